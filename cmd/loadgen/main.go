@@ -0,0 +1,283 @@
+// Command loadgen drives a fixed request rate through the proxy with freshly minted tokens
+// and reports latency percentiles and how many requests were rate limited.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/store"
+)
+
+// maxRPS is the highest -rps the ticker can keep: it fires at most once a nanosecond.
+const maxRPS = float64(time.Second)
+
+type options struct {
+	target      string
+	paths       string
+	method      string
+	rps         float64
+	duration    time.Duration
+	concurrency int
+	timeout     time.Duration
+
+	redisAddr string
+	prefix    string
+	secret    string
+	alg       string
+	tokens    int
+	limit     int
+	window    time.Duration
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.target, "target", "http://localhost:8080", "proxy base URL")
+	flag.StringVar(&o.paths, "paths", "/api/v1/test", "comma-separated paths, requested round-robin")
+	flag.StringVar(&o.method, "method", http.MethodGet, "HTTP method")
+	flag.Float64Var(&o.rps, "rps", 100, "request rate, requests/sec")
+	flag.DurationVar(&o.duration, "duration", 30*time.Second, "test duration")
+	flag.IntVar(&o.concurrency, "concurrency", 64, "max requests in flight; ticks beyond it are counted as missed")
+	flag.DurationVar(&o.timeout, "timeout", 10*time.Second, "per-request timeout")
+
+	flag.StringVar(&o.redisAddr, "redis", "localhost:6379", "Redis address of the proxy, used to store minted tokens")
+	flag.StringVar(&o.prefix, "prefix", "token:", "Redis key prefix (token:<api_key>)")
+	flag.StringVar(&o.secret, "secret", "", "JWT secret of the proxy (required)")
+	flag.StringVar(&o.alg, "alg", "HS256", "JWT algorithm")
+	flag.IntVar(&o.tokens, "tokens", 10, "number of test tokens; requests are spread evenly over them")
+	flag.IntVar(&o.limit, "limit", 1000, "rate limit of each token, requests per window")
+	flag.DurationVar(&o.window, "window", time.Minute, "rate-limit window of the proxy, for the expected 429 share")
+	flag.Parse()
+
+	// run returns instead of exiting, so the minted test tokens are deleted on failure too
+	if err := run(o); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(o options) error {
+	if o.secret == "" {
+		return errors.New("flag -secret is required")
+	}
+	if !(o.rps > 0 && o.rps <= maxRPS) {
+		return fmt.Errorf("flag -rps must be > 0 and <= %g", maxRPS)
+	}
+	if o.tokens <= 0 || o.limit <= 0 || o.concurrency <= 0 {
+		return errors.New("flags -tokens, -limit and -concurrency must be > 0")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rdb := redis.NewClient(&redis.Options{Addr: o.redisAddr})
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	tokenStore := store.NewStore(rdb, o.prefix)
+	issuer := auth.NewIssuer(tokenStore, o.alg, []byte(o.secret))
+
+	jwts := make([]string, 0, o.tokens)
+	apiKeys := make([]string, 0, o.tokens)
+	defer func() {
+		// test tokens are not left behind for anyone to use
+		for _, k := range apiKeys {
+			_ = tokenStore.Delete(context.Background(), k)
+		}
+	}()
+	for i := 0; i < o.tokens; i++ {
+		tok, err := issuer.Issue(ctx, o.limit, o.duration+time.Hour, []string{"*"})
+		if err != nil {
+			return fmt.Errorf("failed to mint token: %w", err)
+		}
+		jwts = append(jwts, tok.JWT)
+		apiKeys = append(apiKeys, tok.APIKey)
+	}
+
+	g := &generator{
+		target: strings.TrimRight(o.target, "/"),
+		paths:  strings.Split(o.paths, ","),
+		method: o.method,
+		jwts:   jwts,
+		client: &http.Client{
+			Timeout:   o.timeout,
+			Transport: &http.Transport{MaxIdleConnsPerHost: o.concurrency},
+		},
+		slots: make(chan struct{}, o.concurrency),
+		stats: newStats(),
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, o.duration)
+	defer cancel()
+
+	start := time.Now()
+	g.run(runCtx, o.rps)
+	elapsed := time.Since(start)
+
+	g.stats.print(os.Stdout, elapsed, expected429(o.rps, elapsed, o.tokens, o.limit, o.window))
+	return nil
+}
+
+// expected429 is the share of requests above the tokens' combined limit, assuming perfect enforcement
+// of fixed windows (a run shorter than a window still gets the full per-window allowance).
+func expected429(rps float64, d time.Duration, tokens, limit int, window time.Duration) float64 {
+	windows := math.Ceil(d.Seconds() / window.Seconds())
+	allowed := float64(tokens*limit) * windows
+	sent := rps * d.Seconds()
+	if sent <= allowed {
+		return 0
+	}
+
+	return 1 - allowed/sent
+}
+
+type generator struct {
+	target string
+	paths  []string
+	method string
+	jwts   []string
+	client *http.Client
+	slots  chan struct{}
+	stats  *stats
+	seq    atomic.Uint64
+}
+
+// run fires requests on a fixed schedule (open loop), so a slow proxy shows up as latency
+// rather than as a lower request rate.
+func (g *generator) run(ctx context.Context, rps float64) {
+	t := time.NewTicker(time.Duration(float64(time.Second) / rps))
+	defer t.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		select {
+		case g.slots <- struct{}{}:
+		default:
+			g.stats.miss()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-g.slots }()
+			g.fire(ctx)
+		}()
+	}
+}
+
+func (g *generator) fire(ctx context.Context) {
+	n := g.seq.Add(1)
+	path := g.paths[n%uint64(len(g.paths))]
+	jwt := g.jwts[n%uint64(len(g.jwts))]
+
+	req, err := http.NewRequestWithContext(ctx, g.method, g.target+path, nil)
+	if err != nil {
+		g.stats.fail()
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	start := time.Now()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			g.stats.fail()
+		}
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	g.stats.add(resp.StatusCode, time.Since(start))
+}
+
+type stats struct {
+	mu        sync.Mutex
+	statuses  map[int]int
+	latencies []time.Duration
+	errors    int
+	missed    int
+}
+
+func newStats() *stats {
+	return &stats{statuses: map[int]int{}}
+}
+
+func (s *stats) add(status int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[status]++
+	s.latencies = append(s.latencies, d)
+}
+
+func (s *stats) fail() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errors++
+}
+
+func (s *stats) miss() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.missed++
+}
+
+func (s *stats) print(w io.Writer, elapsed time.Duration, expected429 float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := len(s.latencies)
+	fmt.Fprintf(w, "requests: %d in %s (%.1f rps), errors: %d, missed ticks: %d\n",
+		total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds(), s.errors, s.missed)
+	if total == 0 {
+		return
+	}
+
+	codes := make([]int, 0, len(s.statuses))
+	for c := range s.statuses {
+		codes = append(codes, c)
+	}
+	slices.Sort(codes)
+	for _, c := range codes {
+		fmt.Fprintf(w, "  %d: %d\n", c, s.statuses[c])
+	}
+
+	fmt.Fprintf(w, "429 rate: %.2f%% (expected %.2f%%)\n",
+		100*float64(s.statuses[http.StatusTooManyRequests])/float64(total), 100*expected429)
+
+	slices.Sort(s.latencies)
+	for _, p := range []float64{0.5, 0.9, 0.99} {
+		fmt.Fprintf(w, "p%-4g %s\n", p*100, s.latencies[int(float64(total-1)*p)].Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "max   %s\n", s.latencies[total-1].Round(time.Microsecond))
+}
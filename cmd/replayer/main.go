@@ -0,0 +1,190 @@
+// Command replayer re-sends traffic recorded by the proxy's capture mode to another environment
+// and compares the statuses and latencies it gets back with the captured ones.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/capture"
+	"tyk-proxy/internal/ratelimit/throttle"
+	"tyk-proxy/internal/store"
+)
+
+func main() {
+	in := flag.String("in", "", "capture file (JSON lines) to replay")
+	kafkaBrokers := flag.String("kafka-brokers", "", "comma-separated Kafka brokers to read captures from instead of -in")
+	kafkaTopic := flag.String("kafka-topic", "", "Kafka topic with captures")
+	kafkaGroup := flag.String("kafka-group", "tyk-replayer", "Kafka consumer group")
+	target := flag.String("target", "http://localhost:8080", "proxy base URL to replay against")
+	rps := flag.Float64("rps", 10, "replay rate, requests/sec")
+	concurrency := flag.Int("concurrency", 8, "requests in flight")
+	maxRecords := flag.Int("n", 0, "stop after this many records (0 = until the source is exhausted)")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+
+	redisAddr := flag.String("redis", "localhost:6379", "Redis of the target environment, used to mint a fresh token")
+	prefix := flag.String("prefix", "token:", "Redis key prefix (token:<api_key>)")
+	secret := flag.String("secret", "", "JWT secret of the target environment (required)")
+	alg := flag.String("alg", "HS256", "JWT algorithm")
+	limit := flag.Int("limit", 1_000_000, "rate limit of the minted token")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("flag -secret is required")
+	}
+	if *in == "" && *kafkaBrokers == "" {
+		log.Fatal("one of -in or -kafka-brokers is required")
+	}
+	if *rps <= 0 || *concurrency <= 0 {
+		log.Fatal("flags -rps and -concurrency must be > 0")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rdb := redis.NewClient(&redis.Options{Addr: *redisAddr})
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+
+	// one fresh token for the whole run; captured credentials were removed at capture time
+	tok, err := auth.NewIssuer(store.NewStore(rdb, *prefix), *alg, []byte(*secret)).
+		Issue(ctx, *limit, 24*time.Hour, []string{"*"})
+	if err != nil {
+		log.Fatalf("Failed to mint token: %v", err)
+	}
+
+	var src source
+	if *kafkaBrokers != "" {
+		src = newKafkaSource(strings.Split(*kafkaBrokers, ","), *kafkaTopic, *kafkaGroup)
+	} else {
+		src, err = newFileSource(*in)
+		if err != nil {
+			log.Fatalf("Failed to open capture file: %v", err)
+		}
+	}
+	defer src.Close()
+
+	r := &replayer{
+		target:  strings.TrimRight(*target, "/"),
+		jwt:     tok.JWT,
+		client:  &http.Client{Timeout: *timeout},
+		pace:    throttle.New(throttle.Options{RPS: *rps, QueueDepth: *concurrency}),
+		report:  newReport(),
+		workers: *concurrency,
+	}
+
+	if err := r.run(ctx, src, *maxRecords); err != nil {
+		log.Printf("replay stopped: %v", err)
+	}
+
+	r.report.print(os.Stdout)
+}
+
+type replayer struct {
+	target  string
+	jwt     string
+	client  *http.Client
+	pace    *throttle.Throttle
+	report  *report
+	workers int
+}
+
+func (r *replayer) run(ctx context.Context, src source, maxRecords int) error {
+	work := make(chan capture.Record)
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range work {
+				r.replay(ctx, rec)
+			}
+		}()
+	}
+	defer func() {
+		close(work)
+		wg.Wait()
+	}()
+
+	for n := 0; maxRecords == 0 || n < maxRecords; n++ {
+		rec, err := src.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case rec.BodyTruncated:
+			r.report.skip("body truncated")
+			continue
+		case rec.BodyOmitted != "":
+			r.report.skip("body omitted: " + rec.BodyOmitted)
+			continue
+		}
+
+		// the queue is as deep as the worker pool, so Wait only fails when ctx is done
+		if err := r.pace.Wait(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case work <- rec:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (r *replayer) replay(ctx context.Context, rec capture.Record) {
+	u := r.target + rec.Path
+	if rec.Query != "" {
+		u += "?" + rec.Query
+	}
+
+	req, err := http.NewRequestWithContext(ctx, rec.Method, u, bytes.NewReader(rec.Body))
+	if err != nil {
+		r.report.skip("invalid request")
+		return
+	}
+
+	for k, vs := range rec.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Del("Content-Length")
+	req.Header.Set("Authorization", "Bearer "+r.jwt)
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		r.report.fail()
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	captured := time.Duration(rec.DurationMs * float64(time.Millisecond))
+	r.report.add(rec.Status, captured, resp.StatusCode, time.Since(start))
+}
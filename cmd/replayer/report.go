@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// report collects replay outcomes and compares them with what was captured.
+type report struct {
+	mu sync.Mutex
+
+	replayed int
+	skipped  map[string]int
+	errors   int
+
+	matched    int
+	mismatches map[[2]int]int // captured status -> replayed status
+
+	captured []time.Duration
+	replay   []time.Duration
+}
+
+func newReport() *report {
+	return &report{
+		skipped:    map[string]int{},
+		mismatches: map[[2]int]int{},
+	}
+}
+
+func (r *report) skip(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.skipped[reason]++
+}
+
+func (r *report) fail() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.replayed++
+	r.errors++
+}
+
+func (r *report) add(capturedStatus int, capturedLatency time.Duration, status int, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.replayed++
+	if capturedStatus == status {
+		r.matched++
+	} else {
+		r.mismatches[[2]int{capturedStatus, status}]++
+	}
+
+	r.captured = append(r.captured, capturedLatency)
+	r.replay = append(r.replay, latency)
+}
+
+func (r *report) print(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintf(w, "replayed: %d (errors: %d)\n", r.replayed, r.errors)
+	for reason, n := range r.skipped {
+		fmt.Fprintf(w, "skipped (%s): %d\n", reason, n)
+	}
+
+	compared := r.replayed - r.errors
+	if compared == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "status matched: %d/%d (%.1f%%)\n", r.matched, compared, 100*float64(r.matched)/float64(compared))
+
+	keys := make([][2]int, 0, len(r.mismatches))
+	for k := range r.mismatches {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return r.mismatches[keys[i]] > r.mismatches[keys[j]] })
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %d -> %d: %d\n", k[0], k[1], r.mismatches[k])
+	}
+
+	fmt.Fprintf(w, "latency      %10s %10s %10s\n", "captured", "replay", "delta")
+	for _, p := range []float64{0.5, 0.9, 0.99} {
+		c, rp := percentile(r.captured, p), percentile(r.replay, p)
+		fmt.Fprintf(w, "  p%-9g %10s %10s %10s\n", p*100, c.Round(time.Microsecond), rp.Round(time.Microsecond), (rp - c).Round(time.Microsecond))
+	}
+}
+
+func percentile(d []time.Duration, p float64) time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+
+	s := slices.Clone(d)
+	slices.Sort(s)
+
+	return s[int(float64(len(s)-1)*p)]
+}
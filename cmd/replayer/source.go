@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/segmentio/kafka-go"
+
+	"tyk-proxy/internal/capture"
+)
+
+// source yields captured records until io.EOF.
+type source interface {
+	Next(ctx context.Context) (capture.Record, error)
+	Close() error
+}
+
+type fileSource struct {
+	f    *os.File
+	sc   *bufio.Scanner
+	line int
+}
+
+func newFileSource(path string) (*fileSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+
+	return &fileSource{f: f, sc: sc}, nil
+}
+
+func (s *fileSource) Next(_ context.Context) (capture.Record, error) {
+	for s.sc.Scan() {
+		s.line++
+		if len(s.sc.Bytes()) == 0 {
+			continue
+		}
+
+		var rec capture.Record
+		if err := json.Unmarshal(s.sc.Bytes(), &rec); err != nil {
+			return capture.Record{}, fmt.Errorf("line %d: %w", s.line, err)
+		}
+		return rec, nil
+	}
+
+	if err := s.sc.Err(); err != nil {
+		return capture.Record{}, err
+	}
+
+	return capture.Record{}, io.EOF
+}
+
+func (s *fileSource) Close() error {
+	return s.f.Close()
+}
+
+type kafkaSource struct {
+	r *kafka.Reader
+}
+
+func newKafkaSource(brokers []string, topic, group string) *kafkaSource {
+	return &kafkaSource{r: kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     group,
+		StartOffset: kafka.FirstOffset,
+	})}
+}
+
+func (s *kafkaSource) Next(ctx context.Context) (capture.Record, error) {
+	msg, err := s.r.ReadMessage(ctx)
+	if err != nil {
+		return capture.Record{}, err
+	}
+
+	var rec capture.Record
+	if err := json.Unmarshal(msg.Value, &rec); err != nil {
+		return capture.Record{}, fmt.Errorf("offset %d: %w", msg.Offset, err)
+	}
+
+	return rec, nil
+}
+
+func (s *kafkaSource) Close() error {
+	return s.r.Close()
+}
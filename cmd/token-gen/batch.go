@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"tyk-proxy/internal/store"
+)
+
+// entry is a token of a batch file; fields left out take the defaults of the flags.
+type entry struct {
+	Name       string   `json:"name"`
+	Limit      *int     `json:"limit"`
+	Routes     []string `json:"routes"`
+	TTL        string   `json:"ttl"`
+	Tier       string   `json:"tier"`
+	Tenant     string   `json:"tenant"`
+	Plan       string   `json:"plan"`
+	SignedURLs *bool    `json:"signed_urls"`
+}
+
+// csvColumns are the columns a CSV batch file may have; its first row names them.
+var csvColumns = map[string]bool{
+	"name": true, "limit": true, "routes": true, "ttl": true,
+	"tier": true, "tenant": true, "plan": true, "signed_urls": true,
+}
+
+// readBatch reads the tokens of a .csv or .json file. def fills what an entry leaves out; planDef does
+// for entries naming their own plan, which inherit its limit and routes unless the flags set them.
+// Every entry is checked before any token is created, so a bad file creates none.
+func readBatch(path string, def, planDef spec) ([]spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []entry
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&entries)
+	case ".csv":
+		entries, err = readCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported batch file %q, want .csv or .json", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no tokens in batch file")
+	}
+
+	specs := make([]spec, 0, len(entries))
+	for i, e := range entries {
+		s, err := e.spec(def, planDef)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if s.Name == "" {
+			s.Name = strconv.Itoa(i + 1)
+		}
+		specs = append(specs, s)
+	}
+
+	return specs, nil
+}
+
+func (e entry) spec(def, planDef spec) (spec, error) {
+	s := def
+	if e.Plan != "" {
+		s = planDef
+		s.Plan = e.Plan
+	}
+	s.Name = e.Name
+
+	if e.Limit != nil {
+		if *e.Limit < store.Unlimited {
+			return spec{}, fmt.Errorf("limit must be >= 0, or -1 for unlimited, got %d", *e.Limit)
+		}
+		s.Limit = *e.Limit
+	}
+	if e.Routes != nil {
+		s.Routes = e.Routes
+	}
+	if e.TTL != "" {
+		ttl, err := time.ParseDuration(e.TTL)
+		if err != nil {
+			return spec{}, fmt.Errorf("ttl: %w", err)
+		}
+		if ttl <= 0 {
+			return spec{}, fmt.Errorf("ttl must be positive, got %s", e.TTL)
+		}
+		s.TTL = ttl
+	}
+	if e.Tier != "" {
+		s.Tier = e.Tier
+	}
+	if e.Tenant != "" {
+		s.Tenant = e.Tenant
+	}
+	if e.SignedURLs != nil {
+		s.SignedURLs = *e.SignedURLs
+	}
+
+	return s, nil
+}
+
+// readCSV reads entries from CSV with a header row; empty cells take the defaults and routes are
+// comma-separated within their (quoted) cell.
+func readCSV(r io.Reader) ([]entry, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	for i, col := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(col))
+		if !csvColumns[header[i]] {
+			return nil, fmt.Errorf("unknown column %q", col)
+		}
+	}
+
+	var entries []entry
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var e entry
+		for i, v := range row {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			switch header[i] {
+			case "name":
+				e.Name = v
+			case "limit":
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: limit: %w", line, err)
+				}
+				e.Limit = &n
+			case "routes":
+				e.Routes = splitCSV(v)
+			case "ttl":
+				e.TTL = v
+			case "tier":
+				e.Tier = v
+			case "tenant":
+				e.Tenant = v
+			case "plan":
+				e.Plan = v
+			case "signed_urls":
+				b, err := strconv.ParseBool(v)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: signed_urls: %w", line, err)
+				}
+				e.SignedURLs = &b
+			}
+		}
+		entries = append(entries, e)
+	}
+}
+
+// runBatch creates the tokens of specs, carrying on past failures, and writes a CSV row per token to
+// report (stdout when empty). It returns the number of tokens that failed.
+func runBatch(ctx context.Context, sv *saver, specs []spec, secret, prefix, report string) int {
+	out := os.Stdout
+	if report != "" {
+		f, err := os.Create(report)
+		if err != nil {
+			log.Fatalf("Failed to create report: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"name", "api_key", "storage_key", "expires_at", "tenant", "plan", "jwt", "signing_secret", "error"})
+
+	failed := 0
+	for _, s := range specs {
+		m, err := mint(s, secret, prefix)
+		if err == nil {
+			err = sv.save(ctx, m)
+		}
+		if err != nil {
+			failed++
+			log.Printf("Failed to create token %s: %v", s.Name, err)
+			_ = w.Write([]string{s.Name, "", "", "", s.Tenant, s.Plan, "", "", err.Error()})
+			continue
+		}
+
+		tok := m.token
+		_ = w.Write([]string{
+			s.Name, tok.APIKey, m.key, tok.ExpiresAt.Format(time.RFC3339), tok.Tenant, tok.Plan, m.jwt, tok.SigningSecret, "",
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+
+	log.Printf("Created %d of %d tokens, %d failed", len(specs)-failed, len(specs), failed)
+	return failed
+}
@@ -3,16 +3,25 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/signedurl"
+	"tyk-proxy/internal/store"
 )
 
 type Claims struct {
@@ -24,81 +33,259 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// spec describes a token to create.
+type spec struct {
+	Name       string
+	Limit      int
+	Routes     []string
+	TTL        time.Duration
+	Tier       string
+	Tenant     string
+	Plan       string
+	SignedURLs bool
+}
+
+// minted is a generated token with its signed JWT.
+type minted struct {
+	key   string // storage key in Redis
+	token store.Token
+	jwt   string
+}
+
 func main() {
 	redisAddr := flag.String("redis", "localhost:6379", "Redis address")
 	prefix := flag.String("prefix", "token:", "Redis key prefix (token:<api_key>)")
 	secret := flag.String("secret", "", "JWT HS256 secret (required)")
-	limit := flag.Int("limit", 10, "Rate limit for api_key")
+	limit := flag.Int("limit", 10, "Rate limit for api_key; 0 inherits the route or global default, -1 is unlimited")
 	ttl := flag.Duration("ttl", 24*time.Hour, "Token TTL")
+	tier := flag.String("tier", "", "token tier, used for fair queueing under the concurrency limit")
+	tenant := flag.String("tenant", "", "Tenant the token belongs to, for the admin token search")
+	pgDSN := flag.String("pg-dsn", "", "PostgreSQL DSN; when set the profile is also written to the tokens table")
 	routes := flag.String("routes", "/api/v1/test,/api/v1/test2,", "Comma-separated allowed routes")
+	plan := flag.String("plan", "", "Config plan the token uses; -limit and -routes then default to none, inheriting the plan's")
+	signing := flag.Bool("signed-urls", false, "Also generate a signing_secret so the token can issue signed URLs")
+	signPath := flag.String("sign-path", "", "Only print a signed URL for this path, using -api-key and -signing-secret")
+	signKey := flag.String("api-key", "", "api_key to sign the URL for (with -sign-path)")
+	signSecret := flag.String("signing-secret", "", "signing_secret of the token (with -sign-path)")
+	offline := flag.Bool("offline", false, "Do not connect to Redis; print the commands that store the token instead, to apply later")
+	format := flag.String("format", "redis", "Output of -offline: redis (redis-cli commands) or json (the token profile)")
+	batch := flag.String("batch", "", "CSV or JSON file of tokens to create; the flags above are the defaults of its entries")
+	report := flag.String("report", "", "File for the CSV report of -batch; defaults to stdout")
 	flag.Parse()
 
+	if *signPath != "" {
+		if *signKey == "" || *signSecret == "" {
+			log.Fatal("flags -api-key and -signing-secret are required with -sign-path")
+		}
+		q := signedurl.Sign(*signKey, *signSecret, *signPath, time.Now().Add(*ttl))
+		fmt.Printf("http://localhost:8080%s?%s\n", *signPath, q.Encode())
+		return
+	}
+
 	if *secret == "" {
 		log.Fatal("flag -secret is required")
 	}
 
-	if *limit <= 0 {
-		log.Fatal("flag -limit must be > 0")
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	def := spec{
+		Limit:      *limit,
+		Routes:     splitCSV(*routes),
+		TTL:        *ttl,
+		Tier:       *tier,
+		Tenant:     *tenant,
+		Plan:       *plan,
+		SignedURLs: *signing,
+	}
+	// a token on a plan inherits the plan's limit and routes unless they are given explicitly
+	planDef := def
+	if !set["limit"] {
+		planDef.Limit = 0
+	}
+	if !set["routes"] {
+		planDef.Routes = nil
+	}
+	if def.Plan != "" {
+		def = planDef
+	}
+
+	if *limit < store.Unlimited {
+		log.Fatal("flag -limit must be >= 0, or -1 for unlimited")
+	}
+	if *offline {
+		if *pgDSN != "" {
+			log.Fatal("flag -pg-dsn cannot be used with -offline")
+		}
+		if *format != "redis" && *format != "json" {
+			log.Fatalf("flag -format must be redis or json, got %q", *format)
+		}
+		if *batch != "" && *report == "" {
+			log.Fatal("flag -report is required with -batch -offline, stdout carries the commands")
+		}
+	}
+
+	specs := []spec{def}
+	if *batch != "" {
+		var err error
+		if specs, err = readBatch(*batch, def, planDef); err != nil {
+			log.Fatalf("Failed to read batch: %v", err)
+		}
 	}
 
 	ctx := context.Background()
-	rdb := redis.NewClient(&redis.Options{Addr: *redisAddr})
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+	sv := &saver{prefix: *prefix}
+	if *offline {
+		sv.offline, sv.format = os.Stdout, *format
+	} else {
+		rdb := redis.NewClient(&redis.Options{Addr: *redisAddr})
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		defer rdb.Close()
+		sv.redis = store.NewStore(rdb, *prefix)
 	}
 
-	defer rdb.Close()
+	if *pgDSN != "" {
+		db, err := sql.Open("pgx", *pgDSN)
+		if err != nil {
+			log.Fatalf("Failed to open PostgreSQL: %v", err)
+		}
+		defer db.Close()
+
+		sv.sql = store.NewSQLStore(db)
+		if err := sv.sql.Migrate(ctx); err != nil {
+			log.Fatalf("Failed to prepare tokens table: %v", err)
+		}
+	}
 
+	if *batch != "" {
+		if failed := runBatch(ctx, sv, specs, *secret, *prefix, *report); failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	m, err := mint(def, *secret, *prefix)
+	if err != nil {
+		log.Fatalf("Failed to generate token: %v", err)
+	}
+	if err := sv.save(ctx, m); err != nil {
+		log.Fatalf("Failed to save token profile: %v", err)
+	}
+
+	out := os.Stdout
+	if *offline {
+		// stdout carries only the commands or profile, so it can be piped to redis-cli or saved as is
+		out = os.Stderr
+		fmt.Fprintln(out, "\nToken generated offline; apply the profile to Redis before using it.")
+	} else {
+		fmt.Fprintln(out, "\nToken created successfully!")
+	}
+	tok := m.token
+	allowedJSON, _ := json.Marshal(tok.AllowedRoutes)
+	fmt.Fprintf(out, "\napi_key: %s\n", tok.APIKey)
+	fmt.Fprintf(out, "api_key in logs: %s\n", auth.HashAPIKey(tok.APIKey))
+	fmt.Fprintf(out, "\nstorage_key: %s\n", m.key)
+	fmt.Fprintf(out, "jwt: %s\n", m.jwt)
+	fmt.Fprintf(out, "\nexpires_at: %s\n", tok.ExpiresAt.Format(time.RFC3339))
+	if tok.Plan != "" {
+		fmt.Fprintf(out, "plan: %s\n", tok.Plan)
+	}
+	if tok.SigningSecret != "" {
+		fmt.Fprintf(out, "signing_secret: %s\n", tok.SigningSecret)
+	}
+	fmt.Fprintf(out, "\nalowed routes: %s\n", string(allowedJSON))
+	fmt.Fprintf(out, "curl example:\n\n")
+	fmt.Fprintf(out, "curl -H 'Authorization: Bearer %s' http://localhost:8080/api/v1/test\n", m.jwt)
+}
+
+// mint generates the api_key, the signing secret if asked for, and the JWT of a token.
+func mint(s spec, secret, prefix string) (minted, error) {
 	apiKey, err := GenerateAPIKey()
 	if err != nil {
-		log.Fatalf("Failed to generate api_key: %v", err)
+		return minted{}, fmt.Errorf("generate api_key: %w", err)
+	}
+
+	jti, err := GenerateAPIKey()
+	if err != nil {
+		return minted{}, fmt.Errorf("generate jti: %w", err)
+	}
+
+	var signingSecret string
+	if s.SignedURLs {
+		if signingSecret, err = GenerateAPIKey(); err != nil {
+			return minted{}, fmt.Errorf("generate signing_secret: %w", err)
+		}
 	}
 
-	expiresAt := time.Now().UTC().Add(*ttl)
-	allowed := splitCSV(*routes)
+	expiresAt := time.Now().UTC().Add(s.TTL).Truncate(time.Second)
+	allowed := s.Routes
+	if allowed == nil {
+		allowed = []string{}
+	}
 
 	// JWT claims: include both expires_at (RFC3339 string) and standard exp (NumericDate)
 	claims := Claims{
 		APIKey:        apiKey,
-		RateLimit:     *limit,
+		RateLimit:     s.Limit,
 		ExpiresAtRFC:  expiresAt.Format(time.RFC3339),
 		AllowedRoutes: allowed,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt), // standard "exp"
 			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ID:        jti,
 		},
 	}
 
 	j := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtStr, err := j.SignedString([]byte(*secret))
+	jwtStr, err := j.SignedString([]byte(secret))
 	if err != nil {
-		log.Fatalf("Failed to sign JWT: %v", err)
+		return minted{}, fmt.Errorf("sign JWT: %w", err)
 	}
 
 	// Store in Redis by api_key
-	key := *prefix + apiKey
-	allowedJSON, _ := json.Marshal(allowed)
-
-	pipe := rdb.TxPipeline()
-	pipe.HSet(ctx, key, map[string]any{
-		"api_key":        apiKey,
-		"rate_limit":     fmt.Sprintf("%d", *limit),
-		"expires_at":     expiresAt.Format(time.RFC3339),
-		"allowed_routes": string(allowedJSON),
-	})
-	pipe.ExpireAt(ctx, key, expiresAt)
-	if _, err := pipe.Exec(ctx); err != nil {
-		log.Fatalf("Failed to save token profile: %v", err)
+	return minted{
+		key: prefix + apiKey,
+		token: store.Token{
+			APIKey:        apiKey,
+			RateLimit:     s.Limit,
+			ExpiresAt:     expiresAt,
+			AllowedRoutes: allowed,
+			Tier:          s.Tier,
+			Tenant:        s.Tenant,
+			Plan:          s.Plan,
+			SigningSecret: signingSecret,
+		},
+		jwt: jwtStr,
+	}, nil
+}
+
+// saver stores token profiles in Redis, or prints them when offline, and in PostgreSQL when configured.
+type saver struct {
+	prefix string
+	redis  *store.Store
+	sql    *store.SQLStore
+
+	offline io.Writer
+	format  string
+}
+
+func (s *saver) save(ctx context.Context, m minted) error {
+	if s.offline != nil {
+		if err := printOffline(s.offline, s.format, s.prefix, m.token); err != nil {
+			return err
+		}
+	} else if err := s.redis.Upsert(ctx, m.token); err != nil {
+		return err
 	}
 
-	fmt.Println("\nToken created successfully!")
-	fmt.Printf("\napi_key: %s\n", apiKey)
-	fmt.Printf("\nstorage_key: %s\n", key)
-	fmt.Printf("jwt: %s\n", jwtStr)
-	fmt.Printf("\nexpires_at: %s\n", expiresAt.Format(time.RFC3339))
-	fmt.Printf("\nalowed routes: %s\n", string(allowedJSON))
-	fmt.Printf("curl example:\n\n")
-	fmt.Printf("curl -H 'Authorization: Bearer %s' http://localhost:8080/api/v1/test\n", jwtStr)
+	if s.sql != nil {
+		if err := s.sql.Upsert(ctx, m.token); err != nil {
+			return fmt.Errorf("postgres: %w", err)
+		}
+	}
+
+	return nil
 }
 
 // simple short api key. We use JWT token encoding later
@@ -123,3 +310,98 @@ func splitCSV(s string) []string {
 
 	return out
 }
+
+// profileFields are the hash fields of the token profile in Redis, in a stable order.
+func profileFields(t store.Token) []string {
+	allowedJSON, _ := json.Marshal(t.AllowedRoutes)
+	fields := []string{
+		"api_key", t.APIKey,
+		"expires_at", t.ExpiresAt.Format(time.RFC3339),
+		"allowed_routes", string(allowedJSON),
+	}
+	if t.RateLimit != 0 {
+		fields = append(fields, "rate_limit", strconv.Itoa(t.RateLimit))
+	}
+	if t.Tier != "" {
+		fields = append(fields, "tier", t.Tier)
+	}
+	if t.Plan != "" {
+		fields = append(fields, "plan", t.Plan)
+	}
+	if t.Tenant != "" {
+		fields = append(fields, "tenant", t.Tenant)
+	}
+	if t.SigningSecret != "" {
+		fields = append(fields, "signing_secret", t.SigningSecret)
+	}
+
+	return fields
+}
+
+// printOffline writes the token profile as redis-cli commands, the same transaction the online mode runs
+// including the index updates, or as a JSON document.
+func printOffline(w io.Writer, format, prefix string, t store.Token) error {
+	key := prefix + t.APIKey
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Key     string      `json:"key"`
+			Profile store.Token `json:"profile"`
+		}{key, t})
+	}
+
+	expiresAt := strconv.FormatInt(t.ExpiresAt.Unix(), 10)
+	cmds := [][]string{
+		{"MULTI"},
+		append([]string{"HSET", key}, profileFields(t)...),
+		{"EXPIREAT", key, expiresAt},
+	}
+	if t.Plan != "" {
+		cmds = append(cmds, []string{"SADD", store.PlanIndex(prefix, t.Plan), t.APIKey})
+	}
+	if t.Tenant != "" {
+		cmds = append(cmds, []string{"SADD", store.TenantIndex(prefix, t.Tenant), t.APIKey})
+	}
+	cmds = append(cmds, []string{"ZADD", store.ExpiryIndex(prefix), expiresAt, t.APIKey}, []string{"EXEC"})
+
+	for _, cmd := range cmds {
+		args := make([]string, len(cmd))
+		for i, a := range cmd {
+			args[i] = quoteArg(a)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(args, " ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// quoteArg quotes s for redis-cli when it holds spaces, quotes or control characters.
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '\'' || r == '\\' || r == 0x7f
+	}) {
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
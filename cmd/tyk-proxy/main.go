@@ -2,29 +2,63 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 
+	"tyk-proxy/internal/admin"
+	"tyk-proxy/internal/analytics"
+	"tyk-proxy/internal/audit"
 	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/botsignal"
+	"tyk-proxy/internal/capture"
 	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/contract"
+	"tyk-proxy/internal/deprecation"
+	"tyk-proxy/internal/experiment"
+	"tyk-proxy/internal/extauthz"
+	"tyk-proxy/internal/flags"
 	"tyk-proxy/internal/handler"
+	"tyk-proxy/internal/hooks"
+	"tyk-proxy/internal/inflight"
+	"tyk-proxy/internal/logship"
 	"tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/opa"
+	"tyk-proxy/internal/pathnorm"
+	"tyk-proxy/internal/ratelimit/adaptive"
+	"tyk-proxy/internal/ratelimit/fairqueue"
 	rate "tyk-proxy/internal/ratelimit/service"
 	rs "tyk-proxy/internal/ratelimit/store"
+	"tyk-proxy/internal/reqcheck"
+	"tyk-proxy/internal/respcache"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/scrub"
+	"tyk-proxy/internal/signedurl"
+	"tyk-proxy/internal/sockopt"
 	"tyk-proxy/internal/store"
+	"tyk-proxy/internal/tlsconf"
+	"tyk-proxy/internal/transcode"
+	"tyk-proxy/internal/waf"
+	"tyk-proxy/internal/watchdog"
 	"tyk-proxy/pkg/redis"
 	"tyk-proxy/pkg/version"
 )
@@ -39,6 +73,24 @@ func main() {
 		return
 	}
 
+	if opts.printSchema {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(config.Schema()); err != nil {
+			slog.Error("Failed to print config schema", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if opts.printEnv {
+		if err := config.PrintEnv(os.Stdout); err != nil {
+			slog.Error("Failed to print environment variables", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := config.ReadConfig(opts.configPath, &opts.envOverrides)
 	if err != nil {
 		slog.Error("Failed to load configuration", "error", err)
@@ -50,35 +102,503 @@ func main() {
 		os.Exit(1)
 	}
 
-	config.InitLogger(cfg)
+	if err := config.InitLogger(ctx, cfg); err != nil {
+		slog.Error("Failed to initialize logger", "error", err)
+		os.Exit(1)
+	}
 	log.Info().Str("level", cfg.Log.Level).Msg("Logger initialized")
 
 	mtx := metrics.GetMetrics()
+	if err := mtx.SetPathClasses(cfg.Monitoring.PathClasses); err != nil {
+		log.Error().Err(err).Msg("Failed to compile metrics path classes")
+		os.Exit(1)
+	}
+	if sd := cfg.Monitoring.StatsD; sd != nil {
+		statsd, err := metrics.NewStatsD(*sd)
+		if err != nil {
+			log.Error().Err(err).Str("addr", sd.Addr).Msg("Failed to set up statsd")
+			os.Exit(1)
+		}
+		defer statsd.Close()
+		go statsd.Run(ctx)
 
-	verifier := auth.NewJWTVerifier(auth.KeySet{
-		ExpectedAlg: cfg.Application.Token.Algorithm,
-		DefaultKey:  []byte(cfg.Application.Token.JWTSecret),
-	})
+		mtx.SetStatsD(statsd)
+		log.Info().Str("addr", sd.Addr).Bool("dogstatsd", sd.DogStatsD).Msg("statsd metrics enabled")
+	}
+	auditLog := audit.New(0)
+
+	var accessLogMw func(http.Handler) http.Handler
+	if cfg.LogShipping.Sink != "" {
+		shipper := logship.New(cfg.LogShipping, logship.NewSink(cfg.LogShipping), mtx)
+		defer shipper.Close()
+
+		auditLog.WithOptions(&audit.Options{OnRecord: shipper.Audit})
+		accessLogMw = shipper.Middleware
+		log.Info().Str("sink", cfg.LogShipping.Sink).Msg("Log shipping enabled")
+	}
+
+	featureFlags := flags.New(cfg.Flags, cfg.Application.Routes)
+
+	keySet, err := auth.LoadKeySet(ctx, cfg.Application.Token, mtx)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid token key material")
+		os.Exit(1)
+	}
+	if keySet.JWKS != nil {
+		go keySet.JWKS.Run(ctx)
+		log.Info().Str("url", cfg.Application.Token.JWKSURL).Dur("refresh", cfg.Application.Token.JWKSRefreshInterval).Msg("JWKS key refresh enabled")
+	}
+
+	var verifier interface {
+		Parse(tokenString string) (*auth.Claims, error)
+	} = auth.NewJWTVerifier(keySet)
+	if tc := cfg.Application.Token; tc.RejectCacheSize > 0 {
+		log.Info().Int("size", tc.RejectCacheSize).Dur("ttl", tc.RejectCacheTTL).Msg("Rejected token cache enabled")
+		verifier = auth.NewRejectCache(verifier, tc.RejectCacheSize, tc.RejectCacheTTL, mtx)
+	}
+	if tc := cfg.Application.Token; tc.VerifyCacheSize > 0 {
+		log.Info().Int("size", tc.VerifyCacheSize).Dur("ttl", tc.VerifyCacheTTL).Msg("Verified token cache enabled")
+		verifier = auth.NewCachingVerifier(verifier, tc.VerifyCacheSize, tc.VerifyCacheTTL)
+	}
 
 	redisConnectCtx, redisConnectCancel := context.WithTimeout(ctx, 5*time.Second)
 	defer redisConnectCancel()
 
-	rd, err := redis.NewRedis(redisConnectCtx, cfg.Redis.Addr)
+	redisTLS, err := tlsconf.Client(cfg.Redis.TLS)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load Redis TLS settings")
+		os.Exit(1)
+	}
+	redisOpts := redis.Options{
+		Username: cfg.Redis.Username,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+		TLS:      redisTLS,
+	}
+	rd, err := redis.NewRedis(redisConnectCtx, cfg.Redis.Addr, redisOpts)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to connect to Redis")
 		os.Exit(1)
 	}
 	defer rd.Close()
 
-	rateStore := rs.NewStore(rd, rs.Options{Prefix: "req_limit:"})
-	limiter := rate.NewRateLimit(rateStore)
+	fo := cfg.Redis.Failover
+	redisHealth := redis.NewHealth(redis.HealthOptions{
+		Window:     fo.Window,
+		Threshold:  fo.ErrorThreshold,
+		MinSamples: fo.MinRequests,
+		OnChange: func(degraded bool, errorRate float64) {
+			mtx.SetRedisDegraded(degraded)
+			log.Warn().Bool("degraded", degraded).Float64("error_rate", errorRate).Str("policy", fo.Policy).
+				Msg("Redis health changed")
+			auditLog.Record(audit.Event{
+				Actor:   "system",
+				Action:  "redis.failover",
+				Target:  "redis",
+				Details: map[string]any{"degraded": degraded, "error_rate": errorRate, "policy": fo.Policy},
+			})
+		},
+	})
+	rd.AddHook(redisHealth)
+
+	sliding := cfg.RateLimitStore.Algorithm == config.RateLimitSlidingWindow
+	if sliding {
+		log.Info().Msg("Rate limits counted over a sliding window")
+	}
+	redisCounters := rs.NewStore(rd, rs.Options{Prefix: "req_limit:", BucketPrefix: "req_bucket:", SlidingWindow: sliding, Metrics: mtx})
+	var counters interface {
+		Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	} = redisCounters
+	if cfg.RateLimitStore.Backend == config.RateLimitBackendMemcached {
+		redisCounters = nil
+		log.Info().Strs("addrs", cfg.RateLimitStore.MemcachedAddrs).Msg("Rate-limit counters kept in Memcached")
+		mc := memcache.New(cfg.RateLimitStore.MemcachedAddrs...)
+		counters = rs.NewMemcachedStore(mc, rs.Options{Prefix: "req_limit:", SlidingWindow: sliding})
+	}
+	if g := cfg.RateLimitStore.Global; g.Addr != "" {
+		globalTLS, err := tlsconf.Client(g.TLS)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load global rate-limit Redis TLS settings")
+			os.Exit(1)
+		}
+		globalOpts := redis.Options{Username: g.Username, Password: g.Password, TLS: globalTLS}
+		globalCtx, globalCancel := context.WithTimeout(ctx, 5*time.Second)
+		grd, err := redis.NewRedis(globalCtx, g.Addr, globalOpts)
+		globalCancel()
+		if err != nil {
+			// the fleet must not wait on another region's Redis to start; syncs retry in the background
+			log.Warn().Err(err).Str("addr", g.Addr).Msg("Global rate-limit Redis unavailable at startup")
+			grd = redis.NewClient(g.Addr, globalOpts)
+		}
+		defer grd.Close()
+
+		global := rs.NewGlobalStore(counters, grd, rs.GlobalOptions{
+			Region:    g.Region,
+			Prefix:    "req_limit_global:",
+			Tolerance: g.Tolerance,
+			Metrics:   mtx,
+		})
+		go global.Run(ctx, g.SyncInterval)
+
+		log.Info().Str("region", g.Region).Dur("sync_interval", g.SyncInterval).Int("tolerance", g.Tolerance).
+			Msg("Rate-limit counters reconciled across regions")
+		counters = global
+	}
+	sh := cfg.RateLimitStore.Sharding
+	limiterOpts := rate.Options{
+		Shards:         sh.Shards,
+		ShardThreshold: sh.MinLimit,
+		Metrics:        mtx,
+	}
+	if cfg.RateLimitStore.Algorithm == config.RateLimitTokenBucket {
+		log.Info().Msg("Rate limits enforced with token buckets")
+		limiterOpts.Buckets = redisCounters
+	}
+	if fb := cfg.RateLimitStore.Fallback; fb.Policy == config.RateLimitFallbackLocal {
+		log.Info().Int("instances", fb.Instances).Int("local_size", fb.LocalSize).
+			Msg("Rate limits counted in process memory while the rate-limit backend fails")
+		limiterOpts.Fallback = rs.NewLocalStore(fb.LocalSize, rs.Options{})
+		limiterOpts.FallbackShare = fb.Instances
+	}
+	limiter := rate.NewRateLimitWithOptions(counters, limiterOpts)
+	if sh.Shards > 1 {
+		log.Info().Int("shards", sh.Shards).Int("min_limit", sh.MinLimit).Msg("Rate-limit counters of busy keys sharded")
+	}
 	hndStore := store.NewStore(rd, "token:")
-	authMdlw := auth.New(hndStore, limiter, verifier)
+	if n := cfg.Redis.SchemaCheckSample; n > 0 {
+		go checkRedisSchema(ctx, hndStore, redisCounters, n)
+	}
+	if cfg.Redis.ReadPreference == config.ReadPreferenceReplica {
+		replicas := redis.NewReplicas(rd, cfg.Redis.ReplicaAddrs, redisOpts, cfg.Redis.MaxStaleness)
+		defer replicas.Close()
+		go replicas.Run(ctx, 5*time.Second)
+
+		log.Info().Strs("replicas", cfg.Redis.ReplicaAddrs).Dur("max_staleness", cfg.Redis.MaxStaleness).
+			Msg("Token lookups read from Redis replicas")
+		hndStore.WithOptions(&store.Options{Reader: replicas.Reader})
+	}
+
+	var tokenStore store.Backend = hndStore
+	if cfg.TokenStore.Backend == config.TokenBackendPostgres {
+		db, err := sql.Open("pgx", cfg.TokenStore.PostgresDSN)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to open PostgreSQL token store")
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		migrateCtx, migrateCancel := context.WithTimeout(ctx, 5*time.Second)
+		sqlStore := store.NewSQLStore(db)
+		err = sqlStore.Migrate(migrateCtx)
+		migrateCancel()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to prepare PostgreSQL token store")
+			os.Exit(1)
+		}
+
+		log.Info().Msg("Token profiles read from PostgreSQL, cached in Redis")
+		tokenStore = store.NewReadThrough(hndStore, sqlStore)
+	}
+
+	if ts := cfg.TokenStore.TykSync; ts != nil {
+		// below the issuer lookup, so keys the sync reads are not looked up there
+		log.Info().Str("url", ts.URL).Dur("interval", ts.Interval).Msg("Keys imported from the Tyk Dashboard")
+		go store.NewTykSync(tokenStore, *ts, limiter.Window(), mtx).Run(ctx, ts.Interval)
+	}
+
+	if ti := cfg.TokenStore.Issuer; ti != nil {
+		log.Info().Str("url", ti.URL).Dur("negative_ttl", ti.NegativeTTL).Msg("Unknown tokens looked up in the token issuer")
+		tokenStore = store.NewIssuerLookup(tokenStore, rd, *ti, mtx)
+	}
+
+	if fo.Policy == config.FailoverPolicyProfiles {
+		key, _ := base64.StdEncoding.DecodeString(fo.Snapshot.Key) // validated with the config
+		snapshot, err := store.NewSnapshot(rd, "token:", fo.Snapshot.Path, key)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to set up token snapshot")
+			os.Exit(1)
+		}
+		if err := snapshot.Load(); err != nil {
+			log.Warn().Err(err).Msg("Existing token snapshot ignored")
+		}
+		go snapshot.Run(ctx, fo.Snapshot.Interval)
+
+		tokenStore = store.NewFallback(tokenStore, snapshot, redisHealth.Degraded)
+	}
+
+	if tc := cfg.TokenStore.Cache; tc.Size > 0 {
+		cached := store.NewCachedStore(tokenStore, tc.Size, tc.TTL)
+		invalidations := store.NewInvalidations(rd, "token_invalidations")
+		cached.WithOptions(&store.CachedOptions{
+			Usage:         store.NewUsage(rd, "token_last_used"),
+			Invalidations: invalidations,
+			Metrics:       mtx,
+		})
+		go invalidations.Run(ctx, cached.Invalidate)
+		if tc.Tracking {
+			tracking := store.NewTracking("token:", cached)
+			trd := redis.NewTrackingClient(cfg.Redis.Addr, redisOpts, tracking.OnConnect)
+			defer trd.Close()
+			go tracking.Run(ctx, trd)
+			log.Info().Msg("Token cache invalidated by Redis key tracking")
+		}
+
+		if tc.WarmUp > 0 {
+			warmCtx, warmCancel := context.WithTimeout(ctx, 10*time.Second)
+			n, err := cached.Warm(warmCtx, tc.WarmUp)
+			warmCancel()
+			if err != nil {
+				log.Warn().Err(err).Int("loaded", n).Msg("Token cache warm-up incomplete")
+			} else {
+				log.Info().Int("loaded", n).Msg("Token cache warmed up")
+			}
+		}
+
+		tokenStore = cached
+	}
+
+	redactor := auth.NewLogRedactor(cfg.Application.Token)
+	authOpts := &auth.Options{
+		DefaultRateLimit: cfg.Application.DefaultRateLimit,
+		Plans:            cfg.Application.Plans,
+		Metrics:          mtx,
+		Redactor:         redactor,
+		FailOpen: func() bool {
+			return fo.Policy == config.FailPolicyOpen && redisHealth.Degraded()
+		},
+		// with profiles the snapshot stands in for the token store, but there is nothing to count against
+		LimiterFailOpen: func() bool {
+			return fo.Policy != config.FailPolicyClosed && redisHealth.Degraded()
+		},
+	}
+	switch cfg.RateLimitStore.Fallback.Policy {
+	case config.RateLimitFallbackOpen:
+		authOpts.LimiterFailOpen = func() bool { return true }
+	case config.RateLimitFallbackClosed:
+		authOpts.LimiterFailOpen = func() bool { return false }
+	}
+	if su := cfg.Application.SignedURLs; su.Enabled {
+		log.Info().Dur("max_ttl", su.MaxTTL).Int("max_uses", su.MaxUses).Msg("Signed URLs enabled")
+		authOpts.SignedURLs = signedurl.New(tokenStore, rd, su, mtx)
+	}
+	var revocations *store.Revocations
+	if rv := cfg.TokenStore.Revocation; rv != nil {
+		log.Info().Msg("Token revocation list enabled")
+		revocations = store.NewRevocations(rd, rv.Prefix)
+		authOpts.Revocations = revocations
+	}
+
+	authMdlw := auth.New(tokenStore, limiter, verifier)
+	authMdlw.WithOptions(authOpts)
 	hnd := handler.NewHandler(cfg.Application.TargetHost, authMdlw, rd)
 
+	var authorizers []func(http.Handler) http.Handler
+	if cfg.OPA.URL != "" {
+		log.Info().Str("url", cfg.OPA.URL).Str("fail_policy", cfg.OPA.FailPolicy).Msg("OPA authorization enabled")
+		authorizers = append(authorizers, opa.New(cfg.OPA, mtx).Handler)
+	}
+	for _, rt := range cfg.Application.Routes {
+		if rt.ExtAuthz != nil {
+			authorizers = append(authorizers, extauthz.New(mtx).Handler)
+			break
+		}
+	}
+
+	upstreamThrottles := handler.UpstreamThrottles(cfg.Application)
+	if ul := cfg.Application.UpstreamRateLimit; ul.RPS > 0 {
+		log.Info().Float64("rps", ul.RPS).Int("queue_depth", ul.QueueDepth).Int("pools", len(upstreamThrottles)).
+			Msg("Upstream throughput limiter enabled")
+	}
+
+	var fairQueue *fairqueue.Queue
+	if cl := cfg.Application.ConcurrencyLimit; cl.MaxInFlight > 0 {
+		log.Info().Int("max_in_flight", cl.MaxInFlight).Int("queue_depth", cl.QueueDepth).
+			Msg("Upstream concurrency limit enabled")
+		fairQueue = fairqueue.New(fairqueue.Options{
+			MaxInFlight: cl.MaxInFlight,
+			QueueDepth:  cl.QueueDepth,
+			MaxWait:     cl.MaxWait,
+			Weights:     cl.TierWeights,
+			OnDepth:     mtx.SetFairQueueDepth,
+		})
+	}
+
+	adaptiveLimits := map[string]*adaptive.Limiter{}
+	for _, rt := range cfg.Application.Routes {
+		ac := rt.AdaptiveConcurrency
+		if ac == nil {
+			continue
+		}
+		log.Info().Str("route", rt.Path).Int("initial_limit", ac.InitialLimit).Msg("Adaptive concurrency limit enabled")
+		adaptiveLimits[rt.Path] = adaptive.New(adaptive.Options{
+			InitialLimit: ac.InitialLimit,
+			MinLimit:     ac.MinLimit,
+			MaxLimit:     ac.MaxLimit,
+			Tolerance:    ac.Tolerance,
+			Window:       ac.Window,
+			OnLimit:      func(limit int) { mtx.SetAdaptiveLimit(rt.Path, limit) },
+		})
+	}
+
+	var captureMw func(http.Handler) http.Handler
+	if cfg.Capture.Sink != "" {
+		sink, err := capture.NewSink(cfg.Capture)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to open capture sink")
+			os.Exit(1)
+		}
+
+		capturer, err := capture.New(cfg.Capture, sink, mtx)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to set up traffic capture")
+			os.Exit(1)
+		}
+		defer capturer.Close()
+
+		log.Info().Str("sink", cfg.Capture.Sink).Float64("sample_rate", cfg.Capture.SampleRate).Msg("Traffic capture enabled")
+		captureMw = capturer.Middleware
+	}
+
+	var analyticsMw func(http.Handler) http.Handler
+	if cfg.Analytics.Sink != "" {
+		sink, err := analytics.NewSink(cfg.Analytics, rd)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to open analytics sink")
+			os.Exit(1)
+		}
+
+		recorder := analytics.New(cfg.Analytics, sink, mtx)
+		defer recorder.Close()
+
+		log.Info().Str("sink", cfg.Analytics.Sink).Msg("Tyk analytics records enabled")
+		analyticsMw = recorder.Middleware
+	}
+
+	var hooksMw func(http.Handler) http.Handler
+	if cfg.Hooks.Enabled() {
+		var hs []hooks.Hook
+		for _, wh := range cfg.Hooks.Webhooks {
+			hs = append(hs, hooks.NewWebhook(wh))
+		}
+		if cfg.Hooks.Usage.Enabled {
+			hs = append(hs, hooks.NewUsage(rd, cfg.Hooks.Usage))
+		}
+
+		hookQueue := hooks.New(cfg.Hooks, hs, mtx)
+		defer hookQueue.Close()
+
+		log.Info().Int("webhooks", len(cfg.Hooks.Webhooks)).Bool("usage", cfg.Hooks.Usage.Enabled).
+			Int("workers", cfg.Hooks.Workers).Msg("Post-response hooks enabled")
+		hooksMw = hookQueue.Middleware
+	}
+
+	contracts, err := contract.New(cfg.Application.Routes, mtx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load route contracts")
+		os.Exit(1)
+	}
+
+	scrubber, err := scrub.New(cfg.Application.ResponseScrub, mtx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to compile response scrub patterns")
+		os.Exit(1)
+	}
+
+	headers, err := reqcheck.New(cfg.Application.Routes, mtx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to compile required route headers")
+		os.Exit(1)
+	}
+
+	transcoder, err := transcode.New(cfg.Application.Routes, mtx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load gRPC transcoding routes")
+		os.Exit(1)
+	}
+
+	upstreamTLS, err := handler.UpstreamTLS(cfg.Application)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load upstream TLS settings")
+		os.Exit(1)
+	}
+
+	respCache := respcache.New(cfg.Application.ResponseCache, featureFlags, mtx)
+
+	var botSignals *botsignal.Scorer
+	if cfg.Application.BotSignals.Enabled {
+		botSignals = botsignal.New(cfg.Application.BotSignals, mtx)
+	}
+
+	var wafEngine *waf.Engine
+	if cfg.WAF.RulesFile != "" {
+		if wafEngine, err = waf.New(cfg.WAF, mtx); err != nil {
+			log.Error().Err(err).Msg("Failed to load WAF rules")
+			os.Exit(1)
+		}
+		log.Info().Str("rules_file", cfg.WAF.RulesFile).Msg("WAF enabled")
+		go wafEngine.Run(ctx)
+	}
+
+	inFlight := inflight.New(inflight.Options{OnChange: mtx.SetInFlight})
+	// keys killed through the admin API of any instance
+	keyKills := store.NewInvalidations(rd, "key_kills")
+	go keyKills.Run(ctx, func(apiKey string) { inFlight.Cancel(apiKey) })
+
+	if wd := cfg.Monitoring.Watchdog; wd.MaxGoroutines > 0 || wd.MaxHeapBytes > 0 {
+		log.Info().Int("max_goroutines", wd.MaxGoroutines).Int64("max_heap_bytes", wd.MaxHeapBytes).
+			Str("profile_dir", wd.ProfileDir).Msg("Watchdog enabled")
+		go watchdog.New(wd, watchdog.Options{InFlight: inFlight, APIKey: redactor.APIKey, Metrics: mtx}).Run(ctx)
+	}
+
+	deprecations := deprecation.New(mtx)
+
+	var upstreamProbe *handler.UpstreamProbe
+	if ru := cfg.Application.ReadyUpstream; ru != nil {
+		upstreamProbe, err = handler.NewUpstreamProbe(cfg.Application.TargetHost, *ru)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to set up the upstream readiness probe")
+			os.Exit(1)
+		}
+		log.Info().Str("mode", ru.Mode).Msg("Readiness includes the upstream")
+	}
+
+	hnd.WithOptions(&handler.Options{
+		Routes:       routes.NewTable(cfg.Application.Routes),
+		Authorizers:  authorizers,
+		Throttles:    upstreamThrottles,
+		Capture:      captureMw,
+		FairQueue:    fairQueue,
+		Adaptive:     adaptiveLimits,
+		Pool:         cfg.Application.UpstreamPool,
+		UpstreamTLS:  upstreamTLS,
+		SLO:          cfg.Monitoring.SLO,
+		Streaming:    cfg.Application.Streaming,
+		InFlight:     inFlight,
+		Contract:     contracts,
+		Scrubber:     scrubber,
+		WAF:          wafEngine,
+		BotSignals:   botSignals,
+		Headers:      headers,
+		Deprecations: deprecations,
+		Experiments:  experiment.New(cfg.Application.Experiments, mtx),
+		Transcoder:   transcoder,
+		Cache:        respCache,
+		AccessLog:    accessLogMw,
+		Analytics:    analyticsMw,
+		Hooks:        hooksMw,
+		Paths:        pathnorm.New(cfg.Application.PathNormalization, mtx),
+
+		ProfileLabels: cfg.Monitoring.Pprof,
+		UpstreamProbe: upstreamProbe,
+
+		MaxBodyBytes:   cfg.Application.MaxBodyBytes,
+		MaxURLLength:   cfg.Application.MaxURLLength,
+		MaxQueryParams: cfg.Application.MaxQueryParams,
+	})
+
 	st := cfg.ServerTimeouts
 	mainSrv := &http.Server{
-		Addr:              fmt.Sprintf(":%d", cfg.Application.Port),
+		Addr:              net.JoinHostPort(cfg.Application.IP, strconv.Itoa(cfg.Application.Port)),
 		Handler:           handler.GetRouter(hnd, mtx),
 		ReadHeaderTimeout: st.ReadHeaderTimeout,
 		ReadTimeout:       st.ReadTimeout,
@@ -86,14 +606,65 @@ func main() {
 		IdleTimeout:       st.IdleTimeout,
 	}
 
-	metricsSrv := newMetricsServer(cfg.Monitoring)
+	if sc := cfg.Application.TLS; sc.CertFile != "" {
+		serverTLS, err := tlsconf.NewServer(sc)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load the listener certificate")
+			os.Exit(1)
+		}
+		log.Info().Str("cert_file", sc.CertFile).Bool("client_ca", sc.ClientCAFile != "").Msg("TLS enabled")
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go serverTLS.Run(ctx, sc.ReloadInterval, hup)
+
+		mainSrv.TLSConfig = serverTLS.Config()
+		if botSignals != nil {
+			mainSrv.TLSConfig.GetConfigForClient = botsignal.ConfigForClient(mainSrv.TLSConfig.GetConfigForClient)
+			mainSrv.ConnContext = botsignal.ConnContext
+		}
+	}
+
+	var adminAPI *admin.API
+	if cfg.Admin.Token != "" {
+		adminOpts := admin.Options{
+			Flags:        featureFlags,
+			Audit:        auditLog,
+			Tokens:       tokenStore,
+			Search:       hndStore,
+			InFlight:     inFlight,
+			Kills:        keyKills,
+			Cache:        respCache,
+			Deprecations: deprecations,
+			Limits: admin.LimitConfig{
+				DefaultRateLimit: cfg.Application.DefaultRateLimit,
+				Plans:            cfg.Application.Plans,
+				Routes:           cfg.Application.Routes,
+				Window:           limiter.Window(),
+				Algorithm:        cfg.RateLimitStore.Algorithm,
+			},
+		}
+		// only a shared secret lets the proxy sign the tokens it creates
+		if secret, ok := keySet.DefaultKey.([]byte); ok {
+			adminOpts.Issuer = auth.NewIssuer(tokenStore, keySet.ExpectedAlg, secret)
+		}
+		if revocations != nil {
+			adminOpts.Revocations = revocations
+		}
+		adminAPI = admin.New(cfg.Admin.Token, adminOpts)
+		if cfg.Monitoring.Port == 0 {
+			log.Warn().Msg("Admin API is configured but the monitoring listener is disabled")
+		}
+	}
+
+	metricsSrv := newMetricsServer(cfg.Monitoring, adminAPI)
 
 	errCh := make(chan error, 2)
 	var wg sync.WaitGroup
 
-	startServer("main", mainSrv, errCh, &wg)
+	startServer(ctx, "main", mainSrv, cfg.Application.Socket, errCh, &wg)
 	if metricsSrv != nil {
-		startServer("metrics", metricsSrv, errCh, &wg)
+		startServer(ctx, "metrics", metricsSrv, config.SocketOptions{}, errCh, &wg)
 	} else {
 		log.Info().Msg("Metrics server is disabled")
 	}
@@ -118,7 +689,47 @@ func main() {
 	log.Info().Msg("Tyk Proxy Service gracefully shutdown")
 }
 
-func newMetricsServer(cfg config.Monitoring) *http.Server {
+// maxLoggedKeys bounds the foreign keys listed in schema check warnings.
+const maxLoggedKeys = 10
+
+// checkRedisSchema warns about keys under the token and counter prefixes that this version cannot read,
+// left by another version or written by another service sharing the Redis instance.
+func checkRedisSchema(ctx context.Context, tokens *store.Store, counters *rs.Store, sample int) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	report, err := tokens.CheckSchema(ctx, sample)
+	switch {
+	case err != nil:
+		log.Warn().Err(err).Msg("Redis schema check of token profiles failed")
+	case !report.OK():
+		log.Warn().Int("sampled", report.Sampled).Interface("invalid", report.Invalid).
+			Interface("unknown_fields", report.UnknownFields).Int("foreign", len(report.Foreign)).
+			Strs("foreign_keys", report.Foreign[:min(len(report.Foreign), maxLoggedKeys)]).
+			Msg("Token profiles in Redis do not match the current schema")
+	default:
+		log.Info().Int("sampled", report.Sampled).Msg("Token profiles in Redis match the current schema")
+	}
+
+	if counters == nil {
+		return
+	}
+	keys, err := counters.CheckKeys(ctx, sample)
+	switch {
+	case err != nil:
+		log.Warn().Err(err).Msg("Redis schema check of rate-limit counters failed")
+	case len(keys.Foreign) > 0:
+		log.Warn().Int("sampled", keys.Sampled).Int("foreign", len(keys.Foreign)).
+			Strs("foreign_keys", keys.Foreign[:min(len(keys.Foreign), maxLoggedKeys)]).
+			Msg("Keys under the rate-limit prefix are not counters, is another service using it?")
+	}
+	if keys.NoExpiry > 0 {
+		log.Warn().Int("sampled", keys.Sampled).Int("no_expiry", keys.NoExpiry).
+			Msg("Rate-limit counters without expiry found in Redis")
+	}
+}
+
+func newMetricsServer(cfg config.Monitoring, adminAPI *admin.API) *http.Server {
 	if cfg.Port == 0 {
 		return nil
 	}
@@ -131,21 +742,36 @@ func newMetricsServer(cfg config.Monitoring) *http.Server {
 	r := chi.NewRouter()
 	r.Use(middleware.Recoverer)
 	r.HandleFunc("/metrics", promhttp.Handler().ServeHTTP)
+	if cfg.Pprof {
+		r.Mount("/debug", middleware.Profiler())
+	}
+	if adminAPI != nil {
+		adminAPI.Routes(r)
+	}
 
 	return &http.Server{
-		Addr:              fmt.Sprintf("%s:%d", host, cfg.Port),
+		Addr:              net.JoinHostPort(host, strconv.Itoa(cfg.Port)),
 		Handler:           r,
 		ReadHeaderTimeout: 3 * time.Second,
 	}
 }
 
-func startServer(name string, srv *http.Server, errCh chan<- error, wg *sync.WaitGroup) {
+func startServer(ctx context.Context, name string, srv *http.Server, sock config.SocketOptions, errCh chan<- error, wg *sync.WaitGroup) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		log.Info().Str("server", name).Str("addr", srv.Addr).Msg("Server starting")
 
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		ln, err := sockopt.Listen(ctx, "tcp", srv.Addr, sock)
+		if err == nil {
+			if srv.TLSConfig != nil {
+				// certificates come from TLSConfig
+				err = srv.ServeTLS(botsignal.Listener(ln), "", "")
+			} else {
+				err = srv.Serve(ln)
+			}
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			select {
 			case errCh <- fmt.Errorf("%s server: %w", name, err):
 			default:
@@ -168,12 +794,16 @@ type startOptions struct {
 	configPath   string
 	envOverrides bool
 	showVersion  bool
+	printSchema  bool
+	printEnv     bool
 }
 
 func preStart() startOptions {
 	configPath := flag.String("config", "", "path to config file")
 	showVersion := flag.Bool("version", false, "show version")
 	envOverrides := flag.Bool("env", false, "override json config values by ENV vars")
+	printSchema := flag.Bool("print-config-schema", false, "print JSON Schema of the config file and exit")
+	printEnv := flag.Bool("print-env", false, "print supported environment variables and exit")
 
 	flag.Parse()
 
@@ -187,6 +817,12 @@ func preStart() startOptions {
 	if showVersion != nil {
 		opts.showVersion = *showVersion
 	}
+	if printSchema != nil {
+		opts.printSchema = *printSchema
+	}
+	if printEnv != nil {
+		opts.printEnv = *printEnv
+	}
 
 	return opts
 }
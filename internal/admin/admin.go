@@ -0,0 +1,178 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/deprecation"
+	"tyk-proxy/internal/flags"
+	"tyk-proxy/internal/inflight"
+)
+
+// ActorHeader optionally names the operator behind an admin call; it is recorded in the audit log.
+const ActorHeader = "X-Admin-Actor"
+
+// API serves the administrative endpoints. It is mounted on the monitoring listener.
+type API struct {
+	token  string
+	flags  *flags.Set
+	audit  *audit.Logger
+	tokens tokenStore
+	issuer tokenIssuer
+	search tokenSearch
+	limits LimitConfig
+
+	revocations revocationList
+
+	inFlight     inFlight
+	kills        killBroadcast
+	cache        responseCache
+	deprecations deprecations
+}
+
+type Options struct {
+	Flags *flags.Set
+	Audit *audit.Logger
+
+	// Tokens enables the /admin/limits and /admin/keys endpoints (kill, pause and resume), and GET and
+	// DELETE /admin/tokens/{api_key}.
+	Tokens tokenStore
+	Limits LimitConfig
+
+	// Issuer, with Tokens, enables POST /admin/tokens. It needs an HMAC algorithm: the proxy holds no
+	// private key for the others.
+	Issuer tokenIssuer
+
+	// Search enables GET /admin/tokens and POST /admin/tokens/reindex.
+	Search tokenSearch
+
+	// Revocations enables POST /admin/revocations. With Tokens, revoking an api key defaults to its profile's expiry.
+	Revocations revocationList
+
+	// InFlight enables GET /admin/inflight and lets POST /admin/keys/{api_key}/kill cancel the key's requests;
+	// without it a killed key is only revoked.
+	InFlight inFlight
+
+	// Kills sends killed keys to every instance, so each cancels its own in-flight requests.
+	Kills killBroadcast
+
+	// Cache enables the /admin/cache endpoints.
+	Cache responseCache
+
+	// Deprecations enables GET /admin/deprecations.
+	Deprecations deprecations
+}
+
+type deprecations interface {
+	Snapshot() []deprecation.RouteUsage
+}
+
+type inFlight interface {
+	Cancel(apiKey string) int
+	Snapshot() []inflight.KeyStats
+}
+
+func New(token string, opts Options) *API {
+	return &API{
+		token:  token,
+		flags:  opts.Flags,
+		audit:  opts.Audit,
+		tokens: opts.Tokens,
+		issuer: opts.Issuer,
+		search: opts.Search,
+		limits: opts.Limits,
+
+		revocations: opts.Revocations,
+
+		inFlight:     opts.InFlight,
+		kills:        opts.Kills,
+		cache:        opts.Cache,
+		deprecations: opts.Deprecations,
+	}
+}
+
+// Routes mounts the admin endpoints under /admin.
+func (a *API) Routes(r chi.Router) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(a.authenticate)
+
+		r.Get("/flags", a.listFlags)
+		r.Put("/flags/{name}", a.setFlag)
+
+		if a.inFlight != nil {
+			r.Get("/inflight", a.listInFlight)
+		}
+
+		if a.deprecations != nil {
+			r.Get("/deprecations", a.listDeprecations)
+		}
+
+		if a.cache != nil {
+			r.Get("/cache", a.listCache)
+			r.Delete("/cache", a.purgeCache)
+		}
+
+		if a.revocations != nil {
+			r.Post("/revocations", a.revoke)
+		}
+
+		if a.search != nil {
+			r.Get("/tokens", a.searchTokens)
+			r.Post("/tokens/reindex", a.reindexTokens)
+		}
+
+		if a.tokens != nil {
+			r.Get("/limits/{api_key}", a.getLimits)
+			r.Put("/limits/{api_key}", a.setLimit)
+			r.Post("/keys/{api_key}/kill", a.killKey)
+			r.Post("/keys/pause", a.pauseKeys)
+			r.Post("/keys/resume", a.resumeKeys)
+			r.Get("/tokens/{api_key}", a.getToken)
+			r.Delete("/tokens/{api_key}", a.deleteToken)
+		}
+
+		if a.tokens != nil && a.issuer != nil {
+			r.Post("/tokens", a.createToken)
+		}
+	})
+}
+
+func (a *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(tok)), []byte(a.token)) != 1 {
+			log.Info().Str("remote", r.RemoteAddr).Str("path", r.URL.Path).Msg("admin request unauthorized")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func actor(r *http.Request) string {
+	if a := r.Header.Get(ActorHeader); a != "" {
+		return a
+	}
+
+	return "admin@" + r.RemoteAddr
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("failed to encode admin response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
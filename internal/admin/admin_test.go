@@ -0,0 +1,633 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/deprecation"
+	"tyk-proxy/internal/flags"
+	"tyk-proxy/internal/inflight"
+	"tyk-proxy/internal/ratelimit/policy"
+	"tyk-proxy/internal/respcache"
+	"tyk-proxy/internal/store"
+)
+
+const testToken = "admin-secret"
+
+func newTestRouter(opts Options) chi.Router {
+	r := chi.NewRouter()
+	New(testToken, opts).Routes(r)
+	return r
+}
+
+func do(r http.Handler, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	r := newTestRouter(Options{Flags: flags.New(nil, nil), Audit: audit.New(10)})
+
+	if rr := do(r, http.MethodGet, "/admin/flags", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := do(r, http.MethodGet, "/admin/flags", "", "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := do(r, http.MethodGet, "/admin/flags", "", testToken); rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestAdmin_SetFlagPerRouteIsAudited(t *testing.T) {
+	fs := flags.New(map[string]bool{config.FlagCache: true}, []config.Route{{Path: "/api/v1/orders*"}, {Path: "/api/v1/users*"}})
+	al := audit.New(10)
+	r := newTestRouter(Options{Flags: fs, Audit: al})
+
+	rr := do(r, http.MethodPut, "/admin/flags/cache", `{"enabled": false, "route": "/api/v1/orders*"}`, testToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusOK, rr.Body)
+	}
+
+	if fs.Enabled(config.FlagCache, "/api/v1/orders*") {
+		t.Fatalf("route flag should be disabled")
+	}
+	if !fs.Enabled(config.FlagCache, "/api/v1/users*") || !fs.Enabled(config.FlagCache, "") {
+		t.Fatalf("global flag should stay enabled")
+	}
+
+	evs := al.Recent(10, nil)
+	if len(evs) != 1 || evs[0].Action != "flag.set" || evs[0].Target != config.FlagCache {
+		t.Fatalf("expected audit event, got %+v", evs)
+	}
+
+	if rr := do(r, http.MethodPut, "/admin/flags/unknown", `{"enabled": true}`, testToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusNotFound)
+	}
+	if rr := do(r, http.MethodPut, "/admin/flags/cache", `{}`, testToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusBadRequest)
+	}
+	if rr := do(r, http.MethodPut, "/admin/flags/cache", `{"enabled": false, "route": "/api/v1/order*"}`, testToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown route: status=%d want=%d", rr.Code, http.StatusBadRequest)
+	}
+	if len(al.Recent(10, nil)) != 1 {
+		t.Fatalf("rejected changes must not be audited")
+	}
+}
+
+type fakeTokens struct {
+	tokens map[string]store.Token
+}
+
+func (f *fakeTokens) GetToken(_ context.Context, key string) (store.Token, error) {
+	t, ok := f.tokens[key]
+	if !ok {
+		return store.Token{}, store.ErrNotFound
+	}
+	return t, nil
+}
+
+func (f *fakeTokens) Upsert(_ context.Context, t store.Token) error {
+	f.tokens[t.APIKey] = t
+	return nil
+}
+
+func (f *fakeTokens) SetRateLimit(_ context.Context, key string, limit int) error {
+	t, ok := f.tokens[key]
+	if !ok {
+		return store.ErrNotFound
+	}
+	t.RateLimit = limit
+	f.tokens[key] = t
+	return nil
+}
+
+func (f *fakeTokens) Delete(_ context.Context, key string) error {
+	delete(f.tokens, key)
+	return nil
+}
+
+func TestAdmin_Limits(t *testing.T) {
+	toks := &fakeTokens{tokens: map[string]store.Token{"k1": {APIKey: "k1"}}}
+	al := audit.New(10)
+	r := newTestRouter(Options{
+		Flags:  flags.New(nil, nil),
+		Audit:  al,
+		Tokens: toks,
+		Limits: LimitConfig{
+			DefaultRateLimit: 50,
+			Routes:           []config.Route{{Path: "/api/v1/search*", RateLimit: 10}, {Path: "/api/v1/*"}},
+			Window:           time.Minute,
+		},
+	})
+
+	get := func() limitsResponse {
+		t.Helper()
+		rr := do(r, http.MethodGet, "/admin/limits/k1", "", testToken)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusOK, rr.Body)
+		}
+		var resp limitsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	resp := get()
+	if resp.Effective.Source != policy.SourceGlobal || resp.Effective.Value != 50 || resp.Effective.Burst != 50 {
+		t.Fatalf("effective=%+v want global 50", resp.Effective)
+	}
+	if len(resp.Routes) != 2 || resp.Routes[0].Effective.Source != policy.SourceRoute || resp.Routes[1].Effective.Value != 50 {
+		t.Fatalf("routes=%+v", resp.Routes)
+	}
+	if resp.Window != "1m0s" || len(resp.History) != 0 {
+		t.Fatalf("window=%q history=%+v", resp.Window, resp.History)
+	}
+
+	if rr := do(r, http.MethodPut, "/admin/limits/k1", `{"rate_limit": 5}`, testToken); rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusOK, rr.Body)
+	}
+
+	resp = get()
+	if resp.Effective.Source != policy.SourceToken || resp.Routes[0].Effective.Value != 5 {
+		t.Fatalf("token override not applied: %+v", resp)
+	}
+	if len(resp.History) != 1 || resp.History[0].Action != ActionLimitSet || resp.History[0].Details["previous"] != float64(0) {
+		t.Fatalf("history=%+v", resp.History)
+	}
+
+	if rr := do(r, http.MethodGet, "/admin/limits/unknown", "", testToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusNotFound)
+	}
+	if rr := do(r, http.MethodPut, "/admin/limits/k1", `{"rate_limit": -2}`, testToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusBadRequest)
+	}
+
+	if rr := do(r, http.MethodPut, "/admin/limits/k1", `{"rate_limit": -1}`, testToken); rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusOK, rr.Body)
+	}
+	resp = get()
+	if !resp.Effective.Unlimited() || resp.Effective.Source != policy.SourceToken || resp.Effective.Burst != 0 {
+		t.Fatalf("effective=%+v want unlimited from the token", resp.Effective)
+	}
+}
+
+type fakeInFlight map[string]int
+
+func (f fakeInFlight) Cancel(key string) int {
+	n := f[key]
+	delete(f, key)
+	return n
+}
+
+func (f fakeInFlight) Snapshot() []inflight.KeyStats {
+	var out []inflight.KeyStats
+	for k, n := range f {
+		out = append(out, inflight.KeyStats{APIKey: k, Count: n, OldestStart: time.Now().Add(-time.Second)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	return out
+}
+
+func TestAdmin_KillKey(t *testing.T) {
+	exp := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	toks := &fakeTokens{tokens: map[string]store.Token{"k1": {APIKey: "k1", ExpiresAt: exp}}}
+	rv := fakeRevocations{}
+	kills := &fakeKills{}
+	al := audit.New(10)
+	r := newTestRouter(Options{
+		Flags:       flags.New(nil, nil),
+		Audit:       al,
+		Tokens:      toks,
+		Revocations: rv,
+		InFlight:    fakeInFlight{"k1": 3},
+		Kills:       kills,
+	})
+
+	rr := do(r, http.MethodPost, "/admin/keys/k1/kill", "", testToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var resp killResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !resp.Revoked || resp.Cancelled != 3 || !resp.Broadcast {
+		t.Fatalf("resp=%+v want revoked with 3 cancelled and broadcast", resp)
+	}
+	if _, ok := toks.tokens["k1"]; ok {
+		t.Fatalf("token profile should be deleted")
+	}
+	if !rv["key:k1"].Equal(exp) {
+		t.Fatalf("key revoked until %v want the profile expiry %v", rv["key:k1"], exp)
+	}
+	if len(kills.keys) != 1 || kills.keys[0] != "k1" {
+		t.Fatalf("broadcast=%v want [k1]", kills.keys)
+	}
+
+	evs := al.Recent(10, nil)
+	if len(evs) != 1 || evs[0].Action != ActionKeyKill || evs[0].Target != "k1" {
+		t.Fatalf("expected audit event, got %+v", evs)
+	}
+
+	rr = do(r, http.MethodPost, "/admin/keys/k1/kill", "", testToken)
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body)
+	}
+	if resp.Revoked || resp.Cancelled != 0 {
+		t.Fatalf("second kill resp=%+v want nothing to revoke", resp)
+	}
+	// without a profile the key stays revoked for killRevocationTTL
+	if until := rv["key:k1"]; until.Before(time.Now().Add(killRevocationTTL - time.Minute)) {
+		t.Fatalf("key revoked until %v want about %v from now", until, killRevocationTTL)
+	}
+}
+
+type fakeKills struct {
+	keys []string
+}
+
+func (f *fakeKills) Publish(_ context.Context, apiKey string) error {
+	f.keys = append(f.keys, apiKey)
+	return nil
+}
+
+type fakeRevocations map[string]time.Time
+
+func (f fakeRevocations) RevokeToken(_ context.Context, jti string, exp time.Time) error {
+	f["jti:"+jti] = exp
+	return nil
+}
+
+func (f fakeRevocations) RevokeKey(_ context.Context, apiKey string, until time.Time) error {
+	f["key:"+apiKey] = until
+	return nil
+}
+
+func TestAdmin_Revoke(t *testing.T) {
+	exp := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	toks := &fakeTokens{tokens: map[string]store.Token{"k1": {APIKey: "k1", ExpiresAt: exp}}}
+	rv := fakeRevocations{}
+	al := audit.New(10)
+	r := newTestRouter(Options{Flags: flags.New(nil, nil), Audit: al, Tokens: toks, Revocations: rv})
+
+	for _, body := range []string{`{}`, `{"jti": "j1", "api_key": "k1"}`, `{"jti": "j1"}`} {
+		if rr := do(r, http.MethodPost, "/admin/revocations", body, testToken); rr.Code != http.StatusBadRequest {
+			t.Fatalf("body %s: status=%d want=%d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+	if rr := do(r, http.MethodPost, "/admin/revocations", `{"api_key": "unknown"}`, testToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusNotFound)
+	}
+
+	if rr := do(r, http.MethodPost, "/admin/revocations", `{"api_key": "k1"}`, testToken); rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body)
+	}
+	if !rv["key:k1"].Equal(exp) {
+		t.Fatalf("key revoked until %v want the profile expiry %v", rv["key:k1"], exp)
+	}
+
+	body := `{"jti": "j1", "expires_at": "` + exp.Format(time.RFC3339) + `"}`
+	if rr := do(r, http.MethodPost, "/admin/revocations", body, testToken); rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body)
+	}
+	if !rv["jti:j1"].Equal(exp) {
+		t.Fatalf("jti revoked until %v want %v", rv["jti:j1"], exp)
+	}
+
+	evs := al.Recent(10, nil)
+	if len(evs) != 2 || evs[0].Action != ActionTokenRevoke {
+		t.Fatalf("expected 2 audit events, got %+v", evs)
+	}
+}
+
+func TestAdmin_PauseResumeKeys(t *testing.T) {
+	toks := &fakeTokens{tokens: map[string]store.Token{"k1": {APIKey: "k1", RateLimit: 7}, "k2": {APIKey: "k2"}}}
+	al := audit.New(10)
+	r := newTestRouter(Options{Flags: flags.New(nil, nil), Audit: al, Tokens: toks})
+
+	bulk := func(path, body string) bulkResponse {
+		t.Helper()
+		rr := do(r, http.MethodPost, path, body, testToken)
+		var resp bulkResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("%s: status=%d body=%s", path, rr.Code, rr.Body)
+		}
+		return resp
+	}
+
+	resp := bulk("/admin/keys/pause", `{"api_keys": ["k1", "k2", "gone"]}`)
+	if resp.Failed != 1 || !resp.Results[0].Changed || resp.Results[2].Error == "" {
+		t.Fatalf("resp=%+v want k1 and k2 paused, gone failed", resp)
+	}
+	if !toks.tokens["k1"].Paused() || toks.tokens["k1"].RateLimit != 7 {
+		t.Fatalf("k1=%+v want paused with its profile kept", toks.tokens["k1"])
+	}
+
+	resp = bulk("/admin/keys/pause", `{"api_keys": ["k1"]}`)
+	if resp.Results[0].Changed {
+		t.Fatalf("resp=%+v pausing a paused key must not change it", resp)
+	}
+
+	resp = bulk("/admin/keys/resume", `{"api_keys": ["k1"]}`)
+	if !resp.Results[0].Changed || resp.Results[0].Status != store.StatusActive || toks.tokens["k1"].Paused() {
+		t.Fatalf("resp=%+v k1=%+v want resumed", resp, toks.tokens["k1"])
+	}
+
+	var actions []string
+	for _, ev := range al.Recent(10, nil) {
+		actions = append(actions, ev.Action+" "+ev.Target)
+	}
+	sort.Strings(actions)
+	if want := []string{"key.pause k1", "key.pause k2", "key.resume k1"}; strings.Join(actions, ",") != strings.Join(want, ",") {
+		t.Fatalf("audit=%v want %v", actions, want)
+	}
+
+	if rr := do(r, http.MethodPost, "/admin/keys/pause", `{"api_keys": []}`, testToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("empty body status=%d want 400", rr.Code)
+	}
+}
+
+func TestAdmin_InFlight(t *testing.T) {
+	r := newTestRouter(Options{Flags: flags.New(nil, nil), Audit: audit.New(10), InFlight: fakeInFlight{"k1": 1, "k2": 4}})
+
+	rr := do(r, http.MethodGet, "/admin/inflight?limit=1", "", testToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var resp inFlightResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Requests != 5 || resp.Keys != 2 || len(resp.Top) != 1 || resp.Top[0].APIKey != "k2" {
+		t.Fatalf("resp=%+v want 5 requests over 2 keys, k2 on top", resp)
+	}
+
+	if rr := do(r, http.MethodGet, "/admin/inflight?limit=0", "", testToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+type fakeCache struct{ purged string }
+
+func (f *fakeCache) Stats() respcache.Stats {
+	return respcache.Stats{Entries: 2, Hits: 3, Misses: 1, HitRate: 0.75}
+}
+
+func (f *fakeCache) Entries(prefix string, limit int) []respcache.EntryInfo {
+	return []respcache.EntryInfo{{Key: prefix + "1"}}[:min(limit, 1)]
+}
+
+func (f *fakeCache) Purge(prefix string) int {
+	f.purged = prefix
+	return 2
+}
+
+func TestAdmin_Cache(t *testing.T) {
+	fc := &fakeCache{}
+	al := audit.New(10)
+	r := newTestRouter(Options{Flags: flags.New(nil, nil), Audit: al, Cache: fc})
+
+	rr := do(r, http.MethodGet, "/admin/cache?prefix=/api/v1/items", "", testToken)
+	var resp cacheResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body)
+	}
+	if resp.HitRate != 0.75 || len(resp.Items) != 1 || resp.Items[0].Key != "/api/v1/items1" {
+		t.Fatalf("resp=%+v", resp)
+	}
+
+	if rr := do(r, http.MethodDelete, "/admin/cache", "", testToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("purge without prefix: status=%d want=%d", rr.Code, http.StatusBadRequest)
+	}
+	if rr := do(r, http.MethodDelete, "/admin/cache?prefix=/api/v1/items", "", testToken); rr.Code != http.StatusOK || fc.purged != "/api/v1/items" {
+		t.Fatalf("purge: status=%d purged=%q", rr.Code, fc.purged)
+	}
+
+	evs := al.Recent(10, nil)
+	if len(evs) != 1 || evs[0].Action != ActionCachePurge || evs[0].Details["purged"] != 2 {
+		t.Fatalf("expected audit event, got %+v", evs)
+	}
+}
+
+type fakeDeprecations []deprecation.RouteUsage
+
+func (f fakeDeprecations) Snapshot() []deprecation.RouteUsage { return f }
+
+func TestAdmin_Deprecations(t *testing.T) {
+	usage := fakeDeprecations{{Route: "/api/v1/legacy*", Keys: []deprecation.KeyUsage{
+		{APIKey: "k2", Count: 5}, {APIKey: "k1", Count: 1},
+	}}}
+	r := newTestRouter(Options{Flags: flags.New(nil, nil), Audit: audit.New(10), Deprecations: usage})
+
+	rr := do(r, http.MethodGet, "/admin/deprecations?limit=1", "", testToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var resp deprecationsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Routes) != 1 || resp.Routes[0].Callers != 2 || len(resp.Routes[0].Keys) != 1 ||
+		resp.Routes[0].Keys[0].APIKey != "k2" {
+		t.Fatalf("resp=%+v want 2 callers, k2 listed", resp)
+	}
+
+	if rr := do(r, http.MethodGet, "/admin/deprecations?limit=x", "", testToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+type fakeSearch struct {
+	tokens []store.Token
+	q      store.Query
+}
+
+func (f *fakeSearch) Search(_ context.Context, q store.Query) ([]store.Token, bool, error) {
+	f.q = q
+	return f.tokens, false, nil
+}
+
+func (f *fakeSearch) Reindex(context.Context) (int, error) { return len(f.tokens), nil }
+
+func TestAdmin_SearchTokens(t *testing.T) {
+	search := &fakeSearch{tokens: []store.Token{
+		{APIKey: "k1", SigningSecret: "s"},
+		{APIKey: "k2", Plan: "partner"},
+		{APIKey: "k3"},
+	}}
+	r := newTestRouter(Options{
+		Flags:  flags.New(nil, nil),
+		Audit:  audit.New(10),
+		Search: search,
+		Limits: LimitConfig{Plans: map[string]config.Plan{"partner": {AllowedRoutes: []string{"/api/v1/users*"}}}},
+	})
+
+	before := time.Now().Add(72 * time.Hour)
+	rr := do(r, http.MethodGet, "/admin/tokens?route=/api/v1/orders*&expiring_before=72h&limit=1", "", testToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusOK, rr.Body)
+	}
+	if strings.Contains(rr.Body.String(), "signing_secret") {
+		t.Fatalf("body=%s leaks the signing secret", rr.Body)
+	}
+	var resp searchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Tokens) != 1 || resp.Tokens[0].APIKey != "k1" || !resp.Truncated {
+		t.Fatalf("resp=%+v want k1 only, truncated", resp)
+	}
+	if search.q.Route != "/api/v1/orders*" || search.q.ExpiringBefore.Sub(before).Abs() > time.Minute {
+		t.Fatalf("query=%+v want the route and expiry window", search.q)
+	}
+
+	// k2's plan does not reach the route, so only k1 and k3 match
+	rr = do(r, http.MethodGet, "/admin/tokens?route=/api/v1/orders", "", testToken)
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Tokens) != 2 || resp.Tokens[1].APIKey != "k3" || resp.Truncated {
+		t.Fatalf("resp=%+v want k1 and k3", resp)
+	}
+
+	al := audit.New(10)
+	r = newTestRouter(Options{Flags: flags.New(nil, nil), Audit: al, Search: search})
+	if rr := do(r, http.MethodPost, "/admin/tokens/reindex", "", testToken); rr.Code != http.StatusOK ||
+		!strings.Contains(rr.Body.String(), `"indexed":3`) {
+		t.Fatalf("status=%d body=%s want 3 indexed", rr.Code, rr.Body)
+	}
+	if ev := al.Recent(1, nil); len(ev) != 1 || ev[0].Action != ActionTokensReindex {
+		t.Fatalf("audit=%+v want the reindex recorded", ev)
+	}
+
+	for _, q := range []string{"limit=0", "expiring_after=tomorrow"} {
+		if rr := do(r, http.MethodGet, "/admin/tokens?"+q, "", testToken); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d want=%d", q, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAdmin_TokenCRUD(t *testing.T) {
+	toks := &fakeTokens{tokens: map[string]store.Token{}}
+	al := audit.New(10)
+	secret := []byte(strings.Repeat("s", 32))
+	r := newTestRouter(Options{
+		Flags:  flags.New(nil, nil),
+		Audit:  al,
+		Tokens: toks,
+		Issuer: auth.NewIssuer(toks, "HS256", secret),
+		Limits: LimitConfig{Plans: map[string]config.Plan{"gold": {RateLimit: 100}}},
+	})
+
+	for _, body := range []string{`{"rate_limit": -2}`, `{"ttl": "-1h"}`, `{"plan": "platinum"}`, `{"ttl": "1h", "expires_at": "2030-01-01T00:00:00Z"}`} {
+		if rr := do(r, http.MethodPost, "/admin/tokens", body, testToken); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d want=%d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	rr := do(r, http.MethodPost, "/admin/tokens", `{"rate_limit": 50, "ttl": "1h", "plan": "gold", "allowed_routes": ["/api/v1/*"], "signed_urls": true}`, testToken)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status=%d want=%d body=%s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	var created createTokenResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	claims, err := auth.NewJWTVerifier(auth.KeySet{ExpectedAlg: "HS256", DefaultKey: secret}).Parse(created.JWT)
+	if err != nil || claims.APIKey != created.APIKey {
+		t.Fatalf("jwt claims=%+v err=%v want api_key %q", claims, err, created.APIKey)
+	}
+	if tok := toks.tokens[created.APIKey]; tok.RateLimit != 50 || tok.Plan != "gold" || tok.SigningSecret != created.SigningSecret || tok.SigningSecret == "" {
+		t.Fatalf("stored token=%+v", tok)
+	}
+
+	rr = do(r, http.MethodGet, "/admin/tokens/"+created.APIKey, "", testToken)
+	var got tokenSummary
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body)
+	}
+	if got.APIKey != created.APIKey || got.RateLimit != 50 || strings.Contains(rr.Body.String(), created.SigningSecret) {
+		t.Fatalf("summary=%s want the profile without secrets", rr.Body)
+	}
+
+	if rr := do(r, http.MethodDelete, "/admin/tokens/"+created.APIKey, "", testToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete status=%d want=%d", rr.Code, http.StatusNoContent)
+	}
+	if rr := do(r, http.MethodGet, "/admin/tokens/"+created.APIKey, "", testToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("get after delete status=%d want=%d", rr.Code, http.StatusNotFound)
+	}
+	if rr := do(r, http.MethodDelete, "/admin/tokens/"+created.APIKey, "", testToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("second delete status=%d want=%d", rr.Code, http.StatusNotFound)
+	}
+
+	evs := al.Recent(10, nil)
+	if len(evs) != 2 || evs[0].Action != ActionTokenDelete || evs[1].Action != ActionTokenCreate {
+		t.Fatalf("audit events=%+v want create and delete", evs)
+	}
+}
+
+func TestAdmin_CreateTokenNeedsIssuer(t *testing.T) {
+	r := newTestRouter(Options{Flags: flags.New(nil, nil), Audit: audit.New(10), Tokens: &fakeTokens{tokens: map[string]store.Token{}}})
+
+	if rr := do(r, http.MethodPost, "/admin/tokens", `{}`, testToken); rr.Code != http.StatusMethodNotAllowed && rr.Code != http.StatusNotFound {
+		t.Fatalf("status=%d want the route unavailable without an issuer", rr.Code)
+	}
+}
+
+func TestAdmin_LimitsBurstAndMethods(t *testing.T) {
+	toks := &fakeTokens{tokens: map[string]store.Token{"k1": {APIKey: "k1", RateLimit: 600, Burst: 100, Plan: "pro"}}}
+	routes := []config.Route{{
+		Path:         "/api/v1/search*",
+		MethodLimits: map[string]config.MethodLimit{http.MethodOptions: {Exempt: true}, http.MethodHead: {Limit: 30}},
+	}}
+	get := func(algorithm string) limitsResponse {
+		t.Helper()
+		r := newTestRouter(Options{
+			Flags:  flags.New(nil, nil),
+			Audit:  audit.New(10),
+			Tokens: toks,
+			Limits: LimitConfig{Routes: routes, Window: time.Minute, Algorithm: algorithm},
+		})
+		rr := do(r, http.MethodGet, "/admin/limits/k1", "", testToken)
+		var resp limitsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body)
+		}
+		return resp
+	}
+
+	resp := get(config.RateLimitTokenBucket)
+	if resp.Effective.Value != 600 || resp.Effective.Burst != 100 {
+		t.Fatalf("effective=%+v want 600 with the token's burst 100", resp.Effective)
+	}
+	methods := resp.Routes[0].Methods
+	if len(methods) != 2 || !methods[http.MethodOptions].Exempt || methods[http.MethodOptions].Effective != nil {
+		t.Fatalf("methods=%+v want OPTIONS exempt", methods)
+	}
+	if head := methods[http.MethodHead].Effective; head == nil || head.Value != 30 || head.Source != policy.SourceMethod || head.Burst != 30 {
+		t.Fatalf("HEAD=%+v want its own limit of 30", head)
+	}
+
+	// a window admits the whole quota at once whatever the token's burst
+	if resp := get(""); resp.Effective.Burst != 600 {
+		t.Fatalf("effective=%+v want a burst of the limit", resp.Effective)
+	}
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/respcache"
+)
+
+// ActionCachePurge is recorded when cached responses are purged.
+const ActionCachePurge = "cache.purge"
+
+// defaultCacheEntriesLimit caps the entries listed by GET /admin/cache unless ?limit= says otherwise.
+const defaultCacheEntriesLimit = 100
+
+type responseCache interface {
+	Stats() respcache.Stats
+	Entries(prefix string, limit int) []respcache.EntryInfo
+	Purge(prefix string) int
+}
+
+type cacheResponse struct {
+	respcache.Stats
+	Items []respcache.EntryInfo `json:"items"`
+}
+
+// listCache reports hit rate and the entries under ?prefix= (keys start with the request path).
+func (a *API) listCache(w http.ResponseWriter, r *http.Request) {
+	limit := defaultCacheEntriesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	writeJSON(w, http.StatusOK, cacheResponse{
+		Stats: a.cache.Stats(),
+		Items: a.cache.Entries(r.URL.Query().Get("prefix"), limit),
+	})
+}
+
+// purgeCache removes the entries under ?prefix=; "/" purges everything.
+func (a *API) purgeCache(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		writeError(w, http.StatusBadRequest, `prefix is required ("/" purges everything)`)
+		return
+	}
+
+	n := a.cache.Purge(prefix)
+	a.audit.Record(audit.Event{
+		Actor:   actor(r),
+		Action:  ActionCachePurge,
+		Target:  prefix,
+		Details: map[string]any{"purged": n},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"prefix": prefix, "purged": n})
+}
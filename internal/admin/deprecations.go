@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"tyk-proxy/internal/deprecation"
+)
+
+// defaultDeprecationKeysLimit caps the keys listed per route by GET /admin/deprecations unless ?limit= says otherwise.
+const defaultDeprecationKeysLimit = 100
+
+type deprecationsResponse struct {
+	Routes []deprecationUsage `json:"routes"`
+}
+
+type deprecationUsage struct {
+	deprecation.RouteUsage
+	// Callers counts distinct api keys; Keys lists the busiest of them.
+	Callers int `json:"callers"`
+}
+
+// listDeprecations reports which api keys called deprecated routes on this instance since it started.
+func (a *API) listDeprecations(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeprecationKeysLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	resp := deprecationsResponse{Routes: []deprecationUsage{}}
+	for _, ru := range a.deprecations.Snapshot() {
+		callers := len(ru.Keys)
+		ru.Keys = ru.Keys[:min(limit, callers)]
+		resp.Routes = append(resp.Routes, deprecationUsage{RouteUsage: ru, Callers: callers})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
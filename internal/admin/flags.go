@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/flags"
+)
+
+type setFlagRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Route   string `json:"route,omitempty"` // route path as configured; empty means global
+}
+
+func (a *API) listFlags(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.flags.Snapshot())
+}
+
+func (a *API) setFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !flags.Known(name) {
+		writeError(w, http.StatusNotFound, "unknown flag")
+		return
+	}
+
+	var req setFlagRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil || req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, `body must be {"enabled": bool, "route": "optional route path"}`)
+		return
+	}
+	if req.Route != "" && !a.flags.HasRoute(req.Route) {
+		writeError(w, http.StatusBadRequest, "unknown route "+req.Route)
+		return
+	}
+
+	prev := a.flags.Set(name, req.Route, *req.Enabled)
+	a.audit.Record(audit.Event{
+		Actor:  actor(r),
+		Action: "flag.set",
+		Target: name,
+		Details: map[string]any{
+			"route":    req.Route,
+			"previous": prev,
+			"enabled":  *req.Enabled,
+		},
+	})
+
+	writeJSON(w, http.StatusOK, a.flags.Snapshot())
+}
@@ -0,0 +1,215 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/inflight"
+	"tyk-proxy/internal/store"
+)
+
+// ActionKeyKill is recorded when a key is revoked and its connections are closed.
+const ActionKeyKill = "key.kill"
+
+// killRevocationTTL is how long a killed key stays on the revocation list when its profile has no future expiry.
+const killRevocationTTL = 24 * time.Hour
+
+type killResponse struct {
+	APIKey    string `json:"api_key"`
+	Revoked   bool   `json:"revoked"`   // false when the profile was already gone
+	Cancelled int    `json:"cancelled"` // in-flight requests cancelled on this instance
+	Broadcast bool   `json:"broadcast"` // the other instances were told to cancel theirs
+}
+
+// killBroadcast tells every instance to cancel the in-flight requests of a killed key.
+type killBroadcast interface {
+	Publish(ctx context.Context, apiKey string) error
+}
+
+// killKey deletes the token profile and puts the key on the revocation list, so new requests fail auth, then
+// cancels the key's in-flight requests and streams here and, through Kills, on the other instances.
+func (a *API) killKey(w http.ResponseWriter, r *http.Request) {
+	apiKey := chi.URLParam(r, "api_key")
+
+	revoked := true
+	tok, err := a.tokens.GetToken(r.Context(), apiKey)
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+		revoked = false
+	}
+	if err := a.tokens.Delete(r.Context(), apiKey); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke token: "+err.Error())
+		return
+	}
+
+	if a.revocations != nil {
+		until := tok.ExpiresAt
+		if now := time.Now(); !until.After(now) {
+			until = now.Add(killRevocationTTL)
+		}
+		if err := a.revocations.RevokeKey(r.Context(), apiKey, until); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to revoke token: "+err.Error())
+			return
+		}
+	}
+
+	cancelled := 0
+	if a.inFlight != nil {
+		cancelled = a.inFlight.Cancel(apiKey)
+	}
+	broadcast := false
+	if a.kills != nil {
+		if err := a.kills.Publish(r.Context(), apiKey); err != nil {
+			log.Warn().Err(err).Msg("failed to send the key kill to other instances")
+		} else {
+			broadcast = true
+		}
+	}
+
+	a.audit.Record(audit.Event{
+		Actor:   actor(r),
+		Action:  ActionKeyKill,
+		Target:  apiKey,
+		Details: map[string]any{"revoked": revoked, "cancelled": cancelled, "broadcast": broadcast},
+	})
+
+	writeJSON(w, http.StatusOK, killResponse{APIKey: apiKey, Revoked: revoked, Cancelled: cancelled, Broadcast: broadcast})
+}
+
+// defaultInFlightLimit caps the keys listed by GET /admin/inflight unless ?limit= says otherwise.
+const defaultInFlightLimit = 100
+
+type inFlightKey struct {
+	inflight.KeyStats
+	OldestAge string `json:"oldest_age"`
+}
+
+type inFlightResponse struct {
+	Requests int           `json:"requests"`
+	Keys     int           `json:"keys"`
+	Top      []inFlightKey `json:"top"` // busiest keys first
+}
+
+func (a *API) listInFlight(w http.ResponseWriter, r *http.Request) {
+	limit := defaultInFlightLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	stats := a.inFlight.Snapshot()
+	resp := inFlightResponse{Keys: len(stats), Top: []inFlightKey{}}
+	now := time.Now()
+	for i, st := range stats {
+		resp.Requests += st.Count
+		if i < limit {
+			resp.Top = append(resp.Top, inFlightKey{KeyStats: st, OldestAge: now.Sub(st.OldestStart).Round(time.Millisecond).String()})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+const (
+	// ActionKeyPause and ActionKeyResume are recorded per key whose status a bulk call changed.
+	ActionKeyPause  = "key.pause"
+	ActionKeyResume = "key.resume"
+)
+
+// maxBulkKeys caps the keys of one bulk call.
+const maxBulkKeys = 1000
+
+type bulkRequest struct {
+	APIKeys []string `json:"api_keys"`
+}
+
+type statusResult struct {
+	APIKey  string `json:"api_key"`
+	Status  string `json:"status,omitempty"`
+	Changed bool   `json:"changed"` // false when the token already had the status
+	Error   string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Results []statusResult `json:"results"`
+	Failed  int            `json:"failed"`
+}
+
+// pauseKeys pauses the tokens of the body's api_keys: their requests get 403 until resumed, while the
+// profiles, limits and counters stay as they are.
+func (a *API) pauseKeys(w http.ResponseWriter, r *http.Request) {
+	a.setKeyStatus(w, r, store.StatusPaused, ActionKeyPause)
+}
+
+// resumeKeys makes paused tokens of the body's api_keys usable again.
+func (a *API) resumeKeys(w http.ResponseWriter, r *http.Request) {
+	a.setKeyStatus(w, r, store.StatusActive, ActionKeyResume)
+}
+
+// setKeyStatus carries on past keys that fail, reporting each key's outcome; the call fails only for a bad body.
+func (a *API) setKeyStatus(w http.ResponseWriter, r *http.Request, status, action string) {
+	var req bulkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil ||
+		len(req.APIKeys) == 0 || len(req.APIKeys) > maxBulkKeys {
+		writeError(w, http.StatusBadRequest, `body must be {"api_keys": [...]} with 1 to `+strconv.Itoa(maxBulkKeys)+" keys")
+		return
+	}
+
+	resp := bulkResponse{Results: make([]statusResult, 0, len(req.APIKeys))}
+	for _, apiKey := range req.APIKeys {
+		res, err := a.setStatus(r.Context(), apiKey, status)
+		if err != nil {
+			res.Error = err.Error()
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, res)
+
+		if res.Changed {
+			a.audit.Record(audit.Event{Actor: actor(r), Action: action, Target: apiKey})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) setStatus(ctx context.Context, apiKey, status string) (statusResult, error) {
+	res := statusResult{APIKey: apiKey}
+
+	tok, err := a.tokens.GetToken(ctx, apiKey)
+	switch {
+	case errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired):
+		return res, errors.New("token not found")
+	case err != nil:
+		return res, fmt.Errorf("token lookup failed: %w", err)
+	}
+
+	res.Status = status
+	if tok.Paused() == (status == store.StatusPaused) {
+		return res, nil
+	}
+
+	// active is stored as the empty status, like profiles written before statuses existed
+	tok.Status = ""
+	if status == store.StatusPaused {
+		tok.Status = store.StatusPaused
+	}
+	if err := a.tokens.Upsert(ctx, tok); err != nil {
+		res.Status = ""
+		return res, fmt.Errorf("failed to update token: %w", err)
+	}
+	res.Changed = true
+
+	return res, nil
+}
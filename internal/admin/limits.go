@@ -0,0 +1,195 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/ratelimit/policy"
+	"tyk-proxy/internal/store"
+)
+
+// ActionLimitSet is recorded whenever a rate limit changes at any layer.
+const ActionLimitSet = "limit.set"
+
+// historySize caps the audit events returned with an effective-limit query.
+const historySize = 20
+
+type tokenStore interface {
+	GetToken(ctx context.Context, apiKey string) (store.Token, error)
+	Upsert(ctx context.Context, t store.Token) error
+	SetRateLimit(ctx context.Context, apiKey string, limit int) error
+	Delete(ctx context.Context, apiKey string) error
+}
+
+// LimitConfig describes the global and route layers of the limit hierarchy.
+type LimitConfig struct {
+	DefaultRateLimit int
+	Plans            map[string]config.Plan
+	Routes           []config.Route
+	Window           time.Duration
+	// Algorithm is rate_limit_store.algorithm; only token buckets honor a token's burst.
+	Algorithm string
+}
+
+type effectiveLimit struct {
+	policy.Limit
+	// Burst is how many requests may arrive at once: the token's burst in a token bucket, the whole quota in a
+	// window.
+	Burst int `json:"burst"`
+}
+
+type routeLimit struct {
+	Path      string                 `json:"path"`
+	Effective effectiveLimit         `json:"effective"`
+	Methods   map[string]methodLimit `json:"methods,omitempty"` // method_limits of the route
+}
+
+// methodLimit is a method exempt from the token quota or counted against a limit of its own.
+type methodLimit struct {
+	Exempt    bool            `json:"exempt,omitempty"`
+	Effective *effectiveLimit `json:"effective,omitempty"` // nil when the method counts against the route's limit
+}
+
+type limitsResponse struct {
+	APIKey         string         `json:"api_key"`
+	TokenRateLimit int            `json:"token_rate_limit"` // 0 means inherited, -1 unlimited
+	Plan           string         `json:"plan,omitempty"`
+	Window         string         `json:"window"`
+	Effective      effectiveLimit `json:"effective"` // for paths without a route
+	Routes         []routeLimit   `json:"routes,omitempty"`
+	History        []audit.Event  `json:"history"`
+}
+
+type setLimitRequest struct {
+	RateLimit *int `json:"rate_limit"`
+}
+
+func (a *API) getLimits(w http.ResponseWriter, r *http.Request) {
+	apiKey := chi.URLParam(r, "api_key")
+
+	tok, ok := a.lookupToken(w, r, apiKey)
+	if !ok {
+		return
+	}
+
+	var plan *config.Plan
+	if p, ok := a.limits.Plans[tok.Plan]; ok {
+		plan = &p
+	}
+
+	resp := limitsResponse{
+		APIKey:         apiKey,
+		TokenRateLimit: tok.RateLimit,
+		Plan:           tok.Plan,
+		Window:         a.limits.Window.String(),
+		Effective:      a.withBurst(policy.Resolve(a.limits.DefaultRateLimit, nil, plan, tok.RateLimit), tok.Burst),
+		History:        a.limitHistory(apiKey),
+	}
+	for i := range a.limits.Routes {
+		rt := &a.limits.Routes[i]
+		effective := policy.Resolve(a.limits.DefaultRateLimit, rt, plan, tok.RateLimit)
+		rl := routeLimit{Path: rt.Path, Effective: a.withBurst(effective, tok.Burst)}
+		for method, ml := range rt.MethodLimits {
+			if rl.Methods == nil {
+				rl.Methods = map[string]methodLimit{}
+			}
+			m := methodLimit{Exempt: ml.Exempt}
+			// as in auth: a method limit replaces the token's unless the token is unlimited, with a burst of the limit
+			if !ml.Exempt && ml.Limit > 0 && !effective.Unlimited() {
+				el := a.withBurst(policy.Limit{Value: ml.Limit, Source: policy.SourceMethod}, 0)
+				m.Effective = &el
+			}
+			rl.Methods[method] = m
+		}
+		resp.Routes = append(resp.Routes, rl)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// setLimit changes the token layer; 0 makes the token inherit the route or global limit, -1 unlimited.
+func (a *API) setLimit(w http.ResponseWriter, r *http.Request) {
+	apiKey := chi.URLParam(r, "api_key")
+
+	var req setLimitRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil ||
+		req.RateLimit == nil || *req.RateLimit < store.Unlimited {
+		writeError(w, http.StatusBadRequest, `body must be {"rate_limit": int >= 0, or -1 for unlimited}`)
+		return
+	}
+
+	tok, ok := a.lookupToken(w, r, apiKey)
+	if !ok {
+		return
+	}
+
+	// only the rate_limit field is written, so changes made to the rest of the profile meanwhile are kept
+	prev := tok.RateLimit
+	err := a.tokens.SetRateLimit(r.Context(), apiKey, *req.RateLimit)
+	switch {
+	case errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired):
+		writeError(w, http.StatusNotFound, "token not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "failed to update token: "+err.Error())
+		return
+	}
+
+	a.audit.Record(audit.Event{
+		Actor:  actor(r),
+		Action: ActionLimitSet,
+		Target: apiKey,
+		Details: map[string]any{
+			"layer":    string(policy.SourceToken),
+			"previous": prev,
+			"limit":    *req.RateLimit,
+		},
+	})
+
+	a.getLimits(w, r)
+}
+
+func (a *API) lookupToken(w http.ResponseWriter, r *http.Request, apiKey string) (store.Token, bool) {
+	tok, err := a.tokens.GetToken(r.Context(), apiKey)
+	switch {
+	case errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired):
+		writeError(w, http.StatusNotFound, "token not found")
+		return store.Token{}, false
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "token lookup failed: "+err.Error())
+		return store.Token{}, false
+	}
+
+	return tok, true
+}
+
+// limitHistory returns limit changes for the token and for the route and global layers it inherits from.
+func (a *API) limitHistory(apiKey string) []audit.Event {
+	return a.audit.Recent(historySize, func(ev audit.Event) bool {
+		if !strings.HasPrefix(ev.Action, "limit.") {
+			return false
+		}
+
+		return ev.Target == apiKey || ev.Details["layer"] != string(policy.SourceToken)
+	})
+}
+
+// withBurst adds the burst of l: with token buckets the token's burst when set, else the limit, which a window
+// admits at once.
+func (a *API) withBurst(l policy.Limit, tokenBurst int) effectiveLimit {
+	if l.Unlimited() {
+		return effectiveLimit{Limit: l}
+	}
+	if a.limits.Algorithm == config.RateLimitTokenBucket && tokenBurst > 0 {
+		return effectiveLimit{Limit: l, Burst: tokenBurst}
+	}
+	return effectiveLimit{Limit: l, Burst: l.Value}
+}
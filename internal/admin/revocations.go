@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/store"
+)
+
+// ActionTokenRevoke is recorded when a token or all tokens of an api key are revoked.
+const ActionTokenRevoke = "token.revoke"
+
+type revocationList interface {
+	RevokeToken(ctx context.Context, jti string, exp time.Time) error
+	RevokeKey(ctx context.Context, apiKey string, until time.Time) error
+}
+
+// revokeRequest names either the jti of one JWT, with its exp, or an api key whose tokens issued so far are
+// revoked until ExpiresAt, by default the expiry of its profile.
+type revokeRequest struct {
+	JTI       string    `json:"jti,omitempty"`
+	APIKey    string    `json:"api_key,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+func (a *API) revoke(w http.ResponseWriter, r *http.Request) {
+	var req revokeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if (req.JTI == "") == (req.APIKey == "") {
+		writeError(w, http.StatusBadRequest, "body must name either jti or api_key")
+		return
+	}
+
+	var err error
+	if req.JTI != "" {
+		if req.ExpiresAt.IsZero() {
+			writeError(w, http.StatusBadRequest, "expires_at (the token's exp) is required with jti")
+			return
+		}
+		err = a.revocations.RevokeToken(r.Context(), req.JTI, req.ExpiresAt)
+	} else {
+		if req.ExpiresAt.IsZero() {
+			if a.tokens == nil {
+				writeError(w, http.StatusBadRequest, "expires_at is required")
+				return
+			}
+			tok, ok := a.lookupToken(w, r, req.APIKey)
+			if !ok {
+				return
+			}
+			req.ExpiresAt = tok.ExpiresAt
+		}
+		err = a.revocations.RevokeKey(r.Context(), req.APIKey, req.ExpiresAt)
+	}
+	switch {
+	case errors.Is(err, store.ErrExpired):
+		writeError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "failed to revoke: "+err.Error())
+		return
+	}
+
+	target, details := req.APIKey, map[string]any{"expires_at": req.ExpiresAt}
+	if req.JTI != "" {
+		target, details["jti"] = "", req.JTI
+	}
+	a.audit.Record(audit.Event{Actor: actor(r), Action: ActionTokenRevoke, Target: target, Details: details})
+
+	writeJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,287 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/store"
+)
+
+const (
+	// ActionTokensReindex is recorded when the token indexes are rebuilt.
+	ActionTokensReindex = "tokens.reindex"
+	// ActionTokenCreate and ActionTokenDelete are recorded when a token is created or deleted.
+	ActionTokenCreate = "token.create"
+	ActionTokenDelete = "token.delete"
+)
+
+// defaultTokenTTL is the lifetime of created tokens without ttl or expires_at, as with token-gen.
+const defaultTokenTTL = 24 * time.Hour
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+type tokenIssuer interface {
+	IssueProfile(ctx context.Context, t store.Token) (auth.Issued, error)
+}
+
+type tokenSearch interface {
+	Search(ctx context.Context, q store.Query) ([]store.Token, bool, error)
+	Reindex(ctx context.Context) (int, error)
+}
+
+// tokenSummary is a token profile without its secrets.
+type tokenSummary struct {
+	APIKey        string    `json:"api_key"`
+	RateLimit     int       `json:"rate_limit"` // 0 means inherited, -1 unlimited
+	ExpiresAt     time.Time `json:"expires_at"`
+	AllowedRoutes []string  `json:"allowed_routes"` // empty allows every route the plan does
+	Tier          string    `json:"tier,omitempty"`
+	Tenant        string    `json:"tenant,omitempty"`
+	Plan          string    `json:"plan,omitempty"`
+	DryRun        bool      `json:"dry_run,omitempty"`
+	Status        string    `json:"status,omitempty"` // paused, or empty for active
+	Disabled      bool      `json:"disabled,omitempty"`
+	Burst         int       `json:"burst,omitempty"`
+}
+
+func summarize(t store.Token) tokenSummary {
+	return tokenSummary{
+		APIKey:        t.APIKey,
+		RateLimit:     t.RateLimit,
+		ExpiresAt:     t.ExpiresAt,
+		AllowedRoutes: t.AllowedRoutes,
+		Tier:          t.Tier,
+		Tenant:        t.Tenant,
+		Plan:          t.Plan,
+		DryRun:        t.DryRun,
+		Status:        t.Status,
+		Disabled:      t.Disabled,
+		Burst:         t.Burst,
+	}
+}
+
+type searchResponse struct {
+	Tokens    []tokenSummary `json:"tokens"`
+	Truncated bool           `json:"truncated"` // more tokens match than limit
+}
+
+// searchTokens lists the tokens matching ?route=, ?plan=, ?tenant=, ?expiring_before= and ?expiring_after=.
+// Times are RFC 3339 or durations from now, e.g. expiring_before=72h.
+func (a *API) searchTokens(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	q := store.Query{Route: qs.Get("route"), Plan: qs.Get("plan"), Tenant: qs.Get("tenant"), Limit: defaultSearchLimit}
+
+	if v := qs.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxSearchLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxSearchLimit))
+			return
+		}
+		q.Limit = n
+	}
+
+	now := time.Now()
+	var err error
+	if q.ExpiringBefore, err = parseInstant(qs.Get("expiring_before"), now); err != nil {
+		writeError(w, http.StatusBadRequest, "expiring_before: "+err.Error())
+		return
+	}
+	if q.ExpiringAfter, err = parseInstant(qs.Get("expiring_after"), now); err != nil {
+		writeError(w, http.StatusBadRequest, "expiring_after: "+err.Error())
+		return
+	}
+
+	// the plan filter below may drop tokens, so fetch them all and apply the limit afterwards
+	limit := q.Limit
+	q.Limit = 0
+	tokens, _, err := a.search.Search(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to search tokens: "+err.Error())
+		return
+	}
+
+	resp := searchResponse{Tokens: []tokenSummary{}}
+	for _, t := range tokens {
+		// a plan's allowed_routes restrict its tokens on top of their own
+		if plan, ok := a.limits.Plans[t.Plan]; ok && q.Route != "" && len(plan.AllowedRoutes) > 0 &&
+			!store.RouteOverlaps(q.Route, plan.AllowedRoutes) {
+			continue
+		}
+		if len(resp.Tokens) == limit {
+			resp.Truncated = true
+			break
+		}
+		resp.Tokens = append(resp.Tokens, summarize(t))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// reindexTokens rebuilds the token indexes from the profiles, e.g. after an upgrade or a restore.
+func (a *API) reindexTokens(w http.ResponseWriter, r *http.Request) {
+	n, err := a.search.Reindex(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to reindex tokens: "+err.Error())
+		return
+	}
+
+	a.audit.Record(audit.Event{
+		Actor:   actor(r),
+		Action:  ActionTokensReindex,
+		Details: map[string]any{"indexed": n},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]int{"indexed": n})
+}
+
+func parseInstant(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), nil
+	}
+
+	return time.Parse(time.RFC3339, v)
+}
+
+type createTokenRequest struct {
+	RateLimit     int       `json:"rate_limit"` // 0 inherits, -1 unlimited
+	Burst         int       `json:"burst"`
+	TTL           string    `json:"ttl"`        // e.g. 720h; default 24h
+	ExpiresAt     time.Time `json:"expires_at"` // instead of ttl
+	AllowedRoutes []string  `json:"allowed_routes"`
+	Tier          string    `json:"tier"`
+	Tenant        string    `json:"tenant"`
+	Plan          string    `json:"plan"`
+	DryRun        bool      `json:"dry_run"`
+	SignedURLs    bool      `json:"signed_urls"` // also generate a signing_secret
+}
+
+type createTokenResponse struct {
+	APIKey        string    `json:"api_key"`
+	JWT           string    `json:"jwt"`
+	JTI           string    `json:"jti"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	SigningSecret string    `json:"signing_secret,omitempty"`
+}
+
+// createToken stores a new token profile and returns its signed JWT. The JWT and signing secret are only
+// returned here; they are not recoverable later.
+func (a *API) createToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	tok := store.Token{
+		RateLimit:     req.RateLimit,
+		Burst:         req.Burst,
+		ExpiresAt:     req.ExpiresAt,
+		AllowedRoutes: req.AllowedRoutes,
+		Tier:          req.Tier,
+		Tenant:        req.Tenant,
+		Plan:          req.Plan,
+		DryRun:        req.DryRun,
+	}
+	switch {
+	case req.TTL != "" && !req.ExpiresAt.IsZero():
+		writeError(w, http.StatusBadRequest, "ttl and expires_at are mutually exclusive")
+		return
+	case req.TTL != "":
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, "ttl must be a positive duration")
+			return
+		}
+		tok.ExpiresAt = time.Now().Add(ttl)
+	case req.ExpiresAt.IsZero():
+		tok.ExpiresAt = time.Now().Add(defaultTokenTTL)
+	}
+	if tok.RateLimit < store.Unlimited {
+		writeError(w, http.StatusBadRequest, "rate_limit must be >= 0, or -1 for unlimited")
+		return
+	}
+	if tok.Burst < 0 {
+		writeError(w, http.StatusBadRequest, "burst must be >= 0")
+		return
+	}
+	if _, ok := a.limits.Plans[tok.Plan]; tok.Plan != "" && !ok {
+		writeError(w, http.StatusBadRequest, "unknown plan "+strconv.Quote(tok.Plan))
+		return
+	}
+	if req.SignedURLs {
+		secret, err := auth.GenerateAPIKey()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to generate signing secret: "+err.Error())
+			return
+		}
+		tok.SigningSecret = secret
+	}
+
+	issued, err := a.issuer.IssueProfile(r.Context(), tok)
+	switch {
+	case errors.Is(err, store.ErrInvalid) || errors.Is(err, store.ErrExpired):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "failed to create token: "+err.Error())
+		return
+	}
+
+	a.audit.Record(audit.Event{
+		Actor:  actor(r),
+		Action: ActionTokenCreate,
+		Target: issued.APIKey,
+		Details: map[string]any{
+			"rate_limit": tok.RateLimit, "expires_at": issued.ExpiresAt, "plan": tok.Plan, "tenant": tok.Tenant,
+		},
+	})
+
+	writeJSON(w, http.StatusCreated, createTokenResponse{
+		APIKey:        issued.APIKey,
+		JWT:           issued.JWT,
+		JTI:           issued.JTI,
+		ExpiresAt:     issued.ExpiresAt,
+		SigningSecret: tok.SigningSecret,
+	})
+}
+
+func (a *API) getToken(w http.ResponseWriter, r *http.Request) {
+	tok, ok := a.lookupToken(w, r, chi.URLParam(r, "api_key"))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summarize(tok))
+}
+
+// deleteToken removes the token profile, so new requests with it fail auth. Unlike a kill, requests
+// already in flight run to completion.
+func (a *API) deleteToken(w http.ResponseWriter, r *http.Request) {
+	apiKey := chi.URLParam(r, "api_key")
+	if _, ok := a.lookupToken(w, r, apiKey); !ok {
+		return
+	}
+
+	if err := a.tokens.Delete(r.Context(), apiKey); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete token: "+err.Error())
+		return
+	}
+
+	a.audit.Record(audit.Event{Actor: actor(r), Action: ActionTokenDelete, Target: apiKey})
+
+	w.WriteHeader(http.StatusNoContent)
+}
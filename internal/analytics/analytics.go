@@ -0,0 +1,174 @@
+// Package analytics emits per-request analytics records in the schema of Tyk's AnalyticsRecord, so Tyk Pump
+// and the pipelines behind it keep working while traffic moves to the proxy.
+package analytics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/async"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+const (
+	resultWritten = "written"
+	resultDropped = "dropped"
+	resultFailed  = "failed"
+
+	maxBatch = 500
+
+	queueName = "analytics"
+)
+
+// Record is the part of Tyk's AnalyticsRecord the proxy can fill in. JSON names follow Tyk's; the Redis sink
+// encodes it with msgpack under the Go field names, as the gateway does.
+type Record struct {
+	Method        string    `json:"method"`
+	Host          string    `json:"host"`
+	Path          string    `json:"path"`
+	RawPath       string    `json:"raw_path"`
+	ContentLength int64     `json:"content_length"`
+	UserAgent     string    `json:"user_agent"`
+	Day           int       `json:"day"`
+	Month         int       `json:"month"`
+	Year          int       `json:"year"`
+	Hour          int       `json:"hour"`
+	ResponseCode  int       `json:"response_code"`
+	APIKey        string    `json:"api_key"` // as logged: hashed unless configured otherwise
+	TimeStamp     time.Time `json:"timestamp"`
+	APIName       string    `json:"api_name"`
+	APIID         string    `json:"api_id"`
+	OrgID         string    `json:"org_id"`
+	RequestTime   int64     `json:"request_time"` // ms
+	Latency       Latency   `json:"latency"`
+	IPAddress     string    `json:"ip_address"`
+	Tags          []string  `json:"tags"`
+	TrackPath     bool      `json:"track_path"`
+	ExpireAt      time.Time `json:"expireAt"`
+}
+
+// Latency is in ms; the proxy does not time the upstream separately, so Upstream stays 0.
+type Latency struct {
+	Total    int64 `json:"total"`
+	Upstream int64 `json:"upstream"`
+}
+
+// Sink stores batches of records.
+type Sink interface {
+	Write(ctx context.Context, recs []Record) error
+	Close() error
+}
+
+// Recorder builds a record for every request passing through Middleware and hands them to a Sink in batches
+// from the background, so a slow sink never delays traffic; records that do not fit the buffer are dropped.
+type Recorder struct {
+	sink    Sink
+	cfg     config.Analytics
+	metrics *mp.Metrics
+
+	queue *async.Queue[Record]
+}
+
+func New(cfg config.Analytics, sink Sink, metrics *mp.Metrics) *Recorder {
+	r := &Recorder{
+		sink:    sink,
+		cfg:     cfg,
+		metrics: metrics,
+	}
+	// a busy proxy writes in batches of what queued up during the previous write
+	r.queue = async.NewBatching(queueName, cfg.BufferSize, maxBatch, 0, r.write, metrics)
+
+	return r
+}
+
+// Middleware records requests once they complete. It must run after decision.Middleware to report the
+// caller's api key.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		elapsed := time.Since(start).Milliseconds()
+		ts := start.UTC()
+
+		apiID, apiName, tracked := rec.cfg.APIID, rec.cfg.APIName, false
+		if rt, ok := routes.FromContext(r.Context()); ok {
+			tracked = true
+			if api, ok := rec.cfg.APIs[rt.Path]; ok {
+				apiID, apiName = api.APIID, api.APIName
+			}
+		}
+		apiKey := ""
+		if d := decision.FromContext(r.Context()); d != nil {
+			apiKey = d.APIKey
+		}
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr // RealIP leaves a bare address
+		}
+
+		rec.enqueue(Record{
+			Method:        r.Method,
+			Host:          r.Host,
+			Path:          r.URL.Path,
+			RawPath:       r.URL.EscapedPath(),
+			ContentLength: max(r.ContentLength, 0),
+			UserAgent:     r.UserAgent(),
+			Day:           ts.Day(),
+			Month:         int(ts.Month()),
+			Year:          ts.Year(),
+			Hour:          ts.Hour(),
+			ResponseCode:  status,
+			APIKey:        apiKey,
+			TimeStamp:     ts,
+			APIName:       apiName,
+			APIID:         apiID,
+			OrgID:         rec.cfg.OrgID,
+			RequestTime:   elapsed,
+			Latency:       Latency{Total: elapsed},
+			IPAddress:     ip,
+			Tags:          rec.cfg.Tags,
+			TrackPath:     tracked,
+			ExpireAt:      ts.Add(rec.cfg.ExpireAfter),
+		})
+	})
+}
+
+func (rec *Recorder) enqueue(r Record) {
+	if !rec.queue.Push(r) {
+		rec.metrics.AddAnalyticsRecords(resultDropped, 1)
+	}
+}
+
+func (rec *Recorder) write(batch []Record) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := rec.sink.Write(ctx, batch); err != nil {
+		log.Debug().Err(err).Int("records", len(batch)).Msg("analytics sink write failed")
+		rec.metrics.AddAnalyticsRecords(resultFailed, len(batch))
+		return
+	}
+	rec.metrics.AddAnalyticsRecords(resultWritten, len(batch))
+}
+
+// Close flushes queued records and closes the sink. Records arriving afterwards are dropped.
+func (rec *Recorder) Close() error {
+	rec.queue.Close()
+
+	return rec.sink.Close()
+}
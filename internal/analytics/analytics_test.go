@@ -0,0 +1,100 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	"tyk-proxy/internal/routes"
+)
+
+type fakeSink struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func (f *fakeSink) Write(_ context.Context, recs []Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, recs...)
+	return nil
+}
+
+func (f *fakeSink) Close() error { return nil }
+
+func TestRecorder_Middleware(t *testing.T) {
+	sink := &fakeSink{}
+	rec := New(config.Analytics{
+		APIs:        map[string]config.AnalyticsAPI{"/api/v1/orders*": {APIID: "orders-id", APIName: "Orders"}},
+		APIID:       "tyk-proxy",
+		APIName:     "tyk-proxy",
+		OrgID:       "org1",
+		ExpireAfter: time.Hour,
+		BufferSize:  10,
+	}, sink, nil)
+
+	table := routes.NewTable([]config.Route{{Path: "/api/v1/orders*"}})
+	h := table.Middleware(decision.Middleware(rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision.FromContext(r.Context()).SetAPIKey("hashed-key")
+		w.WriteHeader(http.StatusTeapot)
+	}))))
+
+	for _, path := range []string{"/api/v1/orders/1", "/api/v1/other"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if len(sink.records) != 2 {
+		t.Fatalf("records=%d want 2", len(sink.records))
+	}
+	r := sink.records[0]
+	if r.APIID != "orders-id" || r.APIName != "Orders" || r.APIKey != "hashed-key" || r.ResponseCode != http.StatusTeapot ||
+		r.IPAddress != "10.0.0.1" || r.OrgID != "org1" || !r.TrackPath || r.ExpireAt.Sub(r.TimeStamp) != time.Hour {
+		t.Fatalf("record=%+v", r)
+	}
+	if r := sink.records[1]; r.APIID != "tyk-proxy" || r.TrackPath {
+		t.Fatalf("record=%+v want the default api, untracked", r)
+	}
+}
+
+func TestRedisSink_Write(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	ts := time.Date(2026, 1, 1, 10, 0, 0, 5, time.UTC)
+	s := NewRedisSink(rdb, "analytics-tyk-system-analytics")
+	if err := s.Write(context.Background(), []Record{{Method: "GET", APIID: "orders-id", TimeStamp: ts}, {}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	items, err := mr.List("analytics-tyk-system-analytics")
+	if err != nil || len(items) != 2 {
+		t.Fatalf("items=%d err=%v want 2", len(items), err)
+	}
+	b := []byte(items[0])
+	// map16 of 22 fields, starting with Method
+	if !bytes.HasPrefix(b, []byte("\xde\x00\x16\xa6Method\xa3GET")) {
+		t.Fatalf("record starts with %q", b[:min(len(b), 16)])
+	}
+	if !bytes.Contains(b, []byte("\xa5APIID\xa9orders-id")) {
+		t.Fatalf("APIID missing")
+	}
+	// TimeStamp as a 96-bit timestamp extension
+	if !bytes.Contains(b, []byte("\xa9TimeStamp\xc7\x0c\xff\x00\x00\x00\x05\x00\x00\x00\x00\x69\x56\x45\xa0")) {
+		t.Fatalf("TimeStamp not encoded as a msgpack timestamp")
+	}
+}
@@ -0,0 +1,124 @@
+package analytics
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// encodeMsgpack encodes rec as the gateway's msgpack library encodes an AnalyticsRecord: a map keyed by Go
+// field names, times as the msgpack timestamp extension. Fields the proxy does not fill are left out; Pump
+// decodes them as zero values.
+func encodeMsgpack(rec Record) []byte {
+	var e msgpackEncoder
+	e.mapHeader(22)
+	e.str("Method").str(rec.Method)
+	e.str("Host").str(rec.Host)
+	e.str("Path").str(rec.Path)
+	e.str("RawPath").str(rec.RawPath)
+	e.str("ContentLength").int(rec.ContentLength)
+	e.str("UserAgent").str(rec.UserAgent)
+	e.str("Day").int(int64(rec.Day))
+	e.str("Month").int(int64(rec.Month))
+	e.str("Year").int(int64(rec.Year))
+	e.str("Hour").int(int64(rec.Hour))
+	e.str("ResponseCode").int(int64(rec.ResponseCode))
+	e.str("APIKey").str(rec.APIKey)
+	e.str("TimeStamp").time(rec.TimeStamp)
+	e.str("APIName").str(rec.APIName)
+	e.str("APIID").str(rec.APIID)
+	e.str("OrgID").str(rec.OrgID)
+	e.str("RequestTime").int(rec.RequestTime)
+	e.str("Latency").mapHeader(2).str("Total").int(rec.Latency.Total).str("Upstream").int(rec.Latency.Upstream)
+	e.str("IPAddress").str(rec.IPAddress)
+	e.str("Tags").strs(rec.Tags)
+	e.str("TrackPath").bool(rec.TrackPath)
+	e.str("ExpireAt").time(rec.ExpireAt)
+
+	return e.buf
+}
+
+// msgpackEncoder writes the few msgpack types analytics records use.
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) mapHeader(n int) *msgpackEncoder {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xde), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdf), uint32(n))
+	}
+	return e
+}
+
+func (e *msgpackEncoder) arrayHeader(n int) *msgpackEncoder {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xdc), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdd), uint32(n))
+	}
+	return e
+}
+
+func (e *msgpackEncoder) str(s string) *msgpackEncoder {
+	switch n := len(s); {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xda), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdb), uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+	return e
+}
+
+func (e *msgpackEncoder) strs(ss []string) *msgpackEncoder {
+	if ss == nil {
+		e.buf = append(e.buf, 0xc0) // nil
+		return e
+	}
+	e.arrayHeader(len(ss))
+	for _, s := range ss {
+		e.str(s)
+	}
+	return e
+}
+
+func (e *msgpackEncoder) int(v int64) *msgpackEncoder {
+	switch {
+	case v >= 0 && v <= 127:
+		e.buf = append(e.buf, byte(v))
+	case v < 0 && v >= -32:
+		e.buf = append(e.buf, byte(v))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xd3), uint64(v))
+	}
+	return e
+}
+
+func (e *msgpackEncoder) bool(b bool) *msgpackEncoder {
+	if b {
+		e.buf = append(e.buf, 0xc3)
+	} else {
+		e.buf = append(e.buf, 0xc2)
+	}
+	return e
+}
+
+// time writes the timestamp extension (type -1) in its 96-bit form, which holds any time.
+func (e *msgpackEncoder) time(t time.Time) *msgpackEncoder {
+	e.buf = append(e.buf, 0xc7, 12, 0xff)
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(t.Nanosecond()))
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(t.Unix()))
+	return e
+}
@@ -0,0 +1,88 @@
+package analytics
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/config"
+)
+
+// RedisSink pushes msgpack records onto the list Tyk Pump's Redis purger reads.
+type RedisSink struct {
+	rdcl redis.UniversalClient
+	key  string
+}
+
+func NewRedisSink(rdcl redis.UniversalClient, key string) *RedisSink {
+	return &RedisSink{rdcl: rdcl, key: key}
+}
+
+func (s *RedisSink) Write(ctx context.Context, recs []Record) error {
+	vals := make([]any, len(recs))
+	for i, r := range recs {
+		vals[i] = encodeMsgpack(r)
+	}
+
+	return s.rdcl.RPush(ctx, s.key, vals...).Err()
+}
+
+// Close leaves the client to its owner.
+func (s *RedisSink) Close() error {
+	return nil
+}
+
+// FileSink appends records to a file as JSON lines.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, recs []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(s.w)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	return s.w.Flush()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.w.Flush(); err != nil {
+		_ = s.f.Close()
+		return err
+	}
+
+	return s.f.Close()
+}
+
+// NewSink builds the sink selected in the analytics config; the redis sink writes through rdcl.
+func NewSink(cfg config.Analytics, rdcl redis.UniversalClient) (Sink, error) {
+	if cfg.Sink == config.AnalyticsSinkRedis {
+		return NewRedisSink(rdcl, cfg.RedisKey), nil
+	}
+
+	return NewFileSink(cfg.File)
+}
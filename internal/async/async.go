@@ -0,0 +1,142 @@
+// Package async runs background work from bounded queues, so features with side effects off the request path
+// (analytics, hooks, log shipping, capture) share one backpressure policy: Push never blocks, items that do not
+// fit are dropped, and every queue exports its depth, capacity, busy workers and drops labeled by name.
+package async
+
+import (
+	"sync"
+	"time"
+
+	mp "tyk-proxy/internal/metrics"
+)
+
+// Queue holds up to its capacity of items for its workers.
+type Queue[T any] struct {
+	name    string
+	metrics *mp.Metrics
+
+	// mu guards closing items: producers such as audit events may still push during shutdown
+	mu     sync.RWMutex
+	closed bool
+	items  chan T
+	wg     sync.WaitGroup
+}
+
+func newQueue[T any](name string, size, workers int, metrics *mp.Metrics) *Queue[T] {
+	size = max(size, 1)
+	metrics.SetAsyncQueue(name, size, workers)
+
+	return &Queue[T]{name: name, metrics: metrics, items: make(chan T, size)}
+}
+
+// New starts workers goroutines calling handle for each item, holding at most size waiting items. name labels
+// the queue in the async_* metrics.
+func New[T any](name string, size, workers int, handle func(T), metrics *mp.Metrics) *Queue[T] {
+	workers = max(workers, 1)
+	q := newQueue[T](name, size, workers, metrics)
+
+	for range workers {
+		q.wg.Add(1)
+		go q.run(handle)
+	}
+
+	return q
+}
+
+// NewBatching starts one goroutine handing items to handle in batches of up to batchSize. A batch is handled
+// once full or, with interval, when interval passes; with interval 0 as soon as no more items are waiting, so
+// batches grow with load. name labels the queue as for New.
+func NewBatching[T any](name string, size, batchSize int, interval time.Duration, handle func([]T), metrics *mp.Metrics) *Queue[T] {
+	q := newQueue[T](name, size, 1, metrics)
+
+	q.wg.Add(1)
+	go q.runBatches(max(batchSize, 1), interval, handle)
+
+	return q
+}
+
+// Push queues item without blocking, reporting whether it fit. Items pushed after Close are dropped.
+func (q *Queue[T]) Push(item T) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if !q.closed {
+		select {
+		case q.items <- item:
+			q.metrics.SetAsyncDepth(q.name, len(q.items))
+			return true
+		default:
+		}
+	}
+
+	q.metrics.IncAsyncDropped(q.name)
+	return false
+}
+
+// Len is the number of waiting items.
+func (q *Queue[T]) Len() int {
+	return len(q.items)
+}
+
+// Close waits for the queued items to be handled and stops the workers.
+func (q *Queue[T]) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.items)
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *Queue[T]) run(handle func(T)) {
+	defer q.wg.Done()
+
+	for item := range q.items {
+		q.metrics.SetAsyncDepth(q.name, len(q.items))
+		q.metrics.AddAsyncBusy(q.name, 1)
+		handle(item)
+		q.metrics.AddAsyncBusy(q.name, -1)
+	}
+}
+
+func (q *Queue[T]) runBatches(batchSize int, interval time.Duration, handle func([]T)) {
+	defer q.wg.Done()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	batch := make([]T, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		q.metrics.AddAsyncBusy(q.name, 1)
+		handle(batch)
+		q.metrics.AddAsyncBusy(q.name, -1)
+		// handle may keep the batch, so the next one gets its own
+		batch = make([]T, 0, batchSize)
+	}
+
+	for {
+		select {
+		case item, ok := <-q.items:
+			if !ok {
+				flush()
+				return
+			}
+			q.metrics.SetAsyncDepth(q.name, len(q.items))
+			batch = append(batch, item)
+			if len(batch) >= batchSize || (interval == 0 && len(q.items) == 0) {
+				flush()
+			}
+		case <-tick:
+			flush()
+		}
+	}
+}
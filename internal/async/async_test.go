@@ -0,0 +1,88 @@
+package async
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue_Workers(t *testing.T) {
+	var mu sync.Mutex
+	var got []int
+	release := make(chan struct{})
+	q := New("test", 1, 2, func(n int) {
+		<-release
+		mu.Lock()
+		got = append(got, n)
+		mu.Unlock()
+	}, nil)
+
+	// both workers take an item and block on it, the queue holds the next
+	for n := range 2 {
+		if !q.Push(n) {
+			t.Fatalf("item %d must be queued", n)
+		}
+		waitEmpty(t, q)
+	}
+	if !q.Push(2) {
+		t.Fatal("item 2 must be queued")
+	}
+	if q.Push(3) {
+		t.Fatal("expected a full queue to drop the item")
+	}
+
+	close(release)
+	q.Close()
+	if q.Push(4) {
+		t.Fatal("expected a closed queue to drop the item")
+	}
+
+	slices.Sort(got)
+	if !slices.Equal(got, []int{0, 1, 2}) {
+		t.Fatalf("handled=%v want [0 1 2]", got)
+	}
+}
+
+func TestQueue_Batches(t *testing.T) {
+	var batches [][]int
+	q := NewBatching("test", 10, 3, time.Hour, func(b []int) { batches = append(batches, b) }, nil)
+
+	for n := range 5 {
+		q.Push(n)
+	}
+	q.Close() // flushes the partial batch
+
+	if len(batches) != 2 || !slices.Equal(batches[0], []int{0, 1, 2}) || !slices.Equal(batches[1], []int{3, 4}) {
+		t.Fatalf("batches=%v want [[0 1 2] [3 4]]", batches)
+	}
+}
+
+func TestQueue_BatchesWhenIdle(t *testing.T) {
+	handled := make(chan []int, 1)
+	q := NewBatching("test", 10, 100, 0, func(b []int) { handled <- b }, nil)
+	defer q.Close()
+
+	// without an interval a lone item is handled once nothing else waits
+	q.Push(1)
+	select {
+	case b := <-handled:
+		if !slices.Equal(b, []int{1}) {
+			t.Fatalf("batch=%v want [1]", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("item was not handled")
+	}
+}
+
+func waitEmpty[T any](t *testing.T, q *Queue[T]) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for q.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("workers did not take the queued item")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
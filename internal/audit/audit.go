@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Event is a single administrative change.
+type Event struct {
+	Time    time.Time      `json:"time"`
+	Actor   string         `json:"actor"`
+	Action  string         `json:"action"`
+	Target  string         `json:"target"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Logger writes audit events to the application log and keeps the most recent ones in memory.
+type Logger struct {
+	mu     sync.Mutex
+	events []Event
+	size   int
+	next   int
+	full   bool
+
+	// onRecord receives every event after it is stored, e.g. to ship it off the host
+	onRecord func(Event)
+
+	// for tests
+	now func() time.Time
+}
+
+type Options struct {
+	Now func() time.Time
+
+	// OnRecord is called with every recorded event; it must not block.
+	OnRecord func(Event)
+}
+
+const defaultSize = 1000
+
+func New(size int) *Logger {
+	if size <= 0 {
+		size = defaultSize
+	}
+
+	return &Logger{
+		events: make([]Event, size),
+		size:   size,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (l *Logger) WithOptions(opts *Options) {
+	now := opts.Now
+	if now == nil {
+		now = func() time.Time { return time.Now().UTC() }
+	}
+
+	l.now = now
+	l.onRecord = opts.OnRecord
+}
+
+func (l *Logger) Record(ev Event) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	if ev.Time.IsZero() {
+		ev.Time = l.now()
+	}
+	l.events[l.next] = ev
+	l.next = (l.next + 1) % l.size
+	if l.next == 0 {
+		l.full = true
+	}
+	l.mu.Unlock()
+
+	log.Info().
+		Str("type", "audit").
+		Str("actor", ev.Actor).
+		Str("action", ev.Action).
+		Str("target", ev.Target).
+		Interface("details", ev.Details).
+		Msg("audit event")
+
+	if l.onRecord != nil {
+		l.onRecord(ev)
+	}
+}
+
+// Recent returns up to n most recent events (newest first) accepted by match; nil match accepts all.
+func (l *Logger) Recent(n int, match func(Event) bool) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+	if l.full {
+		count = l.size
+	}
+
+	out := make([]Event, 0, min(n, count))
+	for i := 0; i < count && len(out) < n; i++ {
+		ev := l.events[(l.next-1-i+l.size)%l.size]
+		if match == nil || match(ev) {
+			out = append(out, ev)
+		}
+	}
+
+	return out
+}
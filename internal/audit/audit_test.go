@@ -0,0 +1,26 @@
+package audit
+
+import "testing"
+
+func TestRecent_NewestFirstAndWraps(t *testing.T) {
+	l := New(3)
+	for _, target := range []string{"a", "b", "c", "d"} {
+		l.Record(Event{Action: "flag.set", Target: target})
+	}
+
+	got := l.Recent(10, nil)
+	if len(got) != 3 {
+		t.Fatalf("len=%d want=3", len(got))
+	}
+	if got[0].Target != "d" || got[2].Target != "b" {
+		t.Fatalf("unexpected order: %+v", got)
+	}
+	if got[0].Time.IsZero() {
+		t.Fatalf("time should be set")
+	}
+
+	filtered := l.Recent(10, func(ev Event) bool { return ev.Target == "c" })
+	if len(filtered) != 1 || filtered[0].Target != "c" {
+		t.Fatalf("unexpected filtered events: %+v", filtered)
+	}
+}
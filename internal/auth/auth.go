@@ -7,11 +7,21 @@ import (
 	"strings"
 	"time"
 
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/ratelimit/policy"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/signedurl"
 	"tyk-proxy/internal/store"
 
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
+// planLimitPrefix keys aggregate plan counters in the limiter; api keys never contain a colon.
+const planLimitPrefix = "plan:"
+
 type Token struct {
 	APIKey        string    `json:"api_key"`
 	RateLimit     int       `json:"rate_limit"`
@@ -24,7 +34,17 @@ type tokenStore interface {
 }
 
 type limiter interface {
-	Allow(ctx context.Context, key string, limit int) (bool, error)
+	Allow(ctx context.Context, key string, limit, burst int) (bool, error)
+}
+
+// signedURLs verifies signed URLs and returns the token profile they were issued for.
+type signedURLs interface {
+	Verify(ctx context.Context, r *http.Request) (store.Token, error)
+}
+
+// revocations reports tokens revoked before their expiry.
+type revocations interface {
+	Revoked(ctx context.Context, apiKey, jti string, issuedAt time.Time) (bool, error)
 }
 
 // verifier verifies and parses JWT.
@@ -37,18 +57,67 @@ type AuthorizationMiddlewareService struct {
 	limiter  limiter
 	verifier verifier
 	now      func() time.Time
+
+	// renders api keys and claims for the decision log
+	redactor *LogRedactor
+
+	// authenticates GET and HEAD requests without an Authorization header by signed URL, nil when disabled
+	signedURLs signedURLs
+
+	// rejects revoked bearer tokens, nil when disabled
+	revocations revocations
+
+	// defaultLimit applies when neither the token nor the matched route sets a rate limit
+	defaultLimit int
+
+	// plans by name, referenced by token profiles
+	plans map[string]config.Plan
+
+	// counts denials let through in dry run
+	metrics *mp.Metrics
+
+	// failOpen and limiterFailOpen report whether requests may pass while the token store
+	// or the limiter is failing
+	failOpen        func() bool
+	limiterFailOpen func() bool
 }
 
 type Options struct {
 	Now func() time.Time
+
+	// DefaultRateLimit is the global layer of the limit hierarchy, see policy.Resolve.
+	DefaultRateLimit int
+
+	// Plans are the named limits token profiles may reference; a token naming an unknown plan is rejected.
+	Plans map[string]config.Plan
+
+	// Redactor controls how the api_key and claims are logged; nil hashes the api_key and logs no claims.
+	Redactor *LogRedactor
+
+	// FailOpen, when it returns true, lets requests through on their JWT claims alone if the token
+	// store fails, and unlimited if the rate limiter fails. Nil means always fail closed.
+	FailOpen func() bool
+	// LimiterFailOpen overrides FailOpen for the rate limiter only.
+	LimiterFailOpen func() bool
+
+	// Metrics counts denials of dry-run tokens and routes; nil disables counting.
+	Metrics *mp.Metrics
+
+	// SignedURLs enables signed URL access; they are rate limited like the token they were issued for.
+	SignedURLs signedURLs
+
+	// Revocations rejects bearer tokens revoked by jti or api key before they expire.
+	Revocations revocations
 }
 
 func New(store tokenStore, limiter limiter, verifier verifier) *AuthorizationMiddlewareService {
 	return &AuthorizationMiddlewareService{
-		store:    store,
-		limiter:  limiter,
-		verifier: verifier,
-		now:      func() time.Time { return time.Now().UTC() },
+		store:           store,
+		limiter:         limiter,
+		verifier:        verifier,
+		now:             func() time.Time { return time.Now().UTC() },
+		failOpen:        func() bool { return false },
+		limiterFailOpen: func() bool { return false },
 	}
 }
 
@@ -63,89 +132,383 @@ func (m *AuthorizationMiddlewareService) WithOptions(opts *Options) {
 	}
 
 	m.now = now
+	m.defaultLimit = opts.DefaultRateLimit
+	m.plans = opts.Plans
+	m.metrics = opts.Metrics
+	m.redactor = opts.Redactor
+	m.signedURLs = opts.SignedURLs
+	m.revocations = opts.Revocations
+
+	if opts.FailOpen != nil {
+		m.failOpen = opts.FailOpen
+		m.limiterFailOpen = opts.FailOpen
+	}
+	if opts.LimiterFailOpen != nil {
+		m.limiterFailOpen = opts.LimiterFailOpen
+	}
 }
 
 func (m *AuthorizationMiddlewareService) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Debug().Msg("authenticating starting")
+		dec := decision.FromContext(r.Context())
 
-		jwtStr, ok := m.extractBearer(r.Header.Get("Authorization"))
-		if !ok {
-			m.unauthorized(w, "missing bearer token")
+		if isProbe(r) {
+			dec.SetAuth(decision.AuthProbe, r.UserAgent())
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		log.Debug().Msg("getting claims from token")
-		claims, err := m.verifier.Parse(jwtStr)
-		if err != nil {
-			m.unauthorized(w, "invalid token: "+err.Error())
+		methodLimit, hasMethodLimit := m.methodLimit(r)
+		if hasMethodLimit && methodLimit.Exempt && IsPreflight(r) {
+			dec.SetAuth(decision.AuthExempt, "CORS preflight")
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		log.Debug().Msg("token parsed successfully")
-
-		if claims.APIKey == "" {
-			m.unauthorized(w, "missing api_key claim")
+		var (
+			claims     *Claims
+			tok        store.Token
+			failedOpen bool
+			ok         bool
+		)
+		if m.signedURLs != nil && r.Header.Get("Authorization") == "" && signedurl.Present(r) {
+			claims, tok, ok = m.authorizeSignedURL(w, r, dec)
+		} else {
+			claims, tok, failedOpen, ok = m.authorizeBearer(w, r, dec)
+		}
+		if !ok {
 			return
 		}
 
-		exp, err := claims.GetExpirationTime()
-		if err != nil || exp == nil || !exp.Time.After(m.now()) {
-			m.unauthorized(w, "token expired")
+		route, _ := routes.FromContext(r.Context())
+
+		// pausing is an operator's decision, enforced even in dry run
+		if tok.Paused() {
+			label := "unmatched"
+			if route != nil {
+				label = route.Path
+			}
+			m.metrics.IncPausedRequest(label)
+			dec.SetAuth(decision.AuthPaused, "token paused")
+			gwerr.Write(w, m.metrics, gwerr.ErrTokenPaused)
 			return
 		}
 
-		if len(claims.AllowedRoutes) > 0 {
-			if !m.isAllowedPath(r.URL.Path, claims.AllowedRoutes) {
-				log.Debug().Str("path", r.URL.Path).Msg("path not allowed")
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
+		if tok.Disabled {
+			m.unauthorized(w, dec, decision.AuthDisabled, "token disabled")
+			return
 		}
 
-		tok, err := m.store.GetToken(r.Context(), claims.APIKey)
-		if err != nil {
-			log.Debug().Err(err).Str("api_key", claims.APIKey).Msg("token store lookup failed")
+		// scopes and limits of dry-run tokens and routes are evaluated but not enforced; the JWT's allowed_routes
+		// were already enforced unless the route is dry-run
+		dryRun := tok.DryRun || (route != nil && route.DryRun)
 
-			if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) || errors.Is(err, store.ErrInvalid) {
-				m.unauthorized(w, "unknown token")
-				return
-			}
+		if len(claims.AllowedRoutes) > 0 && !m.isAllowedPath(r.URL.Path, claims.AllowedRoutes) &&
+			!m.reject(w, r, dec, dryRun, gwerr.ErrScope, decision.AuthForbiddenRoute, "path not in allowed_routes") {
+			return
+		}
 
-			http.Error(w, "authorization backend unavailable", http.StatusServiceUnavailable)
+		plan, ok := m.plan(w, dec, tok)
+		if !ok {
+			return
+		}
+		if plan != nil && len(plan.AllowedRoutes) > 0 && !m.isAllowedPath(r.URL.Path, plan.AllowedRoutes) &&
+			!m.reject(w, r, dec, dryRun, gwerr.ErrScope, decision.AuthForbiddenRoute, "path not in allowed_routes of plan "+tok.Plan) {
 			return
 		}
 
-		limit := tok.RateLimit
-		log.Debug().Int("limit", limit).Str("api", claims.APIKey).Msg("rate limit")
+		effective := policy.Resolve(m.defaultLimit, route, plan, tok.RateLimit)
+		limit := effective.Value
+		dec.SetLimit(limit, string(effective.Source))
 
-		if limit <= 0 {
-			m.unauthorized(w, "token disabled")
+		if limit == 0 && !failedOpen {
+			m.unauthorized(w, dec, decision.AuthNoLimit, "no rate limit configured")
 			return
 		}
 
-		allowed, err := m.limiter.Allow(r.Context(), claims.APIKey, limit)
-		if err != nil {
-			http.Error(w, "Rate limiter error", http.StatusInternalServerError)
-			return
+		limitKey, burst := claims.APIKey, tok.Burst
+		if hasMethodLimit && methodLimit.Limit > 0 && !effective.Unlimited() {
+			limit = methodLimit.Limit
+			limitKey, burst = claims.APIKey+":"+r.Method, 0
+			dec.SetLimit(limit, string(policy.SourceMethod))
 		}
 
-		if !allowed {
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		exempt := hasMethodLimit && methodLimit.Exempt
+		switch {
+		case exempt:
+			dec.SetAuth(decision.AuthExempt, r.Method+" exempt from rate limit")
+		case limit < 0:
+			// unlimited: not counted against the key, only against its plan
+		case limit == 0:
+			// failed open without a rate_limit at any layer: nothing to enforce for the key
+		default:
+			if !m.allow(w, r, dec, dryRun, limitKey, limit, burst, "") {
+				return
+			}
+		}
+		if !exempt && plan != nil && plan.AggregateRateLimit > 0 && !m.allowPlan(w, r, dec, dryRun, tok.Plan, plan.AggregateRateLimit) {
 			return
 		}
 
-		log.Debug().
-			Int("limit", limit).
-			Bool("all", allowed).
-			Str("api", claims.APIKey).
-			Msg("access allowed")
+		if dec != nil && dec.Auth == "" {
+			dec.SetAuth(decision.AuthAllowed, "")
+		}
 
 		ctx := WithClaims(r.Context(), claims)
+		ctx = WithToken(ctx, tok)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authorizeBearer authenticates the request by its bearer JWT and loads the token profile. It reports
+// whether the profile comes from the claims because the store failed open, and whether the request may
+// go on; otherwise the response has been written.
+func (m *AuthorizationMiddlewareService) authorizeBearer(w http.ResponseWriter, r *http.Request, dec *decision.Decision) (*Claims, store.Token, bool, bool) {
+	jwtStr, ok := m.extractBearer(r.Header.Get("Authorization"))
+	if !ok {
+		m.unauthorized(w, dec, decision.AuthMissingToken, "missing bearer token")
+		return nil, store.Token{}, false, false
+	}
+
+	claims, err := m.verifier.Parse(jwtStr)
+	if err != nil {
+		m.unauthorized(w, dec, decision.AuthInvalidToken, err.Error())
+		return nil, store.Token{}, false, false
+	}
+
+	if claims.APIKey == "" {
+		m.unauthorized(w, dec, decision.AuthInvalidToken, "missing api_key claim")
+		return nil, store.Token{}, false, false
+	}
+	dec.SetAPIKey(m.redactor.APIKey(claims.APIKey))
+	if zerolog.GlobalLevel() <= zerolog.DebugLevel {
+		dec.SetClaims(m.redactor.Claims(claims))
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil || !exp.Time.After(m.now()) {
+		m.unauthorized(w, dec, decision.AuthExpired, "token expired")
+		return nil, store.Token{}, false, false
+	}
+
+	var issuedAt time.Time
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+	if !m.checkRevoked(w, r, dec, claims.APIKey, claims.ID, issuedAt) {
+		return nil, store.Token{}, false, false
+	}
+
+	// the token's own scopes need no profile: only a dry-run route lets a forbidden path reach the store
+	if len(claims.AllowedRoutes) > 0 && !m.isAllowedPath(r.URL.Path, claims.AllowedRoutes) {
+		if route, _ := routes.FromContext(r.Context()); route == nil || !route.DryRun {
+			m.reject(w, r, dec, false, gwerr.ErrScope, decision.AuthForbiddenRoute, "path not in allowed_routes")
+			return nil, store.Token{}, false, false
+		}
+	}
+
+	failedOpen := false
+	tok, err := m.store.GetToken(r.Context(), claims.APIKey)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) || errors.Is(err, store.ErrInvalid) {
+			m.unauthorized(w, dec, decision.AuthUnknownToken, err.Error())
+			return nil, store.Token{}, false, false
+		}
+
+		if !m.failOpen() {
+			dec.SetAuth(decision.AuthBackendUnavailable, err.Error())
+			gwerr.Write(w, m.metrics, gwerr.ErrAuthUnavailable)
+			return nil, store.Token{}, false, false
+		}
+
+		// the signed claims are all there is to go on until the store recovers
+		tok = store.Token{APIKey: claims.APIKey, RateLimit: claims.RateLimit, AllowedRoutes: claims.AllowedRoutes}
+		failedOpen = true
+		dec.SetAuth(decision.AuthFailedOpen, "token store: "+err.Error())
+	}
+
+	return claims, tok, failedOpen, true
+}
+
+// checkRevoked reports whether the token of apiKey with jti, issued at issuedAt, is not revoked and the request
+// may go on; otherwise the response has been written. A failing revocation list is handled like a failing token
+// store.
+func (m *AuthorizationMiddlewareService) checkRevoked(w http.ResponseWriter, r *http.Request, dec *decision.Decision, apiKey, jti string, issuedAt time.Time) bool {
+	if m.revocations == nil {
+		return true
+	}
+
+	revoked, err := m.revocations.Revoked(r.Context(), apiKey, jti, issuedAt)
+	if err != nil {
+		if !m.failOpen() {
+			dec.SetAuth(decision.AuthBackendUnavailable, "revocation list: "+err.Error())
+			gwerr.Write(w, m.metrics, gwerr.ErrAuthUnavailable)
+			return false
+		}
+
+		dec.SetAuth(decision.AuthFailedOpen, "revocation list: "+err.Error())
+		return true
+	}
+
+	if revoked {
+		m.unauthorized(w, dec, decision.AuthRevoked, "token revoked")
+		return false
+	}
+
+	return true
+}
+
+// authorizeSignedURL authenticates a GET or HEAD request by its signed URL and strips the signature
+// parameters from it.
+func (m *AuthorizationMiddlewareService) authorizeSignedURL(w http.ResponseWriter, r *http.Request, dec *decision.Decision) (*Claims, store.Token, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		m.unauthorized(w, dec, decision.AuthInvalidSignature, "signed URLs only grant GET and HEAD")
+		return nil, store.Token{}, false
+	}
+
+	tok, err := m.signedURLs.Verify(r.Context(), r)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrExpired), errors.Is(err, store.ErrInvalid):
+			m.unauthorized(w, dec, decision.AuthUnknownToken, err.Error())
+		case errors.Is(err, signedurl.ErrExpired), errors.Is(err, signedurl.ErrTooLong):
+			m.unauthorized(w, dec, decision.AuthExpired, err.Error())
+		case errors.Is(err, signedurl.ErrMalformed), errors.Is(err, signedurl.ErrSignature), errors.Is(err, signedurl.ErrReplayed):
+			m.unauthorized(w, dec, decision.AuthInvalidSignature, err.Error())
+		default:
+			dec.SetAuth(decision.AuthBackendUnavailable, err.Error())
+			gwerr.Write(w, m.metrics, gwerr.ErrAuthUnavailable)
+		}
+		return nil, store.Token{}, false
+	}
+	dec.SetAPIKey(m.redactor.APIKey(tok.APIKey))
+	dec.SetAuth(decision.AuthSignedURL, "")
+	// a signed URL carries no jti or iat: any revocation of its key covers it
+	if !m.checkRevoked(w, r, dec, tok.APIKey, "", time.Time{}) {
+		return nil, store.Token{}, false
+	}
+	signedurl.Strip(r)
+
+	return &Claims{APIKey: tok.APIKey, AllowedRoutes: tok.AllowedRoutes, RateLimit: tok.RateLimit}, tok, true
+}
+
+// allow counts the request against limit (with burst for token buckets) under key. It reports whether the
+// request may go on; otherwise the response has been written.
+func (m *AuthorizationMiddlewareService) allow(w http.ResponseWriter, r *http.Request, dec *decision.Decision, dryRun bool, key string, limit, burst int, reason string) bool {
+	allowed, err := m.limiter.Allow(r.Context(), key, limit, burst)
+	if err != nil {
+		if !m.limiterFailOpen() {
+			dec.SetAuth(decision.AuthLimiterError, err.Error())
+			gwerr.Write(w, m.metrics, gwerr.ErrLimiter)
+			return false
+		}
+
+		dec.SetAuth(decision.AuthFailedOpen, "rate limiter: "+err.Error())
+		return true
+	}
+
+	if !allowed {
+		return m.reject(w, r, dec, dryRun, gwerr.ErrQuota, decision.AuthRateLimited, reason)
+	}
+
+	return true
+}
+
+// reject denies the request with gerr, or in dry run only records and counts the denial and lets the
+// request through. It reports whether the request may go on.
+func (m *AuthorizationMiddlewareService) reject(w http.ResponseWriter, r *http.Request, dec *decision.Decision, dryRun bool, gerr *gwerr.Error, outcome, reason string) bool {
+	dec.SetAuth(outcome, reason)
+	if dryRun {
+		dec.SetDryRun()
+		label := "unmatched"
+		if rt, ok := routes.FromContext(r.Context()); ok {
+			label = rt.Path
+		}
+		m.metrics.IncDryRunDenial(label, outcome)
+		return true
+	}
+
+	gwerr.Write(w, m.metrics, gerr)
+	return false
+}
+
+// allowPlan counts the request against the aggregate limit of its plan, shared by every key on it, unlimited
+// keys included. Requests over their own key's limit are not counted, so one runaway key cannot use up its
+// tenant's budget.
+func (m *AuthorizationMiddlewareService) allowPlan(w http.ResponseWriter, r *http.Request, dec *decision.Decision, dryRun bool, plan string, limit int) bool {
+	var keyCount int64
+	if dec != nil {
+		keyCount = dec.Count
+	}
+
+	if !m.allow(w, r, dec, dryRun, planLimitPrefix+plan, limit, 0, "plan "+plan+" aggregate limit") {
+		dec.SetLimit(limit, string(policy.SourcePlan))
+		return false
+	}
+
+	// the decision log reports the key's own counter for allowed requests
+	dec.SetCount(keyCount)
+	return true
+}
+
+// plan returns the plan the token references, nil for none. It reports whether the request may go on;
+// otherwise the response has been written.
+func (m *AuthorizationMiddlewareService) plan(w http.ResponseWriter, dec *decision.Decision, tok store.Token) (*config.Plan, bool) {
+	if tok.Plan == "" {
+		return nil, true
+	}
+
+	p, ok := m.plans[tok.Plan]
+	if !ok {
+		m.unauthorized(w, dec, decision.AuthUnknownToken, "unknown plan "+tok.Plan)
+		return nil, false
+	}
+
+	return &p, true
+}
+
+// methodLimit returns the matched route's override for the request method, if any.
+func (m *AuthorizationMiddlewareService) methodLimit(r *http.Request) (config.MethodLimit, bool) {
+	rt, ok := routes.FromContext(r.Context())
+	if !ok {
+		return config.MethodLimit{}, false
+	}
+
+	ml, ok := rt.MethodLimits[r.Method]
+	return ml, ok
+}
+
+// isProbe reports whether a GET or HEAD matches a probe_bypass signature of the matched route.
+func isProbe(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	rt, ok := routes.FromContext(r.Context())
+	if !ok {
+		return false
+	}
+
+	for _, p := range rt.ProbeBypass {
+		if p.UserAgentPrefix != "" && !strings.HasPrefix(r.UserAgent(), p.UserAgentPrefix) {
+			continue
+		}
+		if p.Header != "" && r.Header.Get(p.Header) != p.Value {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
+
+// IsPreflight reports whether r is a CORS preflight request.
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
 func (m *AuthorizationMiddlewareService) extractBearer(v string) (string, bool) {
 	v = strings.TrimSpace(v)
 	if v == "" {
@@ -165,11 +528,11 @@ func (m *AuthorizationMiddlewareService) extractBearer(v string) (string, bool)
 	return t, t != ""
 }
 
-func (m *AuthorizationMiddlewareService) unauthorized(w http.ResponseWriter, msg string) {
+func (m *AuthorizationMiddlewareService) unauthorized(w http.ResponseWriter, dec *decision.Decision, outcome, reason string) {
 	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
-	log.Info().Msg(msg)
+	dec.SetAuth(outcome, reason)
 
-	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	gwerr.Write(w, m.metrics, gwerr.ErrInvalidToken)
 }
 
 func (m *AuthorizationMiddlewareService) isAllowedPath(path string, patterns []string) bool {
@@ -214,3 +577,15 @@ func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
 	c, ok := v.(*Claims)
 	return c, ok
 }
+
+type ctxKeyToken struct{}
+
+// WithToken stores the token profile the request was authorized with.
+func WithToken(ctx context.Context, t store.Token) context.Context {
+	return context.WithValue(ctx, ctxKeyToken{}, t)
+}
+
+func TokenFromContext(ctx context.Context) (store.Token, bool) {
+	t, ok := ctx.Value(ctxKeyToken{}).(store.Token)
+	return t, ok
+}
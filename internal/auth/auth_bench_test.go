@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+
+	"tyk-proxy/internal/store"
+)
+
+func quietLogs(b *testing.B) {
+	lvl := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	b.Cleanup(func() { zerolog.SetGlobalLevel(lvl) })
+}
+
+// BenchmarkAuthMiddleware covers JWT verification and route scope matching with in-memory store and limiter.
+func BenchmarkAuthMiddleware(b *testing.B) {
+	quietLogs(b)
+
+	secret := []byte("bench-secret")
+	exp := time.Now().Add(time.Hour)
+	routes := []string{"/api/v1/users/*", "/api/v1/orders/*", "/api/v1/items"}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims("k1", exp, routes)).SignedString(secret)
+	if err != nil {
+		b.Fatalf("sign token: %v", err)
+	}
+
+	st := &fakeTokenStore{getFn: func(context.Context, string) (store.Token, error) {
+		return store.Token{APIKey: "k1", RateLimit: 1 << 30, ExpiresAt: exp}, nil
+	}}
+	lim := &fakeLimiter{allowFn: func(context.Context, string, int) (bool, error) { return true, nil }}
+	m := New(st, lim, NewJWTVerifier(KeySet{ExpectedAlg: "HS256", DefaultKey: secret}))
+
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/42", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNoContent {
+			b.Fatalf("status=%d want=%d", rr.Code, http.StatusNoContent)
+		}
+	}
+}
+
+func BenchmarkJWTVerifier_Parse(b *testing.B) {
+	secret := []byte("bench-secret")
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256,
+		newClaims("k1", time.Now().Add(time.Hour), []string{"/api/v1/*"})).SignedString(secret)
+	if err != nil {
+		b.Fatalf("sign token: %v", err)
+	}
+
+	v := NewJWTVerifier(KeySet{ExpectedAlg: "HS256", DefaultKey: secret})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.Parse(signed); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkCachingVerifier_Parse(b *testing.B) {
+	secret := []byte("bench-secret")
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256,
+		newClaims("k1", time.Now().Add(time.Hour), []string{"/api/v1/*"})).SignedString(secret)
+	if err != nil {
+		b.Fatalf("sign token: %v", err)
+	}
+
+	v := NewCachingVerifier(NewJWTVerifier(KeySet{ExpectedAlg: "HS256", DefaultKey: secret}), 1024, time.Minute)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.Parse(signed); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -10,6 +10,10 @@ import (
 
 	jwt "github.com/golang-jwt/jwt/v5"
 
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/signedurl"
 	"tyk-proxy/internal/store"
 )
 
@@ -44,14 +48,16 @@ type fakeLimiter struct {
 	calls     int
 	lastKey   string
 	lastLimit int
+	lastBurst int
 	lastCtx   context.Context
 }
 
-func (f *fakeLimiter) Allow(ctx context.Context, key string, limit int) (bool, error) {
+func (f *fakeLimiter) Allow(ctx context.Context, key string, limit, burst int) (bool, error) {
 	f.calls++
 	f.lastCtx = ctx
 	f.lastKey = key
 	f.lastLimit = limit
+	f.lastBurst = burst
 	return f.allowFn(ctx, key, limit)
 }
 
@@ -368,7 +374,7 @@ func TestAuthMiddleware_TokenDisabled_401(t *testing.T) {
 		return newClaims("k1", now.Add(time.Hour), []string{"/api/v1/*"}), nil
 	}}
 	fs := &fakeTokenStore{getFn: func(ctx context.Context, key string) (store.Token, error) {
-		return store.Token{RateLimit: 0}, nil
+		return store.Token{RateLimit: 10, Disabled: true}, nil
 	}}
 	fl := &fakeLimiter{allowFn: func(ctx context.Context, key string, limit int) (bool, error) {
 		return true, nil
@@ -393,6 +399,75 @@ func TestAuthMiddleware_TokenDisabled_401(t *testing.T) {
 	}
 }
 
+func TestAuthMiddleware_UnlimitedToken(t *testing.T) {
+	now := time.Now().UTC()
+
+	fv := &fakeVerifier{parseFn: func(tokenString string) (*Claims, error) {
+		return newClaims("k1", now.Add(time.Hour), []string{"/api/v1/*"}), nil
+	}}
+	fs := &fakeTokenStore{getFn: func(ctx context.Context, key string) (store.Token, error) {
+		return store.Token{RateLimit: store.Unlimited}, nil
+	}}
+	fl := &fakeLimiter{allowFn: func(ctx context.Context, key string, limit int) (bool, error) {
+		return false, nil
+	}}
+
+	mw := New(fs, fl, fv)
+	mw.WithOptions(&Options{Now: func() time.Time { return now }, DefaultRateLimit: 5})
+
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/test", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rr := httptest.NewRecorder()
+
+	called := false
+	mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})).ServeHTTP(rr, req)
+
+	if !called {
+		t.Fatalf("next not called, status=%d", rr.Code)
+	}
+	if fl.calls != 0 {
+		t.Fatalf("limiter should not be called for an unlimited token")
+	}
+}
+
+func TestAuthMiddleware_TokenPaused_403(t *testing.T) {
+	now := time.Now().UTC()
+
+	fv := &fakeVerifier{parseFn: func(tokenString string) (*Claims, error) {
+		return newClaims("k1", now.Add(time.Hour), []string{"/api/v1/*"}), nil
+	}}
+	fs := &fakeTokenStore{getFn: func(ctx context.Context, key string) (store.Token, error) {
+		return store.Token{RateLimit: 10, Status: store.StatusPaused, DryRun: true}, nil
+	}}
+	fl := &fakeLimiter{allowFn: func(ctx context.Context, key string, limit int) (bool, error) {
+		return true, nil
+	}}
+
+	mw := New(fs, fl, fv)
+	mw.WithOptions(&Options{Now: func() time.Time { return now }})
+
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/test", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rr := httptest.NewRecorder()
+
+	var dec *decision.Decision
+	decision.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dec = decision.FromContext(r.Context())
+		mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatalf("next must not be called, even in dry run")
+		})).ServeHTTP(w, r)
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden || dec.Auth != decision.AuthPaused {
+		t.Fatalf("status=%d auth=%q want=%d %q", rr.Code, dec.Auth, http.StatusForbidden, decision.AuthPaused)
+	}
+	if fl.calls != 0 {
+		t.Fatalf("limiter should not be called for a paused token")
+	}
+}
+
 func TestAuthMiddleware_LimiterError_500(t *testing.T) {
 	now := time.Now().UTC()
 
@@ -458,7 +533,7 @@ func TestAuthMiddleware_Success_PassesClaimsInContext(t *testing.T) {
 		return newClaims("k1", now.Add(10*time.Minute), []string{"/api/v1/*"}), nil
 	}}
 	fs := &fakeTokenStore{getFn: func(ctx context.Context, key string) (store.Token, error) {
-		return store.Token{RateLimit: 7}, nil
+		return store.Token{RateLimit: 7, Burst: 20}, nil
 	}}
 	fl := &fakeLimiter{allowFn: func(ctx context.Context, key string, limit int) (bool, error) {
 		return true, nil
@@ -491,8 +566,544 @@ func TestAuthMiddleware_Success_PassesClaimsInContext(t *testing.T) {
 	if fs.calls != 1 || fs.lastKey != "k1" {
 		t.Fatalf("store calls=%d lastKey=%q want calls=1 lastKey=k1", fs.calls, fs.lastKey)
 	}
-	if fl.calls != 1 || fl.lastKey != "k1" || fl.lastLimit != 7 {
-		t.Fatalf("limiter calls=%d lastKey=%q lastLimit=%d want calls=1 lastKey=k1 lastLimit=7",
-			fl.calls, fl.lastKey, fl.lastLimit)
+	if fl.calls != 1 || fl.lastKey != "k1" || fl.lastLimit != 7 || fl.lastBurst != 20 {
+		t.Fatalf("limiter calls=%d lastKey=%q lastLimit=%d lastBurst=%d want calls=1 lastKey=k1 lastLimit=7 lastBurst=20",
+			fl.calls, fl.lastKey, fl.lastLimit, fl.lastBurst)
+	}
+}
+
+func TestAuthMiddleware_MethodLimits(t *testing.T) {
+	now := time.Now().UTC()
+	rt := &config.Route{
+		Path: "/api/v1/*",
+		MethodLimits: map[string]config.MethodLimit{
+			http.MethodOptions: {Exempt: true},
+			http.MethodHead:    {Limit: 100},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		preflight    bool
+		token        bool
+		wantStatus   int
+		wantCalls    int
+		wantKey      string
+		wantLimit    int
+		wantVerifier int
+	}{
+		{"preflight without token passes", http.MethodOptions, true, false, http.StatusOK, 0, "", 0, 0},
+		{"options with token not counted", http.MethodOptions, false, true, http.StatusOK, 0, "", 0, 1},
+		{"head counted separately", http.MethodHead, false, true, http.StatusOK, 1, "k1:HEAD", 100, 1},
+		{"get uses token quota", http.MethodGet, false, true, http.StatusOK, 1, "k1", 5, 1},
+		{"options without preflight headers needs token", http.MethodOptions, false, false, http.StatusUnauthorized, 0, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		fv := &fakeVerifier{parseFn: func(tokenString string) (*Claims, error) {
+			return newClaims("k1", now.Add(time.Hour), nil), nil
+		}}
+		fs := &fakeTokenStore{getFn: func(ctx context.Context, key string) (store.Token, error) {
+			return store.Token{RateLimit: 5}, nil
+		}}
+		fl := &fakeLimiter{allowFn: func(ctx context.Context, key string, limit int) (bool, error) {
+			return true, nil
+		}}
+
+		mw := New(fs, fl, fv)
+
+		req := httptest.NewRequest(tt.method, "http://example/api/v1/test", nil)
+		req = req.WithContext(routes.WithRoute(req.Context(), rt))
+		if tt.preflight {
+			req.Header.Set("Origin", "https://app.example")
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		if tt.token {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		rr := httptest.NewRecorder()
+
+		mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Fatalf("%s: status=%d want=%d", tt.name, rr.Code, tt.wantStatus)
+		}
+		if fv.calls != tt.wantVerifier {
+			t.Fatalf("%s: verifier calls=%d want=%d", tt.name, fv.calls, tt.wantVerifier)
+		}
+		if fl.calls != tt.wantCalls || fl.lastKey != tt.wantKey || fl.lastLimit != tt.wantLimit {
+			t.Fatalf("%s: limiter calls=%d key=%q limit=%d want calls=%d key=%q limit=%d",
+				tt.name, fl.calls, fl.lastKey, fl.lastLimit, tt.wantCalls, tt.wantKey, tt.wantLimit)
+		}
+	}
+}
+
+func TestAuthMiddleware_ProbeBypass(t *testing.T) {
+	rt := &config.Route{
+		Path: "/api/v1/health*",
+		ProbeBypass: []config.ProbeSignature{
+			{UserAgentPrefix: "kube-probe/"},
+			{UserAgentPrefix: "ELB-HealthChecker/", Header: "X-Probe", Value: "lb"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		userAgent  string
+		header     string
+		route      *config.Route
+		wantStatus int
+	}{
+		{"kube probe", http.MethodGet, "kube-probe/1.29", "", rt, http.StatusOK},
+		{"head probe", http.MethodHead, "kube-probe/1.29", "", rt, http.StatusOK},
+		{"elb needs its header", http.MethodGet, "ELB-HealthChecker/2.0", "", rt, http.StatusUnauthorized},
+		{"elb with header", http.MethodGet, "ELB-HealthChecker/2.0", "lb", rt, http.StatusOK},
+		{"post is never a probe", http.MethodPost, "kube-probe/1.29", "", rt, http.StatusUnauthorized},
+		{"other user agent", http.MethodGet, "curl/8", "", rt, http.StatusUnauthorized},
+		{"route without bypass", http.MethodGet, "kube-probe/1.29", "", &config.Route{Path: "*"}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		fv := &fakeVerifier{parseFn: func(string) (*Claims, error) {
+			t.Fatalf("%s: verifier must not be called", tt.name)
+			return nil, nil
+		}}
+		fl := &fakeLimiter{allowFn: func(context.Context, string, int) (bool, error) {
+			t.Fatalf("%s: limiter must not be called", tt.name)
+			return false, nil
+		}}
+		mw := New(&fakeTokenStore{}, fl, fv)
+
+		req := httptest.NewRequest(tt.method, "http://example/api/v1/healthz", nil)
+		req = req.WithContext(routes.WithRoute(req.Context(), tt.route))
+		req.Header.Set("User-Agent", tt.userAgent)
+		if tt.header != "" {
+			req.Header.Set("X-Probe", tt.header)
+		}
+		rr := httptest.NewRecorder()
+
+		mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Fatalf("%s: status=%d want=%d", tt.name, rr.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestAuthMiddleware_LimitHierarchy(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name       string
+		global     int
+		route      *config.Route
+		tokenLimit int
+		plan       string
+		wantStatus int
+		wantLimit  int
+	}{
+		{name: "token overrides route", global: 10, route: &config.Route{Path: "*", RateLimit: 20}, tokenLimit: 5, wantStatus: http.StatusOK, wantLimit: 5},
+		{name: "token overrides plan", route: &config.Route{Path: "*", RateLimit: 20}, tokenLimit: 5, plan: "pro", wantStatus: http.StatusOK, wantLimit: 5},
+		{name: "plan overrides route", route: &config.Route{Path: "*", RateLimit: 20}, plan: "pro", wantStatus: http.StatusOK, wantLimit: 600},
+		{name: "plan without the path", global: 10, plan: "free", wantStatus: http.StatusForbidden},
+		{name: "unknown plan", global: 10, plan: "gold", wantStatus: http.StatusUnauthorized},
+		{name: "route overrides global", global: 10, route: &config.Route{Path: "*", RateLimit: 20}, wantStatus: http.StatusOK, wantLimit: 20},
+		{name: "global default", global: 10, wantStatus: http.StatusOK, wantLimit: 10},
+		{name: "no limit anywhere", route: &config.Route{Path: "*"}, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		fv := &fakeVerifier{parseFn: func(string) (*Claims, error) {
+			return newClaims("k1", now.Add(time.Hour), nil), nil
+		}}
+		fs := &fakeTokenStore{getFn: func(context.Context, string) (store.Token, error) {
+			return store.Token{APIKey: "k1", RateLimit: tt.tokenLimit, Plan: tt.plan}, nil
+		}}
+		fl := &fakeLimiter{allowFn: func(context.Context, string, int) (bool, error) {
+			return true, nil
+		}}
+
+		mw := New(fs, fl, fv)
+		mw.WithOptions(&Options{
+			Now:              func() time.Time { return now },
+			DefaultRateLimit: tt.global,
+			Plans: map[string]config.Plan{
+				"free": {RateLimit: 60, AllowedRoutes: []string{"/api/v1/public/*"}},
+				"pro":  {RateLimit: 600},
+			},
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/test", nil)
+		if tt.route != nil {
+			req = req.WithContext(routes.WithRoute(req.Context(), tt.route))
+		}
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+
+		mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Fatalf("%s: status=%d want=%d", tt.name, rr.Code, tt.wantStatus)
+		}
+		if fl.lastLimit != tt.wantLimit {
+			t.Fatalf("%s: limit=%d want=%d", tt.name, fl.lastLimit, tt.wantLimit)
+		}
+	}
+}
+
+func TestAuthMiddleware_FailOpen(t *testing.T) {
+	now := time.Now().UTC()
+	redisDown := errors.New("redis unavailable")
+
+	tests := []struct {
+		name        string
+		failOpen    bool
+		storeErr    error
+		limiterErr  error
+		claimsLimit int
+		wantStatus  int
+		wantLimit   int
+	}{
+		{name: "store down, closed", storeErr: redisDown, wantStatus: http.StatusServiceUnavailable},
+		{name: "store down, open, limit from claims", failOpen: true, storeErr: redisDown, claimsLimit: 7, wantStatus: http.StatusOK, wantLimit: 7},
+		{name: "store down, open, no limit in claims", failOpen: true, storeErr: redisDown, wantStatus: http.StatusOK},
+		{name: "unknown token is still rejected", failOpen: true, storeErr: store.ErrNotFound, wantStatus: http.StatusUnauthorized},
+		{name: "limiter down, closed", limiterErr: redisDown, wantStatus: http.StatusInternalServerError, wantLimit: 5},
+		{name: "limiter down, open", failOpen: true, limiterErr: redisDown, wantStatus: http.StatusOK, wantLimit: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fv := &fakeVerifier{parseFn: func(string) (*Claims, error) {
+				c := newClaims("k1", now.Add(time.Hour), []string{"/api/v1/*"})
+				c.RateLimit = tt.claimsLimit
+				return c, nil
+			}}
+			fs := &fakeTokenStore{getFn: func(context.Context, string) (store.Token, error) {
+				if tt.storeErr != nil {
+					return store.Token{}, tt.storeErr
+				}
+				return store.Token{APIKey: "k1", RateLimit: 5, ExpiresAt: now.Add(time.Hour)}, nil
+			}}
+			fl := &fakeLimiter{allowFn: func(context.Context, string, int) (bool, error) {
+				return tt.limiterErr == nil, tt.limiterErr
+			}}
+
+			mw := New(fs, fl, fv)
+			mw.WithOptions(&Options{
+				Now:      func() time.Time { return now },
+				FailOpen: func() bool { return tt.failOpen },
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/test", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			rr := httptest.NewRecorder()
+
+			mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantLimit > 0 && fl.lastLimit != tt.wantLimit {
+				t.Fatalf("limit=%d want=%d", fl.lastLimit, tt.wantLimit)
+			}
+			if tt.wantLimit == 0 && fl.calls != 0 {
+				t.Fatalf("limiter called without a limit")
+			}
+		})
+	}
+}
+
+type fakeSignedURLs struct {
+	tok store.Token
+	err error
+}
+
+func (f fakeSignedURLs) Verify(context.Context, *http.Request) (store.Token, error) {
+	return f.tok, f.err
+}
+
+func TestAuthMiddleware_SignedURL(t *testing.T) {
+	now := time.Now().UTC()
+	tok := store.Token{APIKey: "k1", RateLimit: 5, AllowedRoutes: []string{"/api/v1/files/*"}}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		verify     fakeSignedURLs
+		wantStatus int
+		wantQuery  string
+	}{
+		{"valid", http.MethodGet, "/api/v1/files/a?x=1&tp_key=k1&tp_expires=1&tp_signature=s", fakeSignedURLs{tok: tok}, http.StatusOK, "x=1"},
+		{"not a download method", http.MethodPost, "/api/v1/files/a?tp_signature=s", fakeSignedURLs{tok: tok}, http.StatusUnauthorized, ""},
+		{"outside allowed_routes", http.MethodGet, "/api/v1/admin?tp_signature=s", fakeSignedURLs{tok: tok}, http.StatusForbidden, ""},
+		{"bad signature", http.MethodGet, "/api/v1/files/a?tp_signature=s", fakeSignedURLs{err: signedurl.ErrSignature}, http.StatusUnauthorized, ""},
+		{"redis down", http.MethodGet, "/api/v1/files/a?tp_signature=s", fakeSignedURLs{err: errors.New("redis unavailable")}, http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fv := &fakeVerifier{parseFn: func(string) (*Claims, error) { return nil, errors.New("unexpected") }}
+			fs := &fakeTokenStore{getFn: func(context.Context, string) (store.Token, error) { return tok, nil }}
+			fl := &fakeLimiter{allowFn: func(context.Context, string, int) (bool, error) { return true, nil }}
+
+			mw := New(fs, fl, fv)
+			mw.WithOptions(&Options{Now: func() time.Time { return now }, SignedURLs: tt.verify})
+
+			req := httptest.NewRequest(tt.method, "http://example"+tt.path, nil)
+			rr := httptest.NewRecorder()
+
+			var gotQuery string
+			mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotQuery = r.URL.RawQuery
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.wantStatus)
+			}
+			if rr.Code == http.StatusOK && (gotQuery != tt.wantQuery || fl.lastKey != "k1") {
+				t.Fatalf("query=%q limit key=%q", gotQuery, fl.lastKey)
+			}
+			if fv.calls != 0 {
+				t.Fatalf("bearer verifier called for a signed URL")
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_PlanAggregateLimit(t *testing.T) {
+	now := time.Now().UTC()
+
+	counts := map[string]int{}
+	fv := &fakeVerifier{parseFn: func(tok string) (*Claims, error) {
+		return newClaims(tok, now.Add(time.Hour), nil), nil
+	}}
+	fs := &fakeTokenStore{getFn: func(_ context.Context, key string) (store.Token, error) {
+		tok := store.Token{APIKey: key, Plan: "pro"}
+		if key == "unlimited" {
+			tok.RateLimit = -1
+		}
+		return tok, nil
+	}}
+	fl := &fakeLimiter{allowFn: func(_ context.Context, key string, limit int) (bool, error) {
+		counts[key]++
+		return counts[key] <= limit, nil
+	}}
+
+	mw := New(fs, fl, fv)
+	mw.WithOptions(&Options{
+		Now:   func() time.Time { return now },
+		Plans: map[string]config.Plan{"pro": {RateLimit: 2, AggregateRateLimit: 4}},
+	})
+	h := mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"k1", http.StatusOK},
+		{"k1", http.StatusOK},
+		{"k1", http.StatusTooManyRequests}, // own limit, not counted against the plan
+		{"unlimited", http.StatusOK},       // no limit of its own, still counted against the plan
+		{"k2", http.StatusOK},
+		{"k2", http.StatusTooManyRequests}, // plan aggregate
+		{"unlimited", http.StatusTooManyRequests},
+	}
+
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/test", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.key)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Fatalf("request %d (%s): status=%d want=%d", i, tt.key, rr.Code, tt.want)
+		}
+	}
+	if counts["plan:pro"] != 6 || counts["unlimited"] != 0 {
+		t.Fatalf("plan counter=%d want=6, unlimited key counter=%d want=0", counts["plan:pro"], counts["unlimited"])
+	}
+}
+
+func TestAuthMiddleware_DryRun(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name       string
+		tokenDry   bool
+		route      *config.Route
+		path       string
+		allowed    bool
+		wantStatus int
+		wantAuth   string
+	}{
+		{name: "enforced scope", path: "/api/v1/admin", allowed: true, wantStatus: http.StatusForbidden, wantAuth: decision.AuthForbiddenRoute},
+		{name: "dry-run token, JWT scope enforced", tokenDry: true, path: "/api/v1/admin", allowed: true, wantStatus: http.StatusForbidden, wantAuth: decision.AuthForbiddenRoute},
+		{name: "dry-run route scope", route: &config.Route{Path: "*", DryRun: true}, path: "/api/v1/admin", allowed: true, wantStatus: http.StatusOK, wantAuth: decision.AuthForbiddenRoute},
+		{name: "enforced limit", path: "/api/v1/users", wantStatus: http.StatusTooManyRequests, wantAuth: decision.AuthRateLimited},
+		{name: "dry-run route limit", route: &config.Route{Path: "*", DryRun: true}, path: "/api/v1/users", wantStatus: http.StatusOK, wantAuth: decision.AuthRateLimited},
+		{name: "dry-run within limits", tokenDry: true, path: "/api/v1/users", allowed: true, wantStatus: http.StatusOK, wantAuth: decision.AuthAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fv := &fakeVerifier{parseFn: func(string) (*Claims, error) {
+				return newClaims("k1", now.Add(time.Hour), []string{"/api/v1/users*"}), nil
+			}}
+			fs := &fakeTokenStore{getFn: func(context.Context, string) (store.Token, error) {
+				return store.Token{APIKey: "k1", RateLimit: 5, DryRun: tt.tokenDry}, nil
+			}}
+			fl := &fakeLimiter{allowFn: func(context.Context, string, int) (bool, error) {
+				return tt.allowed, nil
+			}}
+
+			mw := New(fs, fl, fv)
+			mw.WithOptions(&Options{Now: func() time.Time { return now }})
+
+			req := httptest.NewRequest(http.MethodGet, "http://example"+tt.path, nil)
+			if tt.route != nil {
+				req = req.WithContext(routes.WithRoute(req.Context(), tt.route))
+			}
+			req.Header.Set("Authorization", "Bearer token")
+			rr := httptest.NewRecorder()
+
+			var dec *decision.Decision
+			decision.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				dec = decision.FromContext(r.Context())
+				mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				})).ServeHTTP(w, r)
+			})).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.wantStatus)
+			}
+			if dec.Auth != tt.wantAuth {
+				t.Fatalf("auth=%q want=%q", dec.Auth, tt.wantAuth)
+			}
+			if wantDry := tt.wantStatus == http.StatusOK && tt.wantAuth != decision.AuthAllowed; dec.DryRun != wantDry {
+				t.Fatalf("dry_run=%v want=%v", dec.DryRun, wantDry)
+			}
+		})
+	}
+}
+
+type fakeRevocations struct {
+	revokedFn func(apiKey, jti string, issuedAt time.Time) (bool, error)
+}
+
+func (f *fakeRevocations) Revoked(_ context.Context, apiKey, jti string, issuedAt time.Time) (bool, error) {
+	return f.revokedFn(apiKey, jti, issuedAt)
+}
+
+func TestAuthMiddleware_Revoked(t *testing.T) {
+	now := time.Now().UTC()
+	iat := now.Add(-time.Minute).Truncate(time.Second)
+
+	fv := &fakeVerifier{parseFn: func(tokenString string) (*Claims, error) {
+		c := newClaims("k1", now.Add(time.Hour), []string{"/api/v1/*"})
+		c.ID, c.IssuedAt = tokenString, jwt.NewNumericDate(iat)
+		return c, nil
+	}}
+	fs := &fakeTokenStore{getFn: func(ctx context.Context, key string) (store.Token, error) {
+		return store.Token{APIKey: key, RateLimit: 10, ExpiresAt: now.Add(time.Hour)}, nil
+	}}
+	fl := &fakeLimiter{allowFn: func(ctx context.Context, key string, limit int) (bool, error) { return true, nil }}
+	rv := &fakeRevocations{revokedFn: func(apiKey, jti string, issuedAt time.Time) (bool, error) {
+		if apiKey != "k1" || !issuedAt.Equal(iat) {
+			t.Errorf("checked %s issued at %v", apiKey, issuedAt)
+		}
+		if jti == "broken" {
+			return false, errors.New("redis unavailable")
+		}
+		return jti == "leaked", nil
+	}}
+
+	mw := New(fs, fl, fv)
+	mw.WithOptions(&Options{Now: func() time.Time { return now }, Revocations: rv})
+
+	tests := []struct {
+		jti  string
+		want int
+	}{
+		{"leaked", http.StatusUnauthorized},
+		{"fine", http.StatusOK},
+		{"broken", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.jti, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.jti)
+			rr := httptest.NewRecorder()
+
+			mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.want)
+			}
+		})
+	}
+	if fs.calls != 1 {
+		t.Fatalf("store calls=%d want 1: revoked tokens must not reach the store", fs.calls)
+	}
+}
+
+func TestAuthMiddleware_SignedURLRevoked(t *testing.T) {
+	now := time.Now().UTC()
+	tok := store.Token{APIKey: "k1", RateLimit: 5, AllowedRoutes: []string{"/api/v1/files/*"}}
+
+	tests := []struct {
+		name    string
+		revoked func(apiKey, jti string, issuedAt time.Time) (bool, error)
+		want    int
+	}{
+		{"revoked key", func(apiKey, jti string, issuedAt time.Time) (bool, error) {
+			return apiKey == "k1" && jti == "" && issuedAt.IsZero(), nil
+		}, http.StatusUnauthorized},
+		{"not revoked", func(string, string, time.Time) (bool, error) { return false, nil }, http.StatusOK},
+		{"revocation list down", func(string, string, time.Time) (bool, error) {
+			return false, errors.New("redis unavailable")
+		}, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fv := &fakeVerifier{parseFn: func(string) (*Claims, error) { return nil, errors.New("unexpected") }}
+			fs := &fakeTokenStore{getFn: func(context.Context, string) (store.Token, error) { return tok, nil }}
+			fl := &fakeLimiter{allowFn: func(context.Context, string, int) (bool, error) { return true, nil }}
+
+			mw := New(fs, fl, fv)
+			mw.WithOptions(&Options{
+				Now:         func() time.Time { return now },
+				SignedURLs:  fakeSignedURLs{tok: tok},
+				Revocations: &fakeRevocations{revokedFn: tt.revoked},
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/files/a?tp_key=k1&tp_expires=1&tp_signature=s", nil)
+			rr := httptest.NewRecorder()
+			mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.want)
+			}
+		})
 	}
 }
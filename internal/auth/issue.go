@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tyk-proxy/internal/store"
+)
+
+type tokenWriter interface {
+	Upsert(ctx context.Context, t store.Token) error
+}
+
+// Issuer mints tokens the proxy accepts: it stores the profile under a new api key and signs a JWT for it.
+// Used by the tooling (replayer, load generator); production tokens come from token-gen.
+type Issuer struct {
+	store tokenWriter
+	alg   string
+	key   []byte
+
+	// for tests
+	now func() time.Time
+}
+
+func NewIssuer(store tokenWriter, alg string, secret []byte) *Issuer {
+	return &Issuer{
+		store: store,
+		alg:   alg,
+		key:   secret,
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Issued is a minted token.
+type Issued struct {
+	APIKey    string
+	JWT       string
+	JTI       string // revokes this JWT alone, see store.Revocations
+	ExpiresAt time.Time
+}
+
+// Issue stores a profile with the given limit and routes and returns a JWT valid for ttl.
+func (i *Issuer) Issue(ctx context.Context, limit int, ttl time.Duration, routes []string) (Issued, error) {
+	return i.IssueProfile(ctx, store.Token{RateLimit: limit, ExpiresAt: i.now().Add(ttl), AllowedRoutes: routes})
+}
+
+// IssueProfile stores t under a new api key and returns a JWT for it valid until t.ExpiresAt.
+func (i *Issuer) IssueProfile(ctx context.Context, t store.Token) (Issued, error) {
+	method := jwt.GetSigningMethod(i.alg)
+	if method == nil {
+		return Issued{}, fmt.Errorf("unsupported algorithm %q", i.alg)
+	}
+
+	apiKey, err := GenerateAPIKey()
+	if err != nil {
+		return Issued{}, err
+	}
+
+	jti, err := GenerateAPIKey()
+	if err != nil {
+		return Issued{}, err
+	}
+
+	t.APIKey = apiKey
+	t.ExpiresAt = t.ExpiresAt.UTC()
+	if err := i.store.Upsert(ctx, t); err != nil {
+		return Issued{}, fmt.Errorf("store token profile: %w", err)
+	}
+
+	claims := Claims{
+		APIKey:           apiKey,
+		AllowedRoutes:    t.AllowedRoutes,
+		RateLimit:        t.RateLimit,
+		ExpiresAtRFC3339: t.ExpiresAt.Format(time.RFC3339),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(t.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(i.now()),
+			ID:        jti,
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(method, claims).SignedString(i.key)
+	if err != nil {
+		return Issued{}, fmt.Errorf("sign token: %w", err)
+	}
+
+	return Issued{APIKey: apiKey, JWT: signed, JTI: jti, ExpiresAt: t.ExpiresAt}, nil
+}
+
+// GenerateAPIKey returns a random url-safe api key.
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
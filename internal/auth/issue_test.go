@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/store"
+)
+
+type fakeWriter struct {
+	tokens []store.Token
+}
+
+func (f *fakeWriter) Upsert(_ context.Context, t store.Token) error {
+	f.tokens = append(f.tokens, t)
+	return nil
+}
+
+func TestIssuer_IssueVerifies(t *testing.T) {
+	w := &fakeWriter{}
+	iss := NewIssuer(w, "HS256", []byte("test-secret"))
+
+	got, err := iss.Issue(context.Background(), 100, time.Hour, []string{"/api/v1/*"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(w.tokens) != 1 || w.tokens[0].APIKey != got.APIKey || w.tokens[0].RateLimit != 100 {
+		t.Fatalf("stored profile %+v does not match issued key %q", w.tokens, got.APIKey)
+	}
+
+	v := NewJWTVerifier(KeySet{ExpectedAlg: "HS256", DefaultKey: []byte("test-secret")})
+	claims, err := v.Parse(got.JWT)
+	if err != nil {
+		t.Fatalf("issued token rejected: %v", err)
+	}
+	if claims.APIKey != got.APIKey {
+		t.Fatalf("api_key=%q want=%q", claims.APIKey, got.APIKey)
+	}
+}
+
+func TestIssuer_UnsupportedAlg(t *testing.T) {
+	iss := NewIssuer(&fakeWriter{}, "none-such", []byte("k"))
+	if _, err := iss.Issue(context.Background(), 1, time.Hour, nil); err == nil {
+		t.Fatalf("expected error for unknown algorithm")
+	}
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	mp "tyk-proxy/internal/metrics"
+)
+
+const (
+	jwksFetchTimeout = 10 * time.Second
+	jwksMaxBytes     = 1 << 20
+	// unknown kids trigger an early refresh, but no more often than this
+	jwksMinRefresh = 30 * time.Second
+
+	refreshOK    = "ok"
+	refreshError = "error"
+)
+
+// ErrUnknownKid rejects tokens signed by a key the JWKS endpoint did not publish at the last refresh.
+var ErrUnknownKid = errors.New("unknown kid")
+
+// JWKS holds the signing keys published at a JWKS endpoint, refreshing them in the background so keys
+// rotated by the identity provider are picked up. Every key goes through KeySet.Check before use; a fetch
+// without a single usable key leaves the previous keys in place.
+type JWKS struct {
+	url      string
+	alg      string
+	interval time.Duration
+	client   *http.Client
+	metrics  *mp.Metrics
+
+	keys atomic.Pointer[map[string]any]
+
+	// a token with an unknown kid asks Run for an early refresh
+	refresh chan struct{}
+}
+
+func NewJWKS(url, alg string, interval time.Duration, metrics *mp.Metrics) *JWKS {
+	return &JWKS{
+		url:      url,
+		alg:      alg,
+		interval: interval,
+		client:   &http.Client{Timeout: jwksFetchTimeout},
+		metrics:  metrics,
+		refresh:  make(chan struct{}, 1),
+	}
+}
+
+// Key returns the key for a token's kid. A token without kid is accepted only while the set has a single key.
+func (j *JWKS) Key(kid string) (any, error) {
+	keys := j.keys.Load()
+	if keys == nil {
+		return nil, errors.New("jwks: no keys loaded")
+	}
+
+	if kid == "" {
+		if len(*keys) == 1 {
+			for _, key := range *keys {
+				return key, nil
+			}
+		}
+		return nil, errors.New("token has no kid header")
+	}
+
+	if key, ok := (*keys)[kid]; ok {
+		return key, nil
+	}
+
+	select {
+	case j.refresh <- struct{}{}:
+	default:
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownKid, kid)
+}
+
+// Run refreshes the keys every interval, and early when tokens carry unknown kids, until ctx is done.
+func (j *JWKS) Run(ctx context.Context) {
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-j.refresh:
+			if time.Since(last) < jwksMinRefresh {
+				continue
+			}
+		}
+
+		last = time.Now()
+		if err := j.Refresh(ctx); err != nil {
+			log.Error().Err(err).Str("url", j.url).Msg("jwks: refresh failed, keeping the previous keys")
+		}
+	}
+}
+
+// Refresh fetches the key set and replaces the current keys with its usable ones.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		j.metrics.IncJWKSRefresh(refreshError)
+		return fmt.Errorf("jwks: %w", err)
+	}
+
+	j.metrics.IncJWKSRefresh(refreshOK)
+	j.keys.Store(&keys)
+	log.Debug().Str("url", j.url).Int("keys", len(keys)).Msg("jwks: keys refreshed")
+
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, jwksMaxBytes)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode key set: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != j.alg) {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err == nil {
+			err = KeySet{ExpectedAlg: j.alg, DefaultKey: key}.Check()
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("kid", k.Kid).Str("url", j.url).Msg("jwks: skipping key")
+			continue
+		}
+
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable %s keys among %d", j.alg, len(set.Keys))
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("rsa modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("rsa exponent: invalid")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if err := errors.Join(errX, errY); err != nil {
+			return nil, fmt.Errorf("ec point: %w", err)
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tyk-proxy/internal/config"
+)
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"kty": "EC", "kid": kid, "use": "sig", "crv": key.Curve.Params().Name,
+		"x": base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		"y": base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid,
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func signES256(t *testing.T, kid string, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodES256, Claims{
+		APIKey:           "k1",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestJWKS_KidMatchingAndRotation(t *testing.T) {
+	key1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key2, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	var body atomic.Value
+	setKeys := func(keys ...map[string]string) {
+		b, _ := json.Marshal(map[string]any{"keys": keys})
+		body.Store(string(b))
+	}
+	setKeys(ecJWK("one", key1), rsaJWK("weak", weak))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	defer srv.Close()
+
+	ks, err := LoadKeySet(context.Background(), config.Token{Algorithm: "ES256", JWKSURL: srv.URL, JWKSRefreshInterval: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	v := NewJWTVerifier(ks)
+
+	if _, err := v.Parse(signES256(t, "one", key1)); err != nil {
+		t.Fatalf("known kid rejected: %v", err)
+	}
+	if _, err := v.Parse(signES256(t, "", key1)); err != nil {
+		t.Fatalf("token without kid rejected while the set has one usable key: %v", err)
+	}
+	if _, err := v.Parse(signES256(t, "two", key2)); !errors.Is(err, ErrUnknownKid) {
+		t.Fatalf("unknown kid: err=%v", err)
+	}
+	if _, err := v.Parse(signES256(t, "one", key2)); err == nil {
+		t.Fatalf("token signed by another key accepted")
+	}
+
+	setKeys(ecJWK("one", key1), ecJWK("two", key2))
+	if err := ks.JWKS.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := v.Parse(signES256(t, "two", key2)); err != nil {
+		t.Fatalf("rotated key rejected: %v", err)
+	}
+	if _, err := v.Parse(signES256(t, "", key1)); err == nil {
+		t.Fatalf("token without kid accepted with several keys")
+	}
+
+	setKeys(rsaJWK("weak", weak))
+	if err := ks.JWKS.Refresh(context.Background()); err == nil {
+		t.Fatalf("expected error for a set without usable keys")
+	}
+	if _, err := v.Parse(signES256(t, "two", key2)); err != nil {
+		t.Fatalf("previous keys dropped after a failed refresh: %v", err)
+	}
+}
+
+func TestLoadKeySet_JWKSUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := LoadKeySet(context.Background(), config.Token{Algorithm: "RS256", JWKSURL: srv.URL}, nil)
+	if err == nil || !strings.Contains(err.Error(), "jwks_url") {
+		t.Fatalf("err=%v want jwks_url error", err)
+	}
+}
@@ -20,20 +20,43 @@ type Claims struct {
 type KeySet struct {
 	ExpectedAlg string // e.g. "HS256" or "RS256"
 	DefaultKey  any    // HS256: []byte(secret), RS256: *rsa.PublicKey
+
+	// JWKS, when set, supplies the key by the token's kid header in place of DefaultKey.
+	JWKS *JWKS
 }
 
 type JWTVerifier struct {
 	ks KeySet
+
+	// built once: both are safe for concurrent use and cost allocations when created per request
+	parser  *jwt.Parser
+	keyFunc jwt.Keyfunc
 }
 
 func NewJWTVerifier(ks KeySet) *JWTVerifier {
-	return &JWTVerifier{
+	v := &JWTVerifier{
 		ks: ks,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{ks.ExpectedAlg}),
+			jwt.WithExpirationRequired(),
+		),
+	}
+	v.keyFunc = func(t *jwt.Token) (any, error) {
+		if t.Method.Alg() != v.ks.ExpectedAlg {
+			return nil, fmt.Errorf("unexpected alg: %s", t.Method.Alg())
+		}
+		if v.ks.JWKS != nil {
+			kid, _ := t.Header["kid"].(string)
+			return v.ks.JWKS.Key(kid)
+		}
+		return v.ks.DefaultKey, nil
 	}
+
+	return v
 }
 
 func (v *JWTVerifier) Parse(tokenString string) (*Claims, error) {
-	if v.ks.DefaultKey == nil {
+	if v.ks.DefaultKey == nil && v.ks.JWKS == nil {
 		return nil, errors.New("no key configured")
 	}
 
@@ -43,17 +66,7 @@ func (v *JWTVerifier) Parse(tokenString string) (*Claims, error) {
 
 	claims := new(Claims)
 
-	parser := jwt.NewParser(
-		jwt.WithValidMethods([]string{v.ks.ExpectedAlg}),
-		jwt.WithExpirationRequired(),
-	)
-
-	tok, err := parser.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
-		if t.Method.Alg() != v.ks.ExpectedAlg {
-			return nil, fmt.Errorf("unexpected alg: %s", t.Method.Alg())
-		}
-		return v.ks.DefaultKey, nil
-	})
+	tok, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc)
 	if err != nil {
 		return nil, err
 	}
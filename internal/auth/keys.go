@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+)
+
+const minRSABits = 2048
+
+// LoadKeySet builds the key set for the token config and checks it, so broken key material stops the
+// proxy at startup instead of turning every request into a 401. A JWKS endpoint is fetched once here;
+// the caller runs its background refresh.
+func LoadKeySet(ctx context.Context, cfg config.Token, metrics *mp.Metrics) (KeySet, error) {
+	ks := KeySet{ExpectedAlg: strings.ToUpper(cfg.Algorithm)}
+
+	if cfg.JWKSURL != "" {
+		ks.JWKS = NewJWKS(cfg.JWKSURL, ks.ExpectedAlg, cfg.JWKSRefreshInterval, metrics)
+		if err := ks.JWKS.Refresh(ctx); err != nil {
+			return KeySet{}, fmt.Errorf("application.token.jwks_url: %w", err)
+		}
+		return ks, nil
+	}
+
+	if strings.HasPrefix(ks.ExpectedAlg, "HS") {
+		ks.DefaultKey = []byte(cfg.JWTSecret)
+	} else {
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return KeySet{}, fmt.Errorf("application.token.public_key_file: %w", err)
+		}
+
+		key, err := ParsePublicKeyPEM(data)
+		if err != nil {
+			return KeySet{}, fmt.Errorf("application.token.public_key_file %s: %w", cfg.PublicKeyFile, err)
+		}
+		ks.DefaultKey = key
+	}
+
+	if err := ks.Check(); err != nil {
+		return KeySet{}, err
+	}
+
+	return ks, nil
+}
+
+// ParsePublicKeyPEM returns the RSA or EC public key in the first PEM block of data. PKIX public keys,
+// PKCS#1 RSA public keys and certificates are accepted.
+func ParsePublicKeyPEM(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+		return nil, fmt.Errorf("found %s, want the public key only", block.Type)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// Check validates the key against ExpectedAlg: HMAC secrets must be at least as long as the hash output,
+// RSA keys at least 2048 bits and EC keys on the curve the algorithm names. An HMAC key must then verify
+// a token it signed; a public key, which cannot sign, must be accepted by the algorithm's verifier.
+// Rotated keys go through the same check before they replace the current ones.
+func (ks KeySet) Check() error {
+	method := jwt.GetSigningMethod(ks.ExpectedAlg)
+	if method == nil {
+		return fmt.Errorf("unsupported algorithm %q", ks.ExpectedAlg)
+	}
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		secret, ok := ks.DefaultKey.([]byte)
+		if !ok {
+			return fmt.Errorf("%s needs a shared secret, got %T", ks.ExpectedAlg, ks.DefaultKey)
+		}
+		if want := m.Hash.Size(); len(secret) < want {
+			return fmt.Errorf("%s secret is %d bytes, want at least %d; generate one with `openssl rand -base64 %d`",
+				ks.ExpectedAlg, len(secret), want, want)
+		}
+		return ks.selfTest(m, secret)
+	case *jwt.SigningMethodRSA:
+		key, ok := ks.DefaultKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s needs an RSA public key, got %T", ks.ExpectedAlg, ks.DefaultKey)
+		}
+		if key.N.BitLen() < minRSABits {
+			return fmt.Errorf("%s key is %d bits, want at least %d", ks.ExpectedAlg, key.N.BitLen(), minRSABits)
+		}
+	case *jwt.SigningMethodECDSA:
+		key, ok := ks.DefaultKey.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s needs an EC public key, got %T", ks.ExpectedAlg, ks.DefaultKey)
+		}
+		if bits := key.Curve.Params().BitSize; bits != m.CurveBits {
+			return fmt.Errorf("%s needs a P-%d key, got %s", ks.ExpectedAlg, m.CurveBits, key.Curve.Params().Name)
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", ks.ExpectedAlg)
+	}
+
+	// a garbage signature must fail as a bad signature, not as a key the method cannot use
+	err := method.Verify("header.payload", []byte("signature"), ks.DefaultKey)
+	if errors.Is(err, jwt.ErrInvalidKeyType) || errors.Is(err, jwt.ErrInvalidKey) {
+		return fmt.Errorf("%s cannot verify with the configured key: %w", ks.ExpectedAlg, err)
+	}
+
+	return nil
+}
+
+// selfTest signs a short-lived token with secret and parses it back through the verifier the proxy uses.
+func (ks KeySet) selfTest(method jwt.SigningMethod, secret []byte) error {
+	now := time.Now()
+	signed, err := jwt.NewWithClaims(method, Claims{
+		APIKey: "keycheck",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}).SignedString(secret)
+	if err != nil {
+		return fmt.Errorf("%s cannot sign with the configured secret: %w", ks.ExpectedAlg, err)
+	}
+
+	if _, err := NewJWTVerifier(ks).Parse(signed); err != nil {
+		return fmt.Errorf("%s cannot verify a token signed with the configured secret: %w", ks.ExpectedAlg, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestKeySet_Check(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ks      KeySet
+		wantErr string
+	}{
+		{name: "hmac", ks: KeySet{ExpectedAlg: "HS256", DefaultKey: []byte(strings.Repeat("k", 32))}},
+		{name: "short hmac", ks: KeySet{ExpectedAlg: "HS256", DefaultKey: []byte("secret")}, wantErr: "want at least 32"},
+		{name: "hs512 needs 64 bytes", ks: KeySet{ExpectedAlg: "HS512", DefaultKey: []byte(strings.Repeat("k", 32))}, wantErr: "want at least 64"},
+		{name: "hmac with rsa key", ks: KeySet{ExpectedAlg: "HS256", DefaultKey: &rsaKey.PublicKey}, wantErr: "shared secret"},
+		{name: "rsa", ks: KeySet{ExpectedAlg: "RS256", DefaultKey: &rsaKey.PublicKey}},
+		{name: "weak rsa", ks: KeySet{ExpectedAlg: "RS256", DefaultKey: &weakRSA.PublicKey}, wantErr: "1024 bits"},
+		{name: "rsa with ec key", ks: KeySet{ExpectedAlg: "RS256", DefaultKey: &ecKey.PublicKey}, wantErr: "RSA public key"},
+		{name: "ecdsa", ks: KeySet{ExpectedAlg: "ES256", DefaultKey: &ecKey.PublicKey}},
+		{name: "ecdsa wrong curve", ks: KeySet{ExpectedAlg: "ES384", DefaultKey: &ecKey.PublicKey}, wantErr: "P-384"},
+		{name: "unknown alg", ks: KeySet{ExpectedAlg: "XX256", DefaultKey: []byte("k")}, wantErr: "unsupported"},
+	}
+
+	for _, tt := range tests {
+		err := tt.ks.Check()
+		if tt.wantErr == "" && err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Fatalf("%s: err=%v want containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	pubFile := write("pub.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	privFile := write("priv.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privDER}))
+	junkFile := write("junk.pem", []byte("not a key"))
+
+	tests := []struct {
+		name    string
+		cfg     config.Token
+		wantErr string
+	}{
+		{name: "lower-case hmac alg", cfg: config.Token{Algorithm: "hs256", JWTSecret: strings.Repeat("k", 32)}},
+		{name: "ec public key", cfg: config.Token{Algorithm: "ES256", PublicKeyFile: pubFile}},
+		{name: "private key file", cfg: config.Token{Algorithm: "ES256", PublicKeyFile: privFile}, wantErr: "public key only"},
+		{name: "not pem", cfg: config.Token{Algorithm: "ES256", PublicKeyFile: junkFile}, wantErr: "no PEM block"},
+		{name: "missing file", cfg: config.Token{Algorithm: "ES256", PublicKeyFile: filepath.Join(dir, "nope.pem")}, wantErr: "public_key_file"},
+	}
+
+	for _, tt := range tests {
+		ks, err := LoadKeySet(context.Background(), tt.cfg, nil)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("%s: err=%v want containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if ks.ExpectedAlg != strings.ToUpper(tt.cfg.Algorithm) {
+			t.Fatalf("%s: alg=%q not normalized", tt.name, ks.ExpectedAlg)
+		}
+	}
+}
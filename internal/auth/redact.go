@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"tyk-proxy/internal/config"
+)
+
+// LogRedactor renders token claims for logs. Only allowlisted claims are kept and api_key is hashed
+// unless configured otherwise. The raw JWT must never be logged; log LogRedactor output instead.
+type LogRedactor struct {
+	allow    map[string]bool
+	plainKey bool
+}
+
+func NewLogRedactor(cfg config.Token) *LogRedactor {
+	allow := make(map[string]bool, len(cfg.LogClaims))
+	for _, c := range cfg.LogClaims {
+		allow[c] = true
+	}
+
+	return &LogRedactor{allow: allow, plainKey: cfg.LogAPIKey == config.LogAPIKeyPlain}
+}
+
+// APIKey returns the api_key as it may appear in logs.
+func (r *LogRedactor) APIKey(apiKey string) string {
+	if r != nil && r.plainKey {
+		return apiKey
+	}
+
+	return HashAPIKey(apiKey)
+}
+
+// Claims returns the allowlisted claims; nil when there is nothing to log.
+func (r *LogRedactor) Claims(c *Claims) map[string]any {
+	if r == nil || c == nil || len(r.allow) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	var all map[string]any
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil
+	}
+
+	out := make(map[string]any, len(r.allow))
+	for k, v := range all {
+		if !r.allow[k] {
+			continue
+		}
+		if k == "api_key" {
+			v = r.APIKey(c.APIKey)
+		}
+		out[k] = v
+	}
+
+	return out
+}
+
+// HashAPIKey returns a short stable digest of an api_key, so log lines can be correlated without the key.
+// Support can compute it for a known key to search logs.
+func HashAPIKey(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(apiKey))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
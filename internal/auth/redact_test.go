@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestLogRedactor(t *testing.T) {
+	claims := &Claims{
+		APIKey:        "secret-key",
+		AllowedRoutes: []string{"/api/v1/*"},
+		RateLimit:     5,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "customer-1",
+			ExpiresAt: jwt.NewNumericDate(time.Unix(1700000000, 0)),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.Token
+		wantKeys []string
+		wantKey  string
+	}{
+		{name: "default allowlist hashes api_key", cfg: config.Token{LogClaims: []string{"api_key", "exp"}},
+			wantKeys: []string{"api_key", "exp"}, wantKey: HashAPIKey("secret-key")},
+		{name: "plain api_key", cfg: config.Token{LogClaims: []string{"api_key"}, LogAPIKey: config.LogAPIKeyPlain},
+			wantKeys: []string{"api_key"}, wantKey: "secret-key"},
+		{name: "api_key not allowlisted", cfg: config.Token{LogClaims: []string{"sub", "rate_limit"}},
+			wantKeys: []string{"sub", "rate_limit"}},
+		{name: "nothing allowlisted", cfg: config.Token{}},
+	}
+
+	for _, tt := range tests {
+		got := NewLogRedactor(tt.cfg).Claims(claims)
+		if len(got) != len(tt.wantKeys) {
+			t.Fatalf("%s: claims=%v want keys %v", tt.name, got, tt.wantKeys)
+		}
+		for _, k := range tt.wantKeys {
+			if _, ok := got[k]; !ok {
+				t.Fatalf("%s: claim %q missing from %v", tt.name, k, got)
+			}
+		}
+		if tt.wantKey != "" && got["api_key"] != tt.wantKey {
+			t.Fatalf("%s: api_key=%v want=%v", tt.name, got["api_key"], tt.wantKey)
+		}
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	h := HashAPIKey("secret-key")
+	if !strings.HasPrefix(h, "sha256:") || strings.Contains(h, "secret") || h != HashAPIKey("secret-key") {
+		t.Fatalf("hash=%q must be a stable digest", h)
+	}
+	if HashAPIKey("") != "" || (*LogRedactor)(nil).APIKey("k") != HashAPIKey("k") {
+		t.Fatalf("nil redactor must hash")
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tyk-proxy/internal/cache"
+	mp "tyk-proxy/internal/metrics"
+)
+
+// RejectCache remembers tokens that failed verification (malformed, forged, expired) by SHA-256 of the token
+// string for ttl, so a client replaying the same bad token is rejected without another signature check.
+// Tokens that are not valid yet or signed by a key not yet fetched from JWKS are not cached, they may
+// become valid within ttl.
+type RejectCache struct {
+	next    verifier
+	lru     *cache.LRU[[sha256.Size]byte, error]
+	metrics *mp.Metrics
+}
+
+func NewRejectCache(next verifier, size int, ttl time.Duration, metrics *mp.Metrics) *RejectCache {
+	return &RejectCache{
+		next:    next,
+		lru:     cache.New[[sha256.Size]byte, error](size, ttl),
+		metrics: metrics,
+	}
+}
+
+func (v *RejectCache) WithOptions(opts *CachingOptions) {
+	v.lru.WithOptions(&cache.Options{Now: opts.Now})
+}
+
+func (v *RejectCache) Parse(tokenString string) (*Claims, error) {
+	key := sha256.Sum256([]byte(tokenString))
+	if err, ok := v.lru.Get(key); ok {
+		v.metrics.IncRejectCacheHit()
+		return nil, err
+	}
+
+	claims, err := v.next.Parse(tokenString)
+	if err != nil && !errors.Is(err, jwt.ErrTokenNotValidYet) && !errors.Is(err, ErrUnknownKid) {
+		v.lru.Set(key, err)
+	}
+
+	return claims, err
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRejectCache(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	next := &fakeVerifier{parseFn: func(tok string) (*Claims, error) {
+		switch tok {
+		case "forged":
+			return nil, errors.New("signature is invalid")
+		case "early":
+			return nil, fmt.Errorf("%w: %w", jwt.ErrTokenInvalidClaims, jwt.ErrTokenNotValidYet)
+		}
+		return newClaims("k-"+tok, now.Add(time.Hour), nil), nil
+	}}
+
+	v := NewRejectCache(next, 10, time.Minute, nil)
+	v.WithOptions(&CachingOptions{Now: func() time.Time { return now }})
+
+	tests := []struct {
+		token     string
+		wantErr   bool
+		wantCalls int // verifications after parsing the token twice
+	}{
+		{"forged", true, 1},
+		{"early", true, 2},
+		{"good", false, 2},
+	}
+
+	for _, tt := range tests {
+		next.calls = 0
+		for range 2 {
+			if _, err := v.Parse(tt.token); (err != nil) != tt.wantErr {
+				t.Fatalf("%s: err=%v wantErr=%v", tt.token, err, tt.wantErr)
+			}
+		}
+		if next.calls != tt.wantCalls {
+			t.Fatalf("%s: verifications=%d want %d", tt.token, next.calls, tt.wantCalls)
+		}
+	}
+
+	// entries expire after ttl
+	now = now.Add(2 * time.Minute)
+	next.calls = 0
+	_, _ = v.Parse("forged")
+	if next.calls != 1 {
+		t.Fatalf("verifications=%d want 1 after ttl", next.calls)
+	}
+}
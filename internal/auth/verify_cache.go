@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"tyk-proxy/internal/cache"
+)
+
+// CachingVerifier remembers successfully verified tokens by SHA-256 of the token string, so a client
+// sending the same token again skips signature verification. Entries live until the token's exp or
+// ttl, whichever comes first; failures are never cached. Revoked and killed keys need no eviction: the token
+// profile lookup and the revocation list run on the claims of every request, cached or not.
+//
+// Cached claims are shared between requests and must be treated as read-only.
+type CachingVerifier struct {
+	next verifier
+	lru  *cache.LRU[[sha256.Size]byte, *Claims]
+	ttl  time.Duration
+
+	// for tests
+	now func() time.Time
+}
+
+type CachingOptions struct {
+	// for tests
+	Now func() time.Time
+}
+
+func NewCachingVerifier(next verifier, size int, ttl time.Duration) *CachingVerifier {
+	return &CachingVerifier{
+		next: next,
+		lru:  cache.New[[sha256.Size]byte, *Claims](size, ttl),
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+func (v *CachingVerifier) WithOptions(opts *CachingOptions) {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	v.now = now
+	v.lru.WithOptions(&cache.Options{Now: now})
+}
+
+// maxStackToken bounds the tokens hashed from a stack copy; converting longer ones to []byte allocates.
+const maxStackToken = 2048
+
+// Parse serves a cached token without allocating, so the verify cache is the zero-allocation path for repeat
+// tokens; only misses go through the allocating JWT parser.
+func (v *CachingVerifier) Parse(tokenString string) (*Claims, error) {
+	key := tokenKey(tokenString)
+	now := v.now()
+
+	if claims, ok := v.lru.Get(key); ok {
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Time.After(now) {
+			return claims, nil
+		}
+		v.lru.Delete(key)
+	}
+
+	claims, err := v.next.Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return claims, nil
+	}
+
+	ttl := exp.Time.Sub(now)
+	if v.ttl > 0 && v.ttl < ttl {
+		ttl = v.ttl
+	}
+	if ttl > 0 {
+		v.lru.SetWithTTL(key, claims, ttl)
+	}
+
+	return claims, nil
+}
+
+func tokenKey(tokenString string) [sha256.Size]byte {
+	var buf [maxStackToken]byte
+	if len(tokenString) <= len(buf) {
+		n := copy(buf[:], tokenString)
+		return sha256.Sum256(buf[:n])
+	}
+
+	return sha256.Sum256([]byte(tokenString))
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachingVerifier(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	exp := now.Add(10 * time.Minute)
+
+	next := &fakeVerifier{parseFn: func(tok string) (*Claims, error) {
+		if tok == "bad" {
+			return nil, errors.New("signature is invalid")
+		}
+		return newClaims("k-"+tok, exp, nil), nil
+	}}
+
+	v := NewCachingVerifier(next, 10, 5*time.Minute)
+	v.WithOptions(&CachingOptions{Now: func() time.Time { return now }})
+
+	for i := 0; i < 3; i++ {
+		c, err := v.Parse("a")
+		if err != nil || c.APIKey != "k-a" {
+			t.Fatalf("claims=%v err=%v", c, err)
+		}
+	}
+	if next.calls != 1 {
+		t.Fatalf("verifications=%d want=1", next.calls)
+	}
+
+	// failures are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := v.Parse("bad"); err == nil {
+			t.Fatalf("expected error")
+		}
+	}
+	if next.calls != 3 {
+		t.Fatalf("verifications=%d want=3", next.calls)
+	}
+
+	// ttl bound
+	now = now.Add(6 * time.Minute)
+	if _, err := v.Parse("a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next.calls != 4 {
+		t.Fatalf("verifications=%d want=4 after ttl", next.calls)
+	}
+}
+
+func TestCachingVerifier_NotPastExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	exp := now.Add(30 * time.Second)
+
+	next := &fakeVerifier{parseFn: func(string) (*Claims, error) {
+		if !exp.After(now) {
+			return nil, errors.New("token is expired")
+		}
+		return newClaims("k1", exp, nil), nil
+	}}
+
+	v := NewCachingVerifier(next, 10, time.Hour)
+	v.WithOptions(&CachingOptions{Now: func() time.Time { return now }})
+
+	if _, err := v.Parse("t"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now = now.Add(31 * time.Second)
+	if _, err := v.Parse("t"); err == nil {
+		t.Fatalf("expired token served from cache")
+	}
+}
+
+func TestCachingVerifier_HitDoesNotAllocate(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	next := &fakeVerifier{parseFn: func(string) (*Claims, error) { return newClaims("k1", exp, nil), nil }}
+	v := NewCachingVerifier(next, 10, time.Minute)
+
+	tok := strings.Repeat("t", 600) // about the size of a signed token with a few routes
+	if _, err := v.Parse(tok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := v.Parse(tok); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("allocs per cached Parse=%v want 0", allocs)
+	}
+}
@@ -0,0 +1,174 @@
+// Package botsignal scores how likely a request comes from a bot or scanner from lightweight signals, so the
+// score can be logged, counted and, later, acted on.
+package botsignal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// Signals and the risk they add; a score is their sum, capped at 100.
+const (
+	SignalNoUserAgent     = "no_user_agent"
+	SignalScannerAgent    = "scanner_agent"
+	SignalToolAgent       = "tool_agent"
+	SignalNoAccept        = "no_accept"
+	SignalBrowserMismatch = "browser_mismatch"
+	SignalHTTP10          = "http10"
+	SignalBotJA3          = "bot_ja3"
+)
+
+var weights = map[string]int{
+	SignalNoUserAgent:     30,
+	SignalScannerAgent:    60,
+	SignalToolAgent:       15,
+	SignalNoAccept:        10,
+	SignalBrowserMismatch: 30,
+	SignalHTTP10:          15,
+	SignalBotJA3:          60,
+}
+
+const maxScore = 100
+
+const (
+	BucketLow    = "low"    // below 30
+	BucketMedium = "medium" // 30 to 59
+	BucketHigh   = "high"   // 60 and above
+)
+
+// scanners are User-Agent substrings of vulnerability scanners and mass crawlers.
+var scanners = []string{"sqlmap", "nikto", "nmap", "masscan", "zgrab", "nuclei", "dirbuster", "gobuster", "wpscan", "acunetix", "nessus"}
+
+// tools are User-Agent prefixes of HTTP libraries and command line clients: legitimate API clients use them too,
+// so they only add a little.
+var tools = []string{"curl/", "wget/", "python-requests/", "python-urllib/", "go-http-client/", "java/", "okhttp/", "libwww-perl/"}
+
+// Score is the bot risk of a request.
+type Score struct {
+	Value   int
+	Signals []string // empty when no signal fired
+	JA3     string   // empty unless TLS terminates here
+}
+
+// Bucket names the range of the score, for metric labels.
+func (s Score) Bucket() string {
+	switch {
+	case s.Value >= 60:
+		return BucketHigh
+	case s.Value >= 30:
+		return BucketMedium
+	default:
+		return BucketLow
+	}
+}
+
+type ctxKey struct{}
+
+// FromContext returns the score Middleware gave the request.
+func FromContext(ctx context.Context) (Score, bool) {
+	s, ok := ctx.Value(ctxKey{}).(Score)
+	return s, ok
+}
+
+type Scorer struct {
+	scanners []string
+	botJA3   map[string]struct{}
+	metrics  *mp.Metrics
+}
+
+func New(cfg config.BotSignals, metrics *mp.Metrics) *Scorer {
+	s := &Scorer{scanners: scanners, botJA3: map[string]struct{}{}, metrics: metrics}
+	for _, a := range cfg.ScannerAgents {
+		s.scanners = append(s.scanners, strings.ToLower(a))
+	}
+	for _, h := range cfg.BotJA3 {
+		s.botJA3[strings.ToLower(h)] = struct{}{}
+	}
+
+	return s
+}
+
+// Score collects the signals of r.
+func (s *Scorer) Score(r *http.Request) Score {
+	var sc Score
+	add := func(signal string) {
+		sc.Signals = append(sc.Signals, signal)
+		sc.Value = min(sc.Value+weights[signal], maxScore)
+	}
+
+	ua := strings.ToLower(r.Header.Get("User-Agent"))
+	switch {
+	case ua == "":
+		add(SignalNoUserAgent)
+	case containsAny(ua, s.scanners):
+		add(SignalScannerAgent)
+	case hasAnyPrefix(ua, tools):
+		add(SignalToolAgent)
+	case strings.HasPrefix(ua, "mozilla/") && (r.Header.Get("Accept-Language") == "" || r.Header.Get("Accept-Encoding") == ""):
+		// every browser sends both; a client claiming to be one without them is pretending
+		add(SignalBrowserMismatch)
+	}
+
+	if r.Header.Get("Accept") == "" {
+		add(SignalNoAccept)
+	}
+	if r.ProtoMajor == 1 && r.ProtoMinor == 0 {
+		add(SignalHTTP10)
+	}
+
+	if sc.JA3 = ja3FromContext(r.Context()); sc.JA3 != "" {
+		if _, ok := s.botJA3[sc.JA3]; ok {
+			add(SignalBotJA3)
+		}
+	}
+
+	return sc
+}
+
+// Middleware scores every request, records the score in the decision log and bot_risk_requests_total, and
+// makes it available to later handlers through FromContext. It never rejects a request.
+func (s *Scorer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc := s.Score(r)
+
+		label := "unmatched"
+		if rt, ok := routes.FromContext(r.Context()); ok {
+			label = rt.Path
+		}
+		s.metrics.IncBotRisk(label, sc.Bucket())
+
+		signals := sc.Signals
+		if signals == nil {
+			signals = []string{}
+		}
+		decision.FromContext(r.Context()).SetRisk(sc.Value, signals)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, sc)))
+	})
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+package botsignal
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestScore(t *testing.T) {
+	s := New(config.BotSignals{ScannerAgents: []string{"EvilBot"}}, nil)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		proto   string
+		want    []string
+		bucket  string
+	}{
+		{
+			name:    "api client",
+			headers: map[string]string{"User-Agent": "billing-service/2.1", "Accept": "application/json"},
+			want:    nil,
+			bucket:  BucketLow,
+		},
+		{
+			name:    "browser",
+			headers: map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64)", "Accept": "*/*", "Accept-Language": "en", "Accept-Encoding": "gzip"},
+			want:    nil,
+			bucket:  BucketLow,
+		},
+		{
+			name:    "curl",
+			headers: map[string]string{"User-Agent": "curl/8.5.0", "Accept": "*/*"},
+			want:    []string{SignalToolAgent},
+			bucket:  BucketLow,
+		},
+		{
+			name:    "fake browser",
+			headers: map[string]string{"User-Agent": "Mozilla/5.0", "Accept": "*/*"},
+			want:    []string{SignalBrowserMismatch},
+			bucket:  BucketMedium,
+		},
+		{
+			name:   "bare request",
+			proto:  "HTTP/1.0",
+			want:   []string{SignalNoUserAgent, SignalNoAccept, SignalHTTP10},
+			bucket: BucketMedium,
+		},
+		{
+			name:    "configured scanner",
+			headers: map[string]string{"User-Agent": "evilbot/0.1"},
+			want:    []string{SignalScannerAgent, SignalNoAccept},
+			bucket:  BucketHigh,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/items", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.proto == "HTTP/1.0" {
+				req.Proto, req.ProtoMinor = tt.proto, 0
+			}
+
+			sc := s.Score(req)
+			if !slices.Equal(sc.Signals, tt.want) || sc.Bucket() != tt.bucket {
+				t.Fatalf("signals=%v bucket=%s (score %d), want %v %s", sc.Signals, sc.Bucket(), sc.Value, tt.want, tt.bucket)
+			}
+		})
+	}
+}
+
+func TestJA3(t *testing.T) {
+	var got Score
+	scorer := New(config.BotSignals{}, nil)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = scorer.Score(r)
+	}))
+	srv.Listener = Listener(srv.Listener)
+	srv.Config.ConnContext = ConnContext
+	srv.TLS = &tls.Config{}
+	srv.TLS.GetConfigForClient = ConfigForClient(nil)
+	srv.StartTLS()
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if len(got.JA3) != 32 {
+		t.Fatalf("ja3=%q want an MD5 hex digest", got.JA3)
+	}
+
+	// the same client is recognized once its fingerprint is listed
+	scorer.botJA3[got.JA3] = struct{}{}
+	resp, err = srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !slices.Contains(got.Signals, SignalBotJA3) {
+		t.Fatalf("signals=%v want %s", got.Signals, SignalBotJA3)
+	}
+}
+
+func TestGrease(t *testing.T) {
+	for _, v := range []uint16{0x0a0a, 0x1a1a, 0xfafa} {
+		if !grease(v) {
+			t.Fatalf("%#x is GREASE", v)
+		}
+	}
+	for _, v := range []uint16{0x0a1a, 0x1301, 0x0303} {
+		if grease(v) {
+			t.Fatalf("%#x is not GREASE", v)
+		}
+	}
+}
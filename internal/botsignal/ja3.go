@@ -0,0 +1,126 @@
+package botsignal
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// JA3 fingerprints a TLS client by its hello: the MD5 of version, cipher suites, extensions, curves and point
+// formats, GREASE values left out.
+func JA3(hello *tls.ClientHelloInfo) string {
+	// the legacy version of the hello is not exposed; TLS 1.3 clients send TLS 1.2 (771) in it
+	version := uint16(0)
+	for _, v := range hello.SupportedVersions {
+		if !grease(v) && v > version {
+			version = min(v, tls.VersionTLS12)
+		}
+	}
+
+	curves := make([]uint16, len(hello.SupportedCurves))
+	for i, c := range hello.SupportedCurves {
+		curves[i] = uint16(c)
+	}
+	points := make([]uint16, len(hello.SupportedPoints))
+	for i, p := range hello.SupportedPoints {
+		points[i] = uint16(p)
+	}
+
+	s := strings.Join([]string{
+		strconv.Itoa(int(version)),
+		joinValues(hello.CipherSuites),
+		joinValues(hello.Extensions),
+		joinValues(curves),
+		joinValues(points),
+	}, ",")
+	sum := md5.Sum([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func joinValues(vs []uint16) string {
+	parts := make([]string, 0, len(vs))
+	for _, v := range vs {
+		if !grease(v) {
+			parts = append(parts, strconv.Itoa(int(v)))
+		}
+	}
+
+	return strings.Join(parts, "-")
+}
+
+// grease reports whether v is a GREASE value (RFC 8701), sent at random to keep servers tolerant.
+func grease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// To see JA3 fingerprints, the raw listener under TLS is wrapped by Listener, the tls.Config gets its
+// GetConfigForClient from ConfigForClient and the http.Server its ConnContext.
+
+// fingerprintConn carries the JA3 of its TLS hello, set during the handshake.
+type fingerprintConn struct {
+	net.Conn
+	ja3 string
+}
+
+type listener struct {
+	net.Listener
+}
+
+// Listener wraps the raw listener under a TLS one, so the hello of every connection can be fingerprinted.
+func Listener(l net.Listener) net.Listener {
+	return listener{l}
+}
+
+func (l listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &fingerprintConn{Conn: c}, nil
+}
+
+// ConfigForClient returns a GetConfigForClient callback that fingerprints hellos and then calls next, which
+// may be nil.
+func ConfigForClient(next func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if fc, ok := hello.Conn.(*fingerprintConn); ok {
+			fc.ja3 = JA3(hello)
+		}
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+}
+
+type ja3Key struct{}
+
+// ConnContext makes the connection's JA3 available to its requests. The handshake completes before the first
+// request is read, so the fingerprint is set by the time it is looked up.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	tc, ok := c.(*tls.Conn)
+	if !ok {
+		return ctx
+	}
+	fc, ok := tc.NetConn().(*fingerprintConn)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, ja3Key{}, fc)
+}
+
+func ja3FromContext(ctx context.Context) string {
+	fc, ok := ctx.Value(ja3Key{}).(*fingerprintConn)
+	if !ok {
+		return ""
+	}
+
+	return fc.ja3
+}
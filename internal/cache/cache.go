@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a size-bounded cache with per-entry expiration, safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[K]*list.Element
+
+	// for tests
+	now func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	val       V
+	expiresAt time.Time
+}
+
+type Options struct {
+	// for tests
+	Now func() time.Time
+}
+
+// New creates a cache holding at most size entries, each living for ttl.
+// ttl <= 0 means entries never expire and are only evicted by size.
+func New[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &LRU[K, V]{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[K]*list.Element, size),
+		now:   time.Now,
+	}
+}
+
+func (c *LRU[K, V]) WithOptions(opts *Options) {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	c.now = now
+}
+
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if !e.expiresAt.IsZero() && !e.expiresAt.After(c.now()) {
+		c.removeElement(el)
+		return zero, false
+	}
+
+	c.ll.MoveToFront(el)
+	return e.val, true
+}
+
+func (c *LRU[K, V]) Set(key K, val V) {
+	c.SetWithTTL(key, val, c.ttl)
+}
+
+// SetWithTTL stores val with an explicit ttl, overriding the cache default.
+func (c *LRU[K, V]) SetWithTTL(key K, val V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var exp time.Time
+	if ttl > 0 {
+		exp = c.now().Add(ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.val = val
+		e.expiresAt = exp
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, val: val, expiresAt: exp})
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *LRU[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// Range calls fn for unexpired entries, most recently used first, until fn returns false. It does not
+// change recency. fn runs under the cache lock and must not call back into the cache.
+func (c *LRU[K, V]) Range(fn func(key K, val V, expiresAt time.Time) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*entry[K, V])
+		if !e.expiresAt.IsZero() && !e.expiresAt.After(now) {
+			continue
+		}
+		if !fn(e.key, e.val, e.expiresAt) {
+			return
+		}
+	}
+}
+
+// DeleteFunc removes every entry whose key matches and returns how many were removed.
+func (c *LRU[K, V]) DeleteFunc(match func(key K) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for el := c.ll.Front(); el != nil; {
+		next := el.Next()
+		if match(el.Value.(*entry[K, V]).key) {
+			c.removeElement(el)
+			n++
+		}
+		el = next
+	}
+
+	return n
+}
+
+func (c *LRU[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
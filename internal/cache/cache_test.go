@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU_GetSet(t *testing.T) {
+	c := New[string, int](2, 0)
+	c.Set("a", 1)
+
+	v, ok := c.Get("a")
+	if !ok || v != 1 {
+		t.Fatalf("Get(a) => (%d,%v), want (1,true)", v, ok)
+	}
+
+	if _, ok := c.Get("missing"); ok {
+		t.Fatalf("Get(missing) should miss")
+	}
+}
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2, 0)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	_, _ = c.Get("a") // a becomes most recent
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatalf("b should have been evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("a should still be cached")
+	}
+	if c.Len() != 2 {
+		t.Fatalf("len=%d want=2", c.Len())
+	}
+}
+
+func TestLRU_Expiration(t *testing.T) {
+	now := time.Date(2026, 2, 8, 12, 0, 0, 0, time.UTC)
+	c := New[string, int](10, time.Minute)
+	c.WithOptions(&Options{Now: func() time.Time { return now }})
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(2 * time.Minute)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("a should have expired")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Fatalf("b should not have expired")
+	}
+	if c.Len() != 1 {
+		t.Fatalf("expired entry should be removed; len=%d", c.Len())
+	}
+}
+
+func TestLRU_Delete(t *testing.T) {
+	c := New[string, int](2, 0)
+	c.Set("a", 1)
+	c.Delete("a")
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("a should be deleted")
+	}
+}
+
+func TestLRU_RangeAndDeleteFunc(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := New[string, int](10, 0)
+	c.WithOptions(&Options{Now: func() time.Time { return now }})
+
+	c.Set("/a/1", 1)
+	c.Set("/a/2", 2)
+	c.SetWithTTL("/b/1", 3, time.Second)
+	c.SetWithTTL("/b/2", 4, time.Minute)
+	now = now.Add(2 * time.Second)
+
+	var keys []string
+	c.Range(func(k string, _ int, _ time.Time) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if len(keys) != 3 || keys[0] != "/b/2" || keys[2] != "/a/1" {
+		t.Fatalf("Range keys=%v, want live entries most recent first", keys)
+	}
+
+	if n := c.DeleteFunc(func(k string) bool { return k[:3] == "/a/" }); n != 2 {
+		t.Fatalf("DeleteFunc removed %d, want 2", n)
+	}
+	if _, ok := c.Get("/a/1"); ok || c.Len() != 2 {
+		t.Fatalf("prefix entries should be gone, len=%d", c.Len())
+	}
+}
@@ -0,0 +1,193 @@
+// Package capture records a sample of sanitized API requests for later replay.
+package capture
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/async"
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+)
+
+const (
+	resultWritten = "written"
+	resultDropped = "dropped"
+	resultFailed  = "failed"
+
+	queueName = "capture"
+)
+
+// Record is one captured request and the response status the proxy returned for it.
+// Records are stored as JSON lines; Body is base64 encoded by encoding/json.
+type Record struct {
+	Time      time.Time   `json:"time"`
+	RequestID string      `json:"request_id,omitempty"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+	Query     string      `json:"query,omitempty"`
+	Header    http.Header `json:"header,omitempty"`
+	Body      []byte      `json:"body,omitempty"`
+
+	// BodyTruncated is set when the body was longer than the capture limit.
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+	// BodyOmitted explains why the body was not kept at all.
+	BodyOmitted string `json:"body_omitted,omitempty"`
+
+	Status     int     `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Sink stores captured records.
+type Sink interface {
+	Write(ctx context.Context, rec Record) error
+	Close() error
+}
+
+// Capturer samples requests passing through Middleware and hands them to a Sink in the background,
+// so a slow sink never delays traffic; records that do not fit the buffer are dropped.
+type Capturer struct {
+	sink     Sink
+	redactor *Redactor
+	rate     float64
+	maxBody  int64
+	metrics  *mp.Metrics
+
+	queue *async.Queue[Record]
+
+	// for tests
+	sample func() float64
+}
+
+type Options struct {
+	// for tests
+	Sample func() float64
+}
+
+func New(cfg config.Capture, sink Sink, metrics *mp.Metrics) (*Capturer, error) {
+	redactor, err := NewRedactor(cfg.Redact)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Capturer{
+		sink:     sink,
+		redactor: redactor,
+		rate:     cfg.SampleRate,
+		maxBody:  cfg.MaxBodyBytes,
+		metrics:  metrics,
+		sample:   rand.Float64,
+	}
+	c.queue = async.New(queueName, cfg.BufferSize, 1, c.write, metrics)
+
+	return c, nil
+}
+
+func (c *Capturer) WithOptions(opts *Options) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	sample := opts.Sample
+	if sample == nil {
+		sample = rand.Float64
+	}
+
+	c.sample = sample
+}
+
+func (c *Capturer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.sample() >= c.rate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := Record{
+			Time:      start.UTC(),
+			RequestID: middleware.GetReqID(r.Context()),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Query:     r.URL.RawQuery,
+			Header:    r.Header.Clone(),
+		}
+
+		// the body is copied as the upstream reads it, so capture never buffers ahead of the proxy
+		var body *teeBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &teeBody{ReadCloser: r.Body, limit: c.maxBody}
+			r.Body = body
+		}
+
+		sr := &mp.StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(sr, r)
+
+		rec.Status = sr.Status
+		rec.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		if body != nil {
+			rec.Body = body.buf
+			rec.BodyTruncated = body.truncated
+		}
+
+		c.redactor.Apply(&rec)
+		c.enqueue(rec)
+	})
+}
+
+func (c *Capturer) enqueue(rec Record) {
+	if !c.queue.Push(rec) {
+		c.metrics.IncCaptureRecord(resultDropped)
+	}
+}
+
+func (c *Capturer) write(rec Record) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.sink.Write(ctx, rec); err != nil {
+		log.Debug().Err(err).Msg("capture sink write failed")
+		c.metrics.IncCaptureRecord(resultFailed)
+		return
+	}
+	c.metrics.IncCaptureRecord(resultWritten)
+}
+
+// Close flushes queued records and closes the sink. Records arriving afterwards are dropped.
+func (c *Capturer) Close() error {
+	c.queue.Close()
+
+	return c.sink.Close()
+}
+
+// teeBody keeps up to limit bytes of what is read through it.
+type teeBody struct {
+	io.ReadCloser
+	limit     int64
+	buf       []byte
+	truncated bool
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		room := b.limit - int64(len(b.buf))
+		switch {
+		case room >= int64(n):
+			b.buf = append(b.buf, p[:n]...)
+		case room > 0:
+			b.buf = append(b.buf, p[:room]...)
+			b.truncated = true
+		default:
+			b.truncated = true
+		}
+	}
+
+	return n, err
+}
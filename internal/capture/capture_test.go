@@ -0,0 +1,88 @@
+package capture
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"tyk-proxy/internal/config"
+)
+
+type fakeSink struct {
+	mu      sync.Mutex
+	records []Record
+	closed  bool
+}
+
+func (f *fakeSink) Write(_ context.Context, rec Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, rec)
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestCapturer_Middleware(t *testing.T) {
+	sink := &fakeSink{}
+	c, err := New(config.Capture{SampleRate: 0.5, MaxBodyBytes: 8, BufferSize: 10}, sink, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	samples := []float64{0.1, 0.9}
+	c.WithOptions(&Options{Sample: func() float64 {
+		v := samples[0]
+		samples = samples[1:]
+		return v
+	}})
+
+	var upstreamBody string
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		upstreamBody = string(b)
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/items?x=1", strings.NewReader("0123456789abcdef"))
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if upstreamBody != "0123456789abcdef" {
+			t.Fatalf("upstream body=%q want full body", upstreamBody)
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !sink.closed {
+		t.Fatalf("sink not closed")
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("records=%d want=1 (second request not sampled)", len(sink.records))
+	}
+
+	rec := sink.records[0]
+	if rec.Method != http.MethodPost || rec.Path != "/api/v1/items" || rec.Query != "x=1" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if rec.Status != http.StatusCreated {
+		t.Fatalf("status=%d want=%d", rec.Status, http.StatusCreated)
+	}
+	if string(rec.Body) != "01234567" || !rec.BodyTruncated {
+		t.Fatalf("body=%q truncated=%v want first 8 bytes", rec.Body, rec.BodyTruncated)
+	}
+	if rec.Header.Get("Authorization") != "" {
+		t.Fatalf("authorization header captured")
+	}
+}
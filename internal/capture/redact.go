@@ -0,0 +1,165 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"tyk-proxy/internal/config"
+)
+
+const redacted = "[REDACTED]"
+
+// credentialHeaders never leave the proxy, whatever the configuration says.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// Redactor removes credentials and masks configured PII in captured records.
+type Redactor struct {
+	headers    []string
+	query      map[string]struct{}
+	jsonFields map[string]struct{}
+	patterns   []*regexp.Regexp
+}
+
+func NewRedactor(cfg config.Redact) (*Redactor, error) {
+	r := &Redactor{
+		headers:    append(append([]string{}, credentialHeaders...), cfg.Headers...),
+		query:      lowerSet(cfg.QueryParams),
+		jsonFields: lowerSet(cfg.JSONFields),
+	}
+
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// Apply sanitizes rec in place.
+func (r *Redactor) Apply(rec *Record) {
+	for _, h := range r.headers {
+		rec.Header.Del(h)
+	}
+
+	rec.Query = r.redactQuery(rec.Query)
+
+	if len(rec.Body) == 0 {
+		return
+	}
+
+	if enc := rec.Header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") && r.redactsBody() {
+		// masking rules cannot be applied to compressed bytes, so the body is not kept
+		rec.Body = nil
+		rec.BodyOmitted = "encoded"
+		return
+	}
+
+	if len(r.jsonFields) > 0 && strings.Contains(rec.Header.Get("Content-Type"), "json") {
+		// fields can only be found in a complete document; a cut or broken one could leak them
+		if rec.BodyTruncated {
+			rec.Body = nil
+			rec.BodyOmitted = "truncated"
+			return
+		}
+		body, ok := r.redactJSON(rec.Body)
+		if !ok {
+			rec.Body = nil
+			rec.BodyOmitted = "invalid_json"
+			return
+		}
+		rec.Body = body
+	}
+
+	if len(r.patterns) > 0 {
+		rec.Body = []byte(r.maskPatterns(string(rec.Body)))
+	}
+}
+
+func (r *Redactor) redactsBody() bool {
+	return len(r.jsonFields) > 0 || len(r.patterns) > 0
+}
+
+func (r *Redactor) redactQuery(raw string) string {
+	if raw == "" || (len(r.query) == 0 && len(r.patterns) == 0) {
+		return raw
+	}
+
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		// unparsable queries are replayed as-is only when nothing could be hidden in them
+		return redacted
+	}
+
+	for k, vs := range q {
+		if _, ok := r.query[strings.ToLower(k)]; ok {
+			for i := range vs {
+				vs[i] = redacted
+			}
+			continue
+		}
+		for i, v := range vs {
+			vs[i] = r.maskPatterns(v)
+		}
+	}
+
+	return q.Encode()
+}
+
+// redactJSON replaces the configured fields of a JSON document, reporting false when body is not one.
+func (r *Redactor) redactJSON(body []byte) ([]byte, bool) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+
+	out, err := json.Marshal(r.walk(v))
+	if err != nil {
+		return nil, false
+	}
+
+	return out, true
+}
+
+func (r *Redactor) walk(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if _, ok := r.jsonFields[strings.ToLower(k)]; ok {
+				t[k] = redacted
+				continue
+			}
+			t[k] = r.walk(val)
+		}
+	case []any:
+		for i := range t {
+			t[i] = r.walk(t[i])
+		}
+	}
+
+	return v
+}
+
+func (r *Redactor) maskPatterns(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+
+	return s
+}
+
+func lowerSet(items []string) map[string]struct{} {
+	m := make(map[string]struct{}, len(items))
+	for _, it := range items {
+		m[strings.ToLower(it)] = struct{}{}
+	}
+
+	return m
+}
@@ -0,0 +1,126 @@
+package capture
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestRedactor_Apply(t *testing.T) {
+	r, err := NewRedactor(config.Redact{
+		Headers:     []string{"X-User-Email"},
+		QueryParams: []string{"token"},
+		JSONFields:  []string{"password", "SSN"},
+		Patterns:    []string{`[\w.+-]+@[\w-]+\.[\w.]+`},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := Record{
+		Header: http.Header{
+			"Authorization": {"Bearer secret"},
+			"Cookie":        {"session=1"},
+			"X-Api-Key":     {"k"},
+			"X-User-Email":  {"a@b.io"},
+			"Content-Type":  {"application/json"},
+			"Accept":        {"*/*"},
+		},
+		Query: "token=abc&q=mail+me+at+x%40y.com&page=2",
+		Body:  []byte(`{"user":{"password":"p","ssn":"1","email":"bob@example.com"},"items":[{"Password":"q"}],"n":12345678901234567890}`),
+	}
+	r.Apply(&rec)
+
+	for _, h := range []string{"Authorization", "Cookie", "X-Api-Key", "X-User-Email"} {
+		if v := rec.Header.Get(h); v != "" {
+			t.Fatalf("header %s=%q want removed", h, v)
+		}
+	}
+	if rec.Header.Get("Accept") != "*/*" {
+		t.Fatalf("unrelated header removed")
+	}
+
+	for _, leaked := range []string{"abc", "x@y.com", "x%40y.com"} {
+		if strings.Contains(rec.Query, leaked) {
+			t.Fatalf("query %q leaks %q", rec.Query, leaked)
+		}
+	}
+	if !strings.Contains(rec.Query, "page=2") {
+		t.Fatalf("query %q lost page=2", rec.Query)
+	}
+
+	body := string(rec.Body)
+	for _, leaked := range []string{`"p"`, `"1"`, `"q"`, "bob@example.com"} {
+		if strings.Contains(body, leaked) {
+			t.Fatalf("body %s leaks %s", body, leaked)
+		}
+	}
+	if !strings.Contains(body, "12345678901234567890") {
+		t.Fatalf("body %s lost number precision", body)
+	}
+}
+
+func TestRedactor_EncodedBodyOmitted(t *testing.T) {
+	r, err := NewRedactor(config.Redact{JSONFields: []string{"password"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := Record{
+		Header: http.Header{"Content-Encoding": {"gzip"}},
+		Body:   []byte{0x1f, 0x8b},
+	}
+	r.Apply(&rec)
+
+	if rec.Body != nil || rec.BodyOmitted != "encoded" {
+		t.Fatalf("body=%v omitted=%q want omitted", rec.Body, rec.BodyOmitted)
+	}
+}
+
+func TestRedactor_TruncatedJSONOmitted(t *testing.T) {
+	r, err := NewRedactor(config.Redact{JSONFields: []string{"password"}, Patterns: []string{`secret-\d+`}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := Record{
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          []byte(`{"note":"secret-42","password":"p`),
+		BodyTruncated: true,
+	}
+	r.Apply(&rec)
+
+	if rec.Body != nil || rec.BodyOmitted != "truncated" {
+		t.Fatalf("body=%s omitted=%q want the truncated body omitted", rec.Body, rec.BodyOmitted)
+	}
+
+	rec = Record{
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   []byte(`{"password":"p",}`),
+	}
+	r.Apply(&rec)
+
+	if rec.Body != nil || rec.BodyOmitted != "invalid_json" {
+		t.Fatalf("body=%s omitted=%q want the invalid body omitted", rec.Body, rec.BodyOmitted)
+	}
+}
+
+func TestRedactor_TruncatedTextKeepsPatternMasking(t *testing.T) {
+	r, err := NewRedactor(config.Redact{JSONFields: []string{"password"}, Patterns: []string{`secret-\d+`}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := Record{
+		Header:        http.Header{"Content-Type": {"text/plain"}},
+		Body:          []byte(`note secret-42 and more`),
+		BodyTruncated: true,
+	}
+	r.Apply(&rec)
+
+	if rec.Body == nil || strings.Contains(string(rec.Body), "secret-42") {
+		t.Fatalf("body %s want kept with the pattern masked", rec.Body)
+	}
+}
@@ -0,0 +1,95 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+
+	"tyk-proxy/internal/config"
+)
+
+// FileSink appends records to a file as JSON lines.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	// records are sparse (sampled), so flushing each keeps the file useful while the proxy runs
+	return s.w.Flush()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.w.Flush(); err != nil {
+		_ = s.f.Close()
+		return err
+	}
+
+	return s.f.Close()
+}
+
+// KafkaSink publishes records as JSON messages keyed by request id.
+type KafkaSink struct {
+	w *kafka.Writer
+}
+
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{w: &kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Topic:    topic,
+		Balancer: &kafka.LeastBytes{},
+		// batches are flushed in the background; delivery errors are logged by the writer
+		Async: true,
+	}}
+}
+
+func (s *KafkaSink) Write(ctx context.Context, rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return s.w.WriteMessages(ctx, kafka.Message{Key: []byte(rec.RequestID), Value: b})
+}
+
+func (s *KafkaSink) Close() error {
+	return s.w.Close()
+}
+
+// NewSink builds the sink selected in the capture config.
+func NewSink(cfg config.Capture) (Sink, error) {
+	if cfg.Sink == config.CaptureSinkKafka {
+		return NewKafkaSink(cfg.Kafka.Brokers, cfg.Kafka.Topic), nil
+	}
+
+	return NewFileSink(cfg.File)
+}
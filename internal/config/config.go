@@ -1,9 +1,14 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,177 +17,2718 @@ import (
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
 	"github.com/pkg/errors"
+
+	"tyk-proxy/internal/semver"
+)
+
+type Config struct {
+	Application    Application    `json:"application"`
+	ServerTimeouts ServerTimeouts `json:"server_timeouts"`
+	Redis          Redis          `json:"redis"`
+	Log            Log            `json:"log"`
+	Monitoring     Monitoring     `json:"monitoring"`
+	OPA            OPA            `json:"opa"`
+	Admin          Admin          `json:"admin"`
+	RateLimitStore RateLimitStore `json:"rate_limit_store"`
+	TokenStore     TokenStore     `json:"token_store"`
+	Capture        Capture        `json:"capture"`
+	LogShipping    LogShipping    `json:"log_shipping"`
+	Analytics      Analytics      `json:"analytics"`
+	Hooks          Hooks          `json:"hooks"`
+	WAF            WAF            `json:"waf"`
+
+	// Flags are global defaults of runtime feature toggles; routes may override them.
+	Flags map[string]bool `json:"flags"`
+}
+
+type Application struct {
+	TargetHost string  `json:"target_host"`
+	Port       int     `json:"port"`
+	Token      Token   `json:"token"`
+	Routes     []Route `json:"routes"`
+
+	// IP the main listener binds, e.g. only the private interface; empty binds all interfaces.
+	IP string `json:"ip"`
+
+	// MaxBodyBytes limits request bodies on proxied routes unless a route overrides it.
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+
+	// MaxURLLength caps the request target in bytes (414 beyond it) and MaxQueryParams the number of
+	// query parameters (400 beyond it), protecting upstream parsers and keeping logs and metrics sane.
+	MaxURLLength   int `json:"max_url_length"`
+	MaxQueryParams int `json:"max_query_params"`
+
+	// PathNormalization canonicalizes request paths before route matching and scope checks.
+	PathNormalization PathNormalization `json:"path_normalization"`
+
+	// ReadyUpstream keeps /ready failing while target_host is unreachable. Leave it unset when routes send
+	// traffic to other upstreams too, as one unreachable upstream should not take the instance out.
+	ReadyUpstream *ReadyUpstream `json:"ready_upstream,omitempty"`
+
+	// DefaultRateLimit applies to tokens without their own rate_limit on routes without one; 0 means none.
+	DefaultRateLimit int `json:"default_rate_limit"`
+
+	// Plans are named limit templates token profiles can reference instead of inlining their own.
+	Plans map[string]Plan `json:"plans"`
+
+	Streaming Streaming `json:"streaming"`
+
+	// ResponseCache holds GET responses of routes with cache configured, shared by all of them.
+	ResponseCache ResponseCache `json:"response_cache"`
+
+	// ResponseScrub masks secrets in upstream response bodies before they leave the gateway.
+	ResponseScrub ResponseScrub `json:"response_scrub"`
+
+	// SignedURLs lets GET and HEAD requests authenticate with an HMAC-signed URL instead of a bearer token.
+	SignedURLs SignedURLs `json:"signed_urls"`
+
+	// Socket tunes the TCP connections accepted by the main listener.
+	Socket SocketOptions `json:"socket"`
+
+	// TLS terminates TLS on the main listener, optionally requiring client certificates.
+	TLS ServerTLS `json:"tls"`
+
+	// UpstreamPool sizes the connection pool toward the upstream; routes with their own upstream_pool get a
+	// separate pool, so a slow upstream behind them cannot exhaust the connections of the others.
+	UpstreamPool UpstreamPool `json:"upstream_pool"`
+
+	UpstreamRateLimit UpstreamRateLimit `json:"upstream_rate_limit"`
+	ConcurrencyLimit  ConcurrencyLimit  `json:"concurrency_limit"`
+
+	// Experiments assign authenticated callers to A/B buckets, announced upstream in X-Experiment-Bucket.
+	Experiments []Experiment `json:"experiments"`
+
+	// BotSignals scores every API request for bot and scanner traits, for logs, metrics and later policies.
+	BotSignals BotSignals `json:"bot_signals"`
+}
+
+// BotSignals adds ScannerAgents (User-Agent substrings, case-insensitive) to the built-in scanner list and
+// BotJA3 fingerprints (MD5, hex) of TLS clients known to be bots; JA3 is only seen where TLS terminates here.
+type BotSignals struct {
+	Enabled       bool     `json:"enabled"`
+	ScannerAgents []string `json:"scanner_agents"`
+	BotJA3        []string `json:"bot_ja3"`
+}
+
+// PathNormalization merges duplicate slashes and resolves dot segments unless Disabled,
+// so /api/v1/../v1/admin is checked and proxied as /api/v1/admin.
+type PathNormalization struct {
+	Disabled      bool   `json:"disabled"`
+	TrailingSlash string `json:"trailing_slash"` // keep (default) or strip
+	LowercaseHost bool   `json:"lowercase_host"`
+
+	// EncodedSlash decides what %2F means: decode (default) treats it as a separator, keep passes it
+	// through to the upstream (dot segments behind it are rejected), reject answers 400.
+	EncodedSlash string `json:"encoded_slash"`
+	// Strict rejects ambiguous encodings: double encoding (%252F), encoded backslash and control characters.
+	Strict bool `json:"strict"`
+}
+
+const (
+	TrailingSlashKeep  = "keep"
+	TrailingSlashStrip = "strip"
+
+	EncodedSlashDecode = "decode"
+	EncodedSlashKeep   = "keep"
+	EncodedSlashReject = "reject"
+)
+
+// Streaming limits long-lived streaming responses (by Content-Type) per proxy instance:
+// MaxPerToken open streams per api_key (0 means unlimited) and MaxDuration per stream (0 means unlimited).
+type Streaming struct {
+	ContentTypes []string      `json:"content_types"` // default text/event-stream, application/x-ndjson
+	MaxPerToken  int           `json:"max_per_token"`
+	MaxDuration  time.Duration `json:"max_duration"`
+}
+
+// ResponseScrub replaces matches of Patterns in response bodies of ContentTypes (default JSON, XML and text
+// other than event streams). Routes limits it to route paths (all routes when empty). Bodies over MaxBodyBytes
+// (default 1 MiB), compressed or partial ones pass unscanned and are counted as skipped.
+type ResponseScrub struct {
+	Patterns     []ScrubPattern `json:"patterns"` // empty disables scrubbing
+	Routes       []string       `json:"routes"`
+	MaxBodyBytes int64          `json:"max_body_bytes"`
+	ContentTypes []string       `json:"content_types"`
+}
+
+// ScrubPattern is a regular expression, or with Name credit_card and no Regex the built-in Luhn-checked card
+// number matcher. Name labels the scrub metrics; Replacement (default [REDACTED]) may refer to groups as $1.
+type ScrubPattern struct {
+	Name        string `json:"name"`
+	Regex       string `json:"regex"`
+	Replacement string `json:"replacement"`
+}
+
+const ScrubCreditCard = "credit_card"
+
+var defaultScrubContentTypes = []string{"application/json", "application/*+json", "application/xml", "text/*"}
+
+// ResponseCache bounds the gateway response cache: Size entries of at most MaxBodyBytes each.
+type ResponseCache struct {
+	Size         int   `json:"size"`
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+}
+
+// Plan applies to tokens referencing it by name: RateLimit stands in for a token without its own rate_limit
+// (0 inherits the route or global limit) and AllowedRoutes, when set, restricts the paths its tokens may call.
+// AggregateRateLimit caps the sum of requests of all its tokens per limiter window (0 means no cap).
+// Plans are read from the config, so changing one changes every token on it.
+type Plan struct {
+	RateLimit          int      `json:"rate_limit"`
+	AggregateRateLimit int      `json:"aggregate_rate_limit"`
+	AllowedRoutes      []string `json:"allowed_routes"`
+}
+
+// SignedURLs are signed with the signing_secret of a token profile. MaxTTL caps how far ahead a URL may
+// expire; MaxUses is how often each URL is accepted, counted in Redis (0 means until it expires).
+type SignedURLs struct {
+	Enabled bool          `json:"enabled"`
+	MaxTTL  time.Duration `json:"max_ttl"`
+	MaxUses int           `json:"max_uses"`
+}
+
+var defaultStreamingContentTypes = []string{"text/event-stream", "application/x-ndjson"}
+
+// UpstreamPool bounds an upstream connection pool (an http.Transport). In a route, unset fields inherit
+// application.upstream_pool. IdleConnTimeout closes connections idle for longer; MaxConnLifetime retires
+// HTTP/1.1 connections older than it (plus up to 10% jitter) after their current request, so upstream load
+// balancers get to rebalance and stale NAT entries are not hit.
+type UpstreamPool struct {
+	MaxIdleConns        int           `json:"max_idle_conns"`          // default 200
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host"` // default 100
+	MaxConnsPerHost     int           `json:"max_conns_per_host"`      // 0 means unlimited
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout"`       // default 90s
+	MaxConnLifetime     time.Duration `json:"max_conn_lifetime"`       // 0 means unlimited
+
+	// Socket tunes the upstream connections of the pool; a route without any socket setting inherits all of them.
+	Socket SocketOptions `json:"socket"`
+
+	// TLS customizes connections to https upstreams (CA bundle, client certificate, minimum version); a route
+	// without any tls setting inherits all of them.
+	TLS ClientTLS `json:"tls"`
+}
+
+// SocketOptions tune TCP connections. KeepAlive is the idle time before the first keep-alive probe
+// (negative disables probes); KeepAliveInterval and KeepAliveCount default to 15s and 9 once any
+// keep-alive setting is given. NoDelay (TCP_NODELAY) defaults to true; false lets the kernel coalesce small
+// writes. ReadBuffer and WriteBuffer set SO_RCVBUF and SO_SNDBUF in bytes; 0 keeps the OS default.
+type SocketOptions struct {
+	KeepAlive         time.Duration `json:"keep_alive"`
+	KeepAliveInterval time.Duration `json:"keep_alive_interval"`
+	KeepAliveCount    int           `json:"keep_alive_count"`
+	NoDelay           *bool         `json:"no_delay"`
+	ReadBuffer        int           `json:"read_buffer"`
+	WriteBuffer       int           `json:"write_buffer"`
+}
+
+func (o SocketOptions) validate(name string) error {
+	if o.KeepAliveInterval < 0 || o.KeepAliveCount < 0 || o.ReadBuffer < 0 || o.WriteBuffer < 0 {
+		return fmt.Errorf("%s: keep_alive_interval, keep_alive_count and buffer sizes must be >= 0", name)
+	}
+
+	return nil
+}
+
+const (
+	defaultPoolMaxIdleConns        = 200
+	defaultPoolMaxIdleConnsPerHost = 100
+	defaultPoolIdleConnTimeout     = 90 * time.Second
+)
+
+func (p *UpstreamPool) validate(name string) error {
+	if p.MaxIdleConns < 0 || p.MaxIdleConnsPerHost < 0 || p.MaxConnsPerHost < 0 || p.IdleConnTimeout < 0 ||
+		p.MaxConnLifetime < 0 {
+		return fmt.Errorf("%s values must be >= 0", name)
+	}
+
+	if err := p.Socket.validate(name + ".socket"); err != nil {
+		return err
+	}
+
+	return p.TLS.validate(name + ".tls")
+}
+
+// inherit fills the unset fields of p from parent.
+func (p *UpstreamPool) inherit(parent UpstreamPool) {
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = parent.MaxIdleConns
+	}
+	if p.MaxIdleConnsPerHost == 0 {
+		p.MaxIdleConnsPerHost = parent.MaxIdleConnsPerHost
+	}
+	if p.MaxConnsPerHost == 0 {
+		p.MaxConnsPerHost = parent.MaxConnsPerHost
+	}
+	if p.IdleConnTimeout == 0 {
+		p.IdleConnTimeout = parent.IdleConnTimeout
+	}
+	if p.MaxConnLifetime == 0 {
+		p.MaxConnLifetime = parent.MaxConnLifetime
+	}
+	if p.Socket == (SocketOptions{}) {
+		p.Socket = parent.Socket
+	}
+	if p.TLS == (ClientTLS{}) {
+		p.TLS = parent.TLS
+	}
+}
+
+// UpstreamRateLimit caps the request rate toward the upstream regardless of client identity.
+// RPS 0 disables it. Requests wait in a queue of QueueDepth; beyond it they get 503.
+type UpstreamRateLimit struct {
+	RPS        float64       `json:"rps"`
+	QueueDepth int           `json:"queue_depth"`
+	MaxWait    time.Duration `json:"max_wait"`
+}
+
+// ConcurrencyLimit caps requests in flight to the upstream. Waiting requests are admitted by weighted
+// fair queueing per api_key, weighted by the token's tier.
+type ConcurrencyLimit struct {
+	MaxInFlight int            `json:"max_in_flight"` // 0 disables the cap
+	QueueDepth  int            `json:"queue_depth"`
+	MaxWait     time.Duration  `json:"max_wait"`
+	TierWeights map[string]int `json:"tier_weights"` // tiers not listed get weight 1
+}
+
+// Experiment identities: what a caller is bucketed by.
+const (
+	ExperimentKeyAPIKey       = "api_key"
+	ExperimentKeySubject      = "subject" // the JWT sub claim
+	ExperimentKeyTenant       = "tenant"  // the token profile's tenant
+	ExperimentKeyHeaderPrefix = "header:" // header:<name>, e.g. a user id set by the client
+)
+
+// Experiment splits callers into weighted buckets by a hash of their identity and the experiment name,
+// so each caller stays in its bucket on every instance and experiments are independent of each other.
+// Routes, in the allowed_routes pattern syntax, limit it to some paths; empty means all. Callers without
+// the identity (e.g. no sub claim) are not bucketed.
+type Experiment struct {
+	Name    string             `json:"name"`
+	Routes  []string           `json:"routes,omitempty"`
+	Key     string             `json:"key"` // default api_key
+	Buckets []ExperimentBucket `json:"buckets"`
+}
+
+type ExperimentBucket struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"` // relative share; 0 turns the bucket off unless no bucket sets one
+}
+
+// experimentName keeps names and buckets safe inside the X-Experiment-Bucket header value.
+var experimentName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func validateExperiments(exps []Experiment) error {
+	seen := map[string]bool{}
+	for i := range exps {
+		e := &exps[i]
+		if !experimentName.MatchString(e.Name) {
+			return fmt.Errorf("application.experiments[%d].name %q must be letters, digits, '_', '.' or '-'", i, e.Name)
+		}
+		if seen[e.Name] {
+			return fmt.Errorf("application.experiments[%d].name %q is duplicated", i, e.Name)
+		}
+		seen[e.Name] = true
+
+		switch {
+		case e.Key == "":
+			e.Key = ExperimentKeyAPIKey
+		case e.Key == ExperimentKeyAPIKey, e.Key == ExperimentKeySubject, e.Key == ExperimentKeyTenant:
+		case strings.HasPrefix(e.Key, ExperimentKeyHeaderPrefix) && len(e.Key) > len(ExperimentKeyHeaderPrefix):
+		default:
+			return fmt.Errorf("application.experiments.%s.key %q must be api_key, subject, tenant or header:<name>", e.Name, e.Key)
+		}
+
+		if len(e.Buckets) == 0 {
+			return fmt.Errorf("application.experiments.%s.buckets is required", e.Name)
+		}
+		// without any weights the buckets split evenly
+		even := !slices.ContainsFunc(e.Buckets, func(b ExperimentBucket) bool { return b.Weight != 0 })
+		total := 0
+		buckets := map[string]bool{}
+		for j := range e.Buckets {
+			b := &e.Buckets[j]
+			if !experimentName.MatchString(b.Name) || buckets[b.Name] {
+				return fmt.Errorf("application.experiments.%s.buckets[%d].name %q must be unique letters, digits, '_', '.' or '-'", e.Name, j, b.Name)
+			}
+			buckets[b.Name] = true
+			if b.Weight < 0 {
+				return fmt.Errorf("application.experiments.%s.buckets.%s.weight must be >= 0", e.Name, b.Name)
+			}
+			if even {
+				b.Weight = 1
+			}
+			total += b.Weight
+		}
+		if total == 0 {
+			return fmt.Errorf("application.experiments.%s needs a bucket with weight > 0", e.Name)
+		}
+	}
+
+	return nil
+}
+
+// Route holds per-route policies. Path uses the allowed_routes pattern syntax:
+// an exact path, a prefix ending with "*" or "*" for everything. First match wins.
+type Route struct {
+	Path     string    `json:"path"`
+	ExtAuthz *ExtAuthz `json:"ext_authz,omitempty"`
+
+	// MaxBodyBytes overrides application.max_body_bytes; -1 disables the limit (e.g. multi-GB uploads).
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+	// BodyTimeout extends read and write deadlines of matching requests beyond server_timeouts.
+	BodyTimeout time.Duration `json:"body_timeout,omitempty"`
+
+	// Decompression inflates gzip/deflate/zstd request bodies before proxying, with bomb protection.
+	Decompression *Decompression `json:"decompression,omitempty"`
+
+	// Flags override global feature flags for this route.
+	Flags map[string]bool `json:"flags,omitempty"`
+
+	// RateLimit overrides application.default_rate_limit for tokens without their own rate_limit.
+	RateLimit int `json:"rate_limit,omitempty"`
+
+	// MethodLimits overrides token quota accounting per HTTP method, e.g. for OPTIONS and HEAD.
+	MethodLimits map[string]MethodLimit `json:"method_limits,omitempty"`
+
+	// Methods lists the methods the route accepts; others get 405 with an Allow header. HEAD is accepted with
+	// GET and OPTIONS always. Empty accepts every method.
+	Methods []string `json:"methods,omitempty"`
+
+	// Options is proxy (default) to send OPTIONS requests upstream or local to answer them with 204 and an
+	// Allow header listing Methods. CORS preflights always go upstream, which knows the CORS policy.
+	Options string `json:"options,omitempty"`
+
+	// MethodOverride handles X-HTTP-Method-Override and similar headers: strip (default) removes them so
+	// the upstream cannot act on a method the proxy never checked; honor applies the overridden method to
+	// POST requests before auth, method limits and authorizers, and sends it upstream as the real method.
+	MethodOverride string `json:"method_override,omitempty"`
+
+	// ProbeBypass lets GET and HEAD requests matching any signature through without a token or rate limit,
+	// for upstream health paths polled by load balancers. Signatures are trivially spoofed: only use it on
+	// routes that expose nothing sensitive.
+	ProbeBypass []ProbeSignature `json:"probe_bypass,omitempty"`
+
+	// Contract validates upstream responses against an OpenAPI document to catch backend contract drift.
+	Contract *Contract `json:"contract,omitempty"`
+
+	// Cache keeps GET responses in the gateway cache while the cache feature flag is enabled for the route.
+	Cache *RouteCache `json:"cache,omitempty"`
+
+	// Deprecation marks the route deprecated: responses carry Deprecation, Sunset and Link headers.
+	Deprecation *Deprecation `json:"deprecation,omitempty"`
+
+	// RequiredHeaders rejects requests missing a header or carrying an invalid value with 400.
+	RequiredHeaders []HeaderRequirement `json:"required_headers,omitempty"`
+
+	// DryRun evaluates token scopes and rate limits on the route but only logs and counts would-be denials.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Query limits the query parameters forwarded to the upstream (and used in cache keys) to an allowlist.
+	Query *QueryPolicy `json:"query,omitempty"`
+
+	// GRPC serves the route by transcoding JSON requests to unary calls on a gRPC backend instead of proxying.
+	GRPC *GRPCTranscoding `json:"grpc,omitempty"`
+
+	// Versions sends requests to the upstream of the API version they ask for instead of target_host.
+	Versions *Versioning `json:"versions,omitempty"`
+
+	// Upstream sends requests of the route to this URL instead of target_host; Rewrite changes their path.
+	Upstream string   `json:"upstream,omitempty"`
+	Rewrite  *Rewrite `json:"rewrite,omitempty"`
+
+	// UpstreamPool gives the route its own upstream connection pool; unset fields inherit application.upstream_pool.
+	UpstreamPool *UpstreamPool `json:"upstream_pool,omitempty"`
+
+	// AdaptiveConcurrency caps requests in flight to the upstream with a limit that follows its latency.
+	AdaptiveConcurrency *AdaptiveConcurrency `json:"adaptive_concurrency,omitempty"`
+
+	// LongPoll lets requests of the route wait on the upstream past the server write timeout.
+	LongPoll *LongPoll `json:"long_poll,omitempty"`
+
+	// UpstreamOAuth2 authenticates the proxy to the upstream with its own OAuth2 bearer token.
+	UpstreamOAuth2 *UpstreamOAuth2 `json:"upstream_oauth2,omitempty"`
+}
+
+// Rewrite replaces StripPrefix at the start of request paths with AddPrefix before they are proxied:
+// with strip_prefix /api/v1/users, /api/v1/users/42 goes upstream as /42, or /v2/42 with add_prefix /v2.
+type Rewrite struct {
+	StripPrefix string `json:"strip_prefix"`
+	AddPrefix   string `json:"add_prefix"`
+}
+
+const (
+	MethodOverrideStrip = "strip"
+	MethodOverrideHonor = "honor"
+
+	OptionsProxy = "proxy"
+	OptionsLocal = "local"
+)
+
+// ProbeSignature matches a health checker by User-Agent prefix (e.g. "kube-probe/") and/or a header value.
+// All fields set must match.
+type ProbeSignature struct {
+	UserAgentPrefix string `json:"user_agent_prefix,omitempty"`
+	Header          string `json:"header,omitempty"`
+	Value           string `json:"value,omitempty"`
+}
+
+// Decompression limits inflated request bodies. Exceeding MaxBytes or a decompressed/compressed
+// ratio above MaxRatio aborts the request with 413.
+type Decompression struct {
+	MaxBytes int64   `json:"max_bytes"`
+	MaxRatio float64 `json:"max_ratio"`
+}
+
+// Contract points a route at an OpenAPI 3.0 document (JSON). Mismatching responses are logged and counted;
+// with Enforce they are replaced by 502. BasePath is stripped from request paths before matching the
+// document's paths; bodies larger than MaxBodyBytes are passed through unvalidated.
+type Contract struct {
+	Spec         string `json:"spec"`
+	BasePath     string `json:"base_path"`
+	Enforce      bool   `json:"enforce"`
+	MaxBodyBytes int64  `json:"max_body_bytes"`
+}
+
+// RouteCache sets how long responses of a route are cached and where their ETags come from:
+// generate (default) computes a strong ETag from the body, passthrough keeps the upstream one when present.
+// The cache key is the path, the query (only KeyQuery parameters when set) and the KeyHeaders values,
+// extended by the request headers the upstream names in Vary.
+type RouteCache struct {
+	TTL        time.Duration `json:"ttl"`
+	ETag       string        `json:"etag"`
+	KeyHeaders []string      `json:"key_headers"`
+	KeyQuery   []string      `json:"key_query"`
+}
+
+const (
+	ETagGenerate    = "generate"
+	ETagPassthrough = "passthrough"
+)
+
+// Deprecation announces when a route was deprecated (Date, required), when it will stop working (Sunset)
+// and where clients can read about it (Link), as RFC 9745 and RFC 8594 headers. Dates are RFC 3339.
+type Deprecation struct {
+	Date   time.Time `json:"date"`
+	Sunset time.Time `json:"sunset,omitempty"`
+	Link   string    `json:"link,omitempty"`
+}
+
+// HeaderRequirement requires header Name on requests with one of Methods (all when empty). When set, the
+// value must also match Pattern (a regexp) or satisfy Version, a semver range such as ">=1.4.0 <2" or "^1.4".
+type HeaderRequirement struct {
+	Name    string   `json:"name"`
+	Methods []string `json:"methods,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	Version string   `json:"version,omitempty"`
+}
+
+// Versioning routes a request to Upstreams[version] (an absolute URL). The version is read from path segment
+// Segment (1-based, e.g. 3 for /api/v1/v2/orders; 0 disables it), else from the first of Headers present,
+// else Default. A segment counts as a version when it is a configured one or looks like v<digit>;
+// StripSegment removes it before proxying. Versions match case-insensitively with or without a leading v.
+// Requests for unknown versions, or without one and no Default, get 406.
+type Versioning struct {
+	Headers      []string          `json:"headers"` // default Accept-Version, X-API-Version
+	Segment      int               `json:"segment"`
+	StripSegment bool              `json:"strip_segment"`
+	Default      string            `json:"default"`
+	Upstreams    map[string]string `json:"upstreams"`
+}
+
+// AdaptiveConcurrency sheds requests of a route with 503 once its in-flight count reaches a limit that is
+// recomputed every Window from upstream latency: it shrinks while latency exceeds Tolerance times the
+// long-term baseline or the upstream answers 5xx, and grows while the upstream keeps up and the limit is in use.
+type AdaptiveConcurrency struct {
+	InitialLimit int           `json:"initial_limit"` // default 20
+	MinLimit     int           `json:"min_limit"`     // default 1
+	MaxLimit     int           `json:"max_limit"`     // default 1000
+	Tolerance    float64       `json:"tolerance"`     // default 2
+	Window       time.Duration `json:"window"`        // default 1s
+}
+
+// LongPoll serves a route whose upstream holds requests open until it has something to say. Requests may take
+// up to Timeout (default 2m), overriding the server write timeout and the upstream response header timeout.
+// With Heartbeat set, Payload (default a space) is written every Heartbeat until the upstream body starts, so
+// intermediaries do not drop the idle connection. A heartbeat sent before the upstream headers commits the
+// response as 200 with ContentType (default application/json): a later upstream status is lost, so heartbeats
+// only suit upstreams that answer 200 and whose body format ignores leading whitespace.
+type LongPoll struct {
+	Timeout     time.Duration `json:"timeout"`
+	Heartbeat   time.Duration `json:"heartbeat"`
+	Payload     string        `json:"payload"`
+	ContentType string        `json:"content_type"`
+}
+
+const (
+	defaultLongPollTimeout     = 2 * time.Minute
+	defaultLongPollPayload     = " "
+	defaultLongPollContentType = "application/json"
+)
+
+// UpstreamOAuth2 obtains bearer tokens for the upstream from TokenURL with the client_credentials grant and
+// sends them in place of the client's Authorization header. A token is reused until RefreshBefore (default
+// 30s) ahead of its expiry; tokens without expires_in are kept for 5m. Timeout (default 5s) bounds a fetch.
+type UpstreamOAuth2 struct {
+	TokenURL      string        `json:"token_url"`
+	ClientID      string        `json:"client_id"`
+	ClientSecret  string        `json:"client_secret"`
+	Scopes        []string      `json:"scopes,omitempty"`
+	Audience      string        `json:"audience,omitempty"`
+	Timeout       time.Duration `json:"timeout"`
+	RefreshBefore time.Duration `json:"refresh_before"`
+}
+
+const (
+	defaultUpstreamOAuth2Timeout       = 5 * time.Second
+	defaultUpstreamOAuth2RefreshBefore = 30 * time.Second
+)
+
+const (
+	defaultStatsDPrefix        = "tyk_proxy."
+	defaultStatsDFlushInterval = time.Second
+	defaultStatsDPacketSize    = 1432
+)
+
+const (
+	defaultWatchdogInterval    = 10 * time.Second
+	defaultWatchdogCooldown    = 5 * time.Minute
+	defaultWatchdogMaxProfiles = 5
+)
+
+const (
+	defaultAdaptiveInitialLimit = 20
+	defaultAdaptiveMinLimit     = 1
+	defaultAdaptiveMaxLimit     = 1000
+	defaultAdaptiveTolerance    = 2
+	defaultAdaptiveWindow       = time.Second
+)
+
+var defaultVersionHeaders = []string{"Accept-Version", "X-API-Version"}
+
+// QueryPolicy allowlists query parameter names. Unknown parameters are stripped (default) or, with
+// unknown: reject, answered with 400. A name ending in * allows every parameter with that prefix.
+type QueryPolicy struct {
+	Allowed []string `json:"allowed"`
+	Unknown string   `json:"unknown"`
+}
+
+const (
+	QueryUnknownStrip  = "strip"
+	QueryUnknownReject = "reject"
+)
+
+// GRPCTranscoding maps JSON/HTTP requests to unary gRPC methods (grpc-gateway style). Descriptors is a
+// FileDescriptorSet (protoc --include_imports --descriptor_set_out). Target is host:port, spoken to over
+// cleartext HTTP/2 unless TLS is set.
+type GRPCTranscoding struct {
+	Target         string        `json:"target"`
+	TLS            bool          `json:"tls"`
+	Descriptors    string        `json:"descriptors"`
+	Methods        []GRPCMethod  `json:"methods"`
+	Timeout        time.Duration `json:"timeout"`
+	ForwardHeaders []string      `json:"forward_headers"` // sent as gRPC metadata
+}
+
+// GRPCMethod binds an HTTP method and path template (e.g. /api/v1/users/{id}, where {id} sets field id)
+// to a fully qualified gRPC method (e.g. users.v1.UserService/GetUser).
+type GRPCMethod struct {
+	HTTPMethod string `json:"http_method"` // default POST
+	Path       string `json:"path"`
+	Method     string `json:"method"`
+}
+
+// MethodLimit either exempts a method from the token quota or counts it against a separate per-key limit.
+// An exempt OPTIONS also lets CORS preflights (which carry no credentials) through without a token.
+type MethodLimit struct {
+	Exempt bool `json:"exempt"`
+	Limit  int  `json:"limit"`
+}
+
+// ExtAuthz delegates the authorization decision to an external HTTP service (Envoy ext_authz style).
+// The original method and path are appended to URL; 200 allows, 401/403 deny.
+type ExtAuthz struct {
+	URL             string        `json:"url"`
+	Timeout         time.Duration `json:"timeout"`
+	ForwardHeaders  []string      `json:"forward_headers"`
+	UpstreamHeaders []string      `json:"upstream_headers"` // response headers merged upstream, empty means none
+	FailPolicy      string        `json:"fail_policy"`
+}
+
+type Token struct {
+	JWTSecret string `json:"jwt_secret"` // II+NZDtODCTp0eAGX0/3HNdaExOf+M1uesFHdN+IFcTD774aaeJrJIOMS4aYhi+l
+	Algorithm string `json:"algorithm"`  // HS256
+	// PublicKeyFile is the PEM public key or certificate that verifies RS* and ES* tokens.
+	PublicKeyFile string `json:"public_key_file"`
+	// JWKSURL fetches RS* and ES* keys from a JWKS endpoint instead; tokens pick their key by the kid header.
+	JWKSURL             string        `json:"jwks_url"`
+	JWKSRefreshInterval time.Duration `json:"jwks_refresh_interval"` // default 5m
+
+	// VerifyCacheSize enables a cache of verified tokens so repeat requests skip signature checks; 0 disables it.
+	VerifyCacheSize int           `json:"verify_cache_size"`
+	VerifyCacheTTL  time.Duration `json:"verify_cache_ttl"` // upper bound per entry; tokens never outlive their exp
+
+	// RejectCacheSize enables a cache of tokens that failed verification, so replayed bad tokens skip
+	// signature checks too; 0 disables it.
+	RejectCacheSize int           `json:"reject_cache_size"`
+	RejectCacheTTL  time.Duration `json:"reject_cache_ttl"` // default 1m
+
+	// LogClaims lists the claims that may appear in debug logs, default api_key and exp.
+	LogClaims []string `json:"log_claims"`
+	// LogAPIKey is how api_key appears in logs: hash (default) or plain.
+	LogAPIKey string `json:"log_api_key"`
+}
+
+const (
+	LogAPIKeyHash  = "hash"
+	LogAPIKeyPlain = "plain"
+)
+
+var defaultLogClaims = []string{"api_key", "exp"}
+
+type ServerTimeouts struct {
+	ReadHeaderTimeout time.Duration `json:"readHeaderTimeout,omitempty"`
+	ReadTimeout       time.Duration `json:"readTimeout,omitempty"`
+	WriteTimeout      time.Duration `json:"writeTimeout,omitempty"`
+	IdleTimeout       time.Duration `json:"idleTimeout,omitempty"`
+}
+
+type Log struct {
+	Level   string `json:"level"`
+	Format  string `json:"format"`
+	Colored bool   `json:"colored"`
+
+	// Outputs lists where logs are written: stdout (default), file and/or syslog.
+	Outputs []string  `json:"outputs"`
+	File    LogFile   `json:"file"`
+	Syslog  LogSyslog `json:"syslog"`
+}
+
+// LogFile rotates the log file when it reaches MaxSizeMB or, if set, every RotateInterval.
+// Rotated files are kept for MaxAgeDays and at most MaxBackups of them; 0 keeps them all.
+type LogFile struct {
+	Path           string        `json:"path"`
+	MaxSizeMB      int           `json:"max_size_mb"` // default 100
+	RotateInterval time.Duration `json:"rotate_interval"`
+	MaxAgeDays     int           `json:"max_age_days"`
+	MaxBackups     int           `json:"max_backups"`
+	Compress       bool          `json:"compress"`
+}
+
+// LogSyslog sends logs to the local syslog daemon, or to a remote one when Network and Addr are set.
+type LogSyslog struct {
+	Network string `json:"network"` // udp or tcp; empty means the local daemon
+	Addr    string `json:"addr"`
+	Tag     string `json:"tag"` // default tyk-proxy
+}
+
+const (
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+	LogOutputSyslog = "syslog"
+
+	defaultLogMaxSizeMB = 100
+	defaultSyslogTag    = "tyk-proxy"
+)
+
+var (
+	logOutputs     = []string{LogOutputStdout, LogOutputFile, LogOutputSyslog}
+	syslogNetworks = []string{"", "udp", "tcp"}
+)
+
+func (l *Log) validateAndNormalize() error {
+	if len(l.Outputs) == 0 {
+		l.Outputs = []string{LogOutputStdout}
+	}
+
+	for _, o := range l.Outputs {
+		if !slices.Contains(logOutputs, o) {
+			return fmt.Errorf("log.outputs: %q is not supported", o)
+		}
+	}
+
+	if slices.Contains(l.Outputs, LogOutputFile) {
+		if l.File.Path == "" {
+			return errors.New("log.file.path is required for the file output")
+		}
+		if l.File.MaxSizeMB < 0 || l.File.RotateInterval < 0 || l.File.MaxAgeDays < 0 || l.File.MaxBackups < 0 {
+			return errors.New("log.file rotation settings must be >= 0")
+		}
+		if l.File.MaxSizeMB == 0 {
+			l.File.MaxSizeMB = defaultLogMaxSizeMB
+		}
+	}
+
+	if slices.Contains(l.Outputs, LogOutputSyslog) {
+		if !slices.Contains(syslogNetworks, l.Syslog.Network) {
+			return fmt.Errorf("log.syslog.network %q is not supported", l.Syslog.Network)
+		}
+		if l.Syslog.Network != "" && l.Syslog.Addr == "" {
+			return errors.New("log.syslog.addr is required with log.syslog.network")
+		}
+		if l.Syslog.Tag == "" {
+			l.Syslog.Tag = defaultSyslogTag
+		}
+	}
+
+	return nil
+}
+
+type Monitoring struct {
+	IP     string `json:"ip"`
+	Scheme string `json:"scheme"`
+	Port   int    `json:"port"`
+	SLO    SLO    `json:"slo"`
+
+	Watchdog Watchdog `json:"watchdog"`
+
+	// Pprof serves /debug/pprof on the monitoring listener and labels request goroutines with route, method
+	// and hashed api_key, so profiles can be broken down by them (go tool pprof -tagfocus).
+	Pprof bool `json:"pprof"`
+
+	// PathClasses name the upstream endpoints behind the proxy wildcard in the path label of request metrics,
+	// which otherwise reads /api/v1/* for every proxied request. First match wins; unmatched paths keep the wildcard.
+	PathClasses []PathClass `json:"path_classes"`
+
+	// StatsD also sends request latency and status, auth outcomes and limiter decisions to a statsd or
+	// DogStatsD agent, for stacks that do not scrape Prometheus.
+	StatsD *StatsD `json:"statsd,omitempty"`
+}
+
+// StatsD is a statsd agent reached over UDP. Tags are sent in the DogStatsD format, which plain statsd
+// agents do not understand; leave DogStatsD off for them and the tags are dropped.
+type StatsD struct {
+	Addr          string            `json:"addr"`            // host:port
+	Prefix        string            `json:"prefix"`          // default tyk_proxy.
+	DogStatsD     bool              `json:"dogstatsd"`       // send tags
+	Tags          map[string]string `json:"tags"`            // added to every metric
+	FlushInterval time.Duration     `json:"flush_interval"`  // default 1s
+	MaxPacketSize int               `json:"max_packet_size"` // default 1432, fits an Ethernet MTU
+}
+
+// PathClass labels request paths matching the regexp Pattern as Name, which may refer to its groups
+// ($1, ${name}). Groups must only capture bounded values (e.g. (orders|users)), never ids, or the label
+// cardinality is unbounded again.
+type PathClass struct {
+	Pattern string `json:"pattern"`
+	Name    string `json:"name"`
+}
+
+// Watchdog checks the goroutine count and heap size every Interval. Crossing MaxGoroutines or MaxHeapBytes
+// (0 disables a check) logs the busiest in-flight api keys and, when ProfileDir is set, writes heap and
+// goroutine profiles there, at most once per Cooldown and keeping the newest MaxProfiles of each.
+type Watchdog struct {
+	Interval      time.Duration `json:"interval"` // default 10s
+	MaxGoroutines int           `json:"max_goroutines"`
+	MaxHeapBytes  int64         `json:"max_heap_bytes"`
+	ProfileDir    string        `json:"profile_dir"`
+	Cooldown      time.Duration `json:"cooldown"`     // default 5m
+	MaxProfiles   int           `json:"max_profiles"` // default 5
+}
+
+// SLO defines a good request for the per-route slo_* metrics: answered without a 5xx within LatencyThreshold.
+// Objective is the target share of good requests, e.g. 0.999.
+type SLO struct {
+	LatencyThreshold time.Duration `json:"latency_threshold"`
+	Objective        float64       `json:"objective"`
+}
+
+type Redis struct {
+	Addr string `json:"addr"`
+
+	// Username is the ACL user (Redis 6+); with only Password set the default user authenticates. DB selects
+	// the logical database. Managed offerings usually also require TLS.
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	DB       int       `json:"db"`
+	TLS      ClientTLS `json:"tls"`
+
+	// ReplicaAddrs are read replicas for token lookups, used when ReadPreference is "replica".
+	// Writes and rate-limit counters always go to Addr.
+	ReplicaAddrs   []string      `json:"replica_addrs"`
+	ReadPreference string        `json:"read_preference"` // primary (default) or replica
+	MaxStaleness   time.Duration `json:"max_staleness"`   // replicas lagging behind more are skipped
+
+	Failover Failover `json:"failover"`
+
+	// SchemaCheckSample is how many keys under the token and rate-limit prefixes are checked against the
+	// current schema at startup, default 100; -1 skips the check.
+	SchemaCheckSample int `json:"schema_check_sample"`
+}
+
+// ClientTLS configures TLS toward a server. Files are PEM; without CAFile the system roots are trusted.
+type ClientTLS struct {
+	Enabled    bool   `json:"enabled"`
+	CAFile     string `json:"ca_file"`
+	CertFile   string `json:"cert_file"` // client certificate for mutual TLS, with KeyFile
+	KeyFile    string `json:"key_file"`
+	ServerName string `json:"server_name"` // defaults to the host dialed
+	MinVersion string `json:"min_version"` // 1.2 (default) or 1.3
+
+	// InsecureSkipVerify accepts any server certificate; for development only.
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+}
+
+func (t ClientTLS) validate(name string) error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("%s: cert_file and key_file must be set together", name)
+	}
+	if !t.Enabled && (t.CAFile != "" || t.CertFile != "" || t.ServerName != "" || t.MinVersion != "" || t.InsecureSkipVerify) {
+		return fmt.Errorf("%s: settings given but enabled is false", name)
+	}
+	switch t.MinVersion {
+	case "", TLSVersion12, TLSVersion13:
+	default:
+		return fmt.Errorf("%s.min_version %q is not supported", name, t.MinVersion)
+	}
+
+	return nil
+}
+
+// ServerTLS terminates TLS on a listener when CertFile is set. Files are PEM; the certificate, key and client
+// CAs are checked for changes every ReloadInterval (default 30s) and reloaded on SIGHUP, so renewed certificates
+// apply to new connections without a restart. With ClientCAFile clients must present a certificate it signed
+// (mutual TLS); ClientAuth optional only verifies certificates that are presented.
+type ServerTLS struct {
+	CertFile       string        `json:"cert_file"`
+	KeyFile        string        `json:"key_file"`
+	ClientCAFile   string        `json:"client_ca_file"`
+	ClientAuth     string        `json:"client_auth"` // require (default) or optional
+	MinVersion     string        `json:"min_version"` // 1.2 (default) or 1.3
+	ReloadInterval time.Duration `json:"reload_interval"`
+}
+
+const (
+	ClientAuthRequire  = "require"
+	ClientAuthOptional = "optional"
+
+	TLSVersion12 = "1.2"
+	TLSVersion13 = "1.3"
+)
+
+const defaultTLSReloadInterval = 30 * time.Second
+
+func (t *ServerTLS) validateAndNormalize(name string) error {
+	if t.CertFile == "" {
+		if t.KeyFile != "" || t.ClientCAFile != "" || t.ClientAuth != "" || t.MinVersion != "" || t.ReloadInterval != 0 {
+			return fmt.Errorf("%s: settings given without cert_file", name)
+		}
+		return nil
+	}
+
+	if t.KeyFile == "" {
+		return fmt.Errorf("%s: key_file is required with cert_file", name)
+	}
+	t.ClientAuth = strings.ToLower(t.ClientAuth)
+	switch t.ClientAuth {
+	case "":
+		if t.ClientCAFile != "" {
+			t.ClientAuth = ClientAuthRequire
+		}
+	case ClientAuthRequire, ClientAuthOptional:
+		if t.ClientCAFile == "" {
+			return fmt.Errorf("%s: client_auth requires client_ca_file", name)
+		}
+	default:
+		return fmt.Errorf("%s.client_auth %q is not supported", name, t.ClientAuth)
+	}
+	switch t.MinVersion {
+	case "":
+		t.MinVersion = TLSVersion12
+	case TLSVersion12, TLSVersion13:
+	default:
+		return fmt.Errorf("%s.min_version %q is not supported", name, t.MinVersion)
+	}
+	if t.ReloadInterval < 0 {
+		return fmt.Errorf("%s.reload_interval must be >= 0", name)
+	}
+	if t.ReloadInterval == 0 {
+		t.ReloadInterval = defaultTLSReloadInterval
+	}
+
+	return nil
+}
+
+// Failover decides what happens to requests while Redis is failing. The error rate is always tracked
+// (redis_degraded gauge); only with the open policy are requests let through while it is over the threshold.
+type Failover struct {
+	Policy         string        `json:"policy"`          // closed (default), open or profiles
+	Window         time.Duration `json:"window"`          // rolling window of the error rate, default 30s
+	ErrorThreshold float64       `json:"error_threshold"` // error ratio that engages the policy, default 0.5
+	MinRequests    int           `json:"min_requests"`    // commands in the window before the rate counts, default 20
+
+	// Snapshot is where the profiles policy keeps its encrypted copy of the token profiles.
+	Snapshot Snapshot `json:"snapshot"`
+}
+
+type Snapshot struct {
+	Path     string        `json:"path"`
+	Key      string        `json:"key"`      // base64 of 32 random bytes (AES-256-GCM)
+	Interval time.Duration `json:"interval"` // default 5m
+}
+
+// FailoverPolicyProfiles serves token profiles from the local snapshot while Redis is degraded.
+const FailoverPolicyProfiles = "profiles"
+
+var failoverPolicies = append(slices.Clone(failPolicies), FailoverPolicyProfiles)
+
+const (
+	ReadPreferencePrimary = "primary"
+	ReadPreferenceReplica = "replica"
+)
+
+func (f *Failover) validateAndNormalize() error {
+	f.Policy = strings.ToLower(f.Policy)
+	if f.Policy == "" {
+		f.Policy = FailPolicyClosed
+	}
+	if !slices.Contains(failoverPolicies, f.Policy) {
+		return fmt.Errorf("redis.failover.policy %q is not supported", f.Policy)
+	}
+
+	if f.Policy == FailoverPolicyProfiles {
+		if f.Snapshot.Path == "" {
+			return errors.New("redis.failover.snapshot.path is required for the profiles policy")
+		}
+		key, err := base64.StdEncoding.DecodeString(f.Snapshot.Key)
+		if err != nil || len(key) != 32 {
+			return errors.New("redis.failover.snapshot.key must be base64 of 32 bytes")
+		}
+		if f.Snapshot.Interval <= 0 {
+			f.Snapshot.Interval = defaultSnapshotInterval
+		}
+	}
+
+	if f.ErrorThreshold < 0 || f.ErrorThreshold > 1 {
+		return errors.New("redis.failover.error_threshold must be between 0 and 1")
+	}
+	if f.ErrorThreshold == 0 {
+		f.ErrorThreshold = defaultFailoverThreshold
+	}
+	if f.Window <= 0 {
+		f.Window = defaultFailoverWindow
+	}
+	if f.MinRequests <= 0 {
+		f.MinRequests = defaultFailoverMinRequests
+	}
+
+	return nil
+}
+
+// RateLimitStore selects where rate-limit counters are kept. Tokens always live in Redis.
+type RateLimitStore struct {
+	Backend        string   `json:"backend"` // redis (default) or memcached
+	MemcachedAddrs []string `json:"memcached_addrs"`
+
+	// Algorithm is fixed_window (default) or sliding_window, which weighs in the previous window's count so a
+	// key cannot make up to twice its limit across a window boundary, at the cost of reading a second counter.
+	// token_bucket refills a key at its limit per window and lets it spend up to the burst of its token profile
+	// at once (Redis only).
+	Algorithm string `json:"algorithm"`
+
+	// Global shares the counters of a multi-region fleet through a global Redis.
+	Global GlobalCounters `json:"global"`
+
+	// Sharding spreads the counters of busy keys to avoid hot keys.
+	Sharding CounterSharding `json:"sharding"`
+
+	// Fallback decides what the rate limiter does while the backend fails.
+	Fallback RateLimitFallback `json:"fallback"`
+}
+
+// RateLimitFallback is the policy of the rate limiter while its backend fails: closed answers 500, open lets
+// requests through unlimited, and local counts them in process memory over fixed windows, at most LocalSize
+// keys (default 100000), with limits divided by Instances (default 1) so the fleet roughly keeps the configured
+// limits. Empty (the default) follows redis.failover.policy: requests pass while Redis is degraded under the
+// open and profiles policies, and fail otherwise.
+type RateLimitFallback struct {
+	Policy    string `json:"policy"`
+	Instances int    `json:"instances"`
+	LocalSize int    `json:"local_size"`
+}
+
+const (
+	RateLimitFallbackClosed = "closed"
+	RateLimitFallbackOpen   = "open"
+	RateLimitFallbackLocal  = "local"
+)
+
+const defaultRateLimitLocalSize = 100000
+
+func (f *RateLimitFallback) validateAndNormalize() error {
+	f.Policy = strings.ToLower(f.Policy)
+	switch f.Policy {
+	case "", RateLimitFallbackClosed, RateLimitFallbackOpen:
+		if f.Instances != 0 || f.LocalSize != 0 {
+			return errors.New("rate_limit_store.fallback: instances and local_size require the local policy")
+		}
+	case RateLimitFallbackLocal:
+		if f.Instances < 0 || f.LocalSize < 0 {
+			return errors.New("rate_limit_store.fallback: instances and local_size must be >= 0")
+		}
+		if f.Instances == 0 {
+			f.Instances = 1
+		}
+		if f.LocalSize == 0 {
+			f.LocalSize = defaultRateLimitLocalSize
+		}
+	default:
+		return fmt.Errorf("rate_limit_store.fallback.policy %q is not supported", f.Policy)
+	}
+
+	return nil
+}
+
+// CounterSharding splits the window counter of keys with a limit of at least MinLimit (default 10000) into
+// Shards counters (below 2 disables it). Each request increments one random shard and the key's count is
+// estimated as that shard's count times Shards, which keeps a request at one store round trip; the estimate is
+// off by about sqrt(Shards*limit) requests near the limit, so only shard keys whose limits dwarf that.
+type CounterSharding struct {
+	Shards   int `json:"shards"`
+	MinLimit int `json:"min_limit"`
+}
+
+const defaultShardMinLimit = 10000
+
+// GlobalCounters counts requests in the local backend and reconciles the counts with the other regions through
+// the Redis at Addr (empty disables it) every SyncInterval, off the request path. A key is limited on its
+// local count plus the other regions' counts as of the last sync. A region may count up to Tolerance requests
+// of a key before syncing early, so a key overshoots its limit by at most about Tolerance per region, plus
+// what the others counted since their last sync. Without the global Redis, regions limit on what they last saw.
+// Username, Password and TLS authenticate to the global Redis as for the main one.
+type GlobalCounters struct {
+	Addr         string        `json:"addr"`
+	Region       string        `json:"region"`
+	SyncInterval time.Duration `json:"sync_interval"` // default 1s
+	Tolerance    int           `json:"tolerance"`     // default 100
+
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	TLS      ClientTLS `json:"tls"`
+}
+
+const (
+	defaultGlobalSyncInterval = time.Second
+	defaultGlobalTolerance    = 100
+)
+
+const (
+	RateLimitBackendRedis     = "redis"
+	RateLimitBackendMemcached = "memcached"
+)
+
+const (
+	RateLimitFixedWindow   = "fixed_window"
+	RateLimitSlidingWindow = "sliding_window"
+	RateLimitTokenBucket   = "token_bucket"
+)
+
+// TokenStore selects the source of truth for token profiles. With the postgres backend
+// Redis still serves lookups as a read-through cache.
+type TokenStore struct {
+	Backend     string `json:"backend"`      // redis (default) or postgres
+	PostgresDSN string `json:"postgres_dsn"` // e.g. postgres://proxy:secret@db:5432/proxy
+
+	Cache TokenCache `json:"cache"`
+
+	// Issuer looks up tokens missing from the store in an external issuer API and imports them.
+	Issuer *TokenIssuer `json:"issuer,omitempty"`
+
+	// TykSync periodically imports the keys of a Tyk Dashboard.
+	TykSync *TykSync `json:"tyk_sync,omitempty"`
+
+	// Revocation checks every bearer token against a revocation list in Redis, so a leaked token can be
+	// revoked before its exp. It costs a Redis round trip per request.
+	Revocation *TokenRevocation `json:"revocation,omitempty"`
+}
+
+// TokenRevocation is the Redis revocation list of tokens; entries are stored under Prefix (default revoked:).
+type TokenRevocation struct {
+	Prefix string `json:"prefix"`
+}
+
+// TykSync imports key definitions from the Tyk Dashboard at URL every Interval (default 5m), authenticating
+// with the dashboard user's API Secret. APIRoutes maps Tyk API IDs to the allowed_routes patterns of their
+// listen paths; keys with access to none of them are not imported. Keys that never expire in Tyk get an expiry
+// of NoExpiryTTL (default 8760h), renewed by later syncs.
+type TykSync struct {
+	URL         string              `json:"url"` // e.g. https://dashboard:3000
+	Secret      string              `json:"secret"`
+	Interval    time.Duration       `json:"interval"`
+	Timeout     time.Duration       `json:"timeout"` // per page, default 30s
+	APIRoutes   map[string][]string `json:"api_routes"`
+	NoExpiryTTL time.Duration       `json:"no_expiry_ttl"`
+}
+
+func (ts *TykSync) validateAndNormalize() error {
+	u, err := url.Parse(ts.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("token_store.tyk_sync.url must be a valid absolute URL")
+	}
+	if ts.Secret == "" {
+		return errors.New("token_store.tyk_sync.secret is required")
+	}
+	if len(ts.APIRoutes) == 0 {
+		return errors.New("token_store.tyk_sync.api_routes is required")
+	}
+	for id, routes := range ts.APIRoutes {
+		if len(routes) == 0 || slices.Contains(routes, "") {
+			return fmt.Errorf("token_store.tyk_sync.api_routes[%s] must list non-empty routes", id)
+		}
+	}
+	if ts.Interval < 0 || ts.Timeout < 0 || ts.NoExpiryTTL < 0 {
+		return errors.New("token_store.tyk_sync: interval, timeout and no_expiry_ttl must be >= 0")
+	}
+
+	if ts.Interval == 0 {
+		ts.Interval = defaultTykSyncInterval
+	}
+	if ts.Timeout == 0 {
+		ts.Timeout = defaultTykSyncTimeout
+	}
+	if ts.NoExpiryTTL == 0 {
+		ts.NoExpiryTTL = defaultTykNoExpiryTTL
+	}
+
+	return nil
+}
+
+// TokenIssuer is the management API of an external system that creates tokens. Its profiles are imported
+// into the token store on first use and managed there afterwards.
+type TokenIssuer struct {
+	// URL of a token profile with an {api_key} placeholder, e.g. https://issuer/api/tokens/{api_key}.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"` // e.g. Authorization
+	Timeout time.Duration     `json:"timeout"` // default 2s
+
+	// Keys the issuer does not know are not asked for again for NegativeTTL (default 1m);
+	// NegativeCacheSize (default 10000) bounds how many are remembered.
+	NegativeTTL       time.Duration `json:"negative_ttl"`
+	NegativeCacheSize int           `json:"negative_cache_size"`
+}
+
+// IssuerKeyPlaceholder is replaced with the api key in TokenIssuer.URL.
+const IssuerKeyPlaceholder = "{api_key}"
+
+func (ti *TokenIssuer) validateAndNormalize() error {
+	u, err := url.Parse(strings.Replace(ti.URL, IssuerKeyPlaceholder, "k", 1))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("token_store.issuer.url must be a valid absolute URL")
+	}
+	if !strings.Contains(ti.URL, IssuerKeyPlaceholder) {
+		return fmt.Errorf("token_store.issuer.url must contain %s", IssuerKeyPlaceholder)
+	}
+	if ti.Timeout < 0 || ti.NegativeTTL < 0 || ti.NegativeCacheSize < 0 {
+		return errors.New("token_store.issuer: timeout, negative_ttl and negative_cache_size must be >= 0")
+	}
+
+	if ti.Timeout == 0 {
+		ti.Timeout = defaultIssuerTimeout
+	}
+	if ti.NegativeTTL == 0 {
+		ti.NegativeTTL = defaultIssuerNegativeTTL
+	}
+	if ti.NegativeCacheSize == 0 {
+		ti.NegativeCacheSize = defaultIssuerNegativeSize
+	}
+
+	return nil
+}
+
+// TokenCache is an in-process cache of token profiles in front of the token store.
+type TokenCache struct {
+	Size int           `json:"size"` // 0 disables the cache
+	TTL  time.Duration `json:"ttl"`  // how long changes made elsewhere may go unnoticed
+
+	// WarmUp preloads this many most recently used tokens at startup.
+	WarmUp int `json:"warm_up"`
+
+	// Tracking has Redis report every change to a token key (CLIENT TRACKING), so cached profiles are dropped
+	// as soon as they change rather than after TTL. It needs Redis 6 or later.
+	Tracking bool `json:"tracking"`
+}
+
+const (
+	TokenBackendRedis    = "redis"
+	TokenBackendPostgres = "postgres"
+)
+
+func (tc *TokenCache) validateAndNormalize() error {
+	if tc.Size < 0 || tc.WarmUp < 0 {
+		return errors.New("token_store.cache: size and warm_up must be >= 0")
+	}
+
+	if tc.Size == 0 {
+		if tc.WarmUp > 0 {
+			return errors.New("token_store.cache.warm_up requires token_store.cache.size")
+		}
+		if tc.Tracking {
+			return errors.New("token_store.cache.tracking requires token_store.cache.size")
+		}
+		return nil
+	}
+
+	if tc.WarmUp > tc.Size {
+		return errors.New("token_store.cache.warm_up must not exceed token_store.cache.size")
+	}
+
+	if tc.TTL <= 0 {
+		tc.TTL = defaultTokenCacheTTL
+	}
+
+	return nil
+}
+
+// Capture records a sample of sanitized API requests for replay against other environments.
+type Capture struct {
+	Sink  string     `json:"sink"` // file or kafka; empty disables capture
+	File  string     `json:"file"` // JSON lines, appended
+	Kafka KafkaTopic `json:"kafka"`
+
+	SampleRate   float64 `json:"sample_rate"`    // fraction of requests captured, default 0.01
+	MaxBodyBytes int64   `json:"max_body_bytes"` // request body bytes kept per record, default 64 KiB
+	BufferSize   int     `json:"buffer_size"`    // records queued for the sink; beyond that they are dropped
+
+	Redact Redact `json:"redact"`
+}
+
+type KafkaTopic struct {
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+}
+
+// Redact lists what is masked in captured requests, on top of the always-removed credential headers.
+type Redact struct {
+	Headers     []string `json:"headers"`
+	QueryParams []string `json:"query_params"`
+	JSONFields  []string `json:"json_fields"` // object keys at any depth in JSON bodies
+	Patterns    []string `json:"patterns"`    // regular expressions matched against query values and bodies
+}
+
+// Analytics emits a Tyk Pump compatible analytics record for every proxied request, so existing Tyk analytics
+// pipelines keep working during a migration. The redis sink pushes msgpack records onto RedisKey in the proxy's
+// Redis, where Tyk Pump reads them; the file sink appends them as JSON lines.
+type Analytics struct {
+	Sink     string `json:"sink"`      // redis or file; empty disables analytics
+	RedisKey string `json:"redis_key"` // default analytics-tyk-system-analytics
+	File     string `json:"file"`
+
+	// APIs maps route paths to the Tyk API the route's records are reported under; others use APIID and APIName.
+	APIs    map[string]AnalyticsAPI `json:"apis"`
+	APIID   string                  `json:"api_id"`   // default tyk-proxy
+	APIName string                  `json:"api_name"` // default tyk-proxy
+	OrgID   string                  `json:"org_id"`
+	Tags    []string                `json:"tags"`
+
+	ExpireAfter time.Duration `json:"expire_after"` // sets expireAt for storage TTLs, default 7 days
+	BufferSize  int           `json:"buffer_size"`  // records queued for the sink; beyond that they are dropped
+}
+
+type AnalyticsAPI struct {
+	APIID   string `json:"api_id"`
+	APIName string `json:"api_name"`
+}
+
+const (
+	AnalyticsSinkRedis = "redis"
+	AnalyticsSinkFile  = "file"
+
+	defaultAnalyticsRedisKey    = "analytics-tyk-system-analytics"
+	defaultAnalyticsAPIID       = "tyk-proxy"
+	defaultAnalyticsExpireAfter = 7 * 24 * time.Hour
+	defaultAnalyticsBufferSize  = 10000
+)
+
+func (a *Analytics) validateAndNormalize() error {
+	switch a.Sink {
+	case "":
+		return nil
+	case AnalyticsSinkRedis:
+		if a.RedisKey == "" {
+			a.RedisKey = defaultAnalyticsRedisKey
+		}
+	case AnalyticsSinkFile:
+		if a.File == "" {
+			return errors.New("analytics.file is required for the file sink")
+		}
+	default:
+		return fmt.Errorf("analytics.sink %q is not supported", a.Sink)
+	}
+
+	for path, api := range a.APIs {
+		if api.APIID == "" {
+			return fmt.Errorf("analytics.apis[%s].api_id is required", path)
+		}
+	}
+	if a.ExpireAfter < 0 {
+		return errors.New("analytics.expire_after must be >= 0")
+	}
+
+	if a.APIID == "" {
+		a.APIID = defaultAnalyticsAPIID
+	}
+	if a.APIName == "" {
+		a.APIName = a.APIID
+	}
+	if a.ExpireAfter == 0 {
+		a.ExpireAfter = defaultAnalyticsExpireAfter
+	}
+	if a.BufferSize <= 0 {
+		a.BufferSize = defaultAnalyticsBufferSize
+	}
+
+	return nil
+}
+
+// LogShipping sends access and audit events to Kafka or an HTTP collector in batches, next to stdout logging.
+type LogShipping struct {
+	Sink  string          `json:"sink"` // kafka or http; empty disables shipping
+	Kafka KafkaTopic      `json:"kafka"`
+	HTTP  LogShippingHTTP `json:"http"`
+
+	BatchSize     int           `json:"batch_size"`     // events per request or Kafka batch, default 500
+	FlushInterval time.Duration `json:"flush_interval"` // upper bound on how long an event waits, default 1s
+	BufferSize    int           `json:"buffer_size"`    // events queued for the sink; beyond that they are dropped
+}
+
+// LogShippingHTTP posts batches as newline-delimited JSON.
+type LogShippingHTTP struct {
+	URL     string            `json:"url"`
+	Timeout time.Duration     `json:"timeout"`
+	Headers map[string]string `json:"headers"` // e.g. an ingestion API key
+}
+
+const (
+	LogSinkKafka = "kafka"
+	LogSinkHTTP  = "http"
+
+	defaultLogBatchSize     = 500
+	defaultLogFlushInterval = time.Second
+	defaultLogBufferSize    = 10000
+	defaultLogHTTPTimeout   = 5 * time.Second
+)
+
+func (l *LogShipping) validateAndNormalize() error {
+	switch l.Sink {
+	case "":
+		return nil
+	case LogSinkKafka:
+		if len(l.Kafka.Brokers) == 0 || l.Kafka.Topic == "" {
+			return errors.New("log_shipping.kafka.brokers and log_shipping.kafka.topic are required for the kafka sink")
+		}
+	case LogSinkHTTP:
+		u, err := url.Parse(l.HTTP.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("log_shipping.http.url must be a valid absolute URL")
+		}
+		if l.HTTP.Timeout < 0 {
+			return errors.New("log_shipping.http.timeout must be >= 0")
+		}
+		if l.HTTP.Timeout == 0 {
+			l.HTTP.Timeout = defaultLogHTTPTimeout
+		}
+	default:
+		return fmt.Errorf("log_shipping.sink %q is not supported", l.Sink)
+	}
+
+	if l.BatchSize < 0 || l.FlushInterval < 0 || l.BufferSize < 0 {
+		return errors.New("log_shipping batch_size, flush_interval and buffer_size must be >= 0")
+	}
+	if l.BatchSize == 0 {
+		l.BatchSize = defaultLogBatchSize
+	}
+	if l.FlushInterval == 0 {
+		l.FlushInterval = defaultLogFlushInterval
+	}
+	if l.BufferSize == 0 {
+		l.BufferSize = defaultLogBufferSize
+	}
+
+	return nil
+}
+
+// Hooks run side effects of completed API requests off the hot path: every request queues an event (dropped when
+// the queue is full) that a pool of workers hands to each webhook and to usage counting.
+type Hooks struct {
+	Webhooks []Webhook `json:"webhooks"`
+	Usage    Usage     `json:"usage"`
+
+	Workers   int `json:"workers"`    // default 4
+	QueueSize int `json:"queue_size"` // events waiting for a worker, default 10000
+}
+
+// Webhook POSTs events as JSON to URL. Routes limits it to route paths (all routes when empty), MinStatus to
+// responses with at least that status, e.g. 400 for failures only.
+type Webhook struct {
+	Name      string            `json:"name"` // labels its metrics, default the URL host
+	URL       string            `json:"url"`
+	Routes    []string          `json:"routes"`
+	MinStatus int               `json:"min_status"`
+	Timeout   time.Duration     `json:"timeout"` // default 5s
+	Headers   map[string]string `json:"headers"`
+}
+
+// Usage counts requests per api_key, route and UTC day in Redis hashes under Prefix, kept for Retention.
+type Usage struct {
+	Enabled   bool          `json:"enabled"`
+	Prefix    string        `json:"prefix"`    // default usage:
+	Retention time.Duration `json:"retention"` // default 35 days
+}
+
+const (
+	defaultHookWorkers    = 4
+	defaultHookQueueSize  = 10000
+	defaultWebhookTimeout = 5 * time.Second
+	defaultUsagePrefix    = "usage:"
+	defaultUsageRetention = 35 * 24 * time.Hour
+)
+
+// Enabled reports whether any hook is configured.
+func (h Hooks) Enabled() bool {
+	return len(h.Webhooks) > 0 || h.Usage.Enabled
+}
+
+func (h *Hooks) validateAndNormalize() error {
+	names := map[string]bool{}
+	for i := range h.Webhooks {
+		wh := &h.Webhooks[i]
+		u, err := url.Parse(wh.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("hooks.webhooks[%d].url must be a valid absolute URL", i)
+		}
+		if wh.Timeout < 0 || wh.MinStatus < 0 {
+			return fmt.Errorf("hooks.webhooks[%d] timeout and min_status must be >= 0", i)
+		}
+		if wh.Name == "" {
+			wh.Name = u.Host
+		}
+		if names[wh.Name] {
+			return fmt.Errorf("hooks.webhooks[%d].name %q is not unique", i, wh.Name)
+		}
+		names[wh.Name] = true
+		if wh.Timeout == 0 {
+			wh.Timeout = defaultWebhookTimeout
+		}
+	}
+
+	if h.Usage.Retention < 0 {
+		return errors.New("hooks.usage.retention must be >= 0")
+	}
+	if h.Usage.Enabled {
+		if h.Usage.Prefix == "" {
+			h.Usage.Prefix = defaultUsagePrefix
+		}
+		if h.Usage.Retention == 0 {
+			h.Usage.Retention = defaultUsageRetention
+		}
+	}
+
+	if h.Workers < 0 || h.QueueSize < 0 {
+		return errors.New("hooks.workers and hooks.queue_size must be >= 0")
+	}
+	if h.Workers == 0 {
+		h.Workers = defaultHookWorkers
+	}
+	if h.QueueSize == 0 {
+		h.QueueSize = defaultHookQueueSize
+	}
+
+	return nil
+}
+
+const (
+	CaptureSinkFile  = "file"
+	CaptureSinkKafka = "kafka"
+
+	defaultCaptureSampleRate   = 0.01
+	defaultCaptureMaxBodyBytes = 64 << 10
+	defaultCaptureBufferSize   = 1024
+)
+
+func (w *WAF) validateAndNormalize() error {
+	if w.ReloadInterval < 0 || w.MaxBodyBytes < 0 {
+		return errors.New("reload_interval and max_body_bytes must be >= 0")
+	}
+	if w.ReloadInterval == 0 {
+		w.ReloadInterval = defaultWAFReloadInterval
+	}
+	if w.MaxBodyBytes == 0 {
+		w.MaxBodyBytes = defaultWAFMaxBodyBytes
+	}
+
+	return nil
+}
+
+func (rs *ResponseScrub) validateAndNormalize() error {
+	if rs.MaxBodyBytes < 0 {
+		return errors.New("max_body_bytes must be >= 0")
+	}
+	if rs.MaxBodyBytes == 0 {
+		rs.MaxBodyBytes = defaultScrubMaxBodyBytes
+	}
+	if len(rs.ContentTypes) == 0 {
+		rs.ContentTypes = defaultScrubContentTypes
+	}
+
+	names := make(map[string]struct{}, len(rs.Patterns))
+	for i := range rs.Patterns {
+		p := &rs.Patterns[i]
+		if p.Name == "" {
+			return fmt.Errorf("patterns[%d]: name is required", i)
+		}
+		if _, ok := names[p.Name]; ok {
+			return fmt.Errorf("patterns[%d]: duplicate name %q", i, p.Name)
+		}
+		names[p.Name] = struct{}{}
+
+		switch {
+		case p.Regex != "":
+			if _, err := regexp.Compile(p.Regex); err != nil {
+				return fmt.Errorf("patterns[%d]: %w", i, err)
+			}
+		case p.Name != ScrubCreditCard:
+			return fmt.Errorf("patterns[%d]: regex is required unless name is %s", i, ScrubCreditCard)
+		}
+		if p.Replacement == "" {
+			p.Replacement = defaultScrubReplacement
+		}
+	}
+
+	return nil
+}
+
+func (c *Capture) validateAndNormalize() error {
+	switch c.Sink {
+	case "":
+		return nil
+	case CaptureSinkFile:
+		if c.File == "" {
+			return errors.New("capture.file is required for the file sink")
+		}
+	case CaptureSinkKafka:
+		if len(c.Kafka.Brokers) == 0 || c.Kafka.Topic == "" {
+			return errors.New("capture.kafka.brokers and capture.kafka.topic are required for the kafka sink")
+		}
+	default:
+		return fmt.Errorf("capture.sink %q is not supported", c.Sink)
+	}
+
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return errors.New("capture.sample_rate must be between 0 and 1")
+	}
+	if c.SampleRate == 0 {
+		c.SampleRate = defaultCaptureSampleRate
+	}
+
+	if c.MaxBodyBytes < 0 {
+		return errors.New("capture.max_body_bytes must be >= 0")
+	}
+	if c.MaxBodyBytes == 0 {
+		c.MaxBodyBytes = defaultCaptureMaxBodyBytes
+	}
+
+	if c.BufferSize <= 0 {
+		c.BufferSize = defaultCaptureBufferSize
+	}
+
+	for i, p := range c.Redact.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("capture.redact.patterns[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// WAF inspects API requests with the path, query, header and body rules of RulesFile before they are
+// authenticated. The file is re-read when it changes, checked every ReloadInterval (default 10s); a file that
+// fails to load leaves the previous rules in force. Bodies are inspected up to MaxBodyBytes (default 64 KiB).
+type WAF struct {
+	RulesFile      string        `json:"rules_file"` // empty disables the WAF
+	ReloadInterval time.Duration `json:"reload_interval"`
+	MaxBodyBytes   int64         `json:"max_body_bytes"`
+}
+
+// OPA configures an optional external authorization step evaluated by an OPA sidecar.
+type OPA struct {
+	URL        string        `json:"url"` // e.g. http://localhost:8181/v1/data/tyk/allow
+	Timeout    time.Duration `json:"timeout"`
+	CacheSize  int           `json:"cache_size"`
+	CacheTTL   time.Duration `json:"cache_ttl"`
+	FailPolicy string        `json:"fail_policy"` // closed (default) or open
+}
+
+const (
+	FailPolicyClosed = "closed"
+	FailPolicyOpen   = "open"
+)
+
+var failPolicies = []string{FailPolicyClosed, FailPolicyOpen}
+
+// Admin enables the admin API on the monitoring listener. Requests must carry "Authorization: Bearer <token>".
+type Admin struct {
+	Token string `json:"token"`
+}
+
+// Feature flags that can be toggled at runtime.
+const (
+	FlagCache = "cache" // serve responses from the response cache
+)
+
+var KnownFlags = []string{FlagCache}
+
+const servicePrefix = "TYK_PROX_"
+
+// ReadConfig loads config from JSON file and environment variables.
+// envOverrides controls priority:
+//   - true  => JSON loaded first, then ENV (ENV has higher priority)
+//   - false => ENV loaded first, then JSON (JSON has higher priority)
+func ReadConfig(configPath string, envOverrides *bool) (*Config, error) {
+	k := koanf.New(".")
+
+	useEnvOverrides := false
+	if envOverrides != nil {
+		useEnvOverrides = *envOverrides
+	}
+
+	slog.Info("Starting service. Reading config", "config_path", configPath, "env_overrides", useEnvOverrides)
+
+	if configPath == "" {
+		slog.Info("No config path provided, loading from env only")
+		if err := loadEnv(k); err != nil {
+			return nil, errors.Wrap(err, "fatal error loading config from env")
+		}
+	} else {
+		if useEnvOverrides {
+			slog.Info("Override with env variables")
+			// JSON (low prior) -> ENV (high prior)
+			if err := loadFile(k, configPath); err != nil {
+				return nil, err
+			}
+			if err := loadEnv(k); err != nil {
+				return nil, errors.Wrap(err, "fatal error loading config from env")
+			}
+		} else {
+			slog.Info("json config has priority over env variables")
+			// ENV (low prior) -> JSON (high prior)
+			if err := loadEnv(k); err != nil {
+				return nil, errors.Wrap(err, "fatal error loading config from env")
+			}
+			if err := loadFile(k, configPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	slog.Info("Unmarshaling config fields into struct")
+	var cfg Config
+	if err := k.UnmarshalWithConf("", &cfg, koanf.UnmarshalConf{
+		Tag:       "json",
+		FlatPaths: false,
+	}); err != nil {
+		return nil, errors.Wrap(err, "failure to unmarshal config fields into struct")
+	}
+
+	slog.Info("Config loaded successfully")
+	return &cfg, nil
+}
+
+const maxPort = 65535
+
+var supportedAlgorithms = []string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+
+	defaultMaxBodyBytes int64 = 10 << 20 // 10 MiB
+
+	defaultSignedURLMaxTTL = 24 * time.Hour
+
+	defaultMaxURLLength   = 8 << 10
+	defaultMaxQueryParams = 100
+
+	defaultMaxDecompressedBytes  int64 = 100 << 20 // 100 MiB
+	defaultMaxDecompressionRatio       = 100
+
+	defaultOPATimeout   = 500 * time.Millisecond
+	defaultOPACacheSize = 10000
+
+	defaultExtAuthzTimeout = time.Second
+
+	defaultContractMaxBodyBytes int64 = 1 << 20 // 1 MiB
+
+	defaultGRPCTimeout = 10 * time.Second
+
+	defaultRouteCacheTTL                   = time.Minute
+	defaultResponseCacheSize               = 10000
+	defaultResponseCacheMaxBodyBytes int64 = 1 << 20 // 1 MiB
+
+	defaultWAFReloadInterval       = 10 * time.Second
+	defaultWAFMaxBodyBytes   int64 = 64 << 10 // 64 KiB
+
+	defaultScrubMaxBodyBytes int64 = 1 << 20 // 1 MiB
+	defaultScrubReplacement        = "[REDACTED]"
+
+	defaultMaxStaleness      = 5 * time.Second
+	defaultSchemaCheckSample = 100
+
+	defaultFailoverWindow      = 30 * time.Second
+	defaultFailoverThreshold   = 0.5
+	defaultFailoverMinRequests = 20
+	defaultSnapshotInterval    = 5 * time.Minute
+
+	defaultTokenCacheTTL = 30 * time.Second
+
+	defaultIssuerTimeout      = 2 * time.Second
+	defaultIssuerNegativeTTL  = time.Minute
+	defaultIssuerNegativeSize = 10000
+
+	defaultTykSyncInterval = 5 * time.Minute
+	defaultTykSyncTimeout  = 30 * time.Second
+	defaultTykNoExpiryTTL  = 365 * 24 * time.Hour
+
+	defaultVerifyCacheTTL = 5 * time.Minute
+	defaultRejectCacheTTL = time.Minute
+	defaultJWKSRefresh    = 5 * time.Minute
+
+	defaultSLOLatencyThreshold = 250 * time.Millisecond
+	defaultSLOObjective        = 0.999
 )
 
-type Config struct {
-	Application    Application    `json:"application"`
-	ServerTimeouts ServerTimeouts `json:"server_timeouts"`
-	Redis          Redis          `json:"redis"`
-	Log            Log            `json:"log"`
-	Monitoring     Monitoring     `json:"monitoring"`
-}
+func (c *Config) ValidateAndNormalize() error {
+	if c == nil {
+		return errors.New("config is nil")
+	}
+
+	if c.Application.Port <= 0 || c.Application.Port > maxPort {
+		return fmt.Errorf("application.port must be between 1 and 65535")
+	}
+	if err := c.validateListeners(); err != nil {
+		return err
+	}
+	if err := c.Application.TLS.validateAndNormalize("application.tls"); err != nil {
+		return err
+	}
+
+	if c.Application.TargetHost == "" {
+		return errors.New("application.target_host is required")
+	}
+
+	u, err := url.Parse(c.Application.TargetHost)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("application.target_host must be a valid absolute URL")
+	}
+
+	if c.Application.Token.Algorithm == "" {
+		return errors.New("application.token.algorithm is required")
+	}
+
+	alg := strings.ToUpper(c.Application.Token.Algorithm)
+	if !slices.Contains(supportedAlgorithms, alg) {
+		return fmt.Errorf("application.token.algorithm %q is not supported", c.Application.Token.Algorithm)
+	}
+
+	if strings.HasPrefix(alg, "HS") && c.Application.Token.JWTSecret == "" {
+		return errors.New("application.token.jwt_secret is required for HMAC algorithms")
+	}
+	if tc := &c.Application.Token; tc.JWKSURL != "" {
+		if strings.HasPrefix(alg, "HS") {
+			return errors.New("application.token.jwks_url cannot be used with HMAC algorithms")
+		}
+		if u, err := url.Parse(tc.JWKSURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("application.token.jwks_url must be a valid absolute URL")
+		}
+		if tc.JWKSRefreshInterval <= 0 {
+			tc.JWKSRefreshInterval = defaultJWKSRefresh
+		}
+	} else if !strings.HasPrefix(alg, "HS") && tc.PublicKeyFile == "" {
+		return fmt.Errorf("application.token.public_key_file or jwks_url is required for %s", alg)
+	}
+
+	if c.Application.Token.VerifyCacheSize < 0 {
+		return errors.New("application.token.verify_cache_size must be >= 0")
+	}
+	if c.Application.Token.VerifyCacheSize > 0 && c.Application.Token.VerifyCacheTTL <= 0 {
+		c.Application.Token.VerifyCacheTTL = defaultVerifyCacheTTL
+	}
+	if c.Application.Token.RejectCacheSize < 0 {
+		return errors.New("application.token.reject_cache_size must be >= 0")
+	}
+	if c.Application.Token.RejectCacheSize > 0 && c.Application.Token.RejectCacheTTL <= 0 {
+		c.Application.Token.RejectCacheTTL = defaultRejectCacheTTL
+	}
+
+	switch c.Application.Token.LogAPIKey {
+	case "":
+		c.Application.Token.LogAPIKey = LogAPIKeyHash
+	case LogAPIKeyHash, LogAPIKeyPlain:
+	default:
+		return fmt.Errorf("application.token.log_api_key %q is not supported", c.Application.Token.LogAPIKey)
+	}
+	if c.Application.Token.LogClaims == nil {
+		c.Application.Token.LogClaims = defaultLogClaims
+	}
+
+	if c.Redis.Addr == "" {
+		return errors.New("redis.addr is required")
+	}
+	if c.Redis.DB < 0 {
+		return errors.New("redis.db must be >= 0")
+	}
+	if c.Redis.Username != "" && c.Redis.Password == "" {
+		return errors.New("redis.password is required with redis.username")
+	}
+	if err := c.Redis.TLS.validate("redis.tls"); err != nil {
+		return err
+	}
+
+	switch c.Redis.ReadPreference {
+	case "":
+		c.Redis.ReadPreference = ReadPreferencePrimary
+	case ReadPreferencePrimary:
+	case ReadPreferenceReplica:
+		if len(c.Redis.ReplicaAddrs) == 0 {
+			return errors.New("redis.replica_addrs is required when redis.read_preference is replica")
+		}
+	default:
+		return fmt.Errorf("redis.read_preference %q is not supported", c.Redis.ReadPreference)
+	}
+	if c.Redis.MaxStaleness <= 0 {
+		c.Redis.MaxStaleness = defaultMaxStaleness
+	}
+	if c.Redis.SchemaCheckSample < -1 {
+		return errors.New("redis.schema_check_sample must be -1 (skip), 0 (default) or positive")
+	}
+	if c.Redis.SchemaCheckSample == 0 {
+		c.Redis.SchemaCheckSample = defaultSchemaCheckSample
+	}
+
+	if err := c.Redis.Failover.validateAndNormalize(); err != nil {
+		return err
+	}
+
+	switch c.RateLimitStore.Backend {
+	case "":
+		c.RateLimitStore.Backend = RateLimitBackendRedis
+	case RateLimitBackendRedis:
+	case RateLimitBackendMemcached:
+		if len(c.RateLimitStore.MemcachedAddrs) == 0 {
+			return errors.New("rate_limit_store.memcached_addrs is required for the memcached backend")
+		}
+	default:
+		return fmt.Errorf("rate_limit_store.backend %q is not supported", c.RateLimitStore.Backend)
+	}
+	switch c.RateLimitStore.Algorithm {
+	case "":
+		c.RateLimitStore.Algorithm = RateLimitFixedWindow
+	case RateLimitFixedWindow:
+	case RateLimitSlidingWindow:
+		if c.RateLimitStore.Global.Addr != "" {
+			// regions exchange counts of the current window only
+			return errors.New("rate_limit_store.algorithm sliding_window is not supported with global counters")
+		}
+	case RateLimitTokenBucket:
+		if c.RateLimitStore.Backend != RateLimitBackendRedis || c.RateLimitStore.Global.Addr != "" {
+			return errors.New("rate_limit_store.algorithm token_bucket requires the redis backend without global counters")
+		}
+	default:
+		return fmt.Errorf("rate_limit_store.algorithm %q is not supported", c.RateLimitStore.Algorithm)
+	}
+	if sh := &c.RateLimitStore.Sharding; sh.Shards > 1 {
+		if sh.MinLimit < 0 {
+			return errors.New("rate_limit_store.sharding.min_limit must be >= 0")
+		}
+		if sh.MinLimit == 0 {
+			sh.MinLimit = defaultShardMinLimit
+		}
+	}
+	if err := c.RateLimitStore.Fallback.validateAndNormalize(); err != nil {
+		return err
+	}
+	if g := &c.RateLimitStore.Global; g.Addr != "" {
+		if g.Region == "" {
+			return errors.New("rate_limit_store.global.region is required with a global addr")
+		}
+		if g.SyncInterval < 0 || g.Tolerance < 0 {
+			return errors.New("rate_limit_store.global: sync_interval and tolerance must be >= 0")
+		}
+		if g.Username != "" && g.Password == "" {
+			return errors.New("rate_limit_store.global.password is required with rate_limit_store.global.username")
+		}
+		if err := g.TLS.validate("rate_limit_store.global.tls"); err != nil {
+			return err
+		}
+		if g.SyncInterval == 0 {
+			g.SyncInterval = defaultGlobalSyncInterval
+		}
+		if g.Tolerance == 0 {
+			g.Tolerance = defaultGlobalTolerance
+		}
+	}
+
+	switch c.TokenStore.Backend {
+	case "":
+		c.TokenStore.Backend = TokenBackendRedis
+	case TokenBackendRedis:
+	case TokenBackendPostgres:
+		if c.TokenStore.PostgresDSN == "" {
+			return errors.New("token_store.postgres_dsn is required for the postgres backend")
+		}
+	default:
+		return fmt.Errorf("token_store.backend %q is not supported", c.TokenStore.Backend)
+	}
+
+	if err := c.TokenStore.Cache.validateAndNormalize(); err != nil {
+		return err
+	}
+	if ti := c.TokenStore.Issuer; ti != nil {
+		if err := ti.validateAndNormalize(); err != nil {
+			return err
+		}
+	}
+	if ts := c.TokenStore.TykSync; ts != nil {
+		if err := ts.validateAndNormalize(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Capture.validateAndNormalize(); err != nil {
+		return err
+	}
+	if err := c.Analytics.validateAndNormalize(); err != nil {
+		return err
+	}
+
+	if err := c.Log.validateAndNormalize(); err != nil {
+		return err
+	}
+
+	if err := c.LogShipping.validateAndNormalize(); err != nil {
+		return err
+	}
+
+	if err := c.Hooks.validateAndNormalize(); err != nil {
+		return err
+	}
+
+	if err := c.WAF.validateAndNormalize(); err != nil {
+		return fmt.Errorf("waf: %w", err)
+	}
+
+	if c.Monitoring.Port < 0 || c.Monitoring.Port > maxPort {
+		return errors.New("monitoring.port must be between 0 and 65535")
+	}
+
+	for i, pc := range c.Monitoring.PathClasses {
+		if pc.Name == "" {
+			return fmt.Errorf("monitoring.path_classes[%d].name is required", i)
+		}
+		if _, err := regexp.Compile(pc.Pattern); err != nil || pc.Pattern == "" {
+			return fmt.Errorf("monitoring.path_classes[%d].pattern must be a valid regexp", i)
+		}
+	}
+
+	if err := c.Monitoring.Watchdog.validateAndNormalize(); err != nil {
+		return fmt.Errorf("monitoring.watchdog: %w", err)
+	}
+
+	if c.Monitoring.StatsD != nil {
+		if err := c.Monitoring.StatsD.validateAndNormalize(); err != nil {
+			return fmt.Errorf("monitoring.statsd: %w", err)
+		}
+	}
+
+	if c.Monitoring.SLO.LatencyThreshold < 0 {
+		return errors.New("monitoring.slo.latency_threshold must be >= 0")
+	}
+	if c.Monitoring.SLO.LatencyThreshold == 0 {
+		c.Monitoring.SLO.LatencyThreshold = defaultSLOLatencyThreshold
+	}
+	if o := c.Monitoring.SLO.Objective; o < 0 || o >= 1 {
+		return errors.New("monitoring.slo.objective must be in [0, 1)")
+	}
+	if c.Monitoring.SLO.Objective == 0 {
+		c.Monitoring.SLO.Objective = defaultSLOObjective
+	}
+
+	if c.Application.MaxBodyBytes < 0 {
+		return errors.New("application.max_body_bytes must be >= 0")
+	}
+	if c.Application.MaxBodyBytes == 0 {
+		c.Application.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	if c.Application.MaxURLLength < 0 || c.Application.MaxQueryParams < 0 {
+		return errors.New("application.max_url_length and application.max_query_params must be >= 0")
+	}
+	if c.Application.MaxURLLength == 0 {
+		c.Application.MaxURLLength = defaultMaxURLLength
+	}
+	if c.Application.MaxQueryParams == 0 {
+		c.Application.MaxQueryParams = defaultMaxQueryParams
+	}
+
+	switch c.Application.PathNormalization.TrailingSlash {
+	case "":
+		c.Application.PathNormalization.TrailingSlash = TrailingSlashKeep
+	case TrailingSlashKeep, TrailingSlashStrip:
+	default:
+		return fmt.Errorf("application.path_normalization.trailing_slash %q is not supported",
+			c.Application.PathNormalization.TrailingSlash)
+	}
+	switch c.Application.PathNormalization.EncodedSlash {
+	case "":
+		c.Application.PathNormalization.EncodedSlash = EncodedSlashDecode
+	case EncodedSlashDecode, EncodedSlashKeep, EncodedSlashReject:
+	default:
+		return fmt.Errorf("application.path_normalization.encoded_slash %q is not supported",
+			c.Application.PathNormalization.EncodedSlash)
+	}
+
+	if st := c.Application.Streaming; st.MaxPerToken < 0 || st.MaxDuration < 0 {
+		return errors.New("application.streaming values must be >= 0")
+	}
+	if len(c.Application.Streaming.ContentTypes) == 0 {
+		c.Application.Streaming.ContentTypes = defaultStreamingContentTypes
+	}
+
+	if rc := &c.Application.ResponseCache; rc.Size < 0 || rc.MaxBodyBytes < 0 {
+		return errors.New("application.response_cache values must be >= 0")
+	}
+	if c.Application.ResponseCache.Size == 0 {
+		c.Application.ResponseCache.Size = defaultResponseCacheSize
+	}
+	if c.Application.ResponseCache.MaxBodyBytes == 0 {
+		c.Application.ResponseCache.MaxBodyBytes = defaultResponseCacheMaxBodyBytes
+	}
+
+	if err := c.Application.ResponseScrub.validateAndNormalize(); err != nil {
+		return fmt.Errorf("application.response_scrub: %w", err)
+	}
+
+	if su := &c.Application.SignedURLs; su.MaxTTL < 0 || su.MaxUses < 0 {
+		return errors.New("application.signed_urls values must be >= 0")
+	}
+	if c.Application.SignedURLs.MaxTTL == 0 {
+		c.Application.SignedURLs.MaxTTL = defaultSignedURLMaxTTL
+	}
+
+	if c.Application.DefaultRateLimit < 0 {
+		return errors.New("application.default_rate_limit must be >= 0")
+	}
+
+	for name, p := range c.Application.Plans {
+		if p.RateLimit < 0 || p.AggregateRateLimit < 0 {
+			return fmt.Errorf("application.plans.%s limits must be >= 0", name)
+		}
+	}
+
+	if err := c.Application.Socket.validate("application.socket"); err != nil {
+		return err
+	}
+
+	if c.Application.ReadyUpstream != nil {
+		if err := c.Application.ReadyUpstream.validateAndNormalize(); err != nil {
+			return fmt.Errorf("application.ready_upstream: %w", err)
+		}
+	}
+
+	pool := &c.Application.UpstreamPool
+	if err := pool.validate("application.upstream_pool"); err != nil {
+		return err
+	}
+	pool.inherit(UpstreamPool{
+		MaxIdleConns:        defaultPoolMaxIdleConns,
+		MaxIdleConnsPerHost: defaultPoolMaxIdleConnsPerHost,
+		IdleConnTimeout:     defaultPoolIdleConnTimeout,
+	})
+
+	for i := range c.Application.Routes {
+		rt := &c.Application.Routes[i]
+		if err := rt.validateAndNormalize(); err != nil {
+			return fmt.Errorf("application.routes[%d]: %w", i, err)
+		}
+		if rt.UpstreamPool != nil {
+			rt.UpstreamPool.inherit(*pool)
+		}
+	}
+
+	if ul := c.Application.UpstreamRateLimit; ul.RPS < 0 || ul.QueueDepth < 0 || ul.MaxWait < 0 {
+		return errors.New("application.upstream_rate_limit values must be >= 0")
+	}
+
+	if cl := c.Application.ConcurrencyLimit; cl.MaxInFlight < 0 || cl.QueueDepth < 0 || cl.MaxWait < 0 {
+		return errors.New("application.concurrency_limit values must be >= 0")
+	}
+	for tier, w := range c.Application.ConcurrencyLimit.TierWeights {
+		if w <= 0 {
+			return fmt.Errorf("application.concurrency_limit.tier_weights[%s] must be > 0", tier)
+		}
+	}
+
+	if err := validateExperiments(c.Application.Experiments); err != nil {
+		return err
+	}
+
+	if err := validateFlags("flags", c.Flags); err != nil {
+		return err
+	}
+
+	if err := c.OPA.validateAndNormalize(); err != nil {
+		return err
+	}
+
+	if c.ServerTimeouts.ReadHeaderTimeout <= 0 {
+		c.ServerTimeouts.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if c.ServerTimeouts.ReadTimeout <= 0 {
+		c.ServerTimeouts.ReadTimeout = defaultReadTimeout
+	}
+	if c.ServerTimeouts.WriteTimeout <= 0 {
+		c.ServerTimeouts.WriteTimeout = defaultWriteTimeout
+	}
+	if c.ServerTimeouts.IdleTimeout <= 0 {
+		c.ServerTimeouts.IdleTimeout = defaultIdleTimeout
+	}
+
+	return nil
+}
+
+func (r *Route) validateAndNormalize() error {
+	if r.Path == "" {
+		return errors.New("path is required")
+	}
+	if r.Path != "*" && !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path %q must start with / or be *", r.Path)
+	}
+
+	if r.MaxBodyBytes < -1 {
+		return errors.New("max_body_bytes must be -1 (unlimited), 0 (inherit) or positive")
+	}
+	if r.BodyTimeout < 0 {
+		return errors.New("body_timeout must be >= 0")
+	}
+	if r.RateLimit < 0 {
+		return errors.New("rate_limit must be >= 0")
+	}
+
+	if d := r.Decompression; d != nil {
+		if d.MaxBytes < 0 || d.MaxRatio < 0 {
+			return errors.New("decompression limits must be >= 0")
+		}
+		if d.MaxBytes == 0 {
+			d.MaxBytes = defaultMaxDecompressedBytes
+		}
+		if d.MaxRatio == 0 {
+			d.MaxRatio = defaultMaxDecompressionRatio
+		}
+	}
+
+	if err := validateFlags("flags", r.Flags); err != nil {
+		return err
+	}
+
+	switch r.MethodOverride {
+	case "":
+		r.MethodOverride = MethodOverrideStrip
+	case MethodOverrideStrip, MethodOverrideHonor:
+	default:
+		return fmt.Errorf("method_override %q is not supported", r.MethodOverride)
+	}
+
+	for i, m := range r.Methods {
+		r.Methods[i] = strings.ToUpper(m)
+	}
+
+	switch r.Options {
+	case "":
+		r.Options = OptionsProxy
+	case OptionsProxy, OptionsLocal:
+	default:
+		return fmt.Errorf("options %q is not supported", r.Options)
+	}
+
+	for i, p := range r.ProbeBypass {
+		if p.UserAgentPrefix == "" && p.Header == "" {
+			return fmt.Errorf("probe_bypass[%d]: user_agent_prefix or header is required", i)
+		}
+	}
+
+	if len(r.MethodLimits) > 0 {
+		normalized := make(map[string]MethodLimit, len(r.MethodLimits))
+		for m, ml := range r.MethodLimits {
+			if ml.Limit < 0 {
+				return fmt.Errorf("method_limits.%s.limit must be >= 0", m)
+			}
+			if ml.Exempt && ml.Limit > 0 {
+				return fmt.Errorf("method_limits.%s: exempt and limit are mutually exclusive", m)
+			}
+			normalized[strings.ToUpper(m)] = ml
+		}
+		r.MethodLimits = normalized
+	}
+
+	if r.ExtAuthz != nil {
+		u, err := url.Parse(r.ExtAuthz.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("ext_authz.url must be a valid absolute URL")
+		}
+		if err := validateFailPolicy("ext_authz.fail_policy", &r.ExtAuthz.FailPolicy); err != nil {
+			return err
+		}
+		if r.ExtAuthz.Timeout <= 0 {
+			r.ExtAuthz.Timeout = defaultExtAuthzTimeout
+		}
+	}
 
-type Application struct {
-	TargetHost string `json:"target_host"`
-	Port       int    `json:"port"`
-	Token      Token  `json:"token"`
-}
+	if c := r.Contract; c != nil {
+		if c.Spec == "" {
+			return errors.New("contract.spec is required")
+		}
+		if c.MaxBodyBytes < 0 {
+			return errors.New("contract.max_body_bytes must be >= 0")
+		}
+		if c.MaxBodyBytes == 0 {
+			c.MaxBodyBytes = defaultContractMaxBodyBytes
+		}
+	}
 
-type Token struct {
-	JWTSecret string `json:"jwt_secret"` // II+NZDtODCTp0eAGX0/3HNdaExOf+M1uesFHdN+IFcTD774aaeJrJIOMS4aYhi+l
-	Algorithm string `json:"algorithm"`  // HS256
-}
-type ServerTimeouts struct {
-	ReadHeaderTimeout time.Duration `json:"readHeaderTimeout,omitempty"`
-	ReadTimeout       time.Duration `json:"readTimeout,omitempty"`
-	WriteTimeout      time.Duration `json:"writeTimeout,omitempty"`
-	IdleTimeout       time.Duration `json:"idleTimeout,omitempty"`
-}
+	if rc := r.Cache; rc != nil {
+		if rc.TTL < 0 {
+			return errors.New("cache.ttl must be >= 0")
+		}
+		if rc.TTL == 0 {
+			rc.TTL = defaultRouteCacheTTL
+		}
+		switch rc.ETag {
+		case "":
+			rc.ETag = ETagGenerate
+		case ETagGenerate, ETagPassthrough:
+		default:
+			return fmt.Errorf("cache.etag %q is not supported", rc.ETag)
+		}
+	}
 
-type Log struct {
-	Level   string `json:"level"`
-	Format  string `json:"format"`
-	Colored bool   `json:"colored"`
-}
+	if d := r.Deprecation; d != nil {
+		if d.Date.IsZero() {
+			return errors.New("deprecation.date is required")
+		}
+		if !d.Sunset.IsZero() && d.Sunset.Before(d.Date) {
+			return errors.New("deprecation.sunset must not be before deprecation.date")
+		}
+		if d.Link != "" {
+			if u, err := url.Parse(d.Link); err != nil || !u.IsAbs() {
+				return errors.New("deprecation.link must be an absolute URL")
+			}
+		}
+	}
 
-type Monitoring struct {
-	IP     string `json:"ip"`
-	Scheme string `json:"scheme"`
-	Port   int    `json:"port"`
-}
+	for i := range r.RequiredHeaders {
+		h := &r.RequiredHeaders[i]
+		if h.Name == "" {
+			return fmt.Errorf("required_headers[%d].name is required", i)
+		}
+		if h.Pattern != "" && h.Version != "" {
+			return fmt.Errorf("required_headers[%d]: pattern and version are mutually exclusive", i)
+		}
+		if _, err := regexp.Compile(h.Pattern); err != nil {
+			return fmt.Errorf("required_headers[%d].pattern: %w", i, err)
+		}
+		if h.Version != "" {
+			if _, err := semver.ParseRange(h.Version); err != nil {
+				return fmt.Errorf("required_headers[%d].version: %w", i, err)
+			}
+		}
+		for j, m := range h.Methods {
+			h.Methods[j] = strings.ToUpper(m)
+		}
+	}
 
-type Redis struct {
-	Addr string `json:"addr"`
+	if q := r.Query; q != nil {
+		switch q.Unknown {
+		case "":
+			q.Unknown = QueryUnknownStrip
+		case QueryUnknownStrip, QueryUnknownReject:
+		default:
+			return fmt.Errorf("query.unknown %q is not supported", q.Unknown)
+		}
+	}
+
+	if g := r.GRPC; g != nil {
+		if err := g.validateAndNormalize(); err != nil {
+			return fmt.Errorf("grpc: %w", err)
+		}
+	}
+
+	if v := r.Versions; v != nil {
+		if err := v.validateAndNormalize(); err != nil {
+			return fmt.Errorf("versions: %w", err)
+		}
+	}
+
+	if r.Upstream != "" {
+		if u, err := url.Parse(r.Upstream); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("upstream must be a valid absolute URL")
+		}
+	}
+	if rw := r.Rewrite; rw != nil {
+		if rw.StripPrefix == "" && rw.AddPrefix == "" {
+			return errors.New("rewrite: strip_prefix or add_prefix is required")
+		}
+		if (rw.StripPrefix != "" && !strings.HasPrefix(rw.StripPrefix, "/")) || (rw.AddPrefix != "" && !strings.HasPrefix(rw.AddPrefix, "/")) {
+			return errors.New("rewrite prefixes must start with /")
+		}
+		rw.StripPrefix = strings.TrimSuffix(rw.StripPrefix, "/")
+		rw.AddPrefix = strings.TrimSuffix(rw.AddPrefix, "/")
+	}
+
+	if p := r.UpstreamPool; p != nil {
+		if err := p.validate("upstream_pool"); err != nil {
+			return err
+		}
+	}
+
+	if ac := r.AdaptiveConcurrency; ac != nil {
+		if err := ac.validateAndNormalize(); err != nil {
+			return fmt.Errorf("adaptive_concurrency: %w", err)
+		}
+	}
+
+	if lp := r.LongPoll; lp != nil {
+		if err := lp.validateAndNormalize(); err != nil {
+			return fmt.Errorf("long_poll: %w", err)
+		}
+	}
+
+	if o := r.UpstreamOAuth2; o != nil {
+		if err := o.validateAndNormalize(); err != nil {
+			return fmt.Errorf("upstream_oauth2: %w", err)
+		}
+	}
+
+	return nil
 }
 
-const servicePrefix = "TYK_PROX_"
+func (o *UpstreamOAuth2) validateAndNormalize() error {
+	u, err := url.Parse(o.TokenURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("token_url must be a valid absolute URL")
+	}
+	if o.ClientID == "" || o.ClientSecret == "" {
+		return errors.New("client_id and client_secret are required")
+	}
+	if o.Timeout < 0 || o.RefreshBefore < 0 {
+		return errors.New("timeout and refresh_before must be >= 0")
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultUpstreamOAuth2Timeout
+	}
+	if o.RefreshBefore == 0 {
+		o.RefreshBefore = defaultUpstreamOAuth2RefreshBefore
+	}
 
-// ReadConfig loads config from JSON file and environment variables.
-// envOverrides controls priority:
-//   - true  => JSON loaded first, then ENV (ENV has higher priority)
-//   - false => ENV loaded first, then JSON (JSON has higher priority)
-func ReadConfig(configPath string, envOverrides *bool) (*Config, error) {
-	k := koanf.New(".")
+	return nil
+}
 
-	useEnvOverrides := false
-	if envOverrides != nil {
-		useEnvOverrides = *envOverrides
+func (lp *LongPoll) validateAndNormalize() error {
+	if lp.Timeout < 0 || lp.Heartbeat < 0 {
+		return errors.New("timeout and heartbeat must be >= 0")
+	}
+	if lp.Timeout == 0 {
+		lp.Timeout = defaultLongPollTimeout
+	}
+	if lp.Heartbeat > 0 && lp.Heartbeat >= lp.Timeout {
+		return errors.New("heartbeat must be shorter than timeout")
+	}
+	if lp.Payload == "" {
+		lp.Payload = defaultLongPollPayload
+	}
+	if lp.ContentType == "" {
+		lp.ContentType = defaultLongPollContentType
 	}
 
-	slog.Info("Starting service. Reading config", "config_path", configPath, "env_overrides", useEnvOverrides)
+	return nil
+}
 
-	if configPath == "" {
-		slog.Info("No config path provided, loading from env only")
-		if err := loadEnv(k); err != nil {
-			return nil, errors.Wrap(err, "fatal error loading config from env")
+func (v *Versioning) validateAndNormalize() error {
+	if len(v.Upstreams) == 0 {
+		return errors.New("at least one upstream is required")
+	}
+	if v.Segment < 0 {
+		return errors.New("segment must be >= 0")
+	}
+	if v.StripSegment && v.Segment == 0 {
+		return errors.New("strip_segment requires segment")
+	}
+	if len(v.Headers) == 0 {
+		v.Headers = defaultVersionHeaders
+	}
+
+	seen := map[string]string{}
+	for version, target := range v.Upstreams {
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("upstreams.%s must be a valid absolute URL", version)
 		}
-	} else {
-		if useEnvOverrides {
-			slog.Info("Override with env variables")
-			// JSON (low prior) -> ENV (high prior)
-			if err := loadFile(k, configPath); err != nil {
-				return nil, err
-			}
-			if err := loadEnv(k); err != nil {
-				return nil, errors.Wrap(err, "fatal error loading config from env")
-			}
-		} else {
-			slog.Info("json config has priority over env variables")
-			// ENV (low prior) -> JSON (high prior)
-			if err := loadEnv(k); err != nil {
-				return nil, errors.Wrap(err, "fatal error loading config from env")
-			}
-			if err := loadFile(k, configPath); err != nil {
-				return nil, err
-			}
+		id := VersionID(version)
+		if id == "" {
+			return errors.New("upstreams: version name must not be empty")
 		}
+		if other, ok := seen[id]; ok {
+			return fmt.Errorf("upstreams: %q and %q name the same version", other, version)
+		}
+		seen[id] = version
 	}
 
-	slog.Info("Unmarshaling config fields into struct")
-	var cfg Config
-	if err := k.UnmarshalWithConf("", &cfg, koanf.UnmarshalConf{
-		Tag:       "json",
-		FlatPaths: false,
-	}); err != nil {
-		return nil, errors.Wrap(err, "failure to unmarshal config fields into struct")
+	if v.Default != "" {
+		if _, ok := seen[VersionID(v.Default)]; !ok {
+			return fmt.Errorf("default %q is not one of upstreams", v.Default)
+		}
 	}
 
-	slog.Info("Config loaded successfully")
-	return &cfg, nil
+	return nil
+}
+
+// ReadyUpstream probes the upstream for readiness: a TCP connect, or an HTTP GET of Path answered without a 5xx.
+// A result is reused for CacheTTL so frequent readiness checks do not load the upstream.
+type ReadyUpstream struct {
+	Mode     string        `json:"mode"`      // tcp (default) or http
+	Path     string        `json:"path"`      // http only, default /
+	Timeout  time.Duration `json:"timeout"`   // default 2s
+	CacheTTL time.Duration `json:"cache_ttl"` // default 5s
 }
 
 const (
-	defaultReadHeaderTimeout = 5 * time.Second
-	defaultReadTimeout       = 30 * time.Second
-	defaultWriteTimeout      = 30 * time.Second
-	defaultIdleTimeout       = 60 * time.Second
+	ReadyProbeTCP  = "tcp"
+	ReadyProbeHTTP = "http"
 )
 
-func (c *Config) ValidateAndNormalize() error {
-	if c == nil {
-		return errors.New("config is nil")
+const (
+	defaultReadyUpstreamTimeout  = 2 * time.Second
+	defaultReadyUpstreamCacheTTL = 5 * time.Second
+)
+
+func (ru *ReadyUpstream) validateAndNormalize() error {
+	switch ru.Mode {
+	case "":
+		ru.Mode = ReadyProbeTCP
+	case ReadyProbeTCP, ReadyProbeHTTP:
+	default:
+		return fmt.Errorf("mode must be %s or %s", ReadyProbeTCP, ReadyProbeHTTP)
+	}
+	if ru.Path != "" && !strings.HasPrefix(ru.Path, "/") {
+		return errors.New("path must start with /")
+	}
+	if ru.Timeout < 0 || ru.CacheTTL < 0 {
+		return errors.New("timeout and cache_ttl must be >= 0")
 	}
 
-	if c.Application.Port <= 0 || c.Application.Port > 65535 {
-		return fmt.Errorf("application.port must be between 1 and 65535")
+	if ru.Path == "" {
+		ru.Path = "/"
+	}
+	if ru.Timeout == 0 {
+		ru.Timeout = defaultReadyUpstreamTimeout
+	}
+	if ru.CacheTTL == 0 {
+		ru.CacheTTL = defaultReadyUpstreamCacheTTL
 	}
 
-	if c.Application.TargetHost == "" {
-		return errors.New("application.target_host is required")
+	return nil
+}
+
+// validateListeners checks the listener IPs and that the main and monitoring listeners do not claim the same
+// address: on one port they need distinct, specific IPs.
+func (c *Config) validateListeners() error {
+	appIP, monIP := net.ParseIP(c.Application.IP), net.ParseIP(c.Monitoring.IP)
+	if c.Application.IP != "" && appIP == nil {
+		return errors.New("application.ip must be an IP address")
+	}
+	if c.Monitoring.IP != "" && monIP == nil {
+		return errors.New("monitoring.ip must be an IP address")
 	}
 
-	u, err := url.Parse(c.Application.TargetHost)
-	if err != nil || u.Scheme == "" || u.Host == "" {
-		return fmt.Errorf("application.target_host must be a valid absolute URL")
+	if c.Monitoring.Port != c.Application.Port {
+		return nil
+	}
+	if appIP == nil || monIP == nil || appIP.IsUnspecified() || monIP.IsUnspecified() || appIP.Equal(monIP) {
+		return fmt.Errorf("application and monitoring listeners both bind port %d: use another monitoring.port "+
+			"or distinct, specific application.ip and monitoring.ip", c.Application.Port)
 	}
 
-	if c.Application.Token.Algorithm == "" {
-		return errors.New("application.token.algorithm is required")
+	return nil
+}
+
+func (sd *StatsD) validateAndNormalize() error {
+	if _, _, err := net.SplitHostPort(sd.Addr); err != nil {
+		return errors.New("addr must be host:port")
+	}
+	if sd.FlushInterval < 0 || sd.MaxPacketSize < 0 {
+		return errors.New("flush_interval and max_packet_size must be >= 0")
 	}
 
-	alg := strings.ToUpper(c.Application.Token.Algorithm)
-	switch alg {
-	case "HS256", "HS384", "HS512":
-	default:
-		return fmt.Errorf("application.token.algorithm %q is not supported", c.Application.Token.Algorithm)
+	if sd.Prefix == "" {
+		sd.Prefix = defaultStatsDPrefix
+	}
+	if sd.FlushInterval == 0 {
+		sd.FlushInterval = defaultStatsDFlushInterval
+	}
+	if sd.MaxPacketSize == 0 {
+		sd.MaxPacketSize = defaultStatsDPacketSize
 	}
 
-	if c.Application.Token.JWTSecret == "" {
-		return errors.New("application.token.jwt_secret is required for HMAC algorithms")
+	return nil
+}
+
+func (w *Watchdog) validateAndNormalize() error {
+	if w.Interval < 0 || w.MaxGoroutines < 0 || w.MaxHeapBytes < 0 || w.Cooldown < 0 || w.MaxProfiles < 0 {
+		return errors.New("values must be >= 0")
 	}
 
-	if c.Redis.Addr == "" {
-		return errors.New("redis.addr is required")
+	if w.Interval == 0 {
+		w.Interval = defaultWatchdogInterval
+	}
+	if w.Cooldown == 0 {
+		w.Cooldown = defaultWatchdogCooldown
+	}
+	if w.MaxProfiles == 0 {
+		w.MaxProfiles = defaultWatchdogMaxProfiles
 	}
 
-	if c.Monitoring.Port < 0 || c.Monitoring.Port > 65535 {
-		return errors.New("monitoring.port must be between 0 and 65535")
+	return nil
+}
+
+func (ac *AdaptiveConcurrency) validateAndNormalize() error {
+	if ac.InitialLimit < 0 || ac.MinLimit < 0 || ac.MaxLimit < 0 || ac.Window < 0 {
+		return errors.New("limits and window must be >= 0")
+	}
+	if ac.Tolerance != 0 && ac.Tolerance < 1 {
+		return errors.New("tolerance must be >= 1")
 	}
 
-	if c.ServerTimeouts.ReadHeaderTimeout <= 0 {
-		c.ServerTimeouts.ReadHeaderTimeout = defaultReadHeaderTimeout
+	if ac.MinLimit == 0 {
+		ac.MinLimit = defaultAdaptiveMinLimit
 	}
-	if c.ServerTimeouts.ReadTimeout <= 0 {
-		c.ServerTimeouts.ReadTimeout = defaultReadTimeout
+	if ac.MaxLimit == 0 {
+		ac.MaxLimit = max(defaultAdaptiveMaxLimit, ac.MinLimit)
 	}
-	if c.ServerTimeouts.WriteTimeout <= 0 {
-		c.ServerTimeouts.WriteTimeout = defaultWriteTimeout
+	if ac.MinLimit > ac.MaxLimit {
+		return errors.New("min_limit must not exceed max_limit")
 	}
-	if c.ServerTimeouts.IdleTimeout <= 0 {
-		c.ServerTimeouts.IdleTimeout = defaultIdleTimeout
+	if ac.InitialLimit == 0 {
+		ac.InitialLimit = min(max(defaultAdaptiveInitialLimit, ac.MinLimit), ac.MaxLimit)
+	}
+	if ac.InitialLimit < ac.MinLimit || ac.InitialLimit > ac.MaxLimit {
+		return errors.New("initial_limit must be between min_limit and max_limit")
+	}
+	if ac.Tolerance == 0 {
+		ac.Tolerance = defaultAdaptiveTolerance
+	}
+	if ac.Window == 0 {
+		ac.Window = defaultAdaptiveWindow
+	}
+
+	return nil
+}
+
+// VersionID is how API versions are compared: "V2", "v2" and "2" are the same version.
+func VersionID(version string) string {
+	version = strings.ToLower(strings.TrimSpace(version))
+	return strings.TrimPrefix(version, "v")
+}
+
+func (g *GRPCTranscoding) validateAndNormalize() error {
+	if g.Target == "" || strings.Contains(g.Target, "://") {
+		return errors.New("target must be host:port")
+	}
+	if g.Descriptors == "" {
+		return errors.New("descriptors is required")
+	}
+	if len(g.Methods) == 0 {
+		return errors.New("at least one method is required")
+	}
+	if g.Timeout < 0 {
+		return errors.New("timeout must be >= 0")
+	}
+	if g.Timeout == 0 {
+		g.Timeout = defaultGRPCTimeout
+	}
+
+	for i := range g.Methods {
+		m := &g.Methods[i]
+		if !strings.HasPrefix(m.Path, "/") {
+			return fmt.Errorf("methods[%d].path must start with /", i)
+		}
+		if svc, name, ok := strings.Cut(m.Method, "/"); !ok || svc == "" || name == "" {
+			return fmt.Errorf("methods[%d].method must be package.Service/Method", i)
+		}
+		m.HTTPMethod = strings.ToUpper(m.HTTPMethod)
+		if m.HTTPMethod == "" {
+			m.HTTPMethod = http.MethodPost
+		}
+	}
+
+	return nil
+}
+
+func (o *OPA) validateAndNormalize() error {
+	if o.URL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(o.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("opa.url must be a valid absolute URL")
+	}
+
+	if err := validateFailPolicy("opa.fail_policy", &o.FailPolicy); err != nil {
+		return err
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = defaultOPATimeout
+	}
+	if o.CacheSize <= 0 {
+		o.CacheSize = defaultOPACacheSize
+	}
+
+	return nil
+}
+
+func validateFlags(field string, flags map[string]bool) error {
+	for name := range flags {
+		if !slices.Contains(KnownFlags, name) {
+			return fmt.Errorf("%s: unknown flag %q", field, name)
+		}
+	}
+
+	return nil
+}
+
+func validateFailPolicy(field string, p *string) error {
+	*p = strings.ToLower(*p)
+	if *p == "" {
+		*p = FailPolicyClosed
+	}
+
+	if !slices.Contains(failPolicies, *p) {
+		return fmt.Errorf("%s %q is not supported", field, *p)
 	}
 
 	return nil
 }
 
 func loadEnv(k *koanf.Koanf) error {
+	table := envTable()
 	return k.Load(env.Provider(servicePrefix, ".", func(s string) string {
-		// has to cut it by itself, but didn't work
-		s = strings.TrimPrefix(s, servicePrefix)
+		path, ok := table[s]
+		if !ok {
+			slog.Warn("Unknown environment variable ignored", "name", s)
+			return ""
+		}
 
-		s = strings.ToLower(s)
-		s = strings.ReplaceAll(s, "__", ".")
-		return s
+		return path
 	}), nil)
 }
 
@@ -1,6 +1,16 @@
 package config
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
 
 func TestValidateAndNormalize_AppliesTimeoutDefaults(t *testing.T) {
 	cfg := &Config{
@@ -51,6 +61,238 @@ func TestValidateAndNormalize_InvalidPort(t *testing.T) {
 	}
 }
 
+func TestValidateAndNormalize_ListenerIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		appIP   string
+		monIP   string
+		monPort int
+		wantErr bool
+	}{
+		{"private main listener", "10.0.0.5", "", 9090, false},
+		{"not an ip", "eth0", "", 9090, true},
+		{"bad monitoring ip", "", "localhost", 9090, true},
+		{"same port on all interfaces", "", "127.0.0.1", 8080, true},
+		{"same port and ip", "10.0.0.5", "10.0.0.5", 8080, true},
+		{"same port, distinct ips", "10.0.0.5", "127.0.0.1", 8080, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Application: Application{
+					TargetHost: "http://example.com",
+					IP:         tt.appIP,
+					Port:       8080,
+					Token:      Token{JWTSecret: "secret", Algorithm: "HS256"},
+				},
+				Redis:      Redis{Addr: "localhost:6379"},
+				Monitoring: Monitoring{IP: tt.monIP, Port: tt.monPort},
+			}
+
+			if err := cfg.ValidateAndNormalize(); (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAndNormalize_RedisConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		redis   Redis
+		wantErr bool
+	}{
+		{"password only", Redis{Password: "secret", DB: 3}, false},
+		{"acl user", Redis{Username: "proxy", Password: "secret"}, false},
+		{"user without password", Redis{Username: "proxy"}, true},
+		{"negative db", Redis{DB: -1}, true},
+		{"tls with ca", Redis{TLS: ClientTLS{Enabled: true, CAFile: "ca.pem"}}, false},
+		{"cert without key", Redis{TLS: ClientTLS{Enabled: true, CertFile: "cert.pem"}}, true},
+		{"tls settings while disabled", Redis{TLS: ClientTLS{CAFile: "ca.pem"}}, true},
+		{"tls 1.3", Redis{TLS: ClientTLS{Enabled: true, MinVersion: "1.3"}}, false},
+		{"unknown tls version", Redis{TLS: ClientTLS{Enabled: true, MinVersion: "1.1"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.redis.Addr = "localhost:6379"
+			cfg := &Config{
+				Application: Application{
+					TargetHost: "http://example.com",
+					Port:       8080,
+					Token:      Token{JWTSecret: "secret", Algorithm: "HS256"},
+				},
+				Redis: tt.redis,
+			}
+
+			if err := cfg.ValidateAndNormalize(); (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAndNormalize_GlobalCountersConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  GlobalCounters
+		wantErr bool
+	}{
+		{"no auth", GlobalCounters{}, false},
+		{"acl user", GlobalCounters{Username: "proxy", Password: "secret"}, false},
+		{"user without password", GlobalCounters{Username: "proxy"}, true},
+		{"tls with ca", GlobalCounters{TLS: ClientTLS{Enabled: true, CAFile: "ca.pem"}}, false},
+		{"tls settings while disabled", GlobalCounters{TLS: ClientTLS{CAFile: "ca.pem"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.global.Addr, tt.global.Region = "global:6379", "eu"
+			cfg := &Config{
+				Application: Application{
+					TargetHost: "http://example.com",
+					Port:       8080,
+					Token:      Token{JWTSecret: "secret", Algorithm: "HS256"},
+				},
+				Redis:          Redis{Addr: "localhost:6379"},
+				RateLimitStore: RateLimitStore{Global: tt.global},
+			}
+
+			if err := cfg.ValidateAndNormalize(); (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAndNormalize_RateLimitFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback RateLimitFallback
+		want     RateLimitFallback
+		wantErr  bool
+	}{
+		{"default follows failover", RateLimitFallback{}, RateLimitFallback{}, false},
+		{"open", RateLimitFallback{Policy: "Open"}, RateLimitFallback{Policy: RateLimitFallbackOpen}, false},
+		{"local defaults", RateLimitFallback{Policy: "local"}, RateLimitFallback{Policy: "local", Instances: 1, LocalSize: defaultRateLimitLocalSize}, false},
+		{"local shared", RateLimitFallback{Policy: "local", Instances: 4, LocalSize: 10}, RateLimitFallback{Policy: "local", Instances: 4, LocalSize: 10}, false},
+		{"instances without local", RateLimitFallback{Policy: "closed", Instances: 4}, RateLimitFallback{}, true},
+		{"negative instances", RateLimitFallback{Policy: "local", Instances: -1}, RateLimitFallback{}, true},
+		{"unknown policy", RateLimitFallback{Policy: "memory"}, RateLimitFallback{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Application: Application{
+					TargetHost: "http://example.com",
+					Port:       8080,
+					Token:      Token{JWTSecret: "secret", Algorithm: "HS256"},
+				},
+				Redis:          Redis{Addr: "localhost:6379"},
+				RateLimitStore: RateLimitStore{Fallback: tt.fallback},
+			}
+
+			err := cfg.ValidateAndNormalize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+			if err == nil && cfg.RateLimitStore.Fallback != tt.want {
+				t.Fatalf("fallback=%+v want=%+v", cfg.RateLimitStore.Fallback, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAndNormalize_ServerTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     ServerTLS
+		want    ServerTLS
+		wantErr bool
+	}{
+		{"disabled", ServerTLS{}, ServerTLS{}, false},
+		{"defaults", ServerTLS{CertFile: "cert.pem", KeyFile: "key.pem"},
+			ServerTLS{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: TLSVersion12, ReloadInterval: defaultTLSReloadInterval}, false},
+		{"mutual", ServerTLS{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem", MinVersion: "1.3"},
+			ServerTLS{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem", ClientAuth: ClientAuthRequire, MinVersion: TLSVersion13, ReloadInterval: defaultTLSReloadInterval}, false},
+		{"key without cert", ServerTLS{KeyFile: "key.pem"}, ServerTLS{}, true},
+		{"cert without key", ServerTLS{CertFile: "cert.pem"}, ServerTLS{}, true},
+		{"client_auth without ca", ServerTLS{CertFile: "cert.pem", KeyFile: "key.pem", ClientAuth: "optional"}, ServerTLS{}, true},
+		{"unknown version", ServerTLS{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.0"}, ServerTLS{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Application: Application{
+					TargetHost: "http://example.com",
+					Port:       8080,
+					Token:      Token{JWTSecret: "secret", Algorithm: "HS256"},
+					TLS:        tt.tls,
+				},
+				Redis: Redis{Addr: "localhost:6379"},
+			}
+
+			err := cfg.ValidateAndNormalize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Application.TLS != tt.want {
+				t.Fatalf("tls=%+v want=%+v", cfg.Application.TLS, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAndNormalize_Hooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		hooks   Hooks
+		wantErr bool
+	}{
+		{"disabled", Hooks{}, false},
+		{"webhook", Hooks{Webhooks: []Webhook{{URL: "https://hooks.example.com/in"}}}, false},
+		{"relative url", Hooks{Webhooks: []Webhook{{URL: "/in"}}}, true},
+		{"duplicate names", Hooks{Webhooks: []Webhook{{URL: "https://a.example.com"}, {URL: "https://a.example.com/other"}}}, true},
+		{"negative workers", Hooks{Workers: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Application: Application{
+					TargetHost: "http://example.com",
+					Port:       8080,
+					Token:      Token{JWTSecret: "secret", Algorithm: "HS256"},
+				},
+				Redis: Redis{Addr: "localhost:6379"},
+				Hooks: tt.hooks,
+			}
+
+			if err := cfg.ValidateAndNormalize(); (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+
+	cfg := &Config{
+		Application: Application{TargetHost: "http://example.com", Port: 8080, Token: Token{JWTSecret: "secret", Algorithm: "HS256"}},
+		Redis:       Redis{Addr: "localhost:6379"},
+		Hooks:       Hooks{Webhooks: []Webhook{{URL: "https://hooks.example.com/in"}}, Usage: Usage{Enabled: true}},
+	}
+	if err := cfg.ValidateAndNormalize(); err != nil {
+		t.Fatal(err)
+	}
+	h := cfg.Hooks
+	if h.Webhooks[0].Name != "hooks.example.com" || h.Webhooks[0].Timeout != defaultWebhookTimeout ||
+		h.Usage.Prefix != defaultUsagePrefix || h.Usage.Retention != defaultUsageRetention ||
+		h.Workers != defaultHookWorkers || h.QueueSize != defaultHookQueueSize {
+		t.Fatalf("hooks=%+v", h)
+	}
+}
+
 func TestValidateAndNormalize_UnsupportedAlgorithm(t *testing.T) {
 	cfg := &Config{
 		Application: Application{
@@ -58,7 +300,7 @@ func TestValidateAndNormalize_UnsupportedAlgorithm(t *testing.T) {
 			Port:       8080,
 			Token: Token{
 				JWTSecret: "secret",
-				Algorithm: "RS256",
+				Algorithm: "PS256",
 			},
 		},
 		Redis: Redis{Addr: "localhost:6379"},
@@ -68,3 +310,155 @@ func TestValidateAndNormalize_UnsupportedAlgorithm(t *testing.T) {
 		t.Fatalf("expected error for unsupported algorithm")
 	}
 }
+
+func TestValidateAndNormalize_AlgorithmKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   Token
+		wantErr bool
+	}{
+		{name: "hmac with secret", token: Token{Algorithm: "hs256", JWTSecret: "secret"}},
+		{name: "hmac needs secret", token: Token{Algorithm: "HS256", PublicKeyFile: "key.pem"}, wantErr: true},
+		{name: "rsa with public key", token: Token{Algorithm: "RS256", PublicKeyFile: "key.pem"}},
+		{name: "ecdsa needs public key", token: Token{Algorithm: "ES256", JWTSecret: "secret"}, wantErr: true},
+		{name: "rsa with jwks", token: Token{Algorithm: "RS256", JWKSURL: "https://idp.example.com/jwks"}},
+		{name: "jwks needs absolute url", token: Token{Algorithm: "RS256", JWKSURL: "/jwks"}, wantErr: true},
+		{name: "jwks with hmac", token: Token{Algorithm: "HS256", JWTSecret: "secret", JWKSURL: "https://idp.example.com/jwks"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{
+			Application: Application{TargetHost: "http://example.com", Port: 8080, Token: tt.token},
+			Redis:       Redis{Addr: "localhost:6379"},
+		}
+		err := cfg.ValidateAndNormalize()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err=%v wantErr=%v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEnvVars_ExplicitMapping(t *testing.T) {
+	table := envTable()
+
+	tests := map[string]string{
+		"TYK_PROX_APPLICATION__PORT":                  "application.port",
+		"TYK_PROX_APPLICATION__TOKEN__JWT_SECRET":     "application.token.jwt_secret",
+		"TYK_PROX_SERVER_TIMEOUTS__READHEADERTIMEOUT": "server_timeouts.readHeaderTimeout",
+		"TYK_PROX_REDIS__ADDR":                        "redis.addr",
+	}
+	for name, want := range tests {
+		if got := table[name]; got != want {
+			t.Fatalf("%s => %q, want %q", name, got, want)
+		}
+	}
+
+	if _, ok := table["TYK_PROX_APPLICATION__ROUTES"]; ok {
+		t.Fatalf("list fields must not be mapped from env")
+	}
+}
+
+func TestReadConfig_FromEnv(t *testing.T) {
+	t.Setenv("TYK_PROX_APPLICATION__TARGET_HOST", "http://backend:80")
+	t.Setenv("TYK_PROX_APPLICATION__PORT", "8081")
+	t.Setenv("TYK_PROX_SERVER_TIMEOUTS__READTIMEOUT", "7s")
+	t.Setenv("TYK_PROX_LOG__COLORED", "true")
+	t.Setenv("TYK_PROX_UNKNOWN__FIELD", "ignored")
+
+	cfg, err := ReadConfig("", nil)
+	if err != nil {
+		t.Fatalf("ReadConfig: %v", err)
+	}
+
+	if cfg.Application.TargetHost != "http://backend:80" || cfg.Application.Port != 8081 {
+		t.Fatalf("unexpected application config: %+v", cfg.Application)
+	}
+	if cfg.ServerTimeouts.ReadTimeout != 7*time.Second {
+		t.Fatalf("readTimeout=%s want 7s", cfg.ServerTimeouts.ReadTimeout)
+	}
+	if !cfg.Log.Colored {
+		t.Fatalf("log.colored should be true")
+	}
+}
+
+func TestValidateAndNormalize_LogOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		log     Log
+		wantErr bool
+	}{
+		{name: "defaults to stdout", log: Log{}},
+		{name: "file needs a path", log: Log{Outputs: []string{LogOutputFile}}, wantErr: true},
+		{name: "file with path", log: Log{Outputs: []string{LogOutputStdout, LogOutputFile}, File: LogFile{Path: "/tmp/p.log"}}},
+		{name: "remote syslog needs addr", log: Log{Outputs: []string{LogOutputSyslog}, Syslog: LogSyslog{Network: "udp"}}, wantErr: true},
+		{name: "unknown output", log: Log{Outputs: []string{"kafka"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		l := tt.log
+		err := l.validateAndNormalize()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err=%v wantErr=%v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && len(l.Outputs) == 0 {
+			t.Fatalf("%s: outputs not defaulted", tt.name)
+		}
+		if err == nil && slices.Contains(l.Outputs, LogOutputFile) && l.File.MaxSizeMB != defaultLogMaxSizeMB {
+			t.Fatalf("%s: max_size_mb=%d want default", tt.name, l.File.MaxSizeMB)
+		}
+	}
+}
+
+func TestInitLogger_File(t *testing.T) {
+	prev := log.Logger
+	t.Cleanup(func() { log.Logger = prev })
+
+	path := filepath.Join(t.TempDir(), "proxy.log")
+	cfg := &Config{Log: Log{Level: "info", Format: "json", Outputs: []string{LogOutputFile}, File: LogFile{Path: path, MaxSizeMB: 1}}}
+	if err := InitLogger(context.Background(), cfg); err != nil {
+		t.Fatalf("init logger: %v", err)
+	}
+
+	log.Info().Str("k", "v").Msg("hello file")
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	if !strings.Contains(string(b), `"message":"hello file"`) || !strings.Contains(string(b), `"k":"v"`) {
+		t.Fatalf("log file=%q", b)
+	}
+}
+
+func TestNewRotatingFile_StopsRotatingWithContext(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	lj := newRotatingFile(ctx, LogFile{Path: filepath.Join(dir, "proxy.log"), RotateInterval: 5 * time.Millisecond})
+	defer lj.Close()
+
+	if _, err := lj.Write([]byte("line\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	files := func() int {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("read dir: %v", err)
+		}
+		return len(entries)
+	}
+	deadline := time.Now().Add(time.Second)
+	for files() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("log file was not rotated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	time.Sleep(20 * time.Millisecond) // a rotation in progress when ctx is done may still finish
+	rotated := files()
+	time.Sleep(50 * time.Millisecond)
+	if got := files(); got != rotated {
+		t.Fatalf("files=%d want %d after ctx is done", got, rotated)
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// EnvVar describes a supported environment variable.
+type EnvVar struct {
+	Name string // e.g. TYK_PROX_APPLICATION__PORT
+	Path string // koanf path, e.g. application.port
+	Type string
+}
+
+// EnvVars lists all scalar config fields that can be set from the environment, derived from
+// the json struct tags. Lists and maps (e.g. application.routes) are file-only.
+func EnvVars() []EnvVar {
+	var out []EnvVar
+	collectEnvVars(reflect.TypeOf(Config{}), "", &out)
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func collectEnvVars(t reflect.Type, path string, out *[]EnvVar) {
+	for _, f := range structFields(t) {
+		fp := joinPath(path, f.name)
+		ft := f.typ
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		switch {
+		case ft == durationType:
+			*out = append(*out, EnvVar{Name: envName(fp), Path: fp, Type: "duration"})
+		case ft.Kind() == reflect.Struct:
+			collectEnvVars(ft, fp, out)
+		case ft.Kind() == reflect.Slice, ft.Kind() == reflect.Map:
+			continue
+		default:
+			*out = append(*out, EnvVar{Name: envName(fp), Path: fp, Type: ft.Kind().String()})
+		}
+	}
+}
+
+func envName(path string) string {
+	return servicePrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "__"))
+}
+
+// envTable maps variable names to config paths.
+func envTable() map[string]string {
+	vars := EnvVars()
+	table := make(map[string]string, len(vars))
+	for _, v := range vars {
+		table[v.Name] = v.Path
+	}
+
+	return table
+}
+
+// PrintEnv writes the supported environment variables as a table.
+func PrintEnv(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "VARIABLE\tCONFIG PATH\tTYPE"); err != nil {
+		return err
+	}
+	for _, v := range EnvVars() {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Name, v.Path, v.Type); err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
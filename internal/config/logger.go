@@ -1,9 +1,11 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
+	"log/syslog"
 	"net/http"
 	"os"
 	"strings"
@@ -12,6 +14,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 const (
@@ -61,40 +64,43 @@ var FormatLevelColored = func(i interface{}) string {
 	return padded
 }
 
-func InitLogger(cfg *Config) {
-	slog.Info("Initializing logger", "level", cfg.Log.Level, "format", cfg.Log.Format, "colored", cfg.Log.Colored)
+// InitLogger sets up the global logger; it fails if a configured output (file, syslog) cannot be opened. Time-based
+// log file rotation runs until ctx is done.
+func InitLogger(ctx context.Context, cfg *Config) error {
+	slog.Info("Initializing logger", "level", cfg.Log.Level, "format", cfg.Log.Format, "colored", cfg.Log.Colored,
+		"outputs", cfg.Log.Outputs)
 
 	zerolog.TimeFieldFormat = time.RFC3339Nano
 	zerolog.TimestampFieldName = "time"
 	zerolog.LevelFieldName = "level"
 
-	var output io.Writer
-	formatter := FormatLevel
-	if cfg.Log.Colored {
-		formatter = FormatLevelColored
+	outputs := cfg.Log.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{LogOutputStdout}
 	}
 
-	if cfg.Log.Format == "json" {
-		// Structured JSON output
-		output = os.Stdout
-
-	} else {
-		// Human-friendly console output
-		output = zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			TimeFormat: time.RFC3339Nano,
-			PartsOrder: []string{
-				zerolog.TimestampFieldName,
-				zerolog.LevelFieldName,
-				zerolog.MessageFieldName,
-			},
-			FormatLevel: formatter,
-			FormatMessage: func(i interface{}) string {
-				return fmt.Sprint(i)
-			},
+	writers := make([]io.Writer, 0, len(outputs))
+	for _, o := range outputs {
+		switch o {
+		case LogOutputStdout:
+			writers = append(writers, formatted(cfg.Log, os.Stdout, cfg.Log.Colored))
+		case LogOutputFile:
+			writers = append(writers, formatted(cfg.Log, newRotatingFile(ctx, cfg.Log.File), false))
+		case LogOutputSyslog:
+			w, err := newSyslogWriter(cfg.Log.Syslog)
+			if err != nil {
+				return fmt.Errorf("log.syslog: %w", err)
+			}
+			// syslog carries its own timestamp and severity; the message is the JSON event
+			writers = append(writers, zerolog.SyslogLevelWriter(w))
 		}
 	}
 
+	var output io.Writer = writers[0]
+	if len(writers) > 1 {
+		output = zerolog.MultiLevelWriter(writers...)
+	}
+
 	globalLogger := zerolog.New(output).With().Timestamp().Logger()
 
 	l, err := zerolog.ParseLevel(cfg.Log.Level)
@@ -103,6 +109,78 @@ func InitLogger(cfg *Config) {
 	}
 
 	log.Logger = globalLogger
+
+	return nil
+}
+
+// formatted wraps out in the console writer unless the JSON format is configured.
+func formatted(cfg Log, out io.Writer, colored bool) io.Writer {
+	if cfg.Format == "json" {
+		// Structured JSON output
+		return out
+	}
+
+	formatter := FormatLevel
+	if colored {
+		formatter = FormatLevelColored
+	}
+
+	// Human-friendly console output
+	return zerolog.ConsoleWriter{
+		Out:        out,
+		NoColor:    out != os.Stdout,
+		TimeFormat: time.RFC3339Nano,
+		PartsOrder: []string{
+			zerolog.TimestampFieldName,
+			zerolog.LevelFieldName,
+			zerolog.MessageFieldName,
+		},
+		FormatLevel: formatter,
+		FormatMessage: func(i interface{}) string {
+			return fmt.Sprint(i)
+		},
+	}
+}
+
+// newRotatingFile opens the log file with size-based rotation, plus time-based rotation until ctx is done if
+// configured.
+func newRotatingFile(ctx context.Context, cfg LogFile) *lumberjack.Logger {
+	lj := &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxAge:     cfg.MaxAgeDays,
+		MaxBackups: cfg.MaxBackups,
+		Compress:   cfg.Compress,
+	}
+
+	if cfg.RotateInterval > 0 {
+		go func() {
+			t := time.NewTicker(cfg.RotateInterval)
+			defer t.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+				}
+				if err := lj.Rotate(); err != nil {
+					slog.Error("Failed to rotate log file", "path", cfg.Path, "error", err)
+				}
+			}
+		}()
+	}
+
+	return lj
+}
+
+func newSyslogWriter(cfg LogSyslog) (*syslog.Writer, error) {
+	tag := cfg.Tag
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+
+	return syslog.Dial(cfg.Network, cfg.Addr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
 }
 
 type ChiZerologFormatter struct{}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// schemaRules holds JSON Schema constraints by config path ("[]" marks slice items).
+// Keep it in sync with ValidateAndNormalize.
+var schemaRules = map[string]map[string]any{
+	"application":                                             {"required": true},
+	"application.target_host":                                 {"required": true, "format": "uri", "minLength": 1},
+	"application.ready_upstream.mode":                         {"enum": []string{ReadyProbeTCP, ReadyProbeHTTP}},
+	"application.port":                                        {"required": true, "minimum": 1, "maximum": maxPort},
+	"application.token":                                       {"required": true},
+	"application.token.algorithm":                             {"required": true, "enum": caseVariants(supportedAlgorithms)},
+	"application.token.jwt_secret":                            {"minLength": 1},
+	"application.token.jwks_url":                              {"format": "uri"},
+	"application.token.verify_cache_size":                     {"minimum": 0},
+	"application.token.reject_cache_size":                     {"minimum": 0},
+	"application.token.log_api_key":                           {"enum": []string{LogAPIKeyHash, LogAPIKeyPlain}},
+	"application.max_body_bytes":                              {"minimum": 0},
+	"application.path_normalization.trailing_slash":           {"enum": []string{TrailingSlashKeep, TrailingSlashStrip}},
+	"application.path_normalization.encoded_slash":            {"enum": []string{EncodedSlashDecode, EncodedSlashKeep, EncodedSlashReject}},
+	"application.default_rate_limit":                          {"minimum": 0},
+	"application.routes[].path":                               {"required": true, "pattern": `^(\*|/.*)$`},
+	"application.routes[].max_body_bytes":                     {"minimum": -1},
+	"application.routes[].options":                            {"enum": []string{OptionsProxy, OptionsLocal}},
+	"application.routes[].method_override":                    {"enum": []string{MethodOverrideStrip, MethodOverrideHonor}},
+	"application.routes[].probe_bypass[].header":              {"pattern": `^[A-Za-z0-9-]*$`},
+	"application.routes[].rate_limit":                         {"minimum": 0},
+	"application.routes[].ext_authz.url":                      {"required": true, "format": "uri"},
+	"application.routes[].ext_authz.fail_policy":              {"enum": failPolicies},
+	"application.routes[].upstream_oauth2.token_url":          {"required": true, "format": "uri"},
+	"application.routes[].upstream_oauth2.client_id":          {"required": true},
+	"application.routes[].method_limits.*.limit":              {"minimum": 0},
+	"application.routes[].decompression.max_bytes":            {"minimum": 0},
+	"application.routes[].decompression.max_ratio":            {"minimum": 0},
+	"application.routes[].contract.max_body_bytes":            {"minimum": 0},
+	"application.routes[].cache.etag":                         {"enum": []string{ETagGenerate, ETagPassthrough}},
+	"application.routes[].versions.segment":                   {"minimum": 0},
+	"application.routes[].adaptive_concurrency.initial_limit": {"minimum": 0},
+	"application.routes[].adaptive_concurrency.min_limit":     {"minimum": 0},
+	"application.routes[].adaptive_concurrency.max_limit":     {"minimum": 0},
+	"application.routes[].adaptive_concurrency.tolerance":     {"minimum": 0},
+	"application.routes[].versions.upstreams.*":               {"format": "uri"},
+	"application.routes[].upstream":                           {"format": "uri"},
+	"application.routes[].rewrite.strip_prefix":               {"pattern": "^/"},
+	"application.routes[].rewrite.add_prefix":                 {"pattern": "^/"},
+	"application.response_cache.size":                         {"minimum": 0},
+	"application.response_cache.max_body_bytes":               {"minimum": 0},
+	"application.response_scrub.max_body_bytes":               {"minimum": 0},
+	"application.response_scrub.patterns[].name":              {"required": true, "minLength": 1},
+	"application.streaming.max_per_token":                     {"minimum": 0},
+	"application.plans.*.rate_limit":                          {"minimum": 0},
+	"application.plans.*.aggregate_rate_limit":                {"minimum": 0},
+	"application.experiments[].name":                          {"required": true, "pattern": `^[A-Za-z0-9_.-]+$`},
+	"application.experiments[].buckets":                       {"required": true, "minItems": 1},
+	"application.experiments[].buckets[].name":                {"required": true, "pattern": `^[A-Za-z0-9_.-]+$`},
+	"application.experiments[].buckets[].weight":              {"minimum": 0},
+	"application.signed_urls.max_uses":                        {"minimum": 0},
+	"application.max_url_length":                              {"minimum": 0},
+	"application.max_query_params":                            {"minimum": 0},
+	"application.socket.keep_alive_count":                     {"minimum": 0},
+	"application.socket.read_buffer":                          {"minimum": 0},
+	"application.socket.write_buffer":                         {"minimum": 0},
+	"application.tls.client_auth":                             {"enum": []string{ClientAuthRequire, ClientAuthOptional}},
+	"application.tls.min_version":                             {"enum": []string{TLSVersion12, TLSVersion13}},
+	"application.upstream_pool.socket.keep_alive_count":       {"minimum": 0},
+	"application.upstream_pool.socket.read_buffer":            {"minimum": 0},
+	"application.upstream_pool.socket.write_buffer":           {"minimum": 0},
+	"application.upstream_pool.tls.min_version":               {"enum": []string{TLSVersion12, TLSVersion13}},
+	"application.upstream_rate_limit.rps":                     {"minimum": 0},
+	"application.upstream_rate_limit.queue_depth":             {"minimum": 0},
+	"application.concurrency_limit.max_in_flight":             {"minimum": 0},
+	"application.concurrency_limit.queue_depth":               {"minimum": 0},
+	"application.concurrency_limit.tier_weights.*":            {"minimum": 1},
+	"redis":                              {"required": true},
+	"redis.addr":                         {"required": true, "minLength": 1},
+	"redis.read_preference":              {"enum": []string{ReadPreferencePrimary, ReadPreferenceReplica}},
+	"redis.failover.policy":              {"enum": failoverPolicies},
+	"redis.failover.error_threshold":     {"minimum": 0, "maximum": 1},
+	"redis.db":                           {"minimum": 0},
+	"redis.tls.min_version":              {"enum": []string{TLSVersion12, TLSVersion13}},
+	"redis.schema_check_sample":          {"minimum": -1},
+	"rate_limit_store.backend":           {"enum": []string{RateLimitBackendRedis, RateLimitBackendMemcached}},
+	"rate_limit_store.algorithm":         {"enum": []string{RateLimitFixedWindow, RateLimitSlidingWindow, RateLimitTokenBucket}},
+	"rate_limit_store.global.tolerance":  {"minimum": 0},
+	"rate_limit_store.sharding.shards":   {"minimum": 0},
+	"rate_limit_store.fallback.policy":   {"enum": []string{RateLimitFallbackClosed, RateLimitFallbackOpen, RateLimitFallbackLocal}},
+	"token_store.backend":                {"enum": []string{TokenBackendRedis, TokenBackendPostgres}},
+	"token_store.cache.size":             {"minimum": 0},
+	"token_store.cache.warm_up":          {"minimum": 0},
+	"token_store.issuer.url":             {"required": true, "minLength": 1},
+	"token_store.tyk_sync.url":           {"required": true, "minLength": 1},
+	"capture.sink":                       {"enum": []string{CaptureSinkFile, CaptureSinkKafka}},
+	"analytics.sink":                     {"enum": []string{AnalyticsSinkRedis, AnalyticsSinkFile}},
+	"hooks.workers":                      {"minimum": 0},
+	"hooks.queue_size":                   {"minimum": 0},
+	"hooks.webhooks[].url":               {"required": true, "minLength": 1},
+	"capture.sample_rate":                {"minimum": 0, "maximum": 1},
+	"capture.max_body_bytes":             {"minimum": 0},
+	"log.outputs[]":                      {"enum": logOutputs},
+	"log.file.max_size_mb":               {"minimum": 0},
+	"log.file.max_age_days":              {"minimum": 0},
+	"log.file.max_backups":               {"minimum": 0},
+	"log.syslog.network":                 {"enum": syslogNetworks},
+	"log_shipping.sink":                  {"enum": []string{LogSinkKafka, LogSinkHTTP}},
+	"log_shipping.http.url":              {"format": "uri"},
+	"log_shipping.batch_size":            {"minimum": 0},
+	"log_shipping.buffer_size":           {"minimum": 0},
+	"waf.max_body_bytes":                 {"minimum": 0},
+	"monitoring.port":                    {"minimum": 0, "maximum": maxPort},
+	"monitoring.slo.objective":           {"minimum": 0, "exclusiveMaximum": 1},
+	"monitoring.path_classes[].pattern":  {"required": true, "minLength": 1},
+	"monitoring.path_classes[].name":     {"required": true, "minLength": 1},
+	"monitoring.watchdog.max_goroutines": {"minimum": 0},
+	"monitoring.watchdog.max_heap_bytes": {"minimum": 0},
+	"monitoring.watchdog.max_profiles":   {"minimum": 0},
+	"monitoring.statsd.addr":             {"required": true, "minLength": 1},
+	"monitoring.statsd.max_packet_size":  {"minimum": 0},
+	"opa.url":                            {"format": "uri"},
+	"opa.fail_policy":                    {"enum": failPolicies},
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Schema returns a JSON Schema (draft 2020-12) describing the config file.
+func Schema() map[string]any {
+	s := typeSchema(reflect.TypeOf(Config{}), "")
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "tyk-proxy configuration"
+
+	return s
+}
+
+func typeSchema(t reflect.Type, path string) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	s := map[string]any{}
+	switch {
+	case t == durationType:
+		s["type"] = "string"
+		s["pattern"] = durationPattern
+	case t == timeType:
+		s["type"] = "string"
+		s["format"] = "date-time"
+	case t.Kind() == reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		for _, f := range structFields(t) {
+			fp := joinPath(path, f.name)
+			props[f.name] = typeSchema(f.typ, fp)
+			if req, _ := schemaRules[fp]["required"].(bool); req {
+				required = append(required, f.name)
+			}
+		}
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+		if len(required) > 0 {
+			s["required"] = required
+		}
+	case t.Kind() == reflect.Slice:
+		s["type"] = "array"
+		s["items"] = typeSchema(t.Elem(), path+"[]")
+	case t.Kind() == reflect.Map:
+		s["type"] = "object"
+		s["additionalProperties"] = typeSchema(t.Elem(), joinPath(path, "*"))
+	case t.Kind() == reflect.String:
+		s["type"] = "string"
+	case t.Kind() == reflect.Bool:
+		s["type"] = "boolean"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s["type"] = "number"
+	default:
+		s["type"] = "integer"
+	}
+
+	for k, v := range schemaRules[path] {
+		if k != "required" {
+			s[k] = v
+		}
+	}
+
+	return s
+}
+
+type field struct {
+	name string
+	typ  reflect.Type
+}
+
+// structFields lists exported fields by their json name, skipping untagged and "-" fields.
+func structFields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		out = append(out, field{name: name, typ: f.Type})
+	}
+
+	return out
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "." + name
+}
+
+func caseVariants(values []string) []string {
+	out := make([]string, 0, len(values)*2)
+	for _, v := range values {
+		out = append(out, strings.ToUpper(v), strings.ToLower(v))
+	}
+
+	return out
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSchema_RulesApplied(t *testing.T) {
+	s := Schema()
+
+	app := s["properties"].(map[string]any)["application"].(map[string]any)
+	port := app["properties"].(map[string]any)["port"].(map[string]any)
+	if port["minimum"] != 1 || port["maximum"] != maxPort || port["type"] != "integer" {
+		t.Fatalf("unexpected application.port schema: %v", port)
+	}
+
+	if !slices.Contains(app["required"].([]string), "target_host") {
+		t.Fatalf("application.target_host should be required: %v", app["required"])
+	}
+
+	timeouts := s["properties"].(map[string]any)["server_timeouts"].(map[string]any)
+	rt := timeouts["properties"].(map[string]any)["readTimeout"].(map[string]any)
+	if rt["type"] != "string" || rt["pattern"] != durationPattern {
+		t.Fatalf("durations should be strings with a pattern: %v", rt)
+	}
+
+	routes := app["properties"].(map[string]any)["routes"].(map[string]any)
+	item := routes["items"].(map[string]any)
+	if !slices.Contains(item["required"].([]string), "path") {
+		t.Fatalf("routes[].path should be required: %v", item)
+	}
+}
+
+// Every rule must point at an existing config field, otherwise it silently stops applying.
+func TestSchema_RulesMatchConfigFields(t *testing.T) {
+	paths := map[string]bool{}
+	collectPaths(reflect.TypeOf(Config{}), "", paths)
+
+	for p := range schemaRules {
+		if !paths[p] {
+			t.Fatalf("schema rule %q does not match any config field", p)
+		}
+	}
+}
+
+func collectPaths(t reflect.Type, path string, out map[string]bool) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	out[path] = true
+
+	switch {
+	case t == durationType, t == timeType:
+	case t.Kind() == reflect.Struct:
+		for _, f := range structFields(t) {
+			collectPaths(f.typ, joinPath(path, f.name), out)
+		}
+	case t.Kind() == reflect.Slice:
+		collectPaths(t.Elem(), path+"[]", out)
+	case t.Kind() == reflect.Map:
+		collectPaths(t.Elem(), joinPath(path, "*"), out)
+	}
+}
@@ -0,0 +1,313 @@
+package contract
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+const (
+	reasonOperation   = "undocumented_operation"
+	reasonStatus      = "undocumented_status"
+	reasonContentType = "undocumented_content_type"
+	reasonBody        = "invalid_body"
+)
+
+// MismatchError reports an upstream response that does not match the route's OpenAPI document.
+type MismatchError struct {
+	Route  string
+	Reason string
+	Detail string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("upstream response violates contract (%s): %s", e.Reason, e.Detail)
+}
+
+// Validator checks upstream responses of routes with a contract against their OpenAPI 3.0 documents.
+type Validator struct {
+	specs   map[string]*spec // by route path
+	metrics *mp.Metrics
+}
+
+type spec struct {
+	cfg  config.Contract
+	ops  []operation // most specific templates first
+	defs map[string]*Schema
+}
+
+type operation struct {
+	method    string
+	segments  []string
+	literals  int
+	responses map[string]*response
+}
+
+type response struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *Schema `json:"schema"`
+	} `json:"content"`
+}
+
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]*Schema   `json:"schemas"`
+		Responses map[string]*response `json:"responses"`
+	} `json:"components"`
+}
+
+var methods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true, "options": true, "head": true, "patch": true, "trace": true,
+}
+
+// New loads the OpenAPI documents of all routes with a contract. It returns nil when no route has one.
+func New(rs []config.Route, metrics *mp.Metrics) (*Validator, error) {
+	v := &Validator{specs: map[string]*spec{}, metrics: metrics}
+	for i := range rs {
+		if rs[i].Contract == nil {
+			continue
+		}
+
+		s, err := load(*rs[i].Contract)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", rs[i].Path, err)
+		}
+		v.specs[rs[i].Path] = s
+	}
+
+	if len(v.specs) == 0 {
+		return nil, nil
+	}
+
+	return v, nil
+}
+
+func load(cfg config.Contract) (*spec, error) {
+	b, err := os.ReadFile(cfg.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("read contract spec: %w", err)
+	}
+
+	var doc document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("parse contract spec %s: %w", cfg.Spec, err)
+	}
+
+	s := &spec{cfg: cfg, defs: doc.Components.Schemas}
+	seen := map[*Schema]bool{}
+	for name, def := range s.defs {
+		if err := def.resolve(s.defs, seen); err != nil {
+			return nil, fmt.Errorf("components.schemas.%s: %w", name, err)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method, raw := range item {
+			if !methods[method] {
+				continue
+			}
+
+			var op struct {
+				Responses map[string]*response `json:"responses"`
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("paths.%s.%s: %w", path, method, err)
+			}
+
+			for code, resp := range op.Responses {
+				if name, ok := strings.CutPrefix(resp.Ref, "#/components/responses/"); ok {
+					if op.Responses[code] = doc.Components.Responses[name]; op.Responses[code] == nil {
+						return nil, fmt.Errorf("paths.%s.%s: unresolved $ref %q", path, method, resp.Ref)
+					}
+				}
+				for ct, media := range op.Responses[code].Content {
+					if err := media.Schema.resolve(s.defs, seen); err != nil {
+						return nil, fmt.Errorf("paths.%s.%s.responses.%s.%s: %w", path, method, code, ct, err)
+					}
+				}
+			}
+
+			o := operation{
+				method:    strings.ToUpper(method),
+				segments:  strings.Split(strings.Trim(path, "/"), "/"),
+				responses: op.Responses,
+			}
+			for _, seg := range o.segments {
+				if !isParam(seg) {
+					o.literals++
+				}
+			}
+			s.ops = append(s.ops, o)
+		}
+	}
+
+	sort.SliceStable(s.ops, func(i, j int) bool { return s.ops[i].literals > s.ops[j].literals })
+
+	return s, nil
+}
+
+func isParam(seg string) bool {
+	return strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
+
+func (s *spec) match(method, path string) (*operation, bool) {
+	segs := strings.Split(strings.Trim(strings.TrimPrefix(path, s.cfg.BasePath), "/"), "/")
+	for i := range s.ops {
+		op := &s.ops[i]
+		if op.method != method || len(op.segments) != len(segs) {
+			continue
+		}
+
+		ok := true
+		for j, seg := range op.segments {
+			if !isParam(seg) && seg != segs[j] || isParam(seg) && segs[j] == "" {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return op, true
+		}
+	}
+
+	return nil, false
+}
+
+// responseFor picks the documented response: the exact status, then its class (2XX), then default.
+func (op *operation) responseFor(status int) (*response, bool) {
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+		if r, ok := op.responses[key]; ok {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+// Check validates resp against the contract of its route. Mismatches are logged and counted; the returned
+// error is non-nil only when the route enforces its contract. Bodies over max_body_bytes are not validated.
+func (v *Validator) Check(resp *http.Response) error {
+	if v == nil {
+		return nil
+	}
+
+	req := resp.Request
+	rt, ok := routes.FromContext(req.Context())
+	if !ok {
+		return nil
+	}
+	s, ok := v.specs[rt.Path]
+	if !ok {
+		return nil
+	}
+
+	reason, detail := s.check(resp)
+	if reason == "" {
+		return nil
+	}
+
+	v.metrics.IncContractMismatch(rt.Path, reason)
+	log.Warn().Str("route", rt.Path).Str("method", req.Method).Str("path", req.URL.Path).
+		Int("status", resp.StatusCode).Str("reason", reason).Str("detail", detail).
+		Msg("upstream response violates contract")
+
+	if !s.cfg.Enforce {
+		return nil
+	}
+
+	return &MismatchError{Route: rt.Path, Reason: reason, Detail: detail}
+}
+
+func (s *spec) check(resp *http.Response) (reason, detail string) {
+	req := resp.Request
+
+	op, ok := s.match(req.Method, req.URL.Path)
+	if !ok {
+		return reasonOperation, req.Method + " " + req.URL.Path
+	}
+
+	r, ok := op.responseFor(resp.StatusCode)
+	if !ok {
+		return reasonStatus, strconv.Itoa(resp.StatusCode)
+	}
+
+	if len(r.Content) == 0 || req.Method == http.MethodHead ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return "", ""
+	}
+
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	media, ok := r.Content[ct]
+	if !ok {
+		if media, ok = r.Content[strings.SplitN(ct, "/", 2)[0]+"/*"]; !ok {
+			if media, ok = r.Content["*/*"]; !ok {
+				return reasonContentType, ct
+			}
+		}
+	}
+
+	if media.Schema == nil || !isJSON(ct) {
+		return "", ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, s.cfg.MaxBodyBytes+1))
+	if int64(len(body)) > s.cfg.MaxBodyBytes || err != nil {
+		resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return "", ""
+	}
+	resp.Body = readCloser{Reader: bytes.NewReader(body), Closer: resp.Body}
+
+	// the client's Accept-Encoding goes upstream, so bodies may be compressed; only gzip is decoded
+	switch ce := resp.Header.Get("Content-Encoding"); {
+	case ce == "" || strings.EqualFold(ce, "identity"):
+	case strings.EqualFold(ce, "gzip"):
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return reasonBody, "invalid gzip: " + err.Error()
+		}
+		if body, err = io.ReadAll(io.LimitReader(zr, s.cfg.MaxBodyBytes+1)); err != nil {
+			return reasonBody, "invalid gzip: " + err.Error()
+		}
+		if int64(len(body)) > s.cfg.MaxBodyBytes {
+			return "", ""
+		}
+	default:
+		return "", ""
+	}
+
+	var val any
+	if err := json.Unmarshal(body, &val); err != nil {
+		return reasonBody, "invalid JSON: " + err.Error()
+	}
+	if err := media.Schema.validate(val, "$", s.defs); err != nil {
+		return reasonBody, err.Error()
+	}
+
+	return "", ""
+}
+
+func isJSON(ct string) bool {
+	return ct == "application/json" || strings.HasSuffix(ct, "+json")
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,197 @@
+package contract
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/routes"
+)
+
+const testSpec = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/users/{id}": {
+      "parameters": [{"name": "id", "in": "path"}],
+      "get": {
+        "responses": {
+          "200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "4XX": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/users/me": {
+      "get": {"responses": {"204": {"description": "no content"}}}
+    }
+  },
+  "components": {
+    "schemas": {
+      "User": {
+        "type": "object",
+        "required": ["id", "name"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "integer", "minimum": 1},
+          "name": {"type": "string", "minLength": 1},
+          "role": {"type": "string", "enum": ["admin", "member"]},
+          "tags": {"type": "array", "items": {"type": "string"}},
+          "manager": {"allOf": [{"$ref": "#/components/schemas/User"}], "nullable": true}
+        }
+      }
+    },
+    "responses": {
+      "Error": {"content": {"application/json": {"schema": {"type": "object", "required": ["error"]}}}}
+    }
+  }
+}`
+
+func newTestValidator(t *testing.T, enforce bool) (*Validator, *config.Route) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	if err := os.WriteFile(path, []byte(testSpec), 0o600); err != nil {
+		t.Fatalf("write spec: %v", err)
+	}
+
+	rs := []config.Route{{
+		Path:     "/api/v1/users*",
+		Contract: &config.Contract{Spec: path, BasePath: "/api/v1", Enforce: enforce, MaxBodyBytes: 1 << 10},
+	}}
+	v, err := New(rs, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	return v, &rs[0]
+}
+
+func upstreamResponse(rt *config.Route, method, path string, status int, ct, body string) *http.Response {
+	req := httptest.NewRequest(method, path, nil)
+	req = req.WithContext(routes.WithRoute(req.Context(), rt))
+
+	h := http.Header{}
+	if ct != "" {
+		h.Set("Content-Type", ct)
+	}
+
+	return &http.Response{StatusCode: status, Header: h, Body: io.NopCloser(strings.NewReader(body)), Request: req}
+}
+
+func TestValidator_Check(t *testing.T) {
+	v, rt := newTestValidator(t, true)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		ct     string
+		body   string
+		reason string
+	}{
+		{"valid", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": 7, "name": "ann", "tags": ["a"]}`, ""},
+		{"nested ref", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": 7, "name": "ann", "manager": {"id": 1, "name": "bo"}}`, ""},
+		{"nullable", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": 7, "name": "ann", "manager": null}`, ""},
+		{"literal path wins", http.MethodGet, "/api/v1/users/me", 204, "", "", ""},
+		{"response ref by class", http.MethodGet, "/api/v1/users/7", 404, "application/json", `{"error": "not found"}`, ""},
+		{"missing required", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": 7}`, reasonBody},
+		{"wrong type", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": 7.5, "name": "ann"}`, reasonBody},
+		{"enum", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": 7, "name": "ann", "role": "root"}`, reasonBody},
+		{"extra property", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": 7, "name": "ann", "x": 1}`, reasonBody},
+		{"nested violation", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": 7, "name": "ann", "manager": {"id": 0, "name": "bo"}}`, reasonBody},
+		{"invalid json", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{`, reasonBody},
+		{"undocumented status", http.MethodGet, "/api/v1/users/7", 500, "application/json", `{}`, reasonStatus},
+		{"undocumented content type", http.MethodGet, "/api/v1/users/7", 200, "text/html", `<html>`, reasonContentType},
+		{"undocumented operation", http.MethodDelete, "/api/v1/users/7", 200, "", "", reasonOperation},
+		{"oversized body passes", http.MethodGet, "/api/v1/users/7", 200, "application/json", `{"id": "` + strings.Repeat("x", 2<<10) + `"}`, ""},
+	}
+
+	for _, tt := range tests {
+		resp := upstreamResponse(rt, tt.method, tt.path, tt.status, tt.ct, tt.body)
+		err := v.Check(resp)
+
+		var me *MismatchError
+		switch {
+		case tt.reason == "" && err != nil:
+			t.Fatalf("%s: unexpected mismatch: %v", tt.name, err)
+		case tt.reason != "" && (!errors.As(err, &me) || me.Reason != tt.reason):
+			t.Fatalf("%s: err=%v want reason %s", tt.name, err, tt.reason)
+		}
+
+		if b, _ := io.ReadAll(resp.Body); string(b) != tt.body {
+			t.Fatalf("%s: body was not preserved", tt.name)
+		}
+	}
+}
+
+func TestValidator_CompressedBody(t *testing.T) {
+	v, rt := newTestValidator(t, true)
+
+	gz := func(s string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write([]byte(s))
+		_ = zw.Close()
+		return buf.String()
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     string
+		reason   string
+	}{
+		{"gzip valid", "gzip", gz(`{"id": 7, "name": "ann"}`), ""},
+		{"gzip violation", "gzip", gz(`{"id": 7}`), reasonBody},
+		{"gzip oversized passes", "gzip", gz(`{"id": "` + strings.Repeat("x", 2<<10) + `"}`), ""},
+		{"broken gzip", "gzip", "not gzip", reasonBody},
+		{"other encodings are not validated", "br", "\x0b\x02\x80", ""},
+	}
+
+	for _, tt := range tests {
+		resp := upstreamResponse(rt, http.MethodGet, "/api/v1/users/7", 200, "application/json", tt.body)
+		resp.Header.Set("Content-Encoding", tt.encoding)
+		err := v.Check(resp)
+
+		var me *MismatchError
+		switch {
+		case tt.reason == "" && err != nil:
+			t.Fatalf("%s: unexpected mismatch: %v", tt.name, err)
+		case tt.reason != "" && (!errors.As(err, &me) || me.Reason != tt.reason):
+			t.Fatalf("%s: err=%v want reason %s", tt.name, err, tt.reason)
+		}
+
+		// the client gets the encoded bytes it asked for
+		if b, _ := io.ReadAll(resp.Body); string(b) != tt.body {
+			t.Fatalf("%s: body was not preserved", tt.name)
+		}
+	}
+}
+
+func TestValidator_ReportOnly(t *testing.T) {
+	v, rt := newTestValidator(t, false)
+
+	if err := v.Check(upstreamResponse(rt, http.MethodGet, "/api/v1/users/7", 500, "", "")); err != nil {
+		t.Fatalf("report-only contract must not fail the response: %v", err)
+	}
+}
+
+func TestNew_RejectsUnresolvedRef(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	spec := `{"paths": {"/x": {"get": {"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Nope"}}}}}}}}}`
+	if err := os.WriteFile(path, []byte(spec), 0o600); err != nil {
+		t.Fatalf("write spec: %v", err)
+	}
+
+	if _, err := New([]config.Route{{Path: "/x", Contract: &config.Contract{Spec: path}}}, nil); err == nil {
+		t.Fatalf("expected error for unresolved $ref")
+	}
+}
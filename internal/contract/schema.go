@@ -0,0 +1,212 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Schema is the subset of the OpenAPI 3.0 schema object the validator understands. Unknown keywords
+// (format, pattern, discriminator, ...) are ignored, so a document never fails validation because of them.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []any              `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"` // false or a schema
+	Items                *Schema            `json:"items"`
+	AllOf                []*Schema          `json:"allOf"`
+	AnyOf                []*Schema          `json:"anyOf"`
+	OneOf                []*Schema          `json:"oneOf"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+
+	additional *Schema
+	closed     bool
+}
+
+// resolve links $refs and parses additionalProperties, once per schema.
+func (s *Schema) resolve(defs map[string]*Schema, seen map[*Schema]bool) error {
+	if s == nil || seen[s] {
+		return nil
+	}
+	seen[s] = true
+
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok || defs[name] == nil {
+			return fmt.Errorf("unresolved $ref %q", s.Ref)
+		}
+	}
+
+	switch raw := strings.TrimSpace(string(s.AdditionalProperties)); raw {
+	case "", "true":
+	case "false":
+		s.closed = true
+	default:
+		s.additional = &Schema{}
+		if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+			return fmt.Errorf("additionalProperties: %w", err)
+		}
+	}
+
+	children := []*Schema{s.Items, s.additional}
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	children = append(children, s.AllOf...)
+	children = append(children, s.AnyOf...)
+	children = append(children, s.OneOf...)
+	for _, c := range children {
+		if err := c.resolve(defs, seen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validate checks v (as decoded by encoding/json into any) against s and reports the first violation
+// with its JSON path.
+func (s *Schema) validate(v any, path string, defs map[string]*Schema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return defs[strings.TrimPrefix(s.Ref, "#/components/schemas/")].validate(v, path, defs)
+	}
+
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", path)
+	}
+
+	if err := checkType(s.Type, v, path); err != nil {
+		return err
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		return fmt.Errorf("%s: value is not one of the enum values", path)
+	}
+
+	switch val := v.(type) {
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			return fmt.Errorf("%s: %v is below minimum %v", path, val, *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			return fmt.Errorf("%s: %v is above maximum %v", path, val, *s.Maximum)
+		}
+	case string:
+		n := len([]rune(val))
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s: shorter than minLength %d", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: longer than maxLength %d", path, *s.MaxLength)
+		}
+	case []any:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			return fmt.Errorf("%s: fewer than minItems %d", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			return fmt.Errorf("%s: more than maxItems %d", path, *s.MaxItems)
+		}
+		for i, item := range val {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), defs); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, pv := range val {
+			ps, ok := s.Properties[name]
+			switch {
+			case ok:
+			case s.closed:
+				return fmt.Errorf("%s: unexpected property %q", path, name)
+			default:
+				ps = s.additional
+			}
+			if err := ps.validate(pv, path+"."+name, defs); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		if err := sub.validate(v, path, defs); err != nil {
+			return err
+		}
+	}
+
+	if len(s.AnyOf) > 0 && matching(s.AnyOf, v, path, defs) == 0 {
+		return fmt.Errorf("%s: matches none of anyOf", path)
+	}
+	if len(s.OneOf) > 0 && matching(s.OneOf, v, path, defs) != 1 {
+		return fmt.Errorf("%s: does not match exactly one of oneOf", path)
+	}
+
+	return nil
+}
+
+func matching(schemas []*Schema, v any, path string, defs map[string]*Schema) int {
+	n := 0
+	for _, sub := range schemas {
+		if sub.validate(v, path, defs) == nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func checkType(typ string, v any, path string) error {
+	ok := true
+	switch typ {
+	case "":
+	case "object":
+		_, ok = v.(map[string]any)
+	case "array":
+		_, ok = v.([]any)
+	case "string":
+		_, ok = v.(string)
+	case "boolean":
+		_, ok = v.(bool)
+	case "number":
+		_, ok = v.(float64)
+	case "integer":
+		f, isNum := v.(float64)
+		ok = isNum && f == math.Trunc(f)
+	}
+
+	if !ok {
+		return fmt.Errorf("%s: expected %s", path, typ)
+	}
+
+	return nil
+}
+
+func inEnum(enum []any, v any) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+
+	return false
+}
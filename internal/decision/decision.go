@@ -0,0 +1,193 @@
+// Package decision collects what each layer decided about a request and logs it as one line,
+// so a single "request decision" entry answers most "why was this request rejected" questions.
+package decision
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// Auth outcomes.
+const (
+	AuthAllowed            = "allowed"
+	AuthExempt             = "exempt"
+	AuthProbe              = "probe"
+	AuthSignedURL          = "signed_url"
+	AuthFailedOpen         = "failed_open"
+	AuthMissingToken       = "missing_token"
+	AuthInvalidToken       = "invalid_token"
+	AuthInvalidSignature   = "invalid_signature"
+	AuthExpired            = "expired"
+	AuthRevoked            = "revoked"
+	AuthForbiddenRoute     = "forbidden_route"
+	AuthUnknownToken       = "unknown_token"
+	AuthPaused             = "paused"
+	AuthBlocked            = "blocked"
+	AuthDisabled           = "disabled"
+	AuthNoLimit            = "no_limit"
+	AuthRateLimited        = "rate_limited"
+	AuthBackendUnavailable = "backend_unavailable"
+	AuthLimiterError       = "limiter_error"
+)
+
+// Decision is filled in by the layers a request passes through. The handler chain runs on one goroutine,
+// so it is not synchronized. All setters are no-ops on a nil Decision (requests outside Middleware).
+type Decision struct {
+	Auth        string
+	Reason      string
+	APIKey      string
+	Limit       int
+	LimitSource string
+	Count       int64
+	Upstream    string
+	// DryRun marks Auth as a denial that was only recorded, not enforced.
+	DryRun bool
+
+	// Claims are the redacted token claims, set only at debug level.
+	Claims map[string]any
+
+	// Experiments maps experiment names to the caller's bucket.
+	Experiments map[string]string
+
+	// Risk is the bot risk score of the request, with the signals behind it; RiskSignals is nil when unscored.
+	Risk        int
+	RiskSignals []string
+}
+
+type ctxKey struct{}
+
+func FromContext(ctx context.Context) *Decision {
+	d, _ := ctx.Value(ctxKey{}).(*Decision)
+	return d
+}
+
+func (d *Decision) SetAuth(outcome, reason string) {
+	if d == nil {
+		return
+	}
+
+	d.Auth, d.Reason = outcome, reason
+}
+
+func (d *Decision) SetAPIKey(apiKey string) {
+	if d == nil {
+		return
+	}
+
+	d.APIKey = apiKey
+}
+
+func (d *Decision) SetLimit(limit int, source string) {
+	if d == nil {
+		return
+	}
+
+	d.Limit, d.LimitSource = limit, source
+}
+
+// SetCount records the rate-limit counter value after this request was counted.
+func (d *Decision) SetCount(n int64) {
+	if d == nil {
+		return
+	}
+
+	d.Count = n
+}
+
+// SetClaims records token claims for debugging; callers must pass them through auth.LogRedactor.
+func (d *Decision) SetClaims(claims map[string]any) {
+	if d == nil {
+		return
+	}
+
+	d.Claims = claims
+}
+
+// SetDryRun marks the recorded denial as not enforced.
+func (d *Decision) SetDryRun() {
+	if d == nil {
+		return
+	}
+
+	d.DryRun = true
+}
+
+// SetExperiment records the bucket the caller was assigned in an experiment.
+func (d *Decision) SetExperiment(name, bucket string) {
+	if d == nil {
+		return
+	}
+
+	if d.Experiments == nil {
+		d.Experiments = map[string]string{}
+	}
+	d.Experiments[name] = bucket
+}
+
+// SetRisk records the bot risk score of the request and the signals that raised it.
+func (d *Decision) SetRisk(score int, signals []string) {
+	if d == nil {
+		return
+	}
+
+	d.Risk, d.RiskSignals = score, signals
+}
+
+func (d *Decision) SetUpstream(upstream string) {
+	if d == nil {
+		return
+	}
+
+	d.Upstream = upstream
+}
+
+// Middleware logs the decision line once the request completes. It must run after the route table
+// middleware to report the matched route.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		d := &Decision{}
+		recorder := &mp.StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), ctxKey{}, d)))
+
+		route := ""
+		if rt, ok := routes.FromContext(r.Context()); ok {
+			route = rt.Path
+		}
+
+		ev := log.Info()
+		if d.Claims != nil {
+			ev = ev.Interface("claims", d.Claims)
+		}
+		if d.Experiments != nil {
+			ev = ev.Interface("experiments", d.Experiments)
+		}
+		if d.RiskSignals != nil {
+			ev = ev.Int("risk", d.Risk).Strs("risk_signals", d.RiskSignals)
+		}
+		ev.
+			Str("request_id", middleware.GetReqID(r.Context())).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("route", route).
+			Str("auth", d.Auth).
+			Str("reason", d.Reason).
+			Bool("dry_run", d.DryRun).
+			Str("api_key", d.APIKey).
+			Int("limit", d.Limit).
+			Str("limit_source", d.LimitSource).
+			Int64("count", d.Count).
+			Str("upstream", d.Upstream).
+			Int("status", recorder.Status).
+			Dur("duration", time.Since(start)).
+			Msg("request decision")
+	})
+}
@@ -0,0 +1,64 @@
+package decision
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/routes"
+)
+
+func TestMiddleware_LogsOneDecisionLine(t *testing.T) {
+	var buf bytes.Buffer
+	prev := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = prev })
+
+	table := routes.NewTable([]config.Route{{Path: "/api/v1/orders*"}})
+	h := table.Middleware(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := FromContext(r.Context())
+		d.SetAPIKey("k1")
+		d.SetLimit(10, "route")
+		d.SetCount(11)
+		d.SetAuth(AuthRateLimited, "")
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	})))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/orders/1", nil))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("lines=%d want=1: %s", len(lines), buf.Bytes())
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	want := map[string]any{
+		"message": "request decision", "route": "/api/v1/orders*", "auth": AuthRateLimited, "api_key": "k1",
+		"limit": float64(10), "limit_source": "route", "count": float64(11), "status": float64(429),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s=%v want=%v", k, got[k], v)
+		}
+	}
+}
+
+func TestDecision_NilSafe(t *testing.T) {
+	var d *Decision
+	d.SetAuth(AuthAllowed, "")
+	d.SetCount(1)
+
+	if FromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()) != nil {
+		t.Fatalf("expected no decision outside Middleware")
+	}
+}
@@ -0,0 +1,122 @@
+// Package deprecation announces deprecated routes to clients and records which api keys still call them,
+// as data for retirement communications.
+package deprecation
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"tyk-proxy/internal/auth"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// KeyUsage is how often an api key called a deprecated route on this instance.
+type KeyUsage struct {
+	APIKey   string    `json:"api_key"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// RouteUsage lists the callers of a deprecated route, busiest first.
+type RouteUsage struct {
+	Route  string     `json:"route"`
+	Sunset time.Time  `json:"sunset,omitzero"`
+	Keys   []KeyUsage `json:"keys"`
+}
+
+type route struct {
+	sunset time.Time
+	keys   map[string]*KeyUsage
+}
+
+// Tracker is per proxy instance; counts start over on restart.
+type Tracker struct {
+	mu     sync.Mutex
+	routes map[string]*route
+
+	metrics *mp.Metrics
+	now     func() time.Time
+}
+
+func New(metrics *mp.Metrics) *Tracker {
+	return &Tracker{routes: map[string]*route{}, metrics: metrics, now: time.Now}
+}
+
+// Middleware sets the deprecation headers of the matched route and counts the call. It must run after auth
+// to attribute calls to api keys.
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := routes.FromContext(r.Context())
+		if !ok || rt.Deprecation == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		d := rt.Deprecation
+		h := w.Header()
+		h.Set("Deprecation", "@"+strconv.FormatInt(d.Date.Unix(), 10))
+		if !d.Sunset.IsZero() {
+			h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Link != "" {
+			h.Add("Link", "<"+d.Link+`>; rel="deprecation"; type="text/html"`)
+		}
+
+		tok, _ := auth.TokenFromContext(r.Context())
+		t.record(rt.Path, d.Sunset, tok.APIKey)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *Tracker) record(path string, sunset time.Time, apiKey string) {
+	t.metrics.IncDeprecatedRequest(path)
+	if apiKey == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rt, ok := t.routes[path]
+	if !ok {
+		rt = &route{sunset: sunset, keys: map[string]*KeyUsage{}}
+		t.routes[path] = rt
+	}
+
+	u, ok := rt.keys[apiKey]
+	if !ok {
+		u = &KeyUsage{APIKey: apiKey}
+		rt.keys[apiKey] = u
+	}
+	u.Count++
+	u.LastSeen = t.now()
+}
+
+// Snapshot returns the usage of every deprecated route called since start, by route path.
+func (t *Tracker) Snapshot() []RouteUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]RouteUsage, 0, len(t.routes))
+	for path, rt := range t.routes {
+		ru := RouteUsage{Route: path, Sunset: rt.sunset, Keys: make([]KeyUsage, 0, len(rt.keys))}
+		for _, u := range rt.keys {
+			ru.Keys = append(ru.Keys, *u)
+		}
+		sort.Slice(ru.Keys, func(i, j int) bool {
+			if ru.Keys[i].Count != ru.Keys[j].Count {
+				return ru.Keys[i].Count > ru.Keys[j].Count
+			}
+			return ru.Keys[i].APIKey < ru.Keys[j].APIKey
+		})
+		out = append(out, ru)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Route < out[j].Route })
+
+	return out
+}
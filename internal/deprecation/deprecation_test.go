@@ -0,0 +1,106 @@
+package deprecation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/store"
+)
+
+func serve(tr *Tracker, rt *config.Route, apiKey string) *httptest.ResponseRecorder {
+	h := tr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/legacy", nil)
+	ctx := routes.WithRoute(req.Context(), rt)
+	if apiKey != "" {
+		ctx = auth.WithToken(ctx, store.Token{APIKey: apiKey})
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req.WithContext(ctx))
+	return rr
+}
+
+func TestMiddleware_Headers(t *testing.T) {
+	date := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		route       *config.Route
+		deprecation string
+		sunset      string
+		link        string
+	}{
+		{
+			name:  "not deprecated",
+			route: &config.Route{Path: "/api/v1/legacy"},
+		},
+		{
+			name:        "date only",
+			route:       &config.Route{Path: "/api/v1/legacy", Deprecation: &config.Deprecation{Date: date}},
+			deprecation: "@1767225600",
+		},
+		{
+			name: "sunset and link",
+			route: &config.Route{Path: "/api/v1/legacy", Deprecation: &config.Deprecation{
+				Date: date, Sunset: sunset, Link: "https://docs.example.com/migrate",
+			}},
+			deprecation: "@1767225600",
+			sunset:      "Thu, 31 Dec 2026 00:00:00 GMT",
+			link:        `<https://docs.example.com/migrate>; rel="deprecation"; type="text/html"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(New(nil), tt.route, "k1")
+
+			if got := rr.Header().Get("Deprecation"); got != tt.deprecation {
+				t.Fatalf("Deprecation=%q want=%q", got, tt.deprecation)
+			}
+			if got := rr.Header().Get("Sunset"); got != tt.sunset {
+				t.Fatalf("Sunset=%q want=%q", got, tt.sunset)
+			}
+			if got := rr.Header().Get("Link"); got != tt.link {
+				t.Fatalf("Link=%q want=%q", got, tt.link)
+			}
+		})
+	}
+}
+
+func TestTracker_Snapshot(t *testing.T) {
+	tr := New(nil)
+	now := time.Unix(1000, 0)
+	tr.now = func() time.Time { return now }
+
+	legacy := &config.Route{Path: "/api/v1/legacy", Deprecation: &config.Deprecation{Date: time.Unix(0, 0)}}
+	old := &config.Route{Path: "/api/v1/old", Deprecation: &config.Deprecation{Date: time.Unix(0, 0)}}
+
+	serve(tr, old, "k1")
+	serve(tr, legacy, "k1")
+	serve(tr, legacy, "k2")
+	now = now.Add(time.Second)
+	serve(tr, legacy, "k2")
+	serve(tr, legacy, "")
+	serve(tr, &config.Route{Path: "/api/v1/current"}, "k3")
+
+	got := tr.Snapshot()
+	if len(got) != 2 || got[0].Route != "/api/v1/legacy" || got[1].Route != "/api/v1/old" {
+		t.Fatalf("snapshot=%+v want legacy and old routes", got)
+	}
+
+	keys := got[0].Keys
+	if len(keys) != 2 || keys[0].APIKey != "k2" || keys[0].Count != 2 || keys[1].APIKey != "k1" {
+		t.Fatalf("keys=%+v want k2 (2 calls) before k1", keys)
+	}
+	if !keys[0].LastSeen.Equal(now) {
+		t.Fatalf("last_seen=%v want=%v", keys[0].LastSeen, now)
+	}
+}
@@ -0,0 +1,123 @@
+// Package experiment assigns callers to A/B experiment buckets at the edge, so the upstream, the logs and
+// the metrics agree on every caller's bucket.
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"net/http"
+	"strings"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// Header carries the assignments upstream as name=bucket pairs, e.g. "checkout=b, search=control".
+// A value sent by the client is replaced, so callers cannot pick their own bucket.
+const Header = "X-Experiment-Bucket"
+
+type Assigner struct {
+	experiments []config.Experiment
+	metrics     *mp.Metrics
+}
+
+// New returns nil without experiments; the nil Assigner's Middleware passes requests through.
+func New(experiments []config.Experiment, metrics *mp.Metrics) *Assigner {
+	if len(experiments) == 0 {
+		return nil
+	}
+
+	return &Assigner{experiments: experiments, metrics: metrics}
+}
+
+// Middleware assigns the caller's buckets. It must run after auth, which identifies the caller.
+func (a *Assigner) Middleware(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(Header)
+
+		var pairs []string
+		for _, e := range a.experiments {
+			if !matchesRoute(e.Routes, r.URL.Path) {
+				continue
+			}
+			id := identity(r, e.Key)
+			if id == "" {
+				continue
+			}
+
+			bucket := Bucket(e, id)
+			pairs = append(pairs, e.Name+"="+bucket)
+			decision.FromContext(r.Context()).SetExperiment(e.Name, bucket)
+			a.metrics.IncExperiment(e.Name, bucket)
+		}
+		if len(pairs) > 0 {
+			r.Header.Set(Header, strings.Join(pairs, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Bucket returns the bucket of the caller with identity id. The hash is salted with the experiment name,
+// so a caller's buckets in different experiments are independent.
+func Bucket(e config.Experiment, id string) string {
+	total := 0
+	for _, b := range e.Buckets {
+		total += b.Weight
+	}
+
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + id))
+	point := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, b := range e.Buckets {
+		if point < b.Weight {
+			return b.Name
+		}
+		point -= b.Weight
+	}
+
+	return e.Buckets[len(e.Buckets)-1].Name // unreachable with validated weights
+}
+
+func matchesRoute(patterns []string, path string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if routes.MatchPattern(p, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// identity returns what the caller is bucketed by, empty when the request does not carry it.
+func identity(r *http.Request, key string) string {
+	if name, ok := strings.CutPrefix(key, config.ExperimentKeyHeaderPrefix); ok {
+		return r.Header.Get(name)
+	}
+
+	switch key {
+	case config.ExperimentKeySubject:
+		if c, ok := auth.ClaimsFromContext(r.Context()); ok {
+			return c.Subject
+		}
+	case config.ExperimentKeyTenant:
+		if t, ok := auth.TokenFromContext(r.Context()); ok {
+			return t.Tenant
+		}
+	default:
+		if c, ok := auth.ClaimsFromContext(r.Context()); ok {
+			return c.APIKey
+		}
+	}
+
+	return ""
+}
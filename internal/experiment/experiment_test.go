@@ -0,0 +1,97 @@
+package experiment
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/config"
+)
+
+func TestBucket_Weights(t *testing.T) {
+	e := config.Experiment{Name: "checkout", Buckets: []config.ExperimentBucket{
+		{Name: "control", Weight: 3}, {Name: "b", Weight: 1}, {Name: "off", Weight: 0},
+	}}
+
+	counts := map[string]int{}
+	for i := range 10000 {
+		id := fmt.Sprintf("key-%d", i)
+		b := Bucket(e, id)
+		if Bucket(e, id) != b {
+			t.Fatalf("bucket of %s not stable", id)
+		}
+		counts[b]++
+	}
+
+	if counts["off"] != 0 {
+		t.Fatalf("counts=%v want none in the zero-weight bucket", counts)
+	}
+	if share := float64(counts["control"]) / 10000; share < 0.72 || share > 0.78 {
+		t.Fatalf("control share=%.3f want about 0.75", share)
+	}
+}
+
+func TestBucket_IndependentExperiments(t *testing.T) {
+	buckets := []config.ExperimentBucket{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}
+	e1 := config.Experiment{Name: "one", Buckets: buckets}
+	e2 := config.Experiment{Name: "two", Buckets: buckets}
+
+	same := 0
+	for i := range 1000 {
+		id := fmt.Sprintf("key-%d", i)
+		if Bucket(e1, id) == Bucket(e2, id) {
+			same++
+		}
+	}
+	if same < 400 || same > 600 {
+		t.Fatalf("same=%d of 1000 want about half: experiments must not share assignments", same)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	buckets := []config.ExperimentBucket{{Name: "only", Weight: 1}}
+	a := New([]config.Experiment{
+		{Name: "checkout", Key: config.ExperimentKeyAPIKey, Routes: []string{"/api/v1/orders*"}, Buckets: buckets},
+		{Name: "search", Key: config.ExperimentKeySubject, Buckets: buckets},
+		{Name: "ui", Key: "header:X-User-ID", Buckets: buckets},
+	}, nil)
+
+	var got string
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(Header)
+	}))
+
+	tests := []struct {
+		name    string
+		path    string
+		subject string
+		userID  string
+		want    string
+	}{
+		{"route and subject", "/api/v1/orders/1", "u1", "", "checkout=only, search=only"},
+		{"other route", "/api/v1/users", "u1", "", "search=only"},
+		{"no subject", "/api/v1/users", "", "", ""},
+		{"header identity", "/api/v1/users", "", "42", "ui=only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(Header, "checkout=spoofed")
+			if tt.userID != "" {
+				req.Header.Set("X-User-ID", tt.userID)
+			}
+			claims := &auth.Claims{APIKey: "k", RegisteredClaims: jwt.RegisteredClaims{Subject: tt.subject}}
+			req = req.WithContext(auth.WithClaims(req.Context(), claims))
+
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Fatalf("%s=%q want %q", Header, got, tt.want)
+			}
+		})
+	}
+}
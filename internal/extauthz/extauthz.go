@@ -0,0 +1,129 @@
+package extauthz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+const authorizerName = "ext_authz"
+
+// APIKeyHeader carries the authenticated api_key to the authorization service.
+const APIKeyHeader = "X-Api-Key"
+
+type decision struct {
+	allowed bool
+	status  int
+	headers http.Header
+}
+
+type Service struct {
+	httpc   *http.Client
+	metrics *mp.Metrics
+}
+
+func New(metrics *mp.Metrics) *Service {
+	return &Service{
+		httpc:   &http.Client{},
+		metrics: metrics,
+	}
+}
+
+func (s *Service) check(ctx context.Context, cfg *config.ExtAuthz, r *http.Request) (decision, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	// as sent, so the authorizer decides on the resource the upstream gets
+	target := strings.TrimSuffix(cfg.URL, "/") + r.URL.EscapedPath()
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, target, nil)
+	if err != nil {
+		return decision{}, fmt.Errorf("ext_authz: build request: %w", err)
+	}
+
+	for _, h := range cfg.ForwardHeaders {
+		for _, v := range r.Header.Values(h) {
+			req.Header.Add(h, v)
+		}
+	}
+
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		req.Header.Set(APIKeyHeader, claims.APIKey)
+	}
+
+	resp, err := s.httpc.Do(req)
+	if err != nil {
+		return decision{}, fmt.Errorf("ext_authz: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return decision{allowed: true, status: resp.StatusCode, headers: resp.Header}, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return decision{allowed: false, status: resp.StatusCode}, nil
+	default:
+		return decision{}, fmt.Errorf("ext_authz: unexpected status %d", resp.StatusCode)
+	}
+}
+
+// Handler calls the route's ext_authz service, if configured. It must run after the
+// route and auth middlewares.
+func (s *Service) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := routes.FromContext(r.Context())
+		if !ok || rt.ExtAuthz == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cfg := rt.ExtAuthz
+		d, err := s.check(r.Context(), cfg, r)
+		if err != nil {
+			s.metrics.IncAuthzDecision(authorizerName, "error")
+			log.Error().Err(err).Str("route", rt.Path).Msg("ext_authz check failed")
+
+			if cfg.FailPolicy != config.FailPolicyOpen {
+				gwerr.Write(w, s.metrics, gwerr.ErrAuthUnavailable)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !d.allowed {
+			s.metrics.IncAuthzDecision(authorizerName, "deny")
+			log.Debug().Str("route", rt.Path).Int("status", d.status).Msg("denied by ext_authz")
+			gwerr.Write(w, s.metrics, gwerr.ErrDenied.WithStatus(d.status))
+			return
+		}
+
+		s.metrics.IncAuthzDecision(authorizerName, "allow")
+		mergeHeaders(r.Header, d.headers, cfg.UpstreamHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mergeHeaders copies the allowed headers of the authorization response into the upstream request; with none
+// allowed nothing is copied.
+func mergeHeaders(dst, src http.Header, allow []string) {
+	for _, h := range allow {
+		if vs := src.Values(h); len(vs) > 0 {
+			dst[http.CanonicalHeaderKey(h)] = append([]string(nil), vs...)
+		}
+	}
+}
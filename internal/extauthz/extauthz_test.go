@@ -0,0 +1,142 @@
+package extauthz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/routes"
+)
+
+func TestHandler_AllowMergesHeaders(t *testing.T) {
+	authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/check/api/v1/orders" {
+			t.Errorf("unexpected authz path %q", r.URL.Path)
+		}
+		if r.Header.Get("X-Tenant") != "acme" {
+			t.Errorf("forwarded header missing")
+		}
+		if r.Header.Get("Cookie") != "" {
+			t.Errorf("non-listed header must not be forwarded")
+		}
+		w.Header().Set("X-User-Id", "42")
+		w.Header().Set("X-Internal", "secret")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authSrv.Close()
+
+	tbl := routes.NewTable([]config.Route{{
+		Path: "/api/v1/orders*",
+		ExtAuthz: &config.ExtAuthz{
+			URL:             authSrv.URL + "/check",
+			Timeout:         time.Second,
+			ForwardHeaders:  []string{"X-Tenant"},
+			UpstreamHeaders: []string{"X-User-Id"},
+		},
+	}})
+
+	var got http.Header
+	h := tbl.Middleware(New(nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/orders", nil)
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("Cookie", "a=b")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusOK)
+	}
+	if got.Get("X-User-Id") != "42" {
+		t.Fatalf("expected X-User-Id merged into upstream request")
+	}
+	if got.Get("X-Internal") != "" {
+		t.Fatalf("non-allowlisted header must not be merged")
+	}
+}
+
+func TestHandler_PathAsSent(t *testing.T) {
+	var gotPath, gotQuery string
+	authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.EscapedPath(), r.URL.RawQuery
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authSrv.Close()
+
+	tbl := routes.NewTable([]config.Route{{
+		Path:     "/api/v1/files*",
+		ExtAuthz: &config.ExtAuthz{URL: authSrv.URL + "/check/", Timeout: time.Second},
+	}})
+	h := tbl.Middleware(New(nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/v1/files/a%2Fb?owner=acme&v=2", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusOK)
+	}
+	if gotPath != "/check/api/v1/files/a%2Fb" || gotQuery != "owner=acme&v=2" {
+		t.Fatalf("authz path=%q query=%q want the encoded slash and the query", gotPath, gotQuery)
+	}
+}
+
+func TestMergeHeaders(t *testing.T) {
+	src := http.Header{"X-User-Id": {"42"}, "X-Roles": {"a", "b"}, "Set-Cookie": {"s=1"}}
+
+	dst := http.Header{"X-User-Id": {"spoofed"}}
+	mergeHeaders(dst, src, nil)
+	if len(dst) != 1 || dst.Get("X-User-Id") != "spoofed" {
+		t.Fatalf("headers=%v want none merged without upstream_headers", dst)
+	}
+
+	mergeHeaders(dst, src, []string{"x-user-id", "X-Roles", "X-Missing"})
+	if dst.Get("X-User-Id") != "42" || len(dst.Values("X-Roles")) != 2 || dst.Get("Set-Cookie") != "" || len(dst) != 2 {
+		t.Fatalf("headers=%v want only the listed ones merged", dst)
+	}
+}
+
+func TestHandler_DenyAndFailPolicy(t *testing.T) {
+	authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/denied":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer authSrv.Close()
+
+	tests := []struct {
+		path   string
+		policy string
+		want   int
+	}{
+		{"/api/v1/denied", config.FailPolicyClosed, http.StatusForbidden},
+		{"/api/v1/broken", config.FailPolicyClosed, http.StatusServiceUnavailable},
+		{"/api/v1/broken", config.FailPolicyOpen, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		tbl := routes.NewTable([]config.Route{{
+			Path:     "*",
+			ExtAuthz: &config.ExtAuthz{URL: authSrv.URL, Timeout: time.Second, FailPolicy: tt.policy},
+		}})
+		h := tbl.Middleware(New(nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example"+tt.path, nil))
+		if rr.Code != tt.want {
+			t.Fatalf("path=%s policy=%s status=%d want=%d", tt.path, tt.policy, rr.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package flags
+
+import (
+	"slices"
+	"sync"
+
+	"tyk-proxy/internal/config"
+)
+
+// Set holds feature flags that can be flipped at runtime. A route-level value overrides the global one.
+type Set struct {
+	mu     sync.RWMutex
+	global map[string]bool
+	routes map[string]map[string]bool // route path -> flag -> enabled
+	paths  map[string]bool            // configured route paths
+}
+
+// Snapshot is a point-in-time copy of all flag values.
+type Snapshot struct {
+	Global map[string]bool            `json:"global"`
+	Routes map[string]map[string]bool `json:"routes,omitempty"`
+}
+
+func New(global map[string]bool, rs []config.Route) *Set {
+	s := &Set{
+		global: make(map[string]bool, len(config.KnownFlags)),
+		routes: map[string]map[string]bool{},
+		paths:  make(map[string]bool, len(rs)),
+	}
+
+	for _, name := range config.KnownFlags {
+		s.global[name] = global[name]
+	}
+
+	for _, rt := range rs {
+		s.paths[rt.Path] = true
+		if len(rt.Flags) == 0 {
+			continue
+		}
+		m := make(map[string]bool, len(rt.Flags))
+		for name, v := range rt.Flags {
+			m[name] = v
+		}
+		s.routes[rt.Path] = m
+	}
+
+	return s
+}
+
+// Known reports whether name is a supported flag.
+func Known(name string) bool {
+	return slices.Contains(config.KnownFlags, name)
+}
+
+// HasRoute reports whether route is the path of a configured route, so a flag can be set for it.
+func (s *Set) HasRoute(route string) bool {
+	return s.paths[route]
+}
+
+// Enabled reports the flag value for a route path (as configured in application.routes); "" means global.
+func (s *Set) Enabled(name, route string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if route != "" {
+		if v, ok := s.routes[route][name]; ok {
+			return v
+		}
+	}
+
+	return s.global[name]
+}
+
+// Set changes a flag globally (route "") or for a route and returns the previous effective value.
+func (s *Set) Set(name, route string, enabled bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if route == "" {
+		prev := s.global[name]
+		s.global[name] = enabled
+		return prev
+	}
+
+	prev, ok := s.routes[route][name]
+	if !ok {
+		prev = s.global[name]
+	}
+	if s.routes[route] == nil {
+		s.routes[route] = map[string]bool{}
+	}
+	s.routes[route][name] = enabled
+
+	return prev
+}
+
+func (s *Set) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := Snapshot{
+		Global: make(map[string]bool, len(s.global)),
+		Routes: make(map[string]map[string]bool, len(s.routes)),
+	}
+	for k, v := range s.global {
+		snap.Global[k] = v
+	}
+	for rt, m := range s.routes {
+		cp := make(map[string]bool, len(m))
+		for k, v := range m {
+			cp[k] = v
+		}
+		snap.Routes[rt] = cp
+	}
+
+	return snap
+}
@@ -0,0 +1,57 @@
+package flags
+
+import (
+	"testing"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestSet_RouteOverridesGlobal(t *testing.T) {
+	s := New(map[string]bool{config.FlagCache: true}, []config.Route{
+		{Path: "/api/v1/orders*", Flags: map[string]bool{config.FlagCache: false}},
+		{Path: "/api/v1/users*"},
+	})
+
+	if s.Enabled(config.FlagCache, "/api/v1/orders*") {
+		t.Fatal("route value should override the global one")
+	}
+	if !s.Enabled(config.FlagCache, "/api/v1/users*") || !s.Enabled(config.FlagCache, "") {
+		t.Fatal("routes without their own value should follow the global one")
+	}
+
+	if prev := s.Set(config.FlagCache, "/api/v1/users*", false); !prev {
+		t.Fatal("previous value of a route without its own should be the global one")
+	}
+	if prev := s.Set(config.FlagCache, "", false); !prev {
+		t.Fatal("previous global value should be true")
+	}
+	if s.Enabled(config.FlagCache, "/api/v1/users*") || s.Enabled(config.FlagCache, "") {
+		t.Fatal("flag should be disabled")
+	}
+
+	snap := s.Snapshot()
+	if snap.Global[config.FlagCache] || len(snap.Routes) != 2 {
+		t.Fatalf("snapshot=%+v", snap)
+	}
+	// the snapshot is a copy
+	snap.Routes["/api/v1/orders*"][config.FlagCache] = true
+	if s.Enabled(config.FlagCache, "/api/v1/orders*") {
+		t.Fatal("changing the snapshot must not change the set")
+	}
+}
+
+func TestSet_KnownAndRoutes(t *testing.T) {
+	s := New(nil, []config.Route{{Path: "/api/v1/orders*"}})
+
+	if !Known(config.FlagCache) || Known("compression") {
+		t.Fatal("only configured flag names are known")
+	}
+	if !s.HasRoute("/api/v1/orders*") || s.HasRoute("/api/v1/order*") || s.HasRoute("") {
+		t.Fatal("only configured route paths are known")
+	}
+
+	var unset *Set
+	if unset.Enabled(config.FlagCache, "") {
+		t.Fatal("a nil set has every flag disabled")
+	}
+}
@@ -0,0 +1,82 @@
+// Package gwerr defines the errors the gateway answers requests with itself. Every layer rejects through Write,
+// so a failure gets the same status and body wherever it is detected, and rejections are counted by reason.
+package gwerr
+
+import (
+	"net/http"
+
+	mp "tyk-proxy/internal/metrics"
+)
+
+// Error is a rejection: Reason labels it in metrics, Status and Message make the response.
+type Error struct {
+	Reason  string
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Reason + ": " + e.Message
+}
+
+// Is matches errors of the same reason, so errors.Is recognizes copies made by WithMessage and WithStatus.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Reason == e.Reason
+}
+
+// WithMessage returns a copy of e answering with msg.
+func (e *Error) WithMessage(msg string) *Error {
+	c := *e
+	c.Message = msg
+	return &c
+}
+
+// WithStatus returns a copy of e answering with status and its standard text.
+func (e *Error) WithStatus(status int) *Error {
+	c := *e
+	c.Status, c.Message = status, http.StatusText(status)
+	return &c
+}
+
+// Authentication and authorization.
+var (
+	ErrInvalidToken    = &Error{"invalid_token", http.StatusUnauthorized, "Unauthorized"}
+	ErrTokenPaused     = &Error{"token_paused", http.StatusForbidden, "token paused"}
+	ErrScope           = &Error{"scope", http.StatusForbidden, "Forbidden"}
+	ErrQuota           = &Error{"quota", http.StatusTooManyRequests, "Too Many Requests"}
+	ErrAuthUnavailable = &Error{"auth_unavailable", http.StatusServiceUnavailable, "authorization backend unavailable"}
+	ErrLimiter         = &Error{"limiter_error", http.StatusInternalServerError, "Rate limiter error"}
+	ErrDenied          = &Error{"denied", http.StatusForbidden, "Forbidden"} // by an external authorizer
+	ErrBlocked         = &Error{"blocked", http.StatusForbidden, "request blocked"}
+)
+
+// Requests the gateway does not accept.
+var (
+	ErrInvalidPath        = &Error{"invalid_path", http.StatusBadRequest, "invalid request path"}
+	ErrURITooLong         = &Error{"uri_too_long", http.StatusRequestURITooLong, "request URI too long"}
+	ErrTooManyQueryParams = &Error{"too_many_query_params", http.StatusBadRequest, "too many query parameters"}
+	ErrQueryParam         = &Error{"query_param", http.StatusBadRequest, "query parameter not allowed"}
+	ErrMethodNotAllowed   = &Error{"method_not_allowed", http.StatusMethodNotAllowed, "Method Not Allowed"}
+	ErrMethodOverride     = &Error{"method_override", http.StatusBadRequest, "method override not allowed"}
+	ErrHeader             = &Error{"header", http.StatusBadRequest, "required header missing"}
+	ErrVersion            = &Error{"version", http.StatusNotAcceptable, "unsupported API version"}
+	ErrInvalidBody        = &Error{"invalid_body", http.StatusBadRequest, "invalid compressed body"}
+	ErrBodyTooLarge       = &Error{"body_too_large", http.StatusRequestEntityTooLarge, "request body too large"}
+)
+
+// Upstream failures and load shedding.
+var (
+	ErrUpstreamTimeout    = &Error{"upstream_timeout", http.StatusGatewayTimeout, "gateway timeout"}
+	ErrUpstream           = &Error{"upstream_error", http.StatusBadGateway, "bad gateway"}
+	ErrUpstreamOverloaded = &Error{"upstream_overloaded", http.StatusServiceUnavailable, "upstream overloaded"}
+	ErrTooManyStreams     = &Error{"too_many_streams", http.StatusTooManyRequests, "too many open streams"}
+	ErrUpstreamConfig     = &Error{"upstream_config", http.StatusInternalServerError, "invalid upstream target"}
+)
+
+// Write answers the request with err and counts it in requests_rejected_total. Headers such as
+// WWW-Authenticate or Retry-After must be set before.
+func Write(w http.ResponseWriter, metrics *mp.Metrics, err *Error) {
+	metrics.IncRejected(err.Reason)
+	http.Error(w, err.Message, err.Status)
+}
@@ -0,0 +1,45 @@
+package gwerr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestError_Is(t *testing.T) {
+	err := fmt.Errorf("route check: %w", ErrVersion.WithMessage("unsupported API version: v9"))
+	if !errors.Is(err, ErrVersion) {
+		t.Fatalf("copy with another message must match its error")
+	}
+	if errors.Is(err, ErrQuota) {
+		t.Fatalf("errors of other reasons must not match")
+	}
+
+	denied := ErrDenied.WithStatus(http.StatusUnauthorized)
+	if denied.Status != http.StatusUnauthorized || denied.Message != "Unauthorized" || denied.Reason != ErrDenied.Reason {
+		t.Fatalf("unexpected copy %+v", denied)
+	}
+	if ErrDenied.Status != http.StatusForbidden {
+		t.Fatalf("WithStatus changed the original")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Retry-After", "1")
+
+	Write(rec, nil, ErrUpstreamOverloaded)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status=%d want=%d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != "upstream overloaded" {
+		t.Fatalf("body=%q", body)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("headers set before Write must be kept")
+	}
+}
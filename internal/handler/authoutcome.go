@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"tyk-proxy/internal/decision"
+	mp "tyk-proxy/internal/metrics"
+)
+
+// countAuthOutcome counts requests by the auth outcome recorded in their decision once they complete.
+// Requests turned away before auth ran have no outcome and are not counted.
+func countAuthOutcome(metrics *mp.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+
+			if d := decision.FromContext(r.Context()); d != nil && d.Auth != "" {
+				metrics.IncAuthOutcome(routeLabel(r.Context()), d.Auth)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+const (
+	directionRequest  = "request"
+	directionResponse = "response"
+
+	unmatchedRoute = "unmatched"
+)
+
+// limitBody applies the body size limit of the matched route (or the global one) and counts
+// proxied request bytes as they stream, so multi-GB uploads show progress in metrics.
+// Expect: 100-continue is honored end to end: the client gets its 100 only once the upstream
+// accepted the headers and the transport starts reading the body.
+func (h *Proxy) limitBody(next http.Handler, metrics *mp.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := h.maxBodyBytes
+		label := unmatchedRoute
+
+		if rt, ok := routes.FromContext(r.Context()); ok {
+			label = rt.Path
+			if rt.MaxBodyBytes != 0 {
+				limit = rt.MaxBodyBytes
+			}
+			if rt.BodyTimeout > 0 {
+				extendDeadlines(w, rt.BodyTimeout)
+			}
+		}
+
+		if r.Body != nil && r.Body != http.NoBody {
+			if limit > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			r.Body = &countingBody{ReadCloser: r.Body, add: func(n int) {
+				metrics.AddProxiedBytes(label, directionRequest, n)
+			}}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// extendDeadlines overrides the server read/write timeouts for a single request.
+func extendDeadlines(w http.ResponseWriter, d time.Duration) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(d)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
+
+type countingBody struct {
+	io.ReadCloser
+	add func(n int)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.add(n)
+	return n, err
+}
+
+func routeLabel(ctx context.Context) string {
+	if rt, ok := routes.FromContext(ctx); ok {
+		return rt.Path
+	}
+
+	return unmatchedRoute
+}
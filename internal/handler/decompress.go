@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// ratio checks start after this many decompressed bytes so tiny, highly compressible bodies pass
+const minRatioCheckBytes = 64 << 10
+
+const (
+	reasonSize  = "size"
+	reasonRatio = "ratio"
+)
+
+// DecompressionError reports a request body that exceeded the route's decompression limits.
+type DecompressionError struct {
+	Route  string
+	Reason string
+}
+
+func (e *DecompressionError) Error() string {
+	return fmt.Sprintf("decompressed request body exceeds %s limit", e.Reason)
+}
+
+// decompress inflates request bodies on routes with decompression configured. Unknown encodings pass through.
+func (h *Proxy) decompress(next http.Handler, metrics *mp.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := routes.FromContext(r.Context())
+		if !ok || rt.Decompression == nil || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if enc == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		compressed := &countingBody{ReadCloser: r.Body}
+		var read int64
+		compressed.add = func(n int) { read += int64(n) }
+
+		dec, err := newDecoder(enc, compressed)
+		if err != nil {
+			log.Debug().Err(err).Str("encoding", enc).Msg("cannot decode request body")
+			gwerr.Write(w, metrics, gwerr.ErrInvalidBody)
+			return
+		}
+		if dec == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Body = &limitedDecoder{
+			dec:        dec,
+			compressed: compressed,
+			read:       &read,
+			cfg:        rt.Decompression,
+			route:      rt.Path,
+			metrics:    metrics,
+		}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newDecoder returns nil, nil for encodings the proxy does not inflate.
+func newDecoder(enc string, r io.Reader) (io.ReadCloser, error) {
+	switch enc {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return flate.NewReader(r), nil
+	case "zstd":
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, nil
+	}
+}
+
+type limitedDecoder struct {
+	dec        io.ReadCloser
+	compressed io.Closer
+	read       *int64
+	written    int64
+
+	cfg     *config.Decompression
+	route   string
+	metrics *mp.Metrics
+}
+
+func (d *limitedDecoder) Read(p []byte) (int, error) {
+	n, err := d.dec.Read(p)
+	d.written += int64(n)
+
+	if d.written > d.cfg.MaxBytes {
+		return 0, d.reject(reasonSize)
+	}
+	if d.written > minRatioCheckBytes && *d.read > 0 && float64(d.written)/float64(*d.read) > d.cfg.MaxRatio {
+		return 0, d.reject(reasonRatio)
+	}
+
+	return n, err
+}
+
+func (d *limitedDecoder) reject(reason string) error {
+	d.metrics.IncDecompressionRejected(d.route, reason)
+	log.Info().Str("route", d.route).Str("reason", reason).Int64("decompressed", d.written).Int64("compressed", *d.read).
+		Msg("request decompression limit exceeded")
+	return &DecompressionError{Route: d.route, Reason: reason}
+}
+
+func (d *limitedDecoder) Close() error {
+	_ = d.dec.Close()
+	return d.compressed.Close()
+}
@@ -2,8 +2,8 @@ package handler
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -14,23 +14,192 @@ import (
 	"github.com/redis/go-redis/v9"
 
 	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/botsignal"
 	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/contract"
+	"tyk-proxy/internal/decision"
+	"tyk-proxy/internal/deprecation"
+	"tyk-proxy/internal/experiment"
+	"tyk-proxy/internal/gwerr"
+	"tyk-proxy/internal/inflight"
 	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/pathnorm"
+	"tyk-proxy/internal/ratelimit/adaptive"
+	"tyk-proxy/internal/ratelimit/fairqueue"
+	"tyk-proxy/internal/ratelimit/throttle"
+	"tyk-proxy/internal/reqcheck"
+	"tyk-proxy/internal/respcache"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/scrub"
+	"tyk-proxy/internal/transcode"
+	"tyk-proxy/internal/waf"
 )
 
-const maxBodyBytes int64 = 10 << 20 // 10 MiB // TODO to config
-
 type Proxy struct {
 	target string
 	authMw *auth.AuthorizationMiddlewareService
+	routes *routes.Table
+
+	// extra authorization steps run after authentication, in order
+	authorizers []func(http.Handler) http.Handler
+
+	// throughput caps toward the upstream by connection pool (see UpstreamThrottles), empty when disabled
+	throttles map[string]*throttle.Throttle
+
+	// defines good requests for the slo_* metrics; zero disables them
+	slo config.SLO
+
+	// upstream concurrency cap with fair queueing by api key, nil when disabled
+	fairQueue *fairqueue.Queue
+
+	// latency-driven upstream concurrency caps by route path, empty when no route has one
+	adaptive map[string]*adaptive.Limiter
+
+	// canonicalizes request paths before anything inspects them, nil when not configured
+	paths *pathnorm.Normalizer
+
+	// ships access events off the host, nil when disabled
+	accessLog func(http.Handler) http.Handler
+
+	// records sampled requests for replay, nil when disabled
+	capture func(http.Handler) http.Handler
+
+	// emits Tyk analytics records, nil when disabled
+	analytics func(http.Handler) http.Handler
+
+	// queues completed requests for post-response hooks, nil when disabled
+	hooks func(http.Handler) http.Handler
+
+	// tracks in-flight requests per api_key so the admin API can cancel them, nil when disabled
+	inFlight *inflight.Registry
+
+	// validates upstream responses against route OpenAPI documents, nil when no route has a contract
+	contract *contract.Validator
+
+	// masks secrets in upstream response bodies, nil when no scrub pattern is configured
+	scrubber *scrub.Scrubber
+
+	// blocks requests matching WAF rules before they are authenticated, nil when disabled
+	waf *waf.Engine
+
+	// scores requests for bot and scanner traits, nil when disabled
+	botSignals *botsignal.Scorer
+
+	// serves cached routes from memory and answers If-None-Match for them, nil when disabled
+	respCache *respcache.Cache
+
+	// announces deprecated routes and records their callers, nil when disabled
+	deprecations *deprecation.Tracker
+
+	// assigns A/B experiment buckets, nil without experiments
+	experiments *experiment.Assigner
+
+	// rejects requests missing route-required headers, nil when no route has any
+	headers *reqcheck.Checker
+
+	// serves routes with grpc configured by calling the gRPC backend, nil when no route has it
+	transcoder *transcode.Transcoder
+
+	// caps open streaming responses per api_key and their duration across all upstreams, nil when disabled
+	streams *streamLimiter
+
+	// connection pool toward the upstream, shared by routes without their own
+	pool config.UpstreamPool
+
+	// TLS settings of the upstream pools by pool name (see UpstreamTLS); pools without any use the defaults
+	upstreamTLS map[string]*tls.Config
+
+	// checks the upstream for /ready, nil when readiness does not depend on it
+	upstreamProbe *UpstreamProbe
+
+	// labels request goroutines for profiling by route, method and api_key
+	profileLabels bool
+
+	maxBodyBytes int64
+
+	// request target and query parameter limits; zero disables them
+	maxURLLength   int
+	maxQueryParams int
 
 	rdcl redis.UniversalClient
 }
 
+type Options struct {
+	Routes       *routes.Table
+	Authorizers  []func(http.Handler) http.Handler
+	Throttles    map[string]*throttle.Throttle
+	Capture      func(http.Handler) http.Handler
+	FairQueue    *fairqueue.Queue
+	Adaptive     map[string]*adaptive.Limiter
+	AccessLog    func(http.Handler) http.Handler
+	Analytics    func(http.Handler) http.Handler
+	Hooks        func(http.Handler) http.Handler
+	Paths        *pathnorm.Normalizer
+	SLO          config.SLO
+	Streaming    config.Streaming
+	InFlight     *inflight.Registry
+	Contract     *contract.Validator
+	Scrubber     *scrub.Scrubber
+	WAF          *waf.Engine
+	BotSignals   *botsignal.Scorer
+	Headers      *reqcheck.Checker
+	Deprecations *deprecation.Tracker
+	Experiments  *experiment.Assigner
+	Transcoder   *transcode.Transcoder
+	Cache        *respcache.Cache
+	Pool         config.UpstreamPool
+	UpstreamTLS  map[string]*tls.Config
+
+	// UpstreamProbe, when set, makes /ready fail while the upstream is unreachable.
+	UpstreamProbe *UpstreamProbe
+
+	ProfileLabels bool
+
+	MaxBodyBytes   int64
+	MaxURLLength   int
+	MaxQueryParams int
+}
+
 func NewHandler(target string, authMw *auth.AuthorizationMiddlewareService, rdcl redis.UniversalClient) *Proxy {
 	return &Proxy{target: target, authMw: authMw, rdcl: rdcl}
 }
 
+func (h *Proxy) WithOptions(opts *Options) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	h.routes = opts.Routes
+	h.authorizers = opts.Authorizers
+	h.throttles = opts.Throttles
+	h.capture = opts.Capture
+	h.fairQueue = opts.FairQueue
+	h.adaptive = opts.Adaptive
+	h.accessLog = opts.AccessLog
+	h.analytics = opts.Analytics
+	h.hooks = opts.Hooks
+	h.paths = opts.Paths
+	h.slo = opts.SLO
+	h.streams = newStreamLimiter(opts.Streaming)
+	h.inFlight = opts.InFlight
+	h.contract = opts.Contract
+	h.scrubber = opts.Scrubber
+	h.waf = opts.WAF
+	h.botSignals = opts.BotSignals
+	h.headers = opts.Headers
+	h.deprecations = opts.Deprecations
+	h.experiments = opts.Experiments
+	h.transcoder = opts.Transcoder
+	h.respCache = opts.Cache
+	h.pool = opts.Pool
+	h.upstreamTLS = opts.UpstreamTLS
+	h.upstreamProbe = opts.UpstreamProbe
+	h.profileLabels = opts.ProfileLabels
+	h.maxBodyBytes = opts.MaxBodyBytes
+	h.maxURLLength = opts.MaxURLLength
+	h.maxQueryParams = opts.MaxQueryParams
+}
+
 func setRequestIDHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if rid := middleware.GetReqID(r.Context()); rid != "" {
@@ -45,51 +214,138 @@ func setRequestIDHeader(next http.Handler) http.Handler {
 func GetRouter(h *Proxy, metrics *mp.Metrics) chi.Router {
 	r := chi.NewRouter()
 
+	r.Use(h.limitURL(metrics))
+	if h.paths != nil {
+		r.Use(h.paths.Middleware)
+	}
 	r.Use(middleware.RealIP)
 	r.Use(middleware.CleanPath)
 	r.Use(middleware.RequestID)
 	r.Use(setRequestIDHeader)
-	r.Use(middleware.RequestSize(maxBodyBytes))
 	r.Use(middleware.RequestLogger(&config.ChiZerologFormatter{}))
 	r.Use(middleware.Recoverer)
 	r.Use(metrics.MetricsMiddleware)
+	if h.accessLog != nil {
+		r.Use(h.accessLog)
+	}
 
 	r.Get("/health", h.Health())
 	r.Get("/ready", h.Ready())
 
 	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(h.routes.Middleware)
+		r.Use(methodOverride(metrics))
+		r.Use(allowMethods(metrics))
+		r.Use(filterQuery(metrics))
+		r.Use(decision.Middleware)
+		r.Use(countAuthOutcome(metrics))
+		if h.analytics != nil {
+			r.Use(h.analytics)
+		}
+		if h.hooks != nil {
+			r.Use(h.hooks)
+		}
+		if h.botSignals != nil {
+			r.Use(h.botSignals.Middleware)
+		}
+		if h.waf != nil {
+			r.Use(h.waf.Middleware)
+		}
+		if h.headers != nil {
+			r.Use(h.headers.Middleware)
+		}
+		r.Use(negotiateVersion(metrics))
+		r.Use(h.observeSLO(metrics))
 		r.Use(h.authMw.Handler)
-		r.Handle("/*", h.Handler(h.target))
+		if h.profileLabels {
+			r.Use(profileLabels)
+		}
+		if h.inFlight != nil {
+			r.Use(h.inFlight.Middleware)
+		}
+		for _, authz := range h.authorizers {
+			r.Use(authz)
+		}
+		if h.waf != nil {
+			r.Use(h.waf.BodyMiddleware)
+		}
+		if h.experiments != nil {
+			r.Use(h.experiments.Middleware)
+		}
+		if h.deprecations != nil {
+			r.Use(h.deprecations.Middleware)
+		}
+		if h.capture != nil {
+			r.Use(h.capture)
+		}
+		if h.respCache != nil {
+			r.Use(h.respCache.Middleware)
+		}
+		upstream := h.upstream(metrics)
+		if h.transcoder != nil {
+			upstream = h.transcoder.Handler(upstream)
+		}
+		r.Handle("/*", h.limitBody(h.longPoll(h.decompress(h.fairQueued(h.throttled(h.adaptiveLimited(upstream, metrics), metrics), metrics), metrics)), metrics))
 	})
 
 	return r
 }
 
-func (h *Proxy) Handler(targetURL string) http.HandlerFunc {
+func (h *Proxy) Handler(targetURL string, metrics *mp.Metrics) http.HandlerFunc {
+	return h.proxyTo(targetURL, newUpstreamTransport(defaultPool, h.pool, h.upstreamTLS[defaultPool], defaultResponseHeaderTimeout, metrics), metrics)
+}
+
+func (h *Proxy) proxyTo(targetURL string, transport http.RoundTripper, metrics *mp.Metrics) http.HandlerFunc {
 	target, err := url.Parse(targetURL)
 	if err != nil || target.Scheme == "" || target.Host == "" {
 		return func(w http.ResponseWriter, r *http.Request) {
-			http.Error(w, "invalid upstream target", http.StatusInternalServerError)
+			gwerr.Write(w, metrics, gwerr.ErrUpstreamConfig)
 		}
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(target)
-	proxy.Transport = newUpstreamTransport()
+	proxy.Transport = transport
 	proxy.FlushInterval = 100 * time.Millisecond
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		label := routeLabel(resp.Request.Context())
+		resp.Body = &countingBody{ReadCloser: resp.Body, add: func(n int) {
+			metrics.AddProxiedBytes(label, directionResponse, n)
+		}}
+
+		if err := h.contract.Check(resp); err != nil {
+			return err
+		}
+		if err := h.scrubber.Scrub(resp); err != nil {
+			return err
+		}
+
+		if st, ok := resp.Request.Context().Value(ctxKeyStream{}).(*stream); ok && h.streams.isStream(resp) {
+			tok, _ := auth.TokenFromContext(resp.Request.Context())
+			return h.streams.start(st, tok.APIKey, metrics)
+		}
+		return nil
+	}
 
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, e error) {
 		var mbe *http.MaxBytesError
-		if errors.As(e, &mbe) {
-			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		var de *DecompressionError
+		if errors.As(e, &mbe) || errors.As(e, &de) {
+			gwerr.Write(w, metrics, gwerr.ErrBodyTooLarge)
+			return
+		}
+
+		if errors.Is(e, errTooManyStreams) {
+			w.Header().Set("Retry-After", "1")
+			gwerr.Write(w, metrics, gwerr.ErrTooManyStreams)
 			return
 		}
 
 		if errors.Is(e, context.DeadlineExceeded) {
-			http.Error(w, "gateway timeout", http.StatusGatewayTimeout)
+			gwerr.Write(w, metrics, gwerr.ErrUpstreamTimeout)
 			return
 		}
 
-		http.Error(w, "bad gateway", http.StatusBadGateway)
+		gwerr.Write(w, metrics, gwerr.ErrUpstream)
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -97,25 +353,102 @@ func (h *Proxy) Handler(targetURL string) http.HandlerFunc {
 			r.Header.Set("X-Request-ID", rid)
 		}
 		r.Host = target.Host
+		h.scrubber.PrepareRequest(r)
+		decision.FromContext(r.Context()).SetUpstream(target.Host)
+
+		if h.streams != nil {
+			ctx, cancel := context.WithCancel(r.Context())
+			st := &stream{cancel: cancel}
+			defer cancel()
+			defer st.finish()
+			r = r.WithContext(context.WithValue(ctx, ctxKeyStream{}, st))
+		}
+
 		proxy.ServeHTTP(w, r)
 	}
 }
 
-func newUpstreamTransport() *http.Transport {
-	dialer := &net.Dialer{
-		Timeout:   5 * time.Second,
-		KeepAlive: 30 * time.Second,
+// throttled applies the throughput cap of the matched route's connection pool, shedding with 503 when its queue
+// is full.
+func (h *Proxy) throttled(next http.Handler, metrics *mp.Metrics) http.Handler {
+	if len(h.throttles) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pool := defaultPool
+		if rt, ok := routes.FromContext(r.Context()); ok {
+			pool = poolName(rt)
+		}
+		th := h.throttles[pool]
+		if th == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := th.Wait(r.Context())
+		metrics.SetUpstreamQueue(pool, th.Waiting())
+		if err != nil {
+			if errors.Is(err, throttle.ErrQueueFull) {
+				metrics.IncUpstreamShed(pool)
+			}
+			w.Header().Set("Retry-After", "1")
+			gwerr.Write(w, metrics, gwerr.ErrUpstreamOverloaded)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adaptiveLimited applies the adaptive concurrency limit of the matched route, shedding with 503 at the limit.
+// Every response counts as a latency sample, so the limit suits request/response routes rather than streams.
+func (h *Proxy) adaptiveLimited(next http.Handler, metrics *mp.Metrics) http.Handler {
+	if len(h.adaptive) == 0 {
+		return next
 	}
 
-	return &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
-		DialContext:           dialer.DialContext,
-		MaxIdleConns:          200,
-		MaxIdleConnsPerHost:   100,
-		IdleConnTimeout:       90 * time.Second,
-		ResponseHeaderTimeout: 30 * time.Second,
-		TLSHandshakeTimeout:   5 * time.Second,
-		ExpectContinueTimeout: time.Second,
-		ForceAttemptHTTP2:     true,
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := routes.FromContext(r.Context())
+		if !ok || h.adaptive[rt.Path] == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		release, ok := h.adaptive[rt.Path].Acquire()
+		if !ok {
+			metrics.IncAdaptiveShed(rt.Path)
+			w.Header().Set("Retry-After", "1")
+			gwerr.Write(w, metrics, gwerr.ErrUpstreamOverloaded)
+			return
+		}
+
+		recorder := &mp.StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+		defer func() { release(recorder.Status >= http.StatusInternalServerError) }()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+func (h *Proxy) fairQueued(next http.Handler, metrics *mp.Metrics) http.Handler {
+	if h.fairQueue == nil {
+		return next
 	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok, _ := auth.TokenFromContext(r.Context())
+
+		release, err := h.fairQueue.Acquire(r.Context(), tok.APIKey, tok.Tier)
+		if err != nil {
+			if errors.Is(err, fairqueue.ErrQueueFull) {
+				metrics.IncFairQueueShed(h.fairQueue.Tier(tok.Tier))
+			}
+			w.Header().Set("Retry-After", "1")
+			gwerr.Write(w, metrics, gwerr.ErrUpstreamOverloaded)
+			return
+		}
+		defer release()
+
+		next.ServeHTTP(w, r)
+	})
 }
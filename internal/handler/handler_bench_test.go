@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// BenchmarkProxyChain sends requests through the whole router (middleware, auth, body limits, proxy)
+// to a local upstream, which is the per-request overhead the proxy adds.
+func BenchmarkProxyChain(b *testing.B) {
+	lvl := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	b.Cleanup(func() { zerolog.SetGlobalLevel(lvl) })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	b.Cleanup(upstream.Close)
+
+	srv := newTestServer(b, upstream.URL, nil)
+	token := testToken(b)
+	client := srv.Client()
+
+	for _, bc := range []struct {
+		name   string
+		method string
+		body   string
+	}{
+		{name: "GET", method: http.MethodGet},
+		{name: "POST_1KiB", method: http.MethodPost, body: strings.Repeat("x", 1<<10)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req, _ := http.NewRequest(bc.method, srv.URL+"/api/v1/items", strings.NewReader(bc.body))
+				req.Header.Set("Authorization", "Bearer "+token)
+
+				resp, err := client.Do(req)
+				if err != nil {
+					b.Fatalf("request: %v", err)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					b.Fatalf("status=%d want=%d", resp.StatusCode, http.StatusOK)
+				}
+			}
+		})
+	}
+}
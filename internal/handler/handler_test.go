@@ -0,0 +1,1081 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/flags"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/respcache"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/store"
+)
+
+const testSecret = "test-secret"
+
+type fakeTokenStore struct{}
+
+func (fakeTokenStore) GetToken(_ context.Context, key string) (store.Token, error) {
+	return store.Token{APIKey: key, RateLimit: 1000}, nil
+}
+
+type fakeLimiter struct{}
+
+func (fakeLimiter) Allow(context.Context, string, int, int) (bool, error) {
+	return true, nil
+}
+
+func newTestServer(t testing.TB, upstream string, opts *Options) *httptest.Server {
+	t.Helper()
+
+	verifier := auth.NewJWTVerifier(auth.KeySet{ExpectedAlg: "HS256", DefaultKey: []byte(testSecret)})
+	h := NewHandler(upstream, auth.New(fakeTokenStore{}, fakeLimiter{}, verifier), nil)
+	h.WithOptions(opts)
+
+	srv := httptest.NewServer(GetRouter(h, mp.GetMetrics()))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testToken(t testing.TB) string {
+	t.Helper()
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		APIKey: "k1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	s, err := tok.SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+
+	return s
+}
+
+// chunkedReader hides its length so the client uses chunked transfer encoding.
+type chunkedReader struct{ io.Reader }
+
+func TestProxy_UploadBodyLimits(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Received", strings.Repeat("x", int(n/1024)))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes:       routes.NewTable([]config.Route{{Path: "/api/v1/uploads*", MaxBodyBytes: -1}}),
+		MaxBodyBytes: 1024,
+	})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/v1/uploads/big", http.StatusOK},
+		{"/api/v1/other", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		body := chunkedReader{strings.NewReader(strings.Repeat("a", 64*1024))}
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+tt.path, body)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.path, err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.want {
+			t.Fatalf("%s: status=%d want=%d", tt.path, resp.StatusCode, tt.want)
+		}
+		if tt.want == http.StatusOK && len(resp.Header.Get("X-Received")) != 64 {
+			t.Fatalf("%s: upstream received %d KiB, want 64", tt.path, len(resp.Header.Get("X-Received")))
+		}
+	}
+}
+
+func TestProxy_ExpectContinue(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{MaxBodyBytes: 1 << 20})
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/upload", strings.NewReader("payload"))
+	req.Header.Set("Authorization", "Bearer "+testToken(t))
+	req.Header.Set("Expect", "100-continue")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(b) != "payload" {
+		t.Fatalf("status=%d body=%q, want 200 payload", resp.StatusCode, b)
+	}
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestProxy_Decompression(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "" {
+			t.Errorf("Content-Encoding must be removed after decompression")
+		}
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{{
+			Path:          "*",
+			Decompression: &config.Decompression{MaxBytes: 512 << 10, MaxRatio: 50},
+		}}),
+		MaxBodyBytes: 1 << 20,
+	})
+
+	randomish := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog ", 2000))
+
+	tests := []struct {
+		name string
+		body []byte
+		want int
+	}{
+		{"small body", gzipped(t, []byte(`{"ok":true}`)), http.StatusOK},
+		{"ratio bomb", gzipped(t, make([]byte, 400<<10)), http.StatusRequestEntityTooLarge},
+		{"size bomb", gzipped(t, bytes.Repeat(randomish, 8)), http.StatusRequestEntityTooLarge},
+		{"invalid gzip", []byte("not gzip"), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/ingest", bytes.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		req.Header.Set("Content-Encoding", "gzip")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.want {
+			t.Fatalf("%s: status=%d want=%d body=%q", tt.name, resp.StatusCode, tt.want, b)
+		}
+		if tt.want == http.StatusOK && string(b) != `{"ok":true}` {
+			t.Fatalf("%s: upstream got %q", tt.name, b)
+		}
+	}
+}
+
+func counterValue(t *testing.T, name, route string) float64 {
+	t.Helper()
+
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "route" && l.GetValue() == route {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestProxy_SLOMetrics(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/slo/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if r.URL.Path == "/api/v1/slo/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer upstream.Close()
+
+	const route = "/api/v1/slo/*"
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{{Path: route}}),
+		SLO:    config.SLO{LatencyThreshold: 20 * time.Millisecond, Objective: 0.9},
+	})
+
+	for _, p := range []string{"/api/v1/slo/ok", "/api/v1/slo/slow", "/api/v1/slo/fail"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+p, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", p, err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	tests := []struct {
+		metric string
+		want   float64
+	}{
+		{"slo_requests_total", 3},
+		{"slo_requests_within_latency_total", 2},
+		{"slo_requests_errors_total", 1},
+		{"slo_error_budget_burn_total", 20}, // two bad requests at 1/(1-0.9) each
+	}
+	for _, tt := range tests {
+		if got := counterValue(t, tt.metric, route); math.Abs(got-tt.want) > 1e-9 {
+			t.Fatalf("%s=%v want=%v", tt.metric, got, tt.want)
+		}
+	}
+}
+
+func TestProxy_MethodOverride(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Method", r.Method)
+		w.Header().Set("X-Upstream-Override", r.Header.Get("X-HTTP-Method-Override"))
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{
+			{Path: "/api/v1/legacy*", MethodOverride: config.MethodOverrideHonor},
+			{Path: "*"},
+		}),
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		override   string
+		wantStatus int
+		wantMethod string
+	}{
+		{"stripped by default", http.MethodPost, "/api/v1/orders", "DELETE", http.StatusOK, http.MethodPost},
+		{"honored on route", http.MethodPost, "/api/v1/legacy/1", "delete", http.StatusOK, http.MethodDelete},
+		{"only POST can be overridden", http.MethodGet, "/api/v1/legacy/1", "DELETE", http.StatusBadRequest, ""},
+		{"unknown method", http.MethodPost, "/api/v1/legacy/1", "CONNECT", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		req.Header.Set("X-HTTP-Method-Override", tt.override)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Fatalf("%s: status=%d want=%d", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+		if tt.wantMethod == "" {
+			continue
+		}
+		if got := resp.Header.Get("X-Upstream-Method"); got != tt.wantMethod {
+			t.Fatalf("%s: upstream method=%s want=%s", tt.name, got, tt.wantMethod)
+		}
+		if resp.Header.Get("X-Upstream-Override") != "" {
+			t.Fatalf("%s: override header reached the upstream", tt.name)
+		}
+	}
+}
+
+func TestProxy_URLLimits(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes:         routes.NewTable([]config.Route{{Path: "*"}}),
+		MaxURLLength:   256,
+		MaxQueryParams: 3,
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"within limits", "/api/v1/orders?a=1&b=2&c=3", http.StatusOK},
+		{"empty pairs not counted", "/api/v1/orders?a=1&&b=2&c=3&", http.StatusOK},
+		{"too many params", "/api/v1/orders?a=1&b=2&c=3&d=4", http.StatusBadRequest},
+		{"url too long", "/api/v1/orders?q=" + strings.Repeat("x", 256), http.StatusRequestURITooLong},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.want {
+			t.Fatalf("%s: status=%d want=%d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestProxy_QueryAllowlist(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Query", r.URL.RawQuery)
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{
+			{Path: "/api/v1/search*", Query: &config.QueryPolicy{Allowed: []string{"q", "filter.*"}, Unknown: config.QueryUnknownStrip}},
+			{Path: "/api/v1/strict*", Query: &config.QueryPolicy{Allowed: []string{"id"}, Unknown: config.QueryUnknownReject}},
+			{Path: "*"},
+		}),
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantQuery  string
+	}{
+		{"no policy", "/api/v1/orders?utm_source=x&id=1", http.StatusOK, "utm_source=x&id=1"},
+		{"strips unknown", "/api/v1/search?utm_source=x&q=a%20b&_=123&filter.size=m", http.StatusOK, "q=a%20b&filter.size=m"},
+		{"strips everything", "/api/v1/search?cb=1", http.StatusOK, ""},
+		{"escaped name", "/api/v1/search?%71=1", http.StatusOK, "%71=1"},
+		{"rejects unknown", "/api/v1/strict?id=1&debug=1", http.StatusBadRequest, ""},
+		{"allowed only", "/api/v1/strict?id=1", http.StatusOK, "id=1"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Fatalf("%s: status=%d want=%d", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+		if got := resp.Header.Get("X-Upstream-Query"); got != tt.wantQuery {
+			t.Fatalf("%s: upstream query=%q want=%q", tt.name, got, tt.wantQuery)
+		}
+	}
+}
+
+func TestProxy_APIVersions(t *testing.T) {
+	upstream := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Upstream", version+" "+r.URL.Path)
+		}))
+	}
+	legacy, v1, v2 := upstream("legacy"), upstream("v1"), upstream("v2")
+	defer legacy.Close()
+	defer v1.Close()
+	defer v2.Close()
+
+	upstreams := map[string]string{"v1": v1.URL, "v2": v2.URL}
+	srv := newTestServer(t, legacy.URL, &Options{
+		Routes: routes.NewTable([]config.Route{
+			{Path: "/api/v1/orders*", Versions: &config.Versioning{
+				Headers: []string{"Accept-Version", "X-API-Version"}, Default: "v1", Upstreams: upstreams,
+			}},
+			{Path: "/api/v1/strict*", Versions: &config.Versioning{
+				Headers: []string{"Accept-Version"}, Upstreams: upstreams,
+			}},
+			{Path: "/api/v1/*", Versions: &config.Versioning{
+				Headers: []string{"Accept-Version"}, Segment: 3, StripSegment: true, Default: "v1", Upstreams: upstreams,
+			}},
+		}),
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		header       string
+		value        string
+		wantStatus   int
+		wantUpstream string
+	}{
+		{"default", "/api/v1/orders", "", "", http.StatusOK, "v1 /api/v1/orders"},
+		{"accept-version", "/api/v1/orders", "Accept-Version", "2", http.StatusOK, "v2 /api/v1/orders"},
+		{"x-api-version", "/api/v1/orders", "X-API-Version", "V2", http.StatusOK, "v2 /api/v1/orders"},
+		{"unsupported header", "/api/v1/orders", "Accept-Version", "v3", http.StatusNotAcceptable, ""},
+		{"no default", "/api/v1/strict", "", "", http.StatusNotAcceptable, ""},
+		{"segment", "/api/v1/v2/users", "Accept-Version", "v1", http.StatusOK, "v2 /api/v1/users"},
+		{"unsupported segment", "/api/v1/v9/users", "", "", http.StatusNotAcceptable, ""},
+		{"no segment", "/api/v1/users", "Accept-Version", "2", http.StatusOK, "v2 /api/v1/users"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Fatalf("%s: status=%d want=%d", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+		if got := resp.Header.Get("X-Upstream"); got != tt.wantUpstream {
+			t.Fatalf("%s: upstream=%q want=%q", tt.name, got, tt.wantUpstream)
+		}
+	}
+}
+
+func TestProxy_RouteUpstreams(t *testing.T) {
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Upstream", name+" "+r.URL.Path)
+		}))
+	}
+	def, users, orders := upstream("default"), upstream("users"), upstream("orders")
+	defer def.Close()
+	defer users.Close()
+	defer orders.Close()
+
+	srv := newTestServer(t, def.URL, &Options{
+		Routes: routes.NewTable([]config.Route{
+			{Path: "/api/v1/users/*", Upstream: users.URL, Rewrite: &config.Rewrite{StripPrefix: "/api/v1/users"}},
+			{Path: "/api/v1/orders*", Upstream: orders.URL + "/svc", Rewrite: &config.Rewrite{StripPrefix: "/api/v1/orders", AddPrefix: "/v2"}},
+			{Path: "/api/v1/legacy/*", Rewrite: &config.Rewrite{AddPrefix: "/old"}},
+		}),
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		wantUpstream string
+	}{
+		{"default upstream", "/api/v1/other", "default /api/v1/other"},
+		{"strip prefix", "/api/v1/users/42", "users /42"},
+		{"strip to root", "/api/v1/users/", "users /"},
+		{"upstream base path and add prefix", "/api/v1/orders/7", "orders /svc/v2/7"},
+		{"whole prefix", "/api/v1/orders", "orders /svc/v2"},
+		{"partial segment kept", "/api/v1/orders2", "orders /svc/api/v1/orders2"},
+		{"rewrite on target_host", "/api/v1/legacy/x", "default /old/api/v1/legacy/x"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+
+		if got := resp.Header.Get("X-Upstream"); got != tt.wantUpstream {
+			t.Fatalf("%s: upstream=%q want=%q", tt.name, got, tt.wantUpstream)
+		}
+	}
+}
+
+func TestProxy_RouteUpstreamPool(t *testing.T) {
+	release := make(chan struct{})
+	slowStarted := make(chan struct{}, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v1/slow") {
+			slowStarted <- struct{}{}
+			<-release
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{
+			{Path: "/api/v1/slow*", UpstreamPool: &config.UpstreamPool{MaxConnsPerHost: 1}},
+		}),
+	})
+
+	get := func(path string, timeout time.Duration) (int, error) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	go func() { _, _ = get("/api/v1/slow/1", 5*time.Second) }()
+	<-slowStarted
+
+	// the slow route holds its only connection; a second request on it waits for the pool
+	if _, err := get("/api/v1/slow/2", 200*time.Millisecond); err == nil {
+		t.Fatalf("second slow request should wait for the route pool")
+	}
+	if len(slowStarted) != 0 {
+		t.Fatalf("second slow request reached the upstream despite max_conns_per_host 1")
+	}
+
+	// other routes use the default pool
+	if code, err := get("/api/v1/fast", time.Second); err != nil || code != http.StatusOK {
+		t.Fatalf("fast route: status=%d err=%v, want 200 while the slow pool is exhausted", code, err)
+	}
+}
+
+func TestProxy_UpstreamThrottlePerPool(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	app := config.Application{
+		UpstreamRateLimit: config.UpstreamRateLimit{RPS: 0.1},
+		Routes: []config.Route{
+			{Path: "/api/v1/reports*", UpstreamPool: &config.UpstreamPool{MaxConnsPerHost: 1}},
+			{Path: "/api/v1/*"},
+		},
+	}
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes:    routes.NewTable(app.Routes),
+		Throttles: UpstreamThrottles(app),
+	})
+
+	get := func(path string) int {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get("/api/v1/orders"); code != http.StatusOK {
+		t.Fatalf("first request status=%d want=200", code)
+	}
+	if code := get("/api/v1/users"); code != http.StatusServiceUnavailable {
+		t.Fatalf("second request on the default pool status=%d want=503", code)
+	}
+	// the route pool has a budget of its own
+	if code := get("/api/v1/reports"); code != http.StatusOK {
+		t.Fatalf("request on the route pool status=%d want=200", code)
+	}
+}
+
+func TestProxy_UpstreamConnLifetime(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Pool: config.UpstreamPool{MaxIdleConnsPerHost: 10, MaxConnLifetime: 50 * time.Millisecond},
+	})
+
+	get := func() {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	get()
+	get()
+	mu.Lock()
+	if conns != 1 {
+		t.Fatalf("upstream connections=%d want 1 reused while young", conns)
+	}
+	mu.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	get() // last request on the expired connection
+	get()
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 2 {
+		t.Fatalf("upstream connections=%d want 2 after the first outlived its lifetime", conns)
+	}
+}
+
+func TestProxy_UpstreamTLS(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer upstream.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := config.Application{
+		UpstreamPool: config.UpstreamPool{TLS: config.ClientTLS{Enabled: true, CAFile: caFile, MinVersion: config.TLSVersion13}},
+		Routes: []config.Route{
+			// pools are taken as given here; config validation fills unset route settings from the application
+			{Path: "/api/v1/pooled*", UpstreamPool: &config.UpstreamPool{MaxConnsPerHost: 1, TLS: config.ClientTLS{Enabled: true, CAFile: caFile}}},
+			{Path: "/api/v1/untrusted*", UpstreamPool: &config.UpstreamPool{MaxConnsPerHost: 1}},
+		},
+	}
+	upstreamTLS, err := UpstreamTLS(app)
+	if err != nil {
+		t.Fatalf("UpstreamTLS: %v", err)
+	}
+	if len(upstreamTLS) != 2 || upstreamTLS[defaultPool].MinVersion != tls.VersionTLS13 {
+		t.Fatalf("configs=%v want the default and /api/v1/pooled* pools", upstreamTLS)
+	}
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes:      routes.NewTable(app.Routes),
+		Pool:        app.UpstreamPool,
+		UpstreamTLS: upstreamTLS,
+	})
+
+	for path, want := range map[string]int{
+		"/api/v1/orders":      http.StatusOK,
+		"/api/v1/pooled/1":    http.StatusOK,
+		"/api/v1/untrusted/1": http.StatusBadGateway, // system roots do not know the test CA
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("%s: status=%d want=%d", path, resp.StatusCode, want)
+		}
+	}
+
+	app.UpstreamPool.TLS.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := UpstreamTLS(app); err == nil {
+		t.Fatal("expected error for a missing ca_file")
+	}
+}
+
+func TestProfileLabels(t *testing.T) {
+	var got map[string]string
+	h := profileLabels(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = map[string]string{}
+		pprof.ForLabels(r.Context(), func(k, v string) bool {
+			got[k] = v
+			return true
+		})
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orders", nil)
+	ctx := routes.WithRoute(req.Context(), &config.Route{Path: "/api/v1/orders*"})
+	ctx = auth.WithToken(ctx, store.Token{APIKey: "k1"})
+	h.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+
+	want := map[string]string{"route": "/api/v1/orders*", "method": http.MethodPost, "api_key": auth.HashAPIKey("k1")}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("labels=%v want=%v", got, want)
+	}
+}
+
+func TestProxy_HeadAndOptions(t *testing.T) {
+	const body = "hello, world"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Method", r.Method)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Method != http.MethodHead {
+			_, _ = io.WriteString(w, body)
+		}
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{
+			{Path: "/api/v1/cached*", Cache: &config.RouteCache{TTL: time.Minute, ETag: config.ETagGenerate}},
+			{Path: "/api/v1/orders*", Methods: []string{http.MethodGet, http.MethodPost}, Options: config.OptionsLocal},
+			{Path: "/api/v1/proxied*", Options: config.OptionsProxy},
+		}),
+		Cache: respcache.New(config.ResponseCache{Size: 10, MaxBodyBytes: 1 << 20},
+			flags.New(map[string]bool{config.FlagCache: true}, nil), nil),
+	})
+
+	do := func(method, path string, header http.Header) (*http.Response, string) {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return resp, string(b)
+	}
+
+	// HEAD before the route is cached must not get an ETag of the empty body
+	resp, got := do(http.MethodHead, "/api/v1/cached", nil)
+	if resp.StatusCode != http.StatusOK || got != "" || resp.ContentLength != int64(len(body)) || resp.Header.Get("ETag") != "" {
+		t.Fatalf("HEAD miss: status=%d body=%q length=%d etag=%q", resp.StatusCode, got, resp.ContentLength, resp.Header.Get("ETag"))
+	}
+	get, _ := do(http.MethodGet, "/api/v1/cached", nil)
+	resp, got = do(http.MethodHead, "/api/v1/cached", nil)
+	if got != "" || resp.ContentLength != int64(len(body)) || resp.Header.Get("ETag") != get.Header.Get("ETag") {
+		t.Fatalf("HEAD hit: body=%q length=%d etag=%q want GET etag %q",
+			got, resp.ContentLength, resp.Header.Get("ETag"), get.Header.Get("ETag"))
+	}
+
+	resp, _ = do(http.MethodOptions, "/api/v1/orders", nil)
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Allow") != "GET, POST, HEAD, OPTIONS" ||
+		resp.Header.Get("X-Upstream-Method") != "" {
+		t.Fatalf("local OPTIONS: status=%d allow=%q upstream=%q", resp.StatusCode, resp.Header.Get("Allow"),
+			resp.Header.Get("X-Upstream-Method"))
+	}
+
+	preflight := http.Header{"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {"POST"}}
+	if resp, _ := do(http.MethodOptions, "/api/v1/orders", preflight); resp.Header.Get("X-Upstream-Method") != http.MethodOptions {
+		t.Fatalf("CORS preflight should go upstream, got status=%d", resp.StatusCode)
+	}
+
+	if resp, _ := do(http.MethodDelete, "/api/v1/orders/1", nil); resp.StatusCode != http.StatusMethodNotAllowed ||
+		resp.Header.Get("Allow") != "GET, POST, HEAD, OPTIONS" {
+		t.Fatalf("DELETE: status=%d allow=%q want 405", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+	if resp, _ := do(http.MethodHead, "/api/v1/orders/1", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("HEAD on a GET route: status=%d want 200", resp.StatusCode)
+	}
+
+	if resp, _ := do(http.MethodOptions, "/api/v1/proxied", nil); resp.Header.Get("X-Upstream-Method") != http.MethodOptions {
+		t.Fatalf("proxied OPTIONS: status=%d, want it upstream", resp.StatusCode)
+	}
+}
+
+func TestProxy_StreamingLimits(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Streaming: config.Streaming{
+			ContentTypes: []string{"text/event-stream"},
+			MaxPerToken:  1,
+			MaxDuration:  300 * time.Millisecond,
+		},
+	})
+
+	open := func() *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/events", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	first := open()
+	defer first.Body.Close()
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("first stream status=%d want=200", first.StatusCode)
+	}
+
+	second := open()
+	_ = second.Body.Close()
+	if second.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second stream status=%d want=429", second.StatusCode)
+	}
+
+	start := time.Now()
+	_, _ = io.Copy(io.Discard, first.Body)
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("stream was not cut at max_duration")
+	}
+
+	third := open()
+	_ = third.Body.Close()
+	if third.StatusCode != http.StatusOK {
+		t.Fatalf("stream after the first ended: status=%d want=200", third.StatusCode)
+	}
+}
+
+func TestProxy_StreamingLimitsAcrossPools(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{
+			{Path: "/api/v1/news*", UpstreamPool: &config.UpstreamPool{MaxConnsPerHost: 5}},
+			{Path: "/api/v1/events*"},
+		}),
+		Streaming: config.Streaming{ContentTypes: []string{"text/event-stream"}, MaxPerToken: 1},
+	})
+
+	open := func(path string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	first := open("/api/v1/news")
+	defer first.Body.Close()
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("first stream status=%d want=200", first.StatusCode)
+	}
+
+	// the route with the default pool shares the token's stream count
+	second := open("/api/v1/events")
+	_ = second.Body.Close()
+	if second.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("stream on another pool status=%d want=429", second.StatusCode)
+	}
+}
+
+func TestProxy_RangeRequests(t *testing.T) {
+	media := bytes.Repeat([]byte("0123456789abcdef"), 1<<19) // 8 MiB
+	modTime := time.Unix(1700000000, 0)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"media-v1"`)
+		w.Header().Set("Content-Type", "video/mp4")
+		http.ServeContent(w, r, "movie.mp4", modTime, bytes.NewReader(media))
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{{Path: "/api/v1/media*", Cache: &config.RouteCache{TTL: time.Minute}}}),
+		Cache: respcache.New(config.ResponseCache{Size: 10, MaxBodyBytes: 16 << 20},
+			flags.New(map[string]bool{config.FlagCache: true}, nil), nil),
+	})
+
+	// media players do not ask for compression
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	tests := []struct {
+		name         string
+		rng, ifRange string
+		status       int
+		from, to     int
+	}{
+		{"first bytes", "bytes=0-1023", "", http.StatusPartialContent, 0, 1023},
+		{"middle of a large file", "bytes=5000000-5999999", "", http.StatusPartialContent, 5000000, 5999999},
+		{"suffix", "bytes=-100", "", http.StatusPartialContent, len(media) - 100, len(media) - 1},
+		{"if-range matches", "bytes=100-199", `"media-v1"`, http.StatusPartialContent, 100, 199},
+		{"if-range stale gets full body", "bytes=100-199", `"media-v0"`, http.StatusOK, 0, len(media) - 1},
+		{"full download", "", "", http.StatusOK, 0, len(media) - 1},
+		{"range after a cached full download", "bytes=10-19", "", http.StatusPartialContent, 10, 19},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/media/movie.mp4", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t))
+		if tt.rng != "" {
+			req.Header.Set("Range", tt.rng)
+		}
+		if tt.ifRange != "" {
+			req.Header.Set("If-Range", tt.ifRange)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Fatalf("%s: status=%d want=%d", tt.name, resp.StatusCode, tt.status)
+		}
+		if !bytes.Equal(b, media[tt.from:tt.to+1]) {
+			t.Fatalf("%s: got %d bytes, want bytes %d-%d", tt.name, len(b), tt.from, tt.to)
+		}
+		if tt.status == http.StatusPartialContent {
+			if want := fmt.Sprintf("bytes %d-%d/%d", tt.from, tt.to, len(media)); resp.Header.Get("Content-Range") != want {
+				t.Fatalf("%s: Content-Range=%q want=%q", tt.name, resp.Header.Get("Content-Range"), want)
+			}
+		}
+	}
+}
+
+func TestProxy_LongPoll(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "" && strings.HasPrefix(r.URL.Path, "/api/v1/poll") {
+			t.Errorf("Accept-Encoding must not reach the upstream of a heartbeat route")
+		}
+		switch r.URL.Path {
+		case "/api/v1/poll/fail":
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		case "/api/v1/wait/forever":
+			<-r.Context().Done()
+			return
+		}
+		time.Sleep(300 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"events":[]}`))
+	}))
+	defer upstream.Close()
+
+	srv := newTestServer(t, upstream.URL, &Options{
+		Routes: routes.NewTable([]config.Route{
+			{Path: "/api/v1/poll*", LongPoll: &config.LongPoll{
+				Timeout: 5 * time.Second, Heartbeat: 50 * time.Millisecond, Payload: " ", ContentType: "application/json",
+			}},
+			{Path: "/api/v1/wait*", LongPoll: &config.LongPoll{Timeout: time.Second}},
+		}),
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		want     int
+		wantBody func(string) bool
+	}{
+		{"heartbeats then body", "/api/v1/poll/1", http.StatusOK, func(b string) bool {
+			return strings.HasPrefix(b, "  ") && strings.TrimLeft(b, " ") == `{"events":[]}`
+		}},
+		{"status before the first heartbeat", "/api/v1/poll/fail", http.StatusBadGateway, func(b string) bool { return b == "" }},
+		{"no heartbeat", "/api/v1/wait/1", http.StatusOK, func(b string) bool { return b == `{"events":[]}` }},
+		{"timeout", "/api/v1/wait/forever", http.StatusGatewayTimeout, func(string) bool { return true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+testToken(t))
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.want || !tt.wantBody(string(b)) {
+				t.Fatalf("status=%d body=%q, want %d", resp.StatusCode, b, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamProbe(t *testing.T) {
+	status := http.StatusOK
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			t.Errorf("probed %s", r.URL.Path)
+		}
+		w.WriteHeader(status)
+	}))
+	defer upstream.Close()
+
+	p, err := NewUpstreamProbe(upstream.URL+"/base", config.ReadyUpstream{
+		Mode: config.ReadyProbeHTTP, Path: "/healthz", Timeout: time.Second, CacheTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	if err := p.Check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	status = http.StatusBadGateway
+	if err := p.Check(context.Background()); err != nil {
+		t.Fatalf("cached check: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := p.Check(context.Background()); err == nil {
+		t.Fatalf("expected 502 to fail the check once the cache expired")
+	}
+
+	// a closed port fails the tcp probe
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	tcp, err := NewUpstreamProbe("http://"+addr, config.ReadyUpstream{Mode: config.ReadyProbeTCP, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := tcp.Check(context.Background()); err == nil {
+		t.Fatalf("expected tcp probe of a closed port to fail")
+	}
+}
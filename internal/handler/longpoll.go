@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/routes"
+)
+
+// longPollGrace is how long past its timeout a long-poll request may still write its (timeout) response.
+const longPollGrace = 5 * time.Second
+
+// longPoll lets requests of long_poll routes wait on the upstream for the route's timeout instead of the
+// server write timeout, and writes heartbeats while the upstream is silent.
+func (h *Proxy) longPoll(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := routes.FromContext(r.Context())
+		if !ok || rt.LongPoll == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		lp := rt.LongPoll
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(lp.Timeout + longPollGrace))
+		ctx, cancel := context.WithTimeout(r.Context(), lp.Timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		if lp.Heartbeat <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// heartbeats cannot be interleaved with a compressed body
+		r.Header.Del("Accept-Encoding")
+		hw := newHeartbeatWriter(w, rt.Path, lp)
+		defer hw.stop()
+		next.ServeHTTP(hw, r)
+	})
+}
+
+// heartbeatWriter writes the heartbeat payload every interval until the response body starts. It keeps the
+// headers of the handler apart from those of the underlying writer, which a heartbeat may send first.
+type heartbeatWriter struct {
+	w      http.ResponseWriter
+	route  string
+	lp     *config.LongPoll
+	header http.Header
+	ticker *time.Ticker
+	done   chan struct{}
+
+	mu          sync.Mutex
+	wroteHeader bool
+	early       bool // a heartbeat sent the headers
+	quiet       bool // the body started or the handler returned
+}
+
+func newHeartbeatWriter(w http.ResponseWriter, route string, lp *config.LongPoll) *heartbeatWriter {
+	hw := &heartbeatWriter{
+		w:      w,
+		route:  route,
+		lp:     lp,
+		header: http.Header{},
+		ticker: time.NewTicker(lp.Heartbeat),
+		done:   make(chan struct{}),
+	}
+	go hw.run()
+
+	return hw
+}
+
+func (hw *heartbeatWriter) run() {
+	for {
+		select {
+		case <-hw.ticker.C:
+			hw.beat()
+		case <-hw.done:
+			return
+		}
+	}
+}
+
+func (hw *heartbeatWriter) beat() {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	if hw.quiet {
+		return
+	}
+	if !hw.wroteHeader {
+		h := hw.w.Header()
+		h.Set("Content-Type", hw.lp.ContentType)
+		h.Set("Cache-Control", "no-store")
+		hw.w.WriteHeader(http.StatusOK)
+		hw.wroteHeader, hw.early = true, true
+	}
+
+	if _, err := hw.w.Write([]byte(hw.lp.Payload)); err != nil {
+		hw.quiet = true
+		return
+	}
+	_ = http.NewResponseController(hw.w).Flush()
+}
+
+// stop ends the heartbeats and sends the handler's headers if it never wrote any.
+func (hw *heartbeatWriter) stop() {
+	hw.ticker.Stop()
+	close(hw.done)
+
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.quiet = true
+	if !hw.wroteHeader {
+		copyHeader(hw.w.Header(), hw.header)
+	}
+}
+
+func (hw *heartbeatWriter) Header() http.Header {
+	return hw.header
+}
+
+func (hw *heartbeatWriter) WriteHeader(code int) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.writeHeader(code)
+}
+
+func (hw *heartbeatWriter) writeHeader(code int) {
+	if hw.early {
+		if code != http.StatusOK {
+			log.Warn().Str("route", hw.route).Int("status", code).
+				Msg("long-poll upstream status lost: a heartbeat already sent 200")
+		}
+		return
+	}
+	if hw.wroteHeader {
+		return
+	}
+
+	copyHeader(hw.w.Header(), hw.header)
+	hw.w.WriteHeader(code)
+	if code < http.StatusOK {
+		return // informational, the final status follows
+	}
+	hw.wroteHeader = true
+	// with a declared length, or no body at all, heartbeat bytes would corrupt the response
+	if hw.header.Get("Content-Length") != "" || code == http.StatusNoContent || code == http.StatusNotModified {
+		hw.quiet = true
+	}
+}
+
+func (hw *heartbeatWriter) Write(p []byte) (int, error) {
+	hw.mu.Lock()
+	if !hw.wroteHeader {
+		hw.writeHeader(http.StatusOK)
+	}
+	hw.quiet = true
+	hw.mu.Unlock()
+
+	return hw.w.Write(p)
+}
+
+func (hw *heartbeatWriter) Flush() {
+	hw.mu.Lock()
+	if !hw.wroteHeader {
+		hw.writeHeader(http.StatusOK)
+	}
+	hw.mu.Unlock()
+
+	_ = http.NewResponseController(hw.w).Flush()
+}
+
+func (hw *heartbeatWriter) Unwrap() http.ResponseWriter {
+	return hw.w
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vv := range src {
+		dst[k] = vv
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// standardMethods are listed in Allow for local OPTIONS answers of routes without methods.
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// allowMethods answers 405 for methods the matched route does not accept and, on routes with options: local,
+// answers OPTIONS itself. It runs before auth: neither answer reveals more than the route config.
+func allowMethods(metrics *mp.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt, ok := routes.FromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == http.MethodOptions && rt.Options == config.OptionsLocal && !auth.IsPreflight(r) {
+				w.Header().Set("Allow", strings.Join(allowedMethods(rt), ", "))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if len(rt.Methods) > 0 && !slices.Contains(allowedMethods(rt), r.Method) {
+				w.Header().Set("Allow", strings.Join(allowedMethods(rt), ", "))
+				gwerr.Write(w, metrics, gwerr.ErrMethodNotAllowed)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowedMethods returns the route methods with HEAD added for GET and OPTIONS always, or every standard
+// method when the route lists none.
+func allowedMethods(rt *config.Route) []string {
+	if len(rt.Methods) == 0 {
+		return standardMethods
+	}
+
+	out := slices.Clone(rt.Methods)
+	if slices.Contains(out, http.MethodGet) && !slices.Contains(out, http.MethodHead) {
+		out = append(out, http.MethodHead)
+	}
+	if !slices.Contains(out, http.MethodOptions) {
+		out = append(out, http.MethodOptions)
+	}
+
+	return out
+}
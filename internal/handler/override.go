@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// methodOverrideHeaders are the headers frameworks use to tunnel a method through POST.
+var methodOverrideHeaders = []string{"X-HTTP-Method-Override", "X-HTTP-Method", "X-Method-Override"}
+
+// overridableMethods are the methods a POST may be turned into.
+var overridableMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// methodOverride strips method override headers, or applies them on routes with method_override: honor.
+// It runs after route matching and before auth, so every check sees the method the upstream will act on.
+func methodOverride(metrics *mp.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			override := ""
+			for _, h := range methodOverrideHeaders {
+				if v := r.Header.Get(h); v != "" && override == "" {
+					override = strings.ToUpper(strings.TrimSpace(v))
+				}
+				r.Header.Del(h)
+			}
+
+			if override == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rt, ok := routes.FromContext(r.Context())
+			if !ok || rt.MethodOverride != config.MethodOverrideHonor {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method != http.MethodPost || !overridableMethods[override] {
+				gwerr.Write(w, metrics, gwerr.ErrMethodOverride)
+				return
+			}
+
+			r.Method = override
+			next.ServeHTTP(w, r)
+		})
+	}
+}
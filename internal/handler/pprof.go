@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+
+	"tyk-proxy/internal/auth"
+)
+
+// Profile label keys.
+const (
+	labelRoute  = "route"
+	labelMethod = "method"
+	labelAPIKey = "api_key"
+)
+
+// profileLabels runs the rest of the chain under pprof labels naming the route, method and hashed api_key,
+// so CPU and goroutine profiles can be broken down by customer and route. It must run after auth.
+func profileLabels(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey := ""
+		if tok, ok := auth.TokenFromContext(r.Context()); ok && tok.APIKey != "" {
+			apiKey = auth.HashAPIKey(tok.APIKey)
+		}
+
+		labels := pprof.Labels(labelRoute, routeLabel(r.Context()), labelMethod, r.Method, labelAPIKey, apiKey)
+		pprof.Do(r.Context(), labels, func(ctx context.Context) {
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
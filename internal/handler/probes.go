@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 func (h *Proxy) Health() http.HandlerFunc {
@@ -28,6 +30,14 @@ func (h *Proxy) Ready() http.HandlerFunc {
 			return
 		}
 
+		if h.upstreamProbe != nil {
+			if err := h.upstreamProbe.Check(r.Context()); err != nil {
+				log.Warn().Err(err).Msg("Not ready: upstream unreachable")
+				http.Error(w, "upstream unreachable", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ready"))
 	}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/signedurl"
+)
+
+const (
+	queryStripped = "stripped"
+	queryRejected = "rejected"
+)
+
+// filterQuery applies the route query allowlist: unknown parameters are removed from the request
+// (keeping the encoding and order of the rest) or, with unknown: reject, answered with 400. It runs
+// before capture and the response cache, so cache-busting parameters never reach a cache key.
+func filterQuery(metrics *mp.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt, ok := routes.FromContext(r.Context())
+			if !ok || rt.Query == nil || r.URL.RawQuery == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			kept, unknown := allowedQuery(r.URL.RawQuery, rt.Query.Allowed)
+			if unknown == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if rt.Query.Unknown == config.QueryUnknownReject {
+				metrics.IncQueryFiltered(rt.Path, queryRejected)
+				gwerr.Write(w, metrics, gwerr.ErrQueryParam.WithMessage("query parameter not allowed: "+unknown))
+				return
+			}
+
+			metrics.IncQueryFiltered(rt.Path, queryStripped)
+			r.URL.RawQuery = kept
+			r.RequestURI = r.URL.RequestURI()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowedQuery returns raw with only the allowed pairs left, and the first unknown parameter name if any.
+func allowedQuery(raw string, allowed []string) (string, string) {
+	var kept []string
+	unknown := ""
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if pair == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		// signed URL parameters are checked and stripped by auth
+		if queryAllowed(name, allowed) || signedurl.IsParam(name) {
+			kept = append(kept, pair)
+		} else if unknown == "" {
+			unknown = name
+		}
+	}
+
+	return strings.Join(kept, "&"), unknown
+}
+
+func queryAllowed(name string, allowed []string) bool {
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == a {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	mp "tyk-proxy/internal/metrics"
+)
+
+// observeSLO counts every proxied request, including ones rejected by auth or limits, against the SLO
+// of its route, so alerts can use plain ratios of slo_* counters instead of histogram quantiles.
+func (h *Proxy) observeSLO(metrics *mp.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if h.slo.LatencyThreshold <= 0 {
+			return next
+		}
+
+		budgetCost := 1 / (1 - h.slo.Objective)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &mp.StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r)
+
+			fast := time.Since(start) <= h.slo.LatencyThreshold
+			failed := recorder.Status >= http.StatusInternalServerError
+			metrics.ObserveSLO(routeLabel(r.Context()), fast, failed, budgetCost)
+		})
+	}
+}
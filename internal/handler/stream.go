@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+)
+
+const (
+	streamRejected   = "rejected"
+	streamTerminated = "terminated"
+)
+
+var errTooManyStreams = errors.New("too many open streams for token")
+
+// streamLimiter caps streaming responses per api_key and in duration. Counts are per proxy instance and shared by
+// all routes and upstreams.
+type streamLimiter struct {
+	contentTypes map[string]bool
+	maxPerToken  int
+	maxDuration  time.Duration
+
+	mu   sync.Mutex
+	open map[string]int
+}
+
+func newStreamLimiter(cfg config.Streaming) *streamLimiter {
+	if cfg.MaxPerToken <= 0 && cfg.MaxDuration <= 0 {
+		return nil
+	}
+
+	types := make(map[string]bool, len(cfg.ContentTypes))
+	for _, ct := range cfg.ContentTypes {
+		types[ct] = true
+	}
+
+	return &streamLimiter{
+		contentTypes: types,
+		maxPerToken:  cfg.MaxPerToken,
+		maxDuration:  cfg.MaxDuration,
+		open:         make(map[string]int),
+	}
+}
+
+// stream tracks one proxied request that may turn into a stream once the response headers arrive.
+type stream struct {
+	cancel  context.CancelFunc
+	release func()
+	timer   *time.Timer
+}
+
+type ctxKeyStream struct{}
+
+func (s *streamLimiter) isStream(resp *http.Response) bool {
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return s.contentTypes[ct]
+}
+
+// start registers a streaming response for apiKey (empty for requests without a token, which are not capped)
+// and arms the duration limit, which cancels the request context and with it the upstream read.
+func (s *streamLimiter) start(st *stream, apiKey string, metrics *mp.Metrics) error {
+	if s.maxPerToken > 0 && apiKey != "" {
+		s.mu.Lock()
+		if s.open[apiKey] >= s.maxPerToken {
+			s.mu.Unlock()
+			metrics.IncStreamsLimited(streamRejected)
+			return errTooManyStreams
+		}
+		s.open[apiKey]++
+		s.mu.Unlock()
+	}
+
+	metrics.AddOpenStreams(1)
+
+	var once sync.Once
+	st.release = func() {
+		once.Do(func() {
+			metrics.AddOpenStreams(-1)
+			if s.maxPerToken <= 0 || apiKey == "" {
+				return
+			}
+
+			s.mu.Lock()
+			if s.open[apiKey]--; s.open[apiKey] <= 0 {
+				delete(s.open, apiKey)
+			}
+			s.mu.Unlock()
+		})
+	}
+
+	if s.maxDuration > 0 {
+		st.timer = time.AfterFunc(s.maxDuration, func() {
+			metrics.IncStreamsLimited(streamTerminated)
+			st.cancel()
+		})
+	}
+
+	return nil
+}
+
+// finish releases the stream slot and the duration timer; safe to call for requests that never streamed.
+func (st *stream) finish() {
+	if st.timer != nil {
+		st.timer.Stop()
+	}
+	if st.release != nil {
+		st.release()
+	}
+}
@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/ratelimit/throttle"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/sockopt"
+	"tyk-proxy/internal/tlsconf"
+	"tyk-proxy/internal/upstreamauth"
+)
+
+// defaultPool names the connection pool of routes without their own upstream_pool.
+const defaultPool = "default"
+
+// defaultResponseHeaderTimeout bounds the wait for upstream response headers outside long-poll routes.
+const defaultResponseHeaderTimeout = 30 * time.Second
+
+const (
+	dialOK    = "ok"
+	dialError = "error"
+)
+
+// routeUpstreams are the upstream handlers of a route with its own pool or versions, by target URL.
+type routeUpstreams map[string]http.Handler
+
+// upstream proxies to the upstream of the matched route (target_host unless the route sets one), or to the
+// version upstream negotiateVersion picked, through the connection pool of the route.
+func (h *Proxy) upstream(metrics *mp.Metrics) http.Handler {
+	shared := newUpstreamTransport(defaultPool, h.pool, h.upstreamTLS[defaultPool], defaultResponseHeaderTimeout, metrics)
+	sharedHandlers := map[string]http.Handler{}
+	handlerFor := func(handlers map[string]http.Handler, target string, transport http.RoundTripper) http.Handler {
+		if _, ok := handlers[target]; !ok {
+			handlers[target] = h.proxyTo(target, transport, metrics)
+		}
+		return handlers[target]
+	}
+
+	def := handlerFor(sharedHandlers, h.target, shared)
+	byRoute := map[string]routeUpstreams{}
+	for _, rt := range h.routes.Routes() {
+		if rt.UpstreamPool == nil && rt.Versions == nil && rt.LongPoll == nil && rt.UpstreamOAuth2 == nil &&
+			rt.Upstream == "" && rt.Rewrite == nil {
+			continue
+		}
+
+		// long-poll routes wait longer for headers and get their own pool, so parked requests cannot
+		// exhaust the connections of the others
+		transport, handlers := http.RoundTripper(shared), sharedHandlers
+		if poolName(&rt) != defaultPool {
+			pool, tlsConfig, headerTimeout := h.pool, h.upstreamTLS[defaultPool], defaultResponseHeaderTimeout
+			if rt.UpstreamPool != nil {
+				pool, tlsConfig = *rt.UpstreamPool, h.upstreamTLS[rt.Path]
+			}
+			if rt.LongPoll != nil {
+				headerTimeout = rt.LongPoll.Timeout
+			}
+			transport, handlers = newUpstreamTransport(rt.Path, pool, tlsConfig, headerTimeout, metrics), map[string]http.Handler{}
+		}
+		if rt.UpstreamOAuth2 != nil {
+			creds := upstreamauth.NewClientCredentials(rt.Path, *rt.UpstreamOAuth2, metrics)
+			transport, handlers = &upstreamauth.Transport{Base: transport, Credentials: creds}, map[string]http.Handler{}
+		}
+
+		target := routeTarget(&rt, h.target)
+		ru := routeUpstreams{target: handlerFor(handlers, target, transport)}
+		if rt.Versions != nil {
+			for _, target := range rt.Versions.Upstreams {
+				ru[target] = handlerFor(handlers, target, transport)
+			}
+		}
+		byRoute[rt.Path] = ru
+	}
+
+	if len(byRoute) == 0 {
+		return def
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := routes.FromContext(r.Context())
+		if !ok || byRoute[rt.Path] == nil {
+			def.ServeHTTP(w, r)
+			return
+		}
+
+		target := routeTarget(rt, h.target)
+		if version, ok := r.Context().Value(ctxKeyVersion{}).(apiVersion); ok {
+			target = version.target
+			stripVersionSegment(r, rt.Versions)
+		}
+		rewritePath(r, rt.Rewrite)
+
+		byRoute[rt.Path][target].ServeHTTP(w, r)
+	})
+}
+
+// routeTarget is the upstream of rt, falling back to target_host.
+func routeTarget(rt *config.Route, def string) string {
+	if rt.Upstream != "" {
+		return rt.Upstream
+	}
+
+	return def
+}
+
+// rewritePath replaces the strip prefix of the request path with the add prefix. Prefixes match whole
+// segments only, so strip_prefix /users leaves /users2 alone.
+func rewritePath(r *http.Request, rw *config.Rewrite) {
+	if rw == nil {
+		return
+	}
+
+	rewrite := func(path string) (string, bool) {
+		rest, ok := strings.CutPrefix(path, rw.StripPrefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			return path, false
+		}
+		if rest == "" && rw.AddPrefix == "" {
+			rest = "/"
+		}
+		return rw.AddPrefix + rest, true
+	}
+
+	path, ok := rewrite(r.URL.Path)
+	if !ok {
+		return
+	}
+	r.URL.Path = path
+	if r.URL.RawPath != "" {
+		r.URL.RawPath, _ = rewrite(r.URL.RawPath)
+	}
+}
+
+// poolName names the connection pool of rt: long-poll routes and routes with their own upstream_pool get one
+// under the route path, the others share the default pool.
+func poolName(rt *config.Route) string {
+	if rt.UpstreamPool != nil || rt.LongPoll != nil {
+		return rt.Path
+	}
+
+	return defaultPool
+}
+
+// UpstreamThrottles caps the throughput of every upstream connection pool at application.upstream_rate_limit,
+// each with its own rate and queue, so a busy route pool cannot use up the budget of the others. It returns nil
+// when the limit is disabled.
+func UpstreamThrottles(app config.Application) map[string]*throttle.Throttle {
+	ul := app.UpstreamRateLimit
+	if ul.RPS <= 0 {
+		return nil
+	}
+
+	opts := throttle.Options{RPS: ul.RPS, QueueDepth: ul.QueueDepth, MaxWait: ul.MaxWait}
+	throttles := map[string]*throttle.Throttle{defaultPool: throttle.New(opts)}
+	for i := range app.Routes {
+		if pool := poolName(&app.Routes[i]); pool != defaultPool {
+			throttles[pool] = throttle.New(opts)
+		}
+	}
+
+	return throttles
+}
+
+// UpstreamTLS loads the TLS settings of the upstream pools that have them: the application pool under "default",
+// route pools under the route path.
+func UpstreamTLS(app config.Application) (map[string]*tls.Config, error) {
+	pools := map[string]config.UpstreamPool{defaultPool: app.UpstreamPool}
+	for _, rt := range app.Routes {
+		if rt.UpstreamPool != nil {
+			pools[rt.Path] = *rt.UpstreamPool
+		}
+	}
+
+	configs := map[string]*tls.Config{}
+	for name, pool := range pools {
+		cfg, err := tlsconf.Client(pool.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("upstream pool %s: %w", name, err)
+		}
+		if cfg != nil {
+			configs[name] = cfg
+		}
+	}
+
+	return configs, nil
+}
+
+// newUpstreamTransport returns the transport of a pool; tlsConfig nil keeps the default TLS settings.
+func newUpstreamTransport(pool string, cfg config.UpstreamPool, tlsConfig *tls.Config, headerTimeout time.Duration, metrics *mp.Metrics) http.RoundTripper {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	sockopt.Configure(dialer, cfg.Socket, 30*time.Second)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := sockopt.Apply(conn, cfg.Socket); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           countingDial(pool, cfg.MaxConnLifetime, dial, metrics),
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		ResponseHeaderTimeout: headerTimeout,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+		// the client's Accept-Encoding goes upstream as is; transparent gzip would break Content-Range and ETags
+		DisableCompression: true,
+	}
+	if cfg.MaxConnLifetime > 0 {
+		return lifetimeTransport{transport}
+	}
+
+	return transport
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// countingDial tracks the open connections of pool in upstream_open_connections and stamps them with
+// their retirement time when lifetime is set.
+func countingDial(pool string, lifetime time.Duration, dial dialFunc, metrics *mp.Metrics) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			metrics.IncUpstreamDial(pool, dialError)
+			return nil, err
+		}
+
+		metrics.IncUpstreamDial(pool, dialOK)
+		metrics.AddUpstreamConns(pool, 1)
+		c := &countedConn{Conn: conn, onClose: func() { metrics.AddUpstreamConns(pool, -1) }}
+		if lifetime > 0 {
+			// jitter keeps connections opened together from being retired together
+			c.retireAt = time.Now().Add(lifetime + rand.N(lifetime/10+1))
+		}
+		return c, nil
+	}
+}
+
+type countedConn struct {
+	net.Conn
+	once     sync.Once
+	onClose  func()
+	retireAt time.Time // zero means never
+}
+
+func (c *countedConn) expired() bool {
+	return !c.retireAt.IsZero() && time.Now().After(c.retireAt)
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(c.onClose)
+	return c.Conn.Close()
+}
+
+// lifetimeTransport retires connections past their lifetime: a request that gets one asks the upstream to
+// close it after the response (Connection: close), so it is never reused. HTTP/2 connections are exempt.
+type lifetimeTransport struct {
+	*http.Transport
+}
+
+func (t lifetimeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := req.Header
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+		conn := info.Conn
+		if tc, ok := conn.(*tls.Conn); ok {
+			conn = tc.NetConn()
+		}
+		if c, ok := conn.(*countedConn); ok && c.expired() {
+			header.Set("Connection", "close")
+		}
+	}}
+
+	return t.Transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
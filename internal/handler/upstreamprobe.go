@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+// UpstreamProbe checks that the upstream is reachable for the readiness probe. Results are cached for the
+// configured TTL; concurrent checks wait for the one probing.
+type UpstreamProbe struct {
+	cfg    config.ReadyUpstream
+	addr   string // host:port for tcp
+	url    string // for http
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func NewUpstreamProbe(target string, cfg config.ReadyUpstream) (*UpstreamProbe, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("upstream probe: invalid target %q", target)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return &UpstreamProbe{
+		cfg:  cfg,
+		addr: addr,
+		url:  u.Scheme + "://" + u.Host + cfg.Path,
+		client: &http.Client{
+			// a redirect answers too; following it could probe another host
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		now: time.Now,
+	}, nil
+}
+
+// Check reports why the upstream is unreachable, or nil.
+func (p *UpstreamProbe) Check(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.checked.IsZero() && p.now().Sub(p.checked) < p.cfg.CacheTTL {
+		return p.err
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	err := p.probe(probeCtx)
+	if ctx.Err() != nil {
+		// the caller went away; that says nothing about the upstream
+		return err
+	}
+	p.checked, p.err = p.now(), err
+
+	return err
+}
+
+func (p *UpstreamProbe) probe(ctx context.Context) error {
+	if p.cfg.Mode != config.ReadyProbeHTTP {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", p.addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("upstream answered %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+)
+
+// Reasons for URL limit rejections, counted with the path rejections.
+const (
+	reasonURLTooLong         = "url_too_long"
+	reasonTooManyQueryParams = "too_many_query_params"
+)
+
+// limitURL rejects request targets longer than maxURLLength with 414 and queries with more than
+// maxQueryParams parameters with 400, before anything parses or logs them. Zero disables a limit.
+func (h *Proxy) limitURL(metrics *mp.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h.maxURLLength > 0 && len(r.RequestURI) > h.maxURLLength {
+				metrics.IncPathRejected(reasonURLTooLong)
+				gwerr.Write(w, metrics, gwerr.ErrURITooLong)
+				return
+			}
+
+			if h.maxQueryParams > 0 && queryParams(r.URL.RawQuery) > h.maxQueryParams {
+				metrics.IncPathRejected(reasonTooManyQueryParams)
+				gwerr.Write(w, metrics, gwerr.ErrTooManyQueryParams)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// queryParams counts the non-empty key=value pairs of a raw query the way url.ParseQuery splits them.
+func queryParams(raw string) int {
+	n := 0
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if pair != "" {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+const versionUnsupported = "unsupported"
+
+// versionSegment is what an unconfigured version in the path looks like; other segments are part of the resource.
+var versionSegment = regexp.MustCompile(`^[vV][0-9]`)
+
+type ctxKeyVersion struct{}
+
+// apiVersion is the upstream version a request was routed to.
+type apiVersion struct {
+	name   string // as configured in versions.upstreams
+	target string
+}
+
+// negotiateVersion resolves the API version of requests on versioned routes and answers 406 for versions
+// without an upstream. It runs before auth, so requests that cannot be served never count against quotas.
+func negotiateVersion(metrics *mp.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt, ok := routes.FromContext(r.Context())
+			if !ok || rt.Versions == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			v := rt.Versions
+			requested, fromPath := pathVersion(r.URL.Path, v)
+			if !fromPath {
+				// the response depends on the version headers, so shared caches must key on them
+				w.Header().Add("Vary", strings.Join(v.Headers, ", "))
+				requested = headerVersion(r.Header, v.Headers)
+			}
+			if requested == "" {
+				requested = v.Default
+			}
+
+			name, target, ok := lookupVersion(v, requested)
+			if !ok {
+				metrics.IncAPIVersion(rt.Path, versionUnsupported)
+				if requested == "" {
+					gwerr.Write(w, metrics, gwerr.ErrVersion.WithMessage("API version required"))
+				} else {
+					gwerr.Write(w, metrics, gwerr.ErrVersion.WithMessage("unsupported API version: "+requested))
+				}
+				return
+			}
+
+			metrics.IncAPIVersion(rt.Path, name)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyVersion{}, apiVersion{name: name, target: target})))
+		})
+	}
+}
+
+// pathVersion returns the version segment of path, if the route reads one and path has it.
+func pathVersion(path string, v *config.Versioning) (string, bool) {
+	if v.Segment == 0 {
+		return "", false
+	}
+
+	segment := pathSegment(path, v.Segment)
+	if segment == "" {
+		return "", false
+	}
+	if _, _, ok := lookupVersion(v, segment); !ok && !versionSegment.MatchString(segment) {
+		return "", false
+	}
+
+	return segment, true
+}
+
+func headerVersion(h http.Header, names []string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(h.Get(name)); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func lookupVersion(v *config.Versioning, requested string) (string, string, bool) {
+	id := config.VersionID(requested)
+	if id == "" {
+		return "", "", false
+	}
+
+	for name, target := range v.Upstreams {
+		if config.VersionID(name) == id {
+			return name, target, true
+		}
+	}
+
+	return "", "", false
+}
+
+// pathSegment returns the n-th (1-based) segment of path, or "" if it has fewer.
+func pathSegment(path string, n int) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if n > len(segments) {
+		return ""
+	}
+
+	return segments[n-1]
+}
+
+// withoutSegment removes the n-th (1-based) segment from path.
+func withoutSegment(path string, n int) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if n > len(segments) {
+		return path
+	}
+
+	return "/" + strings.Join(append(segments[:n-1:n-1], segments[n:]...), "/")
+}
+
+// stripVersionSegment removes the version segment from the request path when the route asks for it.
+func stripVersionSegment(r *http.Request, v *config.Versioning) {
+	if !v.StripSegment {
+		return
+	}
+	if _, fromPath := pathVersion(r.URL.Path, v); !fromPath {
+		return
+	}
+
+	r.URL.Path = withoutSegment(r.URL.Path, v.Segment)
+	if r.URL.RawPath != "" {
+		r.URL.RawPath = withoutSegment(r.URL.RawPath, v.Segment)
+	}
+}
@@ -0,0 +1,121 @@
+// Package hooks runs side effects of completed requests, such as webhooks and usage records, off the hot path.
+// Middleware queues an event once the response is written and a pool of workers hands it to every hook, so a
+// slow hook never adds latency to a response. Events that do not fit the queue are dropped and counted.
+package hooks
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/async"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+const (
+	resultOK      = "ok"
+	resultFailed  = "failed"
+	resultDropped = "dropped"
+
+	queueName = "hooks"
+)
+
+// Event describes a completed API request.
+type Event struct {
+	RequestID  string    `json:"request_id,omitempty"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route,omitempty"` // matched route path
+	Status     int       `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	APIKey     string    `json:"api_key,omitempty"` // as logged: hashed unless configured otherwise
+	Auth       string    `json:"auth,omitempty"`    // decision.Auth* outcome
+	Upstream   string    `json:"upstream,omitempty"`
+}
+
+// Hook handles events on a worker; errors are counted, not retried.
+type Hook interface {
+	Name() string
+	Handle(ctx context.Context, ev Event) error
+}
+
+// Queue hands events to hooks from cfg.Workers goroutines, holding at most cfg.QueueSize waiting events.
+type Queue struct {
+	hooks   []Hook
+	metrics *mp.Metrics
+	events  *async.Queue[Event]
+}
+
+func New(cfg config.Hooks, hooks []Hook, metrics *mp.Metrics) *Queue {
+	q := &Queue{hooks: hooks, metrics: metrics}
+	q.events = async.New(queueName, cfg.QueueSize, cfg.Workers, q.handle, metrics)
+
+	return q
+}
+
+// Middleware queues an event for every request once its response is written. It must run after
+// decision.Middleware to report the caller's api key.
+func (q *Queue) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ev := Event{
+			RequestID:  middleware.GetReqID(r.Context()),
+			Time:       start.UTC(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     status,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if rt, ok := routes.FromContext(r.Context()); ok {
+			ev.Route = rt.Path
+		}
+		if d := decision.FromContext(r.Context()); d != nil {
+			ev.APIKey, ev.Auth, ev.Upstream = d.APIKey, d.Auth, d.Upstream
+		}
+
+		q.Enqueue(ev)
+	})
+}
+
+// Enqueue queues ev without blocking, reporting whether it fit.
+func (q *Queue) Enqueue(ev Event) bool {
+	if q.events.Push(ev) {
+		return true
+	}
+
+	for _, h := range q.hooks {
+		q.metrics.IncHookEvent(h.Name(), resultDropped)
+	}
+	return false
+}
+
+func (q *Queue) handle(ev Event) {
+	for _, h := range q.hooks {
+		if err := h.Handle(context.Background(), ev); err != nil {
+			log.Debug().Err(err).Str("hook", h.Name()).Str("request_id", ev.RequestID).Msg("hook failed")
+			q.metrics.IncHookEvent(h.Name(), resultFailed)
+			continue
+		}
+		q.metrics.IncHookEvent(h.Name(), resultOK)
+	}
+}
+
+// Close handles the queued events and stops the workers. Events queued afterwards are dropped.
+func (q *Queue) Close() {
+	q.events.Close()
+}
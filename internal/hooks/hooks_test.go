@@ -0,0 +1,162 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	"tyk-proxy/internal/routes"
+)
+
+type fakeHook struct {
+	mu     sync.Mutex
+	events []Event
+	block  chan struct{} // when set, Handle waits for it
+}
+
+func (f *fakeHook) Name() string { return "fake" }
+
+func (f *fakeHook) Handle(_ context.Context, ev Event) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, ev)
+	return nil
+}
+
+func TestQueue_Middleware(t *testing.T) {
+	hook := &fakeHook{}
+	q := New(config.Hooks{Workers: 2, QueueSize: 10}, []Hook{hook}, nil)
+
+	table := routes.NewTable([]config.Route{{Path: "/api/v1/orders*"}})
+	h := table.Middleware(decision.Middleware(q.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision.FromContext(r.Context()).SetAPIKey("hashed-key")
+		w.WriteHeader(http.StatusCreated)
+	}))))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/orders/1", nil))
+	q.Close()
+
+	if len(hook.events) != 1 {
+		t.Fatalf("events=%d want 1", len(hook.events))
+	}
+	ev := hook.events[0]
+	if ev.Method != http.MethodPost || ev.Path != "/api/v1/orders/1" || ev.Route != "/api/v1/orders*" ||
+		ev.Status != http.StatusCreated || ev.APIKey != "hashed-key" {
+		t.Fatalf("event=%+v", ev)
+	}
+}
+
+func TestQueue_DropsWhenFull(t *testing.T) {
+	hook := &fakeHook{block: make(chan struct{})}
+	q := New(config.Hooks{Workers: 1, QueueSize: 1}, []Hook{hook}, nil)
+
+	// the worker takes one event and blocks on it, the queue holds the next
+	if !q.Enqueue(Event{Path: "/1"}) {
+		t.Fatal("first event must be queued")
+	}
+	deadline := time.Now().Add(time.Second)
+	for q.events.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !q.Enqueue(Event{Path: "/2"}) {
+		t.Fatal("second event must be queued")
+	}
+	if q.Enqueue(Event{Path: "/3"}) {
+		t.Fatal("expected a full queue to drop the event")
+	}
+
+	close(hook.block)
+	q.Close()
+	if len(hook.events) != 2 {
+		t.Fatalf("events=%d want the 2 queued ones", len(hook.events))
+	}
+}
+
+func TestWebhook_Handle(t *testing.T) {
+	var got []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got = append(got, ev)
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(config.Webhook{
+		Name:      "errors",
+		URL:       srv.URL,
+		Routes:    []string{"/api/v1/orders*"},
+		MinStatus: 400,
+		Timeout:   time.Second,
+		Headers:   map[string]string{"X-Api-Key": "secret"},
+	})
+
+	for _, ev := range []Event{
+		{Route: "/api/v1/orders*", Status: 502},
+		{Route: "/api/v1/orders*", Status: 200},
+		{Route: "/api/v1/other*", Status: 500},
+	} {
+		if err := wh.Handle(context.Background(), ev); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+	}
+	if len(got) != 1 || got[0].Status != 502 {
+		t.Fatalf("delivered=%+v want only the failed orders request", got)
+	}
+
+	wh.cfg.Headers = nil
+	if err := wh.Handle(context.Background(), Event{Route: "/api/v1/orders*", Status: 500}); err == nil {
+		t.Fatal("expected error for a non-2xx answer")
+	}
+}
+
+func TestUsage_Handle(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	u := NewUsage(rdb, config.Usage{Enabled: true, Prefix: "usage:", Retention: time.Hour})
+	ts := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	for _, ev := range []Event{
+		{Time: ts, APIKey: "k1", Route: "/api/v1/orders*"},
+		{Time: ts, APIKey: "k1", Route: "/api/v1/orders*"},
+		{Time: ts, APIKey: "k1"},
+		{Time: ts}, // unauthenticated, not counted
+	} {
+		if err := u.Handle(context.Background(), ev); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+	}
+
+	key := "usage:k1:2026-03-01"
+	if got := mr.HGet(key, "/api/v1/orders*"); got != "2" {
+		t.Fatalf("route count=%q want 2", got)
+	}
+	if got := mr.HGet(key, usageAllRoutes); got != "1" {
+		t.Fatalf("unrouted count=%q want 1", got)
+	}
+	if ttl := mr.TTL(key); ttl != time.Hour {
+		t.Fatalf("ttl=%v want 1h", ttl)
+	}
+	if len(mr.Keys()) != 1 {
+		t.Fatalf("keys=%v want only %s", mr.Keys(), key)
+	}
+}
@@ -0,0 +1,55 @@
+package hooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/config"
+)
+
+const (
+	usageHook = "usage"
+
+	// usageAllRoutes is the field of requests outside configured routes.
+	usageAllRoutes = "*"
+)
+
+// Usage counts requests of authenticated callers in a Redis hash per api_key and UTC day
+// (<prefix><api_key>:<yyyy-mm-dd>), with a field per route.
+type Usage struct {
+	rdcl redis.UniversalClient
+	cfg  config.Usage
+}
+
+func NewUsage(rdcl redis.UniversalClient, cfg config.Usage) *Usage {
+	return &Usage{rdcl: rdcl, cfg: cfg}
+}
+
+func (u *Usage) Name() string {
+	return usageHook
+}
+
+func (u *Usage) Handle(ctx context.Context, ev Event) error {
+	if ev.APIKey == "" {
+		return nil
+	}
+
+	field := ev.Route
+	if field == "" {
+		field = usageAllRoutes
+	}
+	key := u.cfg.Prefix + ev.APIKey + ":" + ev.Time.UTC().Format(time.DateOnly)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := u.rdcl.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HIncrBy(ctx, key, field, 1)
+		p.Expire(ctx, key, u.cfg.Retention)
+		return nil
+	})
+
+	return err
+}
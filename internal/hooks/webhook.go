@@ -0,0 +1,63 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"tyk-proxy/internal/config"
+)
+
+// Webhook POSTs each matching event to a URL as a JSON object. A response outside 2xx fails the event.
+type Webhook struct {
+	cfg    config.Webhook
+	client *http.Client
+}
+
+func NewWebhook(cfg config.Webhook) *Webhook {
+	return &Webhook{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (wh *Webhook) Name() string {
+	return wh.cfg.Name
+}
+
+func (wh *Webhook) Handle(ctx context.Context, ev Event) error {
+	if ev.Status < wh.cfg.MinStatus {
+		return nil
+	}
+	if len(wh.cfg.Routes) > 0 && !slices.Contains(wh.cfg.Routes, ev.Route) {
+		return nil
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.cfg.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range wh.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body) // lets the connection be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package inflight
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"tyk-proxy/internal/auth"
+)
+
+// Registry tracks in-flight requests per api_key (count and start times) so they can be inspected and cancelled
+// together, e.g. when a key is killed. It is per proxy instance.
+type Registry struct {
+	onChange func(requests, keys int)
+	now      func() time.Time
+
+	mu    sync.Mutex
+	next  uint64
+	total int
+	keys  map[string]map[uint64]request
+}
+
+type request struct {
+	cancel context.CancelFunc
+	start  time.Time
+}
+
+type Options struct {
+	// OnChange is called with the number of in-flight requests and keys whenever they change, under the registry lock.
+	OnChange func(requests, keys int)
+
+	// for tests
+	Now func() time.Time
+}
+
+// KeyStats describes the in-flight requests of one api_key.
+type KeyStats struct {
+	APIKey      string    `json:"api_key"`
+	Count       int       `json:"count"`
+	OldestStart time.Time `json:"oldest_start"`
+}
+
+func New(opts Options) *Registry {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Registry{
+		onChange: opts.OnChange,
+		now:      now,
+		keys:     make(map[string]map[uint64]request),
+	}
+}
+
+// Track registers a request for apiKey and returns its cancellable context and a done func that must be called
+// when the request ends.
+func (r *Registry) Track(ctx context.Context, apiKey string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r.mu.Lock()
+	r.next++
+	id := r.next
+	if r.keys[apiKey] == nil {
+		r.keys[apiKey] = make(map[uint64]request)
+	}
+	r.keys[apiKey][id] = request{cancel: cancel, start: r.now()}
+	r.total++
+	r.changed()
+	r.mu.Unlock()
+
+	return ctx, func() {
+		cancel()
+
+		r.mu.Lock()
+		if reqs := r.keys[apiKey]; reqs != nil {
+			if _, ok := reqs[id]; ok {
+				delete(reqs, id)
+				r.total--
+			}
+			if len(reqs) == 0 {
+				delete(r.keys, apiKey)
+			}
+			r.changed()
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Cancel cancels every in-flight request of apiKey and returns how many there were.
+func (r *Registry) Cancel(apiKey string) int {
+	r.mu.Lock()
+	reqs := r.keys[apiKey]
+	delete(r.keys, apiKey)
+	r.total -= len(reqs)
+	r.changed()
+	r.mu.Unlock()
+
+	for _, req := range reqs {
+		req.cancel()
+	}
+
+	return len(reqs)
+}
+
+// Snapshot returns per-key stats, busiest keys first.
+func (r *Registry) Snapshot() []KeyStats {
+	r.mu.Lock()
+	out := make([]KeyStats, 0, len(r.keys))
+	for key, reqs := range r.keys {
+		st := KeyStats{APIKey: key, Count: len(reqs)}
+		for _, req := range reqs {
+			if st.OldestStart.IsZero() || req.start.Before(st.OldestStart) {
+				st.OldestStart = req.start
+			}
+		}
+		out = append(out, st)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].APIKey < out[j].APIKey
+	})
+
+	return out
+}
+
+func (r *Registry) changed() {
+	if r.onChange != nil {
+		r.onChange(r.total, len(r.keys))
+	}
+}
+
+// Middleware tracks authenticated requests; it must run after auth. Cancelling a request aborts the upstream
+// call and, once the response has started, drops the client connection.
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tok, ok := auth.TokenFromContext(req.Context())
+		if !ok || tok.APIKey == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		ctx, done := r.Track(req.Context(), tok.APIKey)
+		defer done()
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
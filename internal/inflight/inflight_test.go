@@ -0,0 +1,77 @@
+package inflight
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRegistry_CancelByKey(t *testing.T) {
+	r := New(Options{})
+
+	ctx1, done1 := r.Track(context.Background(), "k1")
+	ctx2, done2 := r.Track(context.Background(), "k1")
+	ctx3, done3 := r.Track(context.Background(), "k2")
+	defer done1()
+	defer done2()
+	defer done3()
+
+	if n := r.Cancel("k1"); n != 2 {
+		t.Fatalf("cancelled=%d want=2", n)
+	}
+	if ctx1.Err() == nil || ctx2.Err() == nil {
+		t.Fatalf("k1 requests should be cancelled")
+	}
+	if ctx3.Err() != nil {
+		t.Fatalf("k2 request must not be cancelled")
+	}
+	if n := r.Cancel("k1"); n != 0 {
+		t.Fatalf("second cancel=%d want=0", n)
+	}
+}
+
+func TestRegistry_DoneUntracks(t *testing.T) {
+	r := New(Options{})
+
+	_, done := r.Track(context.Background(), "k1")
+	done()
+
+	if n := r.Cancel("k1"); n != 0 {
+		t.Fatalf("cancelled=%d want=0 after done", n)
+	}
+}
+
+func TestRegistry_SnapshotAndGauge(t *testing.T) {
+	var requests, keys int
+	now := time.Unix(1000, 0)
+	r := New(Options{
+		OnChange: func(n, k int) { requests, keys = n, k },
+		Now:      func() time.Time { return now },
+	})
+
+	_, done1 := r.Track(context.Background(), "k1")
+	now = now.Add(time.Second)
+	_, done2 := r.Track(context.Background(), "k1")
+	_, done3 := r.Track(context.Background(), "k2")
+	defer done3()
+
+	if requests != 3 || keys != 2 {
+		t.Fatalf("gauge=%d/%d want 3 requests over 2 keys", requests, keys)
+	}
+
+	snap := r.Snapshot()
+	if len(snap) != 2 || snap[0].APIKey != "k1" || snap[0].Count != 2 || !snap[0].OldestStart.Equal(time.Unix(1000, 0)) {
+		t.Fatalf("snapshot=%+v", snap)
+	}
+
+	done1()
+	done2()
+	if requests != 1 || keys != 1 {
+		t.Fatalf("gauge=%d/%d want 1 request over 1 key", requests, keys)
+	}
+
+	r.Cancel("k2")
+	if requests != 0 || keys != 0 {
+		t.Fatalf("gauge=%d/%d want empty after cancel", requests, keys)
+	}
+}
@@ -0,0 +1,179 @@
+// Package logship ships structured access and audit events to Kafka or an HTTP collector.
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/async"
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+)
+
+const (
+	TypeAccess = "access"
+	TypeAudit  = "audit"
+
+	resultShipped = "shipped"
+	resultDropped = "dropped"
+	resultFailed  = "failed"
+
+	// sendAttempts bounds retries of a batch; while they run the queue fills and new events are dropped
+	sendAttempts   = 3
+	sendTimeout    = 10 * time.Second
+	defaultBackoff = 500 * time.Millisecond
+
+	queueName = "log_shipping"
+)
+
+// Sink delivers a batch of JSON-encoded events.
+type Sink interface {
+	Send(ctx context.Context, batch [][]byte) error
+	Close() error
+}
+
+type envelope struct {
+	Type  string `json:"type"`
+	Event any    `json:"event"`
+}
+
+// AccessEvent is one completed request.
+type AccessEvent struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	DurationMs float64   `json:"duration_ms"`
+	Remote     string    `json:"remote"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// Shipper queues events and sends them to a Sink in batches from a background goroutine, so a slow
+// collector never delays traffic; events that do not fit the buffer are dropped and counted.
+type Shipper struct {
+	sink    Sink
+	metrics *mp.Metrics
+	queue   *async.Queue[[]byte]
+
+	// for tests
+	backoff time.Duration
+}
+
+type Options struct {
+	// Backoff is the first delay between attempts to send a failed batch; for tests
+	Backoff time.Duration
+}
+
+func New(cfg config.LogShipping, sink Sink, metrics *mp.Metrics) *Shipper {
+	s := &Shipper{
+		sink:    sink,
+		metrics: metrics,
+		backoff: defaultBackoff,
+	}
+
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	s.queue = async.NewBatching(queueName, cfg.BufferSize, cfg.BatchSize, interval, s.send, metrics)
+
+	return s
+}
+
+func (s *Shipper) WithOptions(opts *Options) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	s.backoff = backoff
+}
+
+// Ship queues an event of the given type without blocking.
+func (s *Shipper) Ship(typ string, ev any) {
+	b, err := json.Marshal(envelope{Type: typ, Event: ev})
+	if err != nil {
+		log.Debug().Err(err).Str("type", typ).Msg("log event marshal failed")
+		s.metrics.AddLogShipEvents(resultFailed, 1)
+		return
+	}
+
+	// audit events may still arrive from background goroutines after Close; they are dropped
+	if !s.queue.Push(b) {
+		s.metrics.AddLogShipEvents(resultDropped, 1)
+	}
+}
+
+// Audit ships an audit event; it fits audit.Options.OnRecord.
+func (s *Shipper) Audit(ev audit.Event) {
+	s.Ship(TypeAudit, ev)
+}
+
+// Middleware ships an access event for every request.
+func (s *Shipper) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.Ship(TypeAccess, AccessEvent{
+			Time:       start.UTC(),
+			RequestID:  middleware.GetReqID(r.Context()),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     status,
+			Bytes:      ww.BytesWritten(),
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			Remote:     r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		})
+	})
+}
+
+func (s *Shipper) send(batch [][]byte) {
+	backoff := s.backoff
+
+	var err error
+	for attempt := 1; attempt <= sendAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err = s.sink.Send(ctx, batch)
+		cancel()
+
+		if err == nil {
+			s.metrics.AddLogShipEvents(resultShipped, len(batch))
+			return
+		}
+
+		if attempt < sendAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	log.Warn().Err(err).Int("events", len(batch)).Msg("log shipping failed, batch dropped")
+	s.metrics.AddLogShipEvents(resultFailed, len(batch))
+}
+
+// Close flushes queued events and closes the sink. Events shipped afterwards are dropped.
+func (s *Shipper) Close() error {
+	s.queue.Close()
+
+	return s.sink.Close()
+}
@@ -0,0 +1,150 @@
+package logship
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/audit"
+	"tyk-proxy/internal/config"
+)
+
+type fakeSink struct {
+	mu      sync.Mutex
+	batches [][][]byte
+	fails   int
+	block   chan struct{}
+	calls   int
+}
+
+func (f *fakeSink) Send(_ context.Context, batch [][]byte) error {
+	if f.block != nil {
+		<-f.block
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.fails > 0 {
+		f.fails--
+		return errors.New("collector down")
+	}
+	f.batches = append(f.batches, batch)
+	return nil
+}
+
+func (f *fakeSink) Close() error { return nil }
+
+func (f *fakeSink) events() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, b := range f.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestShipper_BatchesBySizeAndFlushesOnClose(t *testing.T) {
+	sink := &fakeSink{}
+	s := New(config.LogShipping{BatchSize: 2, FlushInterval: time.Hour, BufferSize: 10}, sink, nil)
+
+	for range 5 {
+		s.Ship(TypeAccess, AccessEvent{Path: "/api/v1/x"})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if len(sink.batches) != 3 || len(sink.batches[0]) != 2 || len(sink.batches[2]) != 1 {
+		t.Fatalf("batches=%d, want sizes 2,2,1", len(sink.batches))
+	}
+
+	var env struct {
+		Type  string      `json:"type"`
+		Event AccessEvent `json:"event"`
+	}
+	if err := json.Unmarshal(sink.batches[0][0], &env); err != nil || env.Type != TypeAccess || env.Event.Path != "/api/v1/x" {
+		t.Fatalf("event=%s err=%v", sink.batches[0][0], err)
+	}
+}
+
+func TestShipper_FlushesOnInterval(t *testing.T) {
+	sink := &fakeSink{}
+	s := New(config.LogShipping{BatchSize: 100, FlushInterval: 10 * time.Millisecond, BufferSize: 10}, sink, nil)
+	defer s.Close()
+
+	s.Audit(audit.Event{Action: "flag.set"})
+
+	deadline := time.Now().Add(time.Second)
+	for sink.events() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("event not flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShipper_DropsWhenFullAndRetries(t *testing.T) {
+	sink := &fakeSink{fails: 2, block: make(chan struct{})}
+	s := New(config.LogShipping{BatchSize: 1, FlushInterval: time.Hour, BufferSize: 2}, sink, nil)
+	s.WithOptions(&Options{Backoff: time.Millisecond})
+
+	// the first event is taken by the sender and blocks in Send; two fill the buffer, the rest drop
+	s.Ship(TypeAccess, AccessEvent{})
+	time.Sleep(20 * time.Millisecond)
+	for range 5 {
+		s.Ship(TypeAccess, AccessEvent{})
+	}
+	close(sink.block)
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	// the first batch succeeds on its third attempt
+	if got := sink.events(); got != 3 {
+		t.Fatalf("shipped=%d want=3", got)
+	}
+	if sink.calls != 5 {
+		t.Fatalf("sink calls=%d want=5", sink.calls)
+	}
+
+	s.Ship(TypeAccess, AccessEvent{}) // after Close: dropped, not a panic
+}
+
+func TestHTTPSink_PostsNDJSON(t *testing.T) {
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "k" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(config.LogShippingHTTP{URL: srv.URL, Timeout: time.Second, Headers: map[string]string{"X-Api-Key": "k"}})
+	if err := sink.Send(context.Background(), [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(lines) != 2 || lines[1] != `{"b":2}` {
+		t.Fatalf("lines=%q", lines)
+	}
+
+	bad := NewHTTPSink(config.LogShippingHTTP{URL: srv.URL, Timeout: time.Second})
+	if err := bad.Send(context.Background(), [][]byte{[]byte(`{}`)}); err == nil {
+		t.Fatalf("expected error on 401")
+	}
+}
@@ -0,0 +1,99 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/segmentio/kafka-go"
+
+	"tyk-proxy/internal/config"
+)
+
+// KafkaSink publishes each event as a message; a batch is written in one request.
+type KafkaSink struct {
+	w *kafka.Writer
+}
+
+func NewKafkaSink(brokers []string, topic string, batchSize int) *KafkaSink {
+	return &KafkaSink{w: &kafka.Writer{
+		Addr:      kafka.TCP(brokers...),
+		Topic:     topic,
+		Balancer:  &kafka.LeastBytes{},
+		BatchSize: batchSize,
+	}}
+}
+
+func (s *KafkaSink) Send(ctx context.Context, batch [][]byte) error {
+	msgs := make([]kafka.Message, len(batch))
+	for i, b := range batch {
+		msgs[i] = kafka.Message{Value: b}
+	}
+
+	return s.w.WriteMessages(ctx, msgs...)
+}
+
+func (s *KafkaSink) Close() error {
+	return s.w.Close()
+}
+
+// HTTPSink posts a batch as newline-delimited JSON; any 2xx accepts it.
+type HTTPSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewHTTPSink(cfg config.LogShippingHTTP) *HTTPSink {
+	return &HTTPSink{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (s *HTTPSink) Send(ctx context.Context, batch [][]byte) error {
+	var body bytes.Buffer
+	for _, b := range batch {
+		body.Write(b)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("log collector answered %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (s *HTTPSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// NewSink builds the sink selected in the log shipping config.
+func NewSink(cfg config.LogShipping) Sink {
+	if cfg.Sink == config.LogSinkKafka {
+		return NewKafkaSink(cfg.Kafka.Brokers, cfg.Kafka.Topic, cfg.BatchSize)
+	}
+
+	return NewHTTPSink(cfg.HTTP)
+}
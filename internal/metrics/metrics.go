@@ -1,13 +1,18 @@
 package metrics
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus"
+
+	"tyk-proxy/internal/config"
 )
 
 const (
@@ -17,9 +22,131 @@ const (
 	labelPath    = "path"
 	labelMethod  = "method"
 	labelCode    = "code"
+	labelAuthz   = "authorizer"
+	labelResult  = "result"
+	labelRoute   = "route"
+	labelDir     = "direction"
+	labelReason  = "reason"
+	labelTier    = "tier"
+	labelVersion = "version"
+	labelPool    = "pool"
+	labelRes     = "resource"
+	labelExp     = "experiment"
+	labelBucket  = "bucket"
+	labelPatt    = "pattern"
+	labelRule    = "rule"
+	labelAction  = "action"
+	labelHook    = "hook"
+	labelQueue   = "queue"
 
 	metricLatencySum = "request_latency_sum"
 	metricLatencyHis = "request_latency_his"
+	metricAuthz      = "authz_decisions_total"
+
+	metricUpstreamQueue = "upstream_throttle_queue_depth"
+	metricUpstreamShed  = "upstream_throttle_shed_total"
+
+	metricProxiedBytes = "proxied_bytes_total"
+
+	metricDecompressionRejected = "request_decompression_rejected_total"
+
+	metricCaptureRecords = "capture_records_total"
+
+	metricRedisDegraded = "redis_degraded"
+
+	metricFairQueueDepth = "fair_queue_depth"
+
+	metricFairQueueShed = "fair_queue_shed_total"
+
+	metricSLORequests = "slo_requests_total"
+	metricSLOFast     = "slo_requests_within_latency_total"
+	metricSLOErrors   = "slo_requests_errors_total"
+	metricSLOBurn     = "slo_error_budget_burn_total"
+
+	metricLogShipEvents = "log_ship_events_total"
+
+	metricAnalyticsRecords = "analytics_records_total"
+
+	metricHookEvents = "hook_events_total"
+
+	metricAsyncDepth    = "async_queue_depth"
+	metricAsyncCapacity = "async_queue_capacity"
+	metricAsyncDropped  = "async_queue_dropped_total"
+	metricAsyncWorkers  = "async_workers"
+	metricAsyncBusy     = "async_workers_busy"
+
+	metricPathRejected = "request_path_rejected_total"
+
+	metricOpenStreams = "open_streams"
+
+	metricStreamsLimited = "streams_limited_total"
+
+	metricInFlightRequests = "inflight_requests"
+	metricInFlightKeys     = "inflight_keys"
+
+	metricContractMismatches = "contract_mismatches_total"
+
+	metricGRPCTranscoded = "grpc_transcoded_requests_total"
+
+	metricResponseCache        = "response_cache_requests_total"
+	metricResponseCacheEntries = "response_cache_entries"
+
+	metricQueryFiltered = "query_params_filtered_total"
+
+	metricSignedURLs = "signed_url_requests_total"
+
+	metricDryRunDenials = "dry_run_denials_total"
+
+	metricRequiredHeaderRejected = "required_header_rejections_total"
+
+	metricDeprecatedRequests = "deprecated_route_requests_total"
+
+	metricAPIVersionRequests = "api_version_requests_total"
+
+	metricAdaptiveLimit = "adaptive_concurrency_limit"
+	metricAdaptiveShed  = "adaptive_concurrency_shed_total"
+
+	metricUpstreamConns = "upstream_open_connections"
+	metricUpstreamDials = "upstream_dials_total"
+
+	metricWatchdogTrips = "watchdog_trips_total"
+
+	metricExperimentRequests = "experiment_requests_total"
+
+	metricGlobalSyncs = "rate_limit_global_syncs_total"
+	metricGlobalDrift = "rate_limit_global_drift"
+
+	metricLimiterStore    = "rate_limit_store_seconds"
+	metricLimiterBoundary = "rate_limit_boundary_hits_total"
+	metricLimiterExpiry   = "rate_limit_expiry_repaired_total"
+
+	metricRejectCacheHits = "auth_reject_cache_hits_total"
+
+	metricPausedRequests = "paused_token_requests_total"
+
+	metricUpstreamTokenFetches = "upstream_oauth2_token_fetches_total"
+
+	metricScrubHits    = "response_scrub_hits_total"
+	metricScrubSkipped = "response_scrub_skipped_total"
+
+	metricWAFHits    = "waf_rule_hits_total"
+	metricWAFReloads = "waf_reloads_total"
+
+	metricBotRisk = "bot_risk_requests_total"
+
+	metricJWKSRefreshes = "jwks_refreshes_total"
+
+	metricIssuerLookups = "token_issuer_lookups_total"
+
+	metricTokenSyncs    = "tyk_key_syncs_total"
+	metricTokenSyncKeys = "tyk_key_sync_keys_total"
+
+	metricAuthOutcomes     = "auth_outcomes_total"
+	metricLimiterDecisions = "rate_limit_decisions_total"
+
+	metricTokenCache = "token_cache_requests_total"
+
+	metricRejected = "requests_rejected_total"
 )
 
 var (
@@ -33,6 +160,123 @@ var (
 type Metrics struct {
 	latencySum  *prometheus.SummaryVec
 	latencyHist *prometheus.HistogramVec
+	authz       *prometheus.CounterVec
+
+	upstreamQueue *prometheus.GaugeVec
+	upstreamShed  *prometheus.CounterVec
+
+	proxiedBytes *prometheus.CounterVec
+
+	decompressionRejected *prometheus.CounterVec
+
+	captureRecords *prometheus.CounterVec
+
+	redisDegraded prometheus.Gauge
+
+	fairQueueDepth *prometheus.GaugeVec
+
+	fairQueueShed *prometheus.CounterVec
+
+	sloRequests *prometheus.CounterVec
+	sloFast     *prometheus.CounterVec
+	sloErrors   *prometheus.CounterVec
+	sloBurn     *prometheus.CounterVec
+
+	logShipEvents *prometheus.CounterVec
+
+	analyticsRecords *prometheus.CounterVec
+
+	hookEvents *prometheus.CounterVec
+
+	asyncDepth    *prometheus.GaugeVec
+	asyncCapacity *prometheus.GaugeVec
+	asyncDropped  *prometheus.CounterVec
+	asyncWorkers  *prometheus.GaugeVec
+	asyncBusy     *prometheus.GaugeVec
+
+	pathRejected *prometheus.CounterVec
+
+	openStreams prometheus.Gauge
+
+	streamsLimited *prometheus.CounterVec
+
+	inFlightRequests prometheus.Gauge
+	inFlightKeys     prometheus.Gauge
+
+	contractMismatches *prometheus.CounterVec
+
+	grpcTranscoded *prometheus.CounterVec
+
+	responseCache        *prometheus.CounterVec
+	responseCacheEntries prometheus.Gauge
+
+	queryFiltered *prometheus.CounterVec
+
+	signedURLs *prometheus.CounterVec
+
+	dryRunDenials *prometheus.CounterVec
+
+	requiredHeaderRejected *prometheus.CounterVec
+
+	deprecatedRequests *prometheus.CounterVec
+
+	apiVersionRequests *prometheus.CounterVec
+
+	adaptiveLimit *prometheus.GaugeVec
+	adaptiveShed  *prometheus.CounterVec
+
+	upstreamConns *prometheus.GaugeVec
+	upstreamDials *prometheus.CounterVec
+
+	watchdogTrips *prometheus.CounterVec
+
+	experimentRequests *prometheus.CounterVec
+
+	globalSyncs *prometheus.CounterVec
+	globalDrift prometheus.Histogram
+
+	limiterStore    prometheus.Histogram
+	limiterBoundary prometheus.Counter
+	limiterExpiry   prometheus.Counter
+
+	rejectCacheHits prometheus.Counter
+
+	pausedRequests *prometheus.CounterVec
+
+	upstreamTokenFetches *prometheus.CounterVec
+
+	scrubHits    *prometheus.CounterVec
+	scrubSkipped *prometheus.CounterVec
+
+	wafHits    *prometheus.CounterVec
+	wafReloads *prometheus.CounterVec
+
+	botRisk *prometheus.CounterVec
+
+	jwksRefreshes *prometheus.CounterVec
+
+	issuerLookups *prometheus.CounterVec
+
+	tokenSyncs    *prometheus.CounterVec
+	tokenSyncKeys *prometheus.CounterVec
+
+	authOutcomes     *prometheus.CounterVec
+	limiterDecisions *prometheus.CounterVec
+
+	tokenCache *prometheus.CounterVec
+
+	rejected *prometheus.CounterVec
+
+	// mirrors request, auth and limiter metrics to a statsd agent; set once before serving
+	statsd *StatsD
+
+	// names proxied paths in the path label; set once before serving
+	pathClasses []pathClass
+}
+
+type pathClass struct {
+	re   *regexp.Regexp
+	name string
 }
 
 type StatusRecorder struct {
@@ -45,6 +289,11 @@ func (r *StatusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer (flush, deadlines).
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func (r *StatusRecorder) Write(body []byte) (int, error) {
 	if r.Status == 0 {
 		r.Status = http.StatusOK
@@ -55,14 +304,47 @@ func (r *StatusRecorder) Write(body []byte) (int, error) {
 func (m *Metrics) MetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		path := r.URL.Path // handlers may rewrite it for the upstream
 		recorder := &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
 
 		next.ServeHTTP(recorder, r)
 
-		m.SaveHTTPDuration(start, routePattern(r), r.Method, recorder.Status)
+		m.SaveHTTPDuration(start, m.pathLabel(r, path), r.Method, recorder.Status)
 	})
 }
 
+// SetPathClasses names the paths behind wildcard routes in the path label: the first pattern matching a path
+// gives its name, expanded with the pattern's groups. It must be called before serving.
+func (m *Metrics) SetPathClasses(pcs []config.PathClass) error {
+	classes := make([]pathClass, 0, len(pcs))
+	for _, pc := range pcs {
+		re, err := regexp.Compile(pc.Pattern)
+		if err != nil {
+			return fmt.Errorf("path class %q: %w", pc.Pattern, err)
+		}
+		classes = append(classes, pathClass{re: re, name: pc.Name})
+	}
+	m.pathClasses = classes
+
+	return nil
+}
+
+// pathLabel is the chi route pattern, or for wildcard routes the name of the first path class matching path.
+func (m *Metrics) pathLabel(r *http.Request, path string) string {
+	pattern := routePattern(r)
+	if !strings.HasSuffix(pattern, "*") {
+		return pattern
+	}
+
+	for _, pc := range m.pathClasses {
+		if match := pc.re.FindStringSubmatchIndex(path); match != nil {
+			return string(pc.re.ExpandString(nil, pc.name, path, match))
+		}
+	}
+
+	return pattern
+}
+
 func GetMetrics() *Metrics {
 	metricsOnce.Do(func() {
 		m := &Metrics{}
@@ -90,37 +372,1154 @@ func GetMetrics() *Metrics {
 		)
 		prometheus.MustRegister(m.latencyHist)
 
-		metricsInst = m
-	})
+		m.authz = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricAuthz,
+				Help:        "External authorization decisions",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelAuthz, labelResult},
+		)
+		prometheus.MustRegister(m.authz)
 
-	return metricsInst
-}
+		m.upstreamQueue = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricUpstreamQueue,
+				Help:        "Requests waiting for the upstream throughput limiter by connection pool",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelPool},
+		)
+		prometheus.MustRegister(m.upstreamQueue)
 
-func (m *Metrics) SaveHTTPDuration(timeSince time.Time, path, method string, code int) {
-	if m == nil {
-		return
-	}
+		m.upstreamShed = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricUpstreamShed,
+				Help:        "Requests rejected by the upstream throughput limiter by connection pool",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelPool},
+		)
+		prometheus.MustRegister(m.upstreamShed)
 
-	codeStr := strconv.Itoa(code)
-	lat := time.Since(timeSince).Seconds()
+		m.proxiedBytes = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricProxiedBytes,
+				Help:        "Body bytes proxied by configured route and direction (request, response)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelDir},
+		)
+		prometheus.MustRegister(m.proxiedBytes)
 
-	m.latencySum.WithLabelValues(path, method, codeStr).Observe(lat)
-	m.latencyHist.WithLabelValues(path, method, codeStr).Observe(lat)
-}
+		m.decompressionRejected = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricDecompressionRejected,
+				Help:        "Compressed request bodies rejected by size or ratio limits",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelReason},
+		)
+		prometheus.MustRegister(m.decompressionRejected)
 
-func routePattern(r *http.Request) string {
-	if r == nil {
-		return "unknown"
-	}
+		m.captureRecords = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricCaptureRecords,
+				Help:        "Captured requests by outcome (written, dropped, failed)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.captureRecords)
 
-	rctx := chi.RouteContext(r.Context())
-	if rctx == nil {
-		return "unknown"
-	}
+		m.redisDegraded = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name:        metricRedisDegraded,
+				Help:        "1 while the Redis error rate is over the failover threshold",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+		)
+		prometheus.MustRegister(m.redisDegraded)
 
-	if pattern := rctx.RoutePattern(); pattern != "" {
-		return pattern
-	}
+		m.fairQueueDepth = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricFairQueueDepth,
+				Help:        "Requests waiting for an upstream concurrency slot, by token tier",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelTier},
+		)
+		prometheus.MustRegister(m.fairQueueDepth)
 
-	return "unknown"
+		m.fairQueueShed = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricFairQueueShed,
+				Help:        "Requests rejected because the concurrency queue was full or the wait too long, by token tier",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelTier},
+		)
+		prometheus.MustRegister(m.fairQueueShed)
+
+		m.sloRequests = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricSLORequests,
+				Help:        "Requests counted towards the route SLO",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute},
+		)
+		prometheus.MustRegister(m.sloRequests)
+
+		m.sloFast = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricSLOFast,
+				Help:        "Requests served faster than the SLO latency threshold",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute},
+		)
+		prometheus.MustRegister(m.sloFast)
+
+		m.sloErrors = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricSLOErrors,
+				Help:        "Requests answered with a 5xx status",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute},
+		)
+		prometheus.MustRegister(m.sloErrors)
+
+		m.sloBurn = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricSLOBurn,
+				Help:        "Error budget burned: each slow or failed request adds 1/(1-objective); divide its rate by the rate of slo_requests_total for the burn rate",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute},
+		)
+		prometheus.MustRegister(m.sloBurn)
+
+		m.logShipEvents = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricLogShipEvents,
+				Help:        "Access and audit events by shipping outcome (shipped, dropped, failed)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.logShipEvents)
+
+		m.analyticsRecords = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricAnalyticsRecords,
+				Help:        "Tyk analytics records by result",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.analyticsRecords)
+
+		m.hookEvents = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricHookEvents,
+				Help:        "Post-response hook events by hook and result (ok, failed, dropped when the queue is full)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelHook, labelResult},
+		)
+		prometheus.MustRegister(m.hookEvents)
+
+		m.asyncDepth = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricAsyncDepth,
+				Help:        "Items waiting in background queues",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelQueue},
+		)
+		prometheus.MustRegister(m.asyncDepth)
+
+		m.asyncCapacity = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricAsyncCapacity,
+				Help:        "Items background queues hold before dropping",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelQueue},
+		)
+		prometheus.MustRegister(m.asyncCapacity)
+
+		m.asyncDropped = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricAsyncDropped,
+				Help:        "Items dropped because their background queue was full or closed",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelQueue},
+		)
+		prometheus.MustRegister(m.asyncDropped)
+
+		m.asyncWorkers = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricAsyncWorkers,
+				Help:        "Workers of background queues",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelQueue},
+		)
+		prometheus.MustRegister(m.asyncWorkers)
+
+		m.asyncBusy = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricAsyncBusy,
+				Help:        "Workers of background queues handling an item",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelQueue},
+		)
+		prometheus.MustRegister(m.asyncBusy)
+
+		m.pathRejected = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricPathRejected,
+				Help:        "Requests rejected by path normalization or URL limits, by reason",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelReason},
+		)
+		prometheus.MustRegister(m.pathRejected)
+
+		m.openStreams = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name:        metricOpenStreams,
+				Help:        "Streaming responses currently open",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+		)
+		prometheus.MustRegister(m.openStreams)
+
+		m.streamsLimited = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricStreamsLimited,
+				Help:        "Streams refused over the per-token cap (rejected) or cut at max duration (terminated)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.streamsLimited)
+
+		m.inFlightRequests = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name:        metricInFlightRequests,
+				Help:        "Authenticated requests currently in flight",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+		)
+		prometheus.MustRegister(m.inFlightRequests)
+
+		m.inFlightKeys = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name:        metricInFlightKeys,
+				Help:        "Distinct api keys with requests in flight",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+		)
+		prometheus.MustRegister(m.inFlightKeys)
+
+		m.contractMismatches = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricContractMismatches,
+				Help:        "Upstream responses that do not match the route's OpenAPI contract, by reason",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelReason},
+		)
+		prometheus.MustRegister(m.contractMismatches)
+
+		m.grpcTranscoded = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricGRPCTranscoded,
+				Help:        "Requests transcoded to gRPC calls, by route and gRPC status code",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelCode},
+		)
+		prometheus.MustRegister(m.grpcTranscoded)
+
+		m.responseCache = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricResponseCache,
+				Help:        "Requests on cached routes by result: hit, miss or not_modified",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelResult},
+		)
+		prometheus.MustRegister(m.responseCache)
+
+		m.responseCacheEntries = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name:        metricResponseCacheEntries,
+				Help:        "Responses held in the gateway cache, including expired ones not yet evicted",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+		)
+		prometheus.MustRegister(m.responseCacheEntries)
+
+		m.queryFiltered = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricQueryFiltered,
+				Help:        "Requests with query parameters outside the route allowlist, by result: stripped or rejected",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelResult},
+		)
+		prometheus.MustRegister(m.queryFiltered)
+
+		m.signedURLs = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricSignedURLs,
+				Help:        "Requests authenticated by signed URL, by result",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.signedURLs)
+
+		m.dryRunDenials = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricDryRunDenials,
+				Help:        "Requests of dry-run tokens and routes that would have been denied, by reason",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelReason},
+		)
+		prometheus.MustRegister(m.dryRunDenials)
+
+		m.requiredHeaderRejected = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricRequiredHeaderRejected,
+				Help:        "Requests rejected for a missing or invalid required header, by reason",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelReason},
+		)
+		prometheus.MustRegister(m.requiredHeaderRejected)
+
+		m.deprecatedRequests = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricDeprecatedRequests,
+				Help:        "Requests to deprecated routes; per api_key usage is on GET /admin/deprecations",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute},
+		)
+		prometheus.MustRegister(m.deprecatedRequests)
+
+		m.apiVersionRequests = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricAPIVersionRequests,
+				Help:        "Requests to versioned routes by the API version they were routed to, or unsupported (406)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelVersion},
+		)
+		prometheus.MustRegister(m.apiVersionRequests)
+
+		m.adaptiveLimit = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricAdaptiveLimit,
+				Help:        "Current adaptive concurrency limit toward the upstream of a route",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute},
+		)
+		prometheus.MustRegister(m.adaptiveLimit)
+
+		m.adaptiveShed = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricAdaptiveShed,
+				Help:        "Requests shed with 503 because the adaptive concurrency limit of their route was reached",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute},
+		)
+		prometheus.MustRegister(m.adaptiveShed)
+
+		m.upstreamConns = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricUpstreamConns,
+				Help:        "Open connections to the upstream by connection pool (default or the route path)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelPool},
+		)
+		prometheus.MustRegister(m.upstreamConns)
+
+		m.upstreamDials = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricUpstreamDials,
+				Help:        "Connection attempts to the upstream by connection pool and result (ok, error)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelPool, labelResult},
+		)
+		prometheus.MustRegister(m.upstreamDials)
+
+		m.watchdogTrips = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricWatchdogTrips,
+				Help:        "Watchdog checks that found a resource (goroutines, heap) above its threshold",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRes},
+		)
+		prometheus.MustRegister(m.watchdogTrips)
+
+		m.experimentRequests = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricExperimentRequests,
+				Help:        "Requests assigned to an experiment bucket",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelExp, labelBucket},
+		)
+		prometheus.MustRegister(m.experimentRequests)
+
+		m.globalSyncs = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricGlobalSyncs,
+				Help:        "Reconciliations of local rate-limit counters with the global store",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.globalSyncs)
+
+		m.globalDrift = prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:        metricGlobalDrift,
+				Help:        "Requests of a key counted by other regions that a region learned of at a sync",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+				Buckets:     prometheus.ExponentialBuckets(1, 4, 10),
+			},
+		)
+		prometheus.MustRegister(m.globalDrift)
+
+		m.limiterStore = prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:        metricLimiterStore,
+				Help:        "Latency of rate-limit counter increments (the Redis script or the Memcached calls)",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+				Buckets:     dflBuckets,
+			},
+		)
+		prometheus.MustRegister(m.limiterStore)
+
+		m.limiterBoundary = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:        metricLimiterBoundary,
+				Help:        "Rate-limit checks whose count hit the limit exactly, the last request a window allows",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+		)
+		prometheus.MustRegister(m.limiterBoundary)
+
+		m.limiterExpiry = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:        metricLimiterExpiry,
+				Help:        "Rate-limit counters found without an expiry, which would have outlived their window",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+		)
+		prometheus.MustRegister(m.limiterExpiry)
+
+		m.rejectCacheHits = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:        metricRejectCacheHits,
+				Help:        "Tokens rejected from the cache of failed verifications, without a signature check",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+		)
+		prometheus.MustRegister(m.rejectCacheHits)
+
+		m.pausedRequests = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricPausedRequests,
+				Help:        "Requests refused because their token is paused",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute},
+		)
+		prometheus.MustRegister(m.pausedRequests)
+
+		m.upstreamTokenFetches = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricUpstreamTokenFetches,
+				Help:        "OAuth2 tokens requested from upstream token endpoints by route and result",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelResult},
+		)
+		prometheus.MustRegister(m.upstreamTokenFetches)
+
+		m.scrubHits = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricScrubHits,
+				Help:        "Matches masked in response bodies by route and scrub pattern",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelPatt},
+		)
+		prometheus.MustRegister(m.scrubHits)
+
+		m.scrubSkipped = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricScrubSkipped,
+				Help:        "Responses passed without scrubbing by route and reason",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelReason},
+		)
+		prometheus.MustRegister(m.scrubSkipped)
+
+		m.wafHits = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricWAFHits,
+				Help:        "Requests matching WAF rules by rule and action",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRule, labelAction},
+		)
+		prometheus.MustRegister(m.wafHits)
+
+		m.wafReloads = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricWAFReloads,
+				Help:        "WAF rules file reloads by result",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.wafReloads)
+
+		m.botRisk = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricBotRisk,
+				Help:        "API requests by route and bot risk bucket",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelBucket},
+		)
+		prometheus.MustRegister(m.botRisk)
+
+		m.jwksRefreshes = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricJWKSRefreshes,
+				Help:        "JWKS key set fetches by result",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.jwksRefreshes)
+
+		m.issuerLookups = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricIssuerLookups,
+				Help:        "Lookups of tokens missing from the token store in the external issuer by result",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.issuerLookups)
+
+		m.tokenSyncs = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricTokenSyncs,
+				Help:        "Imports of keys from the Tyk Dashboard by result",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.tokenSyncs)
+
+		m.tokenSyncKeys = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricTokenSyncKeys,
+				Help:        "Keys seen by imports from the Tyk Dashboard by result",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.tokenSyncKeys)
+
+		m.authOutcomes = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricAuthOutcomes,
+				Help:        "Requests by auth outcome, e.g. allowed, invalid_token or rate_limited",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelRoute, labelResult},
+		)
+		prometheus.MustRegister(m.authOutcomes)
+
+		m.limiterDecisions = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricLimiterDecisions,
+				Help:        "Rate limiter decisions: allowed, limited, error, or local_allowed and local_limited by the fallback",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.limiterDecisions)
+
+		m.tokenCache = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricTokenCache,
+				Help:        "Token profile lookups in the in-memory token cache: hit or miss",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelResult},
+		)
+		prometheus.MustRegister(m.tokenCache)
+
+		m.rejected = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        metricRejected,
+				Help:        "Requests the gateway answered with an error of its own, by reason",
+				ConstLabels: prometheus.Labels{labelService: ServiceName},
+			},
+			[]string{labelReason},
+		)
+		prometheus.MustRegister(m.rejected)
+
+		metricsInst = m
+	})
+
+	return metricsInst
+}
+
+func (m *Metrics) SaveHTTPDuration(timeSince time.Time, path, method string, code int) {
+	if m == nil {
+		return
+	}
+
+	codeStr := strconv.Itoa(code)
+	d := time.Since(timeSince)
+
+	m.latencySum.WithLabelValues(path, method, codeStr).Observe(d.Seconds())
+	m.latencyHist.WithLabelValues(path, method, codeStr).Observe(d.Seconds())
+	m.statsd.timing("request.latency", d, labelPath+":"+path, labelMethod+":"+method, labelCode+":"+codeStr)
+}
+
+// IncAuthzDecision counts a decision of an external authorizer (allow, deny or error).
+func (m *Metrics) IncAuthzDecision(authorizer, result string) {
+	if m == nil {
+		return
+	}
+
+	m.authz.WithLabelValues(authorizer, result).Inc()
+	m.statsd.count("authz.decisions", 1, labelAuthz+":"+authorizer, labelResult+":"+result)
+}
+
+func (m *Metrics) SetUpstreamQueue(pool string, n int) {
+	if m == nil {
+		return
+	}
+
+	m.upstreamQueue.WithLabelValues(pool).Set(float64(n))
+}
+
+func (m *Metrics) IncUpstreamShed(pool string) {
+	if m == nil {
+		return
+	}
+
+	m.upstreamShed.WithLabelValues(pool).Inc()
+}
+
+func (m *Metrics) AddProxiedBytes(route, direction string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+
+	m.proxiedBytes.WithLabelValues(route, direction).Add(float64(n))
+}
+
+func (m *Metrics) IncDecompressionRejected(route, reason string) {
+	if m == nil {
+		return
+	}
+
+	m.decompressionRejected.WithLabelValues(route, reason).Inc()
+}
+
+func (m *Metrics) IncCaptureRecord(result string) {
+	if m == nil {
+		return
+	}
+
+	m.captureRecords.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) SetRedisDegraded(degraded bool) {
+	if m == nil {
+		return
+	}
+
+	v := 0.0
+	if degraded {
+		v = 1
+	}
+	m.redisDegraded.Set(v)
+}
+
+func (m *Metrics) SetFairQueueDepth(tier string, depth int) {
+	if m == nil {
+		return
+	}
+
+	m.fairQueueDepth.WithLabelValues(tier).Set(float64(depth))
+}
+
+func (m *Metrics) IncFairQueueShed(tier string) {
+	if m == nil {
+		return
+	}
+
+	m.fairQueueShed.WithLabelValues(tier).Inc()
+}
+
+// ObserveSLO counts a request against the route SLO. A request that is slow or failed burns budgetCost.
+func (m *Metrics) ObserveSLO(route string, fast, failed bool, budgetCost float64) {
+	if m == nil {
+		return
+	}
+
+	m.sloRequests.WithLabelValues(route).Inc()
+	if fast {
+		m.sloFast.WithLabelValues(route).Inc()
+	}
+	if failed {
+		m.sloErrors.WithLabelValues(route).Inc()
+	}
+	if !fast || failed {
+		m.sloBurn.WithLabelValues(route).Add(budgetCost)
+	}
+}
+
+func (m *Metrics) AddLogShipEvents(result string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+
+	m.logShipEvents.WithLabelValues(result).Add(float64(n))
+}
+
+func (m *Metrics) AddAnalyticsRecords(result string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+
+	m.analyticsRecords.WithLabelValues(result).Add(float64(n))
+}
+
+func (m *Metrics) IncHookEvent(hook, result string) {
+	if m == nil {
+		return
+	}
+
+	m.hookEvents.WithLabelValues(hook, result).Inc()
+}
+
+// SetAsyncQueue records the size and worker count of a background queue.
+func (m *Metrics) SetAsyncQueue(queue string, capacity, workers int) {
+	if m == nil {
+		return
+	}
+
+	m.asyncCapacity.WithLabelValues(queue).Set(float64(capacity))
+	m.asyncWorkers.WithLabelValues(queue).Set(float64(workers))
+}
+
+func (m *Metrics) SetAsyncDepth(queue string, n int) {
+	if m == nil {
+		return
+	}
+
+	m.asyncDepth.WithLabelValues(queue).Set(float64(n))
+}
+
+func (m *Metrics) AddAsyncBusy(queue string, delta int) {
+	if m == nil {
+		return
+	}
+
+	m.asyncBusy.WithLabelValues(queue).Add(float64(delta))
+}
+
+func (m *Metrics) IncAsyncDropped(queue string) {
+	if m == nil {
+		return
+	}
+
+	m.asyncDropped.WithLabelValues(queue).Inc()
+}
+
+func (m *Metrics) IncPathRejected(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.pathRejected.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) AddOpenStreams(delta int) {
+	if m == nil {
+		return
+	}
+
+	m.openStreams.Add(float64(delta))
+}
+
+func (m *Metrics) IncStreamsLimited(result string) {
+	if m == nil {
+		return
+	}
+
+	m.streamsLimited.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) SetInFlight(requests, keys int) {
+	if m == nil {
+		return
+	}
+
+	m.inFlightRequests.Set(float64(requests))
+	m.inFlightKeys.Set(float64(keys))
+}
+
+func (m *Metrics) IncContractMismatch(route, reason string) {
+	if m == nil {
+		return
+	}
+
+	m.contractMismatches.WithLabelValues(route, reason).Inc()
+}
+
+func (m *Metrics) IncGRPCTranscoded(route, code string) {
+	if m == nil {
+		return
+	}
+
+	m.grpcTranscoded.WithLabelValues(route, code).Inc()
+}
+
+func (m *Metrics) IncResponseCache(route, result string) {
+	if m == nil {
+		return
+	}
+
+	m.responseCache.WithLabelValues(route, result).Inc()
+}
+
+func (m *Metrics) SetResponseCacheEntries(n int) {
+	if m == nil {
+		return
+	}
+
+	m.responseCacheEntries.Set(float64(n))
+}
+
+func (m *Metrics) IncQueryFiltered(route, result string) {
+	if m == nil {
+		return
+	}
+
+	m.queryFiltered.WithLabelValues(route, result).Inc()
+}
+
+func (m *Metrics) IncSignedURL(result string) {
+	if m == nil {
+		return
+	}
+
+	m.signedURLs.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) IncDryRunDenial(route, reason string) {
+	if m == nil {
+		return
+	}
+
+	m.dryRunDenials.WithLabelValues(route, reason).Inc()
+}
+
+func (m *Metrics) IncRequiredHeaderRejected(route, reason string) {
+	if m == nil {
+		return
+	}
+
+	m.requiredHeaderRejected.WithLabelValues(route, reason).Inc()
+}
+
+func (m *Metrics) IncDeprecatedRequest(route string) {
+	if m == nil {
+		return
+	}
+
+	m.deprecatedRequests.WithLabelValues(route).Inc()
+}
+
+func (m *Metrics) IncAPIVersion(route, version string) {
+	if m == nil {
+		return
+	}
+
+	m.apiVersionRequests.WithLabelValues(route, version).Inc()
+}
+
+func (m *Metrics) SetAdaptiveLimit(route string, limit int) {
+	if m == nil {
+		return
+	}
+
+	m.adaptiveLimit.WithLabelValues(route).Set(float64(limit))
+}
+
+func (m *Metrics) IncAdaptiveShed(route string) {
+	if m == nil {
+		return
+	}
+
+	m.adaptiveShed.WithLabelValues(route).Inc()
+}
+
+func (m *Metrics) AddUpstreamConns(pool string, delta int) {
+	if m == nil {
+		return
+	}
+
+	m.upstreamConns.WithLabelValues(pool).Add(float64(delta))
+}
+
+func (m *Metrics) IncUpstreamDial(pool, result string) {
+	if m == nil {
+		return
+	}
+
+	m.upstreamDials.WithLabelValues(pool, result).Inc()
+}
+
+func (m *Metrics) IncWatchdogTrip(resource string) {
+	if m == nil {
+		return
+	}
+
+	m.watchdogTrips.WithLabelValues(resource).Inc()
+}
+
+func routePattern(r *http.Request) string {
+	if r == nil {
+		return "unknown"
+	}
+
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return "unknown"
+	}
+
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+
+	return "unknown"
+}
+
+func (m *Metrics) IncExperiment(experiment, bucket string) {
+	if m == nil {
+		return
+	}
+
+	m.experimentRequests.WithLabelValues(experiment, bucket).Inc()
+}
+
+func (m *Metrics) IncGlobalSync(result string) {
+	if m == nil {
+		return
+	}
+
+	m.globalSyncs.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) ObserveGlobalDrift(n int64) {
+	if m == nil {
+		return
+	}
+
+	m.globalDrift.Observe(float64(n))
+}
+
+func (m *Metrics) ObserveLimiterStore(d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.limiterStore.Observe(d.Seconds())
+}
+
+func (m *Metrics) IncLimiterBoundary() {
+	if m == nil {
+		return
+	}
+
+	m.limiterBoundary.Inc()
+}
+
+func (m *Metrics) IncLimiterExpiryRepaired() {
+	if m == nil {
+		return
+	}
+
+	m.limiterExpiry.Inc()
+}
+
+func (m *Metrics) IncRejectCacheHit() {
+	if m == nil {
+		return
+	}
+
+	m.rejectCacheHits.Inc()
+}
+
+func (m *Metrics) IncPausedRequest(route string) {
+	if m == nil {
+		return
+	}
+
+	m.pausedRequests.WithLabelValues(route).Inc()
+}
+
+func (m *Metrics) IncUpstreamTokenFetch(route, result string) {
+	if m == nil {
+		return
+	}
+
+	m.upstreamTokenFetches.WithLabelValues(route, result).Inc()
+}
+
+func (m *Metrics) AddScrubHits(route, pattern string, n int) {
+	if m == nil {
+		return
+	}
+
+	m.scrubHits.WithLabelValues(route, pattern).Add(float64(n))
+}
+
+func (m *Metrics) IncScrubSkipped(route, reason string) {
+	if m == nil {
+		return
+	}
+
+	m.scrubSkipped.WithLabelValues(route, reason).Inc()
+}
+
+func (m *Metrics) IncWAFHit(rule, action string) {
+	if m == nil {
+		return
+	}
+
+	m.wafHits.WithLabelValues(rule, action).Inc()
+}
+
+func (m *Metrics) IncWAFReload(result string) {
+	if m == nil {
+		return
+	}
+
+	m.wafReloads.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) IncBotRisk(route, bucket string) {
+	if m == nil {
+		return
+	}
+
+	m.botRisk.WithLabelValues(route, bucket).Inc()
+}
+
+func (m *Metrics) IncJWKSRefresh(result string) {
+	if m == nil {
+		return
+	}
+
+	m.jwksRefreshes.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) IncIssuerLookup(result string) {
+	if m == nil {
+		return
+	}
+
+	m.issuerLookups.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) IncTokenSync(result string) {
+	if m == nil {
+		return
+	}
+
+	m.tokenSyncs.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) IncTokenSyncKey(result string) {
+	if m == nil {
+		return
+	}
+
+	m.tokenSyncKeys.WithLabelValues(result).Inc()
+}
+
+// IncAuthOutcome counts a request by the outcome the auth middleware recorded in its decision.
+func (m *Metrics) IncAuthOutcome(route, outcome string) {
+	if m == nil {
+		return
+	}
+
+	m.authOutcomes.WithLabelValues(route, outcome).Inc()
+	m.statsd.count("auth.outcomes", 1, labelRoute+":"+route, labelResult+":"+outcome)
+}
+
+func (m *Metrics) IncLimiterDecision(result string) {
+	if m == nil {
+		return
+	}
+
+	m.limiterDecisions.WithLabelValues(result).Inc()
+	m.statsd.count("rate_limit.decisions", 1, labelResult+":"+result)
+}
+
+func (m *Metrics) IncTokenCache(result string) {
+	if m == nil {
+		return
+	}
+
+	m.tokenCache.WithLabelValues(result).Inc()
+}
+
+// IncRejected counts a request the gateway rejected, by the reason of its gateway error.
+func (m *Metrics) IncRejected(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.rejected.WithLabelValues(reason).Inc()
+	m.statsd.count("requests.rejected", 1, labelReason+":"+reason)
+}
+
+// SetStatsD mirrors request latency and status, authz and auth outcomes, limiter decisions and rejections to s. It
+// must be called before serving.
+func (m *Metrics) SetStatsD(s *StatsD) {
+	m.statsd = s
 }
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestPathLabel(t *testing.T) {
+	m := &Metrics{}
+	if err := m.SetPathClasses([]config.PathClass{
+		{Pattern: `^/api/v1/(orders|users)/[^/]+$`, Name: "/api/v1/$1/{id}"},
+		{Pattern: `^/api/v1/(?P<resource>orders|users)$`, Name: "/api/v1/${resource}"},
+	}); err != nil {
+		t.Fatalf("set path classes: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    string
+	}{
+		{"group", "/api/v1/*", "/api/v1/orders/42", "/api/v1/orders/{id}"},
+		{"named group", "/api/v1/*", "/api/v1/users", "/api/v1/users"},
+		{"unmatched keeps wildcard", "/api/v1/*", "/api/v1/reports/2024/q1", "/api/v1/*"},
+		{"exact route untouched", "/health", "/health", "/health"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			var got string
+			r.HandleFunc(tt.pattern, func(_ http.ResponseWriter, req *http.Request) {
+				got = m.pathLabel(req, req.URL.Path)
+			})
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if got != tt.want {
+				t.Fatalf("label=%q want=%q", got, tt.want)
+			}
+		})
+	}
+}
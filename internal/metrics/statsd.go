@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+// tagReplacer keeps tag values from breaking the DogStatsD line format.
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// StatsD sends metrics to a statsd agent over UDP. Lines are buffered into packets of up to MaxPacketSize
+// bytes, sent when full and at least every FlushInterval. Send errors are ignored: the agent may be down,
+// and metrics must not fail requests. All methods are no-ops on a nil StatsD.
+type StatsD struct {
+	conn     net.Conn
+	prefix   string
+	dog      bool
+	tags     []string // added to every line
+	max      int
+	interval time.Duration
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func NewStatsD(cfg config.StatsD) (*StatsD, error) {
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(cfg.Tags))
+	for k, v := range cfg.Tags {
+		tags = append(tags, k+":"+tagReplacer.Replace(v))
+	}
+	sort.Strings(tags)
+
+	return &StatsD{
+		conn:     conn,
+		prefix:   cfg.Prefix,
+		dog:      cfg.DogStatsD,
+		tags:     tags,
+		max:      cfg.MaxPacketSize,
+		interval: cfg.FlushInterval,
+		buf:      make([]byte, 0, cfg.MaxPacketSize),
+	}, nil
+}
+
+// Run flushes the buffer every flush interval until ctx is done.
+func (s *StatsD) Run(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.Flush()
+			return
+		case <-t.C:
+			s.Flush()
+		}
+	}
+}
+
+func (s *StatsD) Flush() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+}
+
+func (s *StatsD) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	s.Flush()
+	return s.conn.Close()
+}
+
+// count adds n to a counter; tags are key:value pairs.
+func (s *StatsD) count(name string, n int64, tags ...string) {
+	if s == nil {
+		return
+	}
+	s.write(name, strconv.FormatInt(n, 10), "c", tags)
+}
+
+// timing records d in milliseconds.
+func (s *StatsD) timing(name string, d time.Duration, tags ...string) {
+	if s == nil {
+		return
+	}
+	s.write(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64), "ms", tags)
+}
+
+func (s *StatsD) write(name, value, typ string, tags []string) {
+	line := make([]byte, 0, 128)
+	line = append(line, s.prefix...)
+	line = append(line, name...)
+	line = append(line, ':')
+	line = append(line, value...)
+	line = append(line, '|')
+	line = append(line, typ...)
+	if s.dog && len(s.tags)+len(tags) > 0 {
+		line = append(line, "|#"...)
+		for i, t := range append(tags, s.tags...) {
+			if i > 0 {
+				line = append(line, ',')
+			}
+			line = append(line, tagReplacer.Replace(t)...)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.buf) > 0 && len(s.buf)+1+len(line) > s.max {
+		s.flush()
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n')
+	}
+	s.buf = append(s.buf, line...)
+}
+
+// flush sends the buffer; s.mu must be held.
+func (s *StatsD) flush() {
+	if len(s.buf) == 0 {
+		return
+	}
+	_, _ = s.conn.Write(s.buf)
+	s.buf = s.buf[:0]
+}
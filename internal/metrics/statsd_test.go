@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestStatsD_Packets(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer pc.Close()
+
+	s, err := NewStatsD(config.StatsD{
+		Addr:          pc.LocalAddr().String(),
+		Prefix:        "tyk_proxy.",
+		DogStatsD:     true,
+		Tags:          map[string]string{"env": "prod"},
+		FlushInterval: time.Second,
+		MaxPacketSize: 120,
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer s.Close()
+
+	s.timing("request.latency", 1500*time.Microsecond, "path:/api/v1/*", "code:200")
+	// does not fit in the packet with the line before, which is sent first
+	s.count("auth.outcomes", 1, "route:/api/v1/orders,x", "result:allowed")
+	s.Flush()
+
+	want := []string{
+		"tyk_proxy.request.latency:1.500|ms|#path:/api/v1/*,code:200,env:prod",
+		"tyk_proxy.auth.outcomes:1|c|#route:/api/v1/orders_x,result:allowed,env:prod",
+	}
+	buf := make([]byte, 1024)
+	for _, w := range want {
+		_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if got := string(buf[:n]); got != w {
+			t.Fatalf("packet=%q want %q", got, w)
+		}
+	}
+}
+
+func TestStatsD_PlainDropsTags(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer pc.Close()
+
+	s, err := NewStatsD(config.StatsD{Addr: pc.LocalAddr().String(), Prefix: "p.", FlushInterval: time.Second, MaxPacketSize: 1432})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer s.Close()
+
+	s.count("a", 1, "result:allowed")
+	s.count("b", 2)
+	s.Flush()
+
+	buf := make([]byte, 1024)
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got := strings.Split(string(buf[:n]), "\n"); len(got) != 2 || got[0] != "p.a:1|c" || got[1] != "p.b:2|c" {
+		t.Fatalf("packet=%q", buf[:n])
+	}
+}
@@ -0,0 +1,173 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/auth"
+	"tyk-proxy/internal/cache"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+)
+
+const authorizerName = "opa"
+
+// Input is the document sent to OPA as {"input": ...}.
+type Input struct {
+	Method        string              `json:"method"`
+	Path          string              `json:"path"`
+	Query         map[string][]string `json:"query,omitempty"`
+	APIKey        string              `json:"api_key,omitempty"`
+	AllowedRoutes []string            `json:"allowed_routes,omitempty"`
+	RateLimit     int                 `json:"rate_limit,omitempty"`
+}
+
+type Client struct {
+	url      string
+	httpc    *http.Client
+	cache    *cache.LRU[string, bool]
+	failOpen bool
+	metrics  *mp.Metrics
+}
+
+func New(cfg config.OPA, metrics *mp.Metrics) *Client {
+	c := &Client{
+		url:      cfg.URL,
+		httpc:    &http.Client{Timeout: cfg.Timeout},
+		failOpen: cfg.FailPolicy == config.FailPolicyOpen,
+		metrics:  metrics,
+	}
+
+	if cfg.CacheTTL > 0 {
+		c.cache = cache.New[string, bool](cfg.CacheSize, cfg.CacheTTL)
+	}
+
+	return c
+}
+
+// Allow asks OPA for a decision. Cached decisions are served without a round trip.
+func (c *Client) Allow(ctx context.Context, in Input) (bool, error) {
+	body, err := json.Marshal(struct {
+		Input Input `json:"input"`
+	}{Input: in})
+	if err != nil {
+		return false, fmt.Errorf("opa: marshal input: %w", err)
+	}
+
+	var key string
+	if c.cache != nil {
+		sum := sha256.Sum256(body)
+		key = hex.EncodeToString(sum[:])
+		if allowed, ok := c.cache.Get(key); ok {
+			return allowed, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("opa: build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("opa: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, fmt.Errorf("opa: unexpected status %d", resp.StatusCode)
+	}
+
+	allowed, err := decodeResult(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if c.cache != nil {
+		c.cache.Set(key, allowed)
+	}
+
+	return allowed, nil
+}
+
+// decodeResult accepts both {"result": true} and {"result": {"allow": true}} documents.
+// A missing result (undefined rule) is treated as deny.
+func decodeResult(r io.Reader) (bool, error) {
+	var doc struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return false, fmt.Errorf("opa: decode response: %w", err)
+	}
+
+	if len(doc.Result) == 0 {
+		return false, nil
+	}
+
+	var allowed bool
+	if err := json.Unmarshal(doc.Result, &allowed); err == nil {
+		return allowed, nil
+	}
+
+	var obj struct {
+		Allow bool `json:"allow"`
+	}
+	if err := json.Unmarshal(doc.Result, &obj); err != nil {
+		return false, fmt.Errorf("opa: unexpected result type: %w", err)
+	}
+
+	return obj.Allow, nil
+}
+
+// Handler enforces the OPA decision. It must run after the auth middleware so claims are available.
+func (c *Client) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in := Input{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.Query(),
+		}
+		if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+			in.APIKey = claims.APIKey
+			in.AllowedRoutes = claims.AllowedRoutes
+			in.RateLimit = claims.RateLimit
+		}
+
+		start := time.Now()
+		allowed, err := c.Allow(r.Context(), in)
+		if err != nil {
+			c.metrics.IncAuthzDecision(authorizerName, "error")
+			log.Error().Err(err).Dur("duration", time.Since(start)).Msg("opa decision failed")
+
+			if !c.failOpen {
+				gwerr.Write(w, c.metrics, gwerr.ErrAuthUnavailable)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !allowed {
+			c.metrics.IncAuthzDecision(authorizerName, "deny")
+			log.Debug().Str("path", r.URL.Path).Msg("denied by opa")
+			gwerr.Write(w, c.metrics, gwerr.ErrDenied)
+			return
+		}
+
+		c.metrics.IncAuthzDecision(authorizerName, "allow")
+		next.ServeHTTP(w, r)
+	})
+}
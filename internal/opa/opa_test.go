@@ -0,0 +1,102 @@
+package opa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestDecodeResult(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+		err  bool
+	}{
+		{`{"result": true}`, true, false},
+		{`{"result": false}`, false, false},
+		{`{"result": {"allow": true}}`, true, false},
+		{`{}`, false, false},
+		{`{"result": "yes"}`, false, true},
+	}
+
+	for _, tt := range tests {
+		got, err := decodeResult(strings.NewReader(tt.in))
+		if (err != nil) != tt.err || got != tt.want {
+			t.Fatalf("decodeResult(%s) => (%v,%v), want (%v, err=%v)", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestHandler_DenyAndCache(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var doc struct {
+			Input Input `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&doc)
+		_, _ = w.Write([]byte(`{"result": ` + boolStr(doc.Input.Path == "/api/v1/ok") + `}`))
+	}))
+	defer srv.Close()
+
+	c := New(config.OPA{URL: srv.URL, Timeout: time.Second, CacheSize: 10, CacheTTL: time.Minute}, nil)
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example/api/v1/ok", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d want=%d", rr.Code, http.StatusOK)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("opa calls=%d want=1 (second decision should be cached)", calls)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example/api/v1/admin", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestHandler_FailPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		policy string
+		want   int
+	}{
+		{config.FailPolicyClosed, http.StatusServiceUnavailable},
+		{config.FailPolicyOpen, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		c := New(config.OPA{URL: srv.URL, Timeout: time.Second, FailPolicy: tt.policy}, nil)
+		rr := httptest.NewRecorder()
+		c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example/api/v1/ok", nil))
+
+		if rr.Code != tt.want {
+			t.Fatalf("policy=%s status=%d want=%d", tt.policy, rr.Code, tt.want)
+		}
+	}
+}
+
+func boolStr(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
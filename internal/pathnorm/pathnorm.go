@@ -0,0 +1,190 @@
+// Package pathnorm rewrites request paths into a canonical form before routing and scope checks,
+// so that what allowed_routes approve is exactly what the upstream receives.
+package pathnorm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+)
+
+// Reasons a path is rejected, also used as metric labels.
+const (
+	ReasonEncodedSlash     = "encoded_slash"
+	ReasonDoubleEncoding   = "double_encoding"
+	ReasonEncodedBackslash = "encoded_backslash"
+	ReasonControlChar      = "control_char"
+	ReasonDotSegment       = "dot_segment"
+	ReasonInvalidEscape    = "invalid_escape"
+)
+
+// RejectError explains why a path cannot be normalized safely.
+type RejectError struct {
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("request path rejected: %s", e.Reason)
+}
+
+// Normalizer applies the configured path normalization policy.
+type Normalizer struct {
+	cfg     config.PathNormalization
+	metrics *mp.Metrics
+}
+
+func New(cfg config.PathNormalization, metrics *mp.Metrics) *Normalizer {
+	return &Normalizer{cfg: cfg, metrics: metrics}
+}
+
+// Path normalizes an escaped URL path. Percent-encodings are canonicalized first (unreserved characters
+// decoded, hex upper-cased, %2F handled by policy), then duplicate slashes are merged and dot segments
+// resolved (never above the root), then the trailing-slash policy is applied.
+func (n *Normalizer) Path(p string) (string, error) {
+	if p == "" {
+		return "/", nil
+	}
+
+	p, err := n.unescape(p)
+	if err != nil {
+		return "", err
+	}
+
+	if !n.cfg.Disabled {
+		trailing := strings.HasSuffix(p, "/")
+		p = path.Clean("/" + p)
+		if trailing && p != "/" {
+			p += "/"
+		}
+	}
+
+	if n.cfg.TrailingSlash == config.TrailingSlashStrip && len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+		if p == "" {
+			p = "/"
+		}
+	}
+
+	// a kept %2F must not hide dot segments that an upstream decoding it would resolve
+	if n.cfg.EncodedSlash == config.EncodedSlashKeep {
+		decoded, _ := url.PathUnescape(p)
+		for _, seg := range strings.Split(decoded, "/") {
+			if seg == "." || seg == ".." {
+				return "", &RejectError{Reason: ReasonDotSegment}
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// unescape canonicalizes percent-encodings in an escaped path.
+func (n *Normalizer) unescape(p string) (string, error) {
+	if !strings.Contains(p, "%") {
+		return p, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(p))
+
+	for i := 0; i < len(p); i++ {
+		if p[i] != '%' {
+			b.WriteByte(p[i])
+			continue
+		}
+
+		if i+2 >= len(p) || !isHex(p[i+1]) || !isHex(p[i+2]) {
+			return "", &RejectError{Reason: ReasonInvalidEscape}
+		}
+		c := unhex(p[i+1])<<4 | unhex(p[i+2])
+		i += 2
+
+		switch {
+		case c == '/':
+			switch n.cfg.EncodedSlash {
+			case config.EncodedSlashReject:
+				return "", &RejectError{Reason: ReasonEncodedSlash}
+			case config.EncodedSlashKeep:
+				b.WriteString("%2F")
+			default:
+				b.WriteByte('/')
+			}
+		case isUnreserved(c):
+			// %2E is '.', so encoded dot segments are resolved like plain ones
+			b.WriteByte(c)
+		case n.cfg.Strict && c == '%' && i+2 < len(p) && isHex(p[i+1]) && isHex(p[i+2]):
+			return "", &RejectError{Reason: ReasonDoubleEncoding}
+		case n.cfg.Strict && c == '\\':
+			return "", &RejectError{Reason: ReasonEncodedBackslash}
+		case n.cfg.Strict && (c < 0x20 || c == 0x7f):
+			return "", &RejectError{Reason: ReasonControlChar}
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// Middleware rewrites the request URL (and optionally Host) in place, answering 400 for paths the policy
+// rejects. It must run before anything that looks at the path: route matching, auth scope checks and the proxy.
+func (n *Normalizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		escaped := r.URL.EscapedPath()
+		normalized, err := n.Path(escaped)
+		if err != nil {
+			reason := ReasonInvalidEscape
+			if re, ok := err.(*RejectError); ok {
+				reason = re.Reason
+			}
+			n.metrics.IncPathRejected(reason)
+			gwerr.Write(w, n.metrics, gwerr.ErrInvalidPath)
+			return
+		}
+
+		if normalized != escaped {
+			p, err := url.PathUnescape(normalized)
+			if err != nil {
+				n.metrics.IncPathRejected(ReasonInvalidEscape)
+				gwerr.Write(w, n.metrics, gwerr.ErrInvalidPath)
+				return
+			}
+			// EscapedPath keeps RawPath only while it still encodes Path, e.g. with a kept %2F
+			r.URL.Path = p
+			r.URL.RawPath = normalized
+		}
+
+		if n.cfg.LowercaseHost {
+			r.Host = strings.ToLower(r.Host)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// isUnreserved reports RFC 3986 unreserved characters, which are equivalent encoded or not.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,85 @@
+package pathnorm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestNormalizer_Path(t *testing.T) {
+	keep := config.PathNormalization{EncodedSlash: config.EncodedSlashKeep}
+	strict := config.PathNormalization{Strict: true}
+
+	tests := []struct {
+		name       string
+		cfg        config.PathNormalization
+		in         string
+		want       string
+		wantReason string
+	}{
+		{name: "dot segments", in: "/api/v1/../v1/admin", want: "/api/v1/admin"},
+		{name: "above root", in: "/../../etc/passwd", want: "/etc/passwd"},
+		{name: "duplicate slashes", in: "//api///v1//users", want: "/api/v1/users"},
+		{name: "current dir", in: "/api/./v1/./users/", want: "/api/v1/users/"},
+		{name: "strip trailing slash", cfg: config.PathNormalization{TrailingSlash: config.TrailingSlashStrip}, in: "/api/v1/users//", want: "/api/v1/users"},
+		{name: "root keeps its slash", cfg: config.PathNormalization{TrailingSlash: config.TrailingSlashStrip}, in: "/", want: "/"},
+		{name: "disabled", cfg: config.PathNormalization{Disabled: true}, in: "/api/v1/../v1//admin", want: "/api/v1/../v1//admin"},
+
+		{name: "unreserved decoded", in: "/api/v1/%75sers/%7Ejo", want: "/api/v1/users/~jo"},
+		{name: "hex upper-cased", in: "/api/v1/a%3fb", want: "/api/v1/a%3Fb"},
+		{name: "encoded dots resolved", in: "/api/v1/public/%2e%2e/admin", want: "/api/v1/admin"},
+		{name: "encoded slash decoded", in: "/api/v1/public%2F..%2Fadmin", want: "/api/v1/admin"},
+		{name: "encoded slash kept", cfg: keep, in: "/api/v1/files/a%2fb", want: "/api/v1/files/a%2Fb"},
+		{name: "kept slash hiding dot segment", cfg: keep, in: "/api/v1/public%2F..%2Fadmin", wantReason: ReasonDotSegment},
+		{name: "encoded slash rejected", cfg: config.PathNormalization{EncodedSlash: config.EncodedSlashReject}, in: "/api/v1/a%2Fb", wantReason: ReasonEncodedSlash},
+		{name: "double encoding allowed when lenient", in: "/api/v1/a%252Fb", want: "/api/v1/a%252Fb"},
+		{name: "double encoding strict", cfg: strict, in: "/api/v1/a%252Fb", wantReason: ReasonDoubleEncoding},
+		{name: "backslash strict", cfg: strict, in: "/api/v1/..%5Cadmin", wantReason: ReasonEncodedBackslash},
+		{name: "control char strict", cfg: strict, in: "/api/v1/a%00", wantReason: ReasonControlChar},
+		{name: "invalid escape", in: "/api/v1/a%zz", wantReason: ReasonInvalidEscape},
+	}
+
+	for _, tt := range tests {
+		got, err := New(tt.cfg, nil).Path(tt.in)
+		if tt.wantReason != "" {
+			var re *RejectError
+			if !errors.As(err, &re) || re.Reason != tt.wantReason {
+				t.Fatalf("%s: err=%v want reason %s", tt.name, err, tt.wantReason)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("%s: Path(%q)=%q, %v want=%q", tt.name, tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizer_Middleware(t *testing.T) {
+	var gotPath, gotEscaped, gotHost string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotEscaped, gotHost = r.URL.Path, r.URL.EscapedPath(), r.Host
+	})
+
+	h := New(config.PathNormalization{LowercaseHost: true}, nil).Middleware(next)
+	req := httptest.NewRequest(http.MethodGet, "http://API.Example.com/api/v1/../v1/admin?x=1", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if gotPath != "/api/v1/admin" || gotHost != "api.example.com" || req.URL.RawQuery != "x=1" {
+		t.Fatalf("path=%q host=%q query=%q", gotPath, gotHost, req.URL.RawQuery)
+	}
+
+	h = New(config.PathNormalization{EncodedSlash: config.EncodedSlashKeep}, nil).Middleware(next)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api//v1/files/a%2fb", nil))
+	if gotPath != "/api/v1/files/a/b" || gotEscaped != "/api/v1/files/a%2Fb" {
+		t.Fatalf("path=%q escaped=%q", gotPath, gotEscaped)
+	}
+
+	h = New(config.PathNormalization{Strict: true}, nil).Middleware(next)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/a%252e%252e/admin", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want=%d", rr.Code, http.StatusBadRequest)
+	}
+}
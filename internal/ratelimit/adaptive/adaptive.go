@@ -0,0 +1,150 @@
+// Package adaptive caps requests in flight to an upstream with a limit derived from its latency
+// (a gradient limiter in the style of Netflix concurrency-limits), so the gateway backs off by itself
+// when the upstream degrades.
+package adaptive
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// baselineWeight is how much one window moves the long-term latency baseline.
+	baselineWeight = 0.05
+	// smoothing is how much one window moves the limit toward its new estimate.
+	smoothing = 0.2
+	// backoff multiplies the limit after a window with upstream errors.
+	backoff = 0.9
+	// minGradient bounds how far a single window can cut the limit.
+	minGradient = 0.5
+)
+
+// Limiter admits requests while fewer than the current limit are in flight. At the end of each window
+// the limit is multiplied by the gradient baseline*tolerance/latency (at most 1) and grows by its square
+// root, so it shrinks while latency rises above the tolerated baseline and grows while the upstream
+// keeps up. Windows with upstream errors cut it by 10%. It only grows while at least half of it is used.
+type Limiter struct {
+	mu        sync.Mutex
+	limit     float64
+	min, max  float64
+	tolerance float64
+	window    time.Duration
+	inFlight  int
+
+	baseline    float64 // long-term latency in seconds, 0 until the first window
+	windowStart time.Time
+	sum         time.Duration
+	samples     int
+	dropped     bool
+	peak        int // most requests in flight during the window
+
+	onLimit func(limit int)
+
+	// for tests
+	now func() time.Time
+}
+
+type Options struct {
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	Tolerance    float64
+	Window       time.Duration
+
+	// OnLimit is called with the new limit whenever it changes, under the limiter lock.
+	OnLimit func(limit int)
+}
+
+func New(opts Options) *Limiter {
+	l := &Limiter{
+		limit:     float64(opts.InitialLimit),
+		min:       float64(opts.MinLimit),
+		max:       float64(opts.MaxLimit),
+		tolerance: opts.Tolerance,
+		window:    opts.Window,
+		onLimit:   opts.OnLimit,
+		now:       time.Now,
+	}
+	l.windowStart = l.now()
+	if l.onLimit != nil {
+		l.onLimit(opts.InitialLimit)
+	}
+
+	return l
+}
+
+// Limit returns the current limit.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+// Acquire admits a request if the limit allows it. The returned function must be called once the
+// upstream answered, with whether it failed (5xx or no response).
+func (l *Limiter) Acquire() (func(failed bool), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		return nil, false
+	}
+	l.inFlight++
+	l.peak = max(l.peak, l.inFlight)
+
+	start := l.now()
+	return func(failed bool) { l.release(l.now().Sub(start), failed) }, true
+}
+
+func (l *Limiter) release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	if failed {
+		l.dropped = true
+	} else {
+		l.sum += latency
+		l.samples++
+	}
+
+	if now := l.now(); now.Sub(l.windowStart) >= l.window {
+		l.update()
+		l.windowStart, l.sum, l.samples, l.dropped, l.peak = now, 0, 0, false, l.inFlight
+	}
+}
+
+// update recomputes the limit from the window that just ended.
+func (l *Limiter) update() {
+	limit := l.limit
+	switch {
+	case l.dropped:
+		limit *= backoff
+	case l.samples > 0:
+		latency := l.sum.Seconds() / float64(l.samples)
+		if l.baseline == 0 {
+			l.baseline = latency
+		} else {
+			l.baseline += (latency - l.baseline) * baselineWeight
+		}
+
+		gradient := max(minGradient, min(1, l.tolerance*l.baseline/latency))
+		estimate := limit*gradient + math.Sqrt(limit)
+		if float64(l.peak) < limit/2 {
+			// an idle limit says nothing about what the upstream can take
+			estimate = min(estimate, limit)
+		}
+		limit += (estimate - limit) * smoothing
+	default:
+		return
+	}
+
+	limit = max(l.min, min(l.max, limit))
+	changed := int(limit) != int(l.limit)
+	l.limit = limit
+	if changed && l.onLimit != nil {
+		l.onLimit(int(limit))
+	}
+}
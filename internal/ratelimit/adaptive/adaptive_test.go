@@ -0,0 +1,109 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter(c *clock, initial int) *Limiter {
+	l := New(Options{InitialLimit: initial, MinLimit: 2, MaxLimit: 100, Tolerance: 2, Window: time.Second})
+	l.now = func() time.Time { return c.now }
+	l.windowStart = c.now
+	return l
+}
+
+// window runs n concurrent requests taking latency each, then closes the window.
+func window(t *testing.T, l *Limiter, c *clock, n int, latency time.Duration, failed bool) {
+	t.Helper()
+
+	releases := make([]func(bool), 0, n)
+	for range n {
+		release, ok := l.Acquire()
+		if !ok {
+			t.Fatalf("request shed below the limit %d", l.Limit())
+		}
+		releases = append(releases, release)
+	}
+
+	c.advance(latency)
+	for _, release := range releases {
+		release(failed)
+	}
+	c.advance(time.Second)
+	release, _ := l.Acquire()
+	release(false)
+}
+
+func TestLimiter_ShedsAtLimit(t *testing.T) {
+	l := newTestLimiter(&clock{now: time.Unix(1000, 0)}, 2)
+
+	r1, ok1 := l.Acquire()
+	_, ok2 := l.Acquire()
+	_, ok3 := l.Acquire()
+	if !ok1 || !ok2 || ok3 {
+		t.Fatalf("admitted=%v,%v,%v want the first two", ok1, ok2, ok3)
+	}
+
+	r1(false)
+	if _, ok := l.Acquire(); !ok {
+		t.Fatalf("released slot should be reusable")
+	}
+}
+
+func TestLimiter_GrowsWhileUpstreamKeepsUp(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	l := newTestLimiter(c, 10)
+
+	for range 10 {
+		window(t, l, c, l.Limit(), 10*time.Millisecond, false)
+	}
+	if got := l.Limit(); got <= 10 {
+		t.Fatalf("limit=%d want growth above 10", got)
+	}
+}
+
+func TestLimiter_IdleLimitDoesNotGrow(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	l := newTestLimiter(c, 20)
+
+	for range 10 {
+		window(t, l, c, 2, 10*time.Millisecond, false)
+	}
+	if got := l.Limit(); got != 20 {
+		t.Fatalf("limit=%d want 20", got)
+	}
+}
+
+func TestLimiter_BacksOffOnLatency(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	l := newTestLimiter(c, 50)
+
+	window(t, l, c, 40, 10*time.Millisecond, false)
+	before := l.Limit()
+	for range 5 {
+		window(t, l, c, min(40, l.Limit()), 200*time.Millisecond, false)
+	}
+	if got := l.Limit(); got >= before {
+		t.Fatalf("limit=%d want below %d after latency rose", got, before)
+	}
+}
+
+func TestLimiter_BacksOffOnErrorsToMin(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	var reported int
+	l := New(Options{InitialLimit: 10, MinLimit: 2, MaxLimit: 100, Tolerance: 2, Window: time.Second,
+		OnLimit: func(limit int) { reported = limit }})
+	l.now = func() time.Time { return c.now }
+	l.windowStart = c.now
+
+	for range 50 {
+		window(t, l, c, 1, 10*time.Millisecond, true)
+	}
+	if got := l.Limit(); got != 2 || reported != 2 {
+		t.Fatalf("limit=%d reported=%d want min 2", got, reported)
+	}
+}
@@ -0,0 +1,219 @@
+// Package fairqueue caps concurrent upstream requests and orders the waiting ones by weighted fair queueing.
+package fairqueue
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrQueueFull = errors.New("fairqueue: queue full")
+
+// DefaultTier is used for keys without a tier and for tiers missing from the weights.
+const DefaultTier = "default"
+
+// pruneFlows is the number of tracked keys above which idle ones are forgotten.
+const pruneFlows = 10_000
+
+// Queue admits at most MaxInFlight requests at a time. When full, requests wait and are admitted in
+// order of their virtual finish time (start-time fair queueing): every api key is its own flow, and
+// a flow with weight w advances 1/w per request, so a key flooding the queue only delays itself and
+// higher tiers get proportionally more turns.
+type Queue struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	depth    int
+	maxWait  time.Duration
+	weights  map[string]float64
+
+	vtime   float64            // virtual time: finish tag of the last admitted request
+	flows   map[string]float64 // key -> finish tag of its last queued request
+	waiting waitHeap
+	seq     uint64
+	byTier  map[string]int
+
+	onDepth func(tier string, depth int)
+}
+
+type Options struct {
+	MaxInFlight int
+	QueueDepth  int
+	MaxWait     time.Duration // 0 means wait for as long as the queue allows
+	Weights     map[string]int
+
+	// OnDepth is called with the new queue depth of a tier whenever it changes, under the queue lock.
+	OnDepth func(tier string, depth int)
+}
+
+func New(opts Options) *Queue {
+	weights := map[string]float64{DefaultTier: 1}
+	for tier, w := range opts.Weights {
+		if w > 0 {
+			weights[tier] = float64(w)
+		}
+	}
+
+	return &Queue{
+		max:     opts.MaxInFlight,
+		depth:   opts.QueueDepth,
+		maxWait: opts.MaxWait,
+		weights: weights,
+		flows:   map[string]float64{},
+		byTier:  map[string]int{},
+		onDepth: opts.OnDepth,
+	}
+}
+
+// Tier returns the tier name the queue accounts tier under.
+func (q *Queue) Tier(tier string) string {
+	if _, ok := q.weights[tier]; ok {
+		return tier
+	}
+
+	return DefaultTier
+}
+
+// Acquire waits for a slot for key and returns the function that frees it.
+func (q *Queue) Acquire(ctx context.Context, key, tier string) (func(), error) {
+	tier = q.Tier(tier)
+
+	q.mu.Lock()
+	if q.inFlight < q.max && len(q.waiting) == 0 {
+		q.inFlight++
+		q.mu.Unlock()
+		return q.release, nil
+	}
+
+	if len(q.waiting) >= q.depth {
+		q.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	start := max(q.vtime, q.flows[key])
+	q.seq++
+	w := &waiter{
+		tag:   start + 1/q.weights[tier],
+		seq:   q.seq,
+		tier:  tier,
+		ready: make(chan struct{}),
+	}
+	q.flows[key] = w.tag
+	heap.Push(&q.waiting, w)
+	q.setDepth(tier, 1)
+	q.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if q.maxWait > 0 {
+		t := time.NewTimer(q.maxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-w.ready:
+		return q.release, nil
+	case <-ctx.Done():
+		return nil, q.abandon(w, ctx.Err())
+	case <-timeout:
+		return nil, q.abandon(w, ErrQueueFull)
+	}
+}
+
+// Waiting returns the number of queued requests.
+func (q *Queue) Waiting() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.waiting)
+}
+
+func (q *Queue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiting) == 0 {
+		q.inFlight--
+		return
+	}
+
+	// hand the slot straight to the next waiter
+	w := heap.Pop(&q.waiting).(*waiter)
+	q.vtime = w.tag
+	q.setDepth(w.tier, -1)
+	close(w.ready)
+
+	if len(q.flows) > pruneFlows {
+		for k, tag := range q.flows {
+			if tag <= q.vtime {
+				delete(q.flows, k)
+			}
+		}
+	}
+}
+
+// abandon removes w from the queue; if it was admitted meanwhile, the slot is passed on.
+func (q *Queue) abandon(w *waiter, err error) error {
+	q.mu.Lock()
+	if w.index >= 0 {
+		heap.Remove(&q.waiting, w.index)
+		q.setDepth(w.tier, -1)
+		q.mu.Unlock()
+		return err
+	}
+	q.mu.Unlock()
+
+	// lost the race with release: the slot is ours, give it back
+	<-w.ready
+	q.release()
+	return err
+}
+
+func (q *Queue) setDepth(tier string, delta int) {
+	q.byTier[tier] += delta
+	if q.onDepth != nil {
+		q.onDepth(tier, q.byTier[tier])
+	}
+}
+
+type waiter struct {
+	tag   float64
+	seq   uint64 // arrival order among equal tags
+	tier  string
+	index int
+	ready chan struct{}
+}
+
+type waitHeap []*waiter
+
+func (h waitHeap) Len() int { return len(h) }
+func (h waitHeap) Less(i, j int) bool {
+	if h[i].tag != h[j].tag {
+		return h[i].tag < h[j].tag
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waitHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waitHeap) Pop() any {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*h = old[:n-1]
+	return w
+}
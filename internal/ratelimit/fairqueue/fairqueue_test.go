@@ -0,0 +1,136 @@
+package fairqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// admitted queues the given (key, tier) requests behind a full queue, then releases slots one by
+// one and returns the keys in the order they were admitted.
+func admitted(t *testing.T, q *Queue, reqs [][2]string) []string {
+	t.Helper()
+
+	hold, err := q.Acquire(context.Background(), "holder", "")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	for i, r := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := q.Acquire(context.Background(), r[0], r[1])
+			if err != nil {
+				t.Errorf("acquire %s: %v", r[0], err)
+				return
+			}
+			mu.Lock()
+			order = append(order, r[0])
+			mu.Unlock()
+			release()
+		}()
+
+		// enqueue in a deterministic order
+		for q.Waiting() < i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	hold()
+	wg.Wait()
+	return order
+}
+
+func TestQueue_AggressiveKeyDoesNotStarveOthers(t *testing.T) {
+	q := New(Options{MaxInFlight: 1, QueueDepth: 100})
+
+	reqs := [][2]string{
+		{"flood", ""}, {"flood", ""}, {"flood", ""}, {"flood", ""}, {"flood", ""},
+		{"quiet", ""},
+	}
+	order := admitted(t, q, reqs)
+
+	pos := -1
+	for i, k := range order {
+		if k == "quiet" {
+			pos = i
+		}
+	}
+	if pos != 1 {
+		t.Fatalf("quiet admitted at %d in %v, want right after the first flood request", pos, order)
+	}
+}
+
+func TestQueue_TierWeights(t *testing.T) {
+	q := New(Options{MaxInFlight: 1, QueueDepth: 100, Weights: map[string]int{"gold": 3}})
+
+	var reqs [][2]string
+	for i := 0; i < 4; i++ {
+		reqs = append(reqs, [2]string{"free", ""})
+	}
+	for i := 0; i < 6; i++ {
+		reqs = append(reqs, [2]string{"gold", "gold"})
+	}
+	order := admitted(t, q, reqs)
+
+	// in the first four turns gold (weight 3) gets three
+	gold := 0
+	for _, k := range order[:4] {
+		if k == "gold" {
+			gold++
+		}
+	}
+	if gold != 3 {
+		t.Fatalf("gold turns in first 4 = %d want 3 (order %v)", gold, order)
+	}
+}
+
+func TestQueue_ShedAndCancel(t *testing.T) {
+	q := New(Options{MaxInFlight: 1, QueueDepth: 1, MaxWait: 20 * time.Millisecond})
+
+	hold, err := q.Acquire(context.Background(), "a", "")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := q.Acquire(context.Background(), "b", "")
+		errCh <- err
+	}()
+	for q.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := q.Acquire(context.Background(), "c", ""); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("err=%v want=%v when queue is full", err, ErrQueueFull)
+	}
+
+	if err := <-errCh; !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("err=%v want=%v after max wait", err, ErrQueueFull)
+	}
+	if q.Waiting() != 0 {
+		t.Fatalf("waiting=%d want=0 after timeout", q.Waiting())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Acquire(ctx, "d", ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want=%v", err, context.Canceled)
+	}
+
+	hold()
+	release, err := q.Acquire(context.Background(), "e", "")
+	if err != nil {
+		t.Fatalf("slot not freed: %v", err)
+	}
+	release()
+}
@@ -0,0 +1,47 @@
+// Package policy resolves the effective per-key rate limit from the configured layers.
+package policy
+
+import "tyk-proxy/internal/config"
+
+// Source names the layer an effective limit came from.
+type Source string
+
+const (
+	SourceToken  Source = "token"
+	SourcePlan   Source = "plan"
+	SourceRoute  Source = "route"
+	SourceGlobal Source = "global"
+	// SourceMethod is a route's method_limits entry, counted apart from the token's limit.
+	SourceMethod Source = "method"
+	// SourceNone means no layer sets a limit.
+	SourceNone Source = "none"
+)
+
+// Limit is an effective rate limit in requests per limiter window.
+type Limit struct {
+	Value  int    `json:"value"`
+	Source Source `json:"source"`
+}
+
+// Unlimited reports whether requests under the limit are not counted at all.
+func (l Limit) Unlimited() bool {
+	return l.Value < 0
+}
+
+// Resolve picks the most specific limit set: the token's, then its plan's, then the matched route's, then the
+// global default. A value <= 0 at any layer means "inherit", except a negative token limit, which makes the
+// token unlimited. route may be nil when no route matched, plan when the token has none.
+func Resolve(global int, route *config.Route, plan *config.Plan, token int) Limit {
+	switch {
+	case token != 0:
+		return Limit{Value: token, Source: SourceToken}
+	case plan != nil && plan.RateLimit > 0:
+		return Limit{Value: plan.RateLimit, Source: SourcePlan}
+	case route != nil && route.RateLimit > 0:
+		return Limit{Value: route.RateLimit, Source: SourceRoute}
+	case global > 0:
+		return Limit{Value: global, Source: SourceGlobal}
+	default:
+		return Limit{Source: SourceNone}
+	}
+}
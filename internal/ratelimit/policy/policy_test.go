@@ -0,0 +1,34 @@
+package policy
+
+import (
+	"testing"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		global int
+		route  *config.Route
+		plan   *config.Plan
+		token  int
+		want   Limit
+	}{
+		{name: "token wins", global: 10, route: &config.Route{RateLimit: 20}, plan: &config.Plan{RateLimit: 40}, token: 30, want: Limit{30, SourceToken}},
+		{name: "plan over route", global: 10, route: &config.Route{RateLimit: 20}, plan: &config.Plan{RateLimit: 40}, want: Limit{40, SourcePlan}},
+		{name: "plan without limit inherits route", route: &config.Route{RateLimit: 20}, plan: &config.Plan{}, want: Limit{20, SourceRoute}},
+		{name: "route over global", global: 10, route: &config.Route{RateLimit: 20}, want: Limit{20, SourceRoute}},
+		{name: "route without limit inherits global", global: 10, route: &config.Route{}, want: Limit{10, SourceGlobal}},
+		{name: "no route matched", global: 10, token: 0, want: Limit{10, SourceGlobal}},
+		{name: "token only", token: 5, want: Limit{5, SourceToken}},
+		{name: "unlimited token", global: 10, plan: &config.Plan{RateLimit: 40}, token: -1, want: Limit{-1, SourceToken}},
+		{name: "nothing set", route: &config.Route{}, want: Limit{0, SourceNone}},
+	}
+
+	for _, tt := range tests {
+		if got := Resolve(tt.global, tt.route, tt.plan, tt.token); got != tt.want {
+			t.Fatalf("%s: got=%+v want=%+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,23 +2,65 @@ package service
 
 import (
 	"context"
+	"math/rand/v2"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/decision"
+	mp "tyk-proxy/internal/metrics"
+)
+
+// Limiter decisions, as counted in metrics.
+const (
+	decisionAllowed = "allowed"
+	decisionLimited = "limited"
+	decisionError   = "error"
+
+	// answered by the fallback store while the store fails
+	decisionLocalAllowed = "local_allowed"
+	decisionLocalLimited = "local_limited"
 )
 
 type store interface {
 	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
 }
 
+type buckets interface {
+	Take(ctx context.Context, key string, rate, burst int, window time.Duration) (bool, int64, error)
+}
+
 type RateLimit struct {
-	store  store
-	window time.Duration
+	store          store
+	buckets        buckets
+	window         time.Duration
+	shards         int
+	shardThreshold int
+	fallback       store
+	fallbackShare  int
+	metrics        *mp.Metrics
 }
 
 type Options struct {
 	Window time.Duration
+
+	// Shards spreads the counter of a key whose limit is at least ShardThreshold over that many counters,
+	// so a very busy key does not turn into a single hot key in the store. Values below 2 disable it.
+	Shards         int
+	ShardThreshold int
+
+	// Buckets switches to token buckets: a key refills at its limit per Window and may spend up to its burst
+	// at once. Window counters and sharding are not used then.
+	Buckets buckets
+
+	// Fallback counts requests over fixed windows while the store (or buckets) fail, e.g. in process memory,
+	// instead of failing them. Its limits are the configured ones divided by FallbackShare (default 1), the
+	// number of instances the traffic is spread over, and at least 1.
+	Fallback      store
+	FallbackShare int
+
+	Metrics *mp.Metrics
 }
 
 func NewRateLimit(s store) *RateLimit {
@@ -31,13 +73,26 @@ func NewRateLimitWithOptions(s store, opts Options) *RateLimit {
 		w = time.Minute // N requests per minute by default
 	}
 
+	share := opts.FallbackShare
+	if share < 1 {
+		share = 1
+	}
+
 	return &RateLimit{
-		store:  s,
-		window: w,
+		store:          s,
+		buckets:        opts.Buckets,
+		window:         w,
+		shards:         opts.Shards,
+		shardThreshold: opts.ShardThreshold,
+		fallback:       opts.Fallback,
+		fallbackShare:  share,
+		metrics:        opts.Metrics,
 	}
 }
 
-func (rl *RateLimit) Allow(ctx context.Context, key string, limit int) (bool, error) {
+// Allow counts a request of key against limit per window. burst only applies to token buckets, where 0 means
+// a burst of limit.
+func (rl *RateLimit) Allow(ctx context.Context, key string, limit, burst int) (bool, error) {
 	if key == "" {
 		return false, errors.New("rate limit: empty key")
 	}
@@ -46,12 +101,99 @@ func (rl *RateLimit) Allow(ctx context.Context, key string, limit int) (bool, er
 		return false, errors.New("rate limit: limit must be > 0")
 	}
 
-	n, err := rl.store.Incr(ctx, key, rl.window)
-	log.Debug().Str("key", key).Int64("n", n).Msg("current rate")
+	if rl.buckets != nil {
+		return rl.take(ctx, key, limit, burst)
+	}
 
+	counter, scale := key, int64(1)
+	if rl.shards > 1 && limit >= rl.shardThreshold {
+		counter, scale = key+"#"+strconv.Itoa(rand.IntN(rl.shards)), int64(rl.shards)
+	}
+
+	start := time.Now()
+	n, err := rl.store.Incr(ctx, counter, rl.window)
+	rl.metrics.ObserveLimiterStore(time.Since(start))
 	if err != nil {
+		if rl.fallback != nil {
+			return rl.local(ctx, key, limit, err)
+		}
+		rl.metrics.IncLimiterDecision(decisionError)
 		return false, errors.Wrap(err, "rate limit: failed to increment counter")
 	}
+	if atBoundary(n, scale, limit) {
+		rl.metrics.IncLimiterBoundary()
+	}
+	// a request lands on a random shard, so one shard's count times the shards estimates the key's count
+	n *= scale
+
+	decision.FromContext(ctx).SetCount(n)
+
+	allowed := n <= int64(limit)
+	rl.observe(allowed)
+
+	return allowed, nil
+}
+
+// atBoundary reports whether count, the count of one of scale shards, reached the shard's share of limit.
+func atBoundary(count, scale int64, limit int) bool {
+	return count == (int64(limit)+scale-1)/scale
+}
+
+func (rl *RateLimit) take(ctx context.Context, key string, limit, burst int) (bool, error) {
+	if burst <= 0 {
+		burst = limit
+	}
+
+	start := time.Now()
+	ok, left, err := rl.buckets.Take(ctx, key, limit, burst, rl.window)
+	rl.metrics.ObserveLimiterStore(time.Since(start))
+	if err != nil {
+		if rl.fallback != nil {
+			return rl.local(ctx, key, limit, err)
+		}
+		rl.metrics.IncLimiterDecision(decisionError)
+		return false, errors.Wrap(err, "rate limit: failed to take a token")
+	}
+
+	// the tokens spent stand in for the window count
+	n := int64(burst) - left
+	if !ok {
+		n++
+	}
+	decision.FromContext(ctx).SetCount(n)
+	rl.observe(ok)
+
+	return ok, nil
+}
+
+// local counts the request in the fallback store after the store failed with cause.
+func (rl *RateLimit) local(ctx context.Context, key string, limit int, cause error) (bool, error) {
+	n, err := rl.fallback.Incr(ctx, key, rl.window)
+	if err != nil {
+		rl.metrics.IncLimiterDecision(decisionError)
+		return false, errors.Wrapf(err, "rate limit: fallback failed after %v", cause)
+	}
+
+	decision.FromContext(ctx).SetCount(n)
+	allowed := n <= int64(max(limit/rl.fallbackShare, 1))
+	if allowed {
+		rl.metrics.IncLimiterDecision(decisionLocalAllowed)
+	} else {
+		rl.metrics.IncLimiterDecision(decisionLocalLimited)
+	}
+
+	return allowed, nil
+}
+
+func (rl *RateLimit) observe(allowed bool) {
+	if allowed {
+		rl.metrics.IncLimiterDecision(decisionAllowed)
+	} else {
+		rl.metrics.IncLimiterDecision(decisionLimited)
+	}
+}
 
-	return n <= int64(limit), nil
+// Window is the window limits are counted over, or token buckets refill their limit in.
+func (rl *RateLimit) Window() time.Duration {
+	return rl.window
 }
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+
+	rs "tyk-proxy/internal/ratelimit/store"
+)
+
+// BenchmarkAllow measures a limiter decision against the Redis store (miniredis, so the number
+// tracks client-side overhead and the Lua round trip, not network latency).
+func BenchmarkAllow(b *testing.B) {
+	lvl := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	b.Cleanup(func() { zerolog.SetGlobalLevel(lvl) })
+
+	mr := miniredis.RunT(b)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	b.Cleanup(func() { _ = rdb.Close() })
+
+	rl := NewRateLimit(rs.NewStore(rdb, rs.Options{Prefix: "bench:"}))
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rl.Allow(ctx, "k1", 1<<30, 0); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
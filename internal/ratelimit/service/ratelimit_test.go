@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"strconv"
 	"testing"
 	"time"
 
@@ -27,7 +28,7 @@ func TestNewRateLimitWithOptions_DefaultWindowIsOneMinute(t *testing.T) {
 	fs := &fakeStore{n: 1}
 	rl := NewRateLimitWithOptions(fs, Options{Window: 0})
 
-	_, _ = rl.Allow(context.Background(), "k", 10)
+	_, _ = rl.Allow(context.Background(), "k", 10, 0)
 
 	if fs.lastWindow != time.Minute {
 		t.Fatalf("expected window %s, got %s", time.Minute, fs.lastWindow)
@@ -38,7 +39,7 @@ func TestNewRateLimit_DefaultWindowIsOneMinute(t *testing.T) {
 	fs := &fakeStore{n: 1}
 	rl := NewRateLimit(fs)
 
-	_, _ = rl.Allow(context.Background(), "k", 10)
+	_, _ = rl.Allow(context.Background(), "k", 10, 0)
 
 	if fs.lastWindow != time.Minute {
 		t.Fatalf("expected window %s, got %s", time.Minute, fs.lastWindow)
@@ -49,7 +50,7 @@ func TestNewRateLimitWithOptions_CustomWindow(t *testing.T) {
 	fs := &fakeStore{n: 1}
 	rl := NewRateLimitWithOptions(fs, Options{Window: 10 * time.Second})
 
-	_, _ = rl.Allow(context.Background(), "k", 10)
+	_, _ = rl.Allow(context.Background(), "k", 10, 0)
 
 	if fs.lastWindow != 10*time.Second {
 		t.Fatalf("expected window %s, got %s", 10*time.Second, fs.lastWindow)
@@ -60,7 +61,7 @@ func TestAllow_EmptyKey(t *testing.T) {
 	fs := &fakeStore{n: 1}
 	rl := NewRateLimitWithOptions(fs, Options{Window: time.Second})
 
-	ok, err := rl.Allow(context.Background(), "", 10)
+	ok, err := rl.Allow(context.Background(), "", 10, 0)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -77,7 +78,7 @@ func TestAllow_InvalidLimit(t *testing.T) {
 	fs := &fakeStore{n: 1}
 	rl := NewRateLimitWithOptions(fs, Options{Window: time.Second})
 
-	ok, err := rl.Allow(context.Background(), "k", 0)
+	ok, err := rl.Allow(context.Background(), "k", 0, 0)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -95,7 +96,7 @@ func TestAllow_StoreError_IsWrapped(t *testing.T) {
 	fs := &fakeStore{n: 0, err: root}
 	rl := NewRateLimitWithOptions(fs, Options{Window: time.Second})
 
-	ok, err := rl.Allow(context.Background(), "k", 10)
+	ok, err := rl.Allow(context.Background(), "k", 10, 0)
 	if ok {
 		t.Fatal("expected ok=false")
 	}
@@ -112,11 +113,43 @@ func TestAllow_StoreError_IsWrapped(t *testing.T) {
 	}
 }
 
+func TestAllow_StoreError_Fallback(t *testing.T) {
+	fs := &fakeStore{err: errors.New("boom")}
+	local := &fakeStore{}
+	rl := NewRateLimitWithOptions(fs, Options{Window: time.Second, Fallback: local, FallbackShare: 3})
+
+	// a limit of 10 shared by 3 instances leaves 3 requests to each
+	for i := int64(1); i <= 4; i++ {
+		local.n = i
+		ok, err := rl.Allow(context.Background(), "k", 10, 0)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		if want := i <= 3; ok != want {
+			t.Fatalf("request %d: ok=%v want=%v", i, ok, want)
+		}
+	}
+	if local.lastKey != "k" || local.lastWindow != time.Second {
+		t.Fatalf("fallback counted key=%q window=%s", local.lastKey, local.lastWindow)
+	}
+
+	// below one request per instance, each instance still lets one through
+	local.n = 1
+	if ok, _ := rl.Allow(context.Background(), "k", 2, 0); !ok {
+		t.Fatalf("expected the first request allowed")
+	}
+
+	local.err = errors.New("full")
+	if _, err := rl.Allow(context.Background(), "k", 10, 0); err == nil {
+		t.Fatalf("expected error when the fallback fails too")
+	}
+}
+
 func TestAllow_AllowedWithinLimit(t *testing.T) {
 	fs := &fakeStore{n: 5}
 	rl := NewRateLimitWithOptions(fs, Options{Window: time.Second})
 
-	ok, err := rl.Allow(context.Background(), "k", 5)
+	ok, err := rl.Allow(context.Background(), "k", 5, 0)
 	if err != nil {
 		t.Fatalf("expected nil error, got %v", err)
 	}
@@ -129,7 +162,7 @@ func TestAllow_DeniedOverLimit(t *testing.T) {
 	fs := &fakeStore{n: 6}
 	rl := NewRateLimitWithOptions(fs, Options{Window: time.Second})
 
-	ok, err := rl.Allow(context.Background(), "k", 5)
+	ok, err := rl.Allow(context.Background(), "k", 5, 0)
 	if err != nil {
 		t.Fatalf("expected nil error, got %v", err)
 	}
@@ -142,7 +175,7 @@ func TestAllow_PassesKeyAndWindowToStore(t *testing.T) {
 	fs := &fakeStore{n: 1}
 	rl := NewRateLimitWithOptions(fs, Options{Window: 3 * time.Second})
 
-	_, _ = rl.Allow(context.Background(), "my-key", 10)
+	_, _ = rl.Allow(context.Background(), "my-key", 10, 0)
 
 	if fs.lastKey != "my-key" {
 		t.Fatalf("expected key %q, got %q", "my-key", fs.lastKey)
@@ -151,3 +184,88 @@ func TestAllow_PassesKeyAndWindowToStore(t *testing.T) {
 		t.Fatalf("expected window %s, got %s", 3*time.Second, fs.lastWindow)
 	}
 }
+
+// countingStore counts like the real stores, per key.
+type countingStore map[string]int64
+
+func (c countingStore) Incr(_ context.Context, key string, _ time.Duration) (int64, error) {
+	c[key]++
+	return c[key], nil
+}
+
+func TestAllow_Sharded(t *testing.T) {
+	cs := countingStore{}
+	rl := NewRateLimitWithOptions(cs, Options{Window: time.Second, Shards: 4, ShardThreshold: 1000})
+
+	_, _ = rl.Allow(context.Background(), "small", 999, 0)
+	if cs["small"] != 1 {
+		t.Fatalf("keys=%v want a limit below the threshold counted unsharded", cs)
+	}
+
+	allowed := 0
+	for range 4000 {
+		if ok, _ := rl.Allow(context.Background(), "big", 2000, 0); ok {
+			allowed++
+		}
+	}
+	for i := range 4 {
+		if cs["big#"+strconv.Itoa(i)] == 0 {
+			t.Fatalf("keys=%v want every shard used", cs)
+		}
+	}
+	if cs["big"] != 0 {
+		t.Fatalf("unsharded counter used for a limit above the threshold")
+	}
+	if allowed < 1800 || allowed > 2200 {
+		t.Fatalf("allowed=%d want about the limit of 2000", allowed)
+	}
+}
+
+func TestAtBoundary(t *testing.T) {
+	tests := []struct {
+		count, scale int64
+		limit        int
+		want         bool
+	}{
+		{count: 10, scale: 1, limit: 10, want: true},
+		{count: 9, scale: 1, limit: 10},
+		{count: 11, scale: 1, limit: 10},
+		{count: 500, scale: 4, limit: 2000, want: true},
+		{count: 501, scale: 4, limit: 2000},
+		{count: 500, scale: 4, limit: 1998, want: true}, // the shard's share rounds up
+		{count: 499, scale: 4, limit: 1998},
+	}
+
+	for _, tt := range tests {
+		if got := atBoundary(tt.count, tt.scale, tt.limit); got != tt.want {
+			t.Errorf("atBoundary(%d, %d, %d)=%v want %v", tt.count, tt.scale, tt.limit, got, tt.want)
+		}
+	}
+}
+
+type fakeBuckets struct {
+	rate, burst int
+	window      time.Duration
+}
+
+func (f *fakeBuckets) Take(_ context.Context, _ string, rate, burst int, window time.Duration) (bool, int64, error) {
+	f.rate, f.burst, f.window = rate, burst, window
+	return true, int64(burst - 1), nil
+}
+
+func TestAllow_TokenBucket(t *testing.T) {
+	fs, fb := &fakeStore{n: 1}, &fakeBuckets{}
+	rl := NewRateLimitWithOptions(fs, Options{Window: time.Minute, Buckets: fb})
+
+	if ok, err := rl.Allow(context.Background(), "k", 10, 50); !ok || err != nil {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+	if fb.rate != 10 || fb.burst != 50 || fb.window != time.Minute || fs.lastKey != "" {
+		t.Fatalf("buckets=%+v store key=%q want the bucket used with the token's burst", fb, fs.lastKey)
+	}
+
+	_, _ = rl.Allow(context.Background(), "k", 10, 0)
+	if fb.burst != 10 {
+		t.Fatalf("burst=%d want the limit without a burst", fb.burst)
+	}
+}
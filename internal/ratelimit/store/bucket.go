@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills the bucket for the time since its last request, at ARGV[2] tokens per ms up to ARGV[1],
+// and takes a token if there is one. A bucket seen for the first time starts full. It returns whether a token
+// was taken and the whole tokens left.
+var takeScript = redis.NewScript(`
+	local capacity = tonumber(ARGV[1])
+	local rate = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+
+	local b = redis.call("HMGET", KEYS[1], "tokens", "ts")
+	local tokens = tonumber(b[1])
+	local ts = tonumber(b[2])
+	if tokens == nil or ts == nil then
+	  tokens = capacity
+	  ts = now
+	end
+
+	tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+	local taken = 0
+	if tokens >= 1 then
+	  tokens = tokens - 1
+	  taken = 1
+	end
+
+	redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+	redis.call("PEXPIRE", KEYS[1], ARGV[4])
+	return {taken, math.floor(tokens)}
+`)
+
+// Take takes a token from the bucket of key, which holds up to burst tokens and refills at rate tokens per
+// window. It reports whether the request may go on and the tokens left. Buckets live under BucketPrefix, as
+// hashes of the token level and the time it was last updated.
+func (s *Store) Take(ctx context.Context, key string, rate, burst int, window time.Duration) (bool, int64, error) {
+	if window < time.Millisecond || rate <= 0 || burst <= 0 {
+		return false, 0, errors.New("store: window must be >= 1ms, rate and burst > 0")
+	}
+
+	perMs := float64(rate) / float64(window.Milliseconds())
+	// an idle bucket is full again after this; dropping it then loses nothing
+	ttlMs := int64(float64(burst)/perMs) + 1000
+
+	res, err := takeScript.Run(ctx, s.rdcl, []string{s.bucketPrefix + key},
+		burst, perMs, s.now().UnixMilli(), ttlMs).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("store: unexpected script result %v", res)
+	}
+
+	return res[0] == 1, res[1], nil
+}
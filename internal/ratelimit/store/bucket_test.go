@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStore_Take(t *testing.T) {
+	mr, rdb := newRedis(t)
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	s := NewStore(rdb, Options{BucketPrefix: "bucket:", Now: func() time.Time { return now }})
+	ctx := context.Background()
+
+	// 60 per minute with a burst of 3: three at once, then one per second
+	for want := int64(2); want >= 0; want-- {
+		if ok, left, err := s.Take(ctx, "key", 60, 3, time.Minute); err != nil || !ok || left != want {
+			t.Fatalf("ok=%v left=%d err=%v want a token with %d left", ok, left, err, want)
+		}
+	}
+	if ok, _, err := s.Take(ctx, "key", 60, 3, time.Minute); err != nil || ok {
+		t.Fatalf("ok=%v err=%v want the empty bucket to refuse", ok, err)
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	if ok, left, err := s.Take(ctx, "key", 60, 3, time.Minute); err != nil || !ok || left != 0 {
+		t.Fatalf("ok=%v left=%d err=%v want the refilled token taken", ok, left, err)
+	}
+
+	// an idle bucket is kept until it would be full again
+	if ttl := mr.TTL("bucket:key"); ttl != 4*time.Second {
+		t.Fatalf("ttl=%s want 4s", ttl)
+	}
+
+	now = now.Add(time.Hour)
+	if ok, left, err := s.Take(ctx, "key", 60, 3, time.Minute); err != nil || !ok || left != 2 {
+		t.Fatalf("ok=%v left=%d err=%v want refills capped at the burst", ok, left, err)
+	}
+}
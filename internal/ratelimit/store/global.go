@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	mp "tyk-proxy/internal/metrics"
+)
+
+const (
+	syncOK    = "ok"
+	syncError = "error"
+)
+
+type counter interface {
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+}
+
+// GlobalStore counts in a local store and reconciles with the other regions of a fleet through a global Redis,
+// where every window of a key is a hash of per-region counts. Requests only touch the local store: a key's
+// count is its local count plus the other regions' counts as of the last sync.
+type GlobalStore struct {
+	local     counter
+	global    redis.UniversalClient
+	region    string
+	prefix    string
+	tolerance int64
+	metrics   *mp.Metrics
+	now       func() time.Time
+
+	early chan struct{}
+
+	mu      sync.Mutex
+	windows map[string]*globalWindow // by global key
+}
+
+type GlobalOptions struct {
+	Region    string
+	Prefix    string
+	Tolerance int // unsynced requests of a key that trigger an early sync
+	Metrics   *mp.Metrics
+	Now       func() time.Time
+}
+
+// globalWindow is a window of a key this region counted in.
+type globalWindow struct {
+	end      time.Time
+	unsynced int64 // counted here, not yet added to the global hash
+	remote   int64 // counted by the other regions, as of the last sync
+}
+
+func NewGlobalStore(local counter, global redis.UniversalClient, opts GlobalOptions) *GlobalStore {
+	now := opts.Now
+	if now == nil {
+		now = func() time.Time { return time.Now().UTC() }
+	}
+	pfx := opts.Prefix
+	if pfx == "" {
+		pfx = "rate_count_global:"
+	}
+
+	return &GlobalStore{
+		local:     local,
+		global:    global,
+		region:    opts.Region,
+		prefix:    pfx,
+		tolerance: int64(opts.Tolerance),
+		metrics:   opts.Metrics,
+		now:       now,
+		early:     make(chan struct{}, 1),
+		windows:   map[string]*globalWindow{},
+	}
+}
+
+func (s *GlobalStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	n, err := s.local.Incr(ctx, key, window)
+	if err != nil {
+		return 0, err
+	}
+
+	ws := windowStart(s.now(), window)
+	gk := fmt.Sprintf("%s%s:%d", s.prefix, key, ws.Unix())
+
+	s.mu.Lock()
+	w, ok := s.windows[gk]
+	if !ok {
+		w = &globalWindow{end: ws.Add(window)}
+		s.windows[gk] = w
+	}
+	w.unsynced++
+	remote, due := w.remote, s.tolerance > 0 && w.unsynced >= s.tolerance
+	s.mu.Unlock()
+
+	if due {
+		select {
+		case s.early <- struct{}{}:
+		default: // a sync is already pending
+		}
+	}
+
+	return n + remote, nil
+}
+
+// Run syncs every interval, and early when a key reaches the tolerance, until ctx is done.
+func (s *GlobalStore) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// hand the last counts over, so the other regions see them
+			sctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			_ = s.Sync(sctx)
+			cancel()
+			return
+		case <-t.C:
+		case <-s.early:
+		}
+
+		sctx, cancel := context.WithTimeout(ctx, interval)
+		if err := s.Sync(sctx); err != nil {
+			log.Warn().Err(err).Msg("rate limit: global counter sync failed")
+		}
+		cancel()
+	}
+}
+
+// Sync adds the unsynced counts of the live windows to the global hashes and reads back the other regions'.
+// On failure the counts stay unsynced and go out with the next sync.
+func (s *GlobalStore) Sync(ctx context.Context) error {
+	type pending struct {
+		key   string
+		w     *globalWindow
+		delta int64
+		all   *redis.MapStringStringCmd
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	batch := make([]pending, 0, len(s.windows))
+	for gk, w := range s.windows {
+		if !now.Before(w.end) && w.unsynced == 0 {
+			delete(s.windows, gk)
+			continue
+		}
+		batch = append(batch, pending{key: gk, w: w, delta: w.unsynced})
+		w.unsynced = 0
+	}
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	pipe := s.global.Pipeline()
+	for i, p := range batch {
+		if p.delta > 0 {
+			pipe.HIncrBy(ctx, p.key, s.region, p.delta)
+			// kept past the window end, so regions syncing late still add to it
+			pipe.PExpireAt(ctx, p.key, p.w.end.Add(time.Minute))
+		}
+		batch[i].all = pipe.HGetAll(ctx, p.key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.mu.Lock()
+		for _, p := range batch {
+			p.w.unsynced += p.delta
+		}
+		s.mu.Unlock()
+		s.metrics.IncGlobalSync(syncError)
+		return err
+	}
+
+	s.mu.Lock()
+	for _, p := range batch {
+		var remote int64
+		for region, v := range p.all.Val() {
+			if region == s.region {
+				continue
+			}
+			n, _ := strconv.ParseInt(v, 10, 64)
+			remote += n
+		}
+		if remote > p.w.remote {
+			s.metrics.ObserveGlobalDrift(remote - p.w.remote)
+		}
+		p.w.remote = remote
+	}
+	s.mu.Unlock()
+	s.metrics.IncGlobalSync(syncOK)
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return mr, rdb
+}
+
+func TestGlobalStore_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 10, 0, 30, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	globalMR, global := newRedis(t)
+	globalMR.SetTime(now) // PEXPIREAT is checked against the server clock
+	region := func(name string) *GlobalStore {
+		_, local := newRedis(t)
+		return NewGlobalStore(NewStore(local, Options{Now: clock}), global, GlobalOptions{Region: name, Now: clock})
+	}
+	eu, us := region("eu"), region("us")
+
+	incr := func(s *GlobalStore) int64 {
+		t.Helper()
+		n, err := s.Incr(ctx, "key", time.Minute)
+		if err != nil {
+			t.Fatalf("incr: %v", err)
+		}
+		return n
+	}
+
+	for range 3 {
+		incr(eu)
+	}
+	if n := incr(us); n != 1 {
+		t.Fatalf("us before sync n=%d want 1", n)
+	}
+
+	globalMR.SetError("unreachable")
+	if err := eu.Sync(ctx); err == nil {
+		t.Fatalf("sync against a failing global store should fail")
+	}
+	globalMR.SetError("")
+
+	// the failed sync kept eu's counts for the next one
+	for _, s := range []*GlobalStore{eu, us, eu} {
+		if err := s.Sync(ctx); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	if n := incr(us); n != 2+3 {
+		t.Fatalf("us after sync n=%d want its 2 plus eu's 3", n)
+	}
+	if n := incr(eu); n != 4+1 {
+		t.Fatalf("eu after sync n=%d want its 4 plus us's 1", n)
+	}
+
+	// a new window starts from zero everywhere, and the old one is forgotten once synced
+	now = now.Add(time.Minute)
+	if err := us.Sync(ctx); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := us.Sync(ctx); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(us.windows) != 0 {
+		t.Fatalf("windows=%d want the ended one dropped", len(us.windows))
+	}
+	if n := incr(us); n != 1 {
+		t.Fatalf("next window n=%d want 1", n)
+	}
+}
+
+func TestGlobalStore_EarlySync(t *testing.T) {
+	_, local := newRedis(t)
+	_, global := newRedis(t)
+	s := NewGlobalStore(NewStore(local, Options{}), global, GlobalOptions{Region: "eu", Tolerance: 2})
+
+	for i := range 2 {
+		if len(s.early) != 0 {
+			t.Fatalf("early sync requested after %d requests, want after 2", i)
+		}
+		if _, err := s.Incr(context.Background(), "key", time.Minute); err != nil {
+			t.Fatalf("incr: %v", err)
+		}
+	}
+	if len(s.early) != 1 {
+		t.Fatalf("no early sync requested at the tolerance")
+	}
+}
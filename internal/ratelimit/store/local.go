@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"tyk-proxy/internal/cache"
+)
+
+// LocalStore keeps fixed-window counters in process memory, bounded to size keys (least recently used are
+// dropped). Each instance only counts its own requests; it stands in for the shared store while that fails.
+type LocalStore struct {
+	mu       sync.Mutex
+	counters *cache.LRU[string, *int64]
+
+	// for tests
+	now func() time.Time
+}
+
+func NewLocalStore(size int, opts Options) *LocalStore {
+	now := opts.Now
+	if now == nil {
+		now = func() time.Time { return time.Now().UTC() }
+	}
+
+	counters := cache.New[string, *int64](size, 0)
+	counters.WithOptions(&cache.Options{Now: now})
+
+	return &LocalStore{counters: counters, now: now}
+}
+
+func (s *LocalStore) Incr(_ context.Context, key string, window time.Duration) (int64, error) {
+	if window <= 0 {
+		return 0, errors.New("store: window must be > 0")
+	}
+
+	now := s.now()
+	ws := windowStart(now, window)
+	k := key + ":" + strconv.FormatInt(ws.Unix(), 10)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.counters.Get(k)
+	if !ok {
+		n = new(int64)
+		s.counters.SetWithTTL(k, n, ws.Add(window).Sub(now))
+	}
+	*n++
+
+	return *n, nil
+}
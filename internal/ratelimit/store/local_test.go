@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalStore_Incr(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 30, 0, time.UTC)
+	s := NewLocalStore(2, Options{Now: func() time.Time { return now }})
+
+	for want := int64(1); want <= 3; want++ {
+		if got, err := s.Incr(context.Background(), "a", time.Minute); err != nil || got != want {
+			t.Fatalf("n=%d err=%v want %d", got, err, want)
+		}
+	}
+
+	// a new window starts from zero
+	now = now.Add(30 * time.Second)
+	if got, _ := s.Incr(context.Background(), "a", time.Minute); got != 1 {
+		t.Fatalf("n=%d want 1 in the next window", got)
+	}
+
+	// least recently used keys are dropped beyond size
+	_, _ = s.Incr(context.Background(), "b", time.Minute)
+	_, _ = s.Incr(context.Background(), "c", time.Minute)
+	if got, _ := s.Incr(context.Background(), "a", time.Minute); got != 1 {
+		t.Fatalf("n=%d want 1 after eviction", got)
+	}
+
+	if _, err := s.Incr(context.Background(), "a", 0); err == nil {
+		t.Fatalf("expected error for zero window")
+	}
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// memcacheClient is the subset of *memcache.Client used by MemcachedStore.
+type memcacheClient interface {
+	Add(item *memcache.Item) error
+	Increment(key string, delta uint64) (uint64, error)
+	Get(key string) (*memcache.Item, error)
+}
+
+// MemcachedStore keeps fixed-window counters in Memcached for deployments without managed Redis.
+// Counters use the same window boundaries as Store, so limits behave the same on either backend.
+type MemcachedStore struct {
+	mc      memcacheClient
+	prefix  string
+	sliding bool
+
+	// for tests
+	now func() time.Time
+}
+
+func NewMemcachedStore(mc memcacheClient, opts Options) *MemcachedStore {
+	now := opts.Now
+	if now == nil {
+		now = func() time.Time { return time.Now().UTC() }
+	}
+	pfx := opts.Prefix
+	if pfx == "" {
+		pfx = "rate_count:"
+	}
+	return &MemcachedStore{
+		mc:      mc,
+		prefix:  pfx,
+		sliding: opts.SlidingWindow,
+		now:     now,
+	}
+}
+
+func (s *MemcachedStore) Incr(_ context.Context, key string, window time.Duration) (int64, error) {
+	if window <= 0 {
+		return 0, errors.New("store: window must be > 0")
+	}
+
+	now := s.now()
+	ws := windowStart(now, window)
+	k := fmt.Sprintf("%s%s:%d", s.prefix, key, ws.Unix())
+
+	// memcached expirations have one second resolution; keep the key a bit past the window like the Redis store does
+	ttl := int32(window.Seconds()) + 1
+	if s.sliding {
+		ttl += int32(window.Seconds())
+	}
+
+	n, err := s.incr(k, ttl)
+	if err != nil || !s.sliding {
+		return n, err
+	}
+
+	it, err := s.mc.Get(fmt.Sprintf("%s%s:%d", s.prefix, key, ws.Add(-window).Unix()))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return n, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	// memcached pads incremented values with spaces
+	prev, err := strconv.ParseInt(strings.TrimSpace(string(it.Value)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("store: malformed counter: %w", err)
+	}
+
+	return slidingCount(n, prev, now.Sub(ws), window), nil
+}
+
+func (s *MemcachedStore) incr(k string, ttl int32) (int64, error) {
+	// The first request of a window creates the counter; Add is atomic, so concurrent
+	// creators lose with ErrNotStored and fall through to Increment.
+	err := s.mc.Add(&memcache.Item{Key: k, Value: []byte("1"), Expiration: ttl})
+	if err == nil {
+		return 1, nil
+	}
+	if !errors.Is(err, memcache.ErrNotStored) {
+		return 0, err
+	}
+
+	v, err := s.mc.Increment(k, 1)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		// evicted or expired between Add and Increment; start the window over
+		if err := s.mc.Add(&memcache.Item{Key: k, Value: []byte("1"), Expiration: ttl}); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(v), nil
+}
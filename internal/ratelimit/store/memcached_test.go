@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+type fakeMemcache struct {
+	mu    sync.Mutex
+	items map[string]uint64
+	ttls  map[string]int32
+}
+
+func newFakeMemcache() *fakeMemcache {
+	return &fakeMemcache{items: map[string]uint64{}, ttls: map[string]int32{}}
+}
+
+func (f *fakeMemcache) Add(item *memcache.Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.items[item.Key]; ok {
+		return memcache.ErrNotStored
+	}
+	f.items[item.Key] = 1
+	f.ttls[item.Key] = item.Expiration
+	return nil
+}
+
+func (f *fakeMemcache) Increment(key string, delta uint64) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, ok := f.items[key]
+	if !ok {
+		return 0, memcache.ErrCacheMiss
+	}
+	v += delta
+	f.items[key] = v
+	return v, nil
+}
+
+func (f *fakeMemcache) Get(key string) (*memcache.Item, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, ok := f.items[key]
+	if !ok {
+		return nil, memcache.ErrCacheMiss
+	}
+	return &memcache.Item{Key: key, Value: []byte(strconv.FormatUint(v, 10))}, nil
+}
+
+func TestMemcachedStore_Incr(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 30, 0, time.UTC)
+	mc := newFakeMemcache()
+	s := NewMemcachedStore(mc, Options{Prefix: "rl:", Now: func() time.Time { return now }})
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := s.Incr(context.Background(), "key", time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("n=%d want=%d", got, want)
+		}
+	}
+
+	k := "rl:key:1767261600"
+	if mc.items[k] != 3 {
+		t.Fatalf("counter %q=%d want=3 (items=%v)", k, mc.items[k], mc.items)
+	}
+	if mc.ttls[k] != 61 {
+		t.Fatalf("ttl=%d want=61", mc.ttls[k])
+	}
+
+	now = now.Add(time.Minute)
+	got, err := s.Incr(context.Background(), "key", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 1 {
+		t.Fatalf("next window n=%d want=1", got)
+	}
+}
+
+func TestMemcachedStore_Concurrent(t *testing.T) {
+	s := NewMemcachedStore(newFakeMemcache(), Options{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Incr(context.Background(), "key", time.Hour); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := s.Incr(context.Background(), "key", time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 51 {
+		t.Fatalf("n=%d want=51", got)
+	}
+}
+
+func TestMemcachedStore_InvalidWindow(t *testing.T) {
+	s := NewMemcachedStore(newFakeMemcache(), Options{})
+	if _, err := s.Incr(context.Background(), "key", 0); err == nil {
+		t.Fatalf("expected error for zero window")
+	}
+}
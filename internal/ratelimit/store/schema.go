@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	schemaScanBatch = 100
+	schemaMaxScans  = 100
+)
+
+// KeyReport is what CheckKeys found in a sample of the keys under the counter prefix.
+type KeyReport struct {
+	Sampled int
+	// Foreign lists keys that are not counters (not named <key>:<window start> or not an integer), likely
+	// of another service sharing the prefix.
+	Foreign []string
+	// NoExpiry counts counters that lost their expiry and would never be removed until their key is
+	// incremented again. Their keys carry API keys and are not kept.
+	NoExpiry int
+}
+
+// CheckKeys checks up to sample keys under the prefix against the counter layout Incr writes.
+func (s *Store) CheckKeys(ctx context.Context, sample int) (KeyReport, error) {
+	var report KeyReport
+
+	var keys []string
+	var cursor uint64
+	for range schemaMaxScans {
+		batch, next, err := s.rdcl.Scan(ctx, cursor, s.prefix+"*", schemaScanBatch).Result()
+		if err != nil {
+			return report, err
+		}
+		keys = append(keys, batch...)
+
+		cursor = next
+		if cursor == 0 || len(keys) >= sample {
+			break
+		}
+	}
+	keys = keys[:min(len(keys), sample)]
+	if len(keys) == 0 {
+		return report, nil
+	}
+
+	pipe := s.rdcl.Pipeline()
+	values := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, k := range keys {
+		values[i] = pipe.Get(ctx, k)
+		ttls[i] = pipe.PTTL(ctx, k)
+	}
+	_, _ = pipe.Exec(ctx) // a GET of another type fails on its own
+
+	for i, k := range keys {
+		v, err := values[i].Result()
+		if errors.Is(err, redis.Nil) {
+			continue // expired since the scan
+		}
+		var rerr redis.Error
+		if err != nil && !errors.As(err, &rerr) {
+			return report, err
+		}
+
+		report.Sampled++
+		if _, perr := strconv.ParseInt(v, 10, 64); err != nil || perr != nil || !counterName(k) {
+			report.Foreign = append(report.Foreign, k)
+			continue
+		}
+		if ttls[i].Val() == -1 {
+			report.NoExpiry++
+		}
+	}
+
+	return report, nil
+}
+
+// counterName reports whether key ends in the :<window start> of counterKey.
+func counterName(key string) bool {
+	i := strings.LastIndexByte(key, ':')
+	if i < 0 {
+		return false
+	}
+	_, err := strconv.ParseInt(key[i+1:], 10, 64)
+	return err == nil
+}
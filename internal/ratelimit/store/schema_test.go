@@ -0,0 +1,30 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStore_CheckKeys(t *testing.T) {
+	mr, rdb := newRedis(t)
+	ctx := context.Background()
+	s := NewStore(rdb, Options{Prefix: "rl:"})
+
+	if _, err := s.Incr(ctx, "key", time.Minute); err != nil {
+		t.Fatalf("incr: %v", err)
+	}
+	_ = mr.Set("rl:leaked:1767261600", "3")
+	_ = mr.Set("rl:config", "{}")
+	mr.HSet("rl:session:1", "user", "x")
+
+	report, err := s.CheckKeys(ctx, 100)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	slices.Sort(report.Foreign)
+	if report.Sampled != 4 || report.NoExpiry != 1 || !slices.Equal(report.Foreign, []string{"rl:config", "rl:session:1"}) {
+		t.Fatalf("report=%+v want 4 sampled, one without expiry, two foreign", report)
+	}
+}
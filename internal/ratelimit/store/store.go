@@ -7,11 +7,16 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	mp "tyk-proxy/internal/metrics"
 )
 
 type Store struct {
-	rdcl   redis.UniversalClient
-	prefix string
+	rdcl         redis.UniversalClient
+	prefix       string
+	bucketPrefix string
+	sliding      bool
+	metrics      *mp.Metrics
 
 	// for tests
 	now func() time.Time
@@ -19,7 +24,14 @@ type Store struct {
 
 type Options struct {
 	Prefix string
-	Now    func() time.Time
+	// BucketPrefix keeps token buckets apart from the window counters under Prefix.
+	BucketPrefix string
+	// SlidingWindow makes Incr return a sliding-window estimate: the current window's count plus the previous
+	// window's count weighted by how much of it the sliding window still covers. This avoids the burst of up to
+	// twice the limit across a window boundary that fixed windows allow.
+	SlidingWindow bool
+	Metrics       *mp.Metrics
+	Now           func() time.Time
 }
 
 func NewStore(rdcl redis.UniversalClient, opts Options) *Store {
@@ -31,24 +43,36 @@ func NewStore(rdcl redis.UniversalClient, opts Options) *Store {
 	if pfx == "" {
 		pfx = "rate_count:"
 	}
+	bpfx := opts.BucketPrefix
+	if bpfx == "" {
+		bpfx = "rate_bucket:"
+	}
 	return &Store{
-		rdcl:   rdcl,
-		prefix: pfx,
-		now:    now,
+		rdcl:         rdcl,
+		prefix:       pfx,
+		bucketPrefix: bpfx,
+		sliding:      opts.SlidingWindow,
+		metrics:      opts.Metrics,
+		now:          now,
 	}
 }
 
-func (s *Store) counterKey(key string, window time.Duration) string {
-	ws := windowStart(s.now(), window).Unix()
-	return fmt.Sprintf("%s%s:%d", s.prefix, key, ws)
+func (s *Store) counterKey(key string, ws time.Time) string {
+	return fmt.Sprintf("%s%s:%d", s.prefix, key, ws.Unix())
 }
 
+// incrScript returns the count and whether the counter had lost its expiry (a PEXPIRE that never ran, e.g.
+// on a replica promoted mid-script), which it restores so the counter cannot outlive its window.
 var incrScript = redis.NewScript(`
 	local c = redis.call("INCR", KEYS[1])
+	local repaired = 0
 	if c == 1 then
 	  redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	elseif redis.call("PTTL", KEYS[1]) == -1 then
+	  redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	  repaired = 1
 	end
-	return c
+	return {c, repaired}
 `)
 
 func (s *Store) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
@@ -56,16 +80,62 @@ func (s *Store) Incr(ctx context.Context, key string, window time.Duration) (int
 		return 0, errors.New("store: window must be > 0")
 	}
 
-	k := s.counterKey(key, window)
+	now := s.now()
+	ws := windowStart(now, window)
+	k := s.counterKey(key, ws)
 
 	ttlMs := window.Milliseconds() + 1000
+	if !s.sliding {
+		res, err := incrScript.Run(ctx, s.rdcl, []string{k}, ttlMs).Int64Slice()
+		if err != nil {
+			return 0, err
+		}
+		return s.count(res)
+	}
 
-	v, err := incrScript.Run(ctx, s.rdcl, []string{k}, ttlMs).Int64()
+	// the previous window is read as well, so counters live for two windows; the counters may sit in
+	// different cluster slots, hence a pipeline rather than one script
+	pipe := s.rdcl.Pipeline()
+	cur := incrScript.Eval(ctx, pipe, []string{k}, ttlMs+window.Milliseconds())
+	prev := pipe.Get(ctx, s.counterKey(key, ws.Add(-window)))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	res, err := cur.Int64Slice()
 	if err != nil {
 		return 0, err
 	}
+	n, err := s.count(res)
+	if err != nil {
+		return 0, err
+	}
+	p, err := prev.Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	return slidingCount(n, p, now.Sub(ws), window), nil
+}
+
+func (s *Store) count(res []int64) (int64, error) {
+	if len(res) != 2 {
+		return 0, fmt.Errorf("store: unexpected script result %v", res)
+	}
+	if res[1] == 1 {
+		s.metrics.IncLimiterExpiryRepaired()
+	}
+
+	return res[0], nil
+}
+
+// slidingCount estimates the requests of the window ending now from the count of the current fixed window,
+// elapsed into it, and the count of the previous one, assuming the previous window's requests were spread evenly.
+func slidingCount(cur, prev int64, elapsed, window time.Duration) int64 {
+	if prev == 0 || elapsed >= window {
+		return cur
+	}
 
-	return v, nil
+	return cur + int64(float64(prev)*float64(window-elapsed)/float64(window))
 }
 
 func windowStart(t time.Time, window time.Duration) time.Time {
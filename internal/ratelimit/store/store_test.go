@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStore_Incr(t *testing.T) {
+	mr, rdb := newRedis(t)
+	now := time.Date(2026, 1, 1, 10, 0, 30, 0, time.UTC)
+	s := NewStore(rdb, Options{Prefix: "rl:", Now: func() time.Time { return now }})
+	k := "rl:key:1767261600"
+
+	for want := int64(1); want <= 2; want++ {
+		if got, err := s.Incr(context.Background(), "key", time.Minute); err != nil || got != want {
+			t.Fatalf("n=%d err=%v want %d", got, err, want)
+		}
+	}
+	if ttl := mr.TTL(k); ttl != 61*time.Second {
+		t.Fatalf("ttl=%s want 61s", ttl)
+	}
+
+	// a counter that lost its expiry gets it back
+	rdb.Persist(context.Background(), k)
+	if got, err := s.Incr(context.Background(), "key", time.Minute); err != nil || got != 3 {
+		t.Fatalf("n=%d err=%v want 3", got, err)
+	}
+	if ttl := mr.TTL(k); ttl != 61*time.Second {
+		t.Fatalf("ttl=%s want the expiry restored", ttl)
+	}
+}
+
+func TestStore_IncrSlidingWindow(t *testing.T) {
+	mr, rdb := newRedis(t)
+	now := time.Date(2026, 1, 1, 10, 0, 45, 0, time.UTC)
+	s := NewStore(rdb, Options{Prefix: "rl:", SlidingWindow: true, Now: func() time.Time { return now }})
+
+	// the first window has no predecessor
+	if got, err := s.Incr(context.Background(), "key", time.Minute); err != nil || got != 1 {
+		t.Fatalf("n=%d err=%v want 1", got, err)
+	}
+	if ttl := mr.TTL("rl:key:1767261600"); ttl != 121*time.Second {
+		t.Fatalf("ttl=%s want the counter kept for two windows", ttl)
+	}
+	mr.Set("rl:key:1767261600", "100")
+
+	// a quarter into the next window three quarters of the previous one still count
+	now = now.Add(30 * time.Second)
+	if got, err := s.Incr(context.Background(), "key", time.Minute); err != nil || got != 76 {
+		t.Fatalf("n=%d err=%v want 1+75", got, err)
+	}
+
+	// two windows later the 100 no longer count
+	now = now.Add(time.Minute)
+	if got, err := s.Incr(context.Background(), "key", time.Minute); err != nil || got != 1 {
+		t.Fatalf("n=%d err=%v want 1", got, err)
+	}
+}
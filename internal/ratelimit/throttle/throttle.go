@@ -0,0 +1,99 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrQueueFull = errors.New("throttle: queue full")
+
+// Throttle spaces requests evenly at a fixed rate (requests/sec) regardless of the client.
+// Requests that cannot start immediately wait in a bounded queue; beyond its depth they are shed, and requests
+// cancelled while waiting give their slot back. The cap is per process: with N instances the upstream sees up to N*rps.
+type Throttle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+	waiting  int
+	depth    int
+	maxWait  time.Duration
+
+	// for tests
+	now func() time.Time
+}
+
+type Options struct {
+	RPS        float64
+	QueueDepth int
+	MaxWait    time.Duration // 0 means wait for as long as the queue allows
+}
+
+func New(opts Options) *Throttle {
+	return &Throttle{
+		interval: time.Duration(float64(time.Second) / opts.RPS),
+		depth:    opts.QueueDepth,
+		maxWait:  opts.MaxWait,
+		now:      time.Now,
+	}
+}
+
+// Wait blocks until the caller may send its request upstream.
+func (t *Throttle) Wait(ctx context.Context) error {
+	t.mu.Lock()
+	now := t.now()
+	slot := t.next
+	if slot.Before(now) {
+		slot = now
+	}
+
+	delay := slot.Sub(now)
+	if delay > 0 {
+		if t.waiting >= t.depth || (t.maxWait > 0 && delay > t.maxWait) {
+			t.mu.Unlock()
+			return ErrQueueFull
+		}
+		t.waiting++
+	}
+	t.next = slot.Add(t.interval)
+	t.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	defer func() {
+		t.mu.Lock()
+		t.waiting--
+		t.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		t.release()
+		return ctx.Err()
+	}
+}
+
+// release gives back the slot of a request that stopped waiting, so the next request can take it instead of
+// queueing behind a slot nobody uses.
+func (t *Throttle) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.next = t.next.Add(-t.interval)
+}
+
+// Waiting returns the number of queued requests.
+func (t *Throttle) Waiting() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.waiting
+}
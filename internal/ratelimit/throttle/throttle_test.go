@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWait_ShedsBeyondQueueDepth(t *testing.T) {
+	th := New(Options{RPS: 1, QueueDepth: 1})
+
+	if err := th.Wait(context.Background()); err != nil {
+		t.Fatalf("first request should pass immediately, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queued := make(chan error, 1)
+	go func() { queued <- th.Wait(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for th.Waiting() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("second request was not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := th.Wait(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	cancel()
+	if err := <-queued; !errors.Is(err, context.Canceled) {
+		t.Fatalf("queued request should observe cancellation, got %v", err)
+	}
+}
+
+func TestWait_MaxWait(t *testing.T) {
+	th := New(Options{RPS: 1, QueueDepth: 10, MaxWait: 10 * time.Millisecond})
+
+	if err := th.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := th.Wait(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull when delay exceeds max wait, got %v", err)
+	}
+}
+
+func TestWait_SpacesRequests(t *testing.T) {
+	th := New(Options{RPS: 100, QueueDepth: 10})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := th.Wait(context.Background()); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	if el := time.Since(start); el < 15*time.Millisecond {
+		t.Fatalf("3 requests at 100 rps finished in %s, expected >= 20ms spacing", el)
+	}
+}
+
+func TestWait_CancelReleasesSlot(t *testing.T) {
+	th := New(Options{RPS: 1, QueueDepth: 10})
+
+	if err := th.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// each cancelled waiter leaves its slot to the next one rather than pushing it a second further
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := th.Wait(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the wait to time out, got %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := th.Wait(ctx); err != nil {
+		t.Fatalf("request after cancelled ones should get the next slot, got %v", err)
+	}
+	if el := time.Since(start); el > 1500*time.Millisecond {
+		t.Fatalf("waited %s, expected at most one interval", el)
+	}
+	if th.Waiting() != 0 {
+		t.Fatalf("waiting=%d want 0", th.Waiting())
+	}
+}
@@ -0,0 +1,113 @@
+// Package reqcheck rejects requests that miss route-required headers or carry invalid values, so basic
+// client validation happens at the edge.
+package reqcheck
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+	"tyk-proxy/internal/semver"
+)
+
+// Rejection reasons, also used as metric labels.
+const (
+	reasonMissing = "missing"
+	reasonPattern = "pattern"
+	reasonVersion = "version"
+)
+
+type requirement struct {
+	config.HeaderRequirement
+	pattern *regexp.Regexp
+	version semver.Range
+}
+
+// Checker holds the compiled header requirements by route path.
+type Checker struct {
+	routes  map[string][]requirement
+	metrics *mp.Metrics
+}
+
+// New compiles the required_headers of rs. It returns nil when no route has any.
+func New(rs []config.Route, metrics *mp.Metrics) (*Checker, error) {
+	c := &Checker{routes: map[string][]requirement{}, metrics: metrics}
+	for _, rt := range rs {
+		for i, h := range rt.RequiredHeaders {
+			req := requirement{HeaderRequirement: h}
+
+			var err error
+			if h.Pattern != "" {
+				req.pattern, err = regexp.Compile(h.Pattern)
+			}
+			if h.Version != "" {
+				req.version, err = semver.ParseRange(h.Version)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("route %s: required_headers[%d]: %w", rt.Path, i, err)
+			}
+
+			c.routes[rt.Path] = append(c.routes[rt.Path], req)
+		}
+	}
+
+	if len(c.routes) == 0 {
+		return nil, nil
+	}
+
+	return c, nil
+}
+
+// Middleware answers 400 naming the first failing requirement of the matched route.
+func (c *Checker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := routes.FromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, req := range c.routes[rt.Path] {
+			if len(req.Methods) > 0 && !slices.Contains(req.Methods, r.Method) {
+				continue
+			}
+
+			if reason, msg := req.check(r.Header); reason != "" {
+				c.metrics.IncRequiredHeaderRejected(rt.Path, reason)
+				gwerr.Write(w, c.metrics, gwerr.ErrHeader.WithMessage(msg))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// check returns the rejection reason and message, or empty strings when h satisfies the requirement.
+func (req requirement) check(h http.Header) (string, string) {
+	v := h.Get(req.Name)
+	if v == "" {
+		return reasonMissing, fmt.Sprintf("missing required header %s", req.Name)
+	}
+
+	if req.pattern != nil && !req.pattern.MatchString(v) {
+		return reasonPattern, fmt.Sprintf("header %s: %q does not match %s", req.Name, v, req.Pattern)
+	}
+
+	if req.version != nil {
+		ver, err := semver.Parse(v)
+		if err != nil {
+			return reasonVersion, fmt.Sprintf("header %s: %q is not a version", req.Name, v)
+		}
+		if !req.version.Contains(ver) {
+			return reasonVersion, fmt.Sprintf("header %s: version %s does not satisfy %s", req.Name, ver, req.Version)
+		}
+	}
+
+	return "", ""
+}
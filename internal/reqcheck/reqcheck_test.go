@@ -0,0 +1,67 @@
+package reqcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/routes"
+)
+
+func TestChecker_Middleware(t *testing.T) {
+	rs := []config.Route{
+		{Path: "/api/v1/orders*", RequiredHeaders: []config.HeaderRequirement{
+			{Name: "X-Client-Version", Version: ">=1.4.0 <2"},
+			{Name: "Content-Type", Methods: []string{http.MethodPost}, Pattern: `^application/json`},
+		}},
+		{Path: "*"},
+	}
+	c, err := New(rs, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := routes.NewTable(rs).Middleware(c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    int
+		wantMsg string
+	}{
+		{"other route", http.MethodGet, "/api/v1/users", nil, http.StatusOK, ""},
+		{"missing version", http.MethodGet, "/api/v1/orders", nil, http.StatusBadRequest, "missing required header X-Client-Version"},
+		{"old version", http.MethodGet, "/api/v1/orders", map[string]string{"X-Client-Version": "1.3.9"}, http.StatusBadRequest, "version 1.3.9 does not satisfy >=1.4.0 <2"},
+		{"not a version", http.MethodGet, "/api/v1/orders", map[string]string{"X-Client-Version": "latest"}, http.StatusBadRequest, "is not a version"},
+		{"GET needs no content type", http.MethodGet, "/api/v1/orders", map[string]string{"X-Client-Version": "1.4.2"}, http.StatusOK, ""},
+		{"POST without content type", http.MethodPost, "/api/v1/orders", map[string]string{"X-Client-Version": "1.4.2"}, http.StatusBadRequest, "missing required header Content-Type"},
+		{"POST with wrong content type", http.MethodPost, "/api/v1/orders", map[string]string{"X-Client-Version": "1.4.2", "Content-Type": "text/plain"}, http.StatusBadRequest, "does not match"},
+		{"POST valid", http.MethodPost, "/api/v1/orders", map[string]string{"X-Client-Version": "1.4.2", "Content-Type": "application/json"}, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Fatalf("%s: status=%d want=%d", tt.name, rr.Code, tt.want)
+		}
+		if !strings.Contains(rr.Body.String(), tt.wantMsg) {
+			t.Fatalf("%s: body=%q want %q", tt.name, rr.Body.String(), tt.wantMsg)
+		}
+	}
+}
+
+func TestNew_NoRequirements(t *testing.T) {
+	c, err := New([]config.Route{{Path: "*"}}, nil)
+	if err != nil || c != nil {
+		t.Fatalf("got %v, %v; want nil checker", c, err)
+	}
+}
@@ -0,0 +1,74 @@
+package respcache
+
+import (
+	"strings"
+	"time"
+)
+
+// Stats summarizes cache effectiveness since start. Not-modified answers count as hits.
+type Stats struct {
+	Entries     int     `json:"entries"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	NotModified int64   `json:"not_modified"`
+	HitRate     float64 `json:"hit_rate"`
+}
+
+// EntryInfo describes a cached response without its body.
+type EntryInfo struct {
+	Key       string    `json:"key"`
+	Route     string    `json:"route"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	ETag      string    `json:"etag"`
+	Vary      string    `json:"vary,omitempty"`
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (c *Cache) Stats() Stats {
+	st := Stats{
+		Entries:     c.lru.Len(),
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		NotModified: c.notModified.Load(),
+	}
+	if total := st.Hits + st.Misses + st.NotModified; total > 0 {
+		st.HitRate = float64(st.Hits+st.NotModified) / float64(total)
+	}
+
+	return st
+}
+
+// Entries lists up to limit cached responses whose key starts with prefix, most recently used first.
+func (c *Cache) Entries(prefix string, limit int) []EntryInfo {
+	out := []EntryInfo{}
+	c.lru.Range(func(key string, e *entry, expiresAt time.Time) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return true
+		}
+		out = append(out, EntryInfo{
+			Key:       key,
+			Route:     e.route,
+			Status:    e.status,
+			Bytes:     len(e.body),
+			ETag:      e.etag,
+			Vary:      e.header.Get("Vary"),
+			StoredAt:  e.storedAt,
+			ExpiresAt: expiresAt,
+		})
+		return len(out) < limit
+	})
+
+	return out
+}
+
+// Purge removes every cached response whose key starts with prefix and returns how many were removed.
+func (c *Cache) Purge(prefix string) int {
+	match := func(key string) bool { return strings.HasPrefix(key, prefix) }
+	n := c.lru.DeleteFunc(match)
+	c.vary.DeleteFunc(match)
+	c.metrics.SetResponseCacheEntries(c.lru.Len())
+
+	return n
+}
@@ -0,0 +1,74 @@
+package respcache
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"tyk-proxy/internal/config"
+)
+
+// baseKey identifies a cached resource: the path, the query (only the allowlisted parameters when the route
+// has key_query, always in sorted order) and the route's key_headers. Keys start with the path, so they can be
+// purged by path prefix.
+func baseKey(r *http.Request, rc *config.RouteCache) string {
+	var b strings.Builder
+	b.WriteString(r.URL.Path)
+
+	q := r.URL.Query()
+	if len(rc.KeyQuery) > 0 {
+		kept := url.Values{}
+		for _, name := range rc.KeyQuery {
+			if vs, ok := q[name]; ok {
+				kept[name] = vs
+			}
+		}
+		q = kept
+	}
+	if enc := q.Encode(); enc != "" { // Encode sorts by key
+		b.WriteString("?")
+		b.WriteString(enc)
+	}
+
+	writeHeaders(&b, r, rc.KeyHeaders)
+
+	return b.String()
+}
+
+// variantKey extends a base key with the request values of the headers the response varies on.
+func variantKey(base string, r *http.Request, vary []string) string {
+	if len(vary) == 0 {
+		return base
+	}
+
+	var b strings.Builder
+	b.WriteString(base)
+	writeHeaders(&b, r, vary)
+
+	return b.String()
+}
+
+func writeHeaders(b *strings.Builder, r *http.Request, names []string) {
+	for _, name := range names {
+		b.WriteString("|")
+		b.WriteString(strings.ToLower(name))
+		b.WriteString("=")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+}
+
+// parseVary returns the canonical, sorted header names of a Vary header.
+func parseVary(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
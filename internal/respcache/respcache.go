@@ -0,0 +1,281 @@
+package respcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"tyk-proxy/internal/cache"
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/flags"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+const (
+	resultHit         = "hit"
+	resultMiss        = "miss"
+	resultNotModified = "not_modified"
+)
+
+// CacheHeader tells clients whether a response came from the gateway cache.
+const CacheHeader = "X-Cache"
+
+// perRequestHeaders are set by the gateway for each request and never replayed from the cache.
+var perRequestHeaders = []string{"X-Request-Id", CacheHeader}
+
+// entry is a cached response.
+type entry struct {
+	route    string
+	status   int
+	header   http.Header
+	body     []byte
+	etag     string
+	storedAt time.Time
+}
+
+// Cache serves GET and HEAD requests of routes with cache configured from memory, and answers
+// If-None-Match with 304 for them. It is per proxy instance.
+type Cache struct {
+	lru *cache.LRU[string, *entry]
+	// Vary header names by base key, for resources whose responses vary
+	vary         *cache.LRU[string, []string]
+	maxBodyBytes int64
+	flags        *flags.Set
+	metrics      *mp.Metrics
+
+	hits, misses, notModified atomic.Int64
+}
+
+func New(cfg config.ResponseCache, fs *flags.Set, metrics *mp.Metrics) *Cache {
+	return &Cache{
+		lru:          cache.New[string, *entry](cfg.Size, 0),
+		vary:         cache.New[string, []string](cfg.Size, 0),
+		maxBodyBytes: cfg.MaxBodyBytes,
+		flags:        fs,
+		metrics:      metrics,
+	}
+}
+
+// Middleware must run after auth: cached responses are shared by every caller allowed on the route.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, ok := routes.FromContext(r.Context())
+		// range requests go to the upstream untouched, which answers 206 or the full body as it sees fit
+		if !ok || rt.Cache == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+			r.Header.Get("Range") != "" || !c.flags.Enabled(config.FlagCache, rt.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		base := baseKey(r, rt.Cache)
+		vary, _ := c.vary.Get(base)
+		if e, ok := c.lru.Get(variantKey(base, r, vary)); ok && !noCache(r.Header) {
+			c.serve(w, r, rt.Path, e, resultHit)
+			return
+		}
+
+		var ttl time.Duration
+		bw := &bufferingWriter{ResponseWriter: w, max: c.maxBodyBytes, cacheable: func(status int, h http.Header) bool {
+			var ok bool
+			ttl, ok = cacheTTL(rt.Cache.TTL, h)
+			return status == http.StatusOK && ok && !isStream(h)
+		}}
+		next.ServeHTTP(bw, r)
+		if !bw.decided {
+			bw.WriteHeader(http.StatusOK)
+		}
+		if bw.passthrough {
+			c.count(rt.Path, resultMiss)
+			return
+		}
+
+		e := &entry{route: rt.Path, status: bw.status, header: w.Header().Clone(), body: bw.buf.Bytes(), storedAt: time.Now()}
+		for _, k := range perRequestHeaders {
+			e.header.Del(k)
+		}
+		if r.Method == http.MethodGet {
+			e.etag = etagFor(rt.Cache, e)
+			vary := parseVary(e.header)
+			if len(vary) > 0 {
+				c.vary.SetWithTTL(base, vary, ttl)
+			} else {
+				c.vary.Delete(base)
+			}
+			c.lru.SetWithTTL(variantKey(base, r, vary), e, ttl)
+			c.metrics.SetResponseCacheEntries(c.lru.Len())
+		} else {
+			// a HEAD response has no body to derive an ETag from; only the upstream one is meaningful
+			e.etag = e.header.Get("ETag")
+		}
+		c.serve(w, r, rt.Path, e, resultMiss)
+	})
+}
+
+// serve writes e, or 304 when the request's If-None-Match names its ETag.
+func (c *Cache) serve(w http.ResponseWriter, r *http.Request, route string, e *entry, result string) {
+	h := w.Header()
+	for k, vs := range e.header {
+		h[k] = vs
+	}
+	h.Set(CacheHeader, strings.ToUpper(result))
+	if e.etag != "" {
+		h.Set("ETag", e.etag)
+	}
+
+	if e.etag != "" && etagMatch(r.Header.Get("If-None-Match"), e.etag) {
+		c.count(route, resultNotModified)
+		for _, k := range []string{"Content-Length", "Content-Type", "Content-Encoding"} {
+			h.Del(k)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	c.count(route, result)
+	w.WriteHeader(e.status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(e.body)
+	}
+}
+
+func (c *Cache) count(route, result string) {
+	switch result {
+	case resultHit:
+		c.hits.Add(1)
+	case resultMiss:
+		c.misses.Add(1)
+	case resultNotModified:
+		c.notModified.Add(1)
+	}
+	c.metrics.IncResponseCache(route, result)
+}
+
+func etagFor(rc *config.RouteCache, e *entry) string {
+	if tag := e.header.Get("ETag"); rc.ETag == config.ETagPassthrough && tag != "" {
+		return tag
+	}
+
+	sum := sha256.Sum256(e.body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatch implements the weak comparison If-None-Match uses.
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheTTL caps the route ttl by the upstream's max-age and refuses responses that must not be shared.
+func cacheTTL(ttl time.Duration, h http.Header) (time.Duration, bool) {
+	if h.Get("Set-Cookie") != "" || h.Get("Vary") == "*" {
+		return 0, false
+	}
+
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, val, _ := strings.Cut(strings.ToLower(strings.TrimSpace(d)), "=")
+		switch name {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age", "s-maxage":
+			if secs, err := time.ParseDuration(val + "s"); err == nil && secs < ttl {
+				ttl = secs
+			}
+		}
+	}
+
+	return ttl, ttl > 0
+}
+
+func noCache(h http.Header) bool {
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	return strings.Contains(cc, "no-cache") || strings.Contains(cc, "no-store")
+}
+
+func isStream(h http.Header) bool {
+	ct := h.Get("Content-Type")
+	return strings.HasPrefix(ct, "text/event-stream") || strings.HasPrefix(ct, "application/x-ndjson")
+}
+
+// bufferingWriter holds cacheable responses until they are complete so their ETag can be set, and passes
+// everything else (or a body over max) straight through.
+type bufferingWriter struct {
+	http.ResponseWriter
+	max       int64
+	cacheable func(status int, h http.Header) bool
+
+	status      int
+	decided     bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+func (b *bufferingWriter) WriteHeader(status int) {
+	if b.decided {
+		return
+	}
+	// informational responses (e.g. 100 Continue) go straight out
+	if status < 200 {
+		b.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	b.decided = true
+	b.status = status
+	if !b.cacheable(status, b.Header()) {
+		b.passthrough = true
+		b.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (b *bufferingWriter) Write(p []byte) (int, error) {
+	if !b.decided {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.passthrough {
+		return b.ResponseWriter.Write(p)
+	}
+
+	if int64(b.buf.Len()+len(p)) > b.max {
+		b.passthrough = true
+		b.ResponseWriter.WriteHeader(b.status)
+		if _, err := b.ResponseWriter.Write(b.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		b.buf.Reset()
+		return b.ResponseWriter.Write(p)
+	}
+
+	return b.buf.Write(p)
+}
+
+// Flush only reaches the client once the response passes through; buffered ones are written when complete.
+func (b *bufferingWriter) Flush() {
+	if !b.passthrough {
+		return
+	}
+	if f, ok := b.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (b *bufferingWriter) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
@@ -0,0 +1,175 @@
+package respcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/flags"
+	"tyk-proxy/internal/routes"
+)
+
+func newTestHandler(t *testing.T, rs []config.Route, upstream http.HandlerFunc) (http.Handler, *flags.Set) {
+	t.Helper()
+
+	fs := flags.New(map[string]bool{config.FlagCache: true}, nil)
+	c := New(config.ResponseCache{Size: 10, MaxBodyBytes: 64}, fs, nil)
+
+	return routes.NewTable(rs).Middleware(c.Middleware(upstream)), fs
+}
+
+func get(h http.Handler, path string, hdr ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(hdr); i += 2 {
+		req.Header.Set(hdr[i], hdr[i+1])
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCache_HitsAndConditionalRequests(t *testing.T) {
+	calls := 0
+	h, fs := newTestHandler(t, []config.Route{{Path: "/api/v1/items*", Cache: &config.RouteCache{TTL: time.Minute, ETag: config.ETagGenerate}}},
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("X-Request-Id", r.Header.Get("X-Request-Id"))
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":1}`))
+		})
+
+	first := get(h, "/api/v1/items/1", "X-Request-Id", "r1")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || first.Body.String() != `{"id":1}` || first.Header().Get(CacheHeader) != "MISS" {
+		t.Fatalf("miss: status=%d body=%q x-cache=%q", first.Code, first.Body, first.Header().Get(CacheHeader))
+	}
+	if !strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("want a strong etag, got %q", etag)
+	}
+
+	second := get(h, "/api/v1/items/1")
+	if second.Header().Get("X-Request-Id") != "" {
+		t.Fatalf("request id of the cached request replayed")
+	}
+	if second.Code != http.StatusOK || second.Body.String() != `{"id":1}` || second.Header().Get(CacheHeader) != "HIT" {
+		t.Fatalf("hit: status=%d body=%q x-cache=%q", second.Code, second.Body, second.Header().Get(CacheHeader))
+	}
+
+	notModified := get(h, "/api/v1/items/1", "If-None-Match", `"other", `+etag)
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 || notModified.Header().Get("ETag") != etag {
+		t.Fatalf("conditional: status=%d body=%q", notModified.Code, notModified.Body)
+	}
+	if calls != 1 {
+		t.Fatalf("upstream calls=%d want=1", calls)
+	}
+
+	fs.Set(config.FlagCache, "/api/v1/items*", false)
+	if rr := get(h, "/api/v1/items/1"); rr.Header().Get(CacheHeader) != "" || calls != 2 {
+		t.Fatalf("cache flag off must bypass the cache: x-cache=%q calls=%d", rr.Header().Get(CacheHeader), calls)
+	}
+}
+
+func TestCache_Uncacheable(t *testing.T) {
+	calls := 0
+	h, _ := newTestHandler(t, []config.Route{{Path: "*", Cache: &config.RouteCache{TTL: time.Minute, ETag: config.ETagPassthrough}}},
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			switch r.URL.Path {
+			case "/private":
+				w.Header().Set("Cache-Control", "private")
+			case "/big":
+				_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+				return
+			case "/error":
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			case "/tagged":
+				w.Header().Set("ETag", `"v1"`)
+			}
+			_, _ = w.Write([]byte("ok"))
+		})
+
+	for _, p := range []string{"/private", "/big", "/error"} {
+		get(h, p)
+		if rr := get(h, p); rr.Header().Get(CacheHeader) == "HIT" {
+			t.Fatalf("%s must not be cached", p)
+		}
+	}
+	if calls != 6 {
+		t.Fatalf("upstream calls=%d want=6", calls)
+	}
+	if rr := get(h, "/big"); rr.Body.Len() != 100 {
+		t.Fatalf("oversized body truncated to %d bytes", rr.Body.Len())
+	}
+
+	get(h, "/tagged")
+	if rr := get(h, "/tagged", "If-None-Match", `W/"v1"`); rr.Code != http.StatusNotModified {
+		t.Fatalf("passthrough etag: status=%d want=304", rr.Code)
+	}
+}
+
+func TestCache_KeysAndVary(t *testing.T) {
+	calls := 0
+	h, _ := newTestHandler(t, []config.Route{{Path: "*", Cache: &config.RouteCache{
+		TTL:        time.Minute,
+		KeyQuery:   []string{"page", "sort"},
+		KeyHeaders: []string{"X-Tenant"},
+	}}}, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/varied" {
+			w.Header().Set("Vary", "accept-language")
+		}
+		_, _ = w.Write([]byte(r.Header.Get("X-Tenant") + r.Header.Get("Accept-Language")))
+	})
+
+	tests := []struct {
+		name  string
+		path  string
+		hdr   []string
+		calls int
+	}{
+		{"first", "/items?sort=a&page=1", []string{"X-Tenant", "t1"}, 1},
+		{"query order and ignored params", "/items?page=1&utm=x&sort=a", []string{"X-Tenant", "t1"}, 1},
+		{"other allowlisted value", "/items?page=2&sort=a", []string{"X-Tenant", "t1"}, 2},
+		{"key header", "/items?sort=a&page=1", []string{"X-Tenant", "t2"}, 3},
+		{"vary first", "/varied", []string{"Accept-Language", "en"}, 4},
+		{"vary same", "/varied", []string{"Accept-Language", "en"}, 4},
+		{"vary other", "/varied", []string{"Accept-Language", "de"}, 5},
+		{"vary other cached", "/varied", []string{"Accept-Language", "de"}, 5},
+	}
+
+	for _, tt := range tests {
+		rr := get(h, tt.path, tt.hdr...)
+		if calls != tt.calls {
+			t.Fatalf("%s: upstream calls=%d want=%d (x-cache %s)", tt.name, calls, tt.calls, rr.Header().Get(CacheHeader))
+		}
+		if want := tt.hdr[1]; !strings.HasSuffix(rr.Body.String(), want) {
+			t.Fatalf("%s: body=%q served for the wrong variant", tt.name, rr.Body)
+		}
+	}
+}
+
+func TestCache_AdminStatsAndPurge(t *testing.T) {
+	fs := flags.New(map[string]bool{config.FlagCache: true}, nil)
+	c := New(config.ResponseCache{Size: 10, MaxBodyBytes: 64}, fs, nil)
+	h := routes.NewTable([]config.Route{{Path: "*", Cache: &config.RouteCache{TTL: time.Minute}}}).Middleware(
+		c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })))
+
+	for _, p := range []string{"/a/1", "/a/2", "/b/1", "/a/1"} {
+		get(h, p)
+	}
+
+	st := c.Stats()
+	if st.Entries != 3 || st.Hits != 1 || st.Misses != 3 || st.HitRate != 0.25 {
+		t.Fatalf("stats=%+v", st)
+	}
+	if items := c.Entries("/a/", 10); len(items) != 2 || items[0].Key != "/a/1" || items[0].Bytes != 2 {
+		t.Fatalf("entries=%+v", items)
+	}
+	if n := c.Purge("/a/"); n != 2 || c.Stats().Entries != 1 {
+		t.Fatalf("purged=%d entries=%d", n, c.Stats().Entries)
+	}
+}
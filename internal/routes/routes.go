@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"tyk-proxy/internal/config"
+)
+
+// Table resolves a request path to its configured route. Routes are matched in declaration order.
+type Table struct {
+	routes []config.Route
+}
+
+func NewTable(rs []config.Route) *Table {
+	return &Table{routes: rs}
+}
+
+func (t *Table) Match(path string) (*config.Route, bool) {
+	if t == nil {
+		return nil, false
+	}
+
+	for i := range t.routes {
+		if MatchPattern(t.routes[i].Path, path) {
+			return &t.routes[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Routes returns the configured routes in match order.
+func (t *Table) Routes() []config.Route {
+	if t == nil {
+		return nil
+	}
+
+	return t.routes
+}
+
+// Middleware stores the matched route (if any) in the request context.
+func (t *Table) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rt, ok := t.Match(r.URL.Path); ok {
+			r = r.WithContext(WithRoute(r.Context(), rt))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MatchPattern reports whether path matches pattern: "*" matches everything,
+// "/prefix*" matches by prefix, anything else must match exactly.
+func MatchPattern(pattern, path string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || path == "" {
+		return false
+	}
+
+	if pattern == "*" {
+		return true
+	}
+
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(path, strings.TrimSuffix(pattern, "*"))
+	}
+
+	return path == pattern
+}
+
+type ctxKeyRoute struct{}
+
+func WithRoute(ctx context.Context, rt *config.Route) context.Context {
+	return context.WithValue(ctx, ctxKeyRoute{}, rt)
+}
+
+func FromContext(ctx context.Context) (*config.Route, bool) {
+	rt, ok := ctx.Value(ctxKeyRoute{}).(*config.Route)
+	return rt, ok && rt != nil
+}
@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"testing"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*", "/anything", true},
+		{"/api/v1/users/*", "/api/v1/users/1", true},
+		{"/api/v1/users/*", "/api/v1/users", false},
+		{"/api/v1/users*", "/api/v1/users", true},
+		{"/api/v1/test", "/api/v1/test", true},
+		{"/api/v1/test", "/api/v1/test2", false},
+		{"", "/api/v1/test", false},
+		{"*", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.path); got != tt.want {
+			t.Fatalf("MatchPattern(%q,%q) => %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTable_FirstMatchWins(t *testing.T) {
+	tbl := NewTable([]config.Route{
+		{Path: "/api/v1/users/admin"},
+		{Path: "/api/v1/users/*"},
+		{Path: "*"},
+	})
+
+	rt, ok := tbl.Match("/api/v1/users/admin")
+	if !ok || rt.Path != "/api/v1/users/admin" {
+		t.Fatalf("expected exact route, got %+v", rt)
+	}
+
+	rt, ok = tbl.Match("/api/v1/users/42")
+	if !ok || rt.Path != "/api/v1/users/*" {
+		t.Fatalf("expected prefix route, got %+v", rt)
+	}
+
+	rt, ok = tbl.Match("/api/v1/orders")
+	if !ok || rt.Path != "*" {
+		t.Fatalf("expected catch-all route, got %+v", rt)
+	}
+
+	var empty *Table
+	if _, ok := empty.Match("/x"); ok {
+		t.Fatalf("nil table should not match")
+	}
+}
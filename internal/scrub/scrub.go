@@ -0,0 +1,240 @@
+// Package scrub masks secrets, e.g. API keys or card numbers, in upstream response bodies.
+package scrub
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// reasons a response passes unscanned
+const (
+	skipTooLarge = "too_large"
+	skipEncoded  = "encoded"
+	skipPartial  = "partial"
+)
+
+// cardNumber finds 13 to 19 digits, optionally grouped by spaces or dashes; matches are Luhn-checked.
+var cardNumber = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+type rule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement []byte
+	valid       func(match []byte) bool // nil accepts every match
+}
+
+type Scrubber struct {
+	rules        []rule
+	routes       []string // empty scrubs every route
+	maxBodyBytes int64
+	contentTypes []string
+	metrics      *mp.Metrics
+}
+
+// New returns nil when cfg has no patterns; a nil Scrubber passes every response as is.
+func New(cfg config.ResponseScrub, metrics *mp.Metrics) (*Scrubber, error) {
+	if len(cfg.Patterns) == 0 {
+		return nil, nil
+	}
+
+	s := &Scrubber{routes: cfg.Routes, maxBodyBytes: cfg.MaxBodyBytes, contentTypes: cfg.ContentTypes, metrics: metrics}
+	for _, p := range cfg.Patterns {
+		r := rule{name: p.Name, replacement: []byte(p.Replacement)}
+		if p.Regex == "" && p.Name == config.ScrubCreditCard {
+			r.re, r.valid = cardNumber, luhn
+		} else {
+			re, err := regexp.Compile(p.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("response_scrub: pattern %s: %w", p.Name, err)
+			}
+			r.re = re
+		}
+		s.rules = append(s.rules, r)
+	}
+
+	return s, nil
+}
+
+// PrepareRequest asks the upstream for an uncompressed response, which is the only kind Scrub can scan. Requests
+// Scrub leaves alone keep their Accept-Encoding.
+func (s *Scrubber) PrepareRequest(r *http.Request) {
+	if !s.applies(r) {
+		return
+	}
+
+	r.Header.Del("Accept-Encoding")
+}
+
+// Scrub replaces the matches in the body of resp. Responses it cannot scan are passed on and counted.
+func (s *Scrubber) Scrub(resp *http.Response) error {
+	if !s.applies(resp.Request) || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !s.scans(ct) {
+		return nil
+	}
+
+	label := "unmatched"
+	if rt, ok := routes.FromContext(resp.Request.Context()); ok {
+		label = rt.Path
+	}
+
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" && !strings.EqualFold(ce, "identity") {
+		s.metrics.IncScrubSkipped(label, skipEncoded)
+		return nil
+	}
+	// masking would shift the offsets of Content-Range
+	if resp.StatusCode == http.StatusPartialContent {
+		s.metrics.IncScrubSkipped(label, skipPartial)
+		return nil
+	}
+	if resp.ContentLength > s.maxBodyBytes {
+		s.metrics.IncScrubSkipped(label, skipTooLarge)
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, s.maxBodyBytes+1))
+	if err != nil {
+		// an unscanned remainder must not reach the client
+		return fmt.Errorf("response_scrub: read body: %w", err)
+	}
+	if int64(len(body)) > s.maxBodyBytes {
+		resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		s.metrics.IncScrubSkipped(label, skipTooLarge)
+		return nil
+	}
+
+	masked := false
+	for _, r := range s.rules {
+		var n int
+		if body, n = r.apply(body); n > 0 {
+			s.metrics.AddScrubHits(label, r.name, n)
+			masked = true
+		}
+	}
+
+	resp.Body = readCloser{Reader: bytes.NewReader(body), Closer: resp.Body}
+	if masked {
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		// validators of the upstream body do not describe the masked one
+		resp.Header.Del("ETag")
+		resp.Header.Del("Content-MD5")
+	}
+
+	return nil
+}
+
+// applies reports whether responses to r are scrubbed: r is not a HEAD request and its route is listed.
+func (s *Scrubber) applies(r *http.Request) bool {
+	if s == nil || r.Method == http.MethodHead {
+		return false
+	}
+	if len(s.routes) == 0 {
+		return true
+	}
+
+	rt, ok := routes.FromContext(r.Context())
+	return ok && slices.Contains(s.routes, rt.Path)
+}
+
+func (s *Scrubber) scans(ct string) bool {
+	// streams are never buffered
+	if ct == "" || ct == "text/event-stream" {
+		return false
+	}
+
+	for _, pattern := range s.contentTypes {
+		if matchType(ct, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchType matches a media type against type/subtype, type/* or type/*+suffix.
+func matchType(ct, pattern string) bool {
+	typ, sub, _ := strings.Cut(pattern, "/")
+	ctTyp, ctSub, _ := strings.Cut(ct, "/")
+	if typ != ctTyp {
+		return false
+	}
+
+	switch {
+	case sub == "*":
+		return true
+	case strings.HasPrefix(sub, "*+"):
+		return strings.HasSuffix(ctSub, sub[1:])
+	default:
+		return sub == ctSub
+	}
+}
+
+// apply returns b with the valid matches replaced, and how many there were.
+func (r rule) apply(b []byte) ([]byte, int) {
+	matches := r.re.FindAllSubmatchIndex(b, -1)
+	if len(matches) == 0 {
+		return b, 0
+	}
+
+	var (
+		out  []byte
+		last int
+		n    int
+	)
+	for _, m := range matches {
+		if r.valid != nil && !r.valid(b[m[0]:m[1]]) {
+			continue
+		}
+		out = append(out, b[last:m[0]]...)
+		out = r.re.Expand(out, r.replacement, b, m)
+		last = m[1]
+		n++
+	}
+	if n == 0 {
+		return b, 0
+	}
+
+	return append(out, b[last:]...), n
+}
+
+// luhn reports whether the digits of s pass the Luhn check of card numbers.
+func luhn(s []byte) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,164 @@
+package scrub
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/routes"
+)
+
+func newTestScrubber(t *testing.T) *Scrubber {
+	t.Helper()
+
+	s, err := New(config.ResponseScrub{
+		Patterns: []config.ScrubPattern{
+			{Name: "api_key", Regex: `(sk_live_)[A-Za-z0-9]{8,}`, Replacement: "${1}****"},
+			{Name: config.ScrubCreditCard, Replacement: "[REDACTED]"},
+		},
+		MaxBodyBytes: 256,
+		ContentTypes: []string{"application/json", "application/*+json", "text/*"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	return s
+}
+
+func TestScrub(t *testing.T) {
+	s := newTestScrubber(t)
+
+	tests := []struct {
+		name     string
+		ct       string
+		encoding string
+		status   int
+		body     string
+		want     string
+	}{
+		{
+			name: "api key",
+			ct:   "application/json",
+			body: `{"key":"sk_live_abcdef123456"}`,
+			want: `{"key":"sk_live_****"}`,
+		},
+		{
+			name: "card numbers pass the Luhn check",
+			ct:   "application/problem+json; charset=utf-8",
+			body: `{"card":"4111 1111 1111 1111","order":"4111111111111112"}`,
+			want: `{"card":"[REDACTED]","order":"4111111111111112"}`,
+		},
+		{name: "no match", ct: "text/plain", body: "nothing here", want: "nothing here"},
+		{name: "unscanned type", ct: "application/octet-stream", body: "sk_live_abcdef123456", want: "sk_live_abcdef123456"},
+		{name: "event stream", ct: "text/event-stream", body: "data: sk_live_abcdef123456\n\n", want: "data: sk_live_abcdef123456\n\n"},
+		{name: "compressed", ct: "application/json", encoding: "gzip", body: "sk_live_abcdef123456", want: "sk_live_abcdef123456"},
+		{name: "partial", ct: "text/plain", status: http.StatusPartialContent, body: "sk_live_abcdef123456", want: "sk_live_abcdef123456"},
+		{name: "too large", ct: "text/plain", body: "sk_live_abcdef123456" + strings.Repeat(" ", 300), want: "sk_live_abcdef123456" + strings.Repeat(" ", 300)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			resp := &http.Response{
+				StatusCode:    status,
+				Header:        http.Header{"Content-Type": {tt.ct}, "Etag": {`"v1"`}},
+				Body:          io.NopCloser(strings.NewReader(tt.body)),
+				ContentLength: -1,
+				Request:       httptest.NewRequest(http.MethodGet, "/api/v1/accounts", nil),
+			}
+			if tt.encoding != "" {
+				resp.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			if err := s.Scrub(resp); err != nil {
+				t.Fatalf("scrub: %v", err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			if string(b) != tt.want {
+				t.Fatalf("body=%q want=%q", b, tt.want)
+			}
+
+			masked := tt.want != tt.body
+			if masked && (resp.ContentLength != int64(len(tt.want)) || resp.Header.Get("ETag") != "") {
+				t.Fatalf("content-length=%d etag=%q after masking", resp.ContentLength, resp.Header.Get("ETag"))
+			}
+			if !masked && resp.Header.Get("ETag") == "" {
+				t.Fatalf("etag dropped from an unchanged response")
+			}
+		})
+	}
+}
+
+func TestScrub_Routes(t *testing.T) {
+	s, err := New(config.ResponseScrub{
+		Patterns:     []config.ScrubPattern{{Name: "api_key", Regex: `sk_live_[A-Za-z0-9]{8,}`, Replacement: "[REDACTED]"}},
+		Routes:       []string{"/api/v1/accounts*"},
+		MaxBodyBytes: 256,
+		ContentTypes: []string{"application/json"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		route  string // empty leaves the request unmatched
+		want   bool   // scrubbed, and Accept-Encoding dropped
+	}{
+		{name: "listed route", method: http.MethodGet, route: "/api/v1/accounts*", want: true},
+		{name: "other route", method: http.MethodGet, route: "/api/v1/orders*"},
+		{name: "unmatched", method: http.MethodGet},
+		{name: "head", method: http.MethodHead, route: "/api/v1/accounts*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/x", nil)
+			if tt.route != "" {
+				req = req.WithContext(routes.WithRoute(req.Context(), &config.Route{Path: tt.route}))
+			}
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			s.PrepareRequest(req)
+			if dropped := req.Header.Get("Accept-Encoding") == ""; dropped != tt.want {
+				t.Fatalf("accept-encoding dropped=%v want %v", dropped, tt.want)
+			}
+
+			body := `{"key":"sk_live_abcdef123456"}`
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {"application/json"}},
+				Body:          io.NopCloser(strings.NewReader(body)),
+				ContentLength: -1,
+				Request:       req,
+			}
+			if err := s.Scrub(resp); err != nil {
+				t.Fatalf("scrub: %v", err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			if scrubbed := string(b) != body; scrubbed != tt.want {
+				t.Fatalf("body=%q scrubbed=%v want %v", b, scrubbed, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_NoPatterns(t *testing.T) {
+	s, err := New(config.ResponseScrub{}, nil)
+	if err != nil || s != nil {
+		t.Fatalf("scrubber=%v err=%v want nil", s, err)
+	}
+
+	// a nil scrubber passes responses untouched
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("x"))}
+	if err := s.Scrub(resp); err != nil {
+		t.Fatalf("scrub: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package semver compares major.minor.patch versions against ranges such as ">=1.4.0 <2", "^1.4" or "~1.4.2".
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is major.minor.patch. Missing parts are 0; a leading v and pre-release or build suffixes are ignored.
+type Version [3]int
+
+func Parse(s string) (Version, error) {
+	var v Version
+
+	core := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	parts := strings.Split(core, ".")
+	if core == "" || len(parts) > 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 as v is lower than, equal to or higher than o.
+func (v Version) Compare(o Version) int {
+	for i := range v {
+		switch {
+		case v[i] < o[i]:
+			return -1
+		case v[i] > o[i]:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+type comparator struct {
+	op string
+	v  Version
+}
+
+func (c comparator) holds(v Version) bool {
+	n := v.Compare(c.v)
+	switch c.op {
+	case ">=":
+		return n >= 0
+	case ">":
+		return n > 0
+	case "<=":
+		return n <= 0
+	case "<":
+		return n < 0
+	case "!=":
+		return n != 0
+	default:
+		return n == 0
+	}
+}
+
+// Range is a set of comparators that must all hold.
+type Range []comparator
+
+// ParseRange parses comparators separated by spaces or commas: >=, >, <=, <, =, != followed by a version,
+// ^1.4.2 (>=1.4.2 <2.0.0, or <0.5.0 for major 0) and ~1.4.2 (>=1.4.2 <1.5.0). A bare version means =.
+func ParseRange(s string) (Range, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty version range %q", s)
+	}
+
+	var r Range
+	for _, f := range fields {
+		op := ""
+		for _, o := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+			if strings.HasPrefix(f, o) {
+				op = o
+				break
+			}
+		}
+
+		v, err := Parse(f[len(op):])
+		if err != nil {
+			return nil, fmt.Errorf("version range %q: %w", s, err)
+		}
+
+		switch op {
+		case "^":
+			upper := Version{v[0] + 1, 0, 0}
+			if v[0] == 0 {
+				upper = Version{0, v[1] + 1, 0}
+			}
+			r = append(r, comparator{">=", v}, comparator{"<", upper})
+		case "~":
+			r = append(r, comparator{">=", v}, comparator{"<", Version{v[0], v[1] + 1, 0}})
+		default:
+			r = append(r, comparator{op, v})
+		}
+	}
+
+	return r, nil
+}
+
+func (r Range) Contains(v Version) bool {
+	for _, c := range r {
+		if !c.holds(v) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,51 @@
+package semver
+
+import "testing"
+
+func TestRange_Contains(t *testing.T) {
+	tests := []struct {
+		rng     string
+		version string
+		want    bool
+	}{
+		{">=1.4.0 <2", "1.4.0", true},
+		{">=1.4.0 <2", "v1.9.3-beta.1", true},
+		{">=1.4.0 <2", "2.0.0", false},
+		{">=1.4.0, <2", "1.3", false},
+		{"^1.4", "1.99.0", true},
+		{"^1.4", "2.0.0", false},
+		{"^0.4.2", "0.4.9", true},
+		{"^0.4.2", "0.5.0", false},
+		{"~1.4.2", "1.4.10", true},
+		{"~1.4.2", "1.5.0", false},
+		{"1.2.3", "1.2.3", true},
+		{"!=1.2.3", "1.2.3", false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.rng)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.rng, err)
+		}
+		v, err := Parse(tt.version)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.version, err)
+		}
+		if got := r.Contains(v); got != tt.want {
+			t.Fatalf("%s contains %s: got=%v want=%v", tt.rng, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, s := range []string{"", "x.1", "1.2.3.4", "1..2", "-1"} {
+		if _, err := Parse(s); err == nil {
+			t.Fatalf("%q: expected error", s)
+		}
+	}
+	for _, s := range []string{"", ">=", ">=x"} {
+		if _, err := ParseRange(s); err == nil {
+			t.Fatalf("range %q: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package signedurl grants temporary access to a path without an Authorization header, e.g. for browser
+// downloads: the URL carries the api_key, an expiry and an HMAC-SHA256 over both and the path, keyed by
+// the signing_secret of the token profile.
+package signedurl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/store"
+)
+
+// Query parameters of a signed URL. They are removed before the request is proxied.
+const (
+	ParamKey       = "tp_key"
+	ParamExpires   = "tp_expires"
+	ParamSignature = "tp_signature"
+)
+
+var (
+	ErrMalformed = errors.New("malformed signed URL")
+	ErrExpired   = errors.New("signed URL expired")
+	ErrTooLong   = errors.New("signed URL expires beyond max_ttl")
+	ErrSignature = errors.New("signed URL signature mismatch")
+	ErrReplayed  = errors.New("signed URL use limit reached")
+)
+
+// Results of the signed_url_requests_total metric.
+const (
+	resultAllowed      = "allowed"
+	resultMalformed    = "malformed"
+	resultExpired      = "expired"
+	resultInvalid      = "invalid_signature"
+	resultUnknownToken = "unknown_token"
+	resultReplayed     = "replayed"
+	resultError        = "error"
+)
+
+type tokenStore interface {
+	GetToken(ctx context.Context, key string) (store.Token, error)
+}
+
+// Verifier checks signed URLs against the token store and counts their uses in Redis.
+type Verifier struct {
+	tokens  tokenStore
+	rdcl    redis.UniversalClient
+	prefix  string
+	maxTTL  time.Duration
+	maxUses int
+	metrics *mp.Metrics
+
+	// for tests
+	now func() time.Time
+}
+
+type Options struct {
+	// Prefix of the use counters in Redis, "signed_url:" by default.
+	Prefix string
+
+	// for tests
+	Now func() time.Time
+}
+
+func New(tokens tokenStore, rdcl redis.UniversalClient, cfg config.SignedURLs, metrics *mp.Metrics) *Verifier {
+	return &Verifier{
+		tokens:  tokens,
+		rdcl:    rdcl,
+		prefix:  "signed_url:",
+		maxTTL:  cfg.MaxTTL,
+		maxUses: cfg.MaxUses,
+		metrics: metrics,
+		now:     time.Now,
+	}
+}
+
+func (v *Verifier) WithOptions(opts *Options) {
+	if opts == nil {
+		return
+	}
+
+	if opts.Prefix != "" {
+		v.prefix = opts.Prefix
+	}
+	if opts.Now != nil {
+		v.now = opts.Now
+	}
+}
+
+// Sign returns the query parameters granting apiKey access to path until expires.
+func Sign(apiKey, secret, path string, expires time.Time) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	q := url.Values{}
+	q.Set(ParamKey, apiKey)
+	q.Set(ParamExpires, exp)
+	q.Set(ParamSignature, signature(secret, apiKey, path, exp))
+	return q
+}
+
+// Present reports whether the request carries a signed URL.
+func Present(r *http.Request) bool {
+	return r.URL.Query().Has(ParamSignature)
+}
+
+// IsParam reports whether a query parameter belongs to the signed URL.
+func IsParam(name string) bool {
+	return name == ParamKey || name == ParamExpires || name == ParamSignature
+}
+
+// Verify returns the token profile the request's signed URL was issued for. Errors other than the ones
+// of this package and of the token store mean the store or Redis failed.
+func (v *Verifier) Verify(ctx context.Context, r *http.Request) (store.Token, error) {
+	tok, err := v.verify(ctx, r)
+	v.metrics.IncSignedURL(result(err))
+	return tok, err
+}
+
+func (v *Verifier) verify(ctx context.Context, r *http.Request) (store.Token, error) {
+	q := r.URL.Query()
+	apiKey, exp, sig := q.Get(ParamKey), q.Get(ParamExpires), q.Get(ParamSignature)
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if apiKey == "" || sig == "" || err != nil {
+		return store.Token{}, ErrMalformed
+	}
+
+	expires := time.Unix(unix, 0)
+	now := v.now()
+	if !expires.After(now) {
+		return store.Token{}, ErrExpired
+	}
+	if expires.Sub(now) > v.maxTTL {
+		return store.Token{}, ErrTooLong
+	}
+
+	tok, err := v.tokens.GetToken(ctx, apiKey)
+	if err != nil {
+		return store.Token{}, err
+	}
+
+	want := signature(tok.SigningSecret, apiKey, r.URL.EscapedPath(), exp)
+	if tok.SigningSecret == "" || !hmac.Equal([]byte(sig), []byte(want)) {
+		return store.Token{}, ErrSignature
+	}
+
+	if v.maxUses > 0 {
+		key := v.prefix + sig
+		pipe := v.rdcl.TxPipeline()
+		uses := pipe.Incr(ctx, key)
+		pipe.ExpireAt(ctx, key, expires)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return store.Token{}, fmt.Errorf("count signed URL use: %w", err)
+		}
+		if uses.Val() > int64(v.maxUses) {
+			return store.Token{}, ErrReplayed
+		}
+	}
+
+	return tok, nil
+}
+
+// Strip removes the signed URL parameters, keeping the encoding and order of the rest of the query,
+// so neither the upstream nor the response cache sees them.
+func Strip(r *http.Request) {
+	raw := r.URL.RawQuery
+	kept := make([]string, 0, 4)
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if name, _, _ := strings.Cut(pair, "="); pair != "" && !IsParam(name) {
+			kept = append(kept, pair)
+		}
+	}
+
+	r.URL.RawQuery = strings.Join(kept, "&")
+	r.RequestURI = r.URL.RequestURI()
+}
+
+func signature(secret, apiKey, path, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "\n" + apiKey + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func result(err error) string {
+	switch {
+	case err == nil:
+		return resultAllowed
+	case errors.Is(err, ErrMalformed):
+		return resultMalformed
+	case errors.Is(err, ErrExpired), errors.Is(err, ErrTooLong):
+		return resultExpired
+	case errors.Is(err, ErrSignature):
+		return resultInvalid
+	case errors.Is(err, ErrReplayed):
+		return resultReplayed
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrExpired), errors.Is(err, store.ErrInvalid):
+		return resultUnknownToken
+	default:
+		return resultError
+	}
+}
@@ -0,0 +1,84 @@
+package signedurl
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/store"
+)
+
+type fakeTokens map[string]store.Token
+
+func (f fakeTokens) GetToken(_ context.Context, key string) (store.Token, error) {
+	t, ok := f[key]
+	if !ok {
+		return store.Token{}, store.ErrNotFound
+	}
+	return t, nil
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	now := time.Now().Truncate(time.Second)
+	tokens := fakeTokens{
+		"k1": {APIKey: "k1", SigningSecret: "s1"},
+		"k2": {APIKey: "k2"},
+	}
+	v := New(tokens, rdb, config.SignedURLs{MaxTTL: time.Hour, MaxUses: 2}, nil)
+	v.WithOptions(&Options{Now: func() time.Time { return now }})
+
+	url := func(path, query string) string { return path + "?a=1&" + query }
+	valid := Sign("k1", "s1", "/api/v1/files/report.pdf", now.Add(time.Minute)).Encode()
+
+	tests := []struct {
+		name    string
+		target  string
+		wantErr error
+	}{
+		{"valid", url("/api/v1/files/report.pdf", valid), nil},
+		{"other path", url("/api/v1/files/other.pdf", valid), ErrSignature},
+		{"expired", url("/p", Sign("k1", "s1", "/p", now.Add(-time.Second)).Encode()), ErrExpired},
+		{"beyond max_ttl", url("/p", Sign("k1", "s1", "/p", now.Add(2*time.Hour)).Encode()), ErrTooLong},
+		{"wrong secret", url("/p", Sign("k1", "nope", "/p", now.Add(time.Minute)).Encode()), ErrSignature},
+		{"no signing secret", url("/p", Sign("k2", "", "/p", now.Add(time.Minute)).Encode()), ErrSignature},
+		{"unknown key", url("/p", Sign("k3", "s1", "/p", now.Add(time.Minute)).Encode()), store.ErrNotFound},
+		{"malformed", "/p?tp_signature=x&tp_key=k1", ErrMalformed},
+		{"second use", url("/api/v1/files/report.pdf", valid), nil},
+		{"replayed", url("/api/v1/files/report.pdf", valid), ErrReplayed},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if !Present(r) {
+			t.Fatalf("%s: signed URL not detected", tt.name)
+		}
+
+		tok, err := v.Verify(context.Background(), r)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: err=%v want=%v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && tok.APIKey != "k1" {
+			t.Fatalf("%s: api_key=%q", tt.name, tok.APIKey)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	q := Sign("k1", "s1", "/p", time.Now().Add(time.Minute)).Encode()
+	r := httptest.NewRequest("GET", "/p?a=1&"+q+"&b=x%20y", nil)
+
+	Strip(r)
+	if r.URL.RawQuery != "a=1&b=x%20y" || r.RequestURI != "/p?a=1&b=x%20y" {
+		t.Fatalf("query=%q uri=%q", r.URL.RawQuery, r.RequestURI)
+	}
+}
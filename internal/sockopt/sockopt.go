@@ -0,0 +1,94 @@
+// Package sockopt applies configured TCP socket options to listeners and dialers.
+package sockopt
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+)
+
+// Listen listens on addr with the keep-alive settings of o and applies its other options to every
+// accepted connection.
+func Listen(ctx context.Context, network, addr string, o config.SocketOptions) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	lc.KeepAlive, lc.KeepAliveConfig = keepAlive(o, 0)
+
+	ln, err := lc.Listen(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if o.NoDelay == nil && o.ReadBuffer == 0 && o.WriteBuffer == 0 {
+		return ln, nil
+	}
+
+	return &listener{Listener: ln, opts: o}, nil
+}
+
+// Configure sets the keep-alive settings of o on d; idle is the probe idle time when o sets none.
+// Connections dialed with d still need Apply.
+func Configure(d *net.Dialer, o config.SocketOptions, idle time.Duration) {
+	d.KeepAlive, d.KeepAliveConfig = keepAlive(o, idle)
+}
+
+// Apply sets TCP_NODELAY and the buffer sizes of o on conn. Connections other than TCP are left alone.
+func Apply(conn net.Conn, o config.SocketOptions) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if o.NoDelay != nil {
+		if err := tc.SetNoDelay(*o.NoDelay); err != nil {
+			return err
+		}
+	}
+	if o.ReadBuffer > 0 {
+		if err := tc.SetReadBuffer(o.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if o.WriteBuffer > 0 {
+		if err := tc.SetWriteBuffer(o.WriteBuffer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func keepAlive(o config.SocketOptions, idle time.Duration) (time.Duration, net.KeepAliveConfig) {
+	if o.KeepAlive < 0 {
+		return -1, net.KeepAliveConfig{}
+	}
+	if o.KeepAlive == 0 && o.KeepAliveInterval == 0 && o.KeepAliveCount == 0 {
+		return idle, net.KeepAliveConfig{}
+	}
+
+	if o.KeepAlive > 0 {
+		idle = o.KeepAlive
+	}
+	return 0, net.KeepAliveConfig{Enable: true, Idle: idle, Interval: o.KeepAliveInterval, Count: o.KeepAliveCount}
+}
+
+type listener struct {
+	net.Listener
+	opts config.SocketOptions
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	// an error here must not stop the server, and the connection works without the tuning
+	if err := Apply(conn, l.opts); err != nil {
+		log.Warn().Err(err).Str("remote", conn.RemoteAddr().String()).Msg("Failed to apply socket options")
+	}
+
+	return conn, nil
+}
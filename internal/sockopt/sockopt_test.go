@@ -0,0 +1,78 @@
+package sockopt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestKeepAlive(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     config.SocketOptions
+		wantIdle time.Duration
+		wantCfg  net.KeepAliveConfig
+	}{
+		{"defaults", config.SocketOptions{}, 30 * time.Second, net.KeepAliveConfig{}},
+		{"disabled", config.SocketOptions{KeepAlive: -1, KeepAliveCount: 3}, -1, net.KeepAliveConfig{}},
+		{
+			"idle only", config.SocketOptions{KeepAlive: time.Minute},
+			0, net.KeepAliveConfig{Enable: true, Idle: time.Minute},
+		},
+		{
+			"probes keep default idle", config.SocketOptions{KeepAliveInterval: 5 * time.Second, KeepAliveCount: 3},
+			0, net.KeepAliveConfig{Enable: true, Idle: 30 * time.Second, Interval: 5 * time.Second, Count: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idle, cfg := keepAlive(tt.opts, 30*time.Second)
+			if idle != tt.wantIdle || cfg != tt.wantCfg {
+				t.Fatalf("keepAlive=%v %+v want %v %+v", idle, cfg, tt.wantIdle, tt.wantCfg)
+			}
+		})
+	}
+}
+
+func TestListen_AppliesOptions(t *testing.T) {
+	noDelay := false
+	ln, err := Listen(context.Background(), "tcp", "127.0.0.1:0", config.SocketOptions{
+		NoDelay: &noDelay, ReadBuffer: 64 << 10, WriteBuffer: 64 << 10,
+	})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	if _, ok := ln.(*listener); !ok {
+		t.Fatalf("listener=%T want the tuning wrapper", ln)
+	}
+
+	go func() {
+		if c, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+			_ = c.Close()
+		}
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	_ = conn.Close()
+}
+
+func TestListen_NoTuning(t *testing.T) {
+	ln, err := Listen(context.Background(), "tcp", "127.0.0.1:0", config.SocketOptions{KeepAlive: time.Minute})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	if _, ok := ln.(*listener); ok {
+		t.Fatalf("keep-alive alone should not wrap the listener")
+	}
+}
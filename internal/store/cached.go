@@ -0,0 +1,248 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/cache"
+	mp "tyk-proxy/internal/metrics"
+)
+
+// touchInterval limits how often a hot key's last-used time is written to Redis.
+const touchInterval = time.Minute
+
+// warmWorkers is the number of concurrent lookups during warm-up.
+const warmWorkers = 8
+
+type usageTracker interface {
+	Touch(ctx context.Context, apiKey string) error
+	Recent(ctx context.Context, n int) ([]string, error)
+}
+
+type invalidations interface {
+	Publish(ctx context.Context, apiKey string) error
+}
+
+// Token cache lookup results, as counted in metrics.
+const (
+	tokenCacheHit  = "hit"
+	tokenCacheMiss = "miss"
+)
+
+type cachedToken struct {
+	token   Token
+	touched atomic.Int64 // unix nanos of the last usage write
+}
+
+// CachedStore keeps recently used token profiles in process memory in front of next.
+// Changes made elsewhere (direct DB edits, or another instance without invalidations) become visible after ttl.
+type CachedStore struct {
+	next          Backend
+	lru           *cache.LRU[string, *cachedToken]
+	ttl           time.Duration
+	usage         usageTracker
+	invalidations invalidations
+	metrics       *mp.Metrics
+
+	// for tests
+	now func() time.Time
+}
+
+type CachedOptions struct {
+	// Usage records last use of tokens for warm-up; nil disables tracking.
+	Usage usageTracker
+
+	// Invalidations tells the other instances about profiles changed through this store, so their caches
+	// drop them; they must call Invalidate for each. Nil leaves them to the ttl.
+	Invalidations invalidations
+
+	// Metrics counts cache hits and misses.
+	Metrics *mp.Metrics
+
+	// for tests
+	Now func() time.Time
+}
+
+func NewCachedStore(next Backend, size int, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		next: next,
+		lru:  cache.New[string, *cachedToken](size, ttl),
+		ttl:  ttl,
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *CachedStore) WithOptions(opts *CachedOptions) {
+	now := opts.Now
+	if now == nil {
+		now = func() time.Time { return time.Now().UTC() }
+	}
+
+	s.now = now
+	s.lru.WithOptions(&cache.Options{Now: now})
+	s.usage = opts.Usage
+	s.invalidations = opts.Invalidations
+	s.metrics = opts.Metrics
+}
+
+func (s *CachedStore) GetToken(ctx context.Context, apiKey string) (Token, error) {
+	now := s.now()
+
+	if ct, ok := s.lru.Get(apiKey); ok {
+		s.metrics.IncTokenCache(tokenCacheHit)
+		if !ct.token.ExpiresAt.After(now) {
+			s.lru.Delete(apiKey)
+			return Token{}, ErrExpired
+		}
+
+		if last := ct.touched.Load(); now.UnixNano()-last >= int64(touchInterval) &&
+			ct.touched.CompareAndSwap(last, now.UnixNano()) {
+			s.touch(ctx, apiKey)
+		}
+
+		return ct.token, nil
+	}
+	s.metrics.IncTokenCache(tokenCacheMiss)
+
+	t, err := s.next.GetToken(ctx, apiKey)
+	if err != nil {
+		return Token{}, err
+	}
+
+	s.touch(ctx, apiKey)
+	s.set(t, now)
+
+	return t, nil
+}
+
+func (s *CachedStore) Upsert(ctx context.Context, t Token) error {
+	s.lru.Delete(t.APIKey)
+	if err := s.next.Upsert(ctx, t); err != nil {
+		return err
+	}
+	s.invalidate(ctx, t.APIKey)
+
+	return nil
+}
+
+func (s *CachedStore) SetRateLimit(ctx context.Context, apiKey string, limit int) error {
+	s.lru.Delete(apiKey)
+	if err := s.next.SetRateLimit(ctx, apiKey, limit); err != nil {
+		return err
+	}
+	s.invalidate(ctx, apiKey)
+
+	return nil
+}
+
+func (s *CachedStore) Delete(ctx context.Context, apiKey string) error {
+	s.lru.Delete(apiKey)
+	if err := s.next.Delete(ctx, apiKey); err != nil {
+		return err
+	}
+	s.invalidate(ctx, apiKey)
+
+	return nil
+}
+
+// Invalidate drops the cached profile of apiKey, e.g. when another instance changed it.
+func (s *CachedStore) Invalidate(apiKey string) {
+	s.lru.Delete(apiKey)
+}
+
+// Purge drops every cached profile, e.g. after invalidations may have been missed.
+func (s *CachedStore) Purge() {
+	s.lru.DeleteFunc(func(string) bool { return true })
+}
+
+// invalidate drops apiKey again, in case a concurrent lookup cached the old profile during the write, and
+// tells the other instances.
+func (s *CachedStore) invalidate(ctx context.Context, apiKey string) {
+	s.lru.Delete(apiKey)
+	if s.invalidations == nil {
+		return
+	}
+
+	if err := s.invalidations.Publish(ctx, apiKey); err != nil {
+		log.Warn().Err(err).Msg("token cache invalidation not published")
+	}
+}
+
+// Warm preloads the n most recently used tokens, so a fresh instance does not send
+// every first request of every client to Redis at once. It returns the number of tokens loaded.
+func (s *CachedStore) Warm(ctx context.Context, n int) (int, error) {
+	if s.usage == nil || n <= 0 {
+		return 0, nil
+	}
+
+	keys, err := s.usage.Recent(ctx, n)
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	work := make(chan string)
+	var (
+		wg     sync.WaitGroup
+		loaded atomic.Int64
+	)
+	for i := 0; i < warmWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range work {
+				t, err := s.next.GetToken(ctx, k)
+				if err != nil {
+					// expired or deleted since last use
+					log.Debug().Err(err).Msg("token warm-up skipped key")
+					continue
+				}
+
+				// warming is not usage, so the last-used index is left alone
+				s.set(t, now)
+				loaded.Add(1)
+			}
+		}()
+	}
+
+	for _, k := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- k
+	}
+	close(work)
+	wg.Wait()
+
+	return int(loaded.Load()), ctx.Err()
+}
+
+// set caches t no longer than the token itself is valid.
+func (s *CachedStore) set(t Token, touched time.Time) {
+	ttl := t.ExpiresAt.Sub(s.now())
+	if ttl <= 0 {
+		return
+	}
+
+	if s.ttl > 0 && s.ttl < ttl {
+		ttl = s.ttl
+	}
+
+	ct := &cachedToken{token: t}
+	ct.touched.Store(touched.UnixNano())
+	s.lru.SetWithTTL(t.APIKey, ct, ttl)
+}
+
+func (s *CachedStore) touch(ctx context.Context, apiKey string) {
+	if s.usage == nil {
+		return
+	}
+
+	if err := s.usage.Touch(ctx, apiKey); err != nil {
+		log.Debug().Err(err).Msg("token usage update failed")
+	}
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type fakeUsage struct {
+	mu      sync.Mutex
+	touched []string
+	recent  []string
+}
+
+func (f *fakeUsage) Touch(_ context.Context, apiKey string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.touched = append(f.touched, apiKey)
+	return nil
+}
+
+func (f *fakeUsage) Recent(_ context.Context, n int) ([]string, error) {
+	if n < len(f.recent) {
+		return f.recent[:n], nil
+	}
+	return f.recent, nil
+}
+
+func TestCachedStore_GetToken(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	next := newFakeBackend()
+	next.tokens["k1"] = Token{APIKey: "k1", RateLimit: 5, ExpiresAt: now.Add(time.Hour)}
+	usage := &fakeUsage{}
+
+	s := NewCachedStore(next, 10, 30*time.Second)
+	s.WithOptions(&CachedOptions{Usage: usage, Now: func() time.Time { return now }})
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.GetToken(context.Background(), "k1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if next.gets != 1 {
+		t.Fatalf("backend reads=%d want=1", next.gets)
+	}
+	if len(usage.touched) != 1 {
+		t.Fatalf("usage writes=%d want=1", len(usage.touched))
+	}
+
+	// a hot key is re-touched once per interval, and reloaded once the cache ttl passes
+	now = now.Add(touchInterval)
+	if _, err := s.GetToken(context.Background(), "k1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next.gets != 2 {
+		t.Fatalf("backend reads=%d want=2 after ttl", next.gets)
+	}
+	if len(usage.touched) != 2 {
+		t.Fatalf("usage writes=%d want=2", len(usage.touched))
+	}
+
+	if _, err := s.GetToken(context.Background(), "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err=%v want=%v", err, ErrNotFound)
+	}
+}
+
+func TestCachedStore_TokenExpiryBoundsCache(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	next := newFakeBackend()
+	next.tokens["k1"] = Token{APIKey: "k1", RateLimit: 5, ExpiresAt: now.Add(5 * time.Second)}
+
+	s := NewCachedStore(next, 10, time.Hour)
+	s.WithOptions(&CachedOptions{Now: func() time.Time { return now }})
+
+	if _, err := s.GetToken(context.Background(), "k1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the backend still has the record, but the cached copy must not outlive the token
+	next.getErr = ErrExpired
+	now = now.Add(6 * time.Second)
+	if _, err := s.GetToken(context.Background(), "k1"); !errors.Is(err, ErrExpired) {
+		t.Fatalf("err=%v want=%v", err, ErrExpired)
+	}
+}
+
+func TestCachedStore_Warm(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	next := newFakeBackend()
+	for _, k := range []string{"a", "b", "c"} {
+		next.tokens[k] = Token{APIKey: k, RateLimit: 5, ExpiresAt: now.Add(time.Hour)}
+	}
+	usage := &fakeUsage{recent: []string{"c", "gone", "a", "b"}}
+
+	s := NewCachedStore(next, 10, time.Minute)
+	s.WithOptions(&CachedOptions{Usage: usage, Now: func() time.Time { return now }})
+
+	n, err := s.Warm(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("loaded=%d want=2", n)
+	}
+	if len(usage.touched) != 0 {
+		t.Fatalf("warm-up must not record usage, got %v", usage.touched)
+	}
+
+	reads := next.gets
+	for _, k := range []string{"c", "a"} {
+		if _, err := s.GetToken(context.Background(), k); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if next.gets != reads {
+		t.Fatalf("warmed keys read from backend: reads=%d want=%d", next.gets, reads)
+	}
+}
+
+func TestCachedStore_Invalidations(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// two instances sharing the backend
+	next := newFakeBackend()
+	next.tokens["k1"] = Token{APIKey: "k1", RateLimit: 5, ExpiresAt: time.Now().Add(time.Hour)}
+	inv := NewInvalidations(rdb, "")
+	a, b := NewCachedStore(next, 10, time.Hour), NewCachedStore(next, 10, time.Hour)
+	a.WithOptions(&CachedOptions{Invalidations: inv})
+	b.WithOptions(&CachedOptions{Invalidations: inv})
+	go inv.Run(ctx, b.Invalidate)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mr.PubSubNumSub("token_invalidations")["token_invalidations"] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("not subscribed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if tok, err := b.GetToken(ctx, "k1"); err != nil || tok.RateLimit != 5 {
+		t.Fatalf("token=%+v err=%v", tok, err)
+	}
+	if err := a.Upsert(ctx, Token{APIKey: "k1", RateLimit: 50, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	for {
+		tok, err := b.GetToken(ctx, "k1")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if tok.RateLimit == 50 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("instance b still serves the old profile")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := a.SetRateLimit(ctx, "k1", 7); err != nil {
+		t.Fatalf("set rate limit: %v", err)
+	}
+	for {
+		tok, err := b.GetToken(ctx, "k1")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if tok.RateLimit == 7 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("instance b still serves the old rate limit")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
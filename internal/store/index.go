@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Secondary indexes let operators query tokens without scanning the keyspace. Members are api keys:
+// a set per plan and per tenant, and a sorted set scored by expiry (unix seconds). Redis expires the
+// profiles but not their index entries, so the indexes may name gone tokens; Search drops those as it
+// meets them and Upsert trims the expired part of the expiry index.
+
+// ExpiryIndex names the sorted set of the tokens stored under prefix, by expiry.
+func ExpiryIndex(prefix string) string {
+	return indexPrefix(prefix) + "expiry"
+}
+
+// PlanIndex names the set of the tokens stored under prefix that use plan.
+func PlanIndex(prefix, plan string) string {
+	return indexPrefix(prefix) + "plan:" + plan
+}
+
+// TenantIndex names the set of the tokens stored under prefix that belong to tenant.
+func TenantIndex(prefix, tenant string) string {
+	return indexPrefix(prefix) + "tenant:" + tenant
+}
+
+// indexPrefix keeps the indexes out of the profiles' keyspace: "token:" indexes under "token_idx:".
+func indexPrefix(prefix string) string {
+	return strings.TrimSuffix(prefix, ":") + "_idx:"
+}
+
+// indexed are the fields of a stored profile its set indexes depend on.
+type indexed struct {
+	plan, tenant string
+}
+
+func (s *Store) indexed(ctx context.Context, key string) (indexed, error) {
+	vals, err := s.rdcl.HMGet(ctx, key, "plan", "tenant").Result()
+	if err != nil {
+		return indexed{}, err
+	}
+
+	plan, _ := vals[0].(string)
+	tenant, _ := vals[1].(string)
+	return indexed{plan: plan, tenant: tenant}, nil
+}
+
+// index queues the index updates of t, which replaces a profile indexed as old, on pipe.
+func (s *Store) index(ctx context.Context, pipe redis.Pipeliner, t Token, old indexed) {
+	if old.plan != "" && old.plan != t.Plan {
+		pipe.SRem(ctx, PlanIndex(s.prefix, old.plan), t.APIKey)
+	}
+	if old.tenant != "" && old.tenant != t.Tenant {
+		pipe.SRem(ctx, TenantIndex(s.prefix, old.tenant), t.APIKey)
+	}
+	if t.Plan != "" {
+		pipe.SAdd(ctx, PlanIndex(s.prefix, t.Plan), t.APIKey)
+	}
+	if t.Tenant != "" {
+		pipe.SAdd(ctx, TenantIndex(s.prefix, t.Tenant), t.APIKey)
+	}
+
+	expiry := ExpiryIndex(s.prefix)
+	pipe.ZAdd(ctx, expiry, redis.Z{Score: float64(t.ExpiresAt.Unix()), Member: t.APIKey})
+	pipe.ZRemRangeByScore(ctx, expiry, "-inf", "("+strconv.FormatInt(s.now().Unix(), 10))
+}
+
+// unindex queues the removal of apiKey, indexed as old, from the indexes on pipe.
+func (s *Store) unindex(ctx context.Context, pipe redis.Pipeliner, apiKey string, old indexed) {
+	if old.plan != "" {
+		pipe.SRem(ctx, PlanIndex(s.prefix, old.plan), apiKey)
+	}
+	if old.tenant != "" {
+		pipe.SRem(ctx, TenantIndex(s.prefix, old.tenant), apiKey)
+	}
+	pipe.ZRem(ctx, ExpiryIndex(s.prefix), apiKey)
+}
+
+// candidates returns the api keys the indexes offer for q, a superset of its matches.
+func (s *Store) candidates(ctx context.Context, q Query) ([]string, error) {
+	var sets []string
+	if q.Plan != "" {
+		sets = append(sets, PlanIndex(s.prefix, q.Plan))
+	}
+	if q.Tenant != "" {
+		sets = append(sets, TenantIndex(s.prefix, q.Tenant))
+	}
+	if len(sets) > 0 {
+		return s.rdcl.SInter(ctx, sets...).Result()
+	}
+
+	after := s.now()
+	if q.ExpiringAfter.After(after) {
+		after = q.ExpiringAfter
+	}
+	// scores are whole seconds, so the range is inclusive; matches re-checks the exact bounds
+	rng := &redis.ZRangeBy{Min: strconv.FormatInt(after.Unix(), 10), Max: "+inf"}
+	if !q.ExpiringBefore.IsZero() {
+		rng.Max = strconv.FormatInt(q.ExpiringBefore.Unix(), 10)
+	}
+
+	return s.rdcl.ZRangeByScore(ctx, ExpiryIndex(s.prefix), rng).Result()
+}
+
+// Reindex rebuilds the indexes from the stored profiles, e.g. for tokens written before they existed.
+// It scans the keyspace once and returns the number of tokens indexed.
+func (s *Store) Reindex(ctx context.Context) (int, error) {
+	now := s.now()
+	n := 0
+
+	var cursor uint64
+	for {
+		keys, next, err := s.rdcl.Scan(ctx, cursor, s.prefix+"*", searchScanBatch).Result()
+		if err != nil {
+			return n, err
+		}
+
+		tokens, err := s.profiles(ctx, keys, now)
+		if err != nil {
+			return n, err
+		}
+		if len(tokens) > 0 {
+			pipe := s.rdcl.Pipeline()
+			for _, t := range tokens {
+				s.index(ctx, pipe, t, indexed{})
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return n, err
+			}
+			n += len(tokens)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return n, nil
+		}
+	}
+}
+
+// profiles loads the live profiles stored at keys, skipping missing, expired and malformed ones.
+func (s *Store) profiles(ctx context.Context, keys []string, now time.Time) ([]Token, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := s.rdcl.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(keys))
+	for i, k := range keys {
+		cmds[i] = pipe.HGetAll(ctx, k)
+	}
+	_, _ = pipe.Exec(ctx) // errors are checked per key: one odd key must not fail the rest
+
+	var tokens []Token
+	for i, k := range keys {
+		m, err := cmds[i].Result()
+		var rerr redis.Error
+		if err != nil && !errors.As(err, &rerr) {
+			return nil, err
+		}
+		if len(m) == 0 {
+			continue
+		}
+		t, err := decodeToken(k[len(s.prefix):], m)
+		if err != nil || !t.ExpiresAt.After(now) {
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Invalidations broadcasts the api keys of changed token profiles over Redis pub/sub, so every instance drops
+// them from its in-memory token cache at once rather than when the cached copy expires. Messages are not
+// queued: an instance disconnected from Redis misses them and relies on the cache ttl. The same broadcast on
+// another channel carries keys killed through the admin API.
+type Invalidations struct {
+	rdcl    redis.UniversalClient
+	channel string
+}
+
+func NewInvalidations(rdcl redis.UniversalClient, channel string) *Invalidations {
+	if channel == "" {
+		channel = "token_invalidations"
+	}
+
+	return &Invalidations{rdcl: rdcl, channel: channel}
+}
+
+func (i *Invalidations) Publish(ctx context.Context, apiKey string) error {
+	return i.rdcl.Publish(ctx, i.channel, apiKey).Err()
+}
+
+// Run calls drop with every api key published, including this instance's own, until ctx is done.
+func (i *Invalidations) Run(ctx context.Context, drop func(apiKey string)) {
+	sub := i.rdcl.Subscribe(ctx, i.channel)
+	defer sub.Close()
+
+	// the subscription reconnects by itself; messages sent meanwhile are lost
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				log.Warn().Str("channel", i.channel).Msg("api key subscription closed")
+				return
+			}
+			drop(msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/cache"
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+)
+
+const (
+	issuerFound      = "found"
+	issuerNotFound   = "not_found"
+	issuerNegCached  = "negative_cached"
+	issuerDeleted    = "deleted"
+	issuerError      = "error"
+	issuerMaxBodyLen = 1 << 20
+
+	// issuerDeletedPrefix marks keys deleted in the store (token_deleted:<api_key>), so they are not imported again.
+	issuerDeletedPrefix = "token_deleted:"
+	// issuerDeletedTTL bounds the mark when the deleted profile's expiry is unknown.
+	issuerDeletedTTL = 24 * time.Hour
+)
+
+// IssuerLookup imports tokens created in an external issuer: a token next does not know is fetched from the
+// issuer API and stored in next, so tokens work without a sync job. Keys the issuer does not know either are
+// remembered for a while, so replayed tokens do not reach it on every request. Once imported, a profile is
+// managed in next like any other; later changes in the issuer are not picked up. A deleted key is marked in
+// Redis until its profile would have expired, so no instance imports it again.
+type IssuerLookup struct {
+	next     Backend
+	rdcl     redis.UniversalClient
+	cfg      config.TokenIssuer
+	client   *http.Client
+	negative *cache.LRU[string, struct{}]
+	metrics  *mp.Metrics
+
+	// for tests
+	now func() time.Time
+}
+
+func NewIssuerLookup(next Backend, rdcl redis.UniversalClient, cfg config.TokenIssuer, metrics *mp.Metrics) *IssuerLookup {
+	return &IssuerLookup{
+		next:     next,
+		rdcl:     rdcl,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		negative: cache.New[string, struct{}](cfg.NegativeCacheSize, cfg.NegativeTTL),
+		metrics:  metrics,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *IssuerLookup) GetToken(ctx context.Context, apiKey string) (Token, error) {
+	t, err := s.next.GetToken(ctx, apiKey)
+	if !errors.Is(err, ErrNotFound) {
+		return t, err
+	}
+
+	if _, ok := s.negative.Get(apiKey); ok {
+		s.metrics.IncIssuerLookup(issuerNegCached)
+		return Token{}, ErrNotFound
+	}
+
+	deleted, err := s.rdcl.Exists(ctx, issuerDeletedPrefix+apiKey).Result()
+	if err != nil {
+		s.metrics.IncIssuerLookup(issuerError)
+		return Token{}, fmt.Errorf("token issuer: deleted keys: %w", err)
+	}
+	if deleted > 0 {
+		s.metrics.IncIssuerLookup(issuerDeleted)
+		return Token{}, ErrNotFound
+	}
+
+	t, err = s.fetch(ctx, apiKey)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		s.metrics.IncIssuerLookup(issuerNotFound)
+		s.negative.Set(apiKey, struct{}{})
+		return Token{}, err
+	case err != nil:
+		s.metrics.IncIssuerLookup(issuerError)
+		return Token{}, fmt.Errorf("token issuer: %w", err)
+	}
+	s.metrics.IncIssuerLookup(issuerFound)
+
+	if err := s.next.Upsert(ctx, t); err != nil {
+		// the profile is still good for this request; the next one asks the issuer again
+		log.Warn().Err(err).Msg("failed to store token imported from the issuer")
+	}
+
+	return t, nil
+}
+
+func (s *IssuerLookup) fetch(ctx context.Context, apiKey string) (Token, error) {
+	target := strings.ReplaceAll(s.cfg.URL, config.IssuerKeyPlaceholder, url.PathEscape(apiKey))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return Token{}, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return Token{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var t Token
+	if err := json.NewDecoder(io.LimitReader(resp.Body, issuerMaxBodyLen)).Decode(&t); err != nil {
+		return Token{}, fmt.Errorf("%w: decode issuer profile: %v", ErrInvalid, err)
+	}
+	if t.APIKey == "" {
+		t.APIKey = apiKey
+	}
+
+	switch {
+	case t.APIKey != apiKey:
+		return Token{}, fmt.Errorf("%w: issuer returned the profile of another key", ErrInvalid)
+	case t.ExpiresAt.IsZero():
+		return Token{}, fmt.Errorf("%w: issuer profile without expires_at", ErrInvalid)
+	case t.RateLimit < Unlimited || !validStatus(t.Status):
+		return Token{}, fmt.Errorf("%w: invalid issuer profile", ErrInvalid)
+	case !t.ExpiresAt.After(s.now()):
+		return Token{}, ErrExpired
+	}
+
+	return t, nil
+}
+
+func (s *IssuerLookup) Upsert(ctx context.Context, t Token) error {
+	s.negative.Delete(t.APIKey)
+	if err := s.rdcl.Del(ctx, issuerDeletedPrefix+t.APIKey).Err(); err != nil {
+		return fmt.Errorf("token issuer: deleted keys: %w", err)
+	}
+	return s.next.Upsert(ctx, t)
+}
+
+func (s *IssuerLookup) SetRateLimit(ctx context.Context, apiKey string, limit int) error {
+	return s.next.SetRateLimit(ctx, apiKey, limit)
+}
+
+// Delete marks apiKey deleted before deleting it from next, so a request in between cannot import it again.
+func (s *IssuerLookup) Delete(ctx context.Context, apiKey string) error {
+	until := s.now().Add(issuerDeletedTTL)
+	if t, err := s.next.GetToken(ctx, apiKey); err == nil {
+		until = t.ExpiresAt
+	}
+	if ttl := until.Sub(s.now()); ttl > 0 {
+		if err := s.rdcl.Set(ctx, issuerDeletedPrefix+apiKey, 1, ttl).Err(); err != nil {
+			return fmt.Errorf("token issuer: deleted keys: %w", err)
+		}
+	}
+
+	return s.next.Delete(ctx, apiKey)
+}
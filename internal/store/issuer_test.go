@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestIssuerLookup_GetToken(t *testing.T) {
+	var calls atomic.Int32
+	exp := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "Bearer mgmt" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch key := strings.TrimPrefix(r.URL.Path, "/tokens/"); key {
+		case "ext":
+			fmt.Fprintf(w, `{"api_key": "ext", "rate_limit": 30, "expires_at": %q, "allowed_routes": ["/api/v1/*"], "tenant": "acme"}`, exp)
+		case "other":
+			fmt.Fprintf(w, `{"api_key": "someone-else", "expires_at": %q}`, exp)
+		case "broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer issuer.Close()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	local := newFakeBackend()
+	local.tokens["local"] = Token{APIKey: "local", ExpiresAt: time.Now().Add(time.Hour)}
+	s := NewIssuerLookup(local, rdb, config.TokenIssuer{
+		URL:               issuer.URL + "/tokens/{api_key}",
+		Headers:           map[string]string{"Authorization": "Bearer mgmt"},
+		Timeout:           time.Second,
+		NegativeTTL:       time.Minute,
+		NegativeCacheSize: 10,
+	}, nil)
+	ctx := context.Background()
+
+	if _, err := s.GetToken(ctx, "local"); err != nil || calls.Load() != 0 {
+		t.Fatalf("err=%v calls=%d want the local token without asking the issuer", err, calls.Load())
+	}
+
+	tok, err := s.GetToken(ctx, "ext")
+	if err != nil || tok.RateLimit != 30 || tok.Tenant != "acme" {
+		t.Fatalf("token=%+v err=%v want the issuer's profile", tok, err)
+	}
+	if _, ok := local.tokens["ext"]; !ok {
+		t.Fatalf("imported token not stored")
+	}
+	if _, err := s.GetToken(ctx, "ext"); err != nil || calls.Load() != 1 {
+		t.Fatalf("err=%v calls=%d want the imported token served locally", err, calls.Load())
+	}
+
+	// a deleted key stays deleted on every instance until its profile would have expired
+	if err := s.Delete(ctx, "ext"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	other := NewIssuerLookup(newFakeBackend(), rdb, s.cfg, nil)
+	for _, lookup := range []*IssuerLookup{s, other} {
+		if _, err := lookup.GetToken(ctx, "ext"); !errors.Is(err, ErrNotFound) || calls.Load() != 1 {
+			t.Fatalf("err=%v calls=%d want a deleted key not imported again", err, calls.Load())
+		}
+	}
+	if ttl := mr.TTL(issuerDeletedPrefix + "ext"); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("deleted mark ttl=%v want the profile's remaining hour", ttl)
+	}
+	// creating the key again lifts the mark
+	if err := s.Upsert(ctx, Token{APIKey: "ext", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if mr.Exists(issuerDeletedPrefix + "ext") {
+		t.Fatalf("deleted mark kept after upsert")
+	}
+
+	for range 2 {
+		if _, err := s.GetToken(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("err=%v want ErrNotFound", err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("calls=%d want the unknown key asked for once", calls.Load())
+	}
+
+	if _, err := s.GetToken(ctx, "other"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err=%v want ErrInvalid for a profile of another key", err)
+	}
+	if _, err := s.GetToken(ctx, "broken"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("err=%v want an issuer error", err)
+	}
+
+	// a token created locally after a negative lookup is served at once
+	if err := s.Upsert(ctx, Token{APIKey: "unknown", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if _, err := s.GetToken(ctx, "unknown"); err != nil {
+		t.Fatalf("err=%v want the local token", err)
+	}
+}
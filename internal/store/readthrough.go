@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Backend is a token store that ReadThrough can use either as the cache or as the source of truth.
+type Backend interface {
+	GetToken(ctx context.Context, apiKey string) (Token, error)
+	Upsert(ctx context.Context, t Token) error
+	// SetRateLimit changes only the rate limit of an existing profile, ErrNotFound when there is none.
+	SetRateLimit(ctx context.Context, apiKey string, limit int) error
+	Delete(ctx context.Context, apiKey string) error
+}
+
+// ReadThrough serves tokens from cache (Redis) and loads misses from source (e.g. PostgreSQL).
+// The source is authoritative: writes go there first and the cache only ever holds copies.
+type ReadThrough struct {
+	cache  Backend
+	source Backend
+}
+
+func NewReadThrough(cache, source Backend) *ReadThrough {
+	return &ReadThrough{cache: cache, source: source}
+}
+
+func (rt *ReadThrough) GetToken(ctx context.Context, apiKey string) (Token, error) {
+	t, err := rt.cache.GetToken(ctx, apiKey)
+	if err == nil {
+		return t, nil
+	}
+
+	if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrInvalid) {
+		// the cache being down must not take authentication down with it
+		log.Warn().Err(err).Msg("token cache lookup failed, reading from source")
+	}
+
+	t, err = rt.source.GetToken(ctx, apiKey)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if err := rt.cache.Upsert(ctx, t); err != nil {
+		log.Debug().Err(err).Msg("token cache fill failed")
+	}
+
+	return t, nil
+}
+
+func (rt *ReadThrough) Upsert(ctx context.Context, t Token) error {
+	if err := rt.source.Upsert(ctx, t); err != nil {
+		return err
+	}
+
+	// a stale copy would outlive the change, so drop it and let the next read refill
+	return rt.cache.Delete(ctx, t.APIKey)
+}
+
+func (rt *ReadThrough) SetRateLimit(ctx context.Context, apiKey string, limit int) error {
+	if err := rt.source.SetRateLimit(ctx, apiKey, limit); err != nil {
+		return err
+	}
+
+	return rt.cache.Delete(ctx, apiKey)
+}
+
+func (rt *ReadThrough) Delete(ctx context.Context, apiKey string) error {
+	if err := rt.source.Delete(ctx, apiKey); err != nil {
+		return err
+	}
+
+	return rt.cache.Delete(ctx, apiKey)
+}
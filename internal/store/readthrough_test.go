@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeBackend struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+	getErr error
+
+	gets, upserts, deletes int
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{tokens: map[string]Token{}}
+}
+
+func (f *fakeBackend) GetToken(_ context.Context, apiKey string) (Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.gets++
+	if f.getErr != nil {
+		return Token{}, f.getErr
+	}
+	t, ok := f.tokens[apiKey]
+	if !ok {
+		return Token{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (f *fakeBackend) Upsert(_ context.Context, t Token) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.upserts++
+	f.tokens[t.APIKey] = t
+	return nil
+}
+
+func (f *fakeBackend) SetRateLimit(_ context.Context, apiKey string, limit int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.tokens[apiKey]
+	if !ok {
+		return ErrNotFound
+	}
+	f.upserts++
+	t.RateLimit = limit
+	f.tokens[apiKey] = t
+	return nil
+}
+
+func (f *fakeBackend) Delete(_ context.Context, apiKey string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deletes++
+	delete(f.tokens, apiKey)
+	return nil
+}
+
+func TestReadThrough_GetToken(t *testing.T) {
+	tok := Token{APIKey: "k1", RateLimit: 5, ExpiresAt: time.Now().Add(time.Hour)}
+
+	tests := []struct {
+		name       string
+		cached     bool
+		cacheErr   error
+		inSource   bool
+		wantErr    error
+		wantSource int
+		wantFill   int
+	}{
+		{name: "cache hit", cached: true, inSource: true, wantSource: 0},
+		{name: "cache miss fills cache", inSource: true, wantSource: 1, wantFill: 1},
+		{name: "cache down reads source", cacheErr: errors.New("connection refused"), inSource: true, wantSource: 1, wantFill: 1},
+		{name: "unknown everywhere", wantErr: ErrNotFound, wantSource: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, source := newFakeBackend(), newFakeBackend()
+			cache.getErr = tt.cacheErr
+			if tt.cached {
+				cache.tokens[tok.APIKey] = tok
+			}
+			if tt.inSource {
+				source.tokens[tok.APIKey] = tok
+			}
+
+			got, err := NewReadThrough(cache, source).GetToken(context.Background(), tok.APIKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err=%v want=%v", err, tt.wantErr)
+			}
+			if err == nil && got.APIKey != tok.APIKey {
+				t.Fatalf("api_key=%q want=%q", got.APIKey, tok.APIKey)
+			}
+			if source.gets != tt.wantSource {
+				t.Fatalf("source reads=%d want=%d", source.gets, tt.wantSource)
+			}
+			if cache.upserts != tt.wantFill {
+				t.Fatalf("cache fills=%d want=%d", cache.upserts, tt.wantFill)
+			}
+		})
+	}
+}
+
+func TestReadThrough_WritesInvalidateCache(t *testing.T) {
+	cache, source := newFakeBackend(), newFakeBackend()
+	rt := NewReadThrough(cache, source)
+
+	tok := Token{APIKey: "k1", RateLimit: 5, ExpiresAt: time.Now().Add(time.Hour)}
+	cache.tokens[tok.APIKey] = tok
+
+	tok.RateLimit = 50
+	if err := rt.Upsert(context.Background(), tok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cache.tokens[tok.APIKey]; ok {
+		t.Fatalf("stale cache entry kept after upsert")
+	}
+
+	got, err := rt.GetToken(context.Background(), tok.APIKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.RateLimit != 50 {
+		t.Fatalf("rate_limit=%d want=50", got.RateLimit)
+	}
+
+	if err := rt.Delete(context.Background(), tok.APIKey); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cache.tokens) != 0 || len(source.tokens) != 0 {
+		t.Fatalf("token left after delete: cache=%v source=%v", cache.tokens, source.tokens)
+	}
+}
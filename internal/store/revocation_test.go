@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRevocations(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+	rv := NewRevocations(rdb, "")
+	rv.now = func() time.Time { return now }
+
+	if err := rv.RevokeToken(ctx, "jti-1", now.Add(-time.Second)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("err=%v want ErrExpired for an expired token", err)
+	}
+	if err := rv.RevokeToken(ctx, "jti-1", now.Add(time.Hour)); err != nil {
+		t.Fatalf("revoke token: %v", err)
+	}
+	if ttl := mr.TTL("revoked:jti:jti-1"); ttl != time.Hour {
+		t.Fatalf("ttl=%v want the token's remaining lifetime", ttl)
+	}
+	if err := rv.RevokeKey(ctx, "k1", now.Add(24*time.Hour)); err != nil {
+		t.Fatalf("revoke key: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		jti      string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"revoked jti", "k2", "jti-1", now, true},
+		{"other jti", "k2", "jti-2", now, false},
+		{"issued before the key was revoked", "k1", "", now.Add(-time.Minute), true},
+		{"issued in the second of the revocation", "k1", "jti-2", now, true},
+		{"issued after", "k1", "jti-2", now.Add(time.Second), false},
+		{"no iat", "k1", "", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rv.Revoked(ctx, tt.apiKey, tt.jti, tt.issuedAt)
+			if err != nil || got != tt.want {
+				t.Fatalf("revoked=%v err=%v want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	mr.FastForward(time.Hour)
+	if got, err := rv.Revoked(ctx, "k2", "jti-1", now); err != nil || got {
+		t.Fatalf("revoked=%v err=%v want the entry gone with the token's exp", got, err)
+	}
+}
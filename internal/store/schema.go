@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// schemaScanBatch is the SCAN COUNT hint of CheckSchema; schemaMaxScans bounds the SCAN calls, so a
+// keyspace where the prefix is rare cannot keep the check running.
+const (
+	schemaScanBatch = 100
+	schemaMaxScans  = 100
+)
+
+// profileFields are the hash fields Upsert writes.
+var profileFields = []string{
+	"api_key", "rate_limit", "expires_at", "allowed_routes", "tier", "plan", "tenant", "dry_run",
+	"signing_secret", "status", "disabled", "burst",
+}
+
+// SchemaReport is what CheckSchema found in a sample of the keys under the token prefix.
+type SchemaReport struct {
+	Sampled int
+	// Invalid counts profiles that do not decode with the current schema, by reason. Their keys are not
+	// kept: they carry API keys.
+	Invalid map[string]int
+	// UnknownFields counts profile fields the current schema does not know, by field.
+	UnknownFields map[string]int
+	// Foreign lists keys under the prefix that are not hashes, e.g. another service sharing the prefix.
+	Foreign []string
+}
+
+// OK reports whether the sample matched the current schema.
+func (r SchemaReport) OK() bool {
+	return len(r.Invalid) == 0 && len(r.UnknownFields) == 0 && len(r.Foreign) == 0
+}
+
+// CheckSchema decodes up to sample profiles under the prefix with the current schema, so data written by
+// another version or another service is reported at startup instead of as unknown tokens under load.
+func (s *Store) CheckSchema(ctx context.Context, sample int) (SchemaReport, error) {
+	report := SchemaReport{Invalid: map[string]int{}, UnknownFields: map[string]int{}}
+
+	keys, err := sampleKeys(ctx, s.rdcl, s.prefix+"*", sample)
+	if err != nil || len(keys) == 0 {
+		return report, err
+	}
+
+	pipe := s.rdcl.Pipeline()
+	types := make([]*redis.StatusCmd, len(keys))
+	for i, k := range keys {
+		types[i] = pipe.Type(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return report, err
+	}
+
+	pipe = s.rdcl.Pipeline()
+	profiles := make([]*redis.MapStringStringCmd, len(keys))
+	for i, k := range keys {
+		switch types[i].Val() {
+		case "hash":
+			profiles[i] = pipe.HGetAll(ctx, k)
+		case "none": // expired since the scan
+		default:
+			report.Foreign = append(report.Foreign, k)
+		}
+	}
+	_, _ = pipe.Exec(ctx) // errors are checked per key
+
+	for i, k := range keys {
+		if profiles[i] == nil {
+			continue
+		}
+		m, err := profiles[i].Result()
+		var rerr redis.Error
+		if err != nil && !errors.As(err, &rerr) {
+			return report, err
+		}
+		if len(m) == 0 {
+			continue
+		}
+
+		report.Sampled++
+		if _, err := decodeToken(k[len(s.prefix):], m); err != nil {
+			report.Invalid[err.Error()]++
+		}
+		for field := range m {
+			if !slices.Contains(profileFields, field) {
+				report.UnknownFields[field]++
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// sampleKeys returns up to n keys matching pattern.
+func sampleKeys(ctx context.Context, rdcl redis.UniversalClient, pattern string, n int) ([]string, error) {
+	var out []string
+
+	var cursor uint64
+	for range schemaMaxScans {
+		keys, next, err := rdcl.Scan(ctx, cursor, pattern, schemaScanBatch).Result()
+		if err != nil {
+			return out, err
+		}
+		out = append(out, keys...)
+
+		cursor = next
+		if cursor == 0 || len(out) >= n {
+			break
+		}
+	}
+
+	return out[:min(len(out), n)], nil
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStore_CheckSchema(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	st := NewStore(rdb, "token:")
+
+	if err := st.Upsert(ctx, Token{APIKey: "good", RateLimit: 10, ExpiresAt: time.Now().Add(time.Hour), Tier: "gold"}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	report, err := st.CheckSchema(ctx, 100)
+	if err != nil || !report.OK() || report.Sampled != 1 {
+		t.Fatalf("report=%+v err=%v want one matching profile", report, err)
+	}
+
+	mr.HSet("token:old", "api_key", "old", "expires_at", "2030-01-01", "quota", "5")
+	mr.HSet("token:newer", "api_key", "newer", "expires_at", "2030-01-01T00:00:00Z", "quota", "5")
+	_ = mr.Set("token:session:1", "other service")
+	mr.HSet("token_idx:plan:x", "not", "scanned")
+
+	report, err = st.CheckSchema(ctx, 100)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if report.Sampled != 3 || len(report.Invalid) != 1 || report.UnknownFields["quota"] != 2 {
+		t.Fatalf("report=%+v want 3 sampled, one invalid, quota unknown twice", report)
+	}
+	if !slices.Equal(report.Foreign, []string{"token:session:1"}) {
+		t.Fatalf("foreign=%v want the string key", report.Foreign)
+	}
+
+	if report, err := st.CheckSchema(ctx, 1); err != nil || report.Sampled+len(report.Foreign) != 1 {
+		t.Fatalf("report=%+v err=%v want a sample of one key", report, err)
+	}
+}
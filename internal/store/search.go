@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const searchScanBatch = 500
+
+// Query selects token profiles; zero fields match every token.
+type Query struct {
+	// Route is a path or a pattern ending in "*"; it matches tokens whose allowed_routes let them call
+	// any path it covers, including tokens without allowed_routes.
+	Route  string
+	Plan   string
+	Tenant string
+
+	ExpiringAfter  time.Time
+	ExpiringBefore time.Time
+
+	// Limit caps the tokens returned; 0 returns all.
+	Limit int
+}
+
+func (q Query) matches(t Token) bool {
+	if q.Plan != "" && t.Plan != q.Plan {
+		return false
+	}
+	if q.Tenant != "" && t.Tenant != q.Tenant {
+		return false
+	}
+	if !q.ExpiringAfter.IsZero() && !t.ExpiresAt.After(q.ExpiringAfter) {
+		return false
+	}
+	if !q.ExpiringBefore.IsZero() && !t.ExpiresAt.Before(q.ExpiringBefore) {
+		return false
+	}
+	if q.Route != "" && len(t.AllowedRoutes) > 0 && !RouteOverlaps(q.Route, t.AllowedRoutes) {
+		return false
+	}
+
+	return true
+}
+
+// Search returns the live token profiles matching q, soonest to expire first. It reads the candidates the
+// plan, tenant and expiry indexes offer, so tokens written before the indexes existed need Reindex first.
+// truncated reports that q.Limit cut the result short.
+func (s *Store) Search(ctx context.Context, q Query) (tokens []Token, truncated bool, err error) {
+	apiKeys, err := s.candidates(ctx, q)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := s.now()
+	found := make(map[string]bool, len(apiKeys))
+	for batch := range slices.Chunk(apiKeys, searchScanBatch) {
+		keys := make([]string, len(batch))
+		for i, k := range batch {
+			keys[i] = s.key(k)
+		}
+		profiles, err := s.profiles(ctx, keys, now)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, t := range profiles {
+			found[t.APIKey] = true
+			if q.matches(t) {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	s.pruneIndexes(ctx, q, apiKeys, found)
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].ExpiresAt.Equal(tokens[j].ExpiresAt) {
+			return tokens[i].ExpiresAt.Before(tokens[j].ExpiresAt)
+		}
+		return tokens[i].APIKey < tokens[j].APIKey
+	})
+	if q.Limit > 0 && len(tokens) > q.Limit {
+		return tokens[:q.Limit], true, nil
+	}
+
+	return tokens, false, nil
+}
+
+// pruneIndexes drops the candidates of q without a live profile from the indexes q read. Best effort:
+// a failure only leaves them for the next search.
+func (s *Store) pruneIndexes(ctx context.Context, q Query, apiKeys []string, found map[string]bool) {
+	var gone []any
+	for _, k := range apiKeys {
+		if !found[k] {
+			gone = append(gone, k)
+		}
+	}
+	if len(gone) == 0 {
+		return
+	}
+
+	pipe := s.rdcl.Pipeline()
+	pipe.ZRem(ctx, ExpiryIndex(s.prefix), gone...)
+	if q.Plan != "" {
+		pipe.SRem(ctx, PlanIndex(s.prefix, q.Plan), gone...)
+	}
+	if q.Tenant != "" {
+		pipe.SRem(ctx, TenantIndex(s.prefix, q.Tenant), gone...)
+	}
+	_, _ = pipe.Exec(ctx)
+}
+
+// RouteOverlaps reports whether some path matched by route is allowed by patterns, which take the
+// allowed_routes forms: exact paths, prefixes ending in "*", or "*" alone.
+func RouteOverlaps(route string, patterns []string) bool {
+	route = strings.TrimSpace(route)
+	rp, rWild := strings.CutSuffix(route, "*")
+
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		pp, pWild := strings.CutSuffix(p, "*")
+
+		switch {
+		case pWild && rWild:
+			if strings.HasPrefix(rp, pp) || strings.HasPrefix(pp, rp) {
+				return true
+			}
+		case pWild:
+			if strings.HasPrefix(route, pp) {
+				return true
+			}
+		case rWild:
+			if strings.HasPrefix(p, rp) {
+				return true
+			}
+		case p == route:
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRouteOverlaps(t *testing.T) {
+	tests := []struct {
+		route    string
+		patterns []string
+		want     bool
+	}{
+		{"/api/v1/orders", []string{"/api/v1/orders"}, true},
+		{"/api/v1/orders", []string{"/api/v1/order"}, false},
+		{"/api/v1/orders/1", []string{"/api/v1/orders*"}, true},
+		{"/api/v1/orders*", []string{"/api/v1/orders/1"}, true},
+		{"/api/v1/orders*", []string{"/api/v1/*"}, true},
+		{"/api/v1/*", []string{"/api/v1/orders*"}, true},
+		{"/api/v1/orders*", []string{"/api/v1/users*", "/api/v2/orders"}, false},
+		{"/api/v1/orders", []string{"*"}, true},
+		{"/api/v1/orders", []string{" ", ""}, false},
+	}
+
+	for _, tt := range tests {
+		if got := RouteOverlaps(tt.route, tt.patterns); got != tt.want {
+			t.Errorf("RouteOverlaps(%q, %q)=%v want %v", tt.route, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestStore_Search(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	st := NewStore(rdb, "token:")
+	for _, tok := range []Token{
+		{APIKey: "orders", ExpiresAt: now.Add(2 * time.Hour), AllowedRoutes: []string{"/api/v1/orders*"}, Plan: "gold", Tenant: "acme"},
+		{APIKey: "users", ExpiresAt: now.Add(time.Hour), AllowedRoutes: []string{"/api/v1/users"}, Tenant: "acme"},
+		{APIKey: "any", ExpiresAt: now.Add(48 * time.Hour), Plan: "gold"},
+	} {
+		if err := st.Upsert(ctx, tok); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+	}
+	// indexed, but its profile is gone
+	mr.ZAdd("token_idx:expiry", float64(now.Add(time.Hour).Unix()), "gone")
+	mr.SAdd("token_idx:plan:gold", "gone")
+
+	tests := []struct {
+		name          string
+		q             Query
+		want          []string
+		wantTruncated bool
+	}{
+		{"all, soonest expiry first", Query{}, []string{"users", "orders", "any"}, false},
+		{"route", Query{Route: "/api/v1/orders/42"}, []string{"orders", "any"}, false},
+		{"plan", Query{Plan: "gold"}, []string{"orders", "any"}, false},
+		{"tenant", Query{Tenant: "acme"}, []string{"users", "orders"}, false},
+		{"plan and tenant", Query{Plan: "gold", Tenant: "acme"}, []string{"orders"}, false},
+		{"expiring before", Query{ExpiringBefore: now.Add(24 * time.Hour)}, []string{"users", "orders"}, false},
+		{"expiring after", Query{ExpiringAfter: now.Add(90 * time.Minute)}, []string{"orders", "any"}, false},
+		{"limit", Query{Limit: 1}, []string{"users"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, truncated, err := st.Search(ctx, tt.q)
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			var got []string
+			for _, tok := range tokens {
+				got = append(got, tok.APIKey)
+			}
+			if len(got) != len(tt.want) || truncated != tt.wantTruncated {
+				t.Fatalf("tokens=%v truncated=%v want %v %v", got, truncated, tt.want, tt.wantTruncated)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("tokens=%v want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	if ok, _ := mr.SIsMember("token_idx:plan:gold", "gone"); ok {
+		t.Fatalf("search left the gone token in the plan index")
+	}
+	if members, _ := mr.ZMembers("token_idx:expiry"); len(members) != 3 {
+		t.Fatalf("search left the gone token in the expiry index")
+	}
+}
+
+func TestStore_Indexes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	exp := time.Now().Add(time.Hour)
+	st := NewStore(rdb, "token:")
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, Plan: "gold", Tenant: "acme"}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, Plan: "silver"}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	members := func(key string) []string {
+		m, _ := mr.Members(key)
+		return m
+	}
+	if len(members("token_idx:plan:gold")) != 0 || len(members("token_idx:tenant:acme")) != 0 ||
+		len(members("token_idx:plan:silver")) != 1 {
+		t.Fatalf("plan and tenant indexes not moved with the profile")
+	}
+	if score, err := mr.ZScore("token_idx:expiry", "k"); err != nil || score != float64(exp.Unix()) {
+		t.Fatalf("expiry score=%v err=%v want %d", score, err, exp.Unix())
+	}
+
+	if err := st.Delete(ctx, "k"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if len(members("token_idx:plan:silver")) != 0 || mr.Exists("token_idx:expiry") {
+		t.Fatalf("delete left index entries")
+	}
+
+	// written without the store, as by older tools
+	mr.HSet("token:legacy", "api_key", "legacy", "expires_at", exp.UTC().Format(time.RFC3339), "plan", "gold")
+	mr.Set("token:broken", "not a hash")
+	n, err := st.Reindex(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("reindex=%d err=%v want 1", n, err)
+	}
+	if tokens, _, _ := st.Search(ctx, Query{Plan: "gold"}); len(tokens) != 1 || tokens[0].APIKey != "legacy" {
+		t.Fatalf("tokens=%+v want the reindexed token", tokens)
+	}
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const snapshotScanBatch = 500
+
+// snapshotMagic prefixes snapshot files so a wrong file is told apart from a wrong key.
+var snapshotMagic = []byte("TYKSNAP1")
+
+// Snapshot periodically copies all token profiles from Redis into an AES-GCM encrypted local file
+// and serves them read-only, so auth decisions can continue while Redis is down.
+type Snapshot struct {
+	rdcl   redis.UniversalClient
+	prefix string
+	path   string
+	aead   cipher.AEAD
+
+	tokens atomic.Pointer[map[string]Token]
+
+	// for tests
+	now func() time.Time
+}
+
+// NewSnapshot creates a snapshot of prefix-keyed profiles stored at path. key must be 32 bytes (AES-256).
+func NewSnapshot(rdcl redis.UniversalClient, prefix, path string, key []byte) (*Snapshot, error) {
+	if len(key) != 32 {
+		return nil, errors.New("snapshot: key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix == "" {
+		prefix = "token:"
+	}
+
+	return &Snapshot{
+		rdcl:   rdcl,
+		prefix: prefix,
+		path:   path,
+		aead:   aead,
+		now:    func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// Load reads the snapshot file written by an earlier Save, if there is one.
+func (s *Snapshot) Load() error {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !bytes.HasPrefix(b, snapshotMagic) {
+		return errors.New("snapshot: not a snapshot file")
+	}
+	b = b[len(snapshotMagic):]
+
+	ns := s.aead.NonceSize()
+	if len(b) < ns {
+		return errors.New("snapshot: file truncated")
+	}
+	plain, err := s.aead.Open(nil, b[:ns], b[ns:], snapshotMagic)
+	if err != nil {
+		return fmt.Errorf("snapshot: decrypt: %w", err)
+	}
+
+	tokens := map[string]Token{}
+	if err := json.Unmarshal(plain, &tokens); err != nil {
+		return fmt.Errorf("snapshot: decode: %w", err)
+	}
+	s.tokens.Store(&tokens)
+
+	return nil
+}
+
+// Save copies the current profiles from Redis and replaces the file atomically.
+func (s *Snapshot) Save(ctx context.Context) (int, error) {
+	tokens := map[string]Token{}
+	now := s.now()
+
+	var cursor uint64
+	for {
+		keys, next, err := s.rdcl.Scan(ctx, cursor, s.prefix+"*", snapshotScanBatch).Result()
+		if err != nil {
+			return 0, err
+		}
+
+		if len(keys) > 0 {
+			pipe := s.rdcl.Pipeline()
+			cmds := make([]*redis.MapStringStringCmd, len(keys))
+			for i, k := range keys {
+				cmds[i] = pipe.HGetAll(ctx, k)
+			}
+			if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+				return 0, err
+			}
+
+			for i, k := range keys {
+				m := cmds[i].Val()
+				if len(m) == 0 {
+					continue
+				}
+				t, err := decodeToken(k[len(s.prefix):], m)
+				if err != nil || !t.ExpiresAt.After(now) {
+					continue
+				}
+				tokens[t.APIKey] = t
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	plain, err := json.Marshal(tokens)
+	if err != nil {
+		return 0, err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return 0, err
+	}
+	out := append(append(append([]byte{}, snapshotMagic...), nonce...), s.aead.Seal(nil, nonce, plain, snapshotMagic)...)
+
+	if err := writeFileAtomic(s.path, out); err != nil {
+		return 0, err
+	}
+	s.tokens.Store(&tokens)
+
+	return len(tokens), nil
+}
+
+// Run saves a snapshot every interval until ctx is done. Failed saves keep the previous snapshot.
+func (s *Snapshot) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		n, err := s.Save(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("token snapshot failed")
+		} else {
+			log.Debug().Int("tokens", n).Msg("token snapshot saved")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Loaded reports whether there is a snapshot to serve from.
+func (s *Snapshot) Loaded() bool {
+	return s.tokens.Load() != nil
+}
+
+func (s *Snapshot) GetToken(_ context.Context, apiKey string) (Token, error) {
+	tokens := s.tokens.Load()
+	if tokens == nil {
+		return Token{}, errors.New("snapshot: not loaded")
+	}
+
+	t, ok := (*tokens)[apiKey]
+	if !ok {
+		return Token{}, ErrNotFound
+	}
+	if !t.ExpiresAt.After(s.now()) {
+		return Token{}, ErrExpired
+	}
+
+	return t, nil
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Fallback reads from primary and, while active reports true, answers lookups that failed
+// for backend reasons from the snapshot instead. Writes always go to primary.
+type Fallback struct {
+	primary  Backend
+	snapshot *Snapshot
+	active   func() bool
+}
+
+func NewFallback(primary Backend, snapshot *Snapshot, active func() bool) *Fallback {
+	return &Fallback{primary: primary, snapshot: snapshot, active: active}
+}
+
+func (f *Fallback) GetToken(ctx context.Context, apiKey string) (Token, error) {
+	t, err := f.primary.GetToken(ctx, apiKey)
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) || errors.Is(err, ErrInvalid) {
+		return t, err
+	}
+
+	if !f.active() || !f.snapshot.Loaded() {
+		return Token{}, err
+	}
+
+	log.Debug().Err(err).Msg("token store failing, serving from snapshot")
+	return f.snapshot.GetToken(ctx, apiKey)
+}
+
+func (f *Fallback) Upsert(ctx context.Context, t Token) error {
+	return f.primary.Upsert(ctx, t)
+}
+
+func (f *Fallback) SetRateLimit(ctx context.Context, apiKey string, limit int) error {
+	return f.primary.SetRateLimit(ctx, apiKey, limit)
+}
+
+func (f *Fallback) Delete(ctx context.Context, apiKey string) error {
+	return f.primary.Delete(ctx, apiKey)
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSnapshot_SaveLoad(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	st := NewStore(rdb, "token:")
+	for _, k := range []string{"a", "b"} {
+		err := st.Upsert(ctx, Token{APIKey: k, RateLimit: 5, ExpiresAt: time.Now().Add(time.Hour), AllowedRoutes: []string{"/api/v1/*"}})
+		if err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+	}
+	// not a token profile
+	mr.Set("token_last_used", "x")
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	path := filepath.Join(t.TempDir(), "tokens.snap")
+
+	snap, err := NewSnapshot(rdb, "token:", path, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n, err := snap.Save(ctx)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("saved=%d want=2", n)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if len(raw) == 0 || bytes.Contains(raw, []byte("/api/v1/*")) {
+		t.Fatalf("snapshot file is not encrypted")
+	}
+
+	restored, err := NewSnapshot(nil, "token:", path, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := restored.Load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	tok, err := restored.GetToken(ctx, "a")
+	if err != nil || tok.RateLimit != 5 || len(tok.AllowedRoutes) != 1 {
+		t.Fatalf("token=%+v err=%v", tok, err)
+	}
+	if _, err := restored.GetToken(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err=%v want=%v", err, ErrNotFound)
+	}
+
+	wrongKey, _ := NewSnapshot(nil, "token:", path, []byte("fedcba9876543210fedcba9876543210"))
+	if err := wrongKey.Load(); err == nil {
+		t.Fatalf("snapshot opened with the wrong key")
+	}
+}
+
+func TestFallback_GetToken(t *testing.T) {
+	snap, err := NewSnapshot(nil, "token:", filepath.Join(t.TempDir(), "s"), make([]byte, 32))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	primary := newFakeBackend()
+	primary.getErr = errors.New("connection refused")
+
+	active := false
+	fb := NewFallback(primary, snap, func() bool { return active })
+
+	if _, err := fb.GetToken(context.Background(), "a"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("err=%v want backend error while inactive", err)
+	}
+
+	// active, but nothing loaded yet: the backend error stands
+	active = true
+	if _, err := fb.GetToken(context.Background(), "a"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("err=%v want backend error without snapshot", err)
+	}
+
+	snap.tokens.Store(&map[string]Token{"a": {APIKey: "a", RateLimit: 3, ExpiresAt: time.Now().Add(time.Hour)}})
+	tok, err := fb.GetToken(context.Background(), "a")
+	if err != nil || tok.RateLimit != 3 {
+		t.Fatalf("token=%+v err=%v", tok, err)
+	}
+	if _, err := fb.GetToken(context.Background(), "b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err=%v want=%v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Schema creates the tokens table used by SQLStore. Placeholders and types are PostgreSQL. Tables from older
+// releases carry tokens_rate_limit_check, which rejected unlimited (-1) tokens; it is replaced by
+// tokens_rate_limit_min once, so later starts leave the constraints alone.
+const Schema = `
+CREATE TABLE IF NOT EXISTS tokens (
+	api_key        TEXT PRIMARY KEY,
+	rate_limit     INTEGER NOT NULL DEFAULT 0 CONSTRAINT tokens_rate_limit_min CHECK (rate_limit >= -1),
+	allowed_routes JSONB NOT NULL DEFAULT '[]',
+	expires_at     TIMESTAMPTZ NOT NULL,
+	tier           TEXT NOT NULL DEFAULT '',
+	signing_secret TEXT NOT NULL DEFAULT '',
+	plan           TEXT NOT NULL DEFAULT '',
+	dry_run        BOOLEAN NOT NULL DEFAULT false,
+	tenant         TEXT NOT NULL DEFAULT '',
+	status         TEXT NOT NULL DEFAULT '',
+	disabled       BOOLEAN NOT NULL DEFAULT false,
+	burst          INTEGER NOT NULL DEFAULT 0 CHECK (burst >= 0),
+	updated_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS signing_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS plan TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS dry_run BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS burst INTEGER NOT NULL DEFAULT 0 CHECK (burst >= 0);
+ALTER TABLE tokens DROP CONSTRAINT IF EXISTS tokens_rate_limit_check;
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'tokens'::regclass AND conname = 'tokens_rate_limit_min') THEN
+		ALTER TABLE tokens ADD CONSTRAINT tokens_rate_limit_min CHECK (rate_limit >= -1) NOT VALID;
+		ALTER TABLE tokens VALIDATE CONSTRAINT tokens_rate_limit_min;
+	END IF;
+END $$`
+
+// SQLStore keeps token profiles in PostgreSQL so they survive Redis flushes.
+type SQLStore struct {
+	db *sql.DB
+
+	// for tests
+	now func() time.Time
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{
+		db:  db,
+		now: func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Migrate creates the tokens table if it does not exist.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, Schema)
+	return err
+}
+
+func (s *SQLStore) Upsert(ctx context.Context, t Token) error {
+	if t.APIKey == "" {
+		return fmt.Errorf("%w: empty api_key", ErrInvalid)
+	}
+
+	if t.RateLimit < Unlimited {
+		return fmt.Errorf("%w: rate_limit must be >= 0, or %d for unlimited", ErrInvalid, Unlimited)
+	}
+
+	if t.ExpiresAt.IsZero() {
+		return fmt.Errorf("%w: expires_at is required", ErrInvalid)
+	}
+
+	if !validStatus(t.Status) {
+		return fmt.Errorf("%w: status must be %s or %s", ErrInvalid, StatusActive, StatusPaused)
+	}
+
+	if t.Burst < 0 {
+		return fmt.Errorf("%w: burst must be >= 0", ErrInvalid)
+	}
+
+	if !t.ExpiresAt.After(s.now()) {
+		return ErrExpired
+	}
+
+	routes := t.AllowedRoutes
+	if routes == nil {
+		routes = []string{}
+	}
+	ar, err := json.Marshal(routes)
+	if err != nil {
+		return fmt.Errorf("%w: allowed_routes marshal: %v", ErrInvalid, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO tokens (api_key, rate_limit, allowed_routes, expires_at, tier, signing_secret, plan, dry_run, tenant, status, disabled, burst, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now())
+		ON CONFLICT (api_key) DO UPDATE SET
+			rate_limit = EXCLUDED.rate_limit,
+			allowed_routes = EXCLUDED.allowed_routes,
+			expires_at = EXCLUDED.expires_at,
+			tier = EXCLUDED.tier,
+			signing_secret = EXCLUDED.signing_secret,
+			plan = EXCLUDED.plan,
+			dry_run = EXCLUDED.dry_run,
+			tenant = EXCLUDED.tenant,
+			status = EXCLUDED.status,
+			disabled = EXCLUDED.disabled,
+			burst = EXCLUDED.burst,
+			updated_at = now()`,
+		t.APIKey, t.RateLimit, string(ar), t.ExpiresAt.UTC(), t.Tier, t.SigningSecret, t.Plan, t.DryRun, t.Tenant, t.Status, t.Disabled, t.Burst)
+
+	return err
+}
+
+func (s *SQLStore) GetToken(ctx context.Context, apiKey string) (Token, error) {
+	if apiKey == "" {
+		return Token{}, fmt.Errorf("%w: empty api_key", ErrInvalid)
+	}
+
+	var (
+		t      Token
+		routes []byte
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT api_key, rate_limit, allowed_routes, expires_at, tier, signing_secret, plan, dry_run, tenant, status, disabled, burst FROM tokens WHERE api_key = $1`, apiKey,
+	).Scan(&t.APIKey, &t.RateLimit, &routes, &t.ExpiresAt, &t.Tier, &t.SigningSecret, &t.Plan, &t.DryRun, &t.Tenant, &t.Status, &t.Disabled, &t.Burst)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, ErrNotFound
+	}
+	if err != nil {
+		return Token{}, err
+	}
+
+	t.ExpiresAt = t.ExpiresAt.UTC()
+	if t.RateLimit < Unlimited {
+		return Token{}, fmt.Errorf("%w: invalid rate_limit", ErrInvalid)
+	}
+	if !validStatus(t.Status) {
+		return Token{}, fmt.Errorf("%w: invalid status", ErrInvalid)
+	}
+
+	if len(routes) > 0 {
+		if err := json.Unmarshal(routes, &t.AllowedRoutes); err != nil {
+			return Token{}, fmt.Errorf("%w: invalid allowed_routes: %v", ErrInvalid, err)
+		}
+		if len(t.AllowedRoutes) == 0 {
+			t.AllowedRoutes = nil
+		}
+	}
+
+	// expired rows are kept for the operators' tooling; they are just not served
+	if !t.ExpiresAt.After(s.now()) {
+		return Token{}, ErrExpired
+	}
+
+	return t, nil
+}
+
+// SetRateLimit changes the rate limit of apiKey's unexpired profile only.
+func (s *SQLStore) SetRateLimit(ctx context.Context, apiKey string, limit int) error {
+	if apiKey == "" {
+		return fmt.Errorf("%w: empty api_key", ErrInvalid)
+	}
+	if limit < Unlimited {
+		return fmt.Errorf("%w: rate_limit must be >= 0, or %d for unlimited", ErrInvalid, Unlimited)
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE tokens SET rate_limit = $1, updated_at = now() WHERE api_key = $2 AND expires_at > $3`,
+		limit, apiKey, s.now().UTC())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, apiKey string) error {
+	if apiKey == "" {
+		return fmt.Errorf("%w: empty api_key", ErrInvalid)
+	}
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM tokens WHERE api_key = $1`, apiKey)
+	return err
+}
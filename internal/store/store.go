@@ -12,11 +12,47 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Token is a stored token profile. RateLimit 0 means the token inherits the route or global limit, Unlimited
+// that its requests are not rate limited.
 type Token struct {
 	APIKey        string    `json:"api_key"`
 	RateLimit     int       `json:"rate_limit"`
 	ExpiresAt     time.Time `json:"expires_at"`
 	AllowedRoutes []string  `json:"allowed_routes"`
+	Tier          string    `json:"tier,omitempty"`
+	// Plan names a config plan whose limits apply where the profile sets none.
+	Plan string `json:"plan,omitempty"`
+	// DryRun lets the token's requests through its scopes and rate limits, logging would-be denials.
+	DryRun bool `json:"dry_run,omitempty"`
+	// Tenant groups the tokens of one customer for operators' queries.
+	Tenant string `json:"tenant,omitempty"`
+	// SigningSecret keys the HMAC of signed URLs issued for the token; empty means it cannot use them.
+	SigningSecret string `json:"signing_secret,omitempty"`
+	// Status is active (empty) or paused; a paused token is refused until resumed, keeping its profile.
+	Status string `json:"status,omitempty"`
+	// Disabled refuses the token's requests as unauthorized. Profiles written when a rate_limit of 0 meant
+	// disabled are read back with it set.
+	Disabled bool `json:"disabled,omitempty"`
+	// Burst is how many requests the token may make at once with the token_bucket algorithm, on top of
+	// refilling at its rate limit; 0 means a burst of the rate limit.
+	Burst int `json:"burst,omitempty"`
+}
+
+// Unlimited is the RateLimit of a token exempt from rate limiting.
+const Unlimited = -1
+
+const (
+	StatusActive = "active"
+	StatusPaused = "paused"
+)
+
+// Paused reports whether the token is refused until an operator resumes it.
+func (t Token) Paused() bool {
+	return t.Status == StatusPaused
+}
+
+func validStatus(status string) bool {
+	return status == "" || status == StatusActive || status == StatusPaused
 }
 
 var (
@@ -29,6 +65,9 @@ type Store struct {
 	rdcl   redis.UniversalClient
 	prefix string
 
+	// client for token reads, e.g. a replica; defaults to rdcl
+	reader func() redis.UniversalClient
+
 	// for tests
 	now func() time.Time
 }
@@ -36,6 +75,9 @@ type Store struct {
 type Options struct {
 	Prefix string
 
+	// Reader picks the client for token reads (e.g. a healthy replica).
+	Reader func() redis.UniversalClient
+
 	// for tests
 	Now func() time.Time
 }
@@ -45,11 +87,14 @@ func NewStore(rdcl redis.UniversalClient, pfx string) *Store {
 		pfx = "token:"
 	}
 
-	return &Store{
+	s := &Store{
 		rdcl:   rdcl,
 		prefix: pfx,
 		now:    func() time.Time { return time.Now().UTC() },
 	}
+	s.reader = func() redis.UniversalClient { return s.rdcl }
+
+	return s
 }
 
 func (s *Store) WithOptions(opts *Options) {
@@ -59,6 +104,10 @@ func (s *Store) WithOptions(opts *Options) {
 	}
 
 	s.now = now
+
+	if opts.Reader != nil {
+		s.reader = opts.Reader
+	}
 }
 
 func (s *Store) key(apiKey string) string {
@@ -70,14 +119,22 @@ func (s *Store) Upsert(ctx context.Context, t Token) error {
 		return fmt.Errorf("%w: empty api_key", ErrInvalid)
 	}
 
-	if t.RateLimit <= 0 {
-		return fmt.Errorf("%w: rate_limit must be > 0", ErrInvalid)
+	if t.RateLimit < Unlimited {
+		return fmt.Errorf("%w: rate_limit must be >= 0, or %d for unlimited", ErrInvalid, Unlimited)
 	}
 
 	if t.ExpiresAt.IsZero() {
 		return fmt.Errorf("%w: expires_at is required", ErrInvalid)
 	}
 
+	if !validStatus(t.Status) {
+		return fmt.Errorf("%w: status must be %s or %s", ErrInvalid, StatusActive, StatusPaused)
+	}
+
+	if t.Burst < 0 {
+		return fmt.Errorf("%w: burst must be >= 0", ErrInvalid)
+	}
+
 	now := s.now()
 	if !t.ExpiresAt.After(now) {
 		return ErrExpired
@@ -90,15 +147,50 @@ func (s *Store) Upsert(ctx context.Context, t Token) error {
 
 	key := s.key(t.APIKey)
 
-	pipe := s.rdcl.TxPipeline()
-	pipe.HSet(ctx, key, map[string]any{
+	fields := map[string]any{
 		"api_key":        t.APIKey,
-		"rate_limit":     strconv.Itoa(t.RateLimit),
 		"expires_at":     t.ExpiresAt.UTC().Format(time.RFC3339),
 		"allowed_routes": string(ar), // JSON array
-	})
+	}
+	if t.RateLimit != 0 {
+		fields["rate_limit"] = strconv.Itoa(t.RateLimit)
+	}
+	if t.Tier != "" {
+		fields["tier"] = t.Tier
+	}
+	if t.Plan != "" {
+		fields["plan"] = t.Plan
+	}
+	if t.Tenant != "" {
+		fields["tenant"] = t.Tenant
+	}
+	if t.DryRun {
+		fields["dry_run"] = "true"
+	}
+	if t.SigningSecret != "" {
+		fields["signing_secret"] = t.SigningSecret
+	}
+	if t.Paused() {
+		fields["status"] = StatusPaused
+	}
+	if t.Disabled {
+		fields["disabled"] = "true"
+	}
+	if t.Burst != 0 {
+		fields["burst"] = strconv.Itoa(t.Burst)
+	}
+
+	old, err := s.indexed(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdcl.TxPipeline()
+	pipe.Del(ctx, key) // fields left out above must not survive from an older profile
+	pipe.HSet(ctx, key, fields)
 
 	pipe.ExpireAt(ctx, key, t.ExpiresAt.UTC()) // auto-expire
+	s.index(ctx, pipe, t, old)
 	_, err = pipe.Exec(ctx)
 	if err != nil {
 		return err
@@ -113,9 +205,10 @@ func (s *Store) GetToken(ctx context.Context, apiKey string) (Token, error) {
 	}
 
 	key := s.key(apiKey)
-	log.Debug().Str("key", key).Msg("getting token")
+	// the key holds the raw api key, which must not reach the logs
+	log.Debug().Msg("getting token")
 
-	m, err := s.rdcl.HGetAll(ctx, key).Result()
+	m, err := s.reader().HGetAll(ctx, key).Result()
 	if err != nil {
 		return Token{}, err
 	}
@@ -137,11 +230,55 @@ func (s *Store) GetToken(ctx context.Context, apiKey string) (Token, error) {
 	return t, nil
 }
 
+// setRateLimitScript changes the rate_limit field of an existing profile only; a 0 limit removes the field, which
+// means inherit. It returns 0 when the profile does not exist.
+var setRateLimitScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if ARGV[1] == '0' then
+	redis.call('HDEL', KEYS[1], 'rate_limit')
+else
+	redis.call('HSET', KEYS[1], 'rate_limit', ARGV[1])
+end
+return 1
+`)
+
+// SetRateLimit changes the rate limit of apiKey's profile without rewriting its other fields, so it cannot undo
+// a concurrent change to them.
+func (s *Store) SetRateLimit(ctx context.Context, apiKey string, limit int) error {
+	if apiKey == "" {
+		return fmt.Errorf("%w: empty api_key", ErrInvalid)
+	}
+	if limit < Unlimited {
+		return fmt.Errorf("%w: rate_limit must be >= 0, or %d for unlimited", ErrInvalid, Unlimited)
+	}
+
+	found, err := setRateLimitScript.Run(ctx, s.rdcl, []string{s.key(apiKey)}, strconv.Itoa(limit)).Int()
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 func (s *Store) Delete(ctx context.Context, apiKey string) error {
 	if apiKey == "" {
 		return fmt.Errorf("%w: empty api_key", ErrInvalid)
 	}
-	_, err := s.rdcl.Del(ctx, s.key(apiKey)).Result()
+	key := s.key(apiKey)
+	old, err := s.indexed(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdcl.TxPipeline()
+	pipe.Del(ctx, key)
+	s.unindex(ctx, pipe, apiKey, old)
+	_, err = pipe.Exec(ctx)
 	return err
 }
 
@@ -154,16 +291,16 @@ func decodeToken(apiKey string, m map[string]string) (Token, error) {
 		t.APIKey = v
 	}
 
-	rls := m["rate_limit"]
-	if rls == "" {
-		return Token{}, fmt.Errorf("%w: missing rate_limit", ErrInvalid)
-	}
-
-	rl, err := strconv.Atoi(rls)
-	if err != nil || rl <= 0 {
-		return Token{}, fmt.Errorf("%w: invalid rate_limit", ErrInvalid)
+	// a missing rate_limit inherits the route or global limit. Upsert never writes a 0: one stored by an older
+	// version disabled the token, and still does.
+	if rls := m["rate_limit"]; rls != "" {
+		rl, err := strconv.Atoi(rls)
+		if err != nil || rl < Unlimited {
+			return Token{}, fmt.Errorf("%w: invalid rate_limit", ErrInvalid)
+		}
+		t.RateLimit = rl
+		t.Disabled = rl == 0
 	}
-	t.RateLimit = rl
 
 	exps := m["expires_at"]
 	if exps == "" {
@@ -176,6 +313,30 @@ func decodeToken(apiKey string, m map[string]string) (Token, error) {
 	}
 
 	t.ExpiresAt = exp.UTC()
+	t.Tier = m["tier"]
+	t.Plan = m["plan"]
+	t.Tenant = m["tenant"]
+	if v := m["dry_run"]; v != "" {
+		if t.DryRun, err = strconv.ParseBool(v); err != nil {
+			return Token{}, fmt.Errorf("%w: invalid dry_run", ErrInvalid)
+		}
+	}
+	t.SigningSecret = m["signing_secret"]
+	if v := m["disabled"]; v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Token{}, fmt.Errorf("%w: invalid disabled", ErrInvalid)
+		}
+		t.Disabled = t.Disabled || disabled
+	}
+	if v := m["burst"]; v != "" {
+		if t.Burst, err = strconv.Atoi(v); err != nil || t.Burst < 0 {
+			return Token{}, fmt.Errorf("%w: invalid burst", ErrInvalid)
+		}
+	}
+	if t.Status = m["status"]; !validStatus(t.Status) {
+		return Token{}, fmt.Errorf("%w: invalid status", ErrInvalid)
+	}
 
 	routes := m["allowed_routes"]
 	if routes == "" {
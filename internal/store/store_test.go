@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStore_Status(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	st := NewStore(rdb, "token:")
+	exp := time.Now().Add(time.Hour)
+
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, Status: "frozen"}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err=%v want ErrInvalid for an unknown status", err)
+	}
+
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, Status: StatusPaused}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if tok, err := st.GetToken(ctx, "k"); err != nil || !tok.Paused() {
+		t.Fatalf("token=%+v err=%v want paused", tok, err)
+	}
+
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if tok, err := st.GetToken(ctx, "k"); err != nil || tok.Paused() || mr.HGet("token:k", "status") != "" {
+		t.Fatalf("token=%+v err=%v want active without a status field", tok, err)
+	}
+}
+
+func TestStore_DisabledAndUnlimited(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	st := NewStore(rdb, "token:")
+	exp := time.Now().Add(time.Hour)
+
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, RateLimit: -2}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err=%v want ErrInvalid below unlimited", err)
+	}
+
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, RateLimit: Unlimited}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if tok, err := st.GetToken(ctx, "k"); err != nil || tok.RateLimit != Unlimited || tok.Disabled {
+		t.Fatalf("token=%+v err=%v want unlimited", tok, err)
+	}
+
+	// a rate_limit of 0 stored by an older version meant disabled
+	mr.HSet("token:legacy", "api_key", "legacy", "expires_at", exp.UTC().Format(time.RFC3339), "rate_limit", "0")
+	tok, err := st.GetToken(ctx, "legacy")
+	if err != nil || !tok.Disabled || tok.RateLimit != 0 {
+		t.Fatalf("token=%+v err=%v want disabled", tok, err)
+	}
+
+	// written back, it keeps the flag and inherits its limit when re-enabled
+	if err := st.Upsert(ctx, tok); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if mr.HGet("token:legacy", "rate_limit") != "" || mr.HGet("token:legacy", "disabled") != "true" {
+		t.Fatalf("profile not migrated: rate_limit=%q disabled=%q", mr.HGet("token:legacy", "rate_limit"), mr.HGet("token:legacy", "disabled"))
+	}
+	tok.Disabled = false
+	if err := st.Upsert(ctx, tok); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if tok, err := st.GetToken(ctx, "legacy"); err != nil || tok.Disabled {
+		t.Fatalf("token=%+v err=%v want enabled", tok, err)
+	}
+}
+
+func TestStore_Burst(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	st := NewStore(rdb, "token:")
+	exp := time.Now().Add(time.Hour)
+
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, Burst: -1}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err=%v want ErrInvalid for a negative burst", err)
+	}
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, RateLimit: 10, Burst: 50}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if tok, err := st.GetToken(ctx, "k"); err != nil || tok.Burst != 50 || mr.HGet("token:k", "burst") != "50" {
+		t.Fatalf("token=%+v err=%v want burst 50", tok, err)
+	}
+
+	mr.HSet("token:k", "burst", "many")
+	if _, err := st.GetToken(ctx, "k"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err=%v want ErrInvalid for a malformed burst", err)
+	}
+}
+
+func TestStore_SetRateLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx := context.Background()
+	st := NewStore(rdb, "token:")
+	exp := time.Now().Add(time.Hour)
+
+	if err := st.SetRateLimit(ctx, "k", 10); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err=%v want ErrNotFound for a missing profile", err)
+	}
+	if mr.Exists("token:k") {
+		t.Fatal("a missing profile must not be created")
+	}
+
+	if err := st.Upsert(ctx, Token{APIKey: "k", ExpiresAt: exp, RateLimit: 10, Plan: "pro", Burst: 50}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	ttl := mr.TTL("token:k")
+
+	if err := st.SetRateLimit(ctx, "k", Unlimited-1); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err=%v want ErrInvalid", err)
+	}
+	if err := st.SetRateLimit(ctx, "k", 20); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if tok, err := st.GetToken(ctx, "k"); err != nil || tok.RateLimit != 20 || tok.Plan != "pro" || tok.Burst != 50 {
+		t.Fatalf("token=%+v err=%v want rate_limit 20 with the other fields kept", tok, err)
+	}
+	if mr.TTL("token:k") != ttl {
+		t.Fatalf("ttl=%v want the profile's %v", mr.TTL("token:k"), ttl)
+	}
+
+	// 0 means inherit and is never stored
+	if err := st.SetRateLimit(ctx, "k", 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if tok, err := st.GetToken(ctx, "k"); err != nil || tok.RateLimit != 0 || tok.Disabled || mr.HGet("token:k", "rate_limit") != "" {
+		t.Fatalf("token=%+v err=%v want an inherited limit", tok, err)
+	}
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// trackingChannel is where Redis sends the invalidations of tracking redirected to a RESP2 connection.
+const trackingChannel = "__redis__:invalidate"
+
+type tokenCache interface {
+	Invalidate(apiKey string)
+	Purge()
+}
+
+// Tracking keeps the in-memory token cache consistent with Redis through server-assisted client-side caching.
+// Its subscription connection turns on CLIENT TRACKING in broadcast mode for the token prefix, redirected to
+// itself, so Redis reports every write to a token key, however it was made (admin API, token-gen, imports,
+// direct edits). Invalidations sent while the connection is down are lost, so the cache is purged whenever
+// the subscription is re-established.
+type Tracking struct {
+	prefix string
+	cache  tokenCache
+}
+
+func NewTracking(prefix string, cache tokenCache) *Tracking {
+	if prefix == "" {
+		prefix = "token:"
+	}
+
+	return &Tracking{prefix: prefix, cache: cache}
+}
+
+// OnConnect turns on tracking for a new connection of the subscription client, before it subscribes.
+func (t *Tracking) OnConnect(ctx context.Context, cn *redis.Conn) error {
+	id, err := cn.ClientID(ctx).Result()
+	if err != nil {
+		return fmt.Errorf("client id: %w", err)
+	}
+
+	err = cn.Do(ctx, "CLIENT", "TRACKING", "ON", "REDIRECT", id, "BCAST", "PREFIX", t.prefix).Err()
+	if err != nil {
+		return fmt.Errorf("client tracking: %w", err)
+	}
+
+	return nil
+}
+
+// Run receives invalidations until ctx is done. rdcl must open its connections with OnConnect.
+func (t *Tracking) Run(ctx context.Context, rdcl redis.UniversalClient) {
+	sub := rdcl.Subscribe(ctx, trackingChannel)
+	defer sub.Close()
+
+	// the subscription reconnects by itself, confirming the subscription again each time
+	ch := sub.ChannelWithSubscriptions()
+	subscribed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				log.Warn().Msg("token tracking subscription closed")
+				return
+			}
+			subscribed = t.handle(msg, subscribed)
+		}
+	}
+}
+
+// handle applies msg to the cache and reports whether the subscription has been confirmed before.
+func (t *Tracking) handle(msg any, subscribed bool) bool {
+	switch m := msg.(type) {
+	case *redis.Subscription:
+		if m.Kind != "subscribe" {
+			return subscribed
+		}
+		if subscribed {
+			// changes made while reconnecting went unreported
+			log.Warn().Msg("token tracking reconnected, token cache purged")
+			t.cache.Purge()
+		}
+		return true
+	case *redis.Message:
+		keys := m.PayloadSlice
+		if m.Payload != "" {
+			keys = append(keys, m.Payload)
+		}
+		for _, k := range keys {
+			if apiKey, ok := strings.CutPrefix(k, t.prefix); ok {
+				t.cache.Invalidate(apiKey)
+			}
+		}
+	}
+
+	return subscribed
+}
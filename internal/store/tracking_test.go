@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTracking_Handle(t *testing.T) {
+	now := time.Now()
+	next := newFakeBackend()
+	for _, k := range []string{"k1", "k2", "k3"} {
+		next.tokens[k] = Token{APIKey: k, RateLimit: 5, ExpiresAt: now.Add(time.Hour)}
+	}
+	cached := NewCachedStore(next, 10, time.Hour)
+	for _, k := range []string{"k1", "k2", "k3"} {
+		if _, err := cached.GetToken(context.Background(), k); err != nil {
+			t.Fatalf("get %s: %v", k, err)
+		}
+	}
+
+	tr := NewTracking("token:", cached)
+	subscribed := tr.handle(&redis.Subscription{Kind: "subscribe", Channel: trackingChannel, Count: 1}, false)
+	if !subscribed || cached.lru.Len() != 3 {
+		t.Fatalf("subscribed=%v cached=%d, first subscription must keep the cache", subscribed, cached.lru.Len())
+	}
+
+	// keys of other prefixes are reported too when another client tracks them
+	tr.handle(&redis.Message{Channel: trackingChannel, PayloadSlice: []string{"token:k1", "req_limit:k2"}}, subscribed)
+	if _, ok := cached.lru.Get("k1"); ok {
+		t.Fatalf("k1 still cached after invalidation")
+	}
+	if cached.lru.Len() != 2 {
+		t.Fatalf("cached=%d want=2", cached.lru.Len())
+	}
+
+	// a new subscription means invalidations may have been missed
+	tr.handle(&redis.Subscription{Kind: "subscribe", Channel: trackingChannel, Count: 1}, subscribed)
+	if cached.lru.Len() != 0 {
+		t.Fatalf("cached=%d want=0 after resubscribe", cached.lru.Len())
+	}
+}
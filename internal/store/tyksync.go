@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+)
+
+const (
+	syncImported  = "imported"
+	syncUnchanged = "unchanged"
+	syncSkipped   = "skipped"
+	syncError     = "error"
+	syncOK        = "ok"
+
+	tykMaxPageLen = 16 << 20
+	tykMaxPages   = 10000
+)
+
+// TykSync periodically imports the keys of a Tyk Dashboard into the token store, so clients can move to the
+// proxy with the keys they have. A key's rate, expiry and inactive flag come from Tyk; its allowed routes are
+// the routes configured for the Tyk APIs it has access to. Other fields of an existing profile are kept, and
+// keys removed from Tyk are not removed here.
+type TykSync struct {
+	next    Backend
+	cfg     config.TykSync
+	window  time.Duration
+	client  *http.Client
+	metrics *mp.Metrics
+
+	// for tests
+	now func() time.Time
+}
+
+// tykKeyPage is a page of GET /api/keys/detailed.
+type tykKeyPage struct {
+	Keys []struct {
+		KeyID string     `json:"key_id"`
+		Data  tykSession `json:"data"`
+	} `json:"keys"`
+	Pages int `json:"pages"`
+}
+
+// tykSession holds the fields of a Tyk session object the import uses.
+type tykSession struct {
+	Rate         float64 `json:"rate"`
+	Per          float64 `json:"per"`
+	Expires      int64   `json:"expires"` // unix seconds, 0 or less for never
+	IsInactive   bool    `json:"is_inactive"`
+	AccessRights map[string]struct {
+		APIID string `json:"api_id"`
+	} `json:"access_rights"`
+}
+
+// NewTykSync imports into next; window is the limiter window Tyk rates are converted to.
+func NewTykSync(next Backend, cfg config.TykSync, window time.Duration, metrics *mp.Metrics) *TykSync {
+	return &TykSync{
+		next:    next,
+		cfg:     cfg,
+		window:  window,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		metrics: metrics,
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run syncs every interval until ctx is done.
+func (s *TykSync) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		n, err := s.Sync(ctx)
+		if err != nil {
+			log.Warn().Err(err).Int("imported", n).Msg("tyk key sync failed")
+			s.metrics.IncTokenSync(syncError)
+		} else {
+			log.Debug().Int("imported", n).Msg("tyk keys synced")
+			s.metrics.IncTokenSync(syncOK)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sync imports every page of keys and returns how many profiles it wrote. A key that cannot be imported is
+// logged and skipped; a page that cannot be read ends the sync.
+func (s *TykSync) Sync(ctx context.Context) (int, error) {
+	imported := 0
+	for p := 1; p <= tykMaxPages; p++ {
+		page, err := s.page(ctx, p)
+		if err != nil {
+			return imported, fmt.Errorf("page %d: %w", p, err)
+		}
+
+		for _, k := range page.Keys {
+			result := s.importKey(ctx, k.KeyID, k.Data)
+			if result == syncImported {
+				imported++
+			}
+			s.metrics.IncTokenSyncKey(result)
+		}
+
+		if p >= page.Pages {
+			return imported, nil
+		}
+	}
+
+	return imported, fmt.Errorf("more than %d pages", tykMaxPages)
+}
+
+func (s *TykSync) page(ctx context.Context, p int) (tykKeyPage, error) {
+	target := strings.TrimRight(s.cfg.URL, "/") + "/api/keys/detailed?p=" + url.QueryEscape(strconv.Itoa(p))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return tykKeyPage{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", s.cfg.Secret)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return tykKeyPage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return tykKeyPage{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var page tykKeyPage
+	if err := json.NewDecoder(io.LimitReader(resp.Body, tykMaxPageLen)).Decode(&page); err != nil {
+		return tykKeyPage{}, fmt.Errorf("decode keys: %w", err)
+	}
+
+	return page, nil
+}
+
+func (s *TykSync) importKey(ctx context.Context, keyID string, sess tykSession) string {
+	routes := s.routes(sess)
+	if keyID == "" || len(routes) == 0 {
+		// without routes the profile would allow every route
+		return syncSkipped
+	}
+
+	t, err := s.next.GetToken(ctx, keyID)
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrExpired), errors.Is(err, ErrInvalid):
+		t = Token{APIKey: keyID}
+	case err != nil:
+		log.Warn().Err(err).Msg("tyk key sync: failed to read token")
+		return syncError
+	}
+
+	want := t
+	want.RateLimit = s.rateLimit(sess)
+	want.ExpiresAt = s.expiresAt(sess, t.ExpiresAt)
+	want.AllowedRoutes = routes
+	want.Disabled = sess.IsInactive
+	if err == nil && want.RateLimit == t.RateLimit && want.ExpiresAt.Equal(t.ExpiresAt) &&
+		slices.Equal(want.AllowedRoutes, t.AllowedRoutes) && want.Disabled == t.Disabled {
+		return syncUnchanged
+	}
+
+	if err := s.next.Upsert(ctx, want); err != nil {
+		if errors.Is(err, ErrExpired) {
+			return syncSkipped
+		}
+		log.Warn().Err(err).Msg("tyk key sync: failed to store token")
+		return syncError
+	}
+
+	return syncImported
+}
+
+// routes returns the configured routes of the Tyk APIs the key has access to, sorted so comparisons are stable.
+func (s *TykSync) routes(sess tykSession) []string {
+	var routes []string
+	for id, ar := range sess.AccessRights {
+		if ar.APIID != "" {
+			id = ar.APIID
+		}
+		for _, r := range s.cfg.APIRoutes[id] {
+			if !slices.Contains(routes, r) {
+				routes = append(routes, r)
+			}
+		}
+	}
+	slices.Sort(routes)
+
+	return routes
+}
+
+// rateLimit converts Tyk's rate requests per per seconds into requests per limiter window.
+func (s *TykSync) rateLimit(sess tykSession) int {
+	switch {
+	case sess.Rate < 0:
+		return Unlimited
+	case sess.Rate == 0 || sess.Per <= 0:
+		return 0 // inherit the route or global limit
+	}
+
+	return max(1, int(math.Ceil(sess.Rate*s.window.Seconds()/sess.Per)))
+}
+
+// expiresAt maps Tyk's never-expiring keys to NoExpiryTTL from now. Later syncs move it forward once half of
+// that has passed, rather than rewriting the profile every time.
+func (s *TykSync) expiresAt(sess tykSession, current time.Time) time.Time {
+	if sess.Expires > 0 {
+		return time.Unix(sess.Expires, 0).UTC()
+	}
+
+	now := s.now()
+	if current.After(now.Add(s.cfg.NoExpiryTTL / 2)) {
+		return current
+	}
+
+	return now.Add(s.cfg.NoExpiryTTL)
+}
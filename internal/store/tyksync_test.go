@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+func TestTykSync_Sync(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	pages := map[string]string{
+		"1": fmt.Sprintf(`{"pages": 2, "keys": [
+			{"key_id": "k1", "data": {"rate": 10, "per": 1, "expires": %d, "access_rights": {"orders": {"api_id": "orders"}}}},
+			{"key_id": "k2", "data": {"rate": -1, "expires": 0, "is_inactive": true, "access_rights": {"orders": {}, "users": {}}}}
+		]}`, exp),
+		"2": `{"pages": 2, "keys": [
+			{"key_id": "k3", "data": {"rate": 5, "per": 60, "access_rights": {"unmapped": {}}}}
+		]}`,
+	}
+	dashboard := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/keys/detailed" || r.Header.Get("Authorization") != "dash-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, pages[r.URL.Query().Get("p")])
+	}))
+	defer dashboard.Close()
+
+	local := newFakeBackend()
+	local.tokens["k1"] = Token{APIKey: "k1", RateLimit: 1, ExpiresAt: time.Now().Add(time.Minute), Tenant: "acme"}
+	s := NewTykSync(local, config.TykSync{
+		URL:         dashboard.URL + "/",
+		Secret:      "dash-secret",
+		Timeout:     time.Second,
+		APIRoutes:   map[string][]string{"orders": {"/api/v1/orders*"}, "users": {"/api/v1/users*", "/api/v1/orders*"}},
+		NoExpiryTTL: 24 * time.Hour,
+	}, time.Minute, nil)
+
+	n, err := s.Sync(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("n=%d err=%v want 2 imported", n, err)
+	}
+
+	k1 := local.tokens["k1"]
+	if k1.RateLimit != 600 || k1.ExpiresAt.Unix() != exp || k1.Tenant != "acme" {
+		t.Fatalf("k1=%+v want 10/s as 600/min, Tyk's expiry and the local tenant kept", k1)
+	}
+	k2 := local.tokens["k2"]
+	if k2.RateLimit != Unlimited || !k2.Disabled || !slices.Equal(k2.AllowedRoutes, []string{"/api/v1/orders*", "/api/v1/users*"}) {
+		t.Fatalf("k2=%+v want an unlimited, disabled token with the routes of both APIs", k2)
+	}
+	if d := time.Until(k2.ExpiresAt); d < 23*time.Hour || d > 24*time.Hour {
+		t.Fatalf("k2 expires in %s, want no_expiry_ttl", d)
+	}
+	if _, ok := local.tokens["k3"]; ok {
+		t.Fatalf("k3 imported without routes")
+	}
+
+	// nothing changed in Tyk, so nothing is written again
+	upserts := local.upserts
+	if n, err := s.Sync(context.Background()); err != nil || n != 0 || local.upserts != upserts {
+		t.Fatalf("n=%d err=%v upserts=%d want no writes", n, err, local.upserts-upserts)
+	}
+}
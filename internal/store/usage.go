@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxTrackedTokens bounds the last-used index; only the most recently used keys matter for warm-up.
+const maxTrackedTokens = 100_000
+
+// Usage records when tokens were last used in a Redis sorted set (score is unix seconds),
+// shared by all proxy instances.
+type Usage struct {
+	rdcl redis.UniversalClient
+	key  string
+
+	// for tests
+	now func() time.Time
+}
+
+func NewUsage(rdcl redis.UniversalClient, key string) *Usage {
+	if key == "" {
+		key = "token_last_used"
+	}
+
+	return &Usage{
+		rdcl: rdcl,
+		key:  key,
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Touch marks apiKey as used now.
+func (u *Usage) Touch(ctx context.Context, apiKey string) error {
+	pipe := u.rdcl.Pipeline()
+	pipe.ZAdd(ctx, u.key, redis.Z{Score: float64(u.now().Unix()), Member: apiKey})
+	pipe.ZRemRangeByRank(ctx, u.key, 0, -maxTrackedTokens-1)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Recent returns up to n api keys, most recently used first.
+func (u *Usage) Recent(ctx context.Context, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	return u.rdcl.ZRevRange(ctx, u.key, 0, int64(n-1)).Result()
+}
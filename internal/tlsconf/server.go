@@ -0,0 +1,149 @@
+package tlsconf
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+)
+
+// Server holds the TLS settings of a listener terminating TLS, reloading the certificate, key and client CAs
+// when their files change. Connections already established keep the settings of their handshake.
+type Server struct {
+	cfg config.ServerTLS
+
+	current atomic.Pointer[tls.Config]
+
+	mu    sync.Mutex
+	files map[string]fileVersion // as of the last load
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func NewServer(c config.ServerTLS) (*Server, error) {
+	s := &Server{cfg: c}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Config returns the config for the listener. Every handshake gets the settings loaded last.
+func (s *Server) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: s.current.Load().MinVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.current.Load(), nil
+		},
+	}
+}
+
+// Reload loads the files again if any of them changed since the last load, reporting whether it did. On
+// error the previous settings stay in use.
+func (s *Server) Reload() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := map[string]fileVersion{}
+	for _, f := range []string{s.cfg.CertFile, s.cfg.KeyFile, s.cfg.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return false, fmt.Errorf("tls: %w", err)
+		}
+		files[f] = fileVersion{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	if s.current.Load() != nil && sameFiles(files, s.files) {
+		return false, nil
+	}
+
+	cfg, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	s.current.Store(cfg)
+	s.files = files
+
+	return true, nil
+}
+
+// Run checks the files for changes every interval, and reloads them unconditionally on every value of
+// reload (e.g. SIGHUP), until ctx is done.
+func (s *Server) Run(ctx context.Context, interval time.Duration, reload <-chan os.Signal) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-reload:
+			s.mu.Lock()
+			s.files = nil
+			s.mu.Unlock()
+		}
+
+		if reloaded, err := s.Reload(); err != nil {
+			log.Error().Err(err).Str("cert_file", s.cfg.CertFile).Msg("tls: reload failed, keeping the previous certificate")
+		} else if reloaded {
+			log.Info().Str("cert_file", s.cfg.CertFile).Msg("tls: certificate reloaded")
+		}
+	}
+}
+
+func (s *Server) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertFile, s.cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if s.cfg.MinVersion == config.TLSVersion13 {
+		cfg.MinVersion = tls.VersionTLS13
+	}
+
+	if s.cfg.ClientCAFile != "" {
+		pool, err := certPool(s.cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if s.cfg.ClientAuth == config.ClientAuthOptional {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return cfg, nil
+}
+
+func sameFiles(a, b map[string]fileVersion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for f, v := range a {
+		if w, ok := b[f]; !ok || !v.modTime.Equal(w.modTime) || v.size != w.size {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,191 @@
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+// writeCert writes a self-signed certificate and its key to dir.
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis.test"},
+		DNSNames:              []string{"redis.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir)
+
+	cfg, err := Client(config.ClientTLS{})
+	if err != nil || cfg != nil {
+		t.Fatalf("disabled: cfg=%v err=%v, want nil, nil", cfg, err)
+	}
+
+	cfg, err = Client(config.ClientTLS{
+		Enabled:    true,
+		CAFile:     certFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "redis.test",
+	})
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	if cfg.RootCAs == nil || len(cfg.Certificates) != 1 || cfg.ServerName != "redis.test" {
+		t.Fatalf("unexpected config: roots=%v certs=%d server_name=%q", cfg.RootCAs, len(cfg.Certificates), cfg.ServerName)
+	}
+
+	if _, err := Client(config.ClientTLS{Enabled: true, CAFile: keyFile}); err == nil {
+		t.Fatal("expected error for a ca_file without certificates")
+	}
+	if _, err := Client(config.ClientTLS{Enabled: true, CAFile: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Fatal("expected error for a missing ca_file")
+	}
+}
+
+// handshake connects a client with cfg to a server with srv over an in-memory pipe.
+func handshake(t *testing.T, srv, cfg *tls.Config) (*x509.Certificate, error) {
+	t.Helper()
+
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		ss := tls.Server(s, srv)
+		err := ss.Handshake()
+		if err == nil {
+			// a failed client certificate check only surfaces on the first read
+			_, err = ss.Write([]byte{0})
+		}
+		errc <- err
+		s.Close()
+	}()
+
+	cc := tls.Client(c, cfg)
+	if err := cc.Handshake(); err != nil {
+		<-errc
+		return nil, err
+	}
+	if _, err := cc.Read(make([]byte, 1)); err != nil {
+		<-errc
+		return nil, err
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	return cc.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir)
+	pool, err := certPool(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(config.ServerTLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	client := &tls.Config{RootCAs: pool, ServerName: "redis.test", MinVersion: tls.VersionTLS12}
+
+	if _, err := handshake(t, srv.Config(), client); err == nil {
+		t.Fatal("expected handshake without a client certificate to fail")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Certificates = []tls.Certificate{cert}
+	first, err := handshake(t, srv.Config(), client)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+
+	// unchanged files are not loaded again
+	if reloaded, err := srv.Reload(); err != nil || reloaded {
+		t.Fatalf("reloaded=%v err=%v, want false, nil", reloaded, err)
+	}
+
+	// a broken certificate keeps the previous one in use
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Reload(); err == nil {
+		t.Fatal("expected error for an invalid certificate")
+	}
+
+	// a new certificate is served once reloaded; connections check it against the new CA
+	writeCert(t, dir)
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reloaded, err := srv.Reload(); err != nil || !reloaded {
+		t.Fatalf("reloaded=%v err=%v, want true, nil", reloaded, err)
+	}
+	if client.RootCAs, err = certPool(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	client.Certificates = []tls.Certificate{cert}
+	second, err := handshake(t, srv.Config(), client)
+	if err != nil {
+		t.Fatalf("handshake after reload: %v", err)
+	}
+	if first.Equal(second) {
+		t.Fatal("expected the reloaded certificate to be served")
+	}
+}
@@ -0,0 +1,181 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxMessageBytes matches the default receive limit of gRPC servers and clients.
+const maxMessageBytes = 4 << 20
+
+// status is a gRPC status as sent in the grpc-status and grpc-message trailers.
+type status struct {
+	code    int
+	message string
+}
+
+const (
+	codeOK               = 0
+	codeInvalidArgument  = 3
+	codeDeadlineExceeded = 4
+	codeInternal         = 13
+	codeUnavailable      = 14
+)
+
+// codeNames are the canonical gRPC code names, indexed by code.
+var codeNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND", "ALREADY_EXISTS",
+	"PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+// httpStatus maps gRPC codes to HTTP statuses the way grpc-gateway does.
+var httpStatus = []int{
+	http.StatusOK, 499, http.StatusInternalServerError, http.StatusBadRequest, http.StatusGatewayTimeout,
+	http.StatusNotFound, http.StatusConflict, http.StatusForbidden, http.StatusTooManyRequests,
+	http.StatusBadRequest, http.StatusConflict, http.StatusBadRequest, http.StatusNotImplemented,
+	http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusInternalServerError,
+	http.StatusUnauthorized,
+}
+
+func codeName(code int) string {
+	if code >= 0 && code < len(codeNames) {
+		return codeNames[code]
+	}
+
+	return "UNKNOWN"
+}
+
+func (s status) httpStatus() int {
+	if s.code >= 0 && s.code < len(httpStatus) {
+		return httpStatus[s.code]
+	}
+
+	return http.StatusInternalServerError
+}
+
+// client makes unary gRPC calls over HTTP/2, cleartext (h2c) unless the target uses TLS.
+type client struct {
+	httpc  *http.Client
+	scheme string
+	target string
+}
+
+func newClient(target string, useTLS bool) *client {
+	protocols := new(http.Protocols)
+	scheme := "https"
+	if useTLS {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+		scheme = "http"
+	}
+
+	return &client{
+		httpc:  &http.Client{Transport: &http.Transport{Protocols: protocols, ForceAttemptHTTP2: true}},
+		scheme: scheme,
+		target: target,
+	}
+}
+
+// invoke sends one request message to method ("/pkg.Service/Method") and returns the response message.
+func (c *client) invoke(ctx context.Context, method string, msg []byte, md http.Header) ([]byte, status, error) {
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.scheme+"://"+c.target+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, status{}, fmt.Errorf("grpc: build request: %w", err)
+	}
+	for k, vs := range md {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10)+"m")
+	}
+
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return nil, status{}, fmt.Errorf("grpc: call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, status{}, fmt.Errorf("grpc: call %s: http status %d", method, resp.StatusCode)
+	}
+
+	out, readErr := readMessage(resp.Body)
+
+	// trailers-only responses carry the status in the headers
+	st, ok := parseStatus(resp.Trailer)
+	if !ok {
+		st, ok = parseStatus(resp.Header)
+	}
+	if !ok {
+		if readErr != nil {
+			return nil, status{}, readErr
+		}
+		return nil, status{}, fmt.Errorf("grpc: call %s: missing grpc-status", method)
+	}
+	if st.code != codeOK {
+		return nil, st, nil
+	}
+	if readErr != nil {
+		return nil, status{}, readErr
+	}
+
+	return out, st, nil
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("grpc: read message header: %w", err)
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("grpc: compressed responses are not supported")
+	}
+
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxMessageBytes {
+		return nil, fmt.Errorf("grpc: response message of %d bytes exceeds %d", n, maxMessageBytes)
+	}
+
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("grpc: read message: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, r)
+
+	return msg, nil
+}
+
+func parseStatus(h http.Header) (status, bool) {
+	v := h.Get("Grpc-Status")
+	if v == "" {
+		return status{}, false
+	}
+
+	code, err := strconv.Atoi(v)
+	if err != nil {
+		return status{code: 2, message: "invalid grpc-status " + v}, true
+	}
+
+	msg, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		msg = h.Get("Grpc-Message")
+	}
+
+	return status{code: code, message: msg}, true
+}
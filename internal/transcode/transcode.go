@@ -0,0 +1,313 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	mp "tyk-proxy/internal/metrics"
+	"tyk-proxy/internal/routes"
+)
+
+// Transcoder serves JSON/HTTP requests on routes with grpc configured by calling unary gRPC methods
+// (grpc-gateway style): path parameters and the query string set request fields, the JSON body the rest.
+type Transcoder struct {
+	routes  map[string]*route // by route path
+	metrics *mp.Metrics
+}
+
+type route struct {
+	cfg     *config.GRPCTranscoding
+	client  *client
+	methods []method
+}
+
+type method struct {
+	httpMethod string
+	segments   []string
+	fullName   string // /pkg.Service/Method
+	in         protoreflect.MessageDescriptor
+	out        protoreflect.MessageDescriptor
+}
+
+// New loads the descriptors of all routes with grpc configured. It returns nil when no route has it.
+func New(rs []config.Route, metrics *mp.Metrics) (*Transcoder, error) {
+	t := &Transcoder{routes: map[string]*route{}, metrics: metrics}
+	for i := range rs {
+		cfg := rs[i].GRPC
+		if cfg == nil {
+			continue
+		}
+
+		rt, err := newRoute(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", rs[i].Path, err)
+		}
+		t.routes[rs[i].Path] = rt
+	}
+
+	if len(t.routes) == 0 {
+		return nil, nil
+	}
+
+	return t, nil
+}
+
+func newRoute(cfg *config.GRPCTranscoding) (*route, error) {
+	b, err := os.ReadFile(cfg.Descriptors)
+	if err != nil {
+		return nil, fmt.Errorf("read grpc descriptors: %w", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("parse grpc descriptors %s: %w", cfg.Descriptors, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("grpc descriptors %s: %w", cfg.Descriptors, err)
+	}
+
+	rt := &route{cfg: cfg, client: newClient(cfg.Target, cfg.TLS)}
+	for _, m := range cfg.Methods {
+		svc, name, _ := strings.Cut(m.Method, "/")
+		d, err := files.FindDescriptorByName(protoreflect.FullName(svc))
+		if err != nil {
+			return nil, fmt.Errorf("grpc method %s: %w", m.Method, err)
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("grpc method %s: %s is not a service", m.Method, svc)
+		}
+		md := sd.Methods().ByName(protoreflect.Name(name))
+		if md == nil {
+			return nil, fmt.Errorf("grpc method %s: not found in %s", m.Method, svc)
+		}
+		if md.IsStreamingClient() || md.IsStreamingServer() {
+			return nil, fmt.Errorf("grpc method %s: streaming methods are not supported", m.Method)
+		}
+
+		rt.methods = append(rt.methods, method{
+			httpMethod: m.HTTPMethod,
+			segments:   strings.Split(strings.Trim(m.Path, "/"), "/"),
+			fullName:   "/" + svc + "/" + name,
+			in:         md.Input(),
+			out:        md.Output(),
+		})
+	}
+
+	return rt, nil
+}
+
+// Handler serves transcoded routes and passes every other request to next.
+func (t *Transcoder) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfgRoute, ok := routes.FromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rt, ok := t.routes[cfgRoute.Path]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m, params, ok := rt.match(r.Method, r.URL.Path)
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "no gRPC method for "+r.Method+" "+r.URL.Path)
+			return
+		}
+
+		decision.FromContext(r.Context()).SetUpstream(rt.cfg.Target)
+		st := t.serve(w, r, rt, m, params)
+		t.metrics.IncGRPCTranscoded(cfgRoute.Path, codeName(st))
+	})
+}
+
+// serve performs one call and returns the gRPC code of the outcome, including failures on the proxy side.
+func (t *Transcoder) serve(w http.ResponseWriter, r *http.Request, rt *route, m *method, params map[string]string) int {
+	in, err := buildRequest(r, m.in, params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return codeInvalidArgument
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), rt.cfg.Timeout)
+	defer cancel()
+
+	out, st, err := rt.client.invoke(ctx, m.fullName, in, rt.metadata(r))
+	if err != nil {
+		log.Warn().Err(err).Str("method", m.fullName).Msg("gRPC call failed")
+		if ctx.Err() == context.DeadlineExceeded {
+			writeError(w, http.StatusGatewayTimeout, "DEADLINE_EXCEEDED", "upstream timeout")
+			return codeDeadlineExceeded
+		}
+		writeError(w, http.StatusBadGateway, "UNAVAILABLE", "bad gateway")
+		return codeUnavailable
+	}
+	if st.code != codeOK {
+		writeError(w, st.httpStatus(), codeName(st.code), st.message)
+		return st.code
+	}
+
+	msg := dynamicpb.NewMessage(m.out)
+	if err := proto.Unmarshal(out, msg); err != nil {
+		log.Warn().Err(err).Str("method", m.fullName).Msg("invalid gRPC response message")
+		writeError(w, http.StatusBadGateway, "INTERNAL", "invalid upstream response")
+		return codeInternal
+	}
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "cannot encode response")
+		return codeInternal
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+
+	return codeOK
+}
+
+func (rt *route) match(httpMethod, path string) (*method, map[string]string, bool) {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range rt.methods {
+		m := &rt.methods[i]
+		if m.httpMethod != httpMethod || len(m.segments) != len(segs) {
+			continue
+		}
+
+		params := map[string]string{}
+		ok := true
+		for j, seg := range m.segments {
+			if name, isParam := strings.CutPrefix(seg, "{"); isParam && strings.HasSuffix(name, "}") && segs[j] != "" {
+				params[strings.TrimSuffix(name, "}")] = segs[j]
+				continue
+			}
+			if seg != segs[j] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return m, params, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// metadata forwards the request id and the configured headers as gRPC metadata.
+func (rt *route) metadata(r *http.Request) http.Header {
+	md := http.Header{}
+	if rid := middleware.GetReqID(r.Context()); rid != "" {
+		md.Set("X-Request-Id", rid)
+	}
+	for _, h := range rt.cfg.ForwardHeaders {
+		for _, v := range r.Header.Values(h) {
+			md.Add(h, v)
+		}
+	}
+
+	return md
+}
+
+// buildRequest merges the JSON body, query parameters and path parameters (in increasing precedence)
+// into the request message and returns it encoded.
+func buildRequest(r *http.Request, desc protoreflect.MessageDescriptor, params map[string]string) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if r.Body != nil && r.Body != http.NoBody {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+		if len(strings.TrimSpace(string(b))) > 0 {
+			if err := json.Unmarshal(b, &fields); err != nil {
+				return nil, fmt.Errorf("body must be a JSON object: %w", err)
+			}
+		}
+	}
+
+	for name, vs := range r.URL.Query() {
+		if err := setField(fields, desc, name, vs[len(vs)-1]); err != nil {
+			return nil, err
+		}
+	}
+	for name, v := range params {
+		if err := setField(fields, desc, name, v); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if err := protojson.Unmarshal(b, msg); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	return proto.Marshal(msg)
+}
+
+// setField sets a scalar top-level field from its string form, by proto or JSON name.
+func setField(fields map[string]json.RawMessage, desc protoreflect.MessageDescriptor, name, value string) error {
+	fd := desc.Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		fd = desc.Fields().ByJSONName(name)
+	}
+	if fd == nil || fd.IsList() || fd.IsMap() || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		return fmt.Errorf("parameter %q does not map to a scalar field of %s", name, desc.FullName())
+	}
+
+	var raw any = value
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("parameter %q must be a boolean", name)
+		}
+		raw = b
+	case protoreflect.EnumKind:
+		if n, err := strconv.Atoi(value); err == nil {
+			raw = n
+		}
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	fields[string(fd.Name())] = b
+	// drop the other spelling so the body cannot set the field twice
+	if fd.JSONName() != string(fd.Name()) {
+		delete(fields, fd.JSONName())
+	}
+
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"code": code, "message": msg})
+}
@@ -0,0 +1,189 @@
+package transcode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/routes"
+)
+
+// testFile describes users.v1.UserService with GetUser(GetUserRequest{id, verbose}) returns (User{id, display_name}).
+func testFile() *descriptorpb.FileDescriptorProto {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(num),
+			Type:     typ.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			JsonName: proto.String(jsonName(name)),
+		}
+	}
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("users.proto"),
+		Package: proto.String("users.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("GetUserRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				field("verbose", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL),
+			}},
+			{Name: proto.String("User"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				field("display_name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("UserService"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("GetUser"),
+				InputType:  proto.String(".users.v1.GetUserRequest"),
+				OutputType: proto.String(".users.v1.User"),
+			}},
+		}},
+	}
+}
+
+func jsonName(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+	}
+	return strings.Join(parts, "")
+}
+
+// newGRPCServer answers GetUser over h2c: id 404 fails with NOT_FOUND, anything else echoes the id.
+func newGRPCServer(t *testing.T, fd protoreflect.FileDescriptor) string {
+	t.Helper()
+
+	in := fd.Messages().ByName("GetUserRequest")
+	out := fd.Messages().ByName("User")
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users.v1.UserService/GetUser" || r.ProtoMajor != 2 {
+			t.Errorf("unexpected call %s over HTTP/%d", r.URL.Path, r.ProtoMajor)
+		}
+
+		b, _ := io.ReadAll(r.Body)
+		req := dynamicpb.NewMessage(in)
+		if err := proto.Unmarshal(b[5:], req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		id := req.Get(in.Fields().ByName("id")).Int()
+		if id == 404 {
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "user%20not%20found")
+			return
+		}
+
+		resp := dynamicpb.NewMessage(out)
+		resp.Set(out.Fields().ByName("id"), protoreflect.ValueOfInt64(id))
+		name := "user-" + r.Header.Get("X-Tenant")
+		if req.Get(in.Fields().ByName("verbose")).Bool() {
+			name += "-verbose"
+		}
+		resp.Set(out.Fields().ByName("display_name"), protoreflect.ValueOfString(name))
+		msg, _ := proto.Marshal(resp)
+
+		frame := make([]byte, 5+len(msg))
+		binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+		copy(frame[5:], msg)
+		_, _ = w.Write(frame)
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return srv.Listener.Addr().(*net.TCPAddr).String()
+}
+
+func TestTranscoder(t *testing.T) {
+	fdp := testFile()
+	fd, err := protodesc.NewFile(fdp, nil)
+	if err != nil {
+		t.Fatalf("descriptor: %v", err)
+	}
+	target := newGRPCServer(t, fd)
+
+	set, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fdp}})
+	path := filepath.Join(t.TempDir(), "users.pb")
+	if err := os.WriteFile(path, set, 0o600); err != nil {
+		t.Fatalf("write descriptors: %v", err)
+	}
+
+	rs := []config.Route{{Path: "/api/v1/users*", GRPC: &config.GRPCTranscoding{
+		Target:         target,
+		Descriptors:    path,
+		ForwardHeaders: []string{"X-Tenant"},
+		Timeout:        5 * time.Second,
+		Methods:        []config.GRPCMethod{{HTTPMethod: http.MethodGet, Path: "/api/v1/users/{id}", Method: "users.v1.UserService/GetUser"}},
+	}}}
+	tc, err := New(rs, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	h := routes.NewTable(rs).Middleware(tc.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		want   map[string]any
+	}{
+		{"ok", http.MethodGet, "/api/v1/users/7", http.StatusOK, map[string]any{"id": "7", "displayName": "user-acme"}},
+		{"query sets fields", http.MethodGet, "/api/v1/users/7?verbose=true", http.StatusOK, map[string]any{"id": "7", "displayName": "user-acme-verbose"}},
+		{"grpc status mapped", http.MethodGet, "/api/v1/users/404", http.StatusNotFound, map[string]any{"code": "NOT_FOUND", "message": "user not found"}},
+		{"invalid field value", http.MethodGet, "/api/v1/users/abc", http.StatusBadRequest, nil},
+		{"unknown parameter", http.MethodGet, "/api/v1/users/7?nope=1", http.StatusBadRequest, nil},
+		{"no method", http.MethodDelete, "/api/v1/users/7", http.StatusNotFound, nil},
+		{"other routes proxied", http.MethodGet, "/api/v1/orders/7", http.StatusTeapot, nil},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-Tenant", "acme")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Fatalf("%s: status=%d want=%d body=%s", tt.name, rr.Code, tt.status, rr.Body)
+		}
+		if tt.want == nil {
+			continue
+		}
+		var got map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Fatalf("%s: %s=%v want=%v (body %s)", tt.name, k, got[k], v, rr.Body)
+			}
+		}
+	}
+}
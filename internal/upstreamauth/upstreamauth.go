@@ -0,0 +1,219 @@
+// Package upstreamauth authenticates the proxy to upstreams that require their own OAuth2 bearer tokens.
+package upstreamauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+	mp "tyk-proxy/internal/metrics"
+)
+
+// defaultLifetime is how long a token the endpoint sent without expires_in is used.
+const defaultLifetime = 5 * time.Minute
+
+const (
+	fetchOK    = "ok"
+	fetchError = "error"
+)
+
+// ClientCredentials obtains bearer tokens with the client_credentials grant and caches them until shortly
+// before they expire. Concurrent callers share one fetch.
+type ClientCredentials struct {
+	cfg     config.UpstreamOAuth2
+	route   string
+	httpc   *http.Client
+	metrics *mp.Metrics
+
+	fetchMu sync.Mutex // held for the duration of a fetch
+
+	mu         sync.Mutex
+	token      string
+	expiry     time.Time
+	refreshing bool // a background refresh is running
+
+	// for tests
+	now func() time.Time
+}
+
+func NewClientCredentials(route string, cfg config.UpstreamOAuth2, metrics *mp.Metrics) *ClientCredentials {
+	return &ClientCredentials{
+		cfg:     cfg,
+		route:   route,
+		httpc:   &http.Client{},
+		metrics: metrics,
+		now:     time.Now,
+	}
+}
+
+// Token returns the cached token, fetching one when there is none or it has expired. A token within
+// refresh_before of its expiry is still returned while its successor is fetched in the background.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	tok, valid := c.token, c.token != "" && now.Before(c.expiry)
+	refresh := valid && !c.refreshing && !now.Before(c.expiry.Add(-c.cfg.RefreshBefore))
+	if refresh {
+		c.refreshing = true
+	}
+	c.mu.Unlock()
+
+	if !valid {
+		return c.refresh(ctx, tok)
+	}
+
+	if refresh {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+			defer cancel()
+			if _, err := c.refresh(ctx, tok); err != nil {
+				log.Warn().Err(err).Str("route", c.route).Msg("upstream oauth2: token refresh failed")
+			}
+
+			c.mu.Lock()
+			c.refreshing = false
+			c.mu.Unlock()
+		}()
+	}
+
+	return tok, nil
+}
+
+// Invalidate drops token if it is still the cached one, e.g. after the upstream rejected it, so the next
+// request fetches a new one.
+func (c *ClientCredentials) Invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == token {
+		c.token, c.expiry = "", time.Time{}
+	}
+}
+
+// refresh replaces the cached token old, unless another caller did so while this one waited for the fetch lock.
+func (c *ClientCredentials) refresh(ctx context.Context, old string) (string, error) {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	c.mu.Lock()
+	if c.token != old && c.token != "" && c.now().Before(c.expiry) {
+		tok := c.token
+		c.mu.Unlock()
+		return tok, nil
+	}
+	c.mu.Unlock()
+
+	tok, expiry, err := c.fetch(ctx)
+	if err != nil {
+		c.metrics.IncUpstreamTokenFetch(c.route, fetchError)
+		return "", err
+	}
+	c.metrics.IncUpstreamTokenFetch(c.route, fetchOK)
+
+	c.mu.Lock()
+	c.token, c.expiry = tok, expiry
+	c.mu.Unlock()
+
+	return tok, nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (string, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+	if c.cfg.Audience != "" {
+		form.Set("audience", c.cfg.Audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("upstream oauth2: build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// RFC 6749 2.3.1: the credentials are form-encoded before they go into the Basic header
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	start := c.now()
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("upstream oauth2: token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("upstream oauth2: read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("upstream oauth2: token endpoint answered %d", resp.StatusCode)
+	}
+
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", time.Time{}, fmt.Errorf("upstream oauth2: decode token response: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return "", time.Time{}, errors.New("upstream oauth2: token response without access_token")
+	}
+	if tr.TokenType != "" && !strings.EqualFold(tr.TokenType, "bearer") {
+		return "", time.Time{}, fmt.Errorf("upstream oauth2: unsupported token_type %q", tr.TokenType)
+	}
+
+	// counted from the request, so the token is never used past its expiry
+	lifetime := defaultLifetime
+	if tr.ExpiresIn > 0 {
+		lifetime = time.Duration(tr.ExpiresIn) * time.Second
+	}
+
+	return tr.AccessToken, start.Add(lifetime), nil
+}
+
+// Transport sends requests upstream with a token of Credentials in place of their Authorization header.
+// An upstream 401 drops the token, so the next request gets a fresh one.
+type Transport struct {
+	Base        http.RoundTripper
+	Credentials *ClientCredentials
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.Credentials.Token(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// a RoundTripper must not modify the request it was given
+	out := req.Clone(req.Context())
+	out.Header.Set("Authorization", "Bearer "+tok)
+
+	resp, err := t.Base.RoundTrip(out)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		t.Credentials.Invalidate(tok)
+	}
+
+	return resp, err
+}
@@ -0,0 +1,137 @@
+package upstreamauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "proxy" || secret != "s%3Acret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "orders:read orders:write" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"t%d","token_type":"Bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fetches
+}
+
+func newCredentials(tokenURL string) *ClientCredentials {
+	return NewClientCredentials("/api/v1/orders*", config.UpstreamOAuth2{
+		TokenURL:      tokenURL,
+		ClientID:      "proxy",
+		ClientSecret:  "s:cret",
+		Scopes:        []string{"orders:read", "orders:write"},
+		Timeout:       time.Second,
+		RefreshBefore: 30 * time.Second,
+	}, nil)
+}
+
+func TestClientCredentials_Token(t *testing.T) {
+	srv, fetches := newTokenServer(t, 60)
+	c := newCredentials(srv.URL)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	token := func() string {
+		t.Helper()
+		tok, err := c.Token(ctx)
+		if err != nil {
+			t.Fatalf("token: %v", err)
+		}
+		return tok
+	}
+
+	if tok := token(); tok != "t1" {
+		t.Fatalf("token=%q want t1", tok)
+	}
+	if tok := token(); tok != "t1" || fetches.Load() != 1 {
+		t.Fatalf("token=%q fetches=%d want the cached t1", tok, fetches.Load())
+	}
+
+	// within refresh_before of the expiry the old token is still used while the next one is fetched
+	now = now.Add(40 * time.Second)
+	if tok := token(); tok != "t1" {
+		t.Fatalf("token=%q want t1 during the refresh", tok)
+	}
+	deadline := time.Now().Add(time.Second)
+	for fetches.Load() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if tok := token(); tok != "t2" {
+		t.Fatalf("token=%q want the refreshed t2", tok)
+	}
+
+	c.Invalidate("t1") // no longer cached: a no-op
+	if tok := token(); tok != "t2" {
+		t.Fatalf("token=%q want t2", tok)
+	}
+	c.Invalidate("t2")
+	if tok := token(); tok != "t3" {
+		t.Fatalf("token=%q want t3 after invalidation", tok)
+	}
+
+	// past the expiry the caller waits for a new token
+	now = now.Add(2 * time.Minute)
+	if tok := token(); tok != "t4" {
+		t.Fatalf("token=%q want t4 after expiry", tok)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	srv, fetches := newTokenServer(t, 3600)
+
+	var seen []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		if len(seen) == 2 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: &Transport{Base: http.DefaultTransport, Credentials: newCredentials(srv.URL)}}
+	for range 3 {
+		req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+		req.Header.Set("Authorization", "Bearer client-jwt")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		_ = resp.Body.Close()
+		if req.Header.Get("Authorization") != "Bearer client-jwt" {
+			t.Fatalf("the caller's request was modified")
+		}
+	}
+
+	want := []string{"Bearer t1", "Bearer t1", "Bearer t2"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) || fetches.Load() != 2 {
+		t.Fatalf("seen=%q fetches=%d want %q", seen, fetches.Load(), want)
+	}
+
+	rejected := newCredentials(srv.URL)
+	rejected.cfg.ClientSecret = "wrong"
+	bad := &http.Client{Transport: &Transport{Base: http.DefaultTransport, Credentials: rejected}}
+	if _, err := bad.Get(upstream.URL); err == nil {
+		t.Fatalf("a failed token fetch must fail the request")
+	}
+}
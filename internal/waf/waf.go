@@ -0,0 +1,279 @@
+// Package waf stops obvious injection and scanner traffic with request inspection rules loaded from a file.
+package waf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/decision"
+	"tyk-proxy/internal/gwerr"
+	mp "tyk-proxy/internal/metrics"
+)
+
+const (
+	TargetPath   = "path"
+	TargetQuery  = "query"
+	TargetHeader = "header"
+	TargetBody   = "body"
+
+	ActionBlock = "block"
+	ActionLog   = "log"
+)
+
+const (
+	reloadOK    = "ok"
+	reloadError = "error"
+)
+
+// Rule matches Pattern against one part of a request: the path, the query string, the values of Header or
+// the body. Path and query are matched both as sent and percent-decoded.
+type Rule struct {
+	ID      string `json:"id"`
+	Target  string `json:"target"`
+	Header  string `json:"header,omitempty"`
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"` // block (default) or log
+
+	re *regexp.Regexp
+}
+
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Load reads and compiles the rules of a rules file.
+func Load(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f rulesFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	ids := make(map[string]struct{}, len(f.Rules))
+	for i := range f.Rules {
+		rl := &f.Rules[i]
+		if err := rl.compile(); err != nil {
+			return nil, fmt.Errorf("%s: rules[%d]: %w", path, i, err)
+		}
+		if _, ok := ids[rl.ID]; ok {
+			return nil, fmt.Errorf("%s: rules[%d]: duplicate id %q", path, i, rl.ID)
+		}
+		ids[rl.ID] = struct{}{}
+	}
+
+	return f.Rules, nil
+}
+
+func (rl *Rule) compile() error {
+	if rl.ID == "" {
+		return errors.New("id is required")
+	}
+
+	switch rl.Target {
+	case TargetPath, TargetQuery, TargetBody:
+	case TargetHeader:
+		if rl.Header == "" {
+			return errors.New("header is required for target header")
+		}
+	default:
+		return fmt.Errorf("target must be %s, %s, %s or %s", TargetPath, TargetQuery, TargetHeader, TargetBody)
+	}
+
+	switch rl.Action {
+	case "":
+		rl.Action = ActionBlock
+	case ActionBlock, ActionLog:
+	default:
+		return fmt.Errorf("action must be %s or %s", ActionBlock, ActionLog)
+	}
+
+	re, err := regexp.Compile(rl.Pattern)
+	if err != nil {
+		return err
+	}
+	rl.re = re
+
+	return nil
+}
+
+// Engine applies the rules of a rules file to requests, picking up changes to the file while it runs.
+type Engine struct {
+	path         string
+	interval     time.Duration
+	maxBodyBytes int64
+	metrics      *mp.Metrics
+
+	rules atomic.Pointer[[]Rule]
+
+	// the rules file as last loaded; only touched by New and Run
+	modTime time.Time
+	size    int64
+}
+
+// New loads the rules file of cfg; unlike a reload, a file that fails to load is an error.
+func New(cfg config.WAF, metrics *mp.Metrics) (*Engine, error) {
+	e := &Engine{
+		path:         cfg.RulesFile,
+		interval:     cfg.ReloadInterval,
+		maxBodyBytes: cfg.MaxBodyBytes,
+		metrics:      metrics,
+	}
+	if _, err := e.reload(); err != nil {
+		return nil, fmt.Errorf("waf: %w", err)
+	}
+
+	return e, nil
+}
+
+// Run reloads the rules file when it changes until ctx is done.
+func (e *Engine) Run(ctx context.Context) {
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if reloaded, err := e.reload(); err != nil {
+			e.metrics.IncWAFReload(reloadError)
+			log.Error().Err(err).Str("file", e.path).Msg("waf: rules reload failed, keeping the previous rules")
+		} else if reloaded {
+			e.metrics.IncWAFReload(reloadOK)
+			log.Info().Str("file", e.path).Int("rules", len(*e.rules.Load())).Msg("waf: rules reloaded")
+		}
+	}
+}
+
+// reload loads the rules file if it changed since the last load, reporting whether it did.
+func (e *Engine) reload() (bool, error) {
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return false, err
+	}
+	if fi.ModTime().Equal(e.modTime) && fi.Size() == e.size {
+		return false, nil
+	}
+
+	rules, err := Load(e.path)
+	if err != nil {
+		return false, err
+	}
+
+	e.rules.Store(&rules)
+	e.modTime, e.size = fi.ModTime(), fi.Size()
+
+	return true, nil
+}
+
+// Middleware applies the path, query and header rules: it answers requests matching a block rule with 403,
+// matches of log rules are only logged. It reads no body, so it can run in front of authentication.
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	return e.inspect(next, false)
+}
+
+// BodyMiddleware applies the body rules like Middleware. Reading the body sends 100 Continue to clients that
+// expect it, so it must run after authentication and rate limiting.
+func (e *Engine) BodyMiddleware(next http.Handler) http.Handler {
+	return e.inspect(next, true)
+}
+
+func (e *Engine) inspect(next http.Handler, bodyRules bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules := *e.rules.Load()
+
+		var (
+			body     []byte
+			bodyRead bool
+		)
+		for i := range rules {
+			rl := &rules[i]
+			if (rl.Target == TargetBody) != bodyRules {
+				continue
+			}
+
+			var matched bool
+			switch rl.Target {
+			case TargetPath:
+				matched = matchEncoded(rl.re, r.URL.EscapedPath())
+			case TargetQuery:
+				matched = r.URL.RawQuery != "" && matchEncoded(rl.re, r.URL.RawQuery)
+			case TargetHeader:
+				for _, v := range r.Header.Values(rl.Header) {
+					if matched = rl.re.MatchString(v); matched {
+						break
+					}
+				}
+			case TargetBody:
+				if !bodyRead {
+					body, bodyRead = e.peekBody(r), true
+				}
+				matched = len(body) > 0 && rl.re.Match(body)
+			}
+			if !matched {
+				continue
+			}
+
+			e.metrics.IncWAFHit(rl.ID, rl.Action)
+			log.Warn().Str("rule", rl.ID).Str("action", rl.Action).Str("method", r.Method).
+				Str("path", r.URL.Path).Str("remote", r.RemoteAddr).Msg("waf rule matched")
+
+			if rl.Action == ActionBlock {
+				decision.FromContext(r.Context()).SetAuth(decision.AuthBlocked, "waf rule "+rl.ID)
+				gwerr.Write(w, e.metrics, gwerr.ErrBlocked)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// matchEncoded matches s as sent and, when it differs, percent-decoded.
+func matchEncoded(re *regexp.Regexp, s string) bool {
+	if re.MatchString(s) {
+		return true
+	}
+	decoded, err := url.QueryUnescape(s)
+	return err == nil && decoded != s && re.MatchString(decoded)
+}
+
+// peekBody returns up to maxBodyBytes of an uncompressed request body, leaving the body readable from the start.
+func (e *Engine) peekBody(r *http.Request) []byte {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	if ce := r.Header.Get("Content-Encoding"); ce != "" && !strings.EqualFold(ce, "identity") {
+		return nil
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(r.Body, e.maxBodyBytes))
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(b), r.Body), Closer: r.Body}
+
+	return b
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,163 @@
+package waf
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+)
+
+const testRules = `{"rules": [
+  {"id": "sqli-union", "target": "query", "pattern": "(?i)union\\s+select"},
+  {"id": "traversal", "target": "path", "pattern": "\\.\\./"},
+  {"id": "scanner-ua", "target": "header", "header": "User-Agent", "pattern": "(?i)sqlmap|nikto"},
+  {"id": "script-tag", "target": "body", "pattern": "(?i)<script", "action": "log"},
+  {"id": "php-eval", "target": "body", "pattern": "eval\\("}
+]}`
+
+func writeRules(t *testing.T, path, rules string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+}
+
+func newTestEngine(t *testing.T, rules string) (*Engine, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "waf.json")
+	writeRules(t, path, rules)
+	e, err := New(config.WAF{RulesFile: path, ReloadInterval: time.Second, MaxBodyBytes: 1024}, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	return e, path
+}
+
+func TestMiddleware(t *testing.T) {
+	e, _ := newTestEngine(t, testRules)
+
+	var gotBody string
+	h := e.Middleware(e.BodyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	})))
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		body   string
+		want   int
+	}{
+		{name: "clean", target: "/api/v1/items?q=shoes", want: http.StatusOK},
+		{name: "union select", target: "/api/v1/items?q=1%20UNION%20SELECT%20password", want: http.StatusForbidden},
+		{name: "encoded traversal", target: "/api/v1/files/..%2F..%2Fetc/passwd", want: http.StatusForbidden},
+		{name: "scanner", target: "/api/v1/items", header: "sqlmap/1.7", want: http.StatusForbidden},
+		{name: "log rule only logs", target: "/api/v1/items", body: `{"note":"<script>"}`, want: http.StatusOK},
+		{name: "body rule", target: "/api/v1/items", body: `{"cmd":"eval(x)"}`, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBody = ""
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set("User-Agent", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && gotBody != tt.body {
+				t.Fatalf("upstream body=%q want the original %q", gotBody, tt.body)
+			}
+		})
+	}
+}
+
+// readCounter counts reads, as the server answers 100 Continue on the first one.
+type readCounter struct {
+	io.Reader
+	reads int
+}
+
+func (rc *readCounter) Read(p []byte) (int, error) {
+	rc.reads++
+	return rc.Reader.Read(p)
+}
+
+func TestMiddleware_LeavesBodyUnread(t *testing.T) {
+	e, _ := newTestEngine(t, testRules)
+
+	// an unauthenticated request is rejected before the body rules ever run
+	h := e.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	body := &readCounter{Reader: strings.NewReader(`{"cmd":"eval(x)"}`)}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/items", body)
+	req.Header.Set("Expect", "100-continue")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized || body.reads != 0 {
+		t.Fatalf("status=%d reads=%d want 401 without reading the body", rr.Code, body.reads)
+	}
+}
+
+func TestReload(t *testing.T) {
+	e, path := newTestEngine(t, testRules)
+
+	if reloaded, err := e.reload(); reloaded || err != nil {
+		t.Fatalf("reloaded=%v err=%v want no reload of an unchanged file", reloaded, err)
+	}
+
+	// a broken file keeps the previous rules
+	writeRules(t, path, `{"rules": [{"id": "bad", "target": "path", "pattern": "("}]}`)
+	if _, err := e.reload(); err == nil {
+		t.Fatalf("reload of an invalid file should fail")
+	}
+	if n := len(*e.rules.Load()); n != 5 {
+		t.Fatalf("rules=%d want the previous 5", n)
+	}
+
+	writeRules(t, path, `{"rules": [{"id": "admin", "target": "path", "pattern": "^/admin"}]}`)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if reloaded, err := e.reload(); !reloaded || err != nil {
+		t.Fatalf("reloaded=%v err=%v want a reload", reloaded, err)
+	}
+	rules := *e.rules.Load()
+	if len(rules) != 1 || rules[0].ID != "admin" || rules[0].Action != ActionBlock {
+		t.Fatalf("rules=%+v want the new admin rule blocking by default", rules)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing id":     `{"rules": [{"target": "path", "pattern": "x"}]}`,
+		"unknown target": `{"rules": [{"id": "a", "target": "cookie", "pattern": "x"}]}`,
+		"header name":    `{"rules": [{"id": "a", "target": "header", "pattern": "x"}]}`,
+		"unknown action": `{"rules": [{"id": "a", "target": "path", "pattern": "x", "action": "drop"}]}`,
+		"duplicate id":   `{"rules": [{"id": "a", "target": "path", "pattern": "x"}, {"id": "a", "target": "query", "pattern": "y"}]}`,
+	}
+
+	for name, rules := range tests {
+		path := filepath.Join(t.TempDir(), "waf.json")
+		writeRules(t, path, rules)
+		if _, err := Load(path); err == nil {
+			t.Fatalf("%s: want an error", name)
+		}
+	}
+}
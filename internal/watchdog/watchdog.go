@@ -0,0 +1,216 @@
+// Package watchdog watches the goroutine count and heap size of the process and, when they cross their
+// thresholds, logs which api keys keep the most requests in flight and saves profiles for a post-mortem
+// before the container runs out of memory.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/inflight"
+	mp "tyk-proxy/internal/metrics"
+)
+
+// Resources, also used as metric labels.
+const (
+	resourceGoroutines = "goroutines"
+	resourceHeap       = "heap"
+)
+
+// heapMetric is the heap memory occupied by objects, live or not yet swept; reading it does not stop the world.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// offenders is how many of the busiest api keys a trip logs.
+const offenders = 5
+
+var profiles = []string{"heap", "goroutine"}
+
+type inFlight interface {
+	Snapshot() []inflight.KeyStats
+}
+
+type Options struct {
+	// InFlight lists the requests in flight per api_key; nil logs no offenders.
+	InFlight inFlight
+	// APIKey renders api keys for the log, e.g. auth.LogRedactor.APIKey; nil logs them as is.
+	APIKey  func(string) string
+	Metrics *mp.Metrics
+}
+
+type Watchdog struct {
+	cfg  config.Watchdog
+	opts Options
+
+	lastTrip time.Time
+
+	// for tests
+	now   func() time.Time
+	usage func() (goroutines int, heapBytes int64)
+}
+
+func New(cfg config.Watchdog, opts Options) *Watchdog {
+	return &Watchdog{cfg: cfg, opts: opts, now: time.Now, usage: usage}
+}
+
+// Run checks the thresholds every interval until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+func (w *Watchdog) check() {
+	goroutines, heap := w.usage()
+
+	var exceeded []string
+	if w.cfg.MaxGoroutines > 0 && goroutines > w.cfg.MaxGoroutines {
+		exceeded = append(exceeded, resourceGoroutines)
+	}
+	if w.cfg.MaxHeapBytes > 0 && heap > w.cfg.MaxHeapBytes {
+		exceeded = append(exceeded, resourceHeap)
+	}
+	if len(exceeded) == 0 {
+		return
+	}
+
+	for _, resource := range exceeded {
+		w.opts.Metrics.IncWatchdogTrip(resource)
+	}
+
+	// a process stuck above a threshold trips on every check; report it once per cooldown
+	now := w.now()
+	if !w.lastTrip.IsZero() && now.Sub(w.lastTrip) < w.cfg.Cooldown {
+		return
+	}
+	w.lastTrip = now
+
+	ev := log.Warn().
+		Strs("exceeded", exceeded).
+		Int("goroutines", goroutines).
+		Int64("heap_bytes", heap).
+		Array("offenders", w.offenders(now))
+	if w.cfg.ProfileDir != "" {
+		files, err := w.writeProfiles(now)
+		if err != nil {
+			ev = ev.AnErr("profile_error", err)
+		}
+		ev = ev.Strs("profiles", files)
+	}
+	ev.Msg("Watchdog threshold exceeded")
+}
+
+func (w *Watchdog) offenders(now time.Time) *zerolog.Array {
+	arr := zerolog.Arr()
+	if w.opts.InFlight == nil {
+		return arr
+	}
+
+	stats := w.opts.InFlight.Snapshot()
+	for _, st := range stats[:min(offenders, len(stats))] {
+		key := st.APIKey
+		if w.opts.APIKey != nil {
+			key = w.opts.APIKey(key)
+		}
+		arr.Dict(zerolog.Dict().
+			Str("api_key", key).
+			Int("in_flight", st.Count).
+			Dur("oldest_age", now.Sub(st.OldestStart)))
+	}
+
+	return arr
+}
+
+// writeProfiles saves the heap and goroutine profiles and removes the oldest beyond max_profiles.
+func (w *Watchdog) writeProfiles(now time.Time) ([]string, error) {
+	if err := os.MkdirAll(w.cfg.ProfileDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range profiles {
+		path := filepath.Join(w.cfg.ProfileDir, fmt.Sprintf("%s-%s.pb.gz", name, now.UTC().Format("20060102T150405.000Z")))
+		if err := writeProfile(name, path); err != nil {
+			return files, err
+		}
+		files = append(files, path)
+
+		if err := prune(w.cfg.ProfileDir, name+"-", w.cfg.MaxProfiles); err != nil {
+			return files, err
+		}
+	}
+
+	return files, nil
+}
+
+func writeProfile(name, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// prune keeps the newest keep files in dir starting with prefix; their timestamps sort by name.
+func prune(dir, prefix string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) <= keep {
+		return nil
+	}
+
+	sort.Strings(names)
+	for _, name := range names[:len(names)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func usage() (int, int64) {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+
+	var heap int64
+	if sample[0].Value.Kind() == metrics.KindUint64 {
+		heap = int64(sample[0].Value.Uint64())
+	}
+
+	return runtime.NumGoroutine(), heap
+}
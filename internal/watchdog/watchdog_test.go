@@ -0,0 +1,90 @@
+package watchdog
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"tyk-proxy/internal/config"
+	"tyk-proxy/internal/inflight"
+)
+
+type fakeInFlight []inflight.KeyStats
+
+func (f fakeInFlight) Snapshot() []inflight.KeyStats { return f }
+
+func newTestWatchdog(t *testing.T, cfg config.Watchdog, goroutines int, heap int64) (*Watchdog, *time.Time) {
+	t.Helper()
+
+	now := time.Unix(1000, 0)
+	w := New(cfg, Options{InFlight: fakeInFlight{{APIKey: "k1", Count: 3, OldestStart: now}}})
+	w.now = func() time.Time { return now }
+	w.usage = func() (int, int64) { return goroutines, heap }
+	return w, &now
+}
+
+func profileFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("read dir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestWatchdog_WritesProfilesOncePerCooldown(t *testing.T) {
+	dir := t.TempDir()
+	w, now := newTestWatchdog(t, config.Watchdog{
+		MaxHeapBytes: 100, ProfileDir: dir, Cooldown: time.Minute, MaxProfiles: 2,
+	}, 10, 200)
+
+	w.check()
+	files := profileFiles(t, dir)
+	if len(files) != 2 || !strings.HasPrefix(files[0], "goroutine-") || !strings.HasPrefix(files[1], "heap-") {
+		t.Fatalf("files=%v want one goroutine and one heap profile", files)
+	}
+
+	*now = now.Add(30 * time.Second)
+	w.check()
+	if files := profileFiles(t, dir); len(files) != 2 {
+		t.Fatalf("files=%v want no new profiles within the cooldown", files)
+	}
+
+	for range 3 {
+		*now = now.Add(time.Minute)
+		w.check()
+	}
+	if files := profileFiles(t, dir); len(files) != 4 {
+		t.Fatalf("files=%v want the newest 2 of each kind", files)
+	}
+}
+
+func TestWatchdog_BelowThresholds(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := newTestWatchdog(t, config.Watchdog{
+		MaxGoroutines: 100, MaxHeapBytes: 100, ProfileDir: dir, Cooldown: time.Minute, MaxProfiles: 2,
+	}, 100, 100)
+
+	w.check()
+	if files := profileFiles(t, dir); len(files) != 0 {
+		t.Fatalf("files=%v want none at the thresholds", files)
+	}
+}
+
+func TestWatchdog_GoroutineThreshold(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := newTestWatchdog(t, config.Watchdog{
+		MaxGoroutines: 100, ProfileDir: dir, Cooldown: time.Minute, MaxProfiles: 2,
+	}, 101, 1<<40)
+
+	w.check()
+	if files := profileFiles(t, dir); len(files) != 2 {
+		t.Fatalf("files=%v want profiles after too many goroutines", files)
+	}
+}
@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Health tracks the Redis command error rate over a rolling window and reports Redis as degraded
+// once the rate reaches the threshold. It recovers when the rate drops below half the threshold,
+// so a rate hovering around the threshold does not flap. Register it with AddHook.
+type Health struct {
+	mu       sync.Mutex
+	buckets  []healthBucket // one per second of the window
+	lastEval int64
+
+	threshold  float64
+	minSamples int
+	onChange   func(degraded bool, errorRate float64)
+
+	degraded atomic.Bool
+
+	// for tests
+	now func() time.Time
+}
+
+type healthBucket struct {
+	sec        int64
+	ok, failed int
+}
+
+type HealthOptions struct {
+	Window     time.Duration
+	Threshold  float64 // error ratio, 0..1
+	MinSamples int     // commands needed in the window before the rate is trusted
+
+	// OnChange is called on every transition, outside of any lock.
+	OnChange func(degraded bool, errorRate float64)
+
+	// for tests
+	Now func() time.Time
+}
+
+func NewHealth(opts HealthOptions) *Health {
+	secs := int(opts.Window / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Health{
+		buckets:    make([]healthBucket, secs),
+		threshold:  opts.Threshold,
+		minSamples: opts.MinSamples,
+		onChange:   opts.OnChange,
+		now:        now,
+	}
+}
+
+// Degraded reports whether the error rate is currently over the threshold.
+func (h *Health) Degraded() bool {
+	return h != nil && h.degraded.Load()
+}
+
+// Record counts the outcome of one command.
+func (h *Health) Record(err error) {
+	if errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) || redis.HasErrorPrefix(err, "NOSCRIPT") {
+		// a missing key or script is an answer, and a caller giving up says nothing about Redis
+		err = nil
+	}
+
+	sec := h.now().Unix()
+
+	h.mu.Lock()
+	b := &h.buckets[sec%int64(len(h.buckets))]
+	if b.sec != sec {
+		*b = healthBucket{sec: sec}
+	}
+	if err != nil {
+		b.failed++
+	} else {
+		b.ok++
+	}
+
+	// re-evaluated at most once a second; the window moves in whole seconds anyway
+	if h.lastEval == sec {
+		h.mu.Unlock()
+		return
+	}
+	h.lastEval = sec
+	rate, samples := h.rateLocked(sec)
+	h.mu.Unlock()
+
+	h.evaluate(rate, samples)
+}
+
+// ErrorRate returns the error ratio and the number of commands in the current window.
+func (h *Health) ErrorRate() (float64, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.rateLocked(h.now().Unix())
+}
+
+func (h *Health) rateLocked(sec int64) (float64, int) {
+	var ok, failed int
+	oldest := sec - int64(len(h.buckets)) + 1
+	for _, b := range h.buckets {
+		if b.sec >= oldest {
+			ok += b.ok
+			failed += b.failed
+		}
+	}
+
+	total := ok + failed
+	if total == 0 {
+		return 0, 0
+	}
+
+	return float64(failed) / float64(total), total
+}
+
+func (h *Health) evaluate(rate float64, samples int) {
+	if samples < h.minSamples {
+		return
+	}
+
+	var flipped bool
+	if h.degraded.Load() {
+		flipped = rate < h.threshold/2 && h.degraded.CompareAndSwap(true, false)
+	} else {
+		flipped = rate >= h.threshold && h.degraded.CompareAndSwap(false, true)
+	}
+
+	if flipped && h.onChange != nil {
+		h.onChange(h.degraded.Load(), rate)
+	}
+}
+
+func (h *Health) DialHook(next redis.DialHook) redis.DialHook {
+	// dial failures surface again as the error of the command that needed the connection
+	return next
+}
+
+func (h *Health) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		h.Record(err)
+		return err
+	}
+}
+
+func (h *Health) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		h.Record(err)
+		return err
+	}
+}
@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestHealth_Transitions(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	var changes []bool
+	h := NewHealth(HealthOptions{
+		Window:     10 * time.Second,
+		Threshold:  0.5,
+		MinSamples: 10,
+		OnChange:   func(degraded bool, _ float64) { changes = append(changes, degraded) },
+		Now:        func() time.Time { return now },
+	})
+
+	boom := errors.New("connection refused")
+	record := func(ok, failed int) {
+		for i := 0; i < ok; i++ {
+			h.Record(nil)
+		}
+		for i := 0; i < failed; i++ {
+			h.Record(boom)
+		}
+		// state is evaluated on the first command of each second
+		now = now.Add(time.Second)
+		h.Record(nil)
+	}
+
+	// misses and cancelled callers are not failures
+	for i := 0; i < 20; i++ {
+		h.Record(redis.Nil)
+	}
+	record(0, 0)
+	if h.Degraded() {
+		t.Fatalf("degraded on redis.Nil")
+	}
+
+	// too few samples to judge
+	now = now.Add(time.Minute)
+	record(0, 5)
+	if h.Degraded() {
+		t.Fatalf("degraded below min samples")
+	}
+
+	record(2, 20)
+	if !h.Degraded() {
+		rate, n := h.ErrorRate()
+		t.Fatalf("not degraded at rate=%.2f samples=%d", rate, n)
+	}
+
+	// under the threshold but above half of it: stays degraded
+	now = now.Add(time.Minute)
+	record(50, 20)
+	if !h.Degraded() {
+		t.Fatalf("recovered at 28%% errors, want hysteresis until below 25%%")
+	}
+
+	now = now.Add(time.Minute)
+	record(100, 1)
+	if h.Degraded() {
+		t.Fatalf("still degraded after recovery")
+	}
+
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Fatalf("changes=%v want=[true false]", changes)
+	}
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -10,10 +11,50 @@ type Redis struct {
 	*redis.Client
 }
 
-func NewRedis(ctx context.Context, addr string) (*Redis, error) {
-	rd := redis.NewClient(&redis.Options{Addr: addr})
+// Options are the connection settings shared by the primary and its replicas.
+type Options struct {
+	Username string // ACL user; empty authenticates as the default user
+	Password string
+	DB       int
+	TLS      *tls.Config // nil for plain TCP
+}
+
+func (o Options) options(addr string) *redis.Options {
+	return &redis.Options{
+		Addr:      addr,
+		Username:  o.Username,
+		Password:  o.Password,
+		DB:        o.DB,
+		TLSConfig: o.TLS,
+	}
+}
+
+func (o Options) client(addr string) *redis.Client {
+	return redis.NewClient(o.options(addr))
+}
+
+// NewClient returns a client for addr without checking that it is reachable.
+func NewClient(addr string, opts Options) *Redis {
+	return &Redis{opts.client(addr)}
+}
+
+// NewTrackingClient returns a client for a subscription receiving CLIENT TRACKING invalidations: onConnect runs
+// on every connection it opens, including reconnects. It speaks RESP2, where invalidations redirected to a
+// subscribed connection arrive as messages on __redis__:invalidate; go-redis cannot read RESP3 invalidate pushes
+// on an idle subscription.
+func NewTrackingClient(addr string, opts Options, onConnect func(ctx context.Context, cn *redis.Conn) error) *Redis {
+	o := opts.options(addr)
+	o.Protocol = 2
+	o.OnConnect = onConnect
+
+	return &Redis{redis.NewClient(o)}
+}
+
+func NewRedis(ctx context.Context, addr string, opts Options) (*Redis, error) {
+	rd := opts.client(addr)
 	st := rd.Ping(ctx)
 	if st.Err() != nil {
+		rd.Close()
 		return nil, st.Err()
 	}
 
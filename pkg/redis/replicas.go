@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Replicas spreads reads over replicas that are connected to the primary and within the staleness budget.
+// When no replica qualifies, reads fall back to the primary.
+type Replicas struct {
+	primary      redis.UniversalClient
+	clients      []*redis.Client
+	maxStaleness time.Duration
+
+	healthy atomic.Pointer[[]*redis.Client]
+	next    atomic.Uint64
+}
+
+func NewReplicas(primary redis.UniversalClient, addrs []string, opts Options, maxStaleness time.Duration) *Replicas {
+	r := &Replicas{
+		primary:      primary,
+		maxStaleness: maxStaleness,
+	}
+	for _, addr := range addrs {
+		r.clients = append(r.clients, opts.client(addr))
+	}
+
+	none := []*redis.Client{}
+	r.healthy.Store(&none)
+
+	return r
+}
+
+// Reader returns a client for read-only commands.
+func (r *Replicas) Reader() redis.UniversalClient {
+	healthy := *r.healthy.Load()
+	if len(healthy) == 0 {
+		return r.primary
+	}
+
+	return healthy[r.next.Add(1)%uint64(len(healthy))]
+}
+
+// Run checks replica health every interval until ctx is done.
+func (r *Replicas) Run(ctx context.Context, interval time.Duration) {
+	r.check(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.check(ctx)
+		}
+	}
+}
+
+func (r *Replicas) check(ctx context.Context) {
+	healthy := make([]*redis.Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		cctx, cancel := context.WithTimeout(ctx, time.Second)
+		info, err := c.Info(cctx, "replication").Result()
+		cancel()
+
+		if err != nil {
+			log.Warn().Err(err).Str("replica", c.Options().Addr).Msg("redis replica unavailable")
+			continue
+		}
+
+		if ok, reason := r.fresh(info); !ok {
+			log.Warn().Str("replica", c.Options().Addr).Str("reason", reason).Msg("redis replica skipped")
+			continue
+		}
+
+		healthy = append(healthy, c)
+	}
+
+	r.healthy.Store(&healthy)
+}
+
+// fresh decides from INFO replication whether a replica may serve reads. Redis does not expose lag
+// in time directly; master_last_io_seconds_ago is the closest bound we have.
+func (r *Replicas) fresh(info string) (bool, string) {
+	fields := map[string]string{}
+	sc := bufio.NewScanner(strings.NewReader(info))
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(strings.TrimSpace(sc.Text()), ":"); ok {
+			fields[k] = v
+		}
+	}
+
+	if fields["role"] != "slave" {
+		return false, "not a replica"
+	}
+	if fields["master_link_status"] != "up" {
+		return false, "link to primary is down"
+	}
+	if fields["master_sync_in_progress"] == "1" {
+		return false, "sync in progress"
+	}
+
+	lastIO, err := strconv.Atoi(fields["master_last_io_seconds_ago"])
+	if err != nil || time.Duration(lastIO)*time.Second > r.maxStaleness {
+		return false, "stale"
+	}
+
+	return true, ""
+}
+
+func (r *Replicas) Close() error {
+	var firstErr error
+	for _, c := range r.clients {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplicas_Fresh(t *testing.T) {
+	r := &Replicas{maxStaleness: 5 * time.Second}
+
+	tests := []struct {
+		name string
+		info string
+		want bool
+	}{
+		{
+			name: "healthy replica",
+			info: "# Replication\r\nrole:slave\r\nmaster_link_status:up\r\nmaster_last_io_seconds_ago:1\r\nmaster_sync_in_progress:0\r\n",
+			want: true,
+		},
+		{
+			name: "primary",
+			info: "# Replication\r\nrole:master\r\nconnected_slaves:1\r\n",
+		},
+		{
+			name: "link down",
+			info: "role:slave\r\nmaster_link_status:down\r\nmaster_last_io_seconds_ago:-1\r\n",
+		},
+		{
+			name: "syncing",
+			info: "role:slave\r\nmaster_link_status:up\r\nmaster_last_io_seconds_ago:0\r\nmaster_sync_in_progress:1\r\n",
+		},
+		{
+			name: "stale",
+			info: "role:slave\r\nmaster_link_status:up\r\nmaster_last_io_seconds_ago:9\r\nmaster_sync_in_progress:0\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := r.fresh(tt.info)
+			if got != tt.want {
+				t.Fatalf("fresh=%v want=%v (reason=%q)", got, tt.want, reason)
+			}
+		})
+	}
+}
+
+func TestReplicas_ReaderFallsBackToPrimary(t *testing.T) {
+	primary := NewReplicas(nil, nil, Options{}, time.Second)
+	if got := primary.Reader(); got != nil {
+		t.Fatalf("reader=%v want primary", got)
+	}
+}
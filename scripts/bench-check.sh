@@ -0,0 +1,38 @@
+#!/bin/sh
+# Compares two `go test -bench` outputs and fails when any benchmark got slower than the threshold.
+# usage: bench-check.sh <baseline> <current> <max regression, percent>
+set -eu
+
+baseline=$1
+current=$2
+threshold=$3
+
+if [ ! -f "$baseline" ]; then
+	echo "no baseline at $baseline; run 'make bench-base' or 'make bench-baseline' on the reference revision first" >&2
+	exit 2
+fi
+
+# mean ns/op per package and benchmark (runs with -count N produce N lines per name)
+awk -v threshold="$threshold" '
+	FNR == 1 { file++; pkg = "" }
+	/^pkg: / { pkg = $2 }
+	/^Benchmark/ {
+		for (i = 1; i <= NF; i++) if ($(i+1) == "ns/op") {
+			name = $1; sub(/-[0-9]+$/, "", name); name = pkg "." name
+			sum[file, name] += $i; cnt[file, name]++
+			names[name] = 1
+		}
+	}
+	END {
+		failed = 0
+		for (n in names) {
+			if (!cnt[1, n] || !cnt[2, n]) continue
+			base = sum[1, n] / cnt[1, n]; cur = sum[2, n] / cnt[2, n]
+			delta = (cur - base) / base * 100
+			status = "ok"
+			if (delta > threshold) { status = "REGRESSION"; failed = 1 }
+			printf "%-70s %12.0f -> %12.0f ns/op  %+7.1f%%  %s\n", n, base, cur, delta, status
+		}
+		exit failed
+	}
+' "$baseline" "$current"